@@ -1047,6 +1047,21 @@ const (
 	// Operands stack effect: no changes
 	Ret Op = 169 // ret
 
+	// Tableswitch - continue execution from an address in the table at offset `index`.
+	// Operands are aligned to the 4-byte boundary relative to the method code start.
+	//
+	// Encoding: aa + 16+: [0-3 bytes padding], defaultbyte1-4, lowbyte1-4, highbyte1-4, jump offsets...
+	// Operands stack effect: (index →)
+	Tableswitch Op = 170 // tableswitch
+
+	// Lookupswitch - a target address is looked up from a table using a key
+	// and execution continues from the instruction at that address.
+	// Operands are aligned to the 4-byte boundary relative to the method code start.
+	//
+	// Encoding: ab + 8+: [0-3 bytes padding], defaultbyte1-4, npairs1-4, match-offset pairs...
+	// Operands stack effect: (key →)
+	Lookupswitch Op = 171 // lookupswitch
+
 	// Ireturn - return an integer from a method.
 	//
 	// Encoding: ac
@@ -1203,6 +1218,16 @@ const (
 	// Operands stack effect: (objectref →)
 	Monitorexit Op = 195 // monitorexit
 
+	// Wide - execute `opcode`, where `opcode` is either iload, fload, aload, lload, dload,
+	// istore, fstore, astore, lstore, dstore, or ret, but assume the `index` is 16 bit;
+	// or execute iinc, where the `index` is 16 bits and the constant to increment by
+	// is a signed 16 bit short.
+	//
+	// Encoding: c4 + 3/5: opcode, indexbyte1, indexbyte2
+	//           or iinc, indexbyte1, indexbyte2, countbyte1, countbyte2
+	// Operands stack effect: [same as for corresponding instructions]
+	Wide Op = 196 // wide
+
 	// Multianewarray - create a new array of `dimensions` dimensions of type
 	// identified by class reference in constant pool `index` (indexbyte1 << 8 + indexbyte2);
 	// the sizes of each dimension is identified by count1, [count2, etc.]
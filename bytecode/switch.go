@@ -0,0 +1,104 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Switch is a decoded tableswitch or lookupswitch instruction.
+//
+// All offsets are relative to the switch instruction address.
+type Switch struct {
+	// Width is an encoded instruction width, including the padding.
+	Width int
+
+	// Default is a jump offset that is used when no key matches.
+	Default int32
+
+	// Keys are sorted in ascending order.
+	// Keys[i] is associated with Offsets[i] jump offset.
+	// For tableswitch, keys are low...high values.
+	Keys    []int32
+	Offsets []int32
+}
+
+// DecodeSwitch decodes a tableswitch or lookupswitch instruction
+// that starts at code[pc].
+func DecodeSwitch(code []byte, pc int) (Switch, error) {
+	var sw Switch
+	width, start, err := switchHeader(code, pc)
+	if err != nil {
+		return sw, err
+	}
+	sw.Width = width
+	sw.Default = readInt32(code, start)
+
+	switch Op(code[pc]) {
+	case Tableswitch:
+		low := readInt32(code, start+4)
+		high := readInt32(code, start+8)
+		n := int(int64(high) - int64(low) + 1)
+		sw.Keys = make([]int32, n)
+		sw.Offsets = make([]int32, n)
+		for i := 0; i < n; i++ {
+			sw.Keys[i] = low + int32(i)
+			sw.Offsets[i] = readInt32(code, start+12+i*4)
+		}
+	case Lookupswitch:
+		n := int(readInt32(code, start+4))
+		sw.Keys = make([]int32, n)
+		sw.Offsets = make([]int32, n)
+		for i := 0; i < n; i++ {
+			pair := start + 8 + i*8
+			sw.Keys[i] = readInt32(code, pair)
+			sw.Offsets[i] = readInt32(code, pair+4)
+			if i != 0 && sw.Keys[i-1] >= sw.Keys[i] {
+				return sw, errors.New("lookupswitch keys are not sorted")
+			}
+		}
+	}
+
+	return sw, nil
+}
+
+// switchHeader validates the switch instruction header and returns
+// its total width along with the padded operands start offset.
+func switchHeader(code []byte, pc int) (width, start int, err error) {
+	// Operands are aligned to the 4-byte boundary
+	// relative to the first code byte.
+	start = (pc + 4) &^ 3
+	if start+8 > len(code) {
+		return 0, 0, errors.New("switch is truncated")
+	}
+
+	var tableLen int64
+	switch Op(code[pc]) {
+	case Tableswitch:
+		if start+12 > len(code) {
+			return 0, 0, errors.New("tableswitch is truncated")
+		}
+		low := int64(readInt32(code, start+4))
+		high := int64(readInt32(code, start+8))
+		if low > high {
+			return 0, 0, errors.New("tableswitch low is greater than high")
+		}
+		tableLen = 12 + (high-low+1)*4
+	case Lookupswitch:
+		npairs := int64(readInt32(code, start+4))
+		if npairs < 0 {
+			return 0, 0, errors.New("lookupswitch npairs is negative")
+		}
+		tableLen = 8 + npairs*8
+	default:
+		return 0, 0, errors.New("not a switch instruction")
+	}
+
+	if int64(start)+tableLen > int64(len(code)) {
+		return 0, 0, errors.New("switch is truncated")
+	}
+	return start + int(tableLen) - pc, start, nil
+}
+
+func readInt32(code []byte, offset int) int32 {
+	return int32(binary.BigEndian.Uint32(code[offset:]))
+}
@@ -0,0 +1,119 @@
+package bytecode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeSwitch(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+		pc   int
+		want Switch
+		err  string
+	}{
+		{
+			name: "tableswitch",
+			code: []byte{
+				byte(Nop), byte(Tableswitch), 0, 0,
+				0, 0, 0, 20, // default
+				0, 0, 0, 1, // low
+				0, 0, 0, 2, // high
+				0, 0, 0, 24,
+				0xff, 0xff, 0xff, 0xff,
+			},
+			pc: 1,
+			want: Switch{
+				Width:   23,
+				Default: 20,
+				Keys:    []int32{1, 2},
+				Offsets: []int32{24, -1},
+			},
+		},
+		{
+			name: "lookupswitch",
+			code: []byte{
+				byte(Lookupswitch), 0, 0, 0,
+				0, 0, 0, 30, // default
+				0, 0, 0, 2, // npairs
+				0xff, 0xff, 0xff, 0xfe, 0, 0, 0, 40,
+				0, 0, 0x10, 0, 0, 0, 0, 50,
+			},
+			want: Switch{
+				Width:   28,
+				Default: 30,
+				Keys:    []int32{-2, 4096},
+				Offsets: []int32{40, 50},
+			},
+		},
+		{
+			name: "lookupswitch empty",
+			code: []byte{
+				byte(Nop), byte(Nop), byte(Nop), byte(Lookupswitch),
+				0, 0, 0, 5,
+				0, 0, 0, 0,
+			},
+			pc: 3,
+			want: Switch{
+				Width:   9,
+				Default: 5,
+				Keys:    []int32{},
+				Offsets: []int32{},
+			},
+		},
+		{
+			name: "truncated table",
+			code: []byte{
+				byte(Tableswitch), 0, 0, 0,
+				0, 0, 0, 0,
+				0, 0, 0, 0,
+				0, 0, 0, 1,
+				0, 0, 0, 0,
+			},
+			err: "switch is truncated",
+		},
+		{
+			name: "bad range",
+			code: []byte{
+				byte(Tableswitch), 0, 0, 0,
+				0, 0, 0, 0,
+				0, 0, 0, 1,
+				0, 0, 0, 0,
+			},
+			err: "tableswitch low is greater than high",
+		},
+		{
+			name: "unsorted keys",
+			code: []byte{
+				byte(Lookupswitch), 0, 0, 0,
+				0, 0, 0, 0,
+				0, 0, 0, 2,
+				0, 0, 0, 2, 0, 0, 0, 0,
+				0, 0, 0, 1, 0, 0, 0, 0,
+			},
+			err: "lookupswitch keys are not sorted",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sw, err := DecodeSwitch(test.code, test.pc)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error mismatch:\nhave: %v\nwant: %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(sw, test.want) {
+				t.Errorf("result mismatch:\nhave: %+v\nwant: %+v", sw, test.want)
+			}
+			if width := InstWidth(test.code, test.pc); width != test.want.Width {
+				t.Errorf("InstWidth mismatch: have %d, want %d", width, test.want.Width)
+			}
+		})
+	}
+}
@@ -210,3 +210,29 @@ var OpWidth = [256]byte{
 	Impdep1:         1 + 0,
 	Impdep2:         1 + 0,
 }
+
+// InstWidth returns an encoding width of the instruction that
+// starts at code[pc].
+//
+// Unlike OpWidth, it also handles variadic-length instructions.
+// It returns 0 if instruction can't be decoded.
+func InstWidth(code []byte, pc int) int {
+	switch Op(code[pc]) {
+	case Tableswitch, Lookupswitch:
+		width, _, err := switchHeader(code, pc)
+		if err != nil {
+			return 0
+		}
+		return width
+	case Wide:
+		if pc+1 >= len(code) {
+			return 0
+		}
+		if Op(code[pc+1]) == Iinc {
+			return 6
+		}
+		return 4
+	default:
+		return int(OpWidth[code[pc]])
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/jit/x64"
+)
+
+// asmLine is a single disassembled machine instruction.
+type asmLine struct {
+	offset int
+	text   string
+}
+
+func (l asmLine) String() string {
+	return fmt.Sprintf("%4d  %s", l.offset, l.text)
+}
+
+// disasm decodes the machine code for the current GOARCH.
+// For the architectures without a disassembler,
+// the code is printed as hex chunks.
+func disasm(code []byte) []asmLine {
+	var lines []asmLine
+	if runtime.GOARCH == "amd64" {
+		for _, inst := range x64.Disasm(code) {
+			lines = append(lines, asmLine{offset: inst.Offset, text: inst.Text})
+		}
+		return lines
+	}
+	for offset := 0; offset < len(code); offset += 16 {
+		end := offset + 16
+		if end > len(code) {
+			end = len(code)
+		}
+		lines = append(lines, asmLine{offset: offset, text: fmt.Sprintf("%x", code[offset:end])})
+	}
+	return lines
+}
+
+// methodAsm is a machine code of the method split by the IR instructions.
+type methodAsm struct {
+	// prologue is a code that precedes the first IR instruction.
+	prologue []asmLine
+
+	// insts are the machine instructions of every IR instruction.
+	insts [][]asmLine
+}
+
+func disasmMethod(m *ir.Method) methodAsm {
+	var result methodAsm
+	lines := disasm(m.Out.Code)
+	if len(m.CodeOffsets) != len(m.Code) {
+		// Offsets are unknown, print everything as a prologue.
+		result.prologue = lines
+		return result
+	}
+	result.insts = make([][]asmLine, len(m.Code))
+	i := -1
+	for _, l := range lines {
+		for i+1 < len(m.CodeOffsets) && l.offset >= m.CodeOffsets[i+1] {
+			i++
+		}
+		if i == -1 {
+			result.prologue = append(result.prologue, l)
+		} else {
+			result.insts[i] = append(result.insts[i], l)
+		}
+	}
+	return result
+}
@@ -12,18 +12,28 @@ import (
 	"github.com/quasilyte/go-jdk/ir"
 	"github.com/quasilyte/go-jdk/irfmt"
 	"github.com/quasilyte/go-jdk/irgen"
+	"github.com/quasilyte/go-jdk/iropt"
 	"github.com/quasilyte/go-jdk/javap"
 	"github.com/quasilyte/go-jdk/jit"
 	"github.com/quasilyte/go-jdk/jruntime"
 	"github.com/quasilyte/go-jdk/loader"
+	"github.com/quasilyte/go-jdk/vmdat"
 )
 
 func javapMain() error {
 	var cmd javapCommand
 	flag.StringVar(&cmd.format, "format", "raw",
-		`output format: raw or ir`)
+		`output format: raw, ir, asm, dot (IR CFG) or rawdot (bytecode CFG)`)
 	flag.StringVar(&cmd.classPath, "cp", "",
 		`class path to use`)
+	flag.BoolVar(&cmd.noVerify, "noverify", false,
+		`disable the bytecode verification`)
+	flag.BoolVar(&cmd.debug, "debug", false,
+		`enable the IR verification after every compilation stage`)
+	flag.StringVar(&cmd.passes, "passes", "",
+		`comma-separated list of IR optimization passes or "none"; empty means default pipeline`)
+	flag.BoolVar(&cmd.stackMap, "stackmap", false,
+		`annotate rawdot blocks with the StackMapTable frame stack depths`)
 	flag.Parse()
 
 	filenames := flag.Args()
@@ -39,19 +49,33 @@ func javapMain() error {
 type javapCommand struct {
 	format    string
 	classPath string
+	noVerify  bool
+	debug     bool
+	passes    string
+	stackMap  bool
+}
+
+// methodIR is a printed method IR snapshot.
+type methodIR struct {
+	slots int
+	lines []string
 }
 
 func (cmd *javapCommand) printFile(filename string) error {
-	if cmd.format == "raw" {
+	switch cmd.format {
+	case "raw", "rawdot":
 		jf, err := cmdutil.DecodeClassFile(filename)
 		if err != nil {
 			return fmt.Errorf("decode error: %v", err)
 		}
-		javap.Fprint(os.Stdout, jf)
+		if cmd.format == "rawdot" {
+			javap.FprintDot(os.Stdout, jf, cmd.stackMap)
+		} else {
+			javap.Fprint(os.Stdout, jf)
+		}
 		return nil
-	}
-
-	if cmd.format != "ir" {
+	case "ir", "asm", "dot":
+	default:
 		return fmt.Errorf("unknown format: %s", cmd.format)
 	}
 
@@ -63,13 +87,33 @@ func (cmd *javapCommand) printFile(filename string) error {
 
 	toCompile, err := loader.LoadClass(&vm.State, filename, &loader.Config{
 		ClassPath: []string{cmd.classPath},
+		NoVerify:  cmd.noVerify,
 	})
 	if err != nil {
 		return fmt.Errorf("load class: %v", err)
 	}
-	if err := irgen.Generate(&vm.State, toCompile); err != nil {
+	if err := irgen.Generate(&vm.State, toCompile, &irgen.Config{Debug: cmd.debug}); err != nil {
 		return fmt.Errorf("irgen: %v", err)
 	}
+
+	// Remember the unoptimized IR to print it along with the final code.
+	before := make(map[*ir.Method]methodIR)
+	for _, pkg := range toCompile {
+		for i := range pkg.Classes {
+			for j := range pkg.Classes[i].Methods {
+				m := &pkg.Classes[i].Methods[j]
+				before[m] = formatMethodIR(&vm.State, m)
+			}
+		}
+	}
+	optConfig := &iropt.Config{
+		Debug:  cmd.debug,
+		Passes: cmdutil.ParsePasses(cmd.passes),
+	}
+	stats, err := iropt.Optimize(&vm.State, toCompile, optConfig)
+	if err != nil {
+		return fmt.Errorf("iropt: %v", err)
+	}
 	jitCtx := jit.Context{
 		Mmap:  &vm.Mmap,
 		State: &vm.State,
@@ -88,31 +132,99 @@ func (cmd *javapCommand) printFile(filename string) error {
 		}
 	}
 
+	if cmd.format == "dot" {
+		for i := range class.Methods {
+			irfmt.FprintDot(os.Stdout, &vm.State, &class.Methods[i])
+		}
+		return nil
+	}
+
+	if cmd.format == "asm" {
+		fmt.Printf("class %q\n", class.Name)
+		for i := range class.Methods {
+			m := &class.Methods[i]
+			fmt.Printf("  method %s (slots=%d, %d bytes):\n",
+				m.Out.Name, m.Out.FrameSlots, len(m.Out.Code))
+			mir := formatMethodIR(&vm.State, m)
+			code := disasmMethod(m)
+			printAsm(code.prologue)
+			for i, insts := range code.insts {
+				fmt.Printf("        // %s\n", mir.lines[i])
+				printAsm(insts)
+			}
+		}
+		return nil
+	}
+
 	fmt.Printf("class %q\n", class.Name)
 	for i := range class.Methods {
 		m := &class.Methods[i]
-		fmt.Printf("  method %s (slots=%d):\n", m.Out.Name, m.Out.FrameSlots)
-		blockIndex := -1
-		for i, inst := range m.Code {
-			if inst.Flags.IsBlockLead() {
-				blockIndex++
-			}
-			fmt.Printf("        b%d %3d: %s\n", blockIndex, i, irfmt.Sprint(&vm.State, inst))
+		after := formatMethodIR(&vm.State, m)
+		fmt.Printf("  method %s (slots=%d):\n", m.Out.Name, after.slots)
+		if old := before[m]; !old.equal(after) {
+			fmt.Printf("    before optimization (slots=%d):\n", old.slots)
+			old.print()
+			fmt.Printf("    after optimization:\n")
+		}
+		if len(m.Out.Code) == 0 {
+			after.print()
+			continue
 		}
-		code := m.Out.Code
-		var codeChunks []string
-		for len(code) != 0 {
-			length := 32
-			if len(code) < length {
-				length = len(code)
+		// Every IR instruction is followed by its machine code.
+		code := disasmMethod(m)
+		printAsm(code.prologue)
+		for i, l := range after.lines {
+			fmt.Printf("        %s\n", l)
+			if i < len(code.insts) {
+				printAsm(code.insts[i])
 			}
-			codeChunks = append(codeChunks, fmt.Sprintf("        %x", code[:length]))
-			code = code[length:]
 		}
-		if len(codeChunks) != 0 {
-			fmt.Printf("%s (%d bytes)\n", strings.Join(codeChunks, "\n"), len(m.Out.Code))
+		fmt.Printf("        (%d bytes)\n", len(m.Out.Code))
+	}
+
+	if len(stats.Passes) != 0 {
+		fmt.Printf("optimizations:\n")
+		for _, p := range stats.Passes {
+			fmt.Printf("  %s: %d changes, %d instructions removed\n",
+				p.Name, p.Changes, p.Removed)
 		}
 	}
 
 	return nil
 }
+
+func formatMethodIR(st *vmdat.State, m *ir.Method) methodIR {
+	lines := make([]string, len(m.Code))
+	blockIndex := -1
+	for i, inst := range m.Code {
+		if inst.Flags.IsBlockLead() {
+			blockIndex++
+		}
+		lines[i] = fmt.Sprintf("b%d %3d: %s", blockIndex, i, irfmt.Sprint(st, inst))
+	}
+	return methodIR{slots: m.Out.FrameSlots, lines: lines}
+}
+
+func (mir methodIR) equal(other methodIR) bool {
+	if mir.slots != other.slots || len(mir.lines) != len(other.lines) {
+		return false
+	}
+	for i := range mir.lines {
+		if mir.lines[i] != other.lines[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func printAsm(lines []asmLine) {
+	for _, l := range lines {
+		fmt.Printf("            %s\n", l)
+	}
+}
+
+func (mir methodIR) print() {
+	for _, l := range mir.lines {
+		fmt.Printf("        %s\n", l)
+	}
+}
@@ -11,7 +11,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/quasilyte/go-jdk/cmd/internal/cmdutil"
+	"github.com/quasilyte/go-jdk/ir"
 	"github.com/quasilyte/go-jdk/irgen"
+	"github.com/quasilyte/go-jdk/iropt"
 	"github.com/quasilyte/go-jdk/jit"
 	"github.com/quasilyte/go-jdk/jruntime"
 	"github.com/quasilyte/go-jdk/loader"
@@ -30,8 +33,20 @@ func runMain() error {
 		`verbose output mode`)
 	flag.StringVar(&cmd.classPath, "cp", "",
 		`class path to use`)
+	flag.BoolVar(&cmd.noVerify, "noverify", false,
+		`disable the bytecode verification`)
+	flag.BoolVar(&cmd.lazyCode, "lazycode", false,
+		`decode and verify method bodies right before their IR generation; with -lazy, it's deferred until the first call`)
 	flag.IntVar(&cmd.heapMem, "heapmem", 0,
 		`allocation bytes limit`)
+	flag.BoolVar(&cmd.debug, "debug", false,
+		`enable the IR verification after every compilation stage`)
+	flag.StringVar(&cmd.passes, "passes", "",
+		`comma-separated list of IR optimization passes or "none"; empty means default pipeline`)
+	flag.IntVar(&cmd.hotThreshold, "hot", 0,
+		`enable tiered compilation with the given hot method threshold; 0 compiles everything at load`)
+	flag.BoolVar(&cmd.lazy, "lazy", false,
+		`compile methods on their first call instead of the class load`)
 	flag.Parse()
 	cmd.methodArgs = flag.Args()
 
@@ -53,6 +68,12 @@ type runCommand struct {
 	methodArgs      []string
 	classPath       string
 	verbose         bool
+	noVerify        bool
+	lazyCode        bool
+	debug           bool
+	passes          string
+	hotThreshold    int
+	lazy            bool
 }
 
 func (cmd *runCommand) run() error {
@@ -61,6 +82,11 @@ func (cmd *runCommand) run() error {
 		return fmt.Errorf("open VM: %v", err)
 	}
 	defer vm.Close()
+	if cmd.lazy {
+		if err := vm.EnableLazyCompilation(); err != nil {
+			return fmt.Errorf("enable lazy compilation: %v", err)
+		}
+	}
 
 	compileStart := time.Now()
 	class, err := cmd.loadAndCompileClass(vm, cmd.classFile)
@@ -96,7 +122,10 @@ func (cmd *runCommand) run() error {
 	log.Printf("%s.%s(%s) => %d\n", class.Name, method.Name, argsString, result)
 	if cmd.verbose {
 		log.Println("-- verbose output --")
-		log.Printf("method machine code: %x\n", method.Code)
+		log.Printf("method machine code (%d bytes):\n", len(method.Code))
+		for _, l := range disasm(method.Code) {
+			log.Printf("  %s\n", l)
+		}
 		log.Printf("class load time:  %.8fs (%d ns)\n",
 			compileTime.Seconds(), compileTime.Nanoseconds())
 		log.Printf("method call time: %.8fs (%d ns)\n",
@@ -109,18 +138,52 @@ func (cmd *runCommand) run() error {
 func (cmd *runCommand) loadAndCompileClass(vm *jruntime.VM, filename string) (*vmdat.Class, error) {
 	toCompile, err := loader.LoadClass(&vm.State, filename, &loader.Config{
 		ClassPath: []string{cmd.classPath},
+		NoVerify:  cmd.noVerify,
+		LazyCode:  cmd.lazyCode,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("load class: %v", err)
 	}
-	if err := irgen.Generate(&vm.State, toCompile); err != nil {
+	// With the lazy compilation, lazily decoded methods
+	// are decoded right before their compilation.
+	lazyIR := cmd.lazyCode && cmd.lazy
+	irgenConfig := &irgen.Config{Debug: cmd.debug, Lazy: lazyIR}
+	if err := irgen.Generate(&vm.State, toCompile, irgenConfig); err != nil {
 		return nil, fmt.Errorf("irgen: %v", err)
 	}
+	optConfig := &iropt.Config{
+		Debug:  cmd.debug,
+		Passes: cmdutil.ParsePasses(cmd.passes),
+	}
+	if cmd.hotThreshold != 0 {
+		// Methods are optimized when they become hot.
+		err := vm.EnableTiering(&jruntime.TieringConfig{
+			HotThreshold: cmd.hotThreshold,
+			Optimize:     optConfig,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("enable tiering: %v", err)
+		}
+	} else if _, err := iropt.Optimize(&vm.State, toCompile, optConfig); err != nil {
+		return nil, fmt.Errorf("iropt: %v", err)
+	}
 	ctx := jit.Context{
 		Mmap:  &vm.Mmap,
 		State: &vm.State,
 	}
 	jruntime.BindFuncs(&ctx)
+	if lazyIR {
+		ctx.GenerateIR = func(p *ir.Package) error {
+			packages := []*ir.Package{p}
+			if err := irgen.Generate(&vm.State, packages, &irgen.Config{Debug: cmd.debug}); err != nil {
+				return fmt.Errorf("irgen: %v", err)
+			}
+			if _, err := iropt.Optimize(&vm.State, packages, optConfig); err != nil {
+				return fmt.Errorf("iropt: %v", err)
+			}
+			return nil
+		}
+	}
 	if err := vm.Compiler.Compile(ctx, toCompile); err != nil {
 		return nil, fmt.Errorf("compile: %v", err)
 	}
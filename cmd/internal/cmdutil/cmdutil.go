@@ -2,6 +2,7 @@ package cmdutil
 
 import (
 	"os"
+	"strings"
 
 	"github.com/quasilyte/go-jdk/jclass"
 )
@@ -15,3 +16,16 @@ func DecodeClassFile(filename string) (*jclass.File, error) {
 	var dec jclass.Decoder
 	return dec.Decode(f)
 }
+
+// ParsePasses converts the -passes flag value into the iropt.Config.Passes.
+// Empty string selects the default pipeline, "none" disables it.
+func ParsePasses(s string) []string {
+	switch s {
+	case "":
+		return nil
+	case "none":
+		return []string{}
+	default:
+		return strings.Split(s, ",")
+	}
+}
@@ -9,8 +9,12 @@ import (
 
 // Arg is an instruction argument (sometimes called operand).
 // Value bits (int64) should be interpreted differently depending on the Kind.
+//
+// Value-carrying arguments (registers and constants) also record
+// the Type of the value, so the backends don't need to guess it.
 type Arg struct {
 	Kind  ArgKind
+	Type  Type
 	Value int64
 }
 
@@ -18,11 +18,25 @@ type Class struct {
 
 	File *jclass.File
 	Out  *vmdat.Class
+
+	// Unverified is set when the class methods bytecode verification
+	// is deferred by the loader. Every method is verified right
+	// before its IR is generated.
+	Unverified bool
 }
 
 type Method struct {
 	Code        []Inst
 	AccessFlags jclass.MethodAccessFlags
 
+	// CodeOffsets maps Code instructions to their offsets
+	// inside the Out.Code machine code. Filled by the JIT compiler.
+	CodeOffsets []int
+
+	// Lazy is set when the method IR generation is deferred
+	// until its first call, see irgen.Config.Lazy.
+	// Such methods have no Code yet.
+	Lazy bool
+
 	Out *vmdat.Method
 }
@@ -31,6 +31,15 @@ func (inst Inst) String() string {
 
 // InstKind describes instruction operation.
 // It can be treated as an "opcode" of IR abstract machine.
+//
+// InstSwitch is a multi-way branch: its arguments are the key,
+// the default branch and then the (int const, branch) pairs
+// sorted by the int const values.
+//
+// InstPhi only appears in the SSA form. It selects one of its
+// arguments depending on the predecessor block control came from.
+// Arguments follow the predecessors order: predecessor blocks
+// are sorted by their first instruction index.
 type InstKind int
 
 //go:generate stringer -type=InstKind -trimprefix=Inst
@@ -48,6 +57,7 @@ const (
 	InstCallGo
 	InstIcmp
 	InstLcmp
+	InstAcmp
 	InstJump
 	InstJumpEqual
 	InstJumpNotEqual
@@ -55,6 +65,7 @@ const (
 	InstJumpGt
 	InstJumpLt
 	InstJumpLtEq
+	InstSwitch
 	InstImul
 	InstIdiv
 	InstIadd
@@ -80,4 +91,5 @@ const (
 	InstIntArraySet
 	InstIntArrayGet
 	InstArrayLen
+	InstPhi
 )
@@ -14,6 +14,11 @@ const (
 	// Mostly needed for alignment: if instruction is a
 	// jump target, it can be beneficial to align it.
 	flagJumpTarget
+
+	// flagInBounds bit is set for the array access instructions
+	// which index is known to be within the array bounds.
+	// Backends can omit the bounds check for such instructions.
+	flagInBounds
 )
 
 func (f InstFlags) IsBlockLead() bool    { return f.getFlag(flagBlockLead) }
@@ -22,6 +27,9 @@ func (f *InstFlags) SetBlockLead(v bool) { f.setFlag(v, flagBlockLead) }
 func (f InstFlags) IsJumpTarget() bool    { return f.getFlag(flagJumpTarget) }
 func (f *InstFlags) SetJumpTarget(v bool) { f.setFlag(v, flagJumpTarget) }
 
+func (f InstFlags) IsInBounds() bool    { return f.getFlag(flagInBounds) }
+func (f *InstFlags) SetInBounds(v bool) { f.setFlag(v, flagInBounds) }
+
 func (f *InstFlags) setFlag(v bool, mask uint64) {
 	if v {
 		*f |= InstFlags(mask)
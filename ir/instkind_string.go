@@ -20,43 +20,46 @@ func _() {
 	_ = x[InstCallGo-9]
 	_ = x[InstIcmp-10]
 	_ = x[InstLcmp-11]
-	_ = x[InstJump-12]
-	_ = x[InstJumpEqual-13]
-	_ = x[InstJumpNotEqual-14]
-	_ = x[InstJumpGtEq-15]
-	_ = x[InstJumpGt-16]
-	_ = x[InstJumpLt-17]
-	_ = x[InstJumpLtEq-18]
-	_ = x[InstImul-19]
-	_ = x[InstIdiv-20]
-	_ = x[InstIadd-21]
-	_ = x[InstLadd-22]
-	_ = x[InstFadd-23]
-	_ = x[InstIsub-24]
-	_ = x[InstIneg-25]
-	_ = x[InstLneg-26]
-	_ = x[InstDadd-27]
-	_ = x[InstConvL2I-28]
-	_ = x[InstConvF2I-29]
-	_ = x[InstConvD2I-30]
-	_ = x[InstConvI2L-31]
-	_ = x[InstConvI2B-32]
-	_ = x[InstNewBoolArray-33]
-	_ = x[InstNewCharArray-34]
-	_ = x[InstNewFloatArray-35]
-	_ = x[InstNewDoubleArray-36]
-	_ = x[InstNewByteArray-37]
-	_ = x[InstNewShortArray-38]
-	_ = x[InstNewIntArray-39]
-	_ = x[InstNewLongArray-40]
-	_ = x[InstIntArraySet-41]
-	_ = x[InstIntArrayGet-42]
-	_ = x[InstArrayLen-43]
+	_ = x[InstAcmp-12]
+	_ = x[InstJump-13]
+	_ = x[InstJumpEqual-14]
+	_ = x[InstJumpNotEqual-15]
+	_ = x[InstJumpGtEq-16]
+	_ = x[InstJumpGt-17]
+	_ = x[InstJumpLt-18]
+	_ = x[InstJumpLtEq-19]
+	_ = x[InstSwitch-20]
+	_ = x[InstImul-21]
+	_ = x[InstIdiv-22]
+	_ = x[InstIadd-23]
+	_ = x[InstLadd-24]
+	_ = x[InstFadd-25]
+	_ = x[InstIsub-26]
+	_ = x[InstIneg-27]
+	_ = x[InstLneg-28]
+	_ = x[InstDadd-29]
+	_ = x[InstConvL2I-30]
+	_ = x[InstConvF2I-31]
+	_ = x[InstConvD2I-32]
+	_ = x[InstConvI2L-33]
+	_ = x[InstConvI2B-34]
+	_ = x[InstNewBoolArray-35]
+	_ = x[InstNewCharArray-36]
+	_ = x[InstNewFloatArray-37]
+	_ = x[InstNewDoubleArray-38]
+	_ = x[InstNewByteArray-39]
+	_ = x[InstNewShortArray-40]
+	_ = x[InstNewIntArray-41]
+	_ = x[InstNewLongArray-42]
+	_ = x[InstIntArraySet-43]
+	_ = x[InstIntArrayGet-44]
+	_ = x[InstArrayLen-45]
+	_ = x[InstPhi-46]
 }
 
-const _InstKind_name = "InvalidIloadLloadAloadRetIretLretAretCallStaticCallGoIcmpLcmpJumpJumpEqualJumpNotEqualJumpGtEqJumpGtJumpLtJumpLtEqImulIdivIaddLaddFaddIsubInegLnegDaddConvL2IConvF2IConvD2IConvI2LConvI2BNewBoolArrayNewCharArrayNewFloatArrayNewDoubleArrayNewByteArrayNewShortArrayNewIntArrayNewLongArrayIntArraySetIntArrayGetArrayLen"
+const _InstKind_name = "InvalidIloadLloadAloadRetIretLretAretCallStaticCallGoIcmpLcmpAcmpJumpJumpEqualJumpNotEqualJumpGtEqJumpGtJumpLtJumpLtEqSwitchImulIdivIaddLaddFaddIsubInegLnegDaddConvL2IConvF2IConvD2IConvI2LConvI2BNewBoolArrayNewCharArrayNewFloatArrayNewDoubleArrayNewByteArrayNewShortArrayNewIntArrayNewLongArrayIntArraySetIntArrayGetArrayLenPhi"
 
-var _InstKind_index = [...]uint16{0, 7, 12, 17, 22, 25, 29, 33, 37, 47, 53, 57, 61, 65, 74, 86, 94, 100, 106, 114, 118, 122, 126, 130, 134, 138, 142, 146, 150, 157, 164, 171, 178, 185, 197, 209, 222, 236, 248, 261, 272, 284, 295, 306, 314}
+var _InstKind_index = [...]uint16{0, 7, 12, 17, 22, 25, 29, 33, 37, 47, 53, 57, 61, 65, 69, 78, 90, 98, 104, 110, 118, 124, 128, 132, 136, 140, 144, 148, 152, 156, 160, 167, 174, 181, 188, 195, 207, 219, 232, 246, 258, 271, 282, 294, 305, 316, 324, 327}
 
 func (i InstKind) String() string {
 	if i < 0 || i >= InstKind(len(_InstKind_index)-1) {
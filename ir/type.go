@@ -0,0 +1,35 @@
+package ir
+
+// Type is a value type of the IR register or constant argument.
+//
+// Arguments that don't carry a value (branches, flags, env, symbols)
+// have a TypeVoid type.
+type Type uint8
+
+const (
+	TypeVoid Type = iota
+	TypeInt
+	TypeLong
+	TypeFloat
+	TypeDouble
+	TypeRef
+)
+
+func (typ Type) String() string {
+	switch typ {
+	case TypeVoid:
+		return "void"
+	case TypeInt:
+		return "int"
+	case TypeLong:
+		return "long"
+	case TypeFloat:
+		return "float"
+	case TypeDouble:
+		return "double"
+	case TypeRef:
+		return "ref"
+	default:
+		return "?"
+	}
+}
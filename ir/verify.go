@@ -0,0 +1,346 @@
+package ir
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Verify checks that the method code is well-formed.
+//
+// It validates the operand counts and types, branch targets
+// and the block flags. The first found problem is reported.
+//
+// Verify is intended to catch the IR generator and optimizer bugs
+// early, before the invalid code reaches the backend.
+func Verify(m *Method) error {
+	code := m.Code
+	for i, inst := range code {
+		if err := verifyInst(code, inst); err != nil {
+			return fmt.Errorf("inst %d (%s): %v", i, inst, err)
+		}
+	}
+	return verifyBlocks(code)
+}
+
+// operand is a set of argument kinds accepted by the instruction.
+// Value-carrying arguments are matched by their type.
+type operand uint16
+
+const (
+	opInt operand = 1 << iota
+	opLong
+	opFloat
+	opDouble
+	opRef
+	opBranch
+	opFlags
+	opEnv
+	opSymbol
+
+	opValue = opInt | opLong | opFloat | opDouble | opRef
+)
+
+type instSchema struct {
+	// dst is a set of accepted destinations.
+	// Zero value means that instruction has no destination.
+	dst operand
+
+	// optionalDst is set for the instructions that can discard their result.
+	optionalDst bool
+
+	// args describes the instruction arguments.
+	// When variadic is set, the last element describes all trailing arguments.
+	args     []operand
+	variadic bool
+}
+
+var instSchemas = map[InstKind]instSchema{
+	InstIload: {dst: opInt | opFloat, args: []operand{opInt | opFloat}},
+	InstLload: {dst: opLong | opDouble, args: []operand{opLong | opDouble}},
+	InstAload: {dst: opRef, args: []operand{opRef}},
+
+	InstRet:  {},
+	InstIret: {args: []operand{opInt}},
+	InstLret: {args: []operand{opLong}},
+	InstAret: {args: []operand{opRef}},
+
+	InstCallStatic: {dst: opValue, optionalDst: true, args: []operand{opSymbol, opValue}, variadic: true},
+	InstCallGo:     {dst: opValue, optionalDst: true, args: []operand{opSymbol, opValue}, variadic: true},
+
+	InstIcmp: {dst: opFlags, args: []operand{opInt, opInt}},
+	InstLcmp: {dst: opFlags, args: []operand{opLong, opLong}},
+	InstAcmp: {dst: opFlags, args: []operand{opRef, opRef}},
+
+	InstJump:         {args: []operand{opBranch}},
+	InstJumpEqual:    {args: []operand{opBranch, opFlags}},
+	InstJumpNotEqual: {args: []operand{opBranch, opFlags}},
+	InstJumpGtEq:     {args: []operand{opBranch, opFlags}},
+	InstJumpGt:       {args: []operand{opBranch, opFlags}},
+	InstJumpLt:       {args: []operand{opBranch, opFlags}},
+	InstJumpLtEq:     {args: []operand{opBranch, opFlags}},
+
+	// Switch cases are (key, branch) pairs, they're checked separately.
+	InstSwitch: {args: []operand{opInt, opBranch}},
+
+	InstImul: {dst: opInt, args: []operand{opInt, opInt}},
+	InstIdiv: {dst: opInt, args: []operand{opInt, opInt}},
+	InstIadd: {dst: opInt, args: []operand{opInt, opInt}},
+	InstLadd: {dst: opLong, args: []operand{opLong, opLong}},
+	InstFadd: {dst: opFloat, args: []operand{opFloat, opFloat}},
+	InstIsub: {dst: opInt, args: []operand{opInt, opInt}},
+	InstIneg: {dst: opInt, args: []operand{opInt}},
+	InstLneg: {dst: opLong, args: []operand{opLong}},
+	InstDadd: {dst: opDouble, args: []operand{opDouble, opDouble}},
+
+	InstConvL2I: {dst: opInt, args: []operand{opLong}},
+	InstConvF2I: {dst: opInt, args: []operand{opFloat}},
+	InstConvD2I: {dst: opInt, args: []operand{opDouble}},
+	InstConvI2L: {dst: opLong, args: []operand{opInt}},
+	InstConvI2B: {dst: opInt, args: []operand{opInt}},
+
+	InstNewBoolArray:   {dst: opRef, args: []operand{opEnv, opInt}},
+	InstNewCharArray:   {dst: opRef, args: []operand{opEnv, opInt}},
+	InstNewFloatArray:  {dst: opRef, args: []operand{opEnv, opInt}},
+	InstNewDoubleArray: {dst: opRef, args: []operand{opEnv, opInt}},
+	InstNewByteArray:   {dst: opRef, args: []operand{opEnv, opInt}},
+	InstNewShortArray:  {dst: opRef, args: []operand{opEnv, opInt}},
+	InstNewIntArray:    {dst: opRef, args: []operand{opEnv, opInt}},
+	InstNewLongArray:   {dst: opRef, args: []operand{opEnv, opInt}},
+
+	InstIntArraySet: {args: []operand{opRef, opInt, opInt}},
+	InstIntArrayGet: {dst: opInt, args: []operand{opRef, opInt}},
+	InstArrayLen:    {dst: opInt, args: []operand{opRef}},
+
+	InstPhi: {dst: opValue, args: []operand{opValue}, variadic: true},
+}
+
+func verifyInst(code []Inst, inst Inst) error {
+	schema, ok := instSchemas[inst.Kind]
+	if !ok {
+		return errors.New("unknown instruction kind")
+	}
+
+	switch {
+	case schema.dst == 0:
+		if inst.Dst.Kind != ArgInvalid {
+			return errors.New("unexpected dst")
+		}
+	case inst.Dst.Kind == ArgInvalid:
+		if !schema.optionalDst {
+			return errors.New("missing dst")
+		}
+	default:
+		if inst.Dst.Kind != ArgReg && inst.Dst.Kind != ArgFlags {
+			return fmt.Errorf("dst: can't assign to %s", inst.Dst)
+		}
+		if err := checkOperand(inst.Dst, schema.dst); err != nil {
+			return fmt.Errorf("dst: %v", err)
+		}
+	}
+
+	args := inst.Args
+	if inst.Kind == InstSwitch {
+		if len(args) < 2 {
+			return fmt.Errorf("expected at least 2 args, found %d", len(args))
+		}
+		if err := verifySwitchCases(args[2:]); err != nil {
+			return err
+		}
+		args = args[:2]
+	}
+	if schema.variadic {
+		if len(args) < len(schema.args)-1 {
+			return fmt.Errorf("expected at least %d args, found %d", len(schema.args)-1, len(args))
+		}
+	} else if len(args) != len(schema.args) {
+		return fmt.Errorf("expected %d args, found %d", len(schema.args), len(args))
+	}
+	for i, arg := range args {
+		want := schema.args[len(schema.args)-1]
+		if i < len(schema.args) {
+			want = schema.args[i]
+		}
+		if err := checkOperand(arg, want); err != nil {
+			return fmt.Errorf("arg[%d]: %v", i, err)
+		}
+	}
+
+	switch inst.Kind {
+	case InstIload, InstLload, InstAload, InstPhi:
+		for _, arg := range inst.Args {
+			if inst.Dst.Type != arg.Type {
+				return fmt.Errorf("can't move %s value to %s register", arg.Type, inst.Dst.Type)
+			}
+		}
+	}
+
+	for _, arg := range inst.Args {
+		if arg.Kind != ArgBranch {
+			continue
+		}
+		if arg.Value < 0 || arg.Value >= int64(len(code)) {
+			return fmt.Errorf("branch target %d is out of range", arg.Value)
+		}
+		flags := code[arg.Value].Flags
+		if !flags.IsJumpTarget() || !flags.IsBlockLead() {
+			return fmt.Errorf("branch target %d is not marked as a block leader and jump target", arg.Value)
+		}
+	}
+
+	return nil
+}
+
+// verifySwitchCases checks the (key, branch) pairs of the switch.
+func verifySwitchCases(cases []Arg) error {
+	if len(cases)%2 != 0 {
+		return errors.New("switch cases are not paired")
+	}
+	for i := 0; i < len(cases); i += 2 {
+		key := cases[i]
+		if key.Kind != ArgIntConst || key.Type != TypeInt {
+			return fmt.Errorf("switch key %s is not an int constant", key)
+		}
+		if cases[i+1].Kind != ArgBranch {
+			return fmt.Errorf("switch case %s has no branch", key)
+		}
+		if i != 0 && cases[i-2].Value >= key.Value {
+			return errors.New("switch keys are not sorted")
+		}
+	}
+	return nil
+}
+
+// checkOperand reports an error if arg doesn't belong to the want set.
+func checkOperand(arg Arg, want operand) error {
+	have, err := argOperand(arg)
+	if err != nil {
+		return err
+	}
+	if have&want == 0 {
+		return fmt.Errorf("unexpected %s", describeArg(arg))
+	}
+	return nil
+}
+
+func argOperand(arg Arg) (operand, error) {
+	switch arg.Kind {
+	case ArgBranch:
+		return opBranch, nil
+	case ArgFlags:
+		return opFlags, nil
+	case ArgEnv:
+		return opEnv, nil
+	case ArgSymbolID:
+		return opSymbol, nil
+	case ArgReg:
+		if arg.Type == TypeVoid {
+			return 0, fmt.Errorf("register %s has no type", arg)
+		}
+	case ArgIntConst:
+		switch arg.Type {
+		case TypeInt, TypeLong:
+		case TypeRef:
+			// Only null reference constants are permitted.
+			if arg.Value != 0 {
+				return 0, fmt.Errorf("non-null ref constant %s", arg)
+			}
+		default:
+			return 0, fmt.Errorf("int constant %s has %s type", arg, arg.Type)
+		}
+	case ArgFloatConst:
+		if arg.Type != TypeFloat {
+			return 0, fmt.Errorf("float constant %s has %s type", arg, arg.Type)
+		}
+	case ArgDoubleConst:
+		if arg.Type != TypeDouble {
+			return 0, fmt.Errorf("double constant %s has %s type", arg, arg.Type)
+		}
+	default:
+		return 0, fmt.Errorf("invalid arg kind %d", arg.Kind)
+	}
+	return typeOperand(arg.Type), nil
+}
+
+func typeOperand(typ Type) operand {
+	switch typ {
+	case TypeInt:
+		return opInt
+	case TypeLong:
+		return opLong
+	case TypeFloat:
+		return opFloat
+	case TypeDouble:
+		return opDouble
+	case TypeRef:
+		return opRef
+	default:
+		return 0
+	}
+}
+
+func describeArg(arg Arg) string {
+	switch arg.Kind {
+	case ArgBranch:
+		return "branch " + arg.String()
+	case ArgFlags:
+		return "flags"
+	case ArgEnv:
+		return "env"
+	case ArgSymbolID:
+		return "symbol " + arg.String()
+	default:
+		return fmt.Sprintf("%s %s", arg.Type, arg)
+	}
+}
+
+// verifyBlocks checks the block leader and jump target flags.
+func verifyBlocks(code []Inst) error {
+	if len(code) == 0 {
+		return nil
+	}
+
+	targets := make([]bool, len(code))
+	for _, inst := range code {
+		for _, arg := range inst.Args {
+			if arg.Kind == ArgBranch {
+				targets[arg.Value] = true
+			}
+		}
+	}
+
+	if !code[0].Flags.IsBlockLead() || !code[0].Flags.IsJumpTarget() {
+		return errors.New("inst 0: entry is not marked as a block leader and jump target")
+	}
+	for i := 1; i < len(code); i++ {
+		flags := code[i].Flags
+		prev := code[i-1]
+		if flags.IsJumpTarget() && !targets[i] {
+			return fmt.Errorf("inst %d: marked as a jump target, but nothing jumps to it", i)
+		}
+		if isJumpKind(prev.Kind) && !flags.IsBlockLead() {
+			return fmt.Errorf("inst %d: follows a jump, but is not a block leader", i)
+		}
+		if flags.IsBlockLead() && !targets[i] && !isJumpKind(prev.Kind) && !isRetKind(prev.Kind) {
+			return fmt.Errorf("inst %d: marked as a block leader, but starts no block", i)
+		}
+		if code[i].Kind == InstPhi && !flags.IsBlockLead() && prev.Kind != InstPhi {
+			return fmt.Errorf("inst %d: phi is not at the block start", i)
+		}
+	}
+
+	last := code[len(code)-1]
+	switch {
+	case last.Kind == InstJump, last.Kind == InstSwitch, isRetKind(last.Kind):
+		return nil
+	default:
+		return fmt.Errorf("inst %d: control flow falls off the end", len(code)-1)
+	}
+}
+
+func isJumpKind(kind InstKind) bool {
+	return kind >= InstJump && kind <= InstSwitch
+}
+
+func isRetKind(kind InstKind) bool {
+	return kind >= InstRet && kind <= InstAret
+}
@@ -0,0 +1,207 @@
+package ir
+
+import (
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	reg := func(typ Type, v int64) Arg { return Arg{Kind: ArgReg, Type: typ, Value: v} }
+	intConst := func(v int64) Arg { return Arg{Kind: ArgIntConst, Type: TypeInt, Value: v} }
+	branch := func(v int64) Arg { return Arg{Kind: ArgBranch, Value: v} }
+	flags := Arg{Kind: ArgFlags}
+
+	// entry is a block leader and a jump target.
+	var entry InstFlags
+	entry.SetBlockLead(true)
+	entry.SetJumpTarget(true)
+	var lead InstFlags
+	lead.SetBlockLead(true)
+
+	tests := []struct {
+		name string
+		code []Inst
+		err  string
+	}{
+		{
+			name: "ok",
+			code: []Inst{
+				{Kind: InstIcmp, Dst: flags, Args: []Arg{reg(TypeInt, 0), intConst(0)}, Flags: entry},
+				{Kind: InstJumpGtEq, Args: []Arg{branch(4), flags}},
+				{Kind: InstIneg, Dst: reg(TypeInt, 1), Args: []Arg{reg(TypeInt, 0)}, Flags: lead},
+				{Kind: InstIret, Args: []Arg{reg(TypeInt, 1)}},
+				{Kind: InstIret, Args: []Arg{reg(TypeInt, 0)}, Flags: entry},
+			},
+		},
+
+		{
+			name: "okSwitch",
+			code: []Inst{
+				{Kind: InstSwitch, Args: []Arg{reg(TypeInt, 0), branch(1), intConst(1), branch(2), intConst(5), branch(1)}, Flags: entry},
+				{Kind: InstLret, Args: []Arg{{Kind: ArgIntConst, Type: TypeLong, Value: 1}}, Flags: entry},
+				{Kind: InstAret, Args: []Arg{reg(TypeRef, 1)}, Flags: entry},
+			},
+		},
+
+		{
+			name: "okCall",
+			code: []Inst{
+				{Kind: InstCallStatic, Args: []Arg{{Kind: ArgSymbolID}}, Flags: entry},
+				{Kind: InstCallStatic, Dst: reg(TypeLong, 2), Args: []Arg{{Kind: ArgSymbolID}, reg(TypeInt, 0), reg(TypeRef, 1)}},
+				{Kind: InstRet},
+			},
+		},
+
+		{
+			name: "unknownKind",
+			code: []Inst{
+				{Kind: InstInvalid, Flags: entry},
+			},
+			err: "inst 0 (Invalid): unknown instruction kind",
+		},
+
+		{
+			name: "argsCount",
+			code: []Inst{
+				{Kind: InstIadd, Dst: reg(TypeInt, 0), Args: []Arg{reg(TypeInt, 0)}, Flags: entry},
+				{Kind: InstRet},
+			},
+			err: "inst 0 (r0 = Iadd r0): expected 2 args, found 1",
+		},
+
+		{
+			name: "argType",
+			code: []Inst{
+				{Kind: InstIadd, Dst: reg(TypeInt, 0), Args: []Arg{reg(TypeInt, 0), reg(TypeLong, 1)}, Flags: entry},
+				{Kind: InstRet},
+			},
+			err: "inst 0 (r0 = Iadd r0 r1): arg[1]: unexpected long r1",
+		},
+
+		{
+			name: "untypedReg",
+			code: []Inst{
+				{Kind: InstIret, Args: []Arg{{Kind: ArgReg, Value: 3}}, Flags: entry},
+			},
+			err: "inst 0 (Iret r3): arg[0]: register r3 has no type",
+		},
+
+		{
+			name: "dstType",
+			code: []Inst{
+				{Kind: InstConvI2L, Dst: reg(TypeInt, 1), Args: []Arg{reg(TypeInt, 0)}, Flags: entry},
+				{Kind: InstRet},
+			},
+			err: "inst 0 (r1 = ConvI2L r0): dst: unexpected int r1",
+		},
+
+		{
+			name: "missingDst",
+			code: []Inst{
+				{Kind: InstArrayLen, Args: []Arg{reg(TypeRef, 0)}, Flags: entry},
+				{Kind: InstRet},
+			},
+			err: "inst 0 (ArrayLen r0): missing dst",
+		},
+
+		{
+			name: "constDst",
+			code: []Inst{
+				{Kind: InstIload, Dst: intConst(1), Args: []Arg{intConst(2)}, Flags: entry},
+				{Kind: InstRet},
+			},
+			err: "inst 0 (1 = Iload 2): dst: can't assign to 1",
+		},
+
+		{
+			name: "moveType",
+			code: []Inst{
+				{Kind: InstIload, Dst: reg(TypeFloat, 1), Args: []Arg{reg(TypeInt, 0)}, Flags: entry},
+				{Kind: InstRet},
+			},
+			err: "inst 0 (r1 = Iload r0): can't move int value to float register",
+		},
+
+		{
+			name: "nonNullRef",
+			code: []Inst{
+				{Kind: InstAret, Args: []Arg{{Kind: ArgIntConst, Type: TypeRef, Value: 1}}, Flags: entry},
+			},
+			err: "inst 0 (Aret 1): arg[0]: non-null ref constant 1",
+		},
+
+		{
+			name: "branchRange",
+			code: []Inst{
+				{Kind: InstJump, Args: []Arg{branch(5)}, Flags: entry},
+			},
+			err: "inst 0 (Jump @5): branch target 5 is out of range",
+		},
+
+		{
+			name: "branchFlags",
+			code: []Inst{
+				{Kind: InstJump, Args: []Arg{branch(1)}, Flags: entry},
+				{Kind: InstRet, Flags: lead},
+			},
+			err: "inst 0 (Jump @1): branch target 1 is not marked as a block leader and jump target",
+		},
+
+		{
+			name: "unsortedSwitch",
+			code: []Inst{
+				{Kind: InstSwitch, Args: []Arg{reg(TypeInt, 0), branch(0), intConst(2), branch(0), intConst(1), branch(0)}, Flags: entry},
+			},
+			err: "inst 0 (Switch r0 @0 2 @0 1 @0): switch keys are not sorted",
+		},
+
+		{
+			name: "entryFlags",
+			code: []Inst{
+				{Kind: InstRet},
+			},
+			err: "inst 0: entry is not marked as a block leader and jump target",
+		},
+
+		{
+			name: "noLeader",
+			code: []Inst{
+				{Kind: InstIcmp, Dst: flags, Args: []Arg{reg(TypeInt, 0), intConst(0)}, Flags: entry},
+				{Kind: InstJumpEqual, Args: []Arg{branch(0), flags}},
+				{Kind: InstRet},
+			},
+			err: "inst 2: follows a jump, but is not a block leader",
+		},
+
+		{
+			name: "spuriousLeader",
+			code: []Inst{
+				{Kind: InstIneg, Dst: reg(TypeInt, 0), Args: []Arg{reg(TypeInt, 0)}, Flags: entry},
+				{Kind: InstRet, Flags: lead},
+			},
+			err: "inst 1: marked as a block leader, but starts no block",
+		},
+
+		{
+			name: "fallsOff",
+			code: []Inst{
+				{Kind: InstIneg, Dst: reg(TypeInt, 0), Args: []Arg{reg(TypeInt, 0)}, Flags: entry},
+			},
+			err: "inst 0: control flow falls off the end",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Verify(&Method{Code: test.code})
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("error mismatch:\nhave: %v\nwant: %s", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Package irfmt implements the textual IR format.
+//
+// The text consists of the method definitions.
+// Every method starts with a header that is followed by its code:
+//
+//	method max(II)I slots=2
+//	  flags = Icmp r0:int r1:int
+//	  JumpLt @less flags
+//	  Iret r0
+//	less:
+//	  Iret r1
+//
+// Header holds the method name immediately followed by its descriptor
+// and optional key=value attributes:
+//
+//	slots   frame slots count; inferred from the registers if omitted
+//	access  method access flags, like access=0x9 (public static)
+//
+// Every code line is an instruction: an optional destination followed
+// by "=", the instruction kind name (see ir.InstKind) and its arguments.
+// Instruction attributes go after the arguments:
+//
+//	!inbounds  array index is known to be in bounds, see ir.InstFlags
+//
+// Arguments syntax:
+//
+//	r1:int     register 1 of the int type (int, long, float, double, ref);
+//	           type can be omitted if the register was mentioned before
+//	10 -5      int constants
+//	10L        long constant
+//	1.5f       float constant
+//	1.5 1.5d   double constants
+//	null       null reference constant
+//	@loop @3   branch to the label or to the instruction index
+//	flags      comparison flags
+//	env        VM environment
+//	pkg/Class.name(I)I
+//	           method symbol, it's resolved by the vmdat.State
+//	sym{0,1,2} method symbol ID by its package, class and member indexes
+//
+// A "name:" line defines a label that refers to the next instruction.
+// Labels are local to the method.
+// Block leader and jump target flags are computed from the code,
+// labels don't affect them.
+//
+// Comments start with "//" and continue until the end of the line.
+package irfmt
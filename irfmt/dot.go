@@ -0,0 +1,88 @@
+package irfmt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+// FprintDot writes the method control flow graph in the Graphviz DOT format.
+//
+// Every basic block becomes a node that is labeled by its instructions.
+// Branch edges are labeled by the jump kind (or the switch case),
+// fallthrough edges are dashed.
+func FprintDot(w io.Writer, st *vmdat.State, m *ir.Method) {
+	fmt.Fprintf(w, "digraph %s {\n", DotQuote(m.Out.Name+m.Out.Descriptor))
+	fmt.Fprintf(w, "  node [shape=box fontname=monospace];\n")
+
+	code := m.Code
+	inst2block := make(map[int64]int)
+	var starts []int
+	for i, inst := range code {
+		if i == 0 || inst.Flags.IsBlockLead() {
+			inst2block[int64(i)] = len(starts)
+			starts = append(starts, i)
+		}
+	}
+
+	for id, start := range starts {
+		end := len(code)
+		if id+1 < len(starts) {
+			end = starts[id+1]
+		}
+		lines := make([]string, 0, end-start+1)
+		lines = append(lines, fmt.Sprintf("b%d:", id))
+		for i := start; i < end; i++ {
+			lines = append(lines, fmt.Sprintf("%3d: %s", i, Sprint(st, code[i])))
+		}
+		fmt.Fprintf(w, "  b%d [label=%s];\n", id, DotLabel(lines))
+
+		last := code[end-1]
+		edge := func(target int64, attrs string) {
+			fmt.Fprintf(w, "  b%d -> b%d%s;\n", id, inst2block[target], attrs)
+		}
+		switch last.Kind {
+		case ir.InstRet, ir.InstIret, ir.InstLret, ir.InstAret:
+			continue
+		case ir.InstJump:
+			edge(last.Args[0].Value, "")
+			continue
+		case ir.InstSwitch:
+			edge(last.Args[1].Value, ` [label="default"]`)
+			for i := 2; i < len(last.Args); i += 2 {
+				edge(last.Args[i+1].Value, fmt.Sprintf(` [label="case %d"]`, last.Args[i].Value))
+			}
+			continue
+		case ir.InstJumpEqual, ir.InstJumpNotEqual, ir.InstJumpGtEq,
+			ir.InstJumpGt, ir.InstJumpLt, ir.InstJumpLtEq:
+			edge(last.Args[0].Value, fmt.Sprintf(` [label=%q]`, last.Kind.String()))
+		}
+		if end < len(code) {
+			edge(int64(end), " [style=dashed]")
+		}
+	}
+
+	fmt.Fprintf(w, "}\n")
+}
+
+// DotQuote returns s as a DOT quoted string.
+func DotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// DotLabel returns a DOT node label that contains the left-aligned lines.
+func DotLabel(lines []string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, l := range lines {
+		l = strings.ReplaceAll(l, `\`, `\\`)
+		buf.WriteString(strings.ReplaceAll(l, `"`, `\"`))
+		buf.WriteString(`\l`)
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
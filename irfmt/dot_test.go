@@ -0,0 +1,61 @@
+package irfmt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFprintDot(t *testing.T) {
+	src := `
+method f(I)I
+  flags = Icmp r0:int 0
+  JumpLt @negative flags
+  Switch r0 @other 1 @one
+one:
+  Iret r0
+negative:
+  r0 = Ineg r0
+other:
+  Iret r0
+`
+	want := `digraph "f(I)I" {
+  node [shape=box fontname=monospace];
+  b0 [label="b0:\l  0: flags = Icmp r0 0\l  1: JumpLt @4 flags\l"];
+  b0 -> b3 [label="JumpLt"];
+  b0 -> b1 [style=dashed];
+  b1 [label="b1:\l  2: Switch r0 @5 1 @3\l"];
+  b1 -> b4 [label="default"];
+  b1 -> b2 [label="case 1"];
+  b2 [label="b2:\l  3: Iret r0\l"];
+  b3 [label="b3:\l  4: r0 = Ineg r0\l"];
+  b3 -> b4 [style=dashed];
+  b4 [label="b4:\l  5: Iret r0\l"];
+}
+`
+
+	methods, err := Parse(nil, src)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var buf strings.Builder
+	FprintDot(&buf, nil, &methods[0])
+	if have := buf.String(); have != want {
+		t.Errorf("output mismatch:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestDotQuote(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{`f()V`, `"f()V"`},
+		{`a"b`, `"a\"b"`},
+		{`a\b`, `"a\\b"`},
+	}
+	for _, test := range tests {
+		if have := DotQuote(test.s); have != test.want {
+			t.Errorf("DotQuote(%q): have %s, want %s", test.s, have, test.want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package irfmt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/symbol"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+func newTestState() *vmdat.State {
+	var st vmdat.State
+	st.Init()
+	pkg := st.NewPackage("testpkg")
+	pkg.Classes = []vmdat.Class{
+		{
+			Name: "Test",
+			Methods: []vmdat.Method{
+				{Name: "add", Descriptor: "(II)I", ID: symbol.NewID(0, 0, 0)},
+				{Name: "sum", Descriptor: "([I)I", ID: symbol.NewID(0, 0, 1)},
+			},
+		},
+	}
+	return &st
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		`
+method max(II)I slots=2
+b0:
+  flags = Icmp r0:int r1:int
+  JumpLt @b2 flags
+b1:
+  Iret r0
+b2:
+  Iret r1
+`,
+
+		`
+method consts()V slots=6 access=0x9
+b0:
+  r0:long = Lload -5L
+  r2:double = Lload 1.5d
+  r4:float = Iload 0.25f
+  r5:ref = Aload null
+  r4:int = Iload -7
+  Ret
+`,
+
+		`
+method calls(I)I slots=2
+b0:
+  r1:int = CallStatic testpkg/Test.add(II)I r0:int 10
+  CallStatic testpkg/Test.add(II)I r1 r1
+  Iret r1
+`,
+
+		`
+method loop([I)I slots=4
+b0:
+  r1:int = Iload 0
+  r2:int = Iload 0
+b1:
+  r3:int = ArrayLen r0:ref
+  flags = Icmp r2 r3
+  JumpGtEq @b3 flags
+b2:
+  r3 = IntArrayGet r0 r2 !inbounds
+  r1 = Iadd r1 r3
+  r2 = Iadd r2 1
+  Jump @b1
+b3:
+  Iret r1
+`,
+
+		`
+method switch(I)V slots=1
+b0:
+  Switch r0:int @b3 1 @b1 5 @b2
+b1:
+  Ret
+b2:
+  Ret
+b3:
+  Ret
+`,
+
+		`
+method phi(Z)I slots=3
+b0:
+  r1:int = Iload 1
+  flags = Icmp r0:int 0
+  JumpEqual @b2 flags
+b1:
+  r2:int = Iload 2
+b2:
+  r2 = Phi r1 r2
+  Iret r2
+`,
+	}
+
+	st := newTestState()
+	for _, test := range tests {
+		src := strings.TrimPrefix(test, "\n")
+		methods, err := Parse(st, src)
+		if err != nil {
+			t.Errorf("parse error: %v\n%s", err, src)
+			continue
+		}
+		var buf strings.Builder
+		for i := range methods {
+			buf.WriteString(Format(st, &methods[i]))
+		}
+		if have := buf.String(); have != src {
+			t.Errorf("round trip mismatch:\nhave:\n%s\nwant:\n%s", have, src)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	src := `
+// Labels can have any names, block flags are computed from the code.
+method abs(I)I
+  flags = Icmp r0:int 0
+  JumpGtEq @positive flags
+  r0 = Ineg r0
+positive:
+  Iret r0
+
+method sum([I)I slots=4
+  r1:int = CallStatic testpkg/Test.sum([I)I r0:ref // Recursive call
+  r2:int = CallStatic sym{0,0,0} r1 r1
+  Jump @4
+unused:
+  Iret r1
+  Iret r2
+`
+
+	methods, err := Parse(newTestState(), src)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if len(methods) != 2 {
+		t.Fatalf("expected 2 methods, found %d", len(methods))
+	}
+
+	abs := methods[0]
+	if abs.Out.Name != "abs" || abs.Out.Descriptor != "(I)I" {
+		t.Errorf("abs: unexpected name %s%s", abs.Out.Name, abs.Out.Descriptor)
+	}
+	if abs.Out.FrameSlots != 1 {
+		t.Errorf("abs: expected 1 frame slot, found %d", abs.Out.FrameSlots)
+	}
+	wantLeaders := []bool{true, false, true, true}
+	for i, inst := range abs.Code {
+		if inst.Flags.IsBlockLead() != wantLeaders[i] {
+			t.Errorf("abs: inst %d block lead flag: have %v, want %v", i, inst.Flags.IsBlockLead(), wantLeaders[i])
+		}
+	}
+	if !abs.Code[3].Flags.IsJumpTarget() || abs.Code[2].Flags.IsJumpTarget() {
+		t.Errorf("abs: jump target flags are not set correctly")
+	}
+	if arg := abs.Code[1].Args[0]; arg.Kind != ir.ArgBranch || arg.Value != 3 {
+		t.Errorf("abs: unexpected branch %s", arg)
+	}
+
+	sum := methods[1]
+	if sum.Out.FrameSlots != 4 {
+		t.Errorf("sum: expected 4 frame slots, found %d", sum.Out.FrameSlots)
+	}
+	if id := sum.Code[0].Args[0].SymbolID(); id != symbol.NewID(0, 0, 1) {
+		t.Errorf("sum: unexpected call symbol %v", id)
+	}
+	if id := sum.Code[1].Args[0].SymbolID(); id != symbol.NewID(0, 0, 0) {
+		t.Errorf("sum: unexpected call symbol %v", id)
+	}
+	if arg := sum.Code[0].Args[1]; arg.Kind != ir.ArgReg || arg.Type != ir.TypeRef {
+		t.Errorf("sum: unexpected arg %s (%s)", arg, arg.Type)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`Iret 0`, `line 1: Iret: code outside of a method`},
+		{`method f`, `line 1: f: expected name(descriptor)`},
+		{`method f()V size=1`, `line 1: unknown attribute size`},
+		{"method f()V\n  Nop", `line 2: unknown instruction Nop`},
+		{"method f()I\n  Iret r0", `line 2: r0: register type is unknown`},
+		{"method f()I\n  Iret r0:bool", `line 2: r0:bool: invalid register type bool`},
+		{"method f()I\n  Iret 1x", `line 2: 1x: invalid argument`},
+		{"method f()V\n  Jump @end", `line 2: label end is not defined`},
+		{"method f()V\na:\na:\n  Ret", `line 3: label a redefined`},
+		{"method f()V\n  Jump @5", `method f()V: branch target 5 is out of range`},
+		{"method f()V\n  Ret !inbounds 1", `line 2: 1: argument after attributes`},
+		{"method f()V\n  CallStatic Test.f()V", `line 2: Test.f()V: can't resolve a symbol without vmdat.State`},
+		{"method f()I\n  Iret 1L", `method f()I: inst 0 (Iret 1): arg[0]: unexpected long 1`},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(nil, test.src)
+		if err == nil {
+			t.Errorf("%q: expected an error", test.src)
+			continue
+		}
+		if err.Error() != test.err {
+			t.Errorf("%q:\nhave error: %v\nwant error: %s", test.src, err, test.err)
+		}
+	}
+}
+
+func TestParseSymbolErrors(t *testing.T) {
+	tests := []struct {
+		sym string
+		err string
+	}{
+		{`Test.add(II)I`, `package "" not found`},
+		{`testpkg/Foo.add(II)I`, `class Foo not found`},
+		{`testpkg/Test.add(J)J`, `method add(J)J not found`},
+		{`testpkg/add(II)I`, `expected Class.method`},
+	}
+
+	st := newTestState()
+	for _, test := range tests {
+		src := "method f()V\n  CallStatic " + test.sym + "\n  Ret"
+		_, err := Parse(st, src)
+		want := "line 2: " + test.sym + ": " + test.err
+		if err == nil || err.Error() != want {
+			t.Errorf("%s:\nhave error: %v\nwant error: %s", test.sym, err, want)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package irfmt
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/jclass"
+	"github.com/quasilyte/go-jdk/symbol"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+// Parse builds the methods from their textual IR representation.
+// See the package docs for the syntax description.
+//
+// st is used to resolve the method symbols by their names,
+// it can be nil if the text doesn't refer to them.
+//
+// Parsed methods are checked with ir.Verify.
+func Parse(st *vmdat.State, src string) ([]ir.Method, error) {
+	p := parser{st: st}
+	for i, line := range strings.Split(src, "\n") {
+		p.line = i + 1
+		if j := strings.Index(line, "//"); j != -1 {
+			line = line[:j]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := p.parseLine(fields); err != nil {
+			return nil, fmt.Errorf("line %d: %v", p.line, err)
+		}
+	}
+	if err := p.finishMethod(); err != nil {
+		return nil, err
+	}
+	return p.methods, nil
+}
+
+var instKinds = func() map[string]ir.InstKind {
+	kinds := make(map[string]ir.InstKind)
+	for k := ir.InstInvalid + 1; ; k++ {
+		name := k.String()
+		if strings.HasPrefix(name, "InstKind(") {
+			break
+		}
+		kinds[name] = k
+	}
+	return kinds
+}()
+
+type parser struct {
+	st   *vmdat.State
+	line int
+
+	methods []ir.Method
+
+	// Current method state.
+	m        *ir.Method
+	slots    int
+	maxReg   int64
+	regTypes map[int64]ir.Type
+	labels   map[string]int64
+	fixups   []labelRef
+}
+
+// labelRef is a branch argument that refers to the label.
+// It's resolved after the whole method is parsed.
+type labelRef struct {
+	line  int
+	inst  int
+	arg   int
+	label string
+}
+
+func (p *parser) parseLine(fields []string) error {
+	if fields[0] == "method" {
+		if err := p.finishMethod(); err != nil {
+			return err
+		}
+		return p.parseHeader(fields[1:])
+	}
+	if p.m == nil {
+		return fmt.Errorf("%s: code outside of a method", fields[0])
+	}
+	if len(fields) == 1 && strings.HasSuffix(fields[0], ":") {
+		label := strings.TrimSuffix(fields[0], ":")
+		if !isIdent(label) {
+			return fmt.Errorf("invalid label name %q", label)
+		}
+		if _, ok := p.labels[label]; ok {
+			return fmt.Errorf("label %s redefined", label)
+		}
+		p.labels[label] = int64(len(p.m.Code))
+		return nil
+	}
+	return p.parseInst(fields)
+}
+
+func (p *parser) parseHeader(fields []string) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("missing method name")
+	}
+	i := strings.IndexByte(fields[0], '(')
+	if i <= 0 {
+		return fmt.Errorf("%s: expected name(descriptor)", fields[0])
+	}
+	p.m = &ir.Method{
+		Out: &vmdat.Method{
+			Name:       fields[0][:i],
+			Descriptor: fields[0][i:],
+		},
+	}
+	p.slots = -1
+	p.maxReg = -1
+	p.regTypes = make(map[int64]ir.Type)
+	p.labels = make(map[string]int64)
+	p.fixups = p.fixups[:0]
+
+	for _, attr := range fields[1:] {
+		eq := strings.IndexByte(attr, '=')
+		if eq == -1 {
+			return fmt.Errorf("%s: expected key=value attribute", attr)
+		}
+		key, val := attr[:eq], attr[eq+1:]
+		v, err := strconv.ParseUint(val, 0, 16)
+		if err != nil {
+			return fmt.Errorf("%s: invalid value", attr)
+		}
+		switch key {
+		case "slots":
+			p.slots = int(v)
+		case "access":
+			p.m.AccessFlags = jclass.MethodAccessFlags(v)
+			p.m.Out.AccessFlags = p.m.AccessFlags
+		default:
+			return fmt.Errorf("unknown attribute %s", key)
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseInst(fields []string) error {
+	var inst ir.Inst
+	if len(fields) >= 2 && fields[1] == "=" {
+		dst, err := p.parseArg(fields[0])
+		if err != nil {
+			return err
+		}
+		inst.Dst = dst
+		fields = fields[2:]
+		if len(fields) == 0 {
+			return fmt.Errorf("missing instruction after =")
+		}
+	}
+	kind, ok := instKinds[fields[0]]
+	if !ok {
+		return fmt.Errorf("unknown instruction %s", fields[0])
+	}
+	inst.Kind = kind
+	for _, s := range fields[1:] {
+		if strings.HasPrefix(s, "!") {
+			switch s {
+			case "!inbounds":
+				inst.Flags.SetInBounds(true)
+			default:
+				return fmt.Errorf("unknown attribute %s", s)
+			}
+			continue
+		}
+		if inst.Flags != 0 {
+			return fmt.Errorf("%s: argument after attributes", s)
+		}
+		if strings.HasPrefix(s, "@") && !isNumber(s[1:]) {
+			label := s[1:]
+			if !isIdent(label) {
+				return fmt.Errorf("invalid label name %q", label)
+			}
+			p.fixups = append(p.fixups, labelRef{
+				line:  p.line,
+				inst:  len(p.m.Code),
+				arg:   len(inst.Args),
+				label: label,
+			})
+			inst.Args = append(inst.Args, ir.Arg{Kind: ir.ArgBranch})
+			continue
+		}
+		arg, err := p.parseArg(s)
+		if err != nil {
+			return err
+		}
+		inst.Args = append(inst.Args, arg)
+	}
+	p.m.Code = append(p.m.Code, inst)
+	return nil
+}
+
+func (p *parser) parseArg(s string) (ir.Arg, error) {
+	switch {
+	case s == "env":
+		return ir.Arg{Kind: ir.ArgEnv}, nil
+	case s == "flags":
+		return ir.Arg{Kind: ir.ArgFlags}, nil
+	case s == "null":
+		return ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeRef}, nil
+	case strings.HasPrefix(s, "@"):
+		v, err := strconv.ParseInt(s[1:], 10, 64)
+		if err != nil {
+			return ir.Arg{}, fmt.Errorf("%s: invalid branch", s)
+		}
+		return ir.Arg{Kind: ir.ArgBranch, Value: v}, nil
+	case strings.HasPrefix(s, "sym{"):
+		return parseSymbolID(s)
+	case strings.IndexByte(s, '(') != -1:
+		return p.parseSymbol(s)
+	case s[0] == 'r' && len(s) > 1 && isDigit(s[1]):
+		return p.parseReg(s)
+	default:
+		return parseConst(s)
+	}
+}
+
+func (p *parser) parseReg(s string) (ir.Arg, error) {
+	name, typename := s, ""
+	if i := strings.IndexByte(s, ':'); i != -1 {
+		name, typename = s[:i], s[i+1:]
+	}
+	v, err := strconv.ParseInt(name[1:], 10, 64)
+	if err != nil {
+		return ir.Arg{}, fmt.Errorf("%s: invalid register", s)
+	}
+	typ := p.regTypes[v]
+	if typename != "" {
+		typ = parseType(typename)
+		if typ == ir.TypeVoid {
+			return ir.Arg{}, fmt.Errorf("%s: invalid register type %s", s, typename)
+		}
+		p.regTypes[v] = typ
+	}
+	if typ == ir.TypeVoid {
+		return ir.Arg{}, fmt.Errorf("%s: register type is unknown", s)
+	}
+	if v > p.maxReg {
+		p.maxReg = v
+	}
+	return ir.Arg{Kind: ir.ArgReg, Type: typ, Value: v}, nil
+}
+
+func (p *parser) parseSymbol(s string) (ir.Arg, error) {
+	if p.st == nil {
+		return ir.Arg{}, fmt.Errorf("%s: can't resolve a symbol without vmdat.State", s)
+	}
+	i := strings.IndexByte(s, '(')
+	path, descriptor := s[:i], s[i:]
+	dot := strings.LastIndexByte(path, '.')
+	if dot == -1 {
+		return ir.Arg{}, fmt.Errorf("%s: expected Class.method", s)
+	}
+	className, methodName := path[:dot], path[dot+1:]
+	pkgName := ""
+	if slash := strings.LastIndexByte(className, '/'); slash != -1 {
+		pkgName, className = className[:slash], className[slash+1:]
+	}
+	pkg := p.st.FindPackage(pkgName)
+	if pkg == nil {
+		return ir.Arg{}, fmt.Errorf("%s: package %q not found", s, pkgName)
+	}
+	class := pkg.FindClass(className)
+	if class == nil {
+		return ir.Arg{}, fmt.Errorf("%s: class %s not found", s, className)
+	}
+	method := class.FindMethod(methodName, descriptor)
+	if method == nil {
+		return ir.Arg{}, fmt.Errorf("%s: method %s%s not found", s, methodName, descriptor)
+	}
+	return ir.Arg{Kind: ir.ArgSymbolID, Value: int64(method.ID)}, nil
+}
+
+func parseSymbolID(s string) (ir.Arg, error) {
+	if !strings.HasSuffix(s, "}") {
+		return ir.Arg{}, fmt.Errorf("%s: invalid symbol ID", s)
+	}
+	parts := strings.Split(s[len("sym{"):len(s)-1], ",")
+	if len(parts) != 3 {
+		return ir.Arg{}, fmt.Errorf("%s: expected 3 symbol ID components", s)
+	}
+	var indexes [3]uint64
+	for i, part := range parts {
+		v, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return ir.Arg{}, fmt.Errorf("%s: invalid symbol ID", s)
+		}
+		indexes[i] = v
+	}
+	id := symbol.NewID(indexes[0], indexes[1], indexes[2])
+	return ir.Arg{Kind: ir.ArgSymbolID, Value: int64(id)}, nil
+}
+
+func parseConst(s string) (ir.Arg, error) {
+	last := s[len(s)-1]
+	switch {
+	case last == 'L':
+		v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		if err != nil {
+			return ir.Arg{}, fmt.Errorf("%s: invalid long constant", s)
+		}
+		return ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeLong, Value: v}, nil
+	case last == 'f':
+		v, err := strconv.ParseFloat(s[:len(s)-1], 32)
+		if err != nil {
+			return ir.Arg{}, fmt.Errorf("%s: invalid float constant", s)
+		}
+		bits := math.Float32bits(float32(v))
+		return ir.Arg{Kind: ir.ArgFloatConst, Type: ir.TypeFloat, Value: int64(bits)}, nil
+	case last == 'd' || strings.ContainsAny(s, ".eE"):
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return ir.Arg{}, fmt.Errorf("%s: invalid double constant", s)
+		}
+		bits := math.Float64bits(v)
+		return ir.Arg{Kind: ir.ArgDoubleConst, Type: ir.TypeDouble, Value: int64(bits)}, nil
+	default:
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return ir.Arg{}, fmt.Errorf("%s: invalid argument", s)
+		}
+		return ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: v}, nil
+	}
+}
+
+func parseType(s string) ir.Type {
+	switch s {
+	case "int":
+		return ir.TypeInt
+	case "long":
+		return ir.TypeLong
+	case "float":
+		return ir.TypeFloat
+	case "double":
+		return ir.TypeDouble
+	case "ref":
+		return ir.TypeRef
+	default:
+		return ir.TypeVoid
+	}
+}
+
+// finishMethod resolves the labels, computes the block flags
+// and the frame size of the current method.
+func (p *parser) finishMethod() error {
+	m := p.m
+	if m == nil {
+		return nil
+	}
+	p.m = nil
+	name := m.Out.Name + m.Out.Descriptor
+
+	for _, ref := range p.fixups {
+		target, ok := p.labels[ref.label]
+		if !ok {
+			return fmt.Errorf("line %d: label %s is not defined", ref.line, ref.label)
+		}
+		m.Code[ref.inst].Args[ref.arg].Value = target
+	}
+	for _, inst := range m.Code {
+		for _, arg := range inst.Args {
+			if arg.Kind == ir.ArgBranch && (arg.Value < 0 || arg.Value >= int64(len(m.Code))) {
+				return fmt.Errorf("method %s: branch target %d is out of range", name, arg.Value)
+			}
+		}
+	}
+	markBlocks(m.Code)
+
+	if p.slots >= 0 {
+		m.Out.FrameSlots = p.slots
+	} else {
+		m.Out.FrameSlots = int(p.maxReg + 1)
+		if n := paramSlots(jclass.MethodDescriptor(m.Out.Descriptor)); n > m.Out.FrameSlots {
+			m.Out.FrameSlots = n
+		}
+	}
+
+	if err := ir.Verify(m); err != nil {
+		return fmt.Errorf("method %s: %v", name, err)
+	}
+	p.methods = append(p.methods, *m)
+	return nil
+}
+
+// markBlocks sets the block leader and jump target flags.
+func markBlocks(code []ir.Inst) {
+	if len(code) == 0 {
+		return
+	}
+	code[0].Flags.SetJumpTarget(true)
+	for _, inst := range code {
+		for _, arg := range inst.Args {
+			if arg.Kind == ir.ArgBranch {
+				code[arg.Value].Flags.SetJumpTarget(true)
+			}
+		}
+	}
+	for i, inst := range code {
+		if i == 0 || inst.Flags.IsJumpTarget() || endsBlock(code[i-1].Kind) {
+			code[i].Flags.SetBlockLead(true)
+		}
+	}
+}
+
+func endsBlock(kind ir.InstKind) bool {
+	switch kind {
+	case ir.InstRet, ir.InstIret, ir.InstLret, ir.InstAret:
+		return true
+	case ir.InstJump, ir.InstJumpEqual, ir.InstJumpNotEqual, ir.InstJumpGtEq,
+		ir.InstJumpGt, ir.InstJumpLt, ir.InstJumpLtEq, ir.InstSwitch:
+		return true
+	default:
+		return false
+	}
+}
+
+func paramSlots(desc jclass.MethodDescriptor) int {
+	n := 0
+	desc.WalkParams(func(typ jclass.DescriptorType) {
+		n++
+		if typ.Dims == 0 && (typ.Kind == 'J' || typ.Kind == 'D') {
+			n++
+		}
+	})
+	return n
+}
+
+func isIdent(s string) bool {
+	if s == "" || isDigit(s[0]) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
@@ -1,9 +1,12 @@
 package irfmt
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/symbol"
 	"github.com/quasilyte/go-jdk/vmdat"
 )
 
@@ -29,3 +32,96 @@ func Sprint(st *vmdat.State, inst ir.Inst) string {
 	}
 	return buf.String()
 }
+
+// Format returns the textual representation of the method.
+// The result can be read back with Parse.
+//
+// If st is nil, method symbols are printed as symbol IDs.
+func Format(st *vmdat.State, m *ir.Method) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "method %s%s slots=%d", m.Out.Name, m.Out.Descriptor, m.Out.FrameSlots)
+	if m.AccessFlags != 0 {
+		fmt.Fprintf(&buf, " access=0x%x", uint16(m.AccessFlags))
+	}
+	buf.WriteByte('\n')
+
+	// Every block gets a label, so the branch targets
+	// are printed as the block names.
+	labels := make(map[int64]string)
+	for i, inst := range m.Code {
+		if i == 0 || inst.Flags.IsBlockLead() {
+			labels[int64(i)] = fmt.Sprintf("b%d", len(labels))
+		}
+	}
+	// regTypes track the last printed register types,
+	// types are only printed when they change.
+	regTypes := make(map[int64]ir.Type)
+	formatArg := func(arg ir.Arg) string {
+		switch arg.Kind {
+		case ir.ArgReg:
+			if regTypes[arg.Value] == arg.Type {
+				return arg.String()
+			}
+			regTypes[arg.Value] = arg.Type
+			return arg.String() + ":" + arg.Type.String()
+		case ir.ArgBranch:
+			if label, ok := labels[arg.Value]; ok {
+				return "@" + label
+			}
+			return arg.String()
+		case ir.ArgIntConst:
+			switch arg.Type {
+			case ir.TypeLong:
+				return strconv.FormatInt(arg.Value, 10) + "L"
+			case ir.TypeRef:
+				return "null"
+			}
+			return arg.String()
+		case ir.ArgFloatConst:
+			return strconv.FormatFloat(float64(arg.FloatValue()), 'g', -1, 32) + "f"
+		case ir.ArgDoubleConst:
+			return strconv.FormatFloat(arg.DoubleValue(), 'g', -1, 64) + "d"
+		case ir.ArgSymbolID:
+			if st == nil {
+				return arg.String()
+			}
+			return symbolName(st, arg.SymbolID())
+		default:
+			return arg.String()
+		}
+	}
+
+	for i, inst := range m.Code {
+		if label, ok := labels[int64(i)]; ok {
+			buf.WriteString(label)
+			buf.WriteString(":\n")
+		}
+		buf.WriteString("  ")
+		if inst.Dst.Kind != 0 {
+			buf.WriteString(formatArg(inst.Dst))
+			buf.WriteString(" = ")
+		}
+		buf.WriteString(inst.Kind.String())
+		for _, arg := range inst.Args {
+			buf.WriteByte(' ')
+			buf.WriteString(formatArg(arg))
+		}
+		if inst.Flags.IsInBounds() {
+			buf.WriteString(" !inbounds")
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// symbolName returns the method symbol name in the pkg/Class.name(descriptor) form.
+func symbolName(st *vmdat.State, id symbol.ID) string {
+	pkg := st.Packages[id.PackageIndex()]
+	class := pkg.Classes[id.ClassIndex()]
+	method := class.Methods[id.MemberIndex()]
+	name := class.Name + "." + method.Name + method.Descriptor
+	if pkg.Name != "" {
+		name = pkg.Name + "/" + name
+	}
+	return name
+}
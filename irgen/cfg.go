@@ -0,0 +1,172 @@
+package irgen
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/quasilyte/go-jdk/bytecode"
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// basicBlock is a straight-line bytecode sequence.
+// Control can only enter it through its first instruction
+// and leave it after the last one.
+type basicBlock struct {
+	start int32 // First instruction pc
+	end   int32 // Last instruction end pc
+
+	succs []*basicBlock
+
+	// entry describes operand stack values at the block entry.
+	// Stack value at depth i is always stored inside tmp i.
+	entry      []valueType
+	entryKnown bool
+
+	reachable bool
+
+	// code is a generated IR for this block.
+	code []ir.Inst
+}
+
+// buildCFG splits the method bytecode into basic blocks.
+// Blocks are returned in the bytecode order.
+func buildCFG(code []byte) ([]*basicBlock, error) {
+	instStart := make([]bool, len(code))
+	leaders := make([]bool, len(code)+1)
+	leaders[0] = true
+	for pc := 0; pc < len(code); {
+		op := bytecode.Op(code[pc])
+		if isSwitch(op) {
+			if _, err := bytecode.DecodeSwitch(code, pc); err != nil {
+				return nil, fmt.Errorf("pc=%d: %v", pc, err)
+			}
+		}
+		width := bytecode.InstWidth(code, pc)
+		if width == 0 || pc+width > len(code) {
+			return nil, fmt.Errorf("pc=%d: can't decode %s", pc, op)
+		}
+		instStart[pc] = true
+		if op == bytecode.Wide && bytecode.Op(code[pc+1]) == bytecode.Ret {
+			op = bytecode.Ret
+		}
+		if op == bytecode.Jsr || op == bytecode.Jsrw || op == bytecode.Ret {
+			return nil, fmt.Errorf("pc=%d: %s: subroutines of the class files before version 51 are not supported", pc, op)
+		}
+		for _, target := range branchTargets(code, pc) {
+			if target < 0 || target >= len(code) {
+				return nil, fmt.Errorf("pc=%d: branch target %d is out of range", pc, target)
+			}
+			leaders[target] = true
+		}
+		if isBlockEnd(op) {
+			leaders[pc+width] = true
+		}
+		pc += width
+	}
+
+	var blocks []*basicBlock
+	pc2block := make(map[int]*basicBlock)
+	for pc := 0; pc < len(code); pc++ {
+		if !leaders[pc] {
+			continue
+		}
+		if !instStart[pc] {
+			return nil, fmt.Errorf("pc=%d: branch into the middle of instruction", pc)
+		}
+		if len(blocks) != 0 {
+			blocks[len(blocks)-1].end = int32(pc)
+		}
+		b := &basicBlock{start: int32(pc)}
+		blocks = append(blocks, b)
+		pc2block[pc] = b
+	}
+	blocks[len(blocks)-1].end = int32(len(code))
+
+	for i, b := range blocks {
+		pc := lastInstPC(code, b)
+		op := bytecode.Op(code[pc])
+		for _, target := range branchTargets(code, pc) {
+			succ := pc2block[target]
+			if !containsBlock(b.succs, succ) {
+				b.succs = append(b.succs, succ)
+			}
+		}
+		if !isUnconditionalBranch(op) && !isSwitch(op) && !isReturn(op) {
+			if i+1 == len(blocks) {
+				return nil, fmt.Errorf("pc=%d: falling off the end of the code", pc)
+			}
+			b.succs = append(b.succs, blocks[i+1])
+		}
+	}
+
+	return blocks, nil
+}
+
+// reversePostorder returns blocks that are reachable from the entry block.
+// Every block, except the entry one, has at least one predecessor
+// that precedes it in the returned slice.
+func reversePostorder(blocks []*basicBlock) []*basicBlock {
+	var order []*basicBlock
+	var visit func(b *basicBlock)
+	visit = func(b *basicBlock) {
+		b.reachable = true
+		for _, succ := range b.succs {
+			if !succ.reachable {
+				visit(succ)
+			}
+		}
+		order = append(order, b)
+	}
+	visit(blocks[0])
+
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+func lastInstPC(code []byte, b *basicBlock) int {
+	pc := int(b.start)
+	for {
+		next := pc + bytecode.InstWidth(code, pc)
+		if next == int(b.end) {
+			return pc
+		}
+		pc = next
+	}
+}
+
+// branchTargets returns all explicit jump targets of the instruction at pc.
+func branchTargets(code []byte, pc int) []int {
+	op := bytecode.Op(code[pc])
+	switch {
+	case isBranch(op):
+		return []int{branchTarget(code, pc)}
+	case isSwitch(op):
+		sw, _ := bytecode.DecodeSwitch(code, pc)
+		targets := make([]int, 0, len(sw.Offsets)+1)
+		targets = append(targets, pc+int(sw.Default))
+		for _, offset := range sw.Offsets {
+			targets = append(targets, pc+int(offset))
+		}
+		return targets
+	default:
+		return nil
+	}
+}
+
+func containsBlock(blocks []*basicBlock, b *basicBlock) bool {
+	for _, x := range blocks {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
+
+func branchTarget(code []byte, pc int) int {
+	if bytecode.Op(code[pc]) == bytecode.Gotow {
+		return pc + int(int32(binary.BigEndian.Uint32(code[pc+1:])))
+	}
+	return pc + int(int16(binary.BigEndian.Uint16(code[pc+1:])))
+}
@@ -1,9 +1,10 @@
 package irgen
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
-	"strings"
 
 	"github.com/quasilyte/go-jdk/bytecode"
 	"github.com/quasilyte/go-jdk/ir"
@@ -17,14 +18,23 @@ type generator struct {
 	m         *jclass.Method
 	tmpOffset int64
 
-	st        operandStack
-	out       []ir.Inst
-	toResolve []unresolvedBranch
+	// maxTmp is the number of tmps that are used by the method.
+	maxTmp int64
+
+	code   []byte
+	frames []jclass.StackMapFrame
+
+	st  operandStack
+	out []ir.Inst
+
+	// cmp is a pending comparison that is emitted right before
+	// the conditional jump that consumes its flags.
+	cmp pendingCmp
 }
 
-type unresolvedBranch struct {
-	pc     int32
-	branch *int64
+type pendingCmp struct {
+	kind ir.InstKind
+	args []stackValue
 }
 
 func (g *generator) Generate(i int, m *ir.Method) error {
@@ -34,58 +44,123 @@ func (g *generator) Generate(i int, m *ir.Method) error {
 
 func (g *generator) reset(m *jclass.Method) {
 	g.m = m
-	g.st.reset()
-	g.out = g.out[:0]
-	g.toResolve = g.toResolve[:0]
+	g.maxTmp = 0
+	g.frames = nil
 }
 
 func (g *generator) irArg(n int) ir.Arg {
-	v := g.st.get(n)
+	return g.valueArg(g.st.get(n))
+}
+
+func (g *generator) valueArg(v stackValue) ir.Arg {
 	switch v.kind {
-	case valueIntLocal, valueLongLocal, valueFloatLocal, valueDoubleLocal:
-		return ir.Arg{Kind: ir.ArgReg, Value: v.value}
+	case valueIntLocal, valueLongLocal, valueFloatLocal, valueDoubleLocal, valueRefLocal:
+		return ir.Arg{Kind: ir.ArgReg, Type: irType(v.typ), Value: v.value}
 	case valueTmp:
-		return ir.Arg{Kind: ir.ArgReg, Value: v.value + g.tmpOffset}
+		return g.tmpArg(v.value, v.typ)
 	case valueIntConst, valueLongConst:
-		return ir.Arg{Kind: ir.ArgIntConst, Value: v.value}
+		return ir.Arg{Kind: ir.ArgIntConst, Type: irType(v.typ), Value: v.value}
 	case valueFloatConst:
-		return ir.Arg{Kind: ir.ArgFloatConst, Value: v.value}
+		return ir.Arg{Kind: ir.ArgFloatConst, Type: ir.TypeFloat, Value: v.value}
 	case valueDoubleConst:
-		return ir.Arg{Kind: ir.ArgDoubleConst, Value: v.value}
+		return ir.Arg{Kind: ir.ArgDoubleConst, Type: ir.TypeDouble, Value: v.value}
 	default:
 		panic(fmt.Sprintf("can't convert arg %#v", v))
 	}
 }
 
+func (g *generator) tmpArg(tmp int64, typ valueType) ir.Arg {
+	return ir.Arg{Kind: ir.ArgReg, Type: irType(typ), Value: tmp + g.tmpOffset}
+}
+
 func (g *generator) generate(dst *ir.Method) error {
-	var code []byte
-	var frames []jclass.StackMapFrame
-	for _, attr := range g.m.Attrs {
-		attr, ok := attr.(jclass.CodeAttribute)
+	codeAttr, err := g.m.Code()
+	if err != nil {
+		return err
+	}
+	if codeAttr == nil {
+		return errors.New("method has no code")
+	}
+	g.code = codeAttr.Code
+	g.tmpOffset = int64(codeAttr.MaxLocals)
+	for _, attr := range codeAttr.Attrs {
+		attr, ok := attr.(jclass.StackMapTableAttribute)
 		if !ok {
 			continue
 		}
-		code = attr.Code
-		g.tmpOffset = int64(attr.MaxLocals)
-		for _, attr := range attr.Attrs {
-			attr, ok := attr.(jclass.StackMapTableAttribute)
-			if !ok {
-				continue
+		g.frames = attr.Frames
+		break
+	}
+
+	blocks, err := buildCFG(g.code)
+	if err != nil {
+		return err
+	}
+	blocks[0].entryKnown = true
+	for _, b := range reversePostorder(blocks) {
+		if err := g.convertBlock(b); err != nil {
+			return err
+		}
+	}
+
+	// Lay out the blocks in the bytecode order,
+	// so the fall through edges remain valid.
+	var out []ir.Inst
+	pc2index := make(map[int64]int64, len(blocks))
+	for _, b := range blocks {
+		if !b.reachable {
+			continue
+		}
+		pc2index[int64(b.start)] = int64(len(out))
+		out = append(out, b.code...)
+	}
+	for _, inst := range out {
+		for i, arg := range inst.Args {
+			if arg.Kind == ir.ArgBranch {
+				inst.Args[i].Value = pc2index[arg.Value]
 			}
-			frames = attr.Frames
-			break
 		}
-		break
 	}
 
-	pc2index := make(map[int32]int32, len(code)/2)
+	out[0].Flags.SetJumpTarget(true)
+	for _, inst := range out {
+		for _, arg := range inst.Args {
+			if arg.Kind == ir.ArgBranch {
+				out[arg.Value].Flags.SetJumpTarget(true)
+			}
+		}
+	}
+
+	prevIsBranch := false
+	for i, inst := range out {
+		isLeader := i == 0 || prevIsBranch || inst.Flags.IsJumpTarget()
+		if isLeader {
+			out[i].Flags.SetBlockLead(true)
+		}
+		prevIsBranch = isJump(inst)
+	}
 
-	var prevOp bytecode.Op
-	pc := 0
-	for pc < len(code) {
-		pc2index[int32(pc)] = int32(len(g.out))
+	dst.Code = out
+	dst.Out.FrameSlots = int(g.tmpOffset + g.maxTmp)
+	return nil
+}
+
+// convertBlock generates IR for the block b.
+// Its entry stack state should be already known.
+func (g *generator) convertBlock(b *basicBlock) error {
+	g.out = g.out[:0]
+	g.st.reset()
+	for i, typ := range b.entry {
+		g.st.pushTmp(typ, int64(i))
+	}
+	g.st.tmp = int64(len(b.entry))
+
+	code := g.code
+	pc := int(b.start)
+	for pc < int(b.end) {
 		op := bytecode.Op(code[pc])
 
+		var err error
 		switch op {
 		case bytecode.Iconstm1:
 			g.st.push(valueIntConst, -1)
@@ -108,24 +183,15 @@ func (g *generator) generate(dst *ir.Method) error {
 			ib := int8(code[pc+1])
 			g.st.push(valueIntConst, int64(ib))
 		case bytecode.Sipush:
-			ib1 := int16(code[pc+1])
-			ib2 := int16(code[pc+2])
-			g.st.push(valueIntConst, int64(ib1<<8+ib2))
+			v := int16(binary.BigEndian.Uint16(code[pc+1:]))
+			g.st.push(valueIntConst, int64(v))
 
 		case bytecode.Ldc:
-			i := uint(code[pc+1])
-			switch c := g.f.Consts[i]; c := c.(type) {
-			case *jclass.IntConst:
-				g.st.push(valueIntConst, int64(c.Value))
-			case *jclass.FloatConst:
-				g.st.push(valueFloatConst, int64(math.Float32bits(c.Value)))
-			default:
-				panic(fmt.Sprintf("%T const ldc", c))
-			}
+			err = g.convertLdc(pc, uint(code[pc+1]))
+		case bytecode.Ldcw:
+			err = g.convertLdc(pc, uint(binary.BigEndian.Uint16(code[pc+1:])))
 		case bytecode.Ldc2w:
-			ib1 := uint(code[pc+1])
-			ib2 := uint(code[pc+2])
-			i := ib1<<8 + ib2
+			i := uint(binary.BigEndian.Uint16(code[pc+1:]))
 			switch c := g.f.Consts[i]; c := c.(type) {
 			case *jclass.IntConst:
 				g.st.push(valueIntConst, int64(c.Value))
@@ -139,27 +205,45 @@ func (g *generator) generate(dst *ir.Method) error {
 				panic(fmt.Sprintf("%T const ldc", c))
 			}
 
-		case bytecode.Iload:
-			g.convertLoad(pc, frames, prevOp, int64(code[pc+1]), ir.InstIload)
-		case bytecode.Lload:
-			g.convertLoad(pc, frames, prevOp, int64(code[pc+1]), ir.InstLload)
+		case bytecode.Iload, bytecode.Lload, bytecode.Fload, bytecode.Dload, bytecode.Aload:
+			g.convertLoad(op, int64(code[pc+1]))
 		case bytecode.Iload0, bytecode.Iload1, bytecode.Iload2, bytecode.Iload3:
-			g.convertLoad(pc, frames, prevOp, int64(op-bytecode.Iload0), ir.InstIload)
+			g.convertLoad(bytecode.Iload, int64(op-bytecode.Iload0))
 		case bytecode.Lload0, bytecode.Lload1, bytecode.Lload2, bytecode.Lload3:
-			g.convertLoad(pc, frames, prevOp, int64(op-bytecode.Lload0), ir.InstLload)
+			g.convertLoad(bytecode.Lload, int64(op-bytecode.Lload0))
+		case bytecode.Fload0, bytecode.Fload1, bytecode.Fload2, bytecode.Fload3:
+			g.convertLoad(bytecode.Fload, int64(op-bytecode.Fload0))
+		case bytecode.Dload0, bytecode.Dload1, bytecode.Dload2, bytecode.Dload3:
+			g.convertLoad(bytecode.Dload, int64(op-bytecode.Dload0))
 		case bytecode.Aload0, bytecode.Aload1, bytecode.Aload2, bytecode.Aload3:
-			g.convertLoad(pc, frames, prevOp, int64(op-bytecode.Aload0), ir.InstAload)
+			g.convertLoad(bytecode.Aload, int64(op-bytecode.Aload0))
 
-		case bytecode.Istore:
-			g.convertStore(int64(code[pc+1]), ir.InstIload)
-		case bytecode.Lstore:
-			g.convertStore(int64(code[pc+1]), ir.InstLload)
+		case bytecode.Istore, bytecode.Lstore, bytecode.Fstore, bytecode.Dstore, bytecode.Astore:
+			g.convertStore(op, int64(code[pc+1]))
 		case bytecode.Istore0, bytecode.Istore1, bytecode.Istore2, bytecode.Istore3:
-			g.convertStore(int64(op-bytecode.Istore0), ir.InstIload)
+			g.convertStore(bytecode.Istore, int64(op-bytecode.Istore0))
 		case bytecode.Lstore0, bytecode.Lstore1, bytecode.Lstore2, bytecode.Lstore3:
-			g.convertStore(int64(op-bytecode.Lstore0), ir.InstLload)
+			g.convertStore(bytecode.Lstore, int64(op-bytecode.Lstore0))
+		case bytecode.Fstore0, bytecode.Fstore1, bytecode.Fstore2, bytecode.Fstore3:
+			g.convertStore(bytecode.Fstore, int64(op-bytecode.Fstore0))
+		case bytecode.Dstore0, bytecode.Dstore1, bytecode.Dstore2, bytecode.Dstore3:
+			g.convertStore(bytecode.Dstore, int64(op-bytecode.Dstore0))
 		case bytecode.Astore0, bytecode.Astore1, bytecode.Astore2, bytecode.Astore3:
-			g.convertStore(int64(op-bytecode.Astore0), ir.InstAload)
+			g.convertStore(bytecode.Astore, int64(op-bytecode.Astore0))
+
+		case bytecode.Wide:
+			index := int64(binary.BigEndian.Uint16(code[pc+2:]))
+			switch op := bytecode.Op(code[pc+1]); op {
+			case bytecode.Iload, bytecode.Lload, bytecode.Fload, bytecode.Dload, bytecode.Aload:
+				g.convertLoad(op, index)
+			case bytecode.Istore, bytecode.Lstore, bytecode.Fstore, bytecode.Dstore, bytecode.Astore:
+				g.convertStore(op, index)
+			case bytecode.Iinc:
+				delta := int16(binary.BigEndian.Uint16(code[pc+4:]))
+				g.convertIinc(index, int64(delta))
+			default:
+				err = fmt.Errorf("pc=%d: wide %s is not supported", pc, op)
+			}
 
 		case bytecode.Iastore:
 			g.out = append(g.out, ir.Inst{
@@ -174,9 +258,8 @@ func (g *generator) generate(dst *ir.Method) error {
 
 		case bytecode.Iaload:
 			tmp := g.st.nextTmp()
-			dst := ir.Arg{Kind: ir.ArgReg, Value: tmp + g.tmpOffset}
 			g.out = append(g.out, ir.Inst{
-				Dst:  dst,
+				Dst:  g.tmpArg(tmp, typeInt),
 				Kind: ir.InstIntArrayGet,
 				Args: []ir.Arg{
 					g.irArg(1), // array ref
@@ -184,22 +267,38 @@ func (g *generator) generate(dst *ir.Method) error {
 				},
 			})
 			g.st.drop(2)
-			g.st.push(valueTmp, tmp)
+			g.st.pushTmp(typeInt, tmp)
 
+		case bytecode.Pop:
+			g.st.drop(1)
+		case bytecode.Pop2:
+			g.st.drop(g.st.countValues(0, 2))
 		case bytecode.Dup:
-			v := g.st.top()
-			g.st.push(v.kind, v.value)
+			g.st.dup(1, 0)
+		case bytecode.Dupx1:
+			g.st.dup(1, 1)
+		case bytecode.Dupx2:
+			g.st.dup(1, g.st.countValues(1, 2))
+		case bytecode.Dup2:
+			g.st.dup(g.st.countValues(0, 2), 0)
+		case bytecode.Dup2x1:
+			n := g.st.countValues(0, 2)
+			g.st.dup(n, 1)
+		case bytecode.Dup2x2:
+			n := g.st.countValues(0, 2)
+			g.st.dup(n, g.st.countValues(n, 2))
+		case bytecode.Swap:
+			g.st.swap()
 
 		case bytecode.Arraylength:
 			tmp := g.st.nextTmp()
-			dst := ir.Arg{Kind: ir.ArgReg, Value: tmp + g.tmpOffset}
 			g.out = append(g.out, ir.Inst{
-				Dst:  dst,
+				Dst:  g.tmpArg(tmp, typeInt),
 				Kind: ir.InstArrayLen,
 				Args: []ir.Arg{g.irArg(0)},
 			})
 			g.st.drop(1)
-			g.st.push(valueTmp, tmp)
+			g.st.pushTmp(typeInt, tmp)
 
 		case bytecode.Iadd:
 			g.convertBinOp(ir.InstIadd)
@@ -224,15 +323,7 @@ func (g *generator) generate(dst *ir.Method) error {
 		case bytecode.Iinc:
 			index := code[pc+1]
 			delta := int8(code[pc+2])
-			dst := ir.Arg{Kind: ir.ArgReg, Value: int64(index)}
-			g.out = append(g.out, ir.Inst{
-				Dst:  dst,
-				Kind: ir.InstIadd,
-				Args: []ir.Arg{
-					dst,
-					ir.Arg{Kind: ir.ArgIntConst, Value: int64(delta)},
-				},
-			})
+			g.convertIinc(int64(index), int64(delta))
 
 		case bytecode.L2i:
 			g.convertUnaryOp(ir.InstConvL2I)
@@ -247,57 +338,57 @@ func (g *generator) generate(dst *ir.Method) error {
 
 		case bytecode.Lcmp:
 			g.convertCmp(ir.InstLcmp)
-		case bytecode.Ifle:
-			if g.st.top().kind != valueFlags {
-				g.convertCmpZero()
-			}
-			g.convertCondJump(code, pc, ir.InstJumpLtEq)
+		case bytecode.Ifeq, bytecode.Ifnull:
+			err = g.convertCondJump(pc, ir.InstJumpEqual, b)
+		case bytecode.Ifne, bytecode.Ifnonnull:
+			err = g.convertCondJump(pc, ir.InstJumpNotEqual, b)
 		case bytecode.Iflt:
-			if g.st.top().kind != valueFlags {
-				g.convertCmpZero()
-			}
-			g.convertCondJump(code, pc, ir.InstJumpLt)
+			err = g.convertCondJump(pc, ir.InstJumpLt, b)
 		case bytecode.Ifge:
-			if g.st.top().kind != valueFlags {
-				g.convertCmpZero()
-			}
-			g.convertCondJump(code, pc, ir.InstJumpGtEq)
-		case bytecode.Ifeq:
-			if g.st.top().kind != valueFlags {
-				g.convertCmpZero()
-			}
-			g.convertCondJump(code, pc, ir.InstJumpEqual)
-		case bytecode.Ifne:
-			if g.st.top().kind != valueFlags {
-				g.convertCmpZero()
-			}
-			g.convertCondJump(code, pc, ir.InstJumpNotEqual)
+			err = g.convertCondJump(pc, ir.InstJumpGtEq, b)
+		case bytecode.Ifgt:
+			err = g.convertCondJump(pc, ir.InstJumpGt, b)
+		case bytecode.Ifle:
+			err = g.convertCondJump(pc, ir.InstJumpLtEq, b)
 
+		case bytecode.Ificmpeq:
+			g.convertCmp(ir.InstIcmp)
+			err = g.convertCondJump(pc, ir.InstJumpEqual, b)
 		case bytecode.Ificmpne:
 			g.convertCmp(ir.InstIcmp)
-			g.convertCondJump(code, pc, ir.InstJumpNotEqual)
+			err = g.convertCondJump(pc, ir.InstJumpNotEqual, b)
+		case bytecode.Ificmplt:
+			g.convertCmp(ir.InstIcmp)
+			err = g.convertCondJump(pc, ir.InstJumpLt, b)
 		case bytecode.Ificmpge:
 			g.convertCmp(ir.InstIcmp)
-			g.convertCondJump(code, pc, ir.InstJumpGtEq)
+			err = g.convertCondJump(pc, ir.InstJumpGtEq, b)
 		case bytecode.Ificmpgt:
 			g.convertCmp(ir.InstIcmp)
-			g.convertCondJump(code, pc, ir.InstJumpGt)
-
-		case bytecode.Goto:
-			ib1 := int16(code[pc+1])
-			ib2 := int16(code[pc+2])
-			inst := ir.Inst{
+			err = g.convertCondJump(pc, ir.InstJumpGt, b)
+		case bytecode.Ificmple:
+			g.convertCmp(ir.InstIcmp)
+			err = g.convertCondJump(pc, ir.InstJumpLtEq, b)
+		case bytecode.Ifacmpeq:
+			g.convertCmp(ir.InstAcmp)
+			err = g.convertCondJump(pc, ir.InstJumpEqual, b)
+		case bytecode.Ifacmpne:
+			g.convertCmp(ir.InstAcmp)
+			err = g.convertCondJump(pc, ir.InstJumpNotEqual, b)
+
+		case bytecode.Goto, bytecode.Gotow:
+			g.spillStack(nil)
+			err = g.enterBlock(b.succs[0])
+			g.out = append(g.out, ir.Inst{
 				Kind: ir.InstJump,
 				Args: []ir.Arg{
-					ir.Arg{Kind: ir.ArgBranch, Value: int64(ib1<<8 + ib2)},
+					{Kind: ir.ArgBranch, Value: int64(branchTarget(code, pc))},
 				},
-			}
-			g.out = append(g.out, inst)
-			g.toResolve = append(g.toResolve, unresolvedBranch{
-				pc:     int32(pc),
-				branch: &inst.Args[0].Value,
 			})
 
+		case bytecode.Tableswitch, bytecode.Lookupswitch:
+			err = g.convertSwitch(pc, b)
+
 		case bytecode.Invokestatic:
 			ib1 := uint(code[pc+1])
 			ib2 := uint(code[pc+2])
@@ -315,9 +406,10 @@ func (g *generator) generate(dst *ir.Method) error {
 			}
 			var dst ir.Arg
 			var tmp int64
-			if !strings.HasSuffix(m.Descriptor, ")V") {
+			retType := methodType(m.Descriptor)
+			if retType != typeInvalid {
 				tmp = g.st.nextTmp()
-				dst = ir.Arg{Kind: ir.ArgReg, Value: tmp + g.tmpOffset}
+				dst = g.tmpArg(tmp, retType)
 			}
 			op := ir.InstCallStatic
 			if method.AccessFlags.IsNative() {
@@ -330,7 +422,7 @@ func (g *generator) generate(dst *ir.Method) error {
 			})
 			g.st.drop(argc)
 			if dst.Kind != 0 {
-				g.st.push(valueTmp, tmp)
+				g.st.pushTmp(retType, tmp)
 			}
 
 		case bytecode.Ireturn:
@@ -351,125 +443,366 @@ func (g *generator) generate(dst *ir.Method) error {
 			panic(fmt.Sprintf("unhandled op=%[1]d (0x%[1]x)", code[pc]))
 		}
 
-		pc += int(bytecode.OpWidth[op])
-		prevOp = op
+		if err != nil {
+			return err
+		}
+		pc += bytecode.InstWidth(code, pc)
 	}
 
-	for _, u := range g.toResolve {
-		pc := u.pc
-		branch := int32(*u.branch)
-		index, ok := pc2index[pc+branch]
-		if !ok {
-			panic(fmt.Sprintf("can't resolve branch with pc=%d and branch=%d", pc, branch))
+	if len(b.succs) != 0 && !isBlockEnd(bytecode.Op(code[lastInstPC(code, b)])) {
+		// Falls through to the next block.
+		g.spillStack(nil)
+		if err := g.enterBlock(b.succs[0]); err != nil {
+			return err
 		}
-		*u.branch = int64(index)
 	}
 
-	g.out[0].Flags.SetJumpTarget(true)
-	for _, inst := range g.out {
-		if isJump(inst) {
-			index := inst.Args[0].Value
-			g.out[index].Flags.SetJumpTarget(true)
-		}
+	if g.st.tmp > g.maxTmp {
+		g.maxTmp = g.st.tmp
 	}
+	b.code = append([]ir.Inst(nil), g.out...)
+	return nil
+}
 
-	prevIsBranch := false
-	for i, inst := range g.out {
-		isLeader := i == 0 || prevIsBranch || inst.Flags.IsJumpTarget()
-		if isLeader {
-			g.out[i].Flags.SetBlockLead(true)
+// enterBlock records the current stack state as the b entry state.
+// The stack should be spilled before this call.
+func (g *generator) enterBlock(b *basicBlock) error {
+	if b.entryKnown {
+		if len(b.entry) != len(g.st.values) {
+			return fmt.Errorf("pc=%d: inconsistent stack depth: %d and %d",
+				b.start, len(b.entry), len(g.st.values))
 		}
-		prevIsBranch = isJump(inst)
+		return nil
 	}
 
-	out := make([]ir.Inst, len(g.out))
-	copy(out, g.out)
-	dst.Code = out
-	dst.Out.FrameSlots = int(g.tmpOffset + g.st.tmp)
+	b.entryKnown = true
+	b.entry = make([]valueType, len(g.st.values))
+	if frame := findFrame(int(b.start), g.frames); frame != nil {
+		if len(frame.Stack) != len(g.st.values) {
+			return fmt.Errorf("pc=%d: stack depth %d doesn't match the frame depth %d",
+				b.start, len(g.st.values), len(frame.Stack))
+		}
+		for i, typ := range frame.Stack {
+			b.entry[i] = frameValueType(typ)
+		}
+		return nil
+	}
+	for i, v := range g.st.values {
+		b.entry[i] = v.typ
+	}
 	return nil
 }
 
-func (g *generator) convertCondJump(code []byte, pc int, kind ir.InstKind) {
-	ib1 := int16(code[pc+1])
-	ib2 := int16(code[pc+2])
-	inst := ir.Inst{
+// spillStack moves all stack values to the tmps that
+// are expected at the successor blocks entry: value at depth i goes to tmp i.
+//
+// Live args are the values that are used after the spilling, like
+// comparison operands. They're copied if their tmps are overwritten.
+func (g *generator) spillStack(live []stackValue) {
+	type move struct {
+		dst ir.Arg
+		src ir.Arg
+		typ valueType
+	}
+	var moves []move
+	for i, v := range g.st.values {
+		if v.kind == valueTmp && v.value == int64(i) {
+			continue
+		}
+		moves = append(moves, move{dst: g.tmpArg(int64(i), v.typ), src: g.valueArg(v), typ: v.typ})
+	}
+	if int64(len(g.st.values)) > g.maxTmp {
+		g.maxTmp = int64(len(g.st.values))
+	}
+	if len(moves) == 0 {
+		return
+	}
+
+	isDst := func(arg ir.Arg) bool {
+		for _, m := range moves {
+			if sameReg(m.dst, arg) {
+				return true
+			}
+		}
+		return false
+	}
+	// scratch returns a tmp that is never used as a move destination.
+	scratch := func(typ valueType) ir.Arg {
+		tmp := g.st.tmp
+		g.st.tmp++
+		if tmp < int64(len(g.st.values)) {
+			tmp = int64(len(g.st.values))
+			g.st.tmp = tmp + 1
+		}
+		return g.tmpArg(tmp, typ)
+	}
+	for i, v := range live {
+		if v.kind == valueTmp && isDst(g.tmpArg(v.value, v.typ)) {
+			tmp := scratch(v.typ)
+			g.out = append(g.out, ir.Inst{Dst: tmp, Kind: moveKind(v.typ), Args: []ir.Arg{g.valueArg(v)}})
+			live[i] = stackValue{kind: valueTmp, value: tmp.Value - g.tmpOffset, typ: v.typ}
+		}
+	}
+
+	// Moves are performed in parallel: a value can't be overwritten
+	// before it's copied to all of its destinations.
+	for len(moves) != 0 {
+		progress := false
+		for i := 0; i < len(moves); i++ {
+			m := moves[i]
+			blocked := false
+			for _, other := range moves {
+				if sameReg(other.src, m.dst) && !sameReg(other.dst, m.dst) {
+					blocked = true
+					break
+				}
+			}
+			if blocked {
+				continue
+			}
+			g.out = append(g.out, ir.Inst{Dst: m.dst, Kind: moveKind(m.typ), Args: []ir.Arg{m.src}})
+			moves = append(moves[:i], moves[i+1:]...)
+			i--
+			progress = true
+		}
+		if !progress {
+			// A cycle: save one of the destinations and redirect its readers.
+			// The saved value is the one that is read by the blocked moves,
+			// so its type is taken from the reader.
+			dst := moves[0].dst
+			var typ valueType
+			for _, m := range moves {
+				if sameReg(m.src, dst) {
+					typ = m.typ
+					break
+				}
+			}
+			tmp := scratch(typ)
+			src := dst
+			src.Type = tmp.Type
+			g.out = append(g.out, ir.Inst{Dst: tmp, Kind: moveKind(typ), Args: []ir.Arg{src}})
+			for i := range moves {
+				if sameReg(moves[i].src, dst) {
+					moves[i].src = tmp
+				}
+			}
+		}
+	}
+
+	for i := range g.st.values {
+		g.st.values[i].kind = valueTmp
+		g.st.values[i].value = int64(i)
+	}
+	g.st.freelist = g.st.freelist[:0]
+}
+
+// convertCondJump emits a conditional jump that consumes the top stack value.
+// The value is either pending comparison flags or a value that is compared with 0 (or null).
+func (g *generator) convertCondJump(pc int, kind ir.InstKind, b *basicBlock) error {
+	if g.st.top().kind != valueFlags {
+		g.convertCmpZero()
+	}
+	g.st.values = g.st.values[:len(g.st.values)-1]
+
+	// Stack values are spilled before the comparison,
+	// so flags are not clobbered by the moves.
+	g.spillStack(g.cmp.args)
+	args := make([]ir.Arg, len(g.cmp.args))
+	for i, v := range g.cmp.args {
+		args[i] = g.valueArg(v)
+	}
+	g.out = append(g.out, ir.Inst{
+		Dst:  ir.Arg{Kind: ir.ArgFlags},
+		Kind: g.cmp.kind,
+		Args: args,
+	})
+	g.out = append(g.out, ir.Inst{
 		Kind: kind,
 		Args: []ir.Arg{
-			ir.Arg{Kind: ir.ArgBranch, Value: int64(ib1<<8 + ib2)},
-			ir.Arg{Kind: ir.ArgFlags},
+			{Kind: ir.ArgBranch, Value: int64(branchTarget(g.code, pc))},
+			{Kind: ir.ArgFlags},
 		},
-	}
-	g.out = append(g.out, inst)
-	g.toResolve = append(g.toResolve, unresolvedBranch{
-		pc:     int32(pc),
-		branch: &inst.Args[0].Value,
 	})
-
-	if g.st.top().kind != valueFlags {
-		panic(fmt.Sprintf("%s arg is not flags", kind))
+	for _, succ := range b.succs {
+		if err := g.enterBlock(succ); err != nil {
+			return err
+		}
 	}
-	g.st.drop(1)
+	return nil
 }
 
-func (g *generator) convertLoad(pc int, frames []jclass.StackMapFrame, prevOp bytecode.Op, index int64, kind ir.InstKind) {
-	if isUnconditionalBranch(prevOp) {
-		frame := findFrame(pc, frames)
-		if frame == nil {
-			panic(fmt.Sprintf("no frame for pc=%d", pc))
+// convertSwitch emits a multi-way branch that consumes the int stack top.
+func (g *generator) convertSwitch(pc int, b *basicBlock) error {
+	sw, err := bytecode.DecodeSwitch(g.code, pc)
+	if err != nil {
+		return err
+	}
+	live := []stackValue{g.st.top()}
+	g.st.values = g.st.values[:len(g.st.values)-1]
+	g.spillStack(live)
+	key := live[0]
+
+	branch := func(offset int32) ir.Arg {
+		return ir.Arg{Kind: ir.ArgBranch, Value: int64(pc) + int64(offset)}
+	}
+	if key.kind == valueIntConst {
+		// The target is known statically.
+		target := branch(sw.Default)
+		for i, k := range sw.Keys {
+			if int64(k) == key.value {
+				target = branch(sw.Offsets[i])
+				break
+			}
 		}
-		diff := len(g.st.values) - int(frame.StackDepth)
-		g.st.drop(diff)
-		tmp := g.st.nextTmp()
-		dst := ir.Arg{Kind: ir.ArgReg, Value: tmp + g.tmpOffset}
 		g.out = append(g.out, ir.Inst{
-			Dst:  dst,
-			Kind: kind,
-			Args: []ir.Arg{{Kind: ir.ArgReg, Value: index}},
+			Kind: ir.InstJump,
+			Args: []ir.Arg{target},
 		})
-		g.st.push(valueTmp, tmp)
 	} else {
+		args := make([]ir.Arg, 0, 2+len(sw.Keys)*2)
+		args = append(args, g.valueArg(key), branch(sw.Default))
+		for i, k := range sw.Keys {
+			args = append(args,
+				ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: int64(k)},
+				branch(sw.Offsets[i]))
+		}
+		g.out = append(g.out, ir.Inst{
+			Kind: ir.InstSwitch,
+			Args: args,
+		})
+	}
+
+	for _, succ := range b.succs {
+		if err := g.enterBlock(succ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detachLocal copies the stack values that reference the local variable
+// with the given index to the tmps, so they're not affected by the following
+// local variable assignment.
+func (g *generator) detachLocal(index int64) {
+	var tmp ir.Arg
+	for i, v := range g.st.values {
+		if !v.kind.isLocal() || v.value != index {
+			continue
+		}
+		if tmp.Kind == ir.ArgInvalid {
+			t := g.st.nextTmp()
+			tmp = g.tmpArg(t, v.typ)
+			g.out = append(g.out, ir.Inst{
+				Dst:  tmp,
+				Kind: moveKind(v.typ),
+				Args: []ir.Arg{g.valueArg(v)},
+			})
+			g.st.values[i] = stackValue{kind: valueTmp, value: t, typ: v.typ}
+			continue
+		}
+		g.st.values[i] = stackValue{kind: valueTmp, value: tmp.Value - g.tmpOffset, typ: v.typ}
+	}
+}
+
+// convertLoad pushes the local variable reference for the xload op.
+func (g *generator) convertLoad(op bytecode.Op, index int64) {
+	switch op {
+	case bytecode.Iload:
 		g.st.push(valueIntLocal, index)
+	case bytecode.Lload:
+		g.st.push(valueLongLocal, index)
+	case bytecode.Fload:
+		g.st.push(valueFloatLocal, index)
+	case bytecode.Dload:
+		g.st.push(valueDoubleLocal, index)
+	case bytecode.Aload:
+		g.st.push(valueRefLocal, index)
 	}
 }
 
-func (g *generator) convertStore(index int64, kind ir.InstKind) {
-	dst := ir.Arg{Kind: ir.ArgReg, Value: index}
+// convertStore emits the stack top assignment for the xstore op.
+func (g *generator) convertStore(op bytecode.Op, index int64) {
+	var typ valueType
+	switch op {
+	case bytecode.Istore:
+		typ = typeInt
+	case bytecode.Lstore:
+		typ = typeLong
+	case bytecode.Fstore:
+		typ = typeFloat
+	case bytecode.Dstore:
+		typ = typeDouble
+	case bytecode.Astore:
+		typ = typeRef
+	}
+	g.detachLocal(index)
+	dst := ir.Arg{Kind: ir.ArgReg, Type: irType(typ), Value: index}
 	g.out = append(g.out, ir.Inst{
 		Dst:  dst,
-		Kind: kind,
+		Kind: moveKind(typ),
 		Args: []ir.Arg{g.irArg(0)},
 	})
 	g.st.drop(1)
 }
 
-func (g *generator) convertCmpZero() {
-	var kind ir.InstKind
-	switch g.st.top().kind {
-	case valueIntLocal:
-		kind = ir.InstIcmp
-	default:
-		panic("unexpected kind for cmp zero") // FIXME
-	}
-
+func (g *generator) convertIinc(index, delta int64) {
+	g.detachLocal(index)
+	dst := ir.Arg{Kind: ir.ArgReg, Type: ir.TypeInt, Value: index}
 	g.out = append(g.out, ir.Inst{
-		Dst:  ir.Arg{Kind: ir.ArgFlags},
-		Kind: kind,
+		Dst:  dst,
+		Kind: ir.InstIadd,
 		Args: []ir.Arg{
-			g.irArg(0),
-			ir.Arg{Kind: ir.ArgIntConst, Value: 0},
+			dst,
+			{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: delta},
 		},
 	})
+}
+
+// convertLdc pushes the int or float constant from the constant pool.
+// String and class constants are not supported yet.
+func (g *generator) convertLdc(pc int, i uint) error {
+	switch c := g.f.Consts[i]; c := c.(type) {
+	case *jclass.IntConst:
+		g.st.push(valueIntConst, int64(c.Value))
+	case *jclass.FloatConst:
+		g.st.push(valueFloatConst, int64(math.Float32bits(c.Value)))
+	case *jclass.StringConst:
+		return fmt.Errorf("pc=%d: %s: string constants are not supported", pc, bytecode.Op(g.code[pc]))
+	case *jclass.ClassConst:
+		return fmt.Errorf("pc=%d: %s: class constants are not supported", pc, bytecode.Op(g.code[pc]))
+	default:
+		panic(fmt.Sprintf("%T const ldc", c))
+	}
+	return nil
+}
+
+// convertCmpZero pushes the flags of the stack top comparison with 0.
+// References are compared with null.
+func (g *generator) convertCmpZero() {
+	x := g.st.top()
 	g.st.drop(1)
-	g.st.push(valueFlags, 0)
+	switch x.typ {
+	case typeLong:
+		g.pushCmp(ir.InstLcmp, x, stackValue{kind: valueLongConst, typ: typeLong})
+	case typeRef:
+		g.pushCmp(ir.InstAcmp, x, stackValue{kind: valueIntConst, typ: typeRef})
+	default:
+		g.pushCmp(ir.InstIcmp, x, stackValue{kind: valueIntConst, typ: typeInt})
+	}
 }
 
+// convertCmp pushes the flags of the two top stack values comparison.
 func (g *generator) convertCmp(kind ir.InstKind) {
-	g.out = append(g.out, ir.Inst{
-		Dst:  ir.Arg{Kind: ir.ArgFlags},
-		Kind: kind,
-		Args: []ir.Arg{g.irArg(1), g.irArg(0)},
-	})
+	x := g.st.get(1)
+	y := g.st.get(0)
 	g.st.drop(2)
+	g.pushCmp(kind, x, y)
+}
+
+// pushCmp pushes the comparison flags.
+// The comparison itself is emitted by the conditional jump that consumes them.
+func (g *generator) pushCmp(kind ir.InstKind, x, y stackValue) {
+	g.cmp = pendingCmp{kind: kind, args: []stackValue{x, y}}
 	g.st.push(valueFlags, 0)
 }
 
@@ -496,9 +829,8 @@ func (g *generator) convertNewArray(code []byte, pc int) {
 	}
 
 	tmp := g.st.nextTmp()
-	dst := ir.Arg{Kind: ir.ArgReg, Value: tmp + g.tmpOffset}
 	g.out = append(g.out, ir.Inst{
-		Dst:  dst,
+		Dst:  g.tmpArg(tmp, typeRef),
 		Kind: kind,
 		Args: []ir.Arg{
 			{Kind: ir.ArgEnv},
@@ -506,31 +838,31 @@ func (g *generator) convertNewArray(code []byte, pc int) {
 		},
 	})
 	g.st.drop(1)
-	g.st.push(valueTmp, tmp)
+	g.st.pushTmp(typeRef, tmp)
 }
 
 func (g *generator) convertUnaryOp(kind ir.InstKind) {
 	tmp := g.st.nextTmp()
-	dst := ir.Arg{Kind: ir.ArgReg, Value: tmp + g.tmpOffset}
+	typ := resultType(kind)
 	g.out = append(g.out, ir.Inst{
-		Dst:  dst,
+		Dst:  g.tmpArg(tmp, typ),
 		Kind: kind,
 		Args: []ir.Arg{g.irArg(0)},
 	})
 	g.st.drop(1)
-	g.st.push(valueTmp, tmp)
+	g.st.pushTmp(typ, tmp)
 }
 
 func (g *generator) convertBinOp(kind ir.InstKind) {
 	tmp := g.st.nextTmp()
-	dst := ir.Arg{Kind: ir.ArgReg, Value: tmp + g.tmpOffset}
+	typ := resultType(kind)
 	g.out = append(g.out, ir.Inst{
-		Dst:  dst,
+		Dst:  g.tmpArg(tmp, typ),
 		Kind: kind,
 		Args: []ir.Arg{g.irArg(1), g.irArg(0)},
 	})
 	g.st.drop(2)
-	g.st.push(valueTmp, tmp)
+	g.st.pushTmp(typ, tmp)
 }
 
 func (g *generator) convertRet(kind ir.InstKind) {
@@ -4,10 +4,25 @@ import (
 	"fmt"
 
 	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/verify"
 	"github.com/quasilyte/go-jdk/vmdat"
 )
 
-func Generate(st *vmdat.State, packages []*ir.Package) error {
+type Config struct {
+	// Debug enables the extra consistency checks.
+	// Every generated method is validated with ir.Verify.
+	Debug bool
+
+	// Lazy makes Generate mark the methods as Lazy instead
+	// of generating their IR. Lazy compilers generate it
+	// right before the method compilation, see jit.Context.
+	//
+	// Lazily decoded methods (see loader.Config) are not
+	// decoded until their IR is generated.
+	Lazy bool
+}
+
+func Generate(st *vmdat.State, packages []*ir.Package, cfg *Config) error {
 	var g generator
 	g.state = st
 	for _, pkg := range packages {
@@ -22,10 +37,29 @@ func Generate(st *vmdat.State, packages []*ir.Package) error {
 				if m.Out.AccessFlags.IsNative() {
 					continue
 				}
-				if err := g.Generate(j, m); err != nil {
+				if cfg.Lazy {
+					m.Lazy = true
+					continue
+				}
+				// Packages may contain only some of the class methods.
+				index := int(m.Out.ID.MemberIndex())
+				if c.Unverified {
+					if err := verify.Method(c.File, &c.File.Methods[index]); err != nil {
+						return fmt.Errorf("%s: %s.%s: verify: %v",
+							pkg.Out.Name, c.Name, m.Out.Name, err)
+					}
+				}
+				if err := g.Generate(index, m); err != nil {
 					return fmt.Errorf("%s: %s.%s: %v",
 						pkg.Out.Name, c.Name, m.Out.Name, err)
 				}
+				m.Lazy = false
+				if cfg.Debug {
+					if err := ir.Verify(m); err != nil {
+						return fmt.Errorf("%s: %s.%s: verify IR: %v",
+							pkg.Out.Name, c.Name, m.Out.Name, err)
+					}
+				}
 			}
 		}
 	}
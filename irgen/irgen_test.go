@@ -1,8 +1,10 @@
 package irgen
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os/exec"
 	"path/filepath"
 	"regexp"
@@ -10,8 +12,11 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/quasilyte/go-jdk/bytecode"
 	"github.com/quasilyte/go-jdk/ir"
 	"github.com/quasilyte/go-jdk/irfmt"
+	"github.com/quasilyte/go-jdk/jclass"
+	"github.com/quasilyte/go-jdk/jclass/jclasstest"
 	"github.com/quasilyte/go-jdk/loader"
 	"github.com/quasilyte/go-jdk/vmdat"
 )
@@ -41,6 +46,822 @@ func TestArgCount(t *testing.T) {
 	}
 }
 
+func TestGenerateBranches(t *testing.T) {
+	intItem := jclass.VerificationType{Tag: jclass.VerifInteger}
+	longItem := jclass.VerificationType{Tag: jclass.VerifLong}
+
+	tests := []generateTest{
+		{
+			// return (x < 0) ? -x : x;
+			name:      "labs",
+			desc:      "(J)J",
+			maxLocals: 2,
+			code: []byte{
+				op(bytecode.Lload0),
+				op(bytecode.Lconst0),
+				op(bytecode.Lcmp),
+				op(bytecode.Ifge), 0, 8,
+				op(bytecode.Lload0),
+				op(bytecode.Lneg),
+				op(bytecode.Goto), 0, 4,
+				op(bytecode.Lload0),
+				op(bytecode.Lreturn),
+			},
+			frames: []jclass.StackMapFrame{
+				{Offset: 11, Kind: jclass.SameFrame},
+				{Offset: 12, Kind: jclass.SameLocals1StackItemFrame, Stack: []jclass.VerificationType{longItem}},
+			},
+			want: []string{
+				"slots=3",
+				"  b0 flags = Lcmp r0 0",
+				"  b0 JumpGtEq label0 flags",
+				"  b1 r2 = Lneg r0",
+				"  b1 Jump label1",
+				"label0:",
+				"  b2 r2 = Lload r0",
+				"label1:",
+				"  b3 Lret r2",
+			},
+		},
+
+		{
+			// return x + (c ? 1 : 2);
+			name:      "addCond",
+			desc:      "(IZ)I",
+			maxLocals: 2,
+			code: []byte{
+				op(bytecode.Iload0),
+				op(bytecode.Iload1),
+				op(bytecode.Ifeq), 0, 7,
+				op(bytecode.Iconst1),
+				op(bytecode.Goto), 0, 4,
+				op(bytecode.Iconst2),
+				op(bytecode.Iadd),
+				op(bytecode.Ireturn),
+			},
+			frames: []jclass.StackMapFrame{
+				{Offset: 9, Kind: jclass.SameLocals1StackItemFrame, Stack: []jclass.VerificationType{intItem}},
+				{Offset: 10, Kind: jclass.FullFrame, Stack: []jclass.VerificationType{intItem, intItem}},
+			},
+			want: []string{
+				"slots=5",
+				"  b0 r2 = Iload r0",
+				"  b0 flags = Icmp r1 0",
+				"  b0 JumpEqual label0 flags",
+				"  b1 r3 = Iload 1",
+				"  b1 Jump label1",
+				"label0:",
+				"  b2 r3 = Iload 2",
+				"label1:",
+				"  b3 r4 = Iadd r2 r3",
+				"  b3 Iret r4",
+			},
+		},
+
+		{
+			// return x > 0 && y > 0;
+			name:      "and",
+			desc:      "(II)Z",
+			maxLocals: 2,
+			code: []byte{
+				op(bytecode.Iload0),
+				op(bytecode.Ifle), 0, 11,
+				op(bytecode.Iload1),
+				op(bytecode.Ifle), 0, 7,
+				op(bytecode.Iconst1),
+				op(bytecode.Goto), 0, 4,
+				op(bytecode.Iconst0),
+				op(bytecode.Ireturn),
+			},
+			frames: []jclass.StackMapFrame{
+				{Offset: 12, Kind: jclass.SameFrame},
+				{Offset: 13, Kind: jclass.SameLocals1StackItemFrame, Stack: []jclass.VerificationType{intItem}},
+			},
+			want: []string{
+				"slots=3",
+				"  b0 flags = Icmp r0 0",
+				"  b0 JumpLtEq label0 flags",
+				"  b1 flags = Icmp r1 0",
+				"  b1 JumpLtEq label0 flags",
+				"  b2 r2 = Iload 1",
+				"  b2 Jump label1",
+				"label0:",
+				"  b3 r2 = Iload 0",
+				"label1:",
+				"  b4 Iret r2",
+			},
+		},
+
+		{
+			// return (x != null) ? 1 : 0;
+			name:      "nonnull",
+			desc:      "(Ljava/lang/Object;)I",
+			maxLocals: 1,
+			code: []byte{
+				op(bytecode.Aload0),
+				op(bytecode.Ifnonnull), 0, 5,
+				op(bytecode.Iconst0),
+				op(bytecode.Ireturn),
+				op(bytecode.Iconst1),
+				op(bytecode.Ireturn),
+			},
+			frames: []jclass.StackMapFrame{
+				{Offset: 6, Kind: jclass.SameFrame},
+			},
+			want: []string{
+				"slots=1",
+				"  b0 flags = Acmp r0 0",
+				"  b0 JumpNotEqual label0 flags",
+				"  b1 Iret 0",
+				"label0:",
+				"  b2 Iret 1",
+			},
+		},
+
+		{
+			// return x == y;
+			name:      "refEqual",
+			desc:      "(Ljava/lang/Object;Ljava/lang/Object;)Z",
+			maxLocals: 2,
+			code: []byte{
+				op(bytecode.Aload0),
+				op(bytecode.Aload1),
+				op(bytecode.Ifacmpne), 0, 5,
+				op(bytecode.Iconst1),
+				op(bytecode.Ireturn),
+				op(bytecode.Iconst0),
+				op(bytecode.Ireturn),
+			},
+			frames: []jclass.StackMapFrame{
+				{Offset: 7, Kind: jclass.SameFrame},
+			},
+			want: []string{
+				"slots=2",
+				"  b0 flags = Acmp r0 r1",
+				"  b0 JumpNotEqual label0 flags",
+				"  b1 Iret 1",
+				"label0:",
+				"  b2 Iret 0",
+			},
+		},
+
+		{
+			// return (x > y) ? x : y;
+			name:      "max",
+			desc:      "(II)I",
+			maxLocals: 2,
+			code: []byte{
+				op(bytecode.Iload0),
+				op(bytecode.Iload1),
+				op(bytecode.Ificmple), 0, 5,
+				op(bytecode.Iload0),
+				op(bytecode.Ireturn),
+				op(bytecode.Iload1),
+				op(bytecode.Ireturn),
+			},
+			frames: []jclass.StackMapFrame{
+				{Offset: 7, Kind: jclass.SameFrame},
+			},
+			want: []string{
+				"slots=2",
+				"  b0 flags = Icmp r0 r1",
+				"  b0 JumpLtEq label0 flags",
+				"  b1 Iret r0",
+				"label0:",
+				"  b2 Iret r1",
+			},
+		},
+
+		{
+			// return (x <= 0) ? 0 : 1;
+			name:      "positive",
+			desc:      "(J)I",
+			maxLocals: 2,
+			code: []byte{
+				op(bytecode.Lload0),
+				op(bytecode.Lconst0),
+				op(bytecode.Lcmp),
+				op(bytecode.Ifgt), 0, 5,
+				op(bytecode.Iconst0),
+				op(bytecode.Ireturn),
+				op(bytecode.Iconst1),
+				op(bytecode.Ireturn),
+			},
+			frames: []jclass.StackMapFrame{
+				{Offset: 8, Kind: jclass.SameFrame},
+			},
+			want: []string{
+				"slots=2",
+				"  b0 flags = Lcmp r0 0",
+				"  b0 JumpGt label0 flags",
+				"  b1 Iret 0",
+				"label0:",
+				"  b2 Iret 1",
+			},
+		},
+
+		{
+			// switch (x) { case 1: return 10; case 2: return 20; default: return 0; }
+			name:      "tableswitch",
+			desc:      "(I)I",
+			maxLocals: 1,
+			code: []byte{
+				op(bytecode.Iload0),
+				op(bytecode.Tableswitch), 0, 0,
+				0, 0, 0, 29,
+				0, 0, 0, 1,
+				0, 0, 0, 2,
+				0, 0, 0, 23,
+				0, 0, 0, 26,
+				op(bytecode.Bipush), 10,
+				op(bytecode.Ireturn),
+				op(bytecode.Bipush), 20,
+				op(bytecode.Ireturn),
+				op(bytecode.Iconst0),
+				op(bytecode.Ireturn),
+			},
+			frames: []jclass.StackMapFrame{
+				{Offset: 24, Kind: jclass.SameFrame},
+				{Offset: 27, Kind: jclass.SameFrame},
+				{Offset: 30, Kind: jclass.SameFrame},
+			},
+			want: []string{
+				"slots=1",
+				"  b0 Switch r0 label2 1 label0 2 label1",
+				"label0:",
+				"  b1 Iret 10",
+				"label1:",
+				"  b2 Iret 20",
+				"label2:",
+				"  b3 Iret 0",
+			},
+		},
+
+		{
+			// return (x + 1) + switch (x) { case -5, 1000 -> 1; default -> 2; };
+			// Written as "iload_0; iconst_1; iadd; iload_0; lookupswitch ...; iadd; ireturn".
+			name:      "lookupswitch",
+			desc:      "(I)I",
+			maxLocals: 1,
+			code: []byte{
+				op(bytecode.Iload0),
+				op(bytecode.Iconst1),
+				op(bytecode.Iadd),
+				op(bytecode.Iload0),
+				op(bytecode.Lookupswitch), 0, 0, 0,
+				0, 0, 0, 32,
+				0, 0, 0, 2,
+				0xff, 0xff, 0xff, 0xfb, 0, 0, 0, 28,
+				0, 0, 0x03, 0xe8, 0, 0, 0, 28,
+				op(bytecode.Iconst1),
+				op(bytecode.Goto), 0, 4,
+				op(bytecode.Iconst2),
+				op(bytecode.Iadd),
+				op(bytecode.Ireturn),
+			},
+			frames: []jclass.StackMapFrame{
+				{Offset: 32, Kind: jclass.SameLocals1StackItemFrame, Stack: []jclass.VerificationType{intItem}},
+				{Offset: 36, Kind: jclass.SameLocals1StackItemFrame, Stack: []jclass.VerificationType{intItem}},
+				{Offset: 37, Kind: jclass.FullFrame, Locals: []jclass.VerificationType{intItem}, Stack: []jclass.VerificationType{intItem, intItem}},
+			},
+			want: []string{
+				"slots=4",
+				"  b0 r1 = Iadd r0 1",
+				"  b0 Switch r0 label1 -5 label0 1000 label0",
+				"label0:",
+				"  b1 r2 = Iload 1",
+				"  b1 Jump label2",
+				"label1:",
+				"  b2 r2 = Iload 2",
+				"label2:",
+				"  b3 r3 = Iadd r1 r2",
+				"  b3 Iret r3",
+			},
+		},
+
+		{
+			// int y = x; x++; return y + x;
+			// Written as "iload_0; iinc 0 1; iload_0; iadd; ireturn".
+			name:      "postinc",
+			desc:      "(I)I",
+			maxLocals: 1,
+			code: []byte{
+				op(bytecode.Iload0),
+				op(bytecode.Iinc), 0, 1,
+				op(bytecode.Iload0),
+				op(bytecode.Iadd),
+				op(bytecode.Ireturn),
+			},
+			want: []string{
+				"slots=3",
+				"  b0 r1 = Iload r0",
+				"  b0 r0 = Iadd r0 1",
+				"  b0 r2 = Iadd r1 r0",
+				"  b0 Iret r2",
+			},
+		},
+	}
+
+	runGenerateTests(t, tests)
+}
+
+func TestGenerateWide(t *testing.T) {
+	// A constant pool that can't be addressed with a single byte index.
+	consts := make([]jclass.Const, 302)
+	for i := 1; i < len(consts); i++ {
+		consts[i] = &jclass.IntConst{Value: int32(i)}
+	}
+	consts[300] = &jclass.IntConst{Value: 100000}
+	consts[301] = &jclass.FloatConst{Value: 1.5}
+
+	tests := []generateTest{
+		{
+			// locals[300] = 100000; locals[300] += 1000; return locals[300];
+			name:      "wideInt",
+			desc:      "()I",
+			maxLocals: 301,
+			code: []byte{
+				op(bytecode.Ldcw), 0x01, 0x2c,
+				op(bytecode.Wide), op(bytecode.Istore), 0x01, 0x2c,
+				op(bytecode.Wide), op(bytecode.Iinc), 0x01, 0x2c, 0x03, 0xe8,
+				op(bytecode.Wide), op(bytecode.Iload), 0x01, 0x2c,
+				op(bytecode.Ireturn),
+			},
+			consts: consts,
+			want: []string{
+				"slots=301",
+				"  b0 r300 = Iload 100000",
+				"  b0 r300 = Iadd r300 1000",
+				"  b0 Iret r300",
+			},
+		},
+
+		{
+			// Every xload/xstore form with explicit and implicit index.
+			name:      "wideMoves",
+			desc:      "(JLjava/lang/Object;)J",
+			maxLocals: 400,
+			code: []byte{
+				op(bytecode.Ldcw), 0x01, 0x2d,
+				op(bytecode.Fstore), 200,
+				op(bytecode.Fload), 200,
+				op(bytecode.Wide), op(bytecode.Fstore), 0x01, 0x2c,
+				op(bytecode.Fload1),
+				op(bytecode.Fstore0),
+				op(bytecode.Aload2),
+				op(bytecode.Astore), 5,
+				op(bytecode.Aload), 5,
+				op(bytecode.Wide), op(bytecode.Astore), 0x01, 0x00,
+				op(bytecode.Dconst1),
+				op(bytecode.Dstore), 10,
+				op(bytecode.Dload), 10,
+				op(bytecode.Wide), op(bytecode.Dstore), 0x01, 0x2e,
+				op(bytecode.Wide), op(bytecode.Dload), 0x01, 0x2e,
+				op(bytecode.Dstore2),
+				op(bytecode.Lload0),
+				op(bytecode.Wide), op(bytecode.Lstore), 0x01, 0x40,
+				op(bytecode.Wide), op(bytecode.Lload), 0x01, 0x40,
+				op(bytecode.Lreturn),
+			},
+			consts: consts,
+			want: []string{
+				"slots=400",
+				"  b0 r200 = Iload 1.5",
+				"  b0 r300 = Iload r200",
+				"  b0 r0 = Iload r1",
+				"  b0 r5 = Aload r2",
+				"  b0 r256 = Aload r5",
+				"  b0 r10 = Lload 1.0",
+				"  b0 r302 = Lload r10",
+				"  b0 r2 = Lload r302",
+				"  b0 r320 = Lload r0",
+				"  b0 Lret r320",
+			},
+		},
+
+		{
+			name:      "sipush",
+			desc:      "()I",
+			maxLocals: 1,
+			code: []byte{
+				op(bytecode.Sipush), 0xff, 0x38,
+				op(bytecode.Sipush), 0x01, 0x80,
+				op(bytecode.Iadd),
+				op(bytecode.Ireturn),
+			},
+			want: []string{
+				"slots=2",
+				"  b0 r1 = Iadd -200 384",
+				"  b0 Iret r1",
+			},
+		},
+	}
+
+	runGenerateTests(t, tests)
+}
+
+func TestGenerateStackOps(t *testing.T) {
+	tests := []generateTest{
+		{
+			// a[i]++; return a[i];
+			name:      "arrayInc",
+			desc:      "([II)I",
+			maxLocals: 2,
+			code: []byte{
+				op(bytecode.Aload0),
+				op(bytecode.Iload1),
+				op(bytecode.Dup2),
+				op(bytecode.Iaload),
+				op(bytecode.Iconst1),
+				op(bytecode.Iadd),
+				op(bytecode.Iastore),
+				op(bytecode.Aload0),
+				op(bytecode.Iload1),
+				op(bytecode.Iaload),
+				op(bytecode.Ireturn),
+			},
+			want: []string{
+				"slots=4",
+				"  b0 r2 = IntArrayGet r0 r1",
+				"  b0 r3 = Iadd r2 1",
+				"  b0 IntArraySet r0 r1 r3",
+				"  b0 r3 = IntArrayGet r0 r1",
+				"  b0 Iret r3",
+			},
+		},
+
+		{
+			// return a[i] = v;
+			name:      "storeExpr",
+			desc:      "([III)I",
+			maxLocals: 3,
+			code: []byte{
+				op(bytecode.Aload0),
+				op(bytecode.Iload1),
+				op(bytecode.Iload2),
+				op(bytecode.Dupx2),
+				op(bytecode.Iastore),
+				op(bytecode.Ireturn),
+			},
+			want: []string{
+				"slots=3",
+				"  b0 IntArraySet r0 r1 r2",
+				"  b0 Iret r2",
+			},
+		},
+
+		{
+			// long a, b; a = b = x + 1; return a + b;
+			name:      "chainAssign",
+			desc:      "(J)J",
+			maxLocals: 6,
+			code: []byte{
+				op(bytecode.Lload0),
+				op(bytecode.Lconst1),
+				op(bytecode.Ladd),
+				op(bytecode.Dup2),
+				op(bytecode.Lstore), 4,
+				op(bytecode.Lstore2),
+				op(bytecode.Lload2),
+				op(bytecode.Lload), 4,
+				op(bytecode.Ladd),
+				op(bytecode.Lreturn),
+			},
+			want: []string{
+				"slots=7",
+				"  b0 r6 = Ladd r0 1",
+				"  b0 r4 = Lload r6",
+				"  b0 r2 = Lload r6",
+				"  b0 r6 = Ladd r2 r4",
+				"  b0 Lret r6",
+			},
+		},
+
+		{
+			name:      "pops",
+			desc:      "(IJ)I",
+			maxLocals: 3,
+			code: []byte{
+				op(bytecode.Iload0),
+				op(bytecode.Lload1),
+				op(bytecode.Pop2),
+				op(bytecode.Iload0),
+				op(bytecode.Iconst1),
+				op(bytecode.Pop2),
+				op(bytecode.Iconst2),
+				op(bytecode.Pop),
+				op(bytecode.Ireturn),
+			},
+			want: []string{
+				"slots=3",
+				"  b0 Iret r0",
+			},
+		},
+
+		{
+			name:      "swapDupx1",
+			desc:      "(II)I",
+			maxLocals: 2,
+			code: []byte{
+				op(bytecode.Iload0),
+				op(bytecode.Iload1),
+				op(bytecode.Swap),
+				op(bytecode.Dupx1),
+				op(bytecode.Isub),
+				op(bytecode.Isub),
+				op(bytecode.Ireturn),
+			},
+			want: []string{
+				"slots=4",
+				"  b0 r2 = Isub r1 r0",
+				"  b0 r3 = Isub r0 r2",
+				"  b0 Iret r3",
+			},
+		},
+
+		{
+			name:      "dup2x1",
+			desc:      "(III)I",
+			maxLocals: 3,
+			code: []byte{
+				op(bytecode.Iload0),
+				op(bytecode.Iload1),
+				op(bytecode.Iload2),
+				op(bytecode.Dup2x1),
+				op(bytecode.Isub),
+				op(bytecode.Isub),
+				op(bytecode.Isub),
+				op(bytecode.Isub),
+				op(bytecode.Ireturn),
+			},
+			want: []string{
+				"slots=5",
+				"  b0 r3 = Isub r1 r2",
+				"  b0 r4 = Isub r0 r3",
+				"  b0 r3 = Isub r2 r4",
+				"  b0 r4 = Isub r1 r3",
+				"  b0 Iret r4",
+			},
+		},
+
+		{
+			// Category 2 value is duplicated beneath a category 1 value.
+			name:      "dup2x1Long",
+			desc:      "(IJ)J",
+			maxLocals: 3,
+			code: []byte{
+				op(bytecode.Iload0),
+				op(bytecode.Lload1),
+				op(bytecode.Lconst1),
+				op(bytecode.Ladd),
+				op(bytecode.Dup2x1),
+				op(bytecode.Lstore1),
+				op(bytecode.Pop),
+				op(bytecode.Lreturn),
+			},
+			want: []string{
+				"slots=4",
+				"  b0 r3 = Ladd r1 1",
+				"  b0 r1 = Lload r3",
+				"  b0 Lret r3",
+			},
+		},
+
+		{
+			name:      "dup2x2",
+			desc:      "(JJ)J",
+			maxLocals: 4,
+			code: []byte{
+				op(bytecode.Lload0),
+				op(bytecode.Lload2),
+				op(bytecode.Dup2x2),
+				op(bytecode.Ladd),
+				op(bytecode.Ladd),
+				op(bytecode.Lreturn),
+			},
+			want: []string{
+				"slots=6",
+				"  b0 r4 = Ladd r0 r2",
+				"  b0 r5 = Ladd r2 r4",
+				"  b0 Lret r5",
+			},
+		},
+
+		{
+			name:      "dup2x2Mixed",
+			desc:      "(JII)J",
+			maxLocals: 4,
+			code: []byte{
+				op(bytecode.Lload0),
+				op(bytecode.Iload2),
+				op(bytecode.Iload3),
+				op(bytecode.Dup2x2),
+				op(bytecode.Isub),
+				op(bytecode.Pop),
+				op(bytecode.Pop2),
+				op(bytecode.Isub),
+				op(bytecode.I2l),
+				op(bytecode.Lreturn),
+			},
+			want: []string{
+				"slots=6",
+				"  b0 r4 = Isub r2 r3",
+				"  b0 r4 = Isub r2 r3",
+				"  b0 r5 = ConvI2L r4",
+				"  b0 Lret r5",
+			},
+		},
+	}
+
+	runGenerateTests(t, tests)
+}
+
+func TestGenerateSubroutines(t *testing.T) {
+	// Pre-51 class file that uses a subroutine:
+	// "jsr L; iconst_1; ireturn; L: astore_0; ret 0"
+	code := []byte{
+		byte(bytecode.Jsr), 0, 5,
+		byte(bytecode.Iconst1),
+		byte(bytecode.Ireturn),
+		byte(bytecode.Astore0),
+		byte(bytecode.Ret), 0,
+	}
+	var st vmdat.State
+	st.Init()
+	f := &jclass.File{
+		Ver: jclass.Version{Major: 49},
+		Methods: []jclass.Method{{
+			Name:       "f",
+			Descriptor: "()I",
+			Attrs: []jclass.Attribute{jclass.CodeAttribute{
+				MaxStack:  1,
+				MaxLocals: 1,
+				Code:      code,
+			}},
+		}},
+	}
+	m := &ir.Method{
+		Out: &vmdat.Method{Name: "f", Descriptor: "()I"},
+	}
+	g := generator{state: &st, f: f}
+	err := g.Generate(0, m)
+	want := "pc=0: jsr: subroutines of the class files before version 51 are not supported"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("error mismatch:\nhave: %v\nwant: %s", err, want)
+	}
+}
+
+func TestGenerateStringConst(t *testing.T) {
+	var st vmdat.State
+	st.Init()
+	f := &jclass.File{
+		Ver: jclass.Version{Major: 52},
+		Consts: []jclass.Const{
+			1: &jclass.StringConst{Value: "hello"},
+		},
+		Methods: []jclass.Method{{
+			Name:       "f",
+			Descriptor: "()Ljava/lang/String;",
+			Attrs: []jclass.Attribute{jclass.CodeAttribute{
+				MaxStack: 1,
+				Code:     []byte{byte(bytecode.Ldc), 1, byte(bytecode.Areturn)},
+			}},
+		}},
+	}
+	m := &ir.Method{
+		Out: &vmdat.Method{Name: "f", Descriptor: "()Ljava/lang/String;"},
+	}
+	g := generator{state: &st, f: f}
+	err := g.Generate(0, m)
+	want := "pc=0: ldc: string constants are not supported"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("error mismatch:\nhave: %v\nwant: %s", err, want)
+	}
+}
+
+func TestGenerateDecodedFloats(t *testing.T) {
+	// #1 is a Float, #2-#299 are Integers and #300 is a Float,
+	// so it can only be loaded by ldc_w.
+	w := jclasstest.NewWriter()
+	w.U4(0xCAFEBABE)
+	w.U2(0)   // minor_version
+	w.U2(52)  // major_version
+	w.U2(303) // constant_pool_count
+	w.U1(4)   // #1 Float
+	w.U4(math.Float32bits(2.5))
+	for i := 2; i < 300; i++ {
+		w.U1(3) // Integer
+		w.U4(uint32(i))
+	}
+	w.U1(4) // #300 Float
+	w.U4(math.Float32bits(1.5))
+	w.Utf8("Foo") // #301
+	w.U1(7)       // #302 Class
+	w.U2(301)     //
+	w.U2(0x0021)  // access_flags
+	w.U2(302)     // this_class
+	w.U2(0)       // super_class
+	w.U2(0)       // interfaces_count
+	w.U2(0)       // fields_count
+	w.U2(0)       // methods_count
+	w.U2(0)       // attributes_count
+
+	var dec jclass.Decoder
+	f, err := dec.Decode(bytes.NewReader(w.Buf))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	tests := []generateTest{
+		{
+			name: "ldcFloat",
+			desc: "()I",
+			code: []byte{
+				op(bytecode.Ldc), 1,
+				op(bytecode.F2i),
+				op(bytecode.Ireturn),
+			},
+			consts: f.Consts,
+			want: []string{
+				"slots=1",
+				"  b0 r0 = ConvF2I 2.5",
+				"  b0 Iret r0",
+			},
+		},
+		{
+			name: "ldcwFloat",
+			desc: "()I",
+			code: []byte{
+				op(bytecode.Ldcw), 0x01, 0x2c,
+				op(bytecode.Ldc), 1,
+				op(bytecode.Fadd),
+				op(bytecode.F2i),
+				op(bytecode.Ireturn),
+			},
+			consts: f.Consts,
+			want: []string{
+				"slots=2",
+				"  b0 r0 = Fadd 1.5 2.5",
+				"  b0 r1 = ConvF2I r0",
+				"  b0 Iret r1",
+			},
+		},
+	}
+
+	runGenerateTests(t, tests)
+}
+
+type generateTest struct {
+	name      string
+	desc      string
+	maxLocals uint16
+	code      []byte
+	frames    []jclass.StackMapFrame
+	consts    []jclass.Const
+	want      []string
+}
+
+func runGenerateTests(t *testing.T, tests []generateTest) {
+	t.Helper()
+	for _, test := range tests {
+		var st vmdat.State
+		st.Init()
+		code := jclass.CodeAttribute{
+			MaxStack:  4,
+			MaxLocals: test.maxLocals,
+			Code:      test.code,
+		}
+		if test.frames != nil {
+			code.Attrs = []jclass.Attribute{jclass.StackMapTableAttribute{Frames: test.frames}}
+		}
+		f := &jclass.File{
+			Ver:    jclass.Version{Major: 52},
+			Consts: test.consts,
+			Methods: []jclass.Method{{
+				Name:       test.name,
+				Descriptor: test.desc,
+				Attrs:      []jclass.Attribute{code},
+			}},
+		}
+		m := &ir.Method{
+			Out: &vmdat.Method{Name: test.name, Descriptor: test.desc},
+		}
+		g := generator{state: &st, f: f}
+		if err := g.Generate(0, m); err != nil {
+			t.Errorf("%s: generate: %v", test.name, err)
+			continue
+		}
+		if err := ir.Verify(m); err != nil {
+			t.Errorf("%s: verify: %v", test.name, err)
+		}
+		have := sprintMethod(&st, m)
+		want := strings.Join(test.want, "\n") + "\n"
+		if have != want {
+			t.Errorf("%s:\nhave:\n%s\nwant:\n%s", test.name, have, want)
+		}
+	}
+}
+
 func TestIrgen(t *testing.T) {
 	absTestdata, err := filepath.Abs("testdata")
 	if err != nil {
@@ -108,7 +929,7 @@ func TestIrgen(t *testing.T) {
 	if len(packages) != 1 {
 		t.Fatalf("expected 1 package, got %d packages", len(packages))
 	}
-	if err := Generate(&st, packages); err != nil {
+	if err := Generate(&st, packages, &Config{Debug: true}); err != nil {
 		t.Fatalf("irgen: %v", err)
 	}
 
@@ -131,6 +952,8 @@ func TestIrgen(t *testing.T) {
 	}
 }
 
+func op(op bytecode.Op) byte { return byte(op) }
+
 var branchArgRE = regexp.MustCompile(`@(\d+)`)
 
 func sprintMethod(st *vmdat.State, m *ir.Method) string {
@@ -153,19 +976,16 @@ func sprintMethod(st *vmdat.State, m *ir.Method) string {
 		}
 		if inst.Flags.IsJumpTarget() && i != 0 {
 			fmt.Fprintf(&buf, "%s:\n", index2label[i])
-			fmt.Fprintf(&buf, "  b%d %s\n", blockIndex, irfmt.Sprint(st, inst))
-		} else {
-			line := fmt.Sprintf("  b%d %s\n", blockIndex, irfmt.Sprint(st, inst))
-			m := branchArgRE.FindStringSubmatch(line)
-			if m != nil {
-				index, err := strconv.Atoi(m[1])
-				if err != nil {
-					panic(err)
-				}
-				line = strings.Replace(line, m[0], index2label[index], 1)
-			}
-			buf.WriteString(line)
 		}
+		line := fmt.Sprintf("  b%d %s\n", blockIndex, irfmt.Sprint(st, inst))
+		line = branchArgRE.ReplaceAllStringFunc(line, func(arg string) string {
+			index, err := strconv.Atoi(arg[len("@"):])
+			if err != nil {
+				panic(err)
+			}
+			return index2label[index]
+		})
+		buf.WriteString(line)
 	}
 
 	return buf.String()
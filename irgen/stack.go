@@ -26,8 +26,14 @@ func (st *operandStack) nextTmp() int64 {
 	return v
 }
 
+// push adds a constant or a local variable to the stack.
+// Use pushTmp for the tmp values.
 func (st *operandStack) push(kind valueKind, v int64) {
-	st.values = append(st.values, stackValue{kind: kind, value: v})
+	st.values = append(st.values, stackValue{kind: kind, value: v, typ: kind.valueType()})
+}
+
+func (st *operandStack) pushTmp(typ valueType, tmp int64) {
+	st.values = append(st.values, stackValue{kind: valueTmp, value: tmp, typ: typ})
 }
 
 // top returns last pushed stack value.
@@ -38,13 +44,23 @@ func (st *operandStack) top() stackValue {
 // drop removes n top values from a stack.
 func (st *operandStack) drop(n int) {
 	for i := 0; i < n; i++ {
-		v := st.get(i)
-		if v.kind == valueTmp {
+		v := st.top()
+		st.values = st.values[:len(st.values)-1]
+		if v.kind == valueTmp && !st.usesTmp(v.value) {
 			st.freelist = append(st.freelist, v.value)
 		}
 	}
+}
 
-	st.values = st.values[:len(st.values)-n]
+// usesTmp reports whether tmp is referenced by any of the stack values.
+// A single tmp can be referenced several times after the dup-like instructions.
+func (st *operandStack) usesTmp(tmp int64) bool {
+	for _, v := range st.values {
+		if v.kind == valueTmp && v.value == tmp {
+			return true
+		}
+	}
+	return false
 }
 
 // get returns n-th stack value.
@@ -53,9 +69,42 @@ func (st *operandStack) get(n int) stackValue {
 	return st.values[len(st.values)-n-1]
 }
 
+// dup inserts the copies of n top values beneath the depth values below them.
+// dup(1, 0) implements the dup instruction.
+func (st *operandStack) dup(n, depth int) {
+	top := len(st.values) - n
+	pos := top - depth
+	copies := make([]stackValue, n)
+	copy(copies, st.values[top:])
+	st.values = append(st.values, copies...)
+	copy(st.values[pos+n:], st.values[pos:top+n])
+	copy(st.values[pos:], copies)
+}
+
+// countValues returns the number of values that occupy
+// the given number of JVM stack slots, starting from get(from).
+//
+// Category 2 values (longs and doubles) take 2 slots,
+// all other values take 1 slot.
+func (st *operandStack) countValues(from, slots int) int {
+	n := 0
+	for slots > 0 {
+		slots -= st.get(from + n).typ.slots()
+		n++
+	}
+	return n
+}
+
+// swap exchanges two top stack values.
+func (st *operandStack) swap() {
+	n := len(st.values)
+	st.values[n-1], st.values[n-2] = st.values[n-2], st.values[n-1]
+}
+
 type stackValue struct {
 	kind  valueKind
 	value int64
+	typ   valueType
 }
 
 type valueKind int
@@ -72,7 +121,49 @@ const (
 	valueLongLocal
 	valueFloatLocal
 	valueDoubleLocal
+	valueRefLocal
 
 	valueTmp
 	valueFlags
 )
+
+func (kind valueKind) isLocal() bool {
+	return kind >= valueIntLocal && kind <= valueRefLocal
+}
+
+func (kind valueKind) valueType() valueType {
+	switch kind {
+	case valueIntConst, valueIntLocal:
+		return typeInt
+	case valueLongConst, valueLongLocal:
+		return typeLong
+	case valueFloatConst, valueFloatLocal:
+		return typeFloat
+	case valueDoubleConst, valueDoubleLocal:
+		return typeDouble
+	case valueRefLocal:
+		return typeRef
+	default:
+		return typeInvalid
+	}
+}
+
+// valueType is a JVM computational type of the stack value.
+type valueType int
+
+const (
+	typeInvalid valueType = iota
+	typeInt
+	typeLong
+	typeFloat
+	typeDouble
+	typeRef
+)
+
+// slots returns the number of JVM stack slots occupied by the value type.
+func (typ valueType) slots() int {
+	if typ == typeLong || typ == typeDouble {
+		return 2
+	}
+	return 1
+}
@@ -13,13 +13,40 @@ func isJump(inst ir.Inst) bool {
 	switch inst.Kind {
 	case ir.InstJump, ir.InstJumpEqual, ir.InstJumpNotEqual, ir.InstJumpGtEq, ir.InstJumpGt, ir.InstJumpLt, ir.InstJumpLtEq:
 		return true
+	case ir.InstSwitch:
+		return true
 	default:
 		return false
 	}
 }
 
 func isUnconditionalBranch(op bytecode.Op) bool {
-	return op == bytecode.Goto
+	return op == bytecode.Goto || op == bytecode.Gotow
+}
+
+// isBranch reports whether op transfers control to its branch target.
+func isBranch(op bytecode.Op) bool {
+	switch {
+	case op >= bytecode.Ifeq && op <= bytecode.Ifacmpne:
+		return true
+	case op == bytecode.Ifnull || op == bytecode.Ifnonnull:
+		return true
+	default:
+		return isUnconditionalBranch(op)
+	}
+}
+
+func isSwitch(op bytecode.Op) bool {
+	return op == bytecode.Tableswitch || op == bytecode.Lookupswitch
+}
+
+func isReturn(op bytecode.Op) bool {
+	return (op >= bytecode.Ireturn && op <= bytecode.Return) || op == bytecode.Athrow
+}
+
+// isBlockEnd reports whether op is the last instruction of its basic block.
+func isBlockEnd(op bytecode.Op) bool {
+	return isBranch(op) || isSwitch(op) || isReturn(op)
 }
 
 func argsCount(d string) int {
@@ -38,6 +65,103 @@ func splitName(full string) (name, pkg string) {
 	return full[delim+1:], full[:delim]
 }
 
+// methodType returns the type of the value returned by the method
+// with descriptor d. Void methods return typeInvalid.
+func methodType(d string) valueType {
+	return descriptorValueType(jclass.MethodDescriptor(d).ReturnType())
+}
+
+func descriptorValueType(typ jclass.DescriptorType) valueType {
+	if typ.Dims != 0 {
+		return typeRef
+	}
+	switch typ.Kind {
+	case 'V':
+		return typeInvalid
+	case 'J':
+		return typeLong
+	case 'F':
+		return typeFloat
+	case 'D':
+		return typeDouble
+	case 'L':
+		return typeRef
+	default:
+		return typeInt
+	}
+}
+
+// frameValueType returns a stack map frame item type.
+func frameValueType(typ jclass.VerificationType) valueType {
+	switch typ.Tag {
+	case jclass.VerifInteger:
+		return typeInt
+	case jclass.VerifLong:
+		return typeLong
+	case jclass.VerifFloat:
+		return typeFloat
+	case jclass.VerifDouble:
+		return typeDouble
+	case jclass.VerifTop:
+		return typeInvalid
+	default:
+		return typeRef
+	}
+}
+
+// resultType returns the type of the value produced by the inst of the given kind.
+func resultType(kind ir.InstKind) valueType {
+	switch kind {
+	case ir.InstLadd, ir.InstLneg, ir.InstConvI2L:
+		return typeLong
+	case ir.InstFadd:
+		return typeFloat
+	case ir.InstDadd:
+		return typeDouble
+	case ir.InstNewBoolArray, ir.InstNewCharArray, ir.InstNewFloatArray, ir.InstNewDoubleArray,
+		ir.InstNewByteArray, ir.InstNewShortArray, ir.InstNewIntArray, ir.InstNewLongArray:
+		return typeRef
+	default:
+		return typeInt
+	}
+}
+
+// irType maps the stack value type to the IR value type.
+func irType(typ valueType) ir.Type {
+	switch typ {
+	case typeInt:
+		return ir.TypeInt
+	case typeLong:
+		return ir.TypeLong
+	case typeFloat:
+		return ir.TypeFloat
+	case typeDouble:
+		return ir.TypeDouble
+	case typeRef:
+		return ir.TypeRef
+	default:
+		return ir.TypeVoid
+	}
+}
+
+// sameReg reports whether a and b refer to the same register,
+// regardless of the value types they hold.
+func sameReg(a, b ir.Arg) bool {
+	return a.Kind == b.Kind && a.Value == b.Value
+}
+
+// moveKind returns an instruction kind that copies the values of type typ.
+func moveKind(typ valueType) ir.InstKind {
+	switch typ {
+	case typeLong, typeDouble:
+		return ir.InstLload
+	case typeRef:
+		return ir.InstAload
+	default:
+		return ir.InstIload
+	}
+}
+
 func findFrame(offset int, frames []jclass.StackMapFrame) *jclass.StackMapFrame {
 	for i, frame := range frames {
 		if int(frame.Offset) == offset {
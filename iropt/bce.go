@@ -0,0 +1,246 @@
+package iropt
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// indexRange is a fact about the index register that holds
+// inside the blocks dominated by the dom block.
+//
+// The index is known to be non-negative and less than
+// the array length (if array is set) or the limit (if it's not -1).
+type indexRange struct {
+	index int64
+	dom   *block
+	array ir.Arg
+	limit int64
+}
+
+// eliminateBoundsChecks marks the array accesses which index
+// is proven to be within the array bounds, see ir.InstFlags.IsInBounds.
+//
+// Constant indexes are checked against the arrays of known size.
+// Loop induction variables are checked against the loop condition:
+//
+//	for (int i = 0; i < a.length; i++) { a[i] }
+//	for (int i = a.length-1; i >= 0; i--) { a[i] }
+//
+// Only the variables with step 1 (or -1) are handled,
+// so they can't overflow without failing the loop condition first.
+func eliminateBoundsChecks(m *ir.Method) int {
+	blocks, loops := prepareLoops(m)
+	consts := constMoves(m.Code)
+	defs := make(map[int64]*ir.Inst)
+	for _, b := range blocks {
+		for i := range b.code {
+			if dst := b.code[i].Dst; dst.Kind == ir.ArgReg {
+				defs[dst.Value] = &b.code[i]
+			}
+		}
+	}
+	arrayLen := func(array ir.Arg) (int64, bool) {
+		def := defs[array.Value]
+		if array.Kind != ir.ArgReg || def == nil || def.Kind < ir.InstNewBoolArray || def.Kind > ir.InstNewLongArray {
+			return 0, false
+		}
+		c, ok := constValue(def.Args[1], consts)
+		return c.Value, ok
+	}
+
+	var ranges []indexRange
+	for _, l := range loops {
+		ranges = append(ranges, loopIndexRanges(l, defs, consts)...)
+	}
+
+	inBounds := func(b *block, array, index ir.Arg) bool {
+		if c, ok := constValue(index, consts); ok {
+			n, ok := arrayLen(array)
+			return ok && c.Value >= 0 && c.Value < n
+		}
+		for _, r := range ranges {
+			if r.index != index.Value || !dominates(r.dom, b) {
+				continue
+			}
+			if r.array.Kind != ir.ArgInvalid && sameArg(r.array, array) {
+				return true
+			}
+			if n, ok := arrayLen(array); ok && r.limit >= 0 && r.limit <= n {
+				return true
+			}
+		}
+		return false
+	}
+
+	changes := 0
+	for _, b := range blocks {
+		for i := range b.code {
+			inst := &b.code[i]
+			if inst.Kind != ir.InstIntArrayGet && inst.Kind != ir.InstIntArraySet {
+				continue
+			}
+			if inst.Flags.IsInBounds() {
+				continue
+			}
+			if inBounds(b, inst.Args[0], inst.Args[1]) {
+				inst.Flags.SetInBounds(true)
+				changes++
+			}
+		}
+	}
+
+	if changes != 0 {
+		m.Code = linearize(blocks)
+	}
+	return changes
+}
+
+// loopIndexRanges collects the induction variable ranges
+// implied by the loop header condition.
+func loopIndexRanges(l *loop, defs map[int64]*ir.Inst, consts map[int64]ir.Arg) []indexRange {
+	h := l.header
+	if len(h.succs) != 2 || len(h.code) < 2 || l.latches[0] == h {
+		return nil
+	}
+	jump := h.code[len(h.code)-1]
+	cmp := h.code[len(h.code)-2]
+	if !isCondJump(jump.Kind) || cmp.Kind != ir.InstIcmp {
+		return nil
+	}
+	// body is the in-loop successor of the header.
+	// All body paths go through the header check.
+	body, exit := h.succs[0], h.succs[1]
+	if !l.blocks[body] {
+		body, exit = exit, body
+	}
+	if !l.blocks[body] || l.blocks[exit] || len(body.preds) != 1 {
+		return nil
+	}
+	cond := jump.Kind
+	if jump.Args[0].Value != int64(body.id) {
+		cond = negateCond(cond)
+	}
+
+	var ranges []indexRange
+	for _, iv := range findInductionVars(l, defs) {
+		var bound ir.Arg
+		cond := cond
+		switch {
+		case sameReg(cmp.Args[0], iv.phi.Dst):
+			bound = cmp.Args[1]
+		case sameReg(cmp.Args[1], iv.phi.Dst):
+			bound = cmp.Args[0]
+			cond = swapCond(cond)
+		default:
+			continue
+		}
+
+		r := indexRange{index: iv.phi.Dst.Value, dom: body, limit: -1}
+		switch iv.step {
+		case 1:
+			// i starts from a non-negative value and the body is
+			// executed only for i < n (or i <= n).
+			init, ok := constValue(iv.init, consts)
+			if !ok || init.Value < 0 {
+				continue
+			}
+			n, isConst := constValue(bound, consts)
+			switch {
+			case cond == ir.InstJumpLt && isConst:
+				r.limit = n.Value
+			case cond == ir.InstJumpLtEq && isConst:
+				r.limit = n.Value + 1
+			case cond == ir.InstJumpLt && bound.Kind == ir.ArgReg:
+				def := defs[bound.Value]
+				if def == nil || def.Kind != ir.InstArrayLen {
+					continue
+				}
+				r.array = def.Args[0]
+			default:
+				continue
+			}
+
+		case -1:
+			// i starts below n and the body is
+			// executed only for i >= 0 (or i > -1).
+			n, ok := constValue(bound, consts)
+			if !ok {
+				continue
+			}
+			if !(cond == ir.InstJumpGtEq && n.Value == 0) && !(cond == ir.InstJumpGt && n.Value == -1) {
+				continue
+			}
+			if init, ok := constValue(iv.init, consts); ok {
+				r.limit = init.Value + 1
+				break
+			}
+			array, ok := lastIndexOf(iv.init, defs)
+			if !ok {
+				continue
+			}
+			r.array = array
+
+		default:
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// lastIndexOf reports whether v is computed as a.length-1
+// and returns the array a.
+func lastIndexOf(v ir.Arg, defs map[int64]*ir.Inst) (ir.Arg, bool) {
+	if v.Kind != ir.ArgReg || defs[v.Value] == nil {
+		return ir.Arg{}, false
+	}
+	def := defs[v.Value]
+	delta := def.Args[len(def.Args)-1]
+	switch {
+	case def.Kind == ir.InstIsub && delta.Kind == ir.ArgIntConst && delta.Value == 1:
+	case def.Kind == ir.InstIadd && delta.Kind == ir.ArgIntConst && delta.Value == -1:
+	default:
+		return ir.Arg{}, false
+	}
+	length := defs[def.Args[0].Value]
+	if def.Args[0].Kind != ir.ArgReg || length == nil || length.Kind != ir.InstArrayLen {
+		return ir.Arg{}, false
+	}
+	return length.Args[0], true
+}
+
+// negateCond returns the condition that holds when
+// the kind conditional jump is not taken.
+func negateCond(kind ir.InstKind) ir.InstKind {
+	switch kind {
+	case ir.InstJumpEqual:
+		return ir.InstJumpNotEqual
+	case ir.InstJumpNotEqual:
+		return ir.InstJumpEqual
+	case ir.InstJumpGtEq:
+		return ir.InstJumpLt
+	case ir.InstJumpGt:
+		return ir.InstJumpLtEq
+	case ir.InstJumpLt:
+		return ir.InstJumpGtEq
+	case ir.InstJumpLtEq:
+		return ir.InstJumpGt
+	default:
+		return kind
+	}
+}
+
+// swapCond returns the condition for the swapped comparison operands.
+func swapCond(kind ir.InstKind) ir.InstKind {
+	switch kind {
+	case ir.InstJumpGtEq:
+		return ir.InstJumpLtEq
+	case ir.InstJumpGt:
+		return ir.InstJumpLt
+	case ir.InstJumpLt:
+		return ir.InstJumpGt
+	case ir.InstJumpLtEq:
+		return ir.InstJumpGtEq
+	default:
+		return kind
+	}
+}
@@ -0,0 +1,140 @@
+package iropt
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// foldBranches replaces the conditional jumps and switches
+// with statically known outcome by the unconditional jumps.
+// Blocks that become unreachable are removed.
+func foldBranches(m *ir.Method) int {
+	consts := constMoves(m.Code)
+	blocks := buildBlocks(m.Code)
+
+	changes := 0
+	for _, b := range blocks {
+		n := len(b.code)
+		last := &b.code[n-1]
+		switch {
+		case last.Kind == ir.InstSwitch:
+			key, ok := constValue(last.Args[0], consts)
+			if !ok {
+				continue
+			}
+			target := last.Args[1]
+			for i := 2; i < len(last.Args); i += 2 {
+				if last.Args[i].Value == key.Value {
+					target = last.Args[i+1]
+					break
+				}
+			}
+			*last = ir.Inst{Kind: ir.InstJump, Args: []ir.Arg{target}}
+			changes++
+
+		case isCondJump(last.Kind):
+			if last.Args[0].Value == int64(b.fallsInto.id) {
+				// Both edges lead to the same block.
+				b.code = b.code[:n-1]
+				changes++
+				continue
+			}
+			if n < 2 || b.code[n-2].Dst.Kind != ir.ArgFlags {
+				continue
+			}
+			taken, ok := evalCondition(last.Kind, b.code[n-2], consts)
+			if !ok {
+				continue
+			}
+			if taken {
+				*last = ir.Inst{Kind: ir.InstJump, Args: last.Args[:1]}
+			} else {
+				b.code = b.code[:n-1]
+			}
+			changes++
+		}
+	}
+	if changes == 0 {
+		return 0
+	}
+
+	oldPreds := make(map[*block][]*block, len(blocks))
+	for _, b := range blocks {
+		oldPreds[b] = append([]*block(nil), b.preds...)
+	}
+	linkBlocks(blocks)
+	if postorder := computeDominators(blocks); len(postorder) != len(blocks) {
+		blocks = removeUnreachable(blocks)
+	}
+
+	// Phi args follow the preds order, drop the args
+	// that correspond to the removed edges.
+	for _, b := range blocks {
+		numPhis := b.numPhis()
+		if numPhis == 0 || len(b.preds) == len(oldPreds[b]) {
+			continue
+		}
+		for i := 0; i < numPhis; i++ {
+			phi := &b.code[i]
+			if len(b.preds) == 1 {
+				// The block can be merged with its predecessor,
+				// so the phi is replaced with a plain copy.
+				src := phi.Args[b.preds[0].predIndexIn(oldPreds[b])]
+				*phi = ir.Inst{Kind: moveKind(phi.Dst.Type), Dst: phi.Dst, Args: []ir.Arg{src}}
+				continue
+			}
+			args := make([]ir.Arg, len(b.preds))
+			for j, pred := range b.preds {
+				args[j] = phi.Args[pred.predIndexIn(oldPreds[b])]
+			}
+			phi.Args = args
+		}
+	}
+
+	m.Code = linearize(blocks)
+	return changes
+}
+
+// predIndexIn returns the index of b inside the preds list.
+func (b *block) predIndexIn(preds []*block) int {
+	for i, p := range preds {
+		if p == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// evalCondition reports whether the conditional jump is taken
+// if it can be determined statically.
+// cmp is the instruction that sets the flags for the jump.
+func evalCondition(kind ir.InstKind, cmp ir.Inst, consts map[int64]ir.Arg) (taken, ok bool) {
+	if cmp.Kind != ir.InstIcmp && cmp.Kind != ir.InstLcmp {
+		return false, false
+	}
+	x, ok1 := constValue(cmp.Args[0], consts)
+	y, ok2 := constValue(cmp.Args[1], consts)
+	if !ok1 || !ok2 {
+		return false, false
+	}
+	a, b := x.Value, y.Value
+	if cmp.Kind == ir.InstIcmp {
+		a, b = int64(int32(a)), int64(int32(b))
+	}
+
+	switch kind {
+	case ir.InstJumpEqual:
+		return a == b, true
+	case ir.InstJumpNotEqual:
+		return a != b, true
+	case ir.InstJumpGtEq:
+		return a >= b, true
+	case ir.InstJumpGt:
+		return a > b, true
+	case ir.InstJumpLt:
+		return a < b, true
+	case ir.InstJumpLtEq:
+		return a <= b, true
+	default:
+		return false, false
+	}
+}
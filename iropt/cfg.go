@@ -0,0 +1,209 @@
+package iropt
+
+import (
+	"sort"
+
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// block is a basic block of the method IR.
+//
+// While the method is split into blocks, branch arguments
+// hold the target block ids instead of the instruction indexes.
+type block struct {
+	id   int
+	code []ir.Inst
+
+	// preds are sorted by id, which is also the order
+	// of the phi arguments.
+	preds []*block
+	succs []*block
+
+	// fallsInto is a successor that follows this block
+	// without an explicit jump, if any.
+	fallsInto *block
+
+	// Dominator tree info, see computeDominators.
+	idom     *block
+	children []*block
+	frontier []*block
+	rpo      int
+}
+
+// buildBlocks splits the method code into the basic blocks.
+// Block ids follow the code layout order.
+func buildBlocks(code []ir.Inst) []*block {
+	isLeader := make([]bool, len(code))
+	isLeader[0] = true
+	for i, inst := range code {
+		if isBranch(inst.Kind) || isRet(inst.Kind) {
+			if i+1 < len(code) {
+				isLeader[i+1] = true
+			}
+		}
+		for _, arg := range inst.Args {
+			if arg.Kind == ir.ArgBranch {
+				isLeader[arg.Value] = true
+			}
+		}
+	}
+
+	var blocks []*block
+	inst2block := make([]int, len(code))
+	for i := range code {
+		if isLeader[i] {
+			blocks = append(blocks, &block{id: len(blocks)})
+		}
+		b := blocks[len(blocks)-1]
+		inst2block[i] = b.id
+		inst := code[i]
+		inst.Args = append([]ir.Arg(nil), inst.Args...)
+		b.code = append(b.code, inst)
+	}
+	for _, b := range blocks {
+		for i := range b.code {
+			for j, arg := range b.code[i].Args {
+				if arg.Kind == ir.ArgBranch {
+					b.code[i].Args[j].Value = int64(inst2block[arg.Value])
+				}
+			}
+		}
+	}
+
+	linkBlocks(blocks)
+	return blocks
+}
+
+// linkBlocks computes the predecessors and successors of every block.
+func linkBlocks(blocks []*block) {
+	for _, b := range blocks {
+		b.preds = b.preds[:0]
+		b.succs = b.succs[:0]
+		b.fallsInto = nil
+	}
+	for i, b := range blocks {
+		last := b.code[len(b.code)-1]
+		for _, arg := range last.Args {
+			if arg.Kind == ir.ArgBranch {
+				addEdge(b, blocks[arg.Value])
+			}
+		}
+		if !isRet(last.Kind) && last.Kind != ir.InstJump && last.Kind != ir.InstSwitch && i+1 < len(blocks) {
+			b.fallsInto = blocks[i+1]
+			addEdge(b, b.fallsInto)
+		}
+	}
+	for _, b := range blocks {
+		sort.Slice(b.preds, func(i, j int) bool {
+			return b.preds[i].id < b.preds[j].id
+		})
+	}
+}
+
+func addEdge(from, to *block) {
+	for _, succ := range from.succs {
+		if succ == to {
+			return
+		}
+	}
+	from.succs = append(from.succs, to)
+	to.preds = append(to.preds, from)
+}
+
+// predIndex returns the index of pred inside the b predecessors list.
+func (b *block) predIndex(pred *block) int {
+	for i, p := range b.preds {
+		if p == pred {
+			return i
+		}
+	}
+	return -1
+}
+
+// linearize concatenates the blocks code and resolves the branch targets.
+// Block leaders and jump targets flags are updated as well.
+//
+// Blocks that are only entered by falling through from
+// the previous block are not marked as leaders: such blocks
+// are merged with their predecessor by the next buildBlocks.
+func linearize(blocks []*block) []ir.Inst {
+	block2inst := make([]int64, len(blocks))
+	n := 0
+	for _, b := range blocks {
+		block2inst[b.id] = int64(n)
+		n += len(b.code)
+	}
+
+	code := make([]ir.Inst, 0, n)
+	for _, b := range blocks {
+		for _, inst := range b.code {
+			inst.Flags.SetBlockLead(false)
+			inst.Flags.SetJumpTarget(false)
+			for j, arg := range inst.Args {
+				if arg.Kind == ir.ArgBranch {
+					inst.Args[j].Value = block2inst[arg.Value]
+				}
+			}
+			code = append(code, inst)
+		}
+	}
+
+	code[0].Flags.SetJumpTarget(true)
+	for _, inst := range code {
+		for _, arg := range inst.Args {
+			if arg.Kind == ir.ArgBranch {
+				code[arg.Value].Flags.SetJumpTarget(true)
+			}
+		}
+	}
+	for i, inst := range code {
+		if i == 0 || inst.Flags.IsJumpTarget() || isBranch(code[i-1].Kind) || isRet(code[i-1].Kind) {
+			code[i].Flags.SetBlockLead(true)
+		}
+	}
+	return code
+}
+
+// removeInsts deletes the instructions marked as dead from the block.
+// A block that becomes empty is replaced with a jump to the block
+// it used to fall into, so the control flow edges are preserved.
+func (b *block) removeInsts(dead []bool) {
+	code := b.code[:0]
+	for i, inst := range b.code {
+		if !dead[i] {
+			code = append(code, inst)
+		}
+	}
+	b.code = code
+	if len(b.code) == 0 {
+		b.code = append(b.code, newJump(b.fallsInto))
+	}
+}
+
+// numPhis returns the number of phi instructions at the block start.
+func (b *block) numPhis() int {
+	n := 0
+	for n < len(b.code) && b.code[n].Kind == ir.InstPhi {
+		n++
+	}
+	return n
+}
+
+func newJump(target *block) ir.Inst {
+	return ir.Inst{
+		Kind: ir.InstJump,
+		Args: []ir.Arg{{Kind: ir.ArgBranch, Value: int64(target.id)}},
+	}
+}
+
+func isBranch(kind ir.InstKind) bool {
+	return kind >= ir.InstJump && kind <= ir.InstSwitch
+}
+
+func isRet(kind ir.InstKind) bool {
+	return kind >= ir.InstRet && kind <= ir.InstAret
+}
+
+func isCondJump(kind ir.InstKind) bool {
+	return kind >= ir.InstJumpEqual && kind <= ir.InstJumpLtEq
+}
@@ -0,0 +1,291 @@
+package iropt
+
+import (
+	"sort"
+
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// coalescePhis assigns the same register to the phi instruction
+// and its args, unless their live ranges overlap.
+// Phi copies between the coalesced registers become no-ops
+// and are not emitted by FromSSA.
+//
+// The code is not in the strict SSA form after that,
+// but it's still suitable for the FromSSA lowering.
+func coalescePhis(m *ir.Method) {
+	related := make(map[int64]bool)
+	for _, inst := range m.Code {
+		if inst.Kind != ir.InstPhi {
+			continue
+		}
+		related[inst.Dst.Value] = true
+		for _, arg := range inst.Args {
+			if arg.Kind == ir.ArgReg {
+				related[arg.Value] = true
+			}
+		}
+	}
+	if len(related) == 0 {
+		return
+	}
+
+	blocks := buildBlocks(m.Code)
+	interfere := computeInterference(blocks, int64(m.Out.FrameSlots), related)
+
+	// Every web is a set of registers that will share a register.
+	// A web is identified by its smallest register number, so
+	// the method params keep their numbers.
+	webOf := make(map[int64]int64, len(related))
+	members := make(map[int64][]int64, len(related))
+	for reg := range related {
+		webOf[reg] = reg
+		members[reg] = []int64{reg}
+	}
+	websInterfere := func(w1, w2 int64) bool {
+		for _, x := range members[w1] {
+			for _, y := range members[w2] {
+				if interfere[regPair{x, y}] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, inst := range m.Code {
+		if inst.Kind != ir.InstPhi {
+			continue
+		}
+		for _, arg := range inst.Args {
+			if arg.Kind != ir.ArgReg {
+				continue
+			}
+			w1, w2 := webOf[inst.Dst.Value], webOf[arg.Value]
+			if w1 == w2 || websInterfere(w1, w2) {
+				continue
+			}
+			if w2 < w1 {
+				w1, w2 = w2, w1
+			}
+			for _, reg := range members[w2] {
+				webOf[reg] = w1
+			}
+			members[w1] = append(members[w1], members[w2]...)
+			delete(members, w2)
+		}
+	}
+
+	for i := range m.Code {
+		inst := &m.Code[i]
+		if inst.Dst.Kind == ir.ArgReg {
+			if w, ok := webOf[inst.Dst.Value]; ok {
+				inst.Dst.Value = w
+			}
+		}
+		for j, arg := range inst.Args {
+			if arg.Kind != ir.ArgReg {
+				continue
+			}
+			if w, ok := webOf[arg.Value]; ok {
+				inst.Args[j].Value = w
+			}
+		}
+	}
+}
+
+type regPair struct {
+	x, y int64
+}
+
+// computeInterference finds the pairs of registers from the related
+// set that are live at the same time. Both (x, y) and (y, x) are recorded.
+//
+// Two SSA values interfere if one of them is live at the
+// definition of another. Phi instructions define their values
+// at the block start, their args are used at the predecessors end.
+func computeInterference(blocks []*block, nregs int64, related map[int64]bool) map[regPair]bool {
+	relatedList := make([]int64, 0, len(related))
+	for reg := range related {
+		relatedList = append(relatedList, reg)
+	}
+	sort.Slice(relatedList, func(i, j int) bool {
+		return relatedList[i] < relatedList[j]
+	})
+
+	interfere := make(map[regPair]bool)
+	live := make([]bool, nregs)
+	addDef := func(def int64) {
+		if !related[def] {
+			return
+		}
+		for _, reg := range relatedList {
+			if reg != def && live[reg] {
+				interfere[regPair{def, reg}] = true
+				interfere[regPair{reg, def}] = true
+			}
+		}
+	}
+
+	liveOut := computeLiveOutSSA(blocks, nregs)
+	for _, b := range blocks {
+		copy(live, liveOut[b.id])
+		numPhis := b.numPhis()
+		for i := len(b.code) - 1; i >= numPhis; i-- {
+			inst := b.code[i]
+			if inst.Dst.Kind == ir.ArgReg {
+				addDef(inst.Dst.Value)
+				live[inst.Dst.Value] = false
+			}
+			for _, arg := range inst.Args {
+				if arg.Kind == ir.ArgReg {
+					live[arg.Value] = true
+				}
+			}
+		}
+		for i := 0; i < numPhis; i++ {
+			addDef(b.code[i].Dst.Value)
+		}
+		if b.id == 0 {
+			// Values that are live at the method entry are
+			// defined simultaneously, before the first block.
+			for i := 0; i < numPhis; i++ {
+				live[b.code[i].Dst.Value] = false
+			}
+			for _, reg := range relatedList {
+				if live[reg] {
+					addDef(reg)
+				}
+			}
+		}
+	}
+
+	return interfere
+}
+
+// computeLiveOutSSA returns the registers that are live at every block exit.
+// The result is indexed by the block id and then by the register number.
+//
+// Phi args are treated as the uses at the end of the corresponding
+// predecessor, phi destinations are defined at the phi block start.
+func computeLiveOutSSA(blocks []*block, nregs int64) [][]bool {
+	uses := make([][]bool, len(blocks))
+	defs := make([][]bool, len(blocks))
+	liveIn := make([][]bool, len(blocks))
+	liveOut := make([][]bool, len(blocks))
+	for _, b := range blocks {
+		uses[b.id] = make([]bool, nregs)
+		defs[b.id] = make([]bool, nregs)
+		liveIn[b.id] = make([]bool, nregs)
+		liveOut[b.id] = make([]bool, nregs)
+		for _, inst := range b.code {
+			if inst.Kind != ir.InstPhi {
+				for _, arg := range inst.Args {
+					if arg.Kind == ir.ArgReg && !defs[b.id][arg.Value] {
+						uses[b.id][arg.Value] = true
+					}
+				}
+			}
+			if inst.Dst.Kind == ir.ArgReg {
+				defs[b.id][inst.Dst.Value] = true
+			}
+		}
+		copy(liveIn[b.id], uses[b.id])
+	}
+	for _, b := range blocks {
+		for _, succ := range b.succs {
+			j := succ.predIndex(b)
+			for _, phi := range succ.code[:succ.numPhis()] {
+				if arg := phi.Args[j]; arg.Kind == ir.ArgReg {
+					liveOut[b.id][arg.Value] = true
+				}
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(blocks) - 1; i >= 0; i-- {
+			b := blocks[i]
+			out := liveOut[b.id]
+			for _, succ := range b.succs {
+				for reg, live := range liveIn[succ.id] {
+					if live && !out[reg] {
+						out[reg] = true
+						changed = true
+					}
+				}
+			}
+			for reg, live := range out {
+				if live && !defs[b.id][reg] && !liveIn[b.id][reg] {
+					liveIn[b.id][reg] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	return liveOut
+}
+
+// compactRegs renumbers the registers to fill the gaps left by
+// the SSA conversion and the optimizations.
+//
+// Registers below fixed keep their numbers: after the SSA conversion
+// such registers can only be the method params.
+func compactRegs(m *ir.Method, fixed int64) {
+	isFixed := make([]bool, fixed)
+	var regs []int64
+	seen := make(map[int64]bool)
+	visit := func(arg ir.Arg) {
+		if arg.Kind != ir.ArgReg {
+			return
+		}
+		if arg.Value < fixed {
+			isFixed[arg.Value] = true
+		} else if !seen[arg.Value] {
+			seen[arg.Value] = true
+			regs = append(regs, arg.Value)
+		}
+	}
+	for _, inst := range m.Code {
+		visit(inst.Dst)
+		for _, arg := range inst.Args {
+			visit(arg)
+		}
+	}
+	sort.Slice(regs, func(i, j int) bool {
+		return regs[i] < regs[j]
+	})
+
+	frameSlots := int64(0)
+	for reg, ok := range isFixed {
+		if ok {
+			frameSlots = int64(reg) + 1
+		}
+	}
+	mapping := make(map[int64]int64, len(regs))
+	next := int64(0)
+	for _, reg := range regs {
+		for next < fixed && isFixed[next] {
+			next++
+		}
+		mapping[reg] = next
+		next++
+		if next > frameSlots {
+			frameSlots = next
+		}
+	}
+
+	for i := range m.Code {
+		inst := &m.Code[i]
+		if inst.Dst.Kind == ir.ArgReg && inst.Dst.Value >= fixed {
+			inst.Dst.Value = mapping[inst.Dst.Value]
+		}
+		for j, arg := range inst.Args {
+			if arg.Kind == ir.ArgReg && arg.Value >= fixed {
+				inst.Args[j].Value = mapping[arg.Value]
+			}
+		}
+	}
+	m.Out.FrameSlots = int(frameSlots)
+}
@@ -0,0 +1,133 @@
+package iropt
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// foldConstants evaluates the instructions with constant operands
+// and propagates the constants into their uses.
+//
+// Only int and long values are folded. Constants are propagated only
+// into the operands that can encode them (see constOperand),
+// other uses keep reading the register.
+func foldConstants(m *ir.Method) int {
+	consts := make(map[int64]ir.Arg)
+	for changed := true; changed; {
+		changed = false
+		for _, inst := range m.Code {
+			if inst.Dst.Kind != ir.ArgReg {
+				continue
+			}
+			if _, ok := consts[inst.Dst.Value]; ok {
+				continue
+			}
+			if c, ok := evalConst(inst, consts); ok {
+				consts[inst.Dst.Value] = c
+				changed = true
+			}
+		}
+	}
+	if len(consts) == 0 {
+		return 0
+	}
+
+	changes := 0
+	for i := range m.Code {
+		inst := &m.Code[i]
+		if inst.Dst.Kind == ir.ArgReg && inst.Kind != ir.InstPhi {
+			c, ok := consts[inst.Dst.Value]
+			if ok && !isConstMove(*inst) && canMoveConst(c) {
+				*inst = ir.Inst{
+					Kind:  moveKind(c.Type),
+					Dst:   inst.Dst,
+					Args:  []ir.Arg{c},
+					Flags: inst.Flags,
+				}
+				changes++
+			}
+		}
+		if inst.Kind == ir.InstIadd && isConstArg(inst.Args[0], consts) && !isConstArg(inst.Args[1], consts) {
+			// Only the second operand can be a constant.
+			inst.Args[0], inst.Args[1] = inst.Args[1], inst.Args[0]
+		}
+		for j, arg := range inst.Args {
+			if arg.Kind != ir.ArgReg {
+				continue
+			}
+			c, ok := consts[arg.Value]
+			if ok && constOperand(*inst, j, c) {
+				inst.Args[j] = c
+				changes++
+			}
+		}
+	}
+	return changes
+}
+
+// evalConst computes the inst result if all its operands are constant.
+func evalConst(inst ir.Inst, consts map[int64]ir.Arg) (ir.Arg, bool) {
+	var args [2]int64
+	for i, arg := range inst.Args {
+		c, ok := constValue(arg, consts)
+		if !ok {
+			return ir.Arg{}, false
+		}
+		if i < len(args) {
+			args[i] = c.Value
+		} else if c.Value != args[0] {
+			// Only phi can have more than 2 args.
+			return ir.Arg{}, false
+		}
+	}
+	x, y := args[0], args[1]
+
+	var v int64
+	switch inst.Kind {
+	case ir.InstIload, ir.InstLload:
+		v = x
+	case ir.InstPhi:
+		if len(inst.Args) > 1 && x != y {
+			return ir.Arg{}, false
+		}
+		v = x
+	case ir.InstIadd:
+		v = int64(int32(x) + int32(y))
+	case ir.InstIsub:
+		v = int64(int32(x) - int32(y))
+	case ir.InstImul:
+		v = int64(int32(x) * int32(y))
+	case ir.InstIdiv:
+		if y == 0 {
+			return ir.Arg{}, false // Should throw at run time
+		}
+		v = int64(int32(x) / int32(y))
+	case ir.InstIneg:
+		v = int64(-int32(x))
+	case ir.InstLadd:
+		v = x + y
+	case ir.InstLneg:
+		v = -x
+	case ir.InstConvL2I, ir.InstConvI2L:
+		v = int64(int32(x))
+	case ir.InstConvI2B:
+		v = int64(int8(x))
+	default:
+		return ir.Arg{}, false
+	}
+	return ir.Arg{Kind: ir.ArgIntConst, Type: inst.Dst.Type, Value: v}, true
+}
+
+func isConstArg(arg ir.Arg, consts map[int64]ir.Arg) bool {
+	_, ok := constValue(arg, consts)
+	return ok
+}
+
+// isConstMove reports whether inst assigns a constant to a register.
+func isConstMove(inst ir.Inst) bool {
+	switch inst.Kind {
+	case ir.InstIload, ir.InstLload:
+		return inst.Args[0].Kind == ir.ArgIntConst
+	default:
+		return false
+	}
+}
@@ -0,0 +1,138 @@
+package iropt
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// propagateCopies replaces the uses of the register copies
+// with the original values and removes the copies.
+//
+// Phi instructions that merge a single value are treated as copies.
+// If that value is a constant, the phi is turned into a move.
+func propagateCopies(m *ir.Method) int {
+	copies := make(map[int64]ir.Arg)
+	constPhis := make(map[int64]ir.Arg)
+	resolve := func(arg ir.Arg) ir.Arg {
+		// In the SSA form copy chains can't form a cycle,
+		// but an extra step limit is cheap enough.
+		for steps := 0; arg.Kind == ir.ArgReg && steps <= len(copies); steps++ {
+			src, ok := copies[arg.Value]
+			if !ok {
+				break
+			}
+			arg = src
+		}
+		return arg
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, inst := range m.Code {
+			if inst.Dst.Kind != ir.ArgReg {
+				continue
+			}
+			if _, ok := copies[inst.Dst.Value]; ok {
+				continue
+			}
+			if _, ok := constPhis[inst.Dst.Value]; ok {
+				continue
+			}
+			var src ir.Arg
+			switch inst.Kind {
+			case ir.InstIload, ir.InstLload, ir.InstAload:
+				if inst.Args[0].Kind != ir.ArgReg {
+					continue
+				}
+				src = inst.Args[0]
+			case ir.InstPhi:
+				v, ok := phiValue(inst, resolve)
+				if !ok {
+					continue
+				}
+				if v.Kind != ir.ArgReg {
+					constPhis[inst.Dst.Value] = v
+					changed = true
+					continue
+				}
+				src = v
+			default:
+				continue
+			}
+			copies[inst.Dst.Value] = src
+			changed = true
+		}
+	}
+	if len(copies) == 0 && len(constPhis) == 0 {
+		return 0
+	}
+
+	blocks := buildBlocks(m.Code)
+	for _, b := range blocks {
+		code := make([]ir.Inst, 0, len(b.code))
+		var moves []ir.Inst
+		for _, inst := range b.code {
+			if inst.Dst.Kind == ir.ArgReg {
+				if _, ok := copies[inst.Dst.Value]; ok {
+					continue
+				}
+				if c, ok := constPhis[inst.Dst.Value]; ok {
+					moves = append(moves, ir.Inst{
+						Kind: moveKind(c.Type),
+						Dst:  inst.Dst,
+						Args: []ir.Arg{c},
+					})
+					continue
+				}
+			}
+			for j, arg := range inst.Args {
+				if arg.Kind == ir.ArgReg {
+					inst.Args[j] = resolve(arg)
+				}
+			}
+			code = append(code, inst)
+		}
+		// Constant moves can't precede the remaining phis.
+		b.code = insertAfterPhis(code, moves)
+		if len(b.code) == 0 {
+			b.code = append(b.code, newJump(b.fallsInto))
+		}
+	}
+
+	m.Code = linearize(blocks)
+	return len(copies) + len(constPhis)
+}
+
+// phiValue returns the single value merged by the phi, if any.
+// Self-references are ignored: a loop phi that only merges
+// its own value with some x is a copy of x.
+func phiValue(phi ir.Inst, resolve func(ir.Arg) ir.Arg) (ir.Arg, bool) {
+	var v ir.Arg
+	for _, arg := range phi.Args {
+		arg = resolve(arg)
+		if sameArg(arg, phi.Dst) {
+			continue
+		}
+		if v.Kind == ir.ArgInvalid {
+			v = arg
+			continue
+		}
+		if !sameArg(v, arg) {
+			return ir.Arg{}, false
+		}
+	}
+	return v, v.Kind != ir.ArgInvalid
+}
+
+func insertAfterPhis(code, insts []ir.Inst) []ir.Inst {
+	if len(insts) == 0 {
+		return code
+	}
+	n := 0
+	for n < len(code) && code[n].Kind == ir.InstPhi {
+		n++
+	}
+	out := make([]ir.Inst, 0, len(code)+len(insts))
+	out = append(out, code[:n]...)
+	out = append(out, insts...)
+	return append(out, code[n:]...)
+}
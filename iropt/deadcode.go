@@ -0,0 +1,106 @@
+package iropt
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// removeDeadCode removes the instructions whose results are never used.
+//
+// Instructions with side effects and the instructions that can
+// throw are always kept, everything else is kept only if
+// it's used by another live instruction.
+func removeDeadCode(m *ir.Method) int {
+	blocks := buildBlocks(m.Code)
+
+	type instRef struct {
+		b *block
+		i int
+	}
+	defs := make(map[int64]instRef)
+	live := make([][]bool, len(blocks))
+	var worklist []instRef
+	mark := func(ref instRef) {
+		if !live[ref.b.id][ref.i] {
+			live[ref.b.id][ref.i] = true
+			worklist = append(worklist, ref)
+		}
+	}
+	for _, b := range blocks {
+		live[b.id] = make([]bool, len(b.code))
+	}
+	for _, b := range blocks {
+		for i, inst := range b.code {
+			if inst.Dst.Kind == ir.ArgReg {
+				defs[inst.Dst.Value] = instRef{b: b, i: i}
+			}
+			if hasSideEffects(inst) {
+				mark(instRef{b: b, i: i})
+			}
+		}
+	}
+
+	for len(worklist) != 0 {
+		ref := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		for _, arg := range ref.b.code[ref.i].Args {
+			switch arg.Kind {
+			case ir.ArgReg:
+				if def, ok := defs[arg.Value]; ok {
+					mark(def)
+				}
+			case ir.ArgFlags:
+				// Flags are set by the closest preceding compare.
+				for i := ref.i - 1; i >= 0; i-- {
+					if ref.b.code[i].Dst.Kind == ir.ArgFlags {
+						mark(instRef{b: ref.b, i: i})
+						break
+					}
+				}
+			}
+		}
+	}
+
+	removed := 0
+	for _, b := range blocks {
+		dead := make([]bool, len(b.code))
+		n := 0
+		for i := range b.code {
+			if !live[b.id][i] {
+				dead[i] = true
+				n++
+			}
+		}
+		if n != 0 {
+			b.removeInsts(dead)
+			removed += n
+		}
+	}
+
+	if removed != 0 {
+		m.Code = linearize(blocks)
+	}
+	return removed
+}
+
+// hasSideEffects reports whether inst can't be removed
+// even if its result is unused.
+func hasSideEffects(inst ir.Inst) bool {
+	switch inst.Kind {
+	case ir.InstIload, ir.InstLload, ir.InstAload, ir.InstPhi:
+		return false
+	case ir.InstIadd, ir.InstIsub, ir.InstImul, ir.InstIneg:
+		return false
+	case ir.InstLadd, ir.InstLneg, ir.InstFadd, ir.InstDadd:
+		return false
+	case ir.InstConvL2I, ir.InstConvF2I, ir.InstConvD2I, ir.InstConvI2L, ir.InstConvI2B:
+		return false
+	case ir.InstIcmp, ir.InstLcmp, ir.InstAcmp:
+		return false
+	case ir.InstIdiv:
+		// Division by zero throws.
+		divisor := inst.Args[1]
+		return divisor.Kind != ir.ArgIntConst || divisor.Value == 0
+	default:
+		return true
+	}
+}
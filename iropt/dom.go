@@ -0,0 +1,100 @@
+package iropt
+
+// computeDominators builds the dominator tree and the dominance frontiers.
+// The first block is the entry block.
+// Unreachable blocks are not included in the returned postorder.
+//
+// Uses the "A Simple, Fast Dominance Algorithm" by Cooper, Harvey and Kennedy.
+func computeDominators(blocks []*block) (postorder []*block) {
+	for _, b := range blocks {
+		b.idom = nil
+		b.children = b.children[:0]
+		b.frontier = b.frontier[:0]
+		b.rpo = -1
+	}
+
+	visited := make([]bool, len(blocks))
+	var walk func(b *block)
+	walk = func(b *block) {
+		visited[b.id] = true
+		for _, succ := range b.succs {
+			if !visited[succ.id] {
+				walk(succ)
+			}
+		}
+		postorder = append(postorder, b)
+	}
+	entry := blocks[0]
+	walk(entry)
+	for i, b := range postorder {
+		b.rpo = len(postorder) - i - 1
+	}
+
+	intersect := func(b1, b2 *block) *block {
+		for b1 != b2 {
+			for b1.rpo > b2.rpo {
+				b1 = b1.idom
+			}
+			for b2.rpo > b1.rpo {
+				b2 = b2.idom
+			}
+		}
+		return b1
+	}
+
+	entry.idom = entry
+	for changed := true; changed; {
+		changed = false
+		for i := len(postorder) - 2; i >= 0; i-- {
+			b := postorder[i]
+			var idom *block
+			for _, pred := range b.preds {
+				if pred.idom == nil {
+					continue // Not processed yet or unreachable
+				}
+				if idom == nil {
+					idom = pred
+				} else {
+					idom = intersect(pred, idom)
+				}
+			}
+			if b.idom != idom {
+				b.idom = idom
+				changed = true
+			}
+		}
+	}
+
+	for i := len(postorder) - 2; i >= 0; i-- {
+		b := postorder[i]
+		b.idom.children = append(b.idom.children, b)
+	}
+
+	for _, b := range postorder {
+		if len(b.preds) < 2 {
+			continue
+		}
+		for _, pred := range b.preds {
+			if pred.rpo == -1 {
+				continue
+			}
+			for runner := pred; runner != b.idom; runner = runner.idom {
+				if !containsBlock(runner.frontier, b) {
+					runner.frontier = append(runner.frontier, b)
+				}
+			}
+		}
+	}
+
+	entry.idom = nil
+	return postorder
+}
+
+func containsBlock(list []*block, b *block) bool {
+	for _, x := range list {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package iropt
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/jclass"
+	"github.com/quasilyte/go-jdk/symbol"
+)
+
+const (
+	defaultInlineMaxSize  = 16
+	defaultInlineMaxDepth = 2
+)
+
+// inliner replaces the static calls with the callee bodies.
+//
+// Inlining is performed before the SSA conversion.
+// Every inlined call gets its own set of registers that
+// are allocated after the caller frame slots.
+type inliner struct {
+	maxSize  int
+	maxDepth int
+
+	// callees map the method symbols to their original code.
+	// Code is copied before any method is modified, so the inlined
+	// bodies don't depend on the order the methods are processed.
+	callees map[symbol.ID]*inlineCallee
+
+	// frameSlots is the current caller frame size.
+	frameSlots int64
+}
+
+type inlineCallee struct {
+	code       []ir.Inst
+	frameSlots int64
+	descriptor jclass.MethodDescriptor
+}
+
+func newInliner(packages []*ir.Package, cfg *Config) *inliner {
+	in := &inliner{
+		maxSize:  cfg.InlineMaxSize,
+		maxDepth: cfg.InlineMaxDepth,
+		callees:  make(map[symbol.ID]*inlineCallee),
+	}
+	if in.maxSize == 0 {
+		in.maxSize = defaultInlineMaxSize
+	}
+	if in.maxDepth == 0 {
+		in.maxDepth = defaultInlineMaxDepth
+	}
+	for _, pkg := range packages {
+		for i := range pkg.Classes {
+			for j := range pkg.Classes[i].Methods {
+				m := &pkg.Classes[i].Methods[j]
+				if len(m.Code) == 0 || len(m.Code) > in.maxSize {
+					continue
+				}
+				in.callees[m.Out.ID] = &inlineCallee{
+					code:       copyCode(m.Code),
+					frameSlots: int64(m.Out.FrameSlots),
+					descriptor: jclass.MethodDescriptor(m.Out.Descriptor),
+				}
+			}
+		}
+	}
+	return in
+}
+
+// inlineCalls inlines the suitable static calls inside m.
+// It returns the number of inlined calls.
+func (in *inliner) inlineCalls(m *ir.Method) int {
+	in.frameSlots = int64(m.Out.FrameSlots)
+	changes := 0
+	code := in.expandCalls(m.Code, []symbol.ID{m.Out.ID}, &changes)
+	if changes == 0 {
+		return 0
+	}
+	m.Code = linearize(buildBlocks(code))
+	m.Out.FrameSlots = int(in.frameSlots)
+	return changes
+}
+
+// expandCalls returns the code with the static calls replaced
+// by the callee bodies. stack holds the methods that are
+// being inlined, it's used to limit the depth and prevent
+// the recursive methods expansion.
+func (in *inliner) expandCalls(code []ir.Inst, stack []symbol.ID, changes *int) []ir.Inst {
+	return spliceCode(code, func(inst ir.Inst) ([]ir.Inst, bool) {
+		if inst.Kind != ir.InstCallStatic {
+			return nil, false
+		}
+		sym := inst.Args[0].SymbolID()
+		callee := in.callees[sym]
+		if callee == nil || !in.canInline(inst, sym, stack) {
+			return nil, false
+		}
+		*changes++
+
+		base := in.frameSlots
+		in.frameSlots += callee.frameSlots
+		body := in.bindParams(inst, callee, base)
+		offset := int64(len(body))
+		calleeCode := in.expandCalls(in.calleeBody(inst, callee, base), append(stack, sym), changes)
+		for _, inst := range calleeCode {
+			for i, arg := range inst.Args {
+				if arg.Kind == ir.ArgBranch {
+					inst.Args[i].Value += offset
+				}
+			}
+			body = append(body, inst)
+		}
+		return body, true
+	})
+}
+
+func (in *inliner) canInline(call ir.Inst, sym symbol.ID, stack []symbol.ID) bool {
+	if len(stack) > in.maxDepth {
+		return false
+	}
+	for _, id := range stack {
+		if id == sym {
+			return false // Recursive call
+		}
+	}
+	for _, arg := range call.Args[1:] {
+		// Params are assigned with a move, only some of the
+		// constant arguments can be used as its operand.
+		if arg.Kind != ir.ArgReg && !(arg.Kind == ir.ArgIntConst && canMoveConst(arg)) {
+			return false
+		}
+	}
+	return true
+}
+
+// bindParams assigns the call arguments to the callee param registers.
+func (in *inliner) bindParams(call ir.Inst, callee *inlineCallee, base int64) []ir.Inst {
+	var code []ir.Inst
+	args := call.Args[1:]
+	slot := base
+	callee.descriptor.WalkParams(func(typ jclass.DescriptorType) {
+		arg := args[len(code)]
+		code = append(code, ir.Inst{
+			Kind: moveKind(arg.Type),
+			Dst:  ir.Arg{Kind: ir.ArgReg, Type: arg.Type, Value: slot},
+			Args: []ir.Arg{arg},
+		})
+		slot++
+		if typ.Dims == 0 && (typ.Kind == 'J' || typ.Kind == 'D') {
+			slot++ // Long and double params occupy 2 locals
+		}
+	})
+	return code
+}
+
+// calleeBody returns the callee code adapted for the call site.
+//
+// Callee registers are moved to the [base, base+frameSlots) range.
+// Returns become the call result assignments followed by
+// a jump to the instruction that follows the call.
+func (in *inliner) calleeBody(call ir.Inst, callee *inlineCallee, base int64) []ir.Inst {
+	code := copyCode(callee.code)
+	for i := range code {
+		inst := &code[i]
+		if inst.Dst.Kind == ir.ArgReg {
+			inst.Dst.Value += base
+		}
+		for j, arg := range inst.Args {
+			if arg.Kind == ir.ArgReg {
+				inst.Args[j].Value += base
+			}
+		}
+	}
+
+	end := int64(len(code))
+	return spliceCode(code, func(inst ir.Inst) ([]ir.Inst, bool) {
+		if !isRet(inst.Kind) {
+			return nil, false
+		}
+		var out []ir.Inst
+		if call.Dst.Kind == ir.ArgReg && inst.Kind != ir.InstRet {
+			out = append(out, ir.Inst{
+				Kind: moveKind(call.Dst.Type),
+				Dst:  call.Dst,
+				Args: []ir.Arg{inst.Args[0]},
+			})
+		}
+		out = append(out, ir.Inst{
+			Kind: ir.InstJump,
+			Args: []ir.Arg{{Kind: ir.ArgBranch, Value: end}},
+		})
+		return out, false
+	})
+}
+
+// spliceCode replaces the instructions with the sequences returned by
+// the replace callback and fixes the branch targets accordingly.
+//
+// If replace returns nil, the instruction is kept as is.
+// Branch targets inside the returned sequence are either the old
+// code indexes or, if local is true, the indexes relative to the
+// sequence start. Old index len(code) refers to the code end.
+//
+// A jump to the code end that is the last instruction is removed.
+func spliceCode(code []ir.Inst, replace func(inst ir.Inst) (seq []ir.Inst, local bool)) []ir.Inst {
+	var out []ir.Inst
+	var fixups []int
+	newIndex := make([]int64, len(code)+1)
+	for i, inst := range code {
+		newIndex[i] = int64(len(out))
+		seq, local := replace(inst)
+		if seq == nil {
+			seq = []ir.Inst{inst}
+		}
+		start := int64(len(out))
+		for _, inst := range seq {
+			if !hasBranchArgs(inst) {
+				out = append(out, inst)
+				continue
+			}
+			inst.Args = append([]ir.Arg(nil), inst.Args...)
+			if local {
+				for j, arg := range inst.Args {
+					if arg.Kind == ir.ArgBranch {
+						inst.Args[j].Value += start
+					}
+				}
+			} else {
+				fixups = append(fixups, len(out))
+			}
+			out = append(out, inst)
+		}
+	}
+	newIndex[len(code)] = int64(len(out))
+
+	for _, index := range fixups {
+		inst := &out[index]
+		for j, arg := range inst.Args {
+			if arg.Kind == ir.ArgBranch {
+				inst.Args[j].Value = newIndex[arg.Value]
+			}
+		}
+	}
+
+	end := int64(len(out))
+	if end != 0 && out[end-1].Kind == ir.InstJump && out[end-1].Args[0].Value == end {
+		out = out[:end-1]
+		for _, inst := range out {
+			for j, arg := range inst.Args {
+				if arg.Kind == ir.ArgBranch && arg.Value == end {
+					inst.Args[j].Value = end - 1
+				}
+			}
+		}
+	}
+	return out
+}
+
+func hasBranchArgs(inst ir.Inst) bool {
+	for _, arg := range inst.Args {
+		if arg.Kind == ir.ArgBranch {
+			return true
+		}
+	}
+	return false
+}
+
+func copyCode(code []ir.Inst) []ir.Inst {
+	out := make([]ir.Inst, len(code))
+	for i, inst := range code {
+		inst.Args = append([]ir.Arg(nil), inst.Args...)
+		out[i] = inst
+	}
+	return out
+}
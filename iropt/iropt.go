@@ -1,11 +1,192 @@
 package iropt
 
 import (
+	"fmt"
+
 	"github.com/quasilyte/go-jdk/ir"
 	"github.com/quasilyte/go-jdk/vmdat"
 )
 
-func Optimize(st *vmdat.State, packages []*ir.Package) {
-	// Does nothing right now.
-	// Stub for the future.
+type Config struct {
+	// Debug enables the IR verification after every pass.
+	Debug bool
+
+	// Passes is a list of pass names to run, in order.
+	// Nil slice selects the DefaultPasses pipeline.
+	// Empty non-nil slice disables the optimizations.
+	Passes []string
+
+	// InlineMaxSize is the max callee size (in IR instructions)
+	// that can be inlined. Zero value selects the default limit.
+	InlineMaxSize int
+
+	// InlineMaxDepth limits the nested inlining: calls inside the
+	// inlined bodies are inlined only up to this depth.
+	// Zero value selects the default limit.
+	InlineMaxDepth int
+}
+
+// Stats describes the work done by the optimizer.
+type Stats struct {
+	// Passes contain one entry per pipeline pass,
+	// in the order they were executed.
+	Passes []PassStats
+}
+
+type PassStats struct {
+	Name string
+
+	// Changes is a number of IR rewrites made by the pass.
+	Changes int
+
+	// Removed is a number of instructions removed by the pass.
+	Removed int
+}
+
+// pass is a single method-level optimization.
+// Passes operate on the SSA form of the method.
+// They return the number of rewrites they performed.
+//
+// The "inline" pass is special: it needs the whole program
+// and operates on the non-SSA code, so it has no run func
+// and can only be the first pass of the pipeline.
+type pass struct {
+	name string
+	run  func(m *ir.Method) int
+}
+
+// passes is a list of all known optimizations.
+var passes = []pass{
+	{name: "inline"},
+	{name: "constfold", run: foldConstants},
+	{name: "branchfold", run: foldBranches},
+	{name: "loadstore", run: removeRedundantLoadStore},
+	{name: "licm", run: hoistInvariants},
+	{name: "strengthreduce", run: reduceStrength},
+	{name: "copyprop", run: propagateCopies},
+	{name: "bce", run: eliminateBoundsChecks},
+	{name: "deadcode", run: removeDeadCode},
+}
+
+// DefaultPasses is a pipeline that is used when Config.Passes is nil.
+var DefaultPasses = []string{
+	"inline",
+	"constfold",
+	"branchfold",
+	"loadstore",
+	"licm",
+	"strengthreduce",
+	"copyprop",
+	"bce",
+	"deadcode",
+}
+
+// PassNames returns all known pass names.
+func PassNames() []string {
+	names := make([]string, len(passes))
+	for i, p := range passes {
+		names[i] = p.name
+	}
+	return names
+}
+
+func findPass(name string) *pass {
+	for i := range passes {
+		if passes[i].name == name {
+			return &passes[i]
+		}
+	}
+	return nil
+}
+
+// Optimize runs the configured optimization pipeline over every method.
+//
+// Methods are converted into the SSA form before the first pass
+// and are lowered back right after the last one.
+func Optimize(st *vmdat.State, packages []*ir.Package, cfg *Config) (*Stats, error) {
+	names := cfg.Passes
+	if names == nil {
+		names = DefaultPasses
+	}
+	pipeline := make([]*pass, len(names))
+	stats := &Stats{Passes: make([]PassStats, len(names))}
+	for i, name := range names {
+		p := findPass(name)
+		if p == nil {
+			return nil, fmt.Errorf("unknown pass %q", name)
+		}
+		if p.run == nil && i != 0 {
+			return nil, fmt.Errorf("%s pass should go first", name)
+		}
+		pipeline[i] = p
+		stats.Passes[i].Name = name
+	}
+	if len(pipeline) == 0 {
+		return stats, nil
+	}
+
+	var in *inliner
+	if pipeline[0].name == "inline" {
+		in = newInliner(packages, cfg)
+	}
+
+	for _, pkg := range packages {
+		for i := range pkg.Classes {
+			c := &pkg.Classes[i]
+			for j := range c.Methods {
+				m := &c.Methods[j]
+				if err := optimizeMethod(m, in, pipeline, stats, cfg); err != nil {
+					return nil, fmt.Errorf("%s: %s.%s: %v",
+						pkg.Out.Name, c.Name, m.Out.Name, err)
+				}
+			}
+		}
+	}
+	return stats, nil
+}
+
+func optimizeMethod(m *ir.Method, in *inliner, pipeline []*pass, stats *Stats, cfg *Config) error {
+	if len(m.Code) == 0 {
+		return nil
+	}
+
+	verify := func(stage string) error {
+		if !cfg.Debug {
+			return nil
+		}
+		if err := ir.Verify(m); err != nil {
+			return fmt.Errorf("after %s: %v", stage, err)
+		}
+		return nil
+	}
+
+	if in != nil {
+		stats.Passes[0].Changes += in.inlineCalls(m)
+		if err := verify("inline"); err != nil {
+			return err
+		}
+	}
+
+	frameSlots := int64(m.Out.FrameSlots)
+	ToSSA(m)
+	if err := verify("ToSSA"); err != nil {
+		return err
+	}
+	for i, p := range pipeline {
+		if p.run == nil {
+			continue
+		}
+		size := len(m.Code)
+		stats.Passes[i].Changes += p.run(m)
+		if removed := size - len(m.Code); removed > 0 {
+			stats.Passes[i].Removed += removed
+		}
+		if err := verify(p.name); err != nil {
+			return err
+		}
+	}
+	coalescePhis(m)
+	FromSSA(m)
+	compactRegs(m, frameSlots)
+	return verify("FromSSA")
 }
@@ -0,0 +1,870 @@
+package iropt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/symbol"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+func TestOptimize(t *testing.T) {
+	i32 := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgReg, Type: ir.TypeInt, Value: v} }
+	ref := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgReg, Type: ir.TypeRef, Value: v} }
+	intConst := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: v} }
+	branch := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgBranch, Value: v} }
+	flags := ir.Arg{Kind: ir.ArgFlags}
+	env := ir.Arg{Kind: ir.ArgEnv}
+
+	tests := []struct {
+		name   string
+		passes []string
+		slots  int
+		code   []ir.Inst
+		want   []string
+	}{
+		{
+			// int x = 10; int y = x * 3; return y + n;
+			name:   "constfold",
+			passes: []string{"constfold", "deadcode"},
+			slots:  3,
+			code: []ir.Inst{
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(10)}},
+				{Kind: ir.InstImul, Dst: i32(2), Args: []ir.Arg{i32(1), intConst(3)}},
+				{Kind: ir.InstIadd, Dst: i32(2), Args: []ir.Arg{i32(2), i32(0)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(2)}},
+			},
+			want: []string{
+				"slots=2",
+				"0:   r1 = Iadd r0 30",
+				"1:   Iret r1",
+			},
+		},
+
+		{
+			// Constants are not propagated into the operands
+			// that can't encode them.
+			name:   "constfoldOperands",
+			passes: []string{"constfold"},
+			slots:  2,
+			code: []ir.Inst{
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(7)}},
+				{Kind: ir.InstImul, Dst: i32(0), Args: []ir.Arg{i32(0), i32(1)}},
+				{Kind: ir.InstIsub, Dst: i32(0), Args: []ir.Arg{i32(1), i32(0)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(0)}},
+			},
+			want: []string{
+				"slots=4",
+				"0:   r1 = Iload 7",
+				"1:   r2 = Imul r0 r1",
+				"2:   r3 = Isub r1 r2",
+				"3:   Iret r3",
+			},
+		},
+
+		{
+			// if (5 < 3) { return 1; } return n;
+			name:   "branchfold",
+			passes: []string{"constfold", "branchfold", "deadcode"},
+			slots:  2,
+			code: []ir.Inst{
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(5)}},
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(1), intConst(3)}},
+				{Kind: ir.InstJumpGtEq, Args: []ir.Arg{branch(4), flags}},
+				{Kind: ir.InstIret, Args: []ir.Arg{intConst(1)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(0)}},
+			},
+			want: []string{
+				"slots=1",
+				"0:   Iret r0",
+			},
+		},
+
+		{
+			// int r = 0; switch (2) { case 1: r = n; break; case 2: r = 10; } return r;
+			name:   "switchfold",
+			passes: []string{"branchfold", "copyprop", "deadcode"},
+			slots:  2,
+			code: []ir.Inst{
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(2)}},
+				{Kind: ir.InstSwitch, Args: []ir.Arg{i32(1), branch(5), intConst(1), branch(2), intConst(2), branch(4)}},
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{i32(0)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(6)}},
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(10)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(6)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+			},
+			want: []string{
+				"slots=1",
+				"0:   r0 = Iload 10",
+				"1:   Iret r0",
+			},
+		},
+
+		{
+			// if (n < 0) { r = -n; } else { r = n; } return r + r;
+			name:   "copyprop",
+			passes: []string{"copyprop"},
+			slots:  3,
+			code: []ir.Inst{
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(0), intConst(0)}},
+				{Kind: ir.InstJumpGtEq, Args: []ir.Arg{branch(5), flags}},
+				{Kind: ir.InstIneg, Dst: i32(2), Args: []ir.Arg{i32(0)}},
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{i32(2)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(6)}},
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{i32(0)}},
+				{Kind: ir.InstIadd, Dst: i32(2), Args: []ir.Arg{i32(1), i32(1)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(2)}},
+			},
+			want: []string{
+				"slots=2",
+				"0:   flags = Icmp r0 0",
+				"1:   JumpGtEq @3 flags",
+				"2:   r0 = Ineg r0",
+				"3: L r1 = Iadd r0 r0",
+				"4:   Iret r1",
+			},
+		},
+
+		{
+			// int s = 0; for (int i = 0; i < n; i++) { s += i; } return s;
+			name:   "loop",
+			passes: nil,
+			slots:  4,
+			code: []ir.Inst{
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(0)}},
+				{Kind: ir.InstIload, Dst: i32(2), Args: []ir.Arg{intConst(0)}},
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(2), i32(0)}},
+				{Kind: ir.InstJumpGtEq, Args: []ir.Arg{branch(8), flags}},
+				{Kind: ir.InstIadd, Dst: i32(3), Args: []ir.Arg{i32(1), i32(2)}},
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{i32(3)}},
+				{Kind: ir.InstIadd, Dst: i32(2), Args: []ir.Arg{i32(2), intConst(1)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(2)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+			},
+			want: []string{
+				"slots=3",
+				"0:   r1 = Iload 0",
+				"1:   r2 = Iload 0",
+				"2: L flags = Icmp r2 r0",
+				"3:   JumpGtEq @7 flags",
+				"4:   r1 = Iadd r1 r2",
+				"5:   r2 = Iadd r2 1",
+				"6:   Jump @2",
+				"7: L Iret r1",
+			},
+		},
+
+		{
+			// a[0] = n; a[1] = a[0] + 1; a[1] = a[1]; return a[0];
+			name:   "loadstore",
+			passes: []string{"loadstore", "copyprop"},
+			slots:  4,
+			code: []ir.Inst{
+				{Kind: ir.InstNewIntArray, Dst: ref(1), Args: []ir.Arg{env, intConst(2)}},
+				{Kind: ir.InstIntArraySet, Args: []ir.Arg{ref(1), intConst(0), i32(0)}},
+				{Kind: ir.InstIntArrayGet, Dst: i32(2), Args: []ir.Arg{ref(1), intConst(0)}},
+				{Kind: ir.InstIadd, Dst: i32(2), Args: []ir.Arg{i32(2), intConst(1)}},
+				{Kind: ir.InstIntArraySet, Args: []ir.Arg{ref(1), intConst(1), i32(2)}},
+				{Kind: ir.InstIntArrayGet, Dst: i32(3), Args: []ir.Arg{ref(1), intConst(1)}},
+				{Kind: ir.InstIntArraySet, Args: []ir.Arg{ref(1), intConst(1), i32(3)}},
+				{Kind: ir.InstIntArrayGet, Dst: i32(2), Args: []ir.Arg{ref(1), intConst(0)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(2)}},
+			},
+			want: []string{
+				"slots=3",
+				"0:   r1 = NewIntArray env 2",
+				"1:   IntArraySet r1 0 r0",
+				"2:   r2 = Iadd r0 1",
+				"3:   IntArraySet r1 1 r2",
+				"4:   Iret r0",
+			},
+		},
+
+		{
+			// Stores through the other array refs invalidate the known values.
+			name:   "loadstoreAlias",
+			passes: []string{"loadstore", "copyprop", "deadcode"},
+			slots:  3,
+			code: []ir.Inst{
+				{Kind: ir.InstIntArraySet, Args: []ir.Arg{ref(0), intConst(0), intConst(5)}},
+				{Kind: ir.InstIntArraySet, Args: []ir.Arg{ref(1), intConst(0), intConst(6)}},
+				{Kind: ir.InstIntArrayGet, Dst: i32(2), Args: []ir.Arg{ref(0), intConst(0)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(2)}},
+			},
+			want: []string{
+				"slots=3",
+				"0:   IntArraySet r0 0 5",
+				"1:   IntArraySet r1 0 6",
+				"2:   r2 = IntArrayGet r0 0",
+				"3:   Iret r2",
+			},
+		},
+
+		{
+			name:   "deadcode",
+			passes: []string{"deadcode"},
+			slots:  3,
+			code: []ir.Inst{
+				{Kind: ir.InstIadd, Dst: i32(1), Args: []ir.Arg{i32(0), intConst(1)}},
+				{Kind: ir.InstIdiv, Dst: i32(1), Args: []ir.Arg{i32(0), intConst(2)}},
+				{Kind: ir.InstIdiv, Dst: i32(2), Args: []ir.Arg{i32(0), i32(1)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(0)}},
+			},
+			want: []string{
+				"slots=3",
+				"0:   r1 = Idiv r0 2",
+				"1:   r2 = Idiv r0 r1",
+				"2:   Iret r0",
+			},
+		},
+
+		{
+			name:   "none",
+			passes: []string{},
+			slots:  2,
+			code: []ir.Inst{
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{i32(0)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+			},
+			want: []string{
+				"slots=2",
+				"0:   r1 = Iload r0",
+				"1:   Iret r1",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &vmdat.Method{Name: "f", FrameSlots: test.slots}
+			pkg := &ir.Package{
+				Out: &vmdat.Package{Name: "test"},
+				Classes: []ir.Class{{
+					Name:    "C",
+					Methods: []ir.Method{{Code: test.code, Out: out}},
+				}},
+			}
+			m := &pkg.Classes[0].Methods[0]
+			markBlocks(m.Code)
+			if err := ir.Verify(m); err != nil {
+				t.Fatalf("input: %v", err)
+			}
+
+			cfg := &Config{Debug: true, Passes: test.passes}
+			if _, err := Optimize(nil, []*ir.Package{pkg}, cfg); err != nil {
+				t.Fatal(err)
+			}
+			have := sprintCode(m)
+			want := strings.Join(test.want, "\n") + "\n"
+			if have != want {
+				t.Errorf("have:\n%s\nwant:\n%s", have, want)
+			}
+		})
+	}
+}
+
+func TestOptimizeStats(t *testing.T) {
+	i32 := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgReg, Type: ir.TypeInt, Value: v} }
+	intConst := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: v} }
+
+	newPackage := func() *ir.Package {
+		code := []ir.Inst{
+			{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(1)}},
+			{Kind: ir.InstIadd, Dst: i32(1), Args: []ir.Arg{i32(1), intConst(2)}},
+			{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+		}
+		markBlocks(code)
+		return &ir.Package{
+			Out: &vmdat.Package{Name: "test"},
+			Classes: []ir.Class{{
+				Name: "C",
+				Methods: []ir.Method{{
+					Code: code,
+					Out:  &vmdat.Method{Name: "f", FrameSlots: 2},
+				}},
+			}},
+		}
+	}
+
+	packages := []*ir.Package{newPackage(), newPackage()}
+	stats, err := Optimize(nil, packages, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := make([]PassStats, len(stats.Passes))
+	copy(have, stats.Passes)
+	want := []PassStats{
+		{Name: "inline"},
+		{Name: "constfold", Changes: 4},
+		{Name: "branchfold"},
+		{Name: "loadstore"},
+		{Name: "licm"},
+		{Name: "strengthreduce"},
+		{Name: "copyprop"},
+		{Name: "bce"},
+		{Name: "deadcode", Changes: 4, Removed: 4},
+	}
+	if len(have) != len(want) {
+		t.Fatalf("have %d passes, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Errorf("pass %d:\nhave: %+v\nwant: %+v", i, have[i], want[i])
+		}
+	}
+
+	if _, err := Optimize(nil, packages, &Config{Passes: []string{"unknown"}}); err == nil {
+		t.Errorf("expected an error for unknown pass")
+	}
+}
+
+func TestInline(t *testing.T) {
+	i32 := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgReg, Type: ir.TypeInt, Value: v} }
+	i64 := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgReg, Type: ir.TypeLong, Value: v} }
+	intConst := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: v} }
+	floatConst := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgFloatConst, Type: ir.TypeFloat, Value: v} }
+	branch := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgBranch, Value: v} }
+	sym := func(v uint64) ir.Arg { return ir.Arg{Kind: ir.ArgSymbolID, Value: int64(symbol.NewID(0, 0, v))} }
+	flags := ir.Arg{Kind: ir.ArgFlags}
+
+	type method struct {
+		desc  string
+		slots int
+		code  []ir.Inst
+	}
+	methods := []method{
+		// 0: static int add(int x, int y) { return x + y; }
+		{desc: "(II)I", slots: 3, code: []ir.Inst{
+			{Kind: ir.InstIadd, Dst: i32(2), Args: []ir.Arg{i32(0), i32(1)}},
+			{Kind: ir.InstIret, Args: []ir.Arg{i32(2)}},
+		}},
+		// 1: static int abs(int x) { if (x < 0) { return -x; } return x; }
+		{desc: "(I)I", slots: 2, code: []ir.Inst{
+			{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(0), intConst(0)}},
+			{Kind: ir.InstJumpGtEq, Args: []ir.Arg{branch(4), flags}},
+			{Kind: ir.InstIneg, Dst: i32(1), Args: []ir.Arg{i32(0)}},
+			{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+			{Kind: ir.InstIret, Args: []ir.Arg{i32(0)}},
+		}},
+		// 2: static int rec(int x) { return rec(x); }
+		{desc: "(I)I", slots: 2, code: []ir.Inst{
+			{Kind: ir.InstCallStatic, Dst: i32(1), Args: []ir.Arg{sym(2), i32(0)}},
+			{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+		}},
+		// 3: static long addLong(long x, int y) { return x + y; }
+		{desc: "(JI)J", slots: 5, code: []ir.Inst{
+			{Kind: ir.InstConvI2L, Dst: i64(3), Args: []ir.Arg{i32(2)}},
+			{Kind: ir.InstLadd, Dst: i64(4), Args: []ir.Arg{i64(0), i64(3)}},
+			{Kind: ir.InstLret, Args: []ir.Arg{i64(4)}},
+		}},
+		// 4: static int addAbs(int x, int y) { return add(abs(x), y); }
+		{desc: "(II)I", slots: 4, code: []ir.Inst{
+			{Kind: ir.InstCallStatic, Dst: i32(2), Args: []ir.Arg{sym(1), i32(0)}},
+			{Kind: ir.InstCallStatic, Dst: i32(3), Args: []ir.Arg{sym(0), i32(2), i32(1)}},
+			{Kind: ir.InstIret, Args: []ir.Arg{i32(3)}},
+		}},
+		// 5: static void nop(float x) {}
+		{desc: "(F)V", slots: 1, code: []ir.Inst{
+			{Kind: ir.InstRet},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		maxDepth int
+		slots    int
+		code     []ir.Inst
+		want     []string
+	}{
+		{
+			name:  "simple",
+			slots: 2,
+			code: []ir.Inst{
+				{Kind: ir.InstCallStatic, Dst: i32(1), Args: []ir.Arg{sym(0), i32(0), intConst(10)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+			},
+			want: []string{
+				"slots=5",
+				"0:   r2 = Iload r0",
+				"1:   r3 = Iload 10",
+				"2:   r4 = Iadd r2 r3",
+				"3:   r1 = Iload r4",
+				"4:   Iret r1",
+			},
+		},
+
+		{
+			name:  "multipleReturns",
+			slots: 2,
+			code: []ir.Inst{
+				{Kind: ir.InstCallStatic, Dst: i32(1), Args: []ir.Arg{sym(1), i32(0)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+			},
+			want: []string{
+				"slots=4",
+				"0:   r2 = Iload r0",
+				"1:   flags = Icmp r2 0",
+				"2:   JumpGtEq @6 flags",
+				"3:   r3 = Ineg r2",
+				"4:   r1 = Iload r3",
+				"5:   Jump @7",
+				"6: L r1 = Iload r2",
+				"7: L Iret r1",
+			},
+		},
+
+		{
+			name:  "branchesAroundCall",
+			slots: 2,
+			code: []ir.Inst{
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(0), intConst(0)}},
+				{Kind: ir.InstJumpEqual, Args: []ir.Arg{branch(3), flags}},
+				{Kind: ir.InstCallStatic, Dst: i32(0), Args: []ir.Arg{sym(1), i32(0)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(0)}},
+			},
+			want: []string{
+				"slots=4",
+				"0:   flags = Icmp r0 0",
+				"1:   JumpEqual @9 flags",
+				"2:   r2 = Iload r0",
+				"3:   flags = Icmp r2 0",
+				"4:   JumpGtEq @8 flags",
+				"5:   r3 = Ineg r2",
+				"6:   r0 = Iload r3",
+				"7:   Jump @9",
+				"8: L r0 = Iload r2",
+				"9: L Iret r0",
+			},
+		},
+
+		{
+			name:  "longParam",
+			slots: 3,
+			code: []ir.Inst{
+				{Kind: ir.InstCallStatic, Dst: i64(1), Args: []ir.Arg{sym(3), i64(0), intConst(1)}},
+				{Kind: ir.InstLret, Args: []ir.Arg{i64(1)}},
+			},
+			want: []string{
+				"slots=8",
+				"0:   r3 = Lload r0",
+				"1:   r5 = Iload 1",
+				"2:   r6 = ConvI2L r5",
+				"3:   r7 = Ladd r3 r6",
+				"4:   r1 = Lload r7",
+				"5:   Lret r1",
+			},
+		},
+
+		{
+			name:  "nested",
+			slots: 3,
+			code: []ir.Inst{
+				{Kind: ir.InstCallStatic, Dst: i32(1), Args: []ir.Arg{sym(4), i32(0), i32(0)}},
+				{Kind: ir.InstCallStatic, Dst: i32(2), Args: []ir.Arg{sym(2), i32(1)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(2)}},
+			},
+			want: []string{
+				"slots=14",
+				"0:   r3 = Iload r0",
+				"1:   r4 = Iload r0",
+				"2:   r7 = Iload r3",
+				"3:   flags = Icmp r7 0",
+				"4:   JumpGtEq @8 flags",
+				"5:   r8 = Ineg r7",
+				"6:   r5 = Iload r8",
+				"7:   Jump @9",
+				"8: L r5 = Iload r7",
+				"9: L r9 = Iload r5",
+				"10:   r10 = Iload r4",
+				"11:   r11 = Iadd r9 r10",
+				"12:   r6 = Iload r11",
+				"13:   r1 = Iload r6",
+				"14:   r12 = Iload r1",
+				"15:   r13 = CallStatic sym{0,0,2} r12",
+				"16:   r2 = Iload r13",
+				"17:   Iret r2",
+			},
+		},
+
+		{
+			name:     "depthLimit",
+			maxDepth: 1,
+			slots:    3,
+			code: []ir.Inst{
+				{Kind: ir.InstCallStatic, Dst: i32(1), Args: []ir.Arg{sym(4), i32(0), i32(0)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+			},
+			want: []string{
+				"slots=7",
+				"0:   r3 = Iload r0",
+				"1:   r4 = Iload r0",
+				"2:   r5 = CallStatic sym{0,0,1} r3",
+				"3:   r6 = CallStatic sym{0,0,0} r5 r4",
+				"4:   r1 = Iload r6",
+				"5:   Iret r1",
+			},
+		},
+
+		{
+			name:  "unsupportedArg",
+			slots: 1,
+			code: []ir.Inst{
+				{Kind: ir.InstCallStatic, Args: []ir.Arg{sym(5), floatConst(0)}},
+				{Kind: ir.InstRet},
+			},
+			want: []string{
+				"slots=1",
+				"0:   CallStatic sym{0,0,5} 0.0",
+				"1:   Ret",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pkg := &ir.Package{
+				Out:     &vmdat.Package{Name: "test"},
+				Classes: []ir.Class{{Name: "C"}},
+			}
+			for i, m := range methods {
+				code := copyCode(m.code)
+				markBlocks(code)
+				pkg.Classes[0].Methods = append(pkg.Classes[0].Methods, ir.Method{
+					Code: code,
+					Out: &vmdat.Method{
+						Descriptor: m.desc,
+						FrameSlots: m.slots,
+						ID:         symbol.NewID(0, 0, uint64(i)),
+					},
+				})
+			}
+			m := &ir.Method{
+				Code: test.code,
+				Out: &vmdat.Method{
+					FrameSlots: test.slots,
+					ID:         symbol.NewID(0, 0, uint64(len(methods))),
+				},
+			}
+			markBlocks(m.Code)
+
+			in := newInliner([]*ir.Package{pkg}, &Config{InlineMaxDepth: test.maxDepth})
+			in.inlineCalls(m)
+			if err := ir.Verify(m); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			have := sprintCode(m)
+			want := strings.Join(test.want, "\n") + "\n"
+			if have != want {
+				t.Errorf("have:\n%s\nwant:\n%s", have, want)
+			}
+		})
+	}
+}
+
+func TestLoopOptimizations(t *testing.T) {
+	i32 := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgReg, Type: ir.TypeInt, Value: v} }
+	intConst := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: v} }
+	branch := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgBranch, Value: v} }
+	flags := ir.Arg{Kind: ir.ArgFlags}
+
+	tests := []struct {
+		name   string
+		passes []string
+		slots  int
+		code   []ir.Inst
+		want   []string
+	}{
+		{
+			// int s = 0; for (int i = 0; i < n; i++) { s += k + 7; } return s;
+			name:   "licm",
+			passes: []string{"licm"},
+			slots:  5,
+			code: []ir.Inst{
+				{Kind: ir.InstIload, Dst: i32(2), Args: []ir.Arg{intConst(0)}},
+				{Kind: ir.InstIload, Dst: i32(3), Args: []ir.Arg{intConst(0)}},
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(3), i32(0)}},
+				{Kind: ir.InstJumpGtEq, Args: []ir.Arg{branch(8), flags}},
+				{Kind: ir.InstIadd, Dst: i32(4), Args: []ir.Arg{i32(1), intConst(7)}},
+				{Kind: ir.InstIadd, Dst: i32(2), Args: []ir.Arg{i32(2), i32(4)}},
+				{Kind: ir.InstIadd, Dst: i32(3), Args: []ir.Arg{i32(3), intConst(1)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(2)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(2)}},
+			},
+			want: []string{
+				"slots=5",
+				"0:   r2 = Iload 0",
+				"1:   r3 = Iload 0",
+				"2:   r4 = Iadd r1 7",
+				"3: L flags = Icmp r3 r0",
+				"4:   JumpGtEq @8 flags",
+				"5:   r2 = Iadd r2 r4",
+				"6:   r3 = Iadd r3 1",
+				"7:   Jump @3",
+				"8: L Iret r2",
+			},
+		},
+
+		{
+			// int s = 0; for (int i = 0; i < n; i++) { s += i * k; } return s;
+			name:   "strengthreduce",
+			passes: []string{"strengthreduce", "copyprop", "deadcode"},
+			slots:  5,
+			code: []ir.Inst{
+				{Kind: ir.InstIload, Dst: i32(2), Args: []ir.Arg{intConst(0)}},
+				{Kind: ir.InstIload, Dst: i32(3), Args: []ir.Arg{intConst(0)}},
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(3), i32(0)}},
+				{Kind: ir.InstJumpGtEq, Args: []ir.Arg{branch(8), flags}},
+				{Kind: ir.InstImul, Dst: i32(4), Args: []ir.Arg{i32(3), i32(1)}},
+				{Kind: ir.InstIadd, Dst: i32(2), Args: []ir.Arg{i32(2), i32(4)}},
+				{Kind: ir.InstIadd, Dst: i32(3), Args: []ir.Arg{i32(3), intConst(1)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(2)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(2)}},
+			},
+			want: []string{
+				"slots=5",
+				"0:   r2 = Iload 0",
+				"1:   r3 = Iload 0",
+				"2:   r4 = Iload 0",
+				"3: L flags = Icmp r3 r0",
+				"4:   JumpGtEq @9 flags",
+				"5:   r2 = Iadd r2 r4",
+				"6:   r3 = Iadd r3 1",
+				"7:   r4 = Iadd r4 r1",
+				"8:   Jump @3",
+				"9: L Iret r2",
+			},
+		},
+
+		{
+			// int s = 0; for (int i = 10; i < n; i += 2) { s += i * 3; } return s;
+			name:   "strengthreduceConst",
+			passes: []string{"constfold", "licm", "strengthreduce", "copyprop", "deadcode"},
+			slots:  5,
+			code: []ir.Inst{
+				{Kind: ir.InstIload, Dst: i32(2), Args: []ir.Arg{intConst(0)}},
+				{Kind: ir.InstIload, Dst: i32(3), Args: []ir.Arg{intConst(10)}},
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(3), i32(0)}},
+				{Kind: ir.InstJumpGtEq, Args: []ir.Arg{branch(9), flags}},
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(3)}},
+				{Kind: ir.InstImul, Dst: i32(4), Args: []ir.Arg{i32(3), i32(1)}},
+				{Kind: ir.InstIadd, Dst: i32(2), Args: []ir.Arg{i32(2), i32(4)}},
+				{Kind: ir.InstIadd, Dst: i32(3), Args: []ir.Arg{i32(3), intConst(2)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(2)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(2)}},
+			},
+			want: []string{
+				"slots=4",
+				"0:   r3 = Iload 30",
+				"1:   r1 = Iload 0",
+				"2:   r2 = Iload 10",
+				"3: L flags = Icmp r2 r0",
+				"4:   JumpGtEq @9 flags",
+				"5:   r1 = Iadd r1 r3",
+				"6:   r2 = Iadd r2 2",
+				"7:   r3 = Iadd r3 6",
+				"8:   Jump @3",
+				"9: L Iret r1",
+			},
+		},
+
+		{
+			// while (n > 0) { n--; } return n;
+			// The header is entered from two places, so a preheader is inserted.
+			name:   "preheader",
+			passes: []string{"licm"},
+			slots:  2,
+			code: []ir.Inst{
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(0), intConst(0)}},
+				{Kind: ir.InstJumpLt, Args: []ir.Arg{branch(4), flags}},
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(5)}},
+				{Kind: ir.InstIadd, Dst: i32(0), Args: []ir.Arg{i32(0), i32(1)}},
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(0), intConst(0)}},
+				{Kind: ir.InstJumpLtEq, Args: []ir.Arg{branch(9), flags}},
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(1)}},
+				{Kind: ir.InstIsub, Dst: i32(0), Args: []ir.Arg{i32(0), i32(1)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(4)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(0)}},
+			},
+			want: []string{
+				"slots=3",
+				"0:   flags = Icmp r0 0",
+				"1:   JumpLt @4 flags",
+				"2:   r1 = Iload 5",
+				"3:   r0 = Iadd r0 r1",
+				"4: L r2 = Iload 1",
+				"5: L flags = Icmp r0 0",
+				"6:   JumpLtEq @9 flags",
+				"7:   r0 = Isub r0 r2",
+				"8:   Jump @5",
+				"9: L Iret r0",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &ir.Method{
+				Code: test.code,
+				Out:  &vmdat.Method{Name: "f", FrameSlots: test.slots},
+			}
+			markBlocks(m.Code)
+			pkg := &ir.Package{
+				Out:     &vmdat.Package{Name: "test"},
+				Classes: []ir.Class{{Name: "C", Methods: []ir.Method{*m}}},
+			}
+			m = &pkg.Classes[0].Methods[0]
+			cfg := &Config{Debug: true, Passes: test.passes}
+			if _, err := Optimize(nil, []*ir.Package{pkg}, cfg); err != nil {
+				t.Fatal(err)
+			}
+			have := sprintCode(m)
+			want := strings.Join(test.want, "\n") + "\n"
+			if have != want {
+				t.Errorf("have:\n%s\nwant:\n%s", have, want)
+			}
+		})
+	}
+}
+
+func TestBoundsCheckElimination(t *testing.T) {
+	i32 := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgReg, Type: ir.TypeInt, Value: v} }
+	ref := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgReg, Type: ir.TypeRef, Value: v} }
+	intConst := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: v} }
+	branch := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgBranch, Value: v} }
+	flags := ir.Arg{Kind: ir.ArgFlags}
+	env := ir.Arg{Kind: ir.ArgEnv}
+
+	// countLoop returns a loop that stores i into a[i].
+	// r0 is an array, r1 is a loop counter.
+	countLoop := func(init ir.Arg, bound ir.Arg, cond ir.InstKind, step int64) []ir.Inst {
+		return []ir.Inst{
+			{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{init}},
+			{Kind: ir.InstArrayLen, Dst: i32(2), Args: []ir.Arg{ref(0)}},
+			{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(1), bound}},
+			{Kind: cond, Args: []ir.Arg{branch(7), flags}},
+			{Kind: ir.InstIntArraySet, Args: []ir.Arg{ref(0), i32(1), i32(1)}},
+			{Kind: ir.InstIadd, Dst: i32(1), Args: []ir.Arg{i32(1), intConst(step)}},
+			{Kind: ir.InstJump, Args: []ir.Arg{branch(1)}},
+			{Kind: ir.InstRet},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		slots int
+		code  []ir.Inst
+		want  []string
+	}{
+		{
+			// for (int i = 0; i < a.length; i++) { a[i] = i; }
+			name:  "countUp",
+			slots: 3,
+			code:  countLoop(intConst(0), i32(2), ir.InstJumpGtEq, 1),
+			want:  []string{"IntArraySet r0 r4 r4"},
+		},
+
+		{
+			// for (int i = 0; i <= a.length; i++) { a[i] = i; }
+			name:  "countUpInclusive",
+			slots: 3,
+			code:  countLoop(intConst(0), i32(2), ir.InstJumpGt, 1),
+			want:  nil,
+		},
+
+		{
+			// for (int i = -1; i < a.length; i++) { a[i] = i; }
+			name:  "countUpNegative",
+			slots: 3,
+			code:  countLoop(intConst(-1), i32(2), ir.InstJumpGtEq, 1),
+			want:  nil,
+		},
+
+		{
+			// for (int i = 0; i < a.length; i += 2) { a[i] = i; }
+			name:  "countUpStep2",
+			slots: 3,
+			code:  countLoop(intConst(0), i32(2), ir.InstJumpGtEq, 2),
+			want:  nil,
+		},
+
+		{
+			// for (int i = a.length-1; i >= 0; i--) { a[i] = i; }
+			name:  "countDown",
+			slots: 3,
+			code: []ir.Inst{
+				{Kind: ir.InstArrayLen, Dst: i32(2), Args: []ir.Arg{ref(0)}},
+				{Kind: ir.InstIsub, Dst: i32(1), Args: []ir.Arg{i32(2), intConst(1)}},
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(1), intConst(0)}},
+				{Kind: ir.InstJumpLt, Args: []ir.Arg{branch(7), flags}},
+				{Kind: ir.InstIntArraySet, Args: []ir.Arg{ref(0), i32(1), intConst(0)}},
+				{Kind: ir.InstIadd, Dst: i32(1), Args: []ir.Arg{i32(1), intConst(-1)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(2)}},
+				{Kind: ir.InstRet},
+			},
+			want: []string{"IntArraySet r0 r5 0"},
+		},
+
+		{
+			// int[] b = new int[5]; for (int i = 0; 5 > i; i++) { b[i] = a[i]; }
+			name:  "constLength",
+			slots: 4,
+			code: []ir.Inst{
+				{Kind: ir.InstNewIntArray, Dst: ref(3), Args: []ir.Arg{env, intConst(5)}},
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(0)}},
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{intConst(5), i32(1)}},
+				{Kind: ir.InstJumpLtEq, Args: []ir.Arg{branch(8), flags}},
+				{Kind: ir.InstIntArrayGet, Dst: i32(2), Args: []ir.Arg{ref(0), i32(1)}},
+				{Kind: ir.InstIntArraySet, Args: []ir.Arg{ref(3), i32(1), i32(2)}},
+				{Kind: ir.InstIadd, Dst: i32(1), Args: []ir.Arg{i32(1), intConst(1)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(2)}},
+				{Kind: ir.InstRet},
+			},
+			want: []string{"IntArraySet r4 r6 r7"},
+		},
+
+		{
+			// int[] b = new int[3]; b[0] = 1; b[2] = 1; b[3] = 1;
+			name:  "constIndex",
+			slots: 2,
+			code: []ir.Inst{
+				{Kind: ir.InstNewIntArray, Dst: ref(1), Args: []ir.Arg{env, intConst(3)}},
+				{Kind: ir.InstIntArraySet, Args: []ir.Arg{ref(1), intConst(0), intConst(1)}},
+				{Kind: ir.InstIntArraySet, Args: []ir.Arg{ref(1), intConst(2), intConst(1)}},
+				{Kind: ir.InstIntArraySet, Args: []ir.Arg{ref(1), intConst(3), intConst(1)}},
+				{Kind: ir.InstIntArrayGet, Dst: i32(0), Args: []ir.Arg{ref(1), intConst(-1)}},
+				{Kind: ir.InstRet},
+			},
+			want: []string{
+				"IntArraySet r2 0 1",
+				"IntArraySet r2 2 1",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &ir.Method{
+				Code: test.code,
+				Out:  &vmdat.Method{Name: "f", FrameSlots: test.slots},
+			}
+			markBlocks(m.Code)
+			ToSSA(m)
+			eliminateBoundsChecks(m)
+			if err := ir.Verify(m); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			var have []string
+			for _, inst := range m.Code {
+				if inst.Flags.IsInBounds() {
+					have = append(have, inst.String())
+				}
+			}
+			if strings.Join(have, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("have:\n%s\nwant:\n%s\ncode:\n%s",
+					strings.Join(have, "\n"), strings.Join(test.want, "\n"), sprintCode(m))
+			}
+		})
+	}
+}
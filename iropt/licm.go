@@ -0,0 +1,96 @@
+package iropt
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// hoistInvariants moves the loop-invariant computations
+// into the loop preheaders (loop-invariant code motion).
+//
+// An instruction is invariant if all its operands are defined
+// outside of the loop. Only the instructions that can't fail
+// are hoisted, so they can be executed even if the loop body is not.
+// ArrayLen can fail on a null array, it's hoisted only from the
+// loop header, as the header is executed every time the loop is entered.
+func hoistInvariants(m *ir.Method) int {
+	blocks, loops := prepareLoops(m)
+	if len(loops) == 0 {
+		return 0
+	}
+	defs := defBlocks(blocks)
+
+	changes := 0
+	for _, l := range loops {
+		isInvariant := func(arg ir.Arg) bool {
+			switch arg.Kind {
+			case ir.ArgReg:
+				def, ok := defs[arg.Value]
+				return !ok || !l.blocks[def]
+			case ir.ArgFlags:
+				return false
+			default:
+				return true
+			}
+		}
+
+		for changed := true; changed; {
+			changed = false
+			for _, b := range blocks {
+				if !l.blocks[b] {
+					continue
+				}
+				var dead []bool
+				for i, inst := range b.code {
+					if !canHoist(inst, b == l.header) {
+						continue
+					}
+					invariant := true
+					for _, arg := range inst.Args {
+						if !isInvariant(arg) {
+							invariant = false
+							break
+						}
+					}
+					if !invariant {
+						continue
+					}
+					if dead == nil {
+						dead = make([]bool, len(b.code))
+					}
+					dead[i] = true
+					l.appendToPreheader(inst)
+					defs[inst.Dst.Value] = l.preheader
+					changes++
+					changed = true
+				}
+				if dead != nil {
+					b.removeInsts(dead)
+				}
+			}
+		}
+	}
+
+	if changes != 0 {
+		m.Code = linearize(blocks)
+	}
+	return changes
+}
+
+// canHoist reports whether inst can be moved out of the loop.
+// inHeader is set for the loop header instructions.
+func canHoist(inst ir.Inst, inHeader bool) bool {
+	switch inst.Kind {
+	case ir.InstIload, ir.InstLload, ir.InstAload:
+		return true
+	case ir.InstIadd, ir.InstIsub, ir.InstImul, ir.InstIneg:
+		return true
+	case ir.InstLadd, ir.InstLneg, ir.InstFadd, ir.InstDadd:
+		return true
+	case ir.InstConvL2I, ir.InstConvF2I, ir.InstConvD2I, ir.InstConvI2L, ir.InstConvI2B:
+		return true
+	case ir.InstArrayLen:
+		return inHeader
+	default:
+		return false
+	}
+}
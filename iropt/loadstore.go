@@ -0,0 +1,115 @@
+package iropt
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// arrayElem is an array element with a known value.
+type arrayElem struct {
+	array ir.Arg
+	index ir.Arg
+	value ir.Arg
+}
+
+// removeRedundantLoadStore removes the array element loads
+// that re-read a known value and the stores that write
+// the value that the element already has.
+//
+// Element values are tracked inside the basic blocks only.
+func removeRedundantLoadStore(m *ir.Method) int {
+	blocks := buildBlocks(m.Code)
+
+	// Replaced loads become copies of the known values,
+	// so the stores of such copies can be recognized too.
+	copies := make(map[int64]ir.Arg)
+	resolve := func(arg ir.Arg) ir.Arg {
+		if arg.Kind == ir.ArgReg {
+			if v, ok := copies[arg.Value]; ok {
+				return v
+			}
+		}
+		return arg
+	}
+
+	changes := 0
+	var known []arrayElem
+	for _, b := range blocks {
+		known = known[:0]
+		var dead []bool
+		for i := range b.code {
+			inst := &b.code[i]
+			switch inst.Kind {
+			case ir.InstIntArrayGet:
+				array, index := inst.Args[0], inst.Args[1]
+				if elem := findElem(known, array, index); elem != nil {
+					copies[inst.Dst.Value] = elem.value
+					*inst = ir.Inst{
+						Kind: ir.InstIload,
+						Dst:  inst.Dst,
+						Args: []ir.Arg{elem.value},
+					}
+					changes++
+					continue
+				}
+				known = append(known, arrayElem{array: array, index: index, value: inst.Dst})
+
+			case ir.InstIntArraySet:
+				array, index, value := inst.Args[0], inst.Args[1], resolve(inst.Args[2])
+				if elem := findElem(known, array, index); elem != nil && sameArg(elem.value, value) {
+					if dead == nil {
+						dead = make([]bool, len(b.code))
+					}
+					dead[i] = true
+					changes++
+					continue
+				}
+				known = invalidateElems(known, array, index)
+				known = append(known, arrayElem{array: array, index: index, value: value})
+
+			case ir.InstCallStatic, ir.InstCallGo:
+				// Called methods can modify any array.
+				known = known[:0]
+			}
+		}
+		if dead != nil {
+			b.removeInsts(dead)
+		}
+	}
+
+	if changes != 0 {
+		m.Code = linearize(blocks)
+	}
+	return changes
+}
+
+func findElem(known []arrayElem, array, index ir.Arg) *arrayElem {
+	for i := range known {
+		elem := &known[i]
+		if sameArg(elem.array, array) && sameArg(elem.index, index) {
+			return elem
+		}
+	}
+	return nil
+}
+
+// invalidateElems removes the elements that can be overwritten
+// by a store to array[index].
+//
+// Different array refs can point to the same array, so only
+// the elements of the same array at different constant
+// indexes are known to be unaffected.
+func invalidateElems(known []arrayElem, array, index ir.Arg) []arrayElem {
+	out := known[:0]
+	for _, elem := range known {
+		if !sameArg(elem.array, array) {
+			continue
+		}
+		if elem.index.Kind != ir.ArgIntConst || index.Kind != ir.ArgIntConst {
+			continue
+		}
+		if elem.index.Value != index.Value {
+			out = append(out, elem)
+		}
+	}
+	return out
+}
@@ -0,0 +1,228 @@
+package iropt
+
+import (
+	"sort"
+
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// loop is a natural loop of the CFG.
+//
+// A natural loop is formed by the back edges that lead to its header:
+// blocks of the loop are the blocks that can reach the back edge
+// source without passing through the header.
+type loop struct {
+	header *block
+
+	// latches are the back edge sources.
+	latches []*block
+
+	// preheader is the only loop entry predecessor of the header.
+	// See prepareLoops.
+	preheader *block
+
+	blocks map[*block]bool
+}
+
+// findLoops returns the natural loops of the CFG.
+// Loops that share a header are merged.
+// Inner loops go first.
+//
+// computeDominators should be called before findLoops.
+func findLoops(blocks []*block) []*loop {
+	var loops []*loop
+	for _, h := range blocks {
+		var l *loop
+		for _, pred := range h.preds {
+			if !dominates(h, pred) {
+				continue
+			}
+			if l == nil {
+				l = &loop{header: h, blocks: map[*block]bool{h: true}}
+				loops = append(loops, l)
+			}
+			l.latches = append(l.latches, pred)
+			worklist := []*block{pred}
+			for len(worklist) != 0 {
+				b := worklist[len(worklist)-1]
+				worklist = worklist[:len(worklist)-1]
+				if l.blocks[b] {
+					continue
+				}
+				l.blocks[b] = true
+				worklist = append(worklist, b.preds...)
+			}
+		}
+	}
+
+	sort.SliceStable(loops, func(i, j int) bool {
+		return len(loops[i].blocks) < len(loops[j].blocks)
+	})
+	return loops
+}
+
+// dominates reports whether every path from the entry to b goes through a.
+func dominates(a, b *block) bool {
+	for ; b != nil; b = b.idom {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareLoops builds the CFG of the method in the SSA form and
+// finds its loops. Every loop gets a preheader: a block that is
+// the only predecessor of the header from outside of the loop.
+// The preheader has a single successor and doesn't end with
+// a conditional branch, so the code can be appended to it.
+//
+// Returned blocks are in the layout order.
+func prepareLoops(m *ir.Method) ([]*block, []*loop) {
+	blocks := buildBlocks(m.Code)
+	computeDominators(blocks)
+	loops := findLoops(blocks)
+	if len(loops) == 0 {
+		return blocks, nil
+	}
+
+	inserted := false
+	for _, l := range loops {
+		if findPreheader(l) != nil {
+			continue
+		}
+		blocks = insertPreheader(m, blocks, l)
+		inserted = true
+	}
+	if inserted {
+		computeDominators(blocks)
+		loops = findLoops(blocks)
+	}
+	for _, l := range loops {
+		l.preheader = findPreheader(l)
+	}
+	return blocks, loops
+}
+
+func findPreheader(l *loop) *block {
+	var p *block
+	for _, pred := range l.header.preds {
+		if l.blocks[pred] {
+			continue
+		}
+		if p != nil {
+			return nil
+		}
+		p = pred
+	}
+	if p == nil || len(p.succs) != 1 {
+		return nil
+	}
+	if last := p.code[len(p.code)-1]; isBranch(last.Kind) && last.Kind != ir.InstJump {
+		return nil
+	}
+	return p
+}
+
+// insertPreheader creates a new block that becomes the only
+// loop entry predecessor of the header.
+//
+// Header phi args that come from outside of the loop are
+// merged by the new phi instructions inside the preheader.
+func insertPreheader(m *ir.Method, layout []*block, l *loop) []*block {
+	h := l.header
+	var outside []*block
+	for _, pred := range h.preds {
+		if !l.blocks[pred] {
+			outside = append(outside, pred)
+		}
+	}
+
+	p := &block{id: len(layout)}
+	numPhis := h.numPhis()
+	// phiArgs map the header preds to the phi args.
+	phiArgs := make(map[*block][]ir.Arg, len(h.preds))
+	for j, pred := range h.preds {
+		args := make([]ir.Arg, numPhis)
+		for i, phi := range h.code[:numPhis] {
+			args[i] = phi.Args[j]
+		}
+		phiArgs[pred] = args
+	}
+	entryArgs := make([]ir.Arg, numPhis)
+	for i, phi := range h.code[:numPhis] {
+		if len(outside) == 1 {
+			entryArgs[i] = phiArgs[outside[0]][i]
+			continue
+		}
+		dst := phi.Dst
+		dst.Value = int64(m.Out.FrameSlots)
+		m.Out.FrameSlots++
+		p.code = append(p.code, ir.Inst{Kind: ir.InstPhi, Dst: dst})
+		entryArgs[i] = dst
+	}
+	phiArgs[p] = entryArgs
+
+	// The preheader is placed right before the header if the
+	// header was entered by falling through from outside of the loop.
+	// Otherwise it's placed at the end.
+	// Redundant jumps are removed by FromSSA.
+	var fallPred *block
+	for _, pred := range outside {
+		if pred.fallsInto == h {
+			fallPred = pred
+		}
+	}
+	for _, pred := range outside {
+		last := pred.code[len(pred.code)-1]
+		replaceBranch(last.Args, int64(h.id), int64(p.id))
+	}
+	p.code = append(p.code, newJump(h))
+	if fallPred != nil {
+		layout = insertBlockAfter(layout, fallPred, p)
+	} else {
+		layout = append(layout, p)
+	}
+	renumberBlocks(layout)
+
+	for i := range p.code[:p.numPhis()] {
+		phi := &p.code[i]
+		phi.Args = make([]ir.Arg, len(p.preds))
+		for j, pred := range p.preds {
+			phi.Args[j] = phiArgs[pred][i]
+		}
+	}
+	for i := range h.code[:numPhis] {
+		phi := &h.code[i]
+		phi.Args = make([]ir.Arg, len(h.preds))
+		for j, pred := range h.preds {
+			phi.Args[j] = phiArgs[pred][i]
+		}
+	}
+	return layout
+}
+
+// appendToPreheader inserts the code at the end of the loop preheader.
+func (l *loop) appendToPreheader(code ...ir.Inst) {
+	p := l.preheader
+	last := p.code[len(p.code)-1]
+	if last.Kind == ir.InstJump {
+		p.code = append(p.code[:len(p.code)-1], code...)
+		p.code = append(p.code, last)
+	} else {
+		p.code = append(p.code, code...)
+	}
+}
+
+// defBlocks maps the registers to the blocks that define them.
+func defBlocks(blocks []*block) map[int64]*block {
+	defs := make(map[int64]*block)
+	for _, b := range blocks {
+		for _, inst := range b.code {
+			if inst.Dst.Kind == ir.ArgReg {
+				defs[inst.Dst.Value] = b
+			}
+		}
+	}
+	return defs
+}
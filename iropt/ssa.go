@@ -0,0 +1,542 @@
+package iropt
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// ToSSA converts the method code into the SSA form.
+//
+// Every register assignment gets a new register number, starting
+// from the method frame slots count. Registers that are read before
+// any assignment (like method params) keep their original numbers.
+// Phi instructions are inserted only for the registers that
+// are live at the merge points (pruned SSA).
+//
+// m.Out.FrameSlots is updated to cover all new registers,
+// so every SSA register gets its own frame slot.
+// Unreachable blocks are removed.
+func ToSSA(m *ir.Method) {
+	if len(m.Code) == 0 {
+		return
+	}
+
+	blocks := buildBlocks(m.Code)
+	if len(blocks[0].preds) != 0 {
+		// Entry block can't have phi instructions,
+		// so a loop header at the method start needs a pre-header.
+		blocks = addEntryBlock(blocks)
+	}
+	postorder := computeDominators(blocks)
+	if len(postorder) != len(blocks) {
+		blocks = removeUnreachable(blocks)
+		computeDominators(blocks)
+	}
+
+	nslots := int64(m.Out.FrameSlots)
+	s := ssaBuilder{
+		nextReg:  nslots,
+		stacks:   make([][]ir.Arg, nslots),
+		phiSlots: make([][]int64, len(blocks)),
+	}
+	s.insertPhis(blocks, nslots)
+	s.rename(blocks[0])
+	inferPhiTypes(blocks)
+
+	m.Code = linearize(blocks)
+	m.Out.FrameSlots = int(s.nextReg)
+}
+
+// FromSSA lowers the method out of the SSA form.
+//
+// Phi instructions are replaced with the register copies at the end
+// of the predecessor blocks. Critical edges are split, so the copies
+// are never executed on the paths that don't lead to the phi block.
+func FromSSA(m *ir.Method) {
+	if len(m.Code) == 0 {
+		return
+	}
+
+	blocks := buildBlocks(m.Code)
+	nextReg := int64(m.Out.FrameSlots)
+	layout := make([]*block, len(blocks))
+	copy(layout, blocks)
+	for _, b := range blocks {
+		numPhis := b.numPhis()
+		if numPhis == 0 {
+			continue
+		}
+		phis := append([]ir.Inst(nil), b.code[:numPhis]...)
+
+		for j, pred := range b.preds {
+			copies := make([]parallelCopy, len(phis))
+			for i, phi := range phis {
+				copies[i] = parallelCopy{dst: phi.Dst, src: phi.Args[j]}
+			}
+			moves := sequentializeCopies(copies, &nextReg)
+			if len(moves) == 0 {
+				continue
+			}
+
+			last := pred.code[len(pred.code)-1]
+			switch {
+			case !isBranch(last.Kind):
+				// A single successor that follows the pred.
+				pred.code = append(pred.code, moves...)
+			case last.Kind == ir.InstJump:
+				pred.code = append(pred.code[:len(pred.code)-1], moves...)
+				pred.code = append(pred.code, last)
+			default:
+				// Conditional jumps and switches can't be followed by
+				// the copies, the edge is split by a new block.
+				split := &block{id: len(layout)}
+				split.code = append(moves, newJump(b))
+				// Args are not shared with other insts, see buildBlocks.
+				replaceBranch(last.Args, int64(b.id), int64(split.id))
+				if pred.fallsInto == b {
+					layout = insertBlockAfter(layout, pred, split)
+				} else {
+					layout = append(layout, split)
+				}
+			}
+		}
+
+		b.code = b.code[numPhis:]
+	}
+
+	layout = simplifyJumps(layout)
+	m.Code = linearize(layout)
+	m.Out.FrameSlots = int(nextReg)
+}
+
+type ssaBuilder struct {
+	nextReg int64
+
+	// stacks hold the current definitions of every original register.
+	stacks [][]ir.Arg
+
+	// phiSlots maps the block phi instructions to the original registers.
+	phiSlots [][]int64
+}
+
+// insertPhis places the phi instructions at the dominance frontiers
+// of the register assignments, if the register is live there.
+func (s *ssaBuilder) insertPhis(blocks []*block, nslots int64) {
+	liveIn := computeLiveIn(blocks, nslots)
+
+	defsites := make([][]*block, nslots)
+	for _, b := range blocks {
+		for _, inst := range b.code {
+			if inst.Dst.Kind != ir.ArgReg {
+				continue
+			}
+			slot := inst.Dst.Value
+			if !containsBlock(defsites[slot], b) {
+				defsites[slot] = append(defsites[slot], b)
+			}
+		}
+	}
+
+	hasPhi := make([]bool, len(blocks))
+	for slot := int64(0); slot < nslots; slot++ {
+		for i := range hasPhi {
+			hasPhi[i] = false
+		}
+		worklist := append([]*block(nil), defsites[slot]...)
+		for len(worklist) != 0 {
+			b := worklist[len(worklist)-1]
+			worklist = worklist[:len(worklist)-1]
+			for _, d := range b.frontier {
+				if hasPhi[d.id] || !liveIn[d.id][slot] {
+					continue
+				}
+				hasPhi[d.id] = true
+				phi := ir.Inst{
+					Kind: ir.InstPhi,
+					Dst:  ir.Arg{Kind: ir.ArgReg, Value: slot},
+					Args: make([]ir.Arg, len(d.preds)),
+				}
+				// Phis are kept in the register number order.
+				n := len(s.phiSlots[d.id])
+				d.code = append(d.code, ir.Inst{})
+				copy(d.code[n+1:], d.code[n:])
+				d.code[n] = phi
+				s.phiSlots[d.id] = append(s.phiSlots[d.id], slot)
+				if !containsBlock(defsites[slot], d) {
+					worklist = append(worklist, d)
+				}
+			}
+		}
+	}
+}
+
+// rename assigns the new register numbers to all definitions
+// dominated by the block b and updates their uses.
+func (s *ssaBuilder) rename(b *block) {
+	var pushed []int64
+	for i := range b.code {
+		inst := &b.code[i]
+		if inst.Kind != ir.InstPhi {
+			for j, arg := range inst.Args {
+				if arg.Kind == ir.ArgReg {
+					inst.Args[j].Value = s.current(arg).Value
+				}
+			}
+		}
+		if inst.Dst.Kind == ir.ArgReg {
+			slot := inst.Dst.Value
+			inst.Dst.Value = s.nextReg
+			s.nextReg++
+			s.stacks[slot] = append(s.stacks[slot], inst.Dst)
+			pushed = append(pushed, slot)
+		}
+	}
+
+	for _, succ := range b.succs {
+		j := succ.predIndex(b)
+		for i, slot := range s.phiSlots[succ.id] {
+			succ.code[i].Args[j] = s.current(ir.Arg{Kind: ir.ArgReg, Value: slot})
+		}
+	}
+
+	for _, child := range b.children {
+		s.rename(child)
+	}
+
+	for _, slot := range pushed {
+		s.stacks[slot] = s.stacks[slot][:len(s.stacks[slot])-1]
+	}
+}
+
+// current returns the reaching definition of the original register arg.
+func (s *ssaBuilder) current(arg ir.Arg) ir.Arg {
+	defs := s.stacks[arg.Value]
+	if len(defs) == 0 {
+		return arg
+	}
+	def := defs[len(defs)-1]
+	if arg.Type != ir.TypeVoid {
+		def.Type = arg.Type
+	}
+	return def
+}
+
+// inferPhiTypes assigns the types to the phi instructions and their args.
+//
+// Phi args that refer to the registers that are never assigned
+// inside the method (like params) have no known type while renaming,
+// so the type is inferred from the other args or the register uses.
+func inferPhiTypes(blocks []*block) {
+	types := make(map[int64]ir.Type)
+	for _, b := range blocks {
+		for _, inst := range b.code {
+			if inst.Kind == ir.InstPhi {
+				continue
+			}
+			if inst.Dst.Kind == ir.ArgReg {
+				types[inst.Dst.Value] = inst.Dst.Type
+			}
+			for _, arg := range inst.Args {
+				if arg.Kind == ir.ArgReg && arg.Type != ir.TypeVoid {
+					types[arg.Value] = arg.Type
+				}
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, b := range blocks {
+			for i := range b.code {
+				phi := &b.code[i]
+				if phi.Kind != ir.InstPhi {
+					break
+				}
+				typ := types[phi.Dst.Value]
+				for _, arg := range phi.Args {
+					if typ != ir.TypeVoid {
+						break
+					}
+					typ = arg.Type
+					if typ == ir.TypeVoid {
+						typ = types[arg.Value]
+					}
+				}
+				if typ == ir.TypeVoid {
+					continue
+				}
+				if phi.Dst.Type != typ {
+					phi.Dst.Type = typ
+					types[phi.Dst.Value] = typ
+					changed = true
+				}
+				for j, arg := range phi.Args {
+					if arg.Type == ir.TypeVoid {
+						phi.Args[j].Type = typ
+						types[arg.Value] = typ
+						changed = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// computeLiveIn returns the registers that are live at every block entry.
+// The result is indexed by the block id and then by the register number.
+func computeLiveIn(blocks []*block, nslots int64) [][]bool {
+	uses := make([][]bool, len(blocks))
+	defs := make([][]bool, len(blocks))
+	liveIn := make([][]bool, len(blocks))
+	for _, b := range blocks {
+		uses[b.id] = make([]bool, nslots)
+		defs[b.id] = make([]bool, nslots)
+		liveIn[b.id] = make([]bool, nslots)
+		for _, inst := range b.code {
+			for _, arg := range inst.Args {
+				if arg.Kind == ir.ArgReg && !defs[b.id][arg.Value] {
+					uses[b.id][arg.Value] = true
+				}
+			}
+			if inst.Dst.Kind == ir.ArgReg {
+				defs[b.id][inst.Dst.Value] = true
+			}
+		}
+		copy(liveIn[b.id], uses[b.id])
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(blocks) - 1; i >= 0; i-- {
+			b := blocks[i]
+			for _, succ := range b.succs {
+				for slot, live := range liveIn[succ.id] {
+					if live && !defs[b.id][slot] && !liveIn[b.id][slot] {
+						liveIn[b.id][slot] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	return liveIn
+}
+
+// addEntryBlock prepends the empty block that jumps to the old entry block.
+func addEntryBlock(blocks []*block) []*block {
+	entry := &block{
+		id:   len(blocks),
+		code: []ir.Inst{newJump(blocks[0])},
+	}
+	blocks = append([]*block{entry}, blocks...)
+	renumberBlocks(blocks)
+	return blocks
+}
+
+// removeUnreachable drops the blocks that were not visited by computeDominators.
+func removeUnreachable(blocks []*block) []*block {
+	live := blocks[:0]
+	for _, b := range blocks {
+		if b.rpo != -1 {
+			live = append(live, b)
+		}
+	}
+	renumberBlocks(live)
+	return live
+}
+
+// renumberBlocks assigns the block ids according to their
+// position and updates the branch targets accordingly.
+// Branch targets should refer to the blocks from the list.
+func renumberBlocks(blocks []*block) {
+	oldID := make(map[*block]int64, len(blocks))
+	newID := make(map[int64]int64, len(blocks))
+	for i, b := range blocks {
+		oldID[b] = int64(b.id)
+		b.id = i
+	}
+	for _, b := range blocks {
+		newID[oldID[b]] = int64(b.id)
+	}
+	for _, b := range blocks {
+		for i := range b.code {
+			for j, arg := range b.code[i].Args {
+				if arg.Kind == ir.ArgBranch {
+					b.code[i].Args[j].Value = newID[arg.Value]
+				}
+			}
+		}
+	}
+	linkBlocks(blocks)
+}
+
+// simplifyJumps redirects the branches that lead to the jump-only
+// blocks right to their targets and drops the unconditional jumps
+// to the block that follows in the layout.
+// Blocks that become unused are removed.
+//
+// It's only valid for the code without phi instructions.
+func simplifyJumps(layout []*block) []*block {
+	byID := make(map[int64]*block, len(layout))
+	for _, b := range layout {
+		byID[int64(b.id)] = b
+	}
+	jumpOnly := func(b *block) (int64, bool) {
+		if len(b.code) != 1 || b.code[0].Kind != ir.InstJump {
+			return 0, false
+		}
+		return b.code[0].Args[0].Value, true
+	}
+
+	referenced := make(map[int64]bool)
+	for _, b := range layout {
+		for i := range b.code {
+			for j, arg := range b.code[i].Args {
+				if arg.Kind != ir.ArgBranch {
+					continue
+				}
+				target := arg.Value
+				// Steps are limited to handle the jump cycles.
+				for steps := 0; steps < len(layout); steps++ {
+					next, ok := jumpOnly(byID[target])
+					if !ok {
+						break
+					}
+					target = next
+				}
+				b.code[i].Args[j].Value = target
+				referenced[target] = true
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i, b := range layout {
+			target, ok := jumpOnly(b)
+			if !ok || referenced[int64(b.id)] {
+				continue
+			}
+			toNext := i+1 < len(layout) && target == int64(layout[i+1].id)
+			unreachable := i != 0 && !fallsThrough(layout[i-1])
+			if toNext || unreachable {
+				layout = append(layout[:i], layout[i+1:]...)
+				changed = true
+				break
+			}
+		}
+	}
+
+	for i, b := range layout {
+		last := b.code[len(b.code)-1]
+		if len(b.code) > 1 && last.Kind == ir.InstJump && i+1 < len(layout) && last.Args[0].Value == int64(layout[i+1].id) {
+			b.code = b.code[:len(b.code)-1]
+		}
+	}
+
+	renumberBlocks(layout)
+	return layout
+}
+
+// fallsThrough reports whether the control can flow from b
+// to the next block in the layout.
+func fallsThrough(b *block) bool {
+	last := b.code[len(b.code)-1]
+	return !isRet(last.Kind) && last.Kind != ir.InstJump && last.Kind != ir.InstSwitch
+}
+
+func insertBlockAfter(layout []*block, after, b *block) []*block {
+	for i, x := range layout {
+		if x == after {
+			layout = append(layout, nil)
+			copy(layout[i+2:], layout[i+1:])
+			layout[i+1] = b
+			return layout
+		}
+	}
+	panic("block is not found in layout")
+}
+
+func replaceBranch(args []ir.Arg, from, to int64) {
+	for i, arg := range args {
+		if arg.Kind == ir.ArgBranch && arg.Value == from {
+			args[i].Value = to
+		}
+	}
+}
+
+type parallelCopy struct {
+	dst ir.Arg
+	src ir.Arg
+}
+
+// sequentializeCopies converts a set of copies that are performed
+// simultaneously into a sequence of moves.
+// Copy cycles are broken with a new temporary register.
+func sequentializeCopies(copies []parallelCopy, nextReg *int64) []ir.Inst {
+	var pending []parallelCopy
+	for _, c := range copies {
+		if !sameReg(c.dst, c.src) {
+			pending = append(pending, c)
+		}
+	}
+
+	var moves []ir.Inst
+	emit := func(dst, src ir.Arg) {
+		moves = append(moves, ir.Inst{
+			Kind: moveKind(dst.Type),
+			Dst:  dst,
+			Args: []ir.Arg{src},
+		})
+	}
+	for len(pending) != 0 {
+		progress := false
+		for i := 0; i < len(pending); i++ {
+			c := pending[i]
+			blocked := false
+			for _, other := range pending {
+				if sameReg(other.src, c.dst) {
+					blocked = true
+					break
+				}
+			}
+			if blocked {
+				continue
+			}
+			emit(c.dst, c.src)
+			pending = append(pending[:i], pending[i+1:]...)
+			i--
+			progress = true
+		}
+		if !progress {
+			// A cycle: save one of the destinations and redirect its readers.
+			saved := pending[0].dst
+			tmp := ir.Arg{Kind: ir.ArgReg, Type: saved.Type, Value: *nextReg}
+			*nextReg++
+			emit(tmp, saved)
+			for i := range pending {
+				if sameReg(pending[i].src, saved) {
+					pending[i].src = tmp
+				}
+			}
+		}
+	}
+	return moves
+}
+
+// sameReg reports whether a and b refer to the same register.
+func sameReg(a, b ir.Arg) bool {
+	return a.Kind == ir.ArgReg && b.Kind == ir.ArgReg && a.Value == b.Value
+}
+
+// moveKind returns an instruction kind that copies the values of type typ.
+func moveKind(typ ir.Type) ir.InstKind {
+	switch typ {
+	case ir.TypeLong, ir.TypeDouble:
+		return ir.InstLload
+	case ir.TypeRef:
+		return ir.InstAload
+	default:
+		return ir.InstIload
+	}
+}
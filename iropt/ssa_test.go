@@ -0,0 +1,298 @@
+package iropt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+func TestSSA(t *testing.T) {
+	i32 := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgReg, Type: ir.TypeInt, Value: v} }
+	i64 := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgReg, Type: ir.TypeLong, Value: v} }
+	intConst := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: v} }
+	branch := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgBranch, Value: v} }
+	flags := ir.Arg{Kind: ir.ArgFlags}
+
+	tests := []struct {
+		name    string
+		slots   int
+		code    []ir.Inst
+		wantSSA []string
+		want    []string
+	}{
+		{
+			// return x < 0 ? -x : x;
+			name:  "abs",
+			slots: 2,
+			code: []ir.Inst{
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(0), intConst(0)}},
+				{Kind: ir.InstJumpGtEq, Args: []ir.Arg{branch(4), flags}},
+				{Kind: ir.InstIneg, Dst: i32(1), Args: []ir.Arg{i32(0)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(5)}},
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{i32(0)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+			},
+			wantSSA: []string{
+				"slots=5",
+				"0:   flags = Icmp r0 0",
+				"1:   JumpGtEq @4 flags",
+				"2:   r2 = Ineg r0",
+				"3:   Jump @5",
+				"4: L r3 = Iload r0",
+				"5: L r4 = Phi r2 r3",
+				"6:   Iret r4",
+			},
+			want: []string{
+				"slots=5",
+				"0:   flags = Icmp r0 0",
+				"1:   JumpGtEq @5 flags",
+				"2:   r2 = Ineg r0",
+				"3:   r4 = Iload r2",
+				"4:   Jump @7",
+				"5: L r3 = Iload r0",
+				"6:   r4 = Iload r3",
+				"7: L Iret r4",
+			},
+		},
+
+		{
+			// for (i = 0; i < n; i++) { s += i; } return s;
+			name:  "loop",
+			slots: 3,
+			code: []ir.Inst{
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{intConst(0)}},
+				{Kind: ir.InstIload, Dst: i32(2), Args: []ir.Arg{intConst(0)}},
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(2), i32(0)}},
+				{Kind: ir.InstJumpGtEq, Args: []ir.Arg{branch(7), flags}},
+				{Kind: ir.InstIadd, Dst: i32(1), Args: []ir.Arg{i32(1), i32(2)}},
+				{Kind: ir.InstIadd, Dst: i32(2), Args: []ir.Arg{i32(2), intConst(1)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(2)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+			},
+			wantSSA: []string{
+				"slots=9",
+				"0:   r3 = Iload 0",
+				"1:   r4 = Iload 0",
+				"2: L r5 = Phi r3 r7",
+				"3:   r6 = Phi r4 r8",
+				"4:   flags = Icmp r6 r0",
+				"5:   JumpGtEq @9 flags",
+				"6:   r7 = Iadd r5 r6",
+				"7:   r8 = Iadd r6 1",
+				"8:   Jump @2",
+				"9: L Iret r5",
+			},
+			want: []string{
+				"slots=9",
+				"0:   r3 = Iload 0",
+				"1:   r4 = Iload 0",
+				"2:   r5 = Iload r3",
+				"3:   r6 = Iload r4",
+				"4: L flags = Icmp r6 r0",
+				"5:   JumpGtEq @11 flags",
+				"6:   r7 = Iadd r5 r6",
+				"7:   r8 = Iadd r6 1",
+				"8:   r5 = Iload r7",
+				"9:   r6 = Iload r8",
+				"10:   Jump @4",
+				"11: L Iret r5",
+			},
+		},
+
+		{
+			// while (n != 0) { t = a; a = b; b = t; n--; } return a;
+			name:  "swap",
+			slots: 4,
+			code: []ir.Inst{
+				{Kind: ir.InstIcmp, Dst: flags, Args: []ir.Arg{i32(0), intConst(0)}},
+				{Kind: ir.InstJumpEqual, Args: []ir.Arg{branch(7), flags}},
+				{Kind: ir.InstIload, Dst: i32(3), Args: []ir.Arg{i32(1)}},
+				{Kind: ir.InstIload, Dst: i32(1), Args: []ir.Arg{i32(2)}},
+				{Kind: ir.InstIload, Dst: i32(2), Args: []ir.Arg{i32(3)}},
+				{Kind: ir.InstIadd, Dst: i32(0), Args: []ir.Arg{i32(0), intConst(-1)}},
+				{Kind: ir.InstJump, Args: []ir.Arg{branch(0)}},
+				{Kind: ir.InstIret, Args: []ir.Arg{i32(1)}},
+			},
+			wantSSA: []string{
+				"slots=11",
+				"0:   Jump @1",
+				"1: L r4 = Phi r0 r10",
+				"2:   r5 = Phi r1 r8",
+				"3:   r6 = Phi r2 r9",
+				"4:   flags = Icmp r4 0",
+				"5:   JumpEqual @11 flags",
+				"6:   r7 = Iload r5",
+				"7:   r8 = Iload r6",
+				"8:   r9 = Iload r7",
+				"9:   r10 = Iadd r4 -1",
+				"10:   Jump @1",
+				"11: L Iret r5",
+			},
+			want: []string{
+				"slots=11",
+				"0:   r4 = Iload r0",
+				"1:   r5 = Iload r1",
+				"2:   r6 = Iload r2",
+				"3: L flags = Icmp r4 0",
+				"4:   JumpEqual @13 flags",
+				"5:   r7 = Iload r5",
+				"6:   r8 = Iload r6",
+				"7:   r9 = Iload r7",
+				"8:   r10 = Iadd r4 -1",
+				"9:   r4 = Iload r10",
+				"10:   r5 = Iload r8",
+				"11:   r6 = Iload r9",
+				"12:   Jump @3",
+				"13: L Iret r5",
+			},
+		},
+
+		{
+			// A phi operand that is defined before the loop,
+			// the loop exit edge is critical and needs a split.
+			// do { x = x + x; } while (x < 100); return x;
+			name:  "criticalEdge",
+			slots: 1,
+			code: []ir.Inst{
+				{Kind: ir.InstLadd, Dst: i64(0), Args: []ir.Arg{i64(0), i64(0)}},
+				{Kind: ir.InstLcmp, Dst: flags, Args: []ir.Arg{i64(0), {Kind: ir.ArgIntConst, Type: ir.TypeLong, Value: 100}}},
+				{Kind: ir.InstJumpLt, Args: []ir.Arg{branch(0), flags}},
+				{Kind: ir.InstLret, Args: []ir.Arg{i64(0)}},
+			},
+			wantSSA: []string{
+				"slots=3",
+				"0:   Jump @1",
+				"1: L r1 = Phi r0 r2",
+				"2:   r2 = Ladd r1 r1",
+				"3:   flags = Lcmp r2 100",
+				"4:   JumpLt @1 flags",
+				"5:   Lret r2",
+			},
+			want: []string{
+				"slots=3",
+				"0:   r1 = Lload r0",
+				"1: L r2 = Ladd r1 r1",
+				"2:   flags = Lcmp r2 100",
+				"3:   JumpLt @5 flags",
+				"4:   Lret r2",
+				"5: L r1 = Lload r2",
+				"6:   Jump @1",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &ir.Method{
+				Code: test.code,
+				Out:  &vmdat.Method{FrameSlots: test.slots},
+			}
+			markBlocks(m.Code)
+			if err := ir.Verify(m); err != nil {
+				t.Fatalf("input: %v", err)
+			}
+
+			ToSSA(m)
+			if err := ir.Verify(m); err != nil {
+				t.Fatalf("ToSSA: %v", err)
+			}
+			have := sprintCode(m)
+			want := strings.Join(test.wantSSA, "\n") + "\n"
+			if have != want {
+				t.Errorf("ToSSA:\nhave:\n%s\nwant:\n%s", have, want)
+			}
+
+			FromSSA(m)
+			if err := ir.Verify(m); err != nil {
+				t.Fatalf("FromSSA: %v", err)
+			}
+			have = sprintCode(m)
+			want = strings.Join(test.want, "\n") + "\n"
+			if have != want {
+				t.Errorf("FromSSA:\nhave:\n%s\nwant:\n%s", have, want)
+			}
+		})
+	}
+}
+
+// markBlocks sets the block flags in the same way irgen does.
+func markBlocks(code []ir.Inst) {
+	blocks := buildBlocks(code)
+	copy(code, linearize(blocks))
+}
+
+// sprintCode formats the method code, one inst per line.
+// Jump targets are marked with "L".
+func sprintCode(m *ir.Method) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "slots=%d\n", m.Out.FrameSlots)
+	for i, inst := range m.Code {
+		mark := " "
+		if inst.Flags.IsJumpTarget() && i != 0 {
+			mark = "L"
+		}
+		fmt.Fprintf(&buf, "%d: %s %s\n", i, mark, inst)
+	}
+	return buf.String()
+}
+
+func TestSequentializeCopies(t *testing.T) {
+	reg := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgReg, Type: ir.TypeInt, Value: v} }
+	intConst := func(v int64) ir.Arg { return ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: v} }
+
+	tests := []struct {
+		name   string
+		copies []parallelCopy
+		want   []string
+	}{
+		{
+			name: "independent",
+			copies: []parallelCopy{
+				{dst: reg(1), src: reg(2)},
+				{dst: reg(3), src: intConst(10)},
+				{dst: reg(4), src: reg(4)},
+			},
+			want: []string{"r1 = Iload r2", "r3 = Iload 10"},
+		},
+		{
+			name: "chain",
+			copies: []parallelCopy{
+				{dst: reg(1), src: reg(2)},
+				{dst: reg(2), src: reg(3)},
+			},
+			want: []string{"r1 = Iload r2", "r2 = Iload r3"},
+		},
+		{
+			name: "swap",
+			copies: []parallelCopy{
+				{dst: reg(1), src: reg(2)},
+				{dst: reg(2), src: reg(1)},
+			},
+			want: []string{"r10 = Iload r1", "r1 = Iload r2", "r2 = Iload r10"},
+		},
+		{
+			name: "rotate",
+			copies: []parallelCopy{
+				{dst: reg(1), src: reg(2)},
+				{dst: reg(2), src: reg(3)},
+				{dst: reg(3), src: reg(1)},
+				{dst: reg(4), src: reg(1)},
+			},
+			want: []string{"r4 = Iload r1", "r10 = Iload r1", "r1 = Iload r2", "r2 = Iload r3", "r3 = Iload r10"},
+		},
+	}
+
+	for _, test := range tests {
+		nextReg := int64(10)
+		var have []string
+		for _, inst := range sequentializeCopies(test.copies, &nextReg) {
+			have = append(have, inst.String())
+		}
+		if strings.Join(have, "; ") != strings.Join(test.want, "; ") {
+			t.Errorf("%s:\nhave: %q\nwant: %q", test.name, have, test.want)
+		}
+	}
+}
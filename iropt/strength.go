@@ -0,0 +1,213 @@
+package iropt
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// inductionVar is a basic induction variable of the loop:
+// a header phi that is incremented by a constant step
+// on every iteration.
+type inductionVar struct {
+	phi  *ir.Inst
+	init ir.Arg
+	step int64
+
+	// next is a register that holds the incremented value.
+	next int64
+}
+
+// findInductionVars returns the basic induction variables of the loop.
+// Only the loops with a single latch are analyzed.
+func findInductionVars(l *loop, defs map[int64]*ir.Inst) []inductionVar {
+	h := l.header
+	if l.preheader == nil || len(h.preds) != 2 || len(l.latches) != 1 {
+		return nil
+	}
+	entryIndex := h.predIndex(l.preheader)
+	latchIndex := h.predIndex(l.latches[0])
+
+	var ivs []inductionVar
+	for i := range h.code[:h.numPhis()] {
+		phi := &h.code[i]
+		if phi.Dst.Type != ir.TypeInt {
+			continue
+		}
+		next := phi.Args[latchIndex]
+		if next.Kind != ir.ArgReg {
+			continue
+		}
+		def := defs[next.Value]
+		if def == nil || def.Args[0].Kind != ir.ArgReg || def.Args[0].Value != phi.Dst.Value {
+			continue
+		}
+		var step int64
+		switch {
+		case def.Kind == ir.InstIadd && def.Args[1].Kind == ir.ArgIntConst:
+			step = def.Args[1].Value
+		case def.Kind == ir.InstIsub && def.Args[1].Kind == ir.ArgIntConst:
+			step = -def.Args[1].Value
+		default:
+			continue
+		}
+		ivs = append(ivs, inductionVar{
+			phi:  phi,
+			init: phi.Args[entryIndex],
+			step: step,
+			next: next.Value,
+		})
+	}
+	return ivs
+}
+
+// reduceStrength replaces the multiplications of the induction
+// variables by the loop invariants with the additions.
+//
+// For every t=i*k a new induction variable j is introduced.
+// j starts from init*k and is incremented by step*k
+// every time the i is incremented. The multiplication
+// is then replaced with a copy of j.
+func reduceStrength(m *ir.Method) int {
+	blocks, loops := prepareLoops(m)
+	if len(loops) == 0 {
+		return 0
+	}
+	consts := constMoves(m.Code)
+	nextReg := int64(m.Out.FrameSlots)
+	newReg := func() ir.Arg {
+		reg := ir.Arg{Kind: ir.ArgReg, Type: ir.TypeInt, Value: nextReg}
+		nextReg++
+		return reg
+	}
+
+	changes := 0
+	for _, l := range loops {
+		defs := make(map[int64]*ir.Inst)
+		defBlock := make(map[int64]*block)
+		for _, b := range blocks {
+			for i := range b.code {
+				if dst := b.code[i].Dst; dst.Kind == ir.ArgReg {
+					defs[dst.Value] = &b.code[i]
+					defBlock[dst.Value] = b
+				}
+			}
+		}
+		ivs := findInductionVars(l, defs)
+		if len(ivs) == 0 {
+			continue
+		}
+		findIV := func(arg ir.Arg) *inductionVar {
+			for i := range ivs {
+				if arg.Kind == ir.ArgReg && ivs[i].phi.Dst.Value == arg.Value {
+					return &ivs[i]
+				}
+			}
+			return nil
+		}
+		isInvariant := func(arg ir.Arg) bool {
+			def, ok := defBlock[arg.Value]
+			return arg.Kind == ir.ArgReg && (!ok || !l.blocks[def])
+		}
+
+		type reduction struct {
+			iv *inductionVar
+			k  ir.Arg
+			t  *ir.Inst
+		}
+		var reductions []reduction
+		for _, b := range blocks {
+			if !l.blocks[b] {
+				continue
+			}
+			for i := range b.code {
+				inst := &b.code[i]
+				if inst.Kind != ir.InstImul {
+					continue
+				}
+				x, y := inst.Args[0], inst.Args[1]
+				if iv := findIV(x); iv != nil && isInvariant(y) {
+					reductions = append(reductions, reduction{iv: iv, k: y, t: inst})
+				} else if iv := findIV(y); iv != nil && isInvariant(x) {
+					reductions = append(reductions, reduction{iv: iv, k: x, t: inst})
+				}
+			}
+		}
+
+		h := l.header
+		var headerPhis []ir.Inst
+		increments := make(map[int64][]ir.Inst)
+		for _, r := range reductions {
+			var init []ir.Inst
+			j0 := newReg()
+			var step ir.Arg
+			k, kIsConst := consts[r.k.Value]
+			c, initIsConst := constValue(r.iv.init, consts)
+			switch {
+			case initIsConst && (kIsConst || c.Value == 0):
+				init = append(init, ir.Inst{
+					Kind: ir.InstIload,
+					Dst:  j0,
+					Args: []ir.Arg{{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: int64(int32(c.Value) * int32(k.Value))}},
+				})
+			case r.iv.init.Kind == ir.ArgReg:
+				init = append(init, ir.Inst{Kind: ir.InstImul, Dst: j0, Args: []ir.Arg{r.iv.init, r.k}})
+			default:
+				tmp := newReg()
+				init = append(init,
+					ir.Inst{Kind: ir.InstIload, Dst: tmp, Args: []ir.Arg{r.iv.init}},
+					ir.Inst{Kind: ir.InstImul, Dst: j0, Args: []ir.Arg{tmp, r.k}})
+			}
+			switch {
+			case kIsConst:
+				step = ir.Arg{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: int64(int32(r.iv.step) * int32(k.Value))}
+			case r.iv.step == 1:
+				step = r.k
+			default:
+				step = newReg()
+				tmp := newReg()
+				init = append(init,
+					ir.Inst{Kind: ir.InstIload, Dst: tmp, Args: []ir.Arg{{Kind: ir.ArgIntConst, Type: ir.TypeInt, Value: r.iv.step}}},
+					ir.Inst{Kind: ir.InstImul, Dst: step, Args: []ir.Arg{r.k, tmp}})
+			}
+			l.appendToPreheader(init...)
+
+			j := newReg()
+			jNext := newReg()
+			phi := ir.Inst{Kind: ir.InstPhi, Dst: j, Args: make([]ir.Arg, 2)}
+			phi.Args[h.predIndex(l.preheader)] = j0
+			phi.Args[h.predIndex(l.latches[0])] = jNext
+			headerPhis = append(headerPhis, phi)
+			increments[r.iv.next] = append(increments[r.iv.next], ir.Inst{
+				Kind: ir.InstIadd,
+				Dst:  jNext,
+				Args: []ir.Arg{j, step},
+			})
+
+			*r.t = ir.Inst{Kind: ir.InstIload, Dst: r.t.Dst, Args: []ir.Arg{j}}
+			changes++
+		}
+		if len(headerPhis) == 0 {
+			continue
+		}
+
+		for _, b := range blocks {
+			if !l.blocks[b] {
+				continue
+			}
+			var code []ir.Inst
+			for _, inst := range b.code {
+				code = append(code, inst)
+				if inst.Dst.Kind == ir.ArgReg {
+					code = append(code, increments[inst.Dst.Value]...)
+				}
+			}
+			b.code = code
+		}
+		h.code = append(headerPhis, h.code...)
+	}
+
+	if changes != 0 {
+		m.Code = linearize(blocks)
+		m.Out.FrameSlots = int(nextReg)
+	}
+	return changes
+}
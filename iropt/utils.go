@@ -0,0 +1,79 @@
+package iropt
+
+import (
+	"math"
+
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+// constValue returns the int or long constant that arg evaluates to.
+// consts map the registers that are known to hold a constant.
+func constValue(arg ir.Arg, consts map[int64]ir.Arg) (ir.Arg, bool) {
+	switch arg.Kind {
+	case ir.ArgIntConst:
+		ok := arg.Type == ir.TypeInt || arg.Type == ir.TypeLong
+		return arg, ok
+	case ir.ArgReg:
+		c, ok := consts[arg.Value]
+		return c, ok
+	default:
+		return ir.Arg{}, false
+	}
+}
+
+// constMoves collects the registers that are assigned with
+// an int or long constant by a move instruction.
+// The code is expected to be in the SSA form.
+func constMoves(code []ir.Inst) map[int64]ir.Arg {
+	consts := make(map[int64]ir.Arg)
+	for _, inst := range code {
+		if inst.Kind != ir.InstIload && inst.Kind != ir.InstLload {
+			continue
+		}
+		if c, ok := constValue(inst.Args[0], nil); ok {
+			consts[inst.Dst.Value] = c
+		}
+	}
+	return consts
+}
+
+// canMoveConst reports whether constant c can be assigned
+// to a register with a move instruction.
+func canMoveConst(c ir.Arg) bool {
+	return c.Type == ir.TypeInt || (c.Type == ir.TypeLong && fits32bit(c.Value))
+}
+
+// constOperand reports whether the inst argument at index i
+// can be replaced with the constant c.
+//
+// Backends can't encode the constants at every operand position,
+// the accepted positions follow the forms that irgen produces.
+func constOperand(inst ir.Inst, i int, c ir.Arg) bool {
+	if !canMoveConst(c) {
+		return false
+	}
+	switch inst.Kind {
+	case ir.InstIload, ir.InstLload, ir.InstIret, ir.InstLret, ir.InstPhi:
+		return true
+	case ir.InstIadd, ir.InstIsub, ir.InstIdiv, ir.InstIntArrayGet:
+		return i == 1
+	case ir.InstIntArraySet:
+		return i != 0
+	case ir.InstIcmp, ir.InstLcmp:
+		// At most one of the compared values can be a constant.
+		return inst.Args[1-i].Kind == ir.ArgReg
+	case ir.InstCallStatic, ir.InstCallGo:
+		return i != 0
+	default:
+		return false
+	}
+}
+
+// sameArg reports whether a and b are the same register or constant.
+func sameArg(a, b ir.Arg) bool {
+	return a.Kind == b.Kind && a.Value == b.Value
+}
+
+func fits32bit(v int64) bool {
+	return v >= math.MinInt32 && v <= math.MaxInt32
+}
@@ -0,0 +1,179 @@
+package javap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/quasilyte/go-jdk/bytecode"
+	"github.com/quasilyte/go-jdk/irfmt"
+	"github.com/quasilyte/go-jdk/jclass"
+)
+
+// FprintDot writes the bytecode control flow graph of every c method
+// in the Graphviz DOT format.
+//
+// If stackMap is true, blocks that have a StackMapTable frame
+// are annotated by the frame operand stack depth.
+func FprintDot(w io.Writer, c *jclass.File, stackMap bool) {
+	p := printer{w: w, c: c}
+	for _, m := range c.Methods {
+		p.printMethodDot(m, stackMap)
+	}
+}
+
+// bytecodeBlock is a basic block of the bytecode: [start, end) pc range.
+type bytecodeBlock struct {
+	start int
+	end   int
+}
+
+func (p *printer) printMethodDot(m jclass.Method, stackMap bool) {
+	if m.AccessFlags.IsNative() {
+		return
+	}
+	sig := jclass.MethodDescriptor(m.Descriptor).SignatureString(m.Name)
+	codeAttr, err := m.Code()
+	if err != nil {
+		p.write("// %s: can't decode code: %v\n", sig, err)
+		return
+	}
+	if codeAttr == nil {
+		return
+	}
+	code := codeAttr.Code
+	blocks, err := splitBlocks(code)
+	if err != nil {
+		p.write("// %s: %v\n", sig, err)
+		return
+	}
+	var frames []jclass.StackMapFrame
+	if stackMap {
+		frameTab, ok := findAttr(p.c, codeAttr.Attrs, "StackMapTable").(jclass.StackMapTableAttribute)
+		if ok {
+			frames = frameTab.Frames
+		}
+	}
+
+	pc2block := make(map[int]int, len(blocks))
+	for i, b := range blocks {
+		pc2block[b.start] = i
+	}
+
+	p.write("digraph %s {\n", irfmt.DotQuote(m.Name+m.Descriptor))
+	p.write("  node [shape=box fontname=monospace];\n")
+	for id, b := range blocks {
+		header := fmt.Sprintf("b%d:", id)
+		for _, frame := range frames {
+			if int(frame.Offset) == b.start {
+				header = fmt.Sprintf("b%d: depth=%d", id, frame.StackDepth)
+				break
+			}
+		}
+		lines := []string{header}
+		lastPC := b.start
+		for pc := b.start; pc < b.end; pc += bytecode.InstWidth(code, pc) {
+			lines = append(lines, fmt.Sprintf("%3d %s", pc, bytecode.Op(code[pc])))
+			lastPC = pc
+		}
+		p.write("  b%d [label=%s];\n", id, irfmt.DotLabel(lines))
+
+		edge := func(target int, attrs string) {
+			p.write("  b%d -> b%d%s;\n", id, pc2block[target], attrs)
+		}
+		op := bytecode.Op(code[lastPC])
+		switch {
+		case isReturn(op):
+			continue
+		case op == bytecode.Goto || op == bytecode.Gotow:
+			edge(branchTarget(code, lastPC), "")
+			continue
+		case op == bytecode.Tableswitch || op == bytecode.Lookupswitch:
+			sw, _ := bytecode.DecodeSwitch(code, lastPC)
+			edge(lastPC+int(sw.Default), ` [label="default"]`)
+			for i, key := range sw.Keys {
+				edge(lastPC+int(sw.Offsets[i]), fmt.Sprintf(` [label="case %d"]`, key))
+			}
+			continue
+		case isCondBranch(op):
+			edge(branchTarget(code, lastPC), fmt.Sprintf(` [label=%q]`, op.String()))
+		}
+		if b.end < len(code) {
+			edge(b.end, " [style=dashed]")
+		}
+	}
+	p.write("}\n")
+}
+
+// splitBlocks splits the bytecode into basic blocks.
+func splitBlocks(code []byte) ([]bytecodeBlock, error) {
+	leaders := make([]bool, len(code)+1)
+	leaders[0] = true
+	for pc := 0; pc < len(code); {
+		op := bytecode.Op(code[pc])
+		width := bytecode.InstWidth(code, pc)
+		if width == 0 || pc+width > len(code) {
+			return nil, fmt.Errorf("pc=%d: can't decode %s", pc, op)
+		}
+		var targets []int
+		switch {
+		case op == bytecode.Goto || op == bytecode.Gotow || isCondBranch(op):
+			targets = append(targets, branchTarget(code, pc))
+		case op == bytecode.Tableswitch || op == bytecode.Lookupswitch:
+			sw, err := bytecode.DecodeSwitch(code, pc)
+			if err != nil {
+				return nil, fmt.Errorf("pc=%d: %v", pc, err)
+			}
+			targets = append(targets, pc+int(sw.Default))
+			for _, offset := range sw.Offsets {
+				targets = append(targets, pc+int(offset))
+			}
+		case !isReturn(op):
+			pc += width
+			continue
+		}
+		for _, target := range targets {
+			if target < 0 || target >= len(code) {
+				return nil, fmt.Errorf("pc=%d: branch target %d is out of range", pc, target)
+			}
+			leaders[target] = true
+		}
+		leaders[pc+width] = true
+		pc += width
+	}
+
+	var blocks []bytecodeBlock
+	for pc := 0; pc < len(code); {
+		if leaders[pc] && len(blocks) != 0 {
+			blocks[len(blocks)-1].end = pc
+		}
+		if leaders[pc] {
+			blocks = append(blocks, bytecodeBlock{start: pc})
+		}
+		pc += bytecode.InstWidth(code, pc)
+	}
+	if len(blocks) != 0 {
+		blocks[len(blocks)-1].end = len(code)
+	}
+	return blocks, nil
+}
+
+func isCondBranch(op bytecode.Op) bool {
+	switch {
+	case op >= bytecode.Ifeq && op <= bytecode.Ifacmpne:
+		return true
+	default:
+		return op == bytecode.Ifnull || op == bytecode.Ifnonnull
+	}
+}
+
+func isReturn(op bytecode.Op) bool {
+	return (op >= bytecode.Ireturn && op <= bytecode.Return) || op == bytecode.Athrow
+}
+
+func branchTarget(code []byte, pc int) int {
+	if bytecode.Op(code[pc]) == bytecode.Gotow {
+		return pc + int(int32(binary.BigEndian.Uint32(code[pc+1:])))
+	}
+	return pc + int(int16(binary.BigEndian.Uint16(code[pc+1:])))
+}
@@ -0,0 +1,37 @@
+package javap
+
+import (
+	"testing"
+
+	"github.com/quasilyte/go-jdk/bytecode"
+)
+
+func TestSplitBlocks(t *testing.T) {
+	code := []byte{
+		0: byte(bytecode.Iload0),
+		1: byte(bytecode.Ifeq), 0, 7, // goto 8
+		4: byte(bytecode.Iconst0),
+		5: byte(bytecode.Goto), 0, 4, // goto 9
+		8: byte(bytecode.Iload0),
+		9: byte(bytecode.Ireturn),
+	}
+
+	blocks, err := splitBlocks(code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []bytecodeBlock{{0, 4}, {4, 8}, {8, 9}, {9, 10}}
+	if len(blocks) != len(want) {
+		t.Fatalf("have %v, want %v", blocks, want)
+	}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Errorf("block %d: have %v, want %v", i, blocks[i], want[i])
+		}
+	}
+
+	code[3] = 100
+	if _, err := splitBlocks(code); err == nil || err.Error() != "pc=1: branch target 101 is out of range" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -49,7 +49,15 @@ func (p *printer) printMethod(m jclass.Method) {
 	}
 
 	p.write("  method %s:\n", sig)
-	codeAttr := findAttr(p.c, m.Attrs, "Code").(jclass.CodeAttribute)
+	codeAttr, err := m.Code()
+	if err != nil {
+		p.write("    can't decode code: %v\n\n", err)
+		return
+	}
+	if codeAttr == nil {
+		p.write("    no code\n\n")
+		return
+	}
 	p.write("    max_locals=%d max_stack=%d\n",
 		codeAttr.MaxLocals, codeAttr.MaxStack)
 	p.write("    bytecode (size=%d):\n", len(codeAttr.Code))
@@ -81,10 +89,6 @@ func findAttr(c *jclass.File, attrs []jclass.Attribute, name string) jclass.Attr
 			if name == "StackMapTable" {
 				return attr
 			}
-		case jclass.CodeAttribute:
-			if name == "Code" {
-				return attr
-			}
 		case jclass.RawAttribute:
 			attrName := c.Consts[attr.NameIndex].(*jclass.Utf8Const).Value
 			if name == attrName {
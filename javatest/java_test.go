@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/quasilyte/go-jdk/irgen"
+	"github.com/quasilyte/go-jdk/iropt"
 	"github.com/quasilyte/go-jdk/jit"
 	"github.com/quasilyte/go-jdk/jruntime"
 	"github.com/quasilyte/go-jdk/loader"
@@ -36,6 +37,9 @@ var tests = []*testParams{
 	{Pkg: "bubblesort"},
 	{Pkg: "arrayreverse"},
 	{Pkg: "eratosthenes", Input: 30},
+	{Pkg: "switch1"},
+	{Pkg: "branches1"},
+	{Pkg: "stackops1"},
 }
 
 func TestMain(m *testing.M) {
@@ -281,9 +285,12 @@ func loadAndCompilePackage(vm *jruntime.VM, pkg string) (*vmdat.Package, error)
 		return nil, fmt.Errorf("load %s: %v", pkg, err)
 	}
 
-	if err := irgen.Generate(&vm.State, packages); err != nil {
+	if err := irgen.Generate(&vm.State, packages, &irgen.Config{Debug: true}); err != nil {
 		return nil, fmt.Errorf("irgen: %v", err)
 	}
+	if _, err := iropt.Optimize(&vm.State, packages, &iropt.Config{Debug: true}); err != nil {
+		return nil, fmt.Errorf("iropt: %v", err)
+	}
 
 	ctx := jit.Context{
 		Mmap:  &vm.Mmap,
@@ -0,0 +1,59 @@
+package branches1;
+
+import testutil.T;
+
+public class Test {
+    public static void run(int x) {
+        for (int i = -2; i <= 2; i++) {
+            for (int j = -2; j <= 2; j++) {
+                T.printInt(intCmp(i, j));
+                T.printInt(longCmp((long)i, (long)j));
+            }
+            T.printInt(intCmpZero(i));
+        }
+        int[] arr = new int[1];
+        T.printInt(refCmp(arr));
+    }
+
+    public static int intCmp(int a, int b) {
+        int r = 0;
+        if (a == b) r += 1;
+        if (a != b) r += 2;
+        if (a < b) r += 4;
+        if (a <= b) r += 8;
+        if (a > b) r += 16;
+        if (a >= b) r += 32;
+        return r;
+    }
+
+    public static int longCmp(long a, long b) {
+        int r = 0;
+        if (a == b) r += 1;
+        if (a != b) r += 2;
+        if (a < b) r += 4;
+        if (a <= b) r += 8;
+        if (a > b) r += 16;
+        if (a >= b) r += 32;
+        return r;
+    }
+
+    public static int intCmpZero(int a) {
+        int r = 0;
+        if (a == 0) r += 1;
+        if (a != 0) r += 2;
+        if (a < 0) r += 4;
+        if (a <= 0) r += 8;
+        if (a > 0) r += 16;
+        if (a >= 0) r += 32;
+        return r;
+    }
+
+    public static int refCmp(int[] a) {
+        int r = 0;
+        if (a == null) r += 1;
+        if (a != null) r += 2;
+        if (a == a) r += 4;
+        if (a != a) r += 8;
+        return r;
+    }
+}
@@ -0,0 +1,53 @@
+package stackops1;
+
+import testutil.T;
+
+public class Test {
+    public static void run(int x) {
+        int[] arr = new int[3];
+        for (int i = 0; i < 5; i++) {
+            arrayInc(arr, i % 3);
+        }
+        T.printIntArray(arr);
+        T.printInt(storeExpr(arr, 1, 10));
+        T.printIntArray(arr);
+        T.printLong(chainAssign(4L));
+        T.printLong(chainAssign(-1L));
+        T.printInt(discard(7));
+        T.printInt(postInc(arr, 2));
+        T.printIntArray(arr);
+    }
+
+    public static void arrayInc(int[] arr, int i) {
+        arr[i]++;
+    }
+
+    public static int storeExpr(int[] arr, int i, int v) {
+        return arr[i] = v;
+    }
+
+    public static long chainAssign(long x) {
+        long a;
+        long b;
+        a = b = x + 1;
+        return a + b;
+    }
+
+    public static int discard(int x) {
+        intValue(x);
+        longValue(x);
+        return x;
+    }
+
+    public static int postInc(int[] arr, int i) {
+        return arr[i]++ + arr[i];
+    }
+
+    public static int intValue(int x) {
+        return x + 1;
+    }
+
+    public static long longValue(int x) {
+        return (long)x;
+    }
+}
@@ -0,0 +1,48 @@
+package switch1;
+
+import testutil.T;
+
+public class Test {
+    public static void run(int x) {
+        for (int i = -2; i < 8; i++) {
+            T.printInt(dense(i));
+            T.printInt(sparse(i - 3));
+        }
+        T.printInt(sparse(1000));
+        T.printInt(sparse(7000));
+    }
+
+    public static int dense(int x) {
+        switch (x) {
+        case 0:
+            return 10;
+        case 1:
+            return 11;
+        case 2:
+            return 12;
+        case 3:
+            return 13;
+        case 5:
+            return 15;
+        default:
+            return -1;
+        }
+    }
+
+    public static int sparse(int x) {
+        switch (x) {
+        case -3:
+            return 1;
+        case 1:
+            return 2;
+        case 4:
+            return 3;
+        case 1000:
+            return 4;
+        case 7000:
+            return 5;
+        default:
+            return 0;
+        }
+    }
+}
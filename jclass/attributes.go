@@ -1,5 +1,10 @@
 package jclass
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 type Attribute interface {
 	attribute()
 }
@@ -21,8 +26,57 @@ type (
 	StackMapTableAttribute struct {
 		Frames []StackMapFrame
 	}
+
+	// LazyCodeAttribute is a Code attribute which decoding is postponed.
+	// It's produced by a Decoder with LazyCode option set.
+	//
+	// Copies of the attribute share the decoding result,
+	// so the code is decoded only once.
+	LazyCodeAttribute struct {
+		*lazyCode
+	}
 )
 
+type lazyCode struct {
+	data   []byte
+	file   *File
+	offset int64
+	path   []pathElem
+
+	once    sync.Once
+	decoded uint32
+	code    CodeAttribute
+	err     error
+}
+
 func (RawAttribute) attribute()           {}
 func (CodeAttribute) attribute()          {}
 func (StackMapTableAttribute) attribute() {}
+func (LazyCodeAttribute) attribute()      {}
+
+// Decode returns the decoded Code attribute.
+// It's safe to call Decode concurrently.
+func (a LazyCodeAttribute) Decode() (CodeAttribute, error) {
+	code, err := a.decode()
+	if err != nil {
+		return CodeAttribute{}, err
+	}
+	return *code, nil
+}
+
+// IsDecoded reports whether the attribute contents were already decoded.
+func (a LazyCodeAttribute) IsDecoded() bool {
+	return atomic.LoadUint32(&a.decoded) != 0
+}
+
+func (a LazyCodeAttribute) decode() (*CodeAttribute, error) {
+	a.once.Do(func() {
+		a.code, a.err = decodeLazyCode(a.lazyCode)
+		a.data = nil // Not needed anymore
+		atomic.StoreUint32(&a.decoded, 1)
+	})
+	if a.err != nil {
+		return nil, a.err
+	}
+	return &a.code, nil
+}
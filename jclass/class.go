@@ -7,6 +7,23 @@ type Method struct {
 	Attrs       []Attribute
 }
 
+// Code returns the method Code attribute.
+// Methods without the code, like native or abstract methods, return nil.
+//
+// If the code was decoded lazily, it's decoded during the first call.
+// The result is shared by all calls. It's safe to call Code concurrently.
+func (m *Method) Code() (*CodeAttribute, error) {
+	for _, attr := range m.Attrs {
+		switch attr := attr.(type) {
+		case CodeAttribute:
+			return &attr, nil
+		case LazyCodeAttribute:
+			return attr.decode()
+		}
+	}
+	return nil, nil
+}
+
 type Field struct {
 	AccessFlags FieldAccessFlags
 	Name        string
@@ -41,4 +58,16 @@ type ExceptionHandler struct {
 type StackMapFrame struct {
 	Offset     uint32
 	StackDepth uint16
+
+	Kind FrameKind
+
+	// Locals are the added locals for the AppendFrame
+	// and all locals for the FullFrame.
+	Locals []VerificationType
+
+	// Stack is a list of the operand stack items.
+	Stack []VerificationType
+
+	// Chop is a number of removed locals for the ChopFrame.
+	Chop int
 }
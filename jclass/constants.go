@@ -29,6 +29,10 @@ type (
 		Value float64
 	}
 
+	StringConst struct {
+		Value string
+	}
+
 	FieldrefConst struct {
 		ClassName  string
 		Name       string
@@ -52,6 +56,7 @@ func (*IntConst) constant()         {}
 func (*LongConst) constant()        {}
 func (*FloatConst) constant()       {}
 func (*DoubleConst) constant()      {}
+func (*StringConst) constant()      {}
 func (*ClassConst) constant()       {}
 func (*FieldrefConst) constant()    {}
 func (*MethodrefConst) constant()   {}
@@ -2,70 +2,152 @@ package jclass
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"strconv"
+	"strings"
 )
 
+// Decoder reads class files.
+//
+// Malformed inputs are reported as *DecodeError.
+// The decoder never trusts encoded lengths when allocating memory
+// for variable-length data: allocations are bounded by the actual
+// input size.
 type Decoder struct {
-	r *bufio.Reader
-	f *File
+	// AllowPreview permits class files that depend on the
+	// Java SE preview features (minor version 65535).
+	AllowPreview bool
 
-	deferred struct {
-		names        map[*string]uint16
-		names2       map[*string]uint16
-		descriptors  map[*string]uint16
-		descriptors2 map[*string]uint16
-		classNames   map[*string]uint16
-	}
+	// LazyCode makes the decoder store method Code attributes
+	// as LazyCodeAttribute that are decoded on the first access.
+	// See Method.Code.
+	LazyCode bool
+
+	r      byteReader
+	f      *File
+	offset int64
+	path   []pathElem
+
+	// limit is an end offset of the attribute being decoded.
+	// Zero value means that there is no enclosing attribute.
+	limit int64
+
+	// inMethod is set while method_info attributes are decoded.
+	// Code attribute is not permitted anywhere else.
+	inMethod bool
+
+	deferred []deferredRef
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
 }
 
+// pathElem is a single structure path element.
+// If name is empty, it's an index element like "[10]".
+type pathElem struct {
+	name  string
+	index int
+}
+
+// deferredRef is a constant pool reference that can't be resolved
+// until the whole constant pool is decoded.
+type deferredRef struct {
+	dst        *string
+	kind       refKind
+	index      uint16
+	constIndex int
+	field      string
+	offset     int64
+}
+
+type refKind int
+
+const (
+	refUtf8 refKind = iota
+	refClassName
+	refNameAndTypeName
+	refNameAndTypeDescriptor
+)
+
+// maxCodeLength is a code_length limit imposed by the JVM specification.
+const maxCodeLength = 65535
+
 func (d *Decoder) Decode(r io.Reader) (*File, error) {
 	d.r = bufio.NewReader(r)
 	d.f = &File{}
-	d.deferred.names = map[*string]uint16{}
-	d.deferred.names2 = map[*string]uint16{}
-	d.deferred.descriptors = map[*string]uint16{}
-	d.deferred.descriptors2 = map[*string]uint16{}
-	d.deferred.classNames = map[*string]uint16{}
+	d.offset = 0
+	d.path = d.path[:0]
+	d.deferred = d.deferred[:0]
 	err := d.decode()
 	return d.f, err
 }
 
-func (d *Decoder) resolveDeferred() {
-	for s, index := range d.deferred.names {
-		*s = d.f.Consts[index].(*Utf8Const).Value
-	}
-	for s, index := range d.deferred.names2 {
-		*s = d.f.Consts[index].(*NameAndTypeConst).Name
-	}
-	for s, index := range d.deferred.descriptors {
-		*s = d.f.Consts[index].(*Utf8Const).Value
-	}
-	for s, index := range d.deferred.descriptors2 {
-		*s = d.f.Consts[index].(*NameAndTypeConst).Descriptor
+func (d *Decoder) resolveDeferred() error {
+	// Names and descriptors are resolved first as other
+	// references depend on the ClassConst and NameAndTypeConst values.
+	for _, ref := range d.deferred {
+		if ref.kind == refUtf8 {
+			if err := d.resolveRef(ref); err != nil {
+				return err
+			}
+		}
 	}
-	for s, index := range d.deferred.classNames {
-		*s = d.f.Consts[index].(*ClassConst).Name
+	for _, ref := range d.deferred {
+		if ref.kind != refUtf8 {
+			if err := d.resolveRef(ref); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
 }
 
-func (d *Decoder) deferNameResolving(index uint16, s *string) {
-	d.deferred.names[s] = index
-}
-
-func (d *Decoder) deferClassNameResolving(index uint16, s *string) {
-	d.deferred.classNames[s] = index
-}
-
-func (d *Decoder) deferDescriptorResolving(index uint16, desc *string) {
-	d.deferred.descriptors[desc] = index
+func (d *Decoder) resolveRef(ref deferredRef) error {
+	var err error
+	switch ref.kind {
+	case refUtf8:
+		*ref.dst, err = d.utf8At(ref.index)
+	case refClassName:
+		var c *ClassConst
+		c, err = d.classAt(ref.index)
+		if err == nil {
+			*ref.dst = c.Name
+		}
+	case refNameAndTypeName, refNameAndTypeDescriptor:
+		var c *NameAndTypeConst
+		c, err = d.nameAndTypeAt(ref.index)
+		if err == nil && ref.kind == refNameAndTypeName {
+			*ref.dst = c.Name
+		} else if err == nil {
+			*ref.dst = c.Descriptor
+		}
+	}
+	if err != nil {
+		return &DecodeError{
+			Offset: ref.offset,
+			Path:   fmt.Sprintf("constant_pool[%d].%s", ref.constIndex, ref.field),
+			Err:    err,
+		}
+	}
+	return nil
 }
 
-func (d *Decoder) deferNameAndTypeResolving(index uint16, name, desc *string) {
-	d.deferred.names2[name] = index
-	d.deferred.descriptors2[desc] = index
+func (d *Decoder) deferRef(constIndex int, field string, offset int64, index uint16, kind refKind, dst *string) {
+	d.deferred = append(d.deferred, deferredRef{
+		dst:        dst,
+		kind:       kind,
+		index:      index,
+		constIndex: constIndex,
+		field:      field,
+		offset:     offset,
+	})
 }
 
 func (d *Decoder) decode() error {
@@ -75,25 +157,28 @@ func (d *Decoder) decode() error {
 	}{
 		{"magic", d.decodeMagic},
 		{"version", d.decodeVersion},
-		{"constant pool", d.decodeConstantPool},
-		{"access flags", d.decodeClassAccessFlags},
-		{"this class", d.decodeClassName},
-		{"super class", d.makeUint16Decode(&d.f.SuperClass)},
+		{"constant_pool", d.decodeConstantPool},
+		{"access_flags", d.decodeClassAccessFlags},
+		{"this_class", d.decodeClassName},
+		{"super_class", d.decodeSuperClass},
 		{"interfaces", d.decodeInterfaces},
 		{"fields", d.decodeFields},
 		{"methods", d.decodeMethods},
 		{"attributes", d.decodeAttributes},
 	}
 	for _, step := range steps {
-		if err := step.fn(); err != nil {
-			return fmt.Errorf("decode %s: %w", step.name, err)
+		d.enter(step.name)
+		err := step.fn()
+		d.leave()
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
 func (d *Decoder) decodeClassAccessFlags() error {
-	v, err := d.readUint16()
+	v, err := d.readUint16("")
 	if err != nil {
 		return err
 	}
@@ -102,117 +187,163 @@ func (d *Decoder) decodeClassAccessFlags() error {
 }
 
 func (d *Decoder) decodeClassName() error {
-	v, err := d.readUint16()
+	c, err := d.readClassRef("")
 	if err != nil {
 		return err
 	}
-	d.f.ThisClassName = d.f.Consts[v].(*ClassConst).Name
+	d.f.ThisClassName = c.Name
+	return nil
+}
+
+func (d *Decoder) decodeSuperClass() error {
+	offset := d.offset
+	v, err := d.readUint16("")
+	if err != nil {
+		return err
+	}
+	// Zero index is permitted for java/lang/Object only,
+	// but we don't enforce that here.
+	if v != 0 {
+		if _, err := d.classAt(v); err != nil {
+			return d.errorAt(offset, "", err)
+		}
+	}
+	d.f.SuperClass = v
 	return nil
 }
 
 func (d *Decoder) decodeMagic() error {
-	magic, err := d.readUint32()
+	offset := d.offset
+	magic, err := d.readUint32("")
 	if err != nil {
 		return err
 	}
 	if magic != 0xCAFEBABE {
-		return fmt.Errorf("invalid value (want 0xCAFEBABE, got 0x%X)", magic)
+		return d.errorAt(offset, "", fmt.Errorf("invalid value (want 0xCAFEBABE, got 0x%X)", magic))
 	}
 	return nil
 }
 
 func (d *Decoder) decodeVersion() error {
-	minor, err := d.readUint16()
+	offset := d.offset
+	minor, err := d.readUint16("minor")
 	if err != nil {
-		return fmt.Errorf("read minor: %w", err)
+		return err
 	}
-	major, err := d.readUint16()
+	major, err := d.readUint16("major")
 	if err != nil {
-		return fmt.Errorf("read major: %w", err)
+		return err
 	}
 	d.f.Ver.Minor = minor
 	d.f.Ver.Major = major
+	if err := d.checkVersion(d.f.Ver); err != nil {
+		return d.errorAt(offset, "", err)
+	}
 	return nil
 }
 
 func (d *Decoder) decodeConstantPool() error {
-	n, err := d.readUint16()
+	n, err := d.readUint16("count")
 	if err != nil {
-		return fmt.Errorf("read count: %w", err)
+		return err
+	}
+	cp := make([]Const, 0, preallocCount(int(n)))
+	if n != 0 {
+		cp = append(cp, nil) // Constant at 0 index is undefined
 	}
-	cp := make([]Const, n)
-	i := 1 // Constant at 0 index is undefined
-	for i < len(cp) {
-		c, skip, err := d.readConst()
+	for len(cp) < int(n) {
+		i := len(cp)
+		d.enterIndex(i)
+		offset := d.offset
+		c, skip, err := d.readConst(i)
+		if err == nil && i+skip > int(n) {
+			err = d.errorAt(offset, "", errors.New("8-byte constant occupies the last pool entry"))
+		}
+		d.leave()
 		if err != nil {
-			return fmt.Errorf("const%d: %w", i, err)
+			return err
+		}
+		cp = append(cp, c)
+		if skip == 2 {
+			cp = append(cp, nil)
 		}
-		cp[i] = c
-		i += skip
 	}
 	d.f.Consts = cp
-	d.resolveDeferred()
-	return nil
+	return d.resolveDeferred()
 }
 
 func (d *Decoder) decodeInterfaces() error {
-	n, err := d.readUint16()
+	n, err := d.readUint16("count")
 	if err != nil {
-		return fmt.Errorf("read count: %w", err)
+		return err
 	}
-	ifaces := make([]uint16, n)
-	for i := range ifaces {
-		index, err := d.readUint16()
+	ifaces := make([]uint16, 0, preallocCount(int(n)))
+	for i := 0; i < int(n); i++ {
+		d.enterIndex(i)
+		offset := d.offset
+		index, err := d.readUint16("")
+		if err == nil {
+			if _, err2 := d.classAt(index); err2 != nil {
+				err = d.errorAt(offset, "", err2)
+			}
+		}
+		d.leave()
 		if err != nil {
-			return fmt.Errorf("interface%d: %w", i, err)
+			return err
 		}
-		ifaces[i] = index
+		ifaces = append(ifaces, index)
 	}
 	d.f.Interfaces = ifaces
 	return nil
 }
 
 func (d *Decoder) decodeFields() error {
-	n, err := d.readUint16()
+	n, err := d.readUint16("count")
 	if err != nil {
-		return fmt.Errorf("read count: %w", err)
+		return err
 	}
-	fields := make([]Field, n)
-	for i := range fields {
+	fields := make([]Field, 0, preallocCount(int(n)))
+	for i := 0; i < int(n); i++ {
+		d.enterIndex(i)
 		field, err := d.readField()
+		d.leave()
 		if err != nil {
-			return fmt.Errorf("field%d: %w", i, err)
+			return err
 		}
-		fields[i] = field
+		fields = append(fields, field)
 	}
 	d.f.Fields = fields
 	return nil
 }
 
 func (d *Decoder) decodeMethods() error {
-	n, err := d.readUint16()
+	n, err := d.readUint16("count")
 	if err != nil {
-		return fmt.Errorf("read count: %w", err)
+		return err
 	}
-	methods := make([]Method, n)
-	for i := range methods {
+	methods := make([]Method, 0, preallocCount(int(n)))
+	for i := 0; i < int(n); i++ {
+		d.enterIndex(i)
+		d.inMethod = true
 		field, err := d.readField()
+		d.inMethod = false
+		d.leave()
 		if err != nil {
-			return fmt.Errorf("method%d: %w", i, err)
+			return err
 		}
-		methods[i] = Method{
+		methods = append(methods, Method{
 			AccessFlags: MethodAccessFlags(field.AccessFlags),
 			Name:        field.Name,
 			Descriptor:  field.Descriptor,
 			Attrs:       field.Attrs,
-		}
+		})
 	}
 	d.f.Methods = methods
 	return nil
 }
 
 func (d *Decoder) decodeAttributes() error {
-	attrs, err := d.readAttributes()
+	attrs, err := d.readAttributeList()
 	if err != nil {
 		return err
 	}
@@ -220,34 +351,30 @@ func (d *Decoder) decodeAttributes() error {
 	return nil
 }
 
-func (d *Decoder) makeUint16Decode(dst *uint16) func() error {
-	return func() error {
-		v, err := d.readUint16()
-		if err != nil {
-			return err
-		}
-		*dst = v
-		return nil
-	}
-}
-
 func (d *Decoder) readExceptionHandler() (ExceptionHandler, error) {
 	var h ExceptionHandler
-	startPC, err := d.readUint16()
+	startPC, err := d.readUint16("start_pc")
 	if err != nil {
-		return h, fmt.Errorf("read start_pc: %w", err)
+		return h, err
 	}
-	endPC, err := d.readUint16()
+	endPC, err := d.readUint16("end_pc")
 	if err != nil {
-		return h, fmt.Errorf("read end_pc: %w", err)
+		return h, err
 	}
-	handlerPC, err := d.readUint16()
+	handlerPC, err := d.readUint16("handler_pc")
 	if err != nil {
-		return h, fmt.Errorf("read handler_pc: %w", err)
+		return h, err
 	}
-	catchType, err := d.readUint16()
+	offset := d.offset
+	catchType, err := d.readUint16("catch_type")
 	if err != nil {
-		return h, fmt.Errorf("read catch_type: %w", err)
+		return h, err
+	}
+	// Zero catch_type is used for "finally" blocks.
+	if catchType != 0 {
+		if _, err := d.classAt(catchType); err != nil {
+			return h, d.errorAt(offset, "catch_type", err)
+		}
 	}
 	h.StartPC = startPC
 	h.EndPC = endPC
@@ -256,210 +383,326 @@ func (d *Decoder) readExceptionHandler() (ExceptionHandler, error) {
 	return h, nil
 }
 
+// readAttributes reads attributes_count followed by the attributes array
+// that is reported as a "attributes" path element.
 func (d *Decoder) readAttributes() ([]Attribute, error) {
-	n, err := d.readUint16()
+	d.enter("attributes")
+	attrs, err := d.readAttributeList()
+	d.leave()
+	return attrs, err
+}
+
+func (d *Decoder) readAttributeList() ([]Attribute, error) {
+	// Attribute name index and length occupy 6 bytes.
+	n, err := d.readCount("count", 6)
 	if err != nil {
-		return nil, fmt.Errorf("read attrs count: %w", err)
+		return nil, err
 	}
-	attrs := make([]Attribute, n)
-	for i := range attrs {
+	attrs := make([]Attribute, 0, preallocCount(n))
+	for i := 0; i < n; i++ {
+		d.enterIndex(i)
 		attr, err := d.readAttr()
+		d.leave()
 		if err != nil {
-			return nil, fmt.Errorf("attr%d: %w", i, err)
+			return nil, err
 		}
-		attrs[i] = attr
+		attrs = append(attrs, attr)
 	}
 	return attrs, nil
 }
 
 func (d *Decoder) readAttr() (Attribute, error) {
-	nameIndex, err := d.readUint16()
+	nameOffset := d.offset
+	nameIndex, err := d.readUint16("attribute_name_index")
 	if err != nil {
-		return nil, fmt.Errorf("read name_index: %w", err)
+		return nil, err
+	}
+	name, err := d.utf8At(nameIndex)
+	if err != nil {
+		return nil, d.errorAt(nameOffset, "attribute_name_index", err)
 	}
 
-	length, err := d.readUint32()
+	length, err := d.readUint32("attribute_length")
 	if err != nil {
-		return nil, fmt.Errorf("read attribute_length: %w", err)
+		return nil, err
 	}
 
-	var attr Attribute
-	switch d.f.Consts[nameIndex].(*Utf8Const).Value {
-	case "Code":
-		maxStack, err := d.readUint16()
-		if err != nil {
-			return nil, fmt.Errorf("read max_stack: %w", err)
-		}
-		maxLocals, err := d.readUint16()
-		if err != nil {
-			return nil, fmt.Errorf("read max_locals: %w", err)
-		}
-		code, err := d.readByteSlice32()
-		if err != nil {
-			return nil, fmt.Errorf("read code: %w", err)
-		}
-		handlersCount, err := d.readUint16()
-		if err != nil {
-			return nil, fmt.Errorf("read exception_table_length: %v", err)
-		}
-		handlers := make([]ExceptionHandler, handlersCount)
-		for i := range handlers {
-			h, err := d.readExceptionHandler()
-			if err != nil {
-				return nil, fmt.Errorf("handler%d: %w", i, err)
-			}
-			handlers[i] = h
-		}
-		attrs, err := d.readAttributes()
-		if err != nil {
-			return nil, fmt.Errorf("read attributes: %w", err)
-		}
-		attr = CodeAttribute{
-			MaxStack:       maxStack,
-			MaxLocals:      maxLocals,
-			Code:           code,
-			ExceptionTable: handlers,
-			Attrs:          attrs,
-		}
+	start := d.offset
+	if name == "Code" && !d.inMethod {
+		return nil, d.errorAt(nameOffset, "attribute_name_index",
+			errors.New("Code attribute outside of method_info"))
+	}
+	// Nested attributes can't be bigger than the enclosing one
+	// and they never belong to the method.
+	limit, inMethod := d.limit, d.inMethod
+	d.limit = start + int64(length)
+	if limit != 0 && limit < d.limit {
+		d.limit = limit
+	}
+	d.inMethod = false
+	defer func() {
+		d.limit, d.inMethod = limit, inMethod
+	}()
 
-	case "StackMapTable":
-		frames, err := d.readStackMapFrames()
-		if err != nil {
-			return nil, fmt.Errorf("read stack map frames: %v", err)
+	var attr Attribute
+	switch {
+	case name == "Code" && d.LazyCode:
+		lazy := &lazyCode{
+			file:   d.f,
+			offset: start,
+			path:   append([]pathElem(nil), d.path...),
 		}
+		lazy.data, err = d.readBytes("info", length)
+		attr = LazyCodeAttribute{lazy}
+	case name == "Code":
+		attr, err = d.readCodeAttr()
+	case name == "StackMapTable" && d.f.Ver.HasStackMapTable():
+		// Older class files may contain this attribute too,
+		// but it must be ignored, so it's decoded as a raw attribute.
+		var frames []StackMapFrame
+		frames, err = d.readStackMapFrames()
 		attr = StackMapTableAttribute{Frames: frames}
-
 	default:
-		buf := make([]byte, length)
-		_, err = io.ReadFull(d.r, buf)
-		if err != nil {
-			return nil, fmt.Errorf("read info: %w", err)
-		}
+		var buf []byte
+		buf, err = d.readBytes("info", length)
 		attr = RawAttribute{
 			NameIndex: nameIndex,
 			Data:      buf,
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.checkAttrLength(name, start, length); err != nil {
+		return nil, err
+	}
 
 	return attr, nil
 }
 
-func (d *Decoder) skipVerificationTypes(n int) error {
-	// We could use verification info at some point in future.
-	// Right now we skip it completely.
-	const (
-		itemTop               = 0
-		itemInteger           = 1
-		itemFloat             = 2
-		itemDouble            = 3
-		itemLong              = 4
-		itemNull              = 5
-		itemUninitializedThis = 6
-		itemObject            = 7
-		itemUninitialized     = 8
-	)
+func (d *Decoder) checkAttrLength(name string, start int64, length uint32) error {
+	if decoded := d.offset - start; decoded != int64(length) {
+		return d.errorAt(start, "", fmt.Errorf("%s attribute_length is %d, but %d bytes were decoded",
+			name, length, decoded))
+	}
+	return nil
+}
+
+// decodeLazyCode decodes the Code attribute contents that were
+// skipped during the class file decoding.
+func decodeLazyCode(a *lazyCode) (CodeAttribute, error) {
+	d := Decoder{
+		r:      bytes.NewReader(a.data),
+		f:      a.file,
+		offset: a.offset,
+		path:   a.path,
+		limit:  a.offset + int64(len(a.data)),
+	}
+	attr, err := d.readCodeAttr()
+	if err != nil {
+		return CodeAttribute{}, err
+	}
+	if err := d.checkAttrLength("Code", a.offset, uint32(len(a.data))); err != nil {
+		return CodeAttribute{}, err
+	}
+	return attr.(CodeAttribute), nil
+}
+
+func (d *Decoder) readCodeAttr() (Attribute, error) {
+	maxStack, err := d.readUint16("max_stack")
+	if err != nil {
+		return nil, err
+	}
+	maxLocals, err := d.readUint16("max_locals")
+	if err != nil {
+		return nil, err
+	}
+	lengthOffset := d.offset
+	codeLength, err := d.readUint32("code_length")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case codeLength == 0:
+		return nil, d.errorAt(lengthOffset, "code_length", errors.New("code can't be empty"))
+	case codeLength > maxCodeLength:
+		return nil, d.errorAt(lengthOffset, "code_length", &LengthError{Length: codeLength, Max: maxCodeLength})
+	}
+	code, err := d.readBytes("code", codeLength)
+	if err != nil {
+		return nil, err
+	}
+	handlersCount, err := d.readCount("exception_table_length", 8)
+	if err != nil {
+		return nil, err
+	}
+	handlers := make([]ExceptionHandler, 0, preallocCount(handlersCount))
+	d.enter("exception_table")
+	for i := 0; i < handlersCount; i++ {
+		d.enterIndex(i)
+		h, err := d.readExceptionHandler()
+		d.leave()
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, h)
+	}
+	d.leave()
+	attrs, err := d.readAttributes()
+	if err != nil {
+		return nil, err
+	}
+	return CodeAttribute{
+		MaxStack:       maxStack,
+		MaxLocals:      maxLocals,
+		Code:           code,
+		ExceptionTable: handlers,
+		Attrs:          attrs,
+	}, nil
+}
 
+func (d *Decoder) readVerificationTypes(field string, n int) ([]VerificationType, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	d.enter(field)
+	defer d.leave()
+	types := make([]VerificationType, 0, preallocCount(n))
 	for i := 0; i < n; i++ {
-		tag, err := d.r.ReadByte()
+		d.enterIndex(i)
+		offset := d.offset
+		tag, err := d.readUint8("tag")
 		if err != nil {
-			return fmt.Errorf("verification_type_info%d: read tag: %v", i, err)
+			return nil, err
 		}
-		switch tag {
-		case itemUninitialized, itemObject:
-			_, err = d.r.Discard(2)
+		var typ VerificationType
+		typ.Tag = VerificationTag(tag)
+		switch typ.Tag {
+		case VerifObject:
+			class, err := d.readClassRef("cpool_index")
 			if err != nil {
-				return fmt.Errorf("verification_type_info%d: tag=%d: %v", i, tag, err)
+				return nil, err
 			}
+			typ.ClassName = class.Name
+		case VerifUninitialized:
+			typ.Offset, err = d.readUint16("offset")
+			if err != nil {
+				return nil, err
+			}
+		case VerifTop, VerifInteger, VerifFloat, VerifDouble, VerifLong, VerifNull, VerifUninitializedThis:
+			// No additional info.
+		default:
+			return nil, d.errorAt(offset, "tag", fmt.Errorf("unexpected verification type tag: %d", tag))
 		}
+		types = append(types, typ)
+		d.leave()
 	}
-
-	return nil
+	return types, nil
 }
 
 func (d *Decoder) readStackMapFrames() ([]StackMapFrame, error) {
-	framesCount, err := d.readUint16()
+	framesCount, err := d.readCount("number_of_entries", 1)
 	if err != nil {
-		return nil, fmt.Errorf("read number_of_entries: %v", err)
+		return nil, err
 	}
-	frames := make([]StackMapFrame, framesCount)
+	frames := make([]StackMapFrame, 0, preallocCount(framesCount))
+	d.enter("entries")
+	defer d.leave()
 	offset := uint32(0)
-	for i := range frames {
-		tag, err := d.r.ReadByte()
+	for i := 0; i < framesCount; i++ {
+		d.enterIndex(i)
+		frameOffset := d.offset
+		tag, err := d.readUint8("frame_type")
 		if err != nil {
-			return nil, fmt.Errorf("frame%d: read type: %v", i, err)
+			return nil, err
 		}
 
-		depth := uint16(0)
+		var frame StackMapFrame
 		switch {
 		case tag <= 63: // 0-63 same_frame
+			frame.Kind = SameFrame
 			offset += uint32(tag)
 		case tag <= 127: // 64-127 same_locals_1_stack_item_frame
+			frame.Kind = SameLocals1StackItemFrame
 			offset += uint32(tag - 64)
-			if err := d.skipVerificationTypes(1); err != nil {
-				return nil, fmt.Errorf("same_locals_1_stack_item_frame: %v", err)
+			frame.Stack, err = d.readVerificationTypes("stack", 1)
+			if err != nil {
+				return nil, err
 			}
-			depth = 1
 		case tag == 247: // same_locals_1_stack_item_frame_extended
-			delta, err := d.readUint16()
+			frame.Kind = SameLocals1StackItemFrame
+			delta, err := d.readUint16("offset_delta")
 			if err != nil {
-				return nil, fmt.Errorf("same_locals_1_stack_item_frame_extended: %v", err)
+				return nil, err
 			}
 			offset += uint32(delta)
-			depth = 1
+			frame.Stack, err = d.readVerificationTypes("stack", 1)
+			if err != nil {
+				return nil, err
+			}
 		case tag >= 248 && tag <= 250: // 248-250 chop_frame
-			delta, err := d.readUint16()
+			frame.Kind = ChopFrame
+			frame.Chop = int(251 - tag)
+			delta, err := d.readUint16("offset_delta")
 			if err != nil {
-				return nil, fmt.Errorf("chop_frame: %v", err)
+				return nil, err
 			}
 			offset += uint32(delta)
 		case tag == 251: // same_frame_extended
-			delta, err := d.readUint16()
+			frame.Kind = SameFrame
+			delta, err := d.readUint16("offset_delta")
 			if err != nil {
-				return nil, fmt.Errorf("same_frame_extended: %v", err)
+				return nil, err
 			}
 			offset += uint32(delta)
 		case tag >= 252 && tag <= 254: // 252-254 append_frame
-			delta, err := d.readUint16()
+			frame.Kind = AppendFrame
+			delta, err := d.readUint16("offset_delta")
 			if err != nil {
-				return nil, fmt.Errorf("append_frame: %v", err)
+				return nil, err
 			}
 			offset += uint32(delta)
 			localsNum := int(tag - 251)
-			if err := d.skipVerificationTypes(localsNum); err != nil {
-				return nil, fmt.Errorf("append_frame: %v", err)
+			frame.Locals, err = d.readVerificationTypes("locals", localsNum)
+			if err != nil {
+				return nil, err
 			}
 		case tag == 255: // full_frame
-			delta, err := d.readUint16()
+			frame.Kind = FullFrame
+			delta, err := d.readUint16("offset_delta")
 			if err != nil {
-				return nil, fmt.Errorf("full_frame: %v", err)
+				return nil, err
 			}
 			offset += uint32(delta)
-			localsNum, err := d.readUint16()
+			localsNum, err := d.readCount("number_of_locals", 1)
 			if err != nil {
-				return nil, fmt.Errorf("full_frame: %v", err)
+				return nil, err
 			}
-			if err := d.skipVerificationTypes(int(localsNum)); err != nil {
-				return nil, fmt.Errorf("full_frame: %v", err)
+			frame.Locals, err = d.readVerificationTypes("locals", localsNum)
+			if err != nil {
+				return nil, err
 			}
-			stackDepth, err := d.readUint16()
+			stackDepth, err := d.readCount("number_of_stack_items", 1)
 			if err != nil {
-				return nil, fmt.Errorf("full_frame: %v", err)
+				return nil, err
 			}
-			if err := d.skipVerificationTypes(int(stackDepth)); err != nil {
-				return nil, fmt.Errorf("full_frame: %v", err)
+			frame.Stack, err = d.readVerificationTypes("stack", stackDepth)
+			if err != nil {
+				return nil, err
 			}
-			depth = stackDepth
 		default:
-			return nil, fmt.Errorf("unexpected tag: %d", tag)
+			return nil, d.errorAt(frameOffset, "frame_type", fmt.Errorf("unexpected tag: %d", tag))
 		}
 
 		if i != 0 {
 			offset++
 		}
 
-		frame := &frames[i]
 		frame.Offset = offset
-		frame.StackDepth = depth
+		frame.StackDepth = uint16(len(frame.Stack))
+		frames = append(frames, frame)
+		d.leave()
 	}
 
 	return frames, nil
@@ -467,168 +710,366 @@ func (d *Decoder) readStackMapFrames() ([]StackMapFrame, error) {
 
 func (d *Decoder) readField() (Field, error) {
 	var f Field
-	accessFlags, err := d.readUint16()
+	accessFlags, err := d.readUint16("access_flags")
 	if err != nil {
-		return f, fmt.Errorf("read access_flags: %w", err)
+		return f, err
 	}
-	nameIndex, err := d.readUint16()
+	name, err := d.readUtf8Ref("name_index")
 	if err != nil {
-		return f, fmt.Errorf("read name_index: %w", err)
+		return f, err
 	}
-	descriptorIndex, err := d.readUint16()
+	descriptor, err := d.readUtf8Ref("descriptor_index")
 	if err != nil {
-		return f, fmt.Errorf("read descriptor_index: %w", err)
+		return f, err
 	}
 	attrs, err := d.readAttributes()
 	if err != nil {
 		return f, err
 	}
 	f.AccessFlags = FieldAccessFlags(accessFlags)
-	f.Name = d.f.Consts[nameIndex].(*Utf8Const).Value
-	f.Descriptor = d.f.Consts[descriptorIndex].(*Utf8Const).Value
+	f.Name = name
+	f.Descriptor = descriptor
 	f.Attrs = attrs
 	return f, nil
 }
 
-func (d *Decoder) readConst() (Const, int, error) {
-	tag, err := d.r.ReadByte()
+func (d *Decoder) readConst(i int) (Const, int, error) {
+	offset := d.offset
+	tag, err := d.readUint8("tag")
 	if err != nil {
-		return nil, 0, fmt.Errorf("read tag: %w", err)
+		return nil, 0, err
 	}
 
 	var c Const
 	skip := 1 // Almost all consts occupy 1 index
 	switch tag {
 	case 1:
-		buf, err := d.readByteSlice16()
+		length, err := d.readUint16("length")
+		if err != nil {
+			return nil, 0, err
+		}
+		bytesOffset := d.offset
+		buf, err := d.readBytes("bytes", uint32(length))
+		if err != nil {
+			return nil, 0, err
+		}
+		v, err := decodeModifiedUtf8(buf)
 		if err != nil {
-			return nil, 0, fmt.Errorf("read bytes: %w", err)
+			return nil, 0, d.errorAt(bytesOffset, "bytes", err)
 		}
-		c = &Utf8Const{Value: string(buf)}
+		c = &Utf8Const{Value: v}
 	case 3:
-		v, err := d.readUint32()
+		v, err := d.readUint32("bytes")
 		if err != nil {
-			return nil, 0, fmt.Errorf("read bytes: %w", err)
+			return nil, 0, err
 		}
 		c = &IntConst{Value: int32(v)}
+	case 4:
+		v, err := d.readUint32("bytes")
+		if err != nil {
+			return nil, 0, err
+		}
+		c = &FloatConst{Value: math.Float32frombits(v)}
 	case 5:
-		v, err := d.readUint64()
+		v, err := d.readUint64("bytes")
 		if err != nil {
-			return nil, 0, fmt.Errorf("read bytes: %w", err)
+			return nil, 0, err
 		}
 		c = &LongConst{Value: int64(v)}
 		skip = 2
 	case 6:
-		v, err := d.readUint64()
+		v, err := d.readUint64("bytes")
 		if err != nil {
-			return nil, 0, fmt.Errorf("read bytes: %w", err)
+			return nil, 0, err
 		}
 		c = &DoubleConst{Value: math.Float64frombits(v)}
 		skip = 2
 	case 7:
-		nameIndex, err := d.readUint16()
+		nameOffset := d.offset
+		nameIndex, err := d.readUint16("name_index")
 		if err != nil {
-			return nil, 0, fmt.Errorf("read name_index: %w", err)
+			return nil, 0, err
 		}
 		cc := &ClassConst{}
-		d.deferNameResolving(nameIndex, &cc.Name)
+		d.deferRef(i, "name_index", nameOffset, nameIndex, refUtf8, &cc.Name)
 		c = cc
+	case 8:
+		stringOffset := d.offset
+		stringIndex, err := d.readUint16("string_index")
+		if err != nil {
+			return nil, 0, err
+		}
+		sc := &StringConst{}
+		d.deferRef(i, "string_index", stringOffset, stringIndex, refUtf8, &sc.Value)
+		c = sc
 	case 9, 10:
-		classIndex, err := d.readUint16()
+		classOffset := d.offset
+		classIndex, err := d.readUint16("class_index")
 		if err != nil {
-			return nil, 0, fmt.Errorf("read class_index: %w", err)
+			return nil, 0, err
 		}
-		nameAndTypeIndex, err := d.readUint16()
+		ntOffset := d.offset
+		nameAndTypeIndex, err := d.readUint16("name_and_type_index")
 		if err != nil {
-			return nil, 0, fmt.Errorf("read name_and_type_index: %w", err)
+			return nil, 0, err
 		}
+		var className, name, descriptor *string
 		switch tag {
 		case 9:
 			fc := &FieldrefConst{}
-			d.deferClassNameResolving(classIndex, &fc.ClassName)
-			d.deferNameAndTypeResolving(nameAndTypeIndex, &fc.Name, &fc.Descriptor)
+			className, name, descriptor = &fc.ClassName, &fc.Name, &fc.Descriptor
 			c = fc
 		case 10:
 			mc := &MethodrefConst{}
-			d.deferClassNameResolving(classIndex, &mc.ClassName)
-			d.deferNameAndTypeResolving(nameAndTypeIndex, &mc.Name, &mc.Descriptor)
+			className, name, descriptor = &mc.ClassName, &mc.Name, &mc.Descriptor
 			c = mc
 		}
+		d.deferRef(i, "class_index", classOffset, classIndex, refClassName, className)
+		d.deferRef(i, "name_and_type_index", ntOffset, nameAndTypeIndex, refNameAndTypeName, name)
+		d.deferRef(i, "name_and_type_index", ntOffset, nameAndTypeIndex, refNameAndTypeDescriptor, descriptor)
 	case 12:
-		nameIndex, err := d.readUint16()
+		nameOffset := d.offset
+		nameIndex, err := d.readUint16("name_index")
 		if err != nil {
-			return nil, 0, fmt.Errorf("read name_index: %w", err)
+			return nil, 0, err
 		}
-		descriptorIndex, err := d.readUint16()
+		descriptorOffset := d.offset
+		descriptorIndex, err := d.readUint16("descriptor_index")
 		if err != nil {
-			return nil, 0, fmt.Errorf("read descriptor_index: %w", err)
+			return nil, 0, err
 		}
 		ntc := &NameAndTypeConst{}
-		d.deferNameResolving(nameIndex, &ntc.Name)
-		d.deferDescriptorResolving(descriptorIndex, &ntc.Descriptor)
+		d.deferRef(i, "name_index", nameOffset, nameIndex, refUtf8, &ntc.Name)
+		d.deferRef(i, "descriptor_index", descriptorOffset, descriptorIndex, refUtf8, &ntc.Descriptor)
 		c = ntc
 	default:
-		return nil, 0, fmt.Errorf("unexpected tag: %d", tag)
+		return nil, 0, d.errorAt(offset, "tag", fmt.Errorf("unexpected tag: %d", tag))
 	}
 
 	return c, skip, nil
 }
 
-func (d *Decoder) readUint64() (uint64, error) {
-	var buf [8]byte
-	n, err := d.r.Read(buf[:])
+// constAt returns a usable constant pool entry at the specified index.
+func (d *Decoder) constAt(index uint16) (Const, error) {
+	if index == 0 || int(index) >= len(d.f.Consts) {
+		return nil, &IndexError{Index: index, PoolSize: len(d.f.Consts)}
+	}
+	c := d.f.Consts[index]
+	if c == nil {
+		// An index that follows a long or double constant.
+		return nil, &ConstKindError{Index: index, Want: "usable entry"}
+	}
+	return c, nil
+}
+
+func (d *Decoder) utf8At(index uint16) (string, error) {
+	c, err := d.constAt(index)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
-	if n != 8 {
-		return 0, fmt.Errorf("not enough input bytes (want 8, got %d)", n)
+	utf8, ok := c.(*Utf8Const)
+	if !ok {
+		return "", &ConstKindError{Index: index, Want: "Utf8", Have: c}
 	}
-	v := binary.BigEndian.Uint64(buf[:])
-	return v, nil
+	return utf8.Value, nil
 }
 
-func (d *Decoder) readUint32() (uint32, error) {
-	var buf [4]byte
-	n, err := d.r.Read(buf[:])
+func (d *Decoder) classAt(index uint16) (*ClassConst, error) {
+	c, err := d.constAt(index)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	if n != 4 {
-		return 0, fmt.Errorf("not enough input bytes (want 4, got %d)", n)
+	class, ok := c.(*ClassConst)
+	if !ok {
+		return nil, &ConstKindError{Index: index, Want: "Class", Have: c}
 	}
-	v := binary.BigEndian.Uint32(buf[:])
+	return class, nil
+}
+
+func (d *Decoder) nameAndTypeAt(index uint16) (*NameAndTypeConst, error) {
+	c, err := d.constAt(index)
+	if err != nil {
+		return nil, err
+	}
+	nt, ok := c.(*NameAndTypeConst)
+	if !ok {
+		return nil, &ConstKindError{Index: index, Want: "NameAndType", Have: c}
+	}
+	return nt, nil
+}
+
+func (d *Decoder) readUtf8Ref(field string) (string, error) {
+	offset := d.offset
+	index, err := d.readUint16(field)
+	if err != nil {
+		return "", err
+	}
+	s, err := d.utf8At(index)
+	if err != nil {
+		return "", d.errorAt(offset, field, err)
+	}
+	return s, nil
+}
+
+func (d *Decoder) readClassRef(field string) (*ClassConst, error) {
+	offset := d.offset
+	index, err := d.readUint16(field)
+	if err != nil {
+		return nil, err
+	}
+	c, err := d.classAt(index)
+	if err != nil {
+		return nil, d.errorAt(offset, field, err)
+	}
+	return c, nil
+}
+
+func (d *Decoder) readUint8(field string) (uint8, error) {
+	offset := d.offset
+	v, err := d.r.ReadByte()
+	if err != nil {
+		return 0, d.readError(offset, field, err)
+	}
+	d.offset++
 	return v, nil
 }
 
-func (d *Decoder) readUint16() (uint16, error) {
+func (d *Decoder) readUint64(field string) (uint64, error) {
+	var buf [8]byte
+	if err := d.readFull(field, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *Decoder) readUint32(field string) (uint32, error) {
+	var buf [4]byte
+	if err := d.readFull(field, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf[:]), nil
+}
+
+func (d *Decoder) readUint16(field string) (uint16, error) {
 	var buf [2]byte
-	n, err := d.r.Read(buf[:])
+	if err := d.readFull(field, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(buf[:]), nil
+}
+
+// readCount reads a number of entries that occupy at least minSize bytes.
+//
+// Inside of an attribute, the count can't exceed the number
+// of entries that fit into the remaining attribute bytes.
+func (d *Decoder) readCount(field string, minSize int64) (int, error) {
+	offset := d.offset
+	n, err := d.readUint16(field)
 	if err != nil {
 		return 0, err
 	}
-	if n != 2 {
-		return 0, fmt.Errorf("not enough input bytes (want 2, got %d)", n)
+	if d.limit != 0 {
+		max := (d.limit - d.offset) / minSize
+		if max < 0 {
+			max = 0
+		}
+		if int64(n) > max {
+			return 0, d.errorAt(offset, field, &LengthError{Length: uint32(n), Max: uint32(max)})
+		}
 	}
-	v := binary.BigEndian.Uint16(buf[:])
-	return v, nil
+	return int(n), nil
+}
+
+// maxPrealloc is a number of table entries that are allocated
+// before they're decoded. Bigger tables grow while they're decoded,
+// so we never allocate more memory than the input can describe.
+const maxPrealloc = 256
+
+// preallocCount returns the capacity to allocate for n table entries.
+func preallocCount(n int) int {
+	if n > maxPrealloc {
+		return maxPrealloc
+	}
+	return n
 }
 
-func (d *Decoder) readByteSlice32() ([]byte, error) {
-	length, err := d.readUint32()
+// readBytes reads n bytes from the input.
+//
+// Big buffers are grown while the data is being read,
+// so we never allocate more memory than the input has.
+func (d *Decoder) readBytes(field string, n uint32) ([]byte, error) {
+	const preallocLimit = 64 * 1024
+	if n <= preallocLimit {
+		buf := make([]byte, n)
+		err := d.readFull(field, buf)
+		return buf, err
+	}
+	offset := d.offset
+	var buf bytes.Buffer
+	copied, err := io.CopyN(&buf, d.r, int64(n))
+	d.offset += copied
 	if err != nil {
-		return nil, fmt.Errorf("read length: %w", err)
+		return nil, d.readError(offset, field, err)
 	}
-	buf := make([]byte, length)
-	_, err = io.ReadFull(d.r, buf)
-	return buf, err
+	return buf.Bytes(), nil
 }
 
-func (d *Decoder) readByteSlice16() ([]byte, error) {
-	length, err := d.readUint16()
+func (d *Decoder) readFull(field string, buf []byte) error {
+	offset := d.offset
+	n, err := io.ReadFull(d.r, buf)
+	d.offset += int64(n)
 	if err != nil {
-		return nil, fmt.Errorf("read length: %w", err)
+		return d.readError(offset, field, err)
+	}
+	return nil
+}
+
+func (d *Decoder) readError(offset int64, field string, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	return d.errorAt(offset, field, err)
+}
+
+func (d *Decoder) errorAt(offset int64, field string, err error) *DecodeError {
+	return &DecodeError{
+		Offset: offset,
+		Path:   d.pathString(field),
+		Err:    err,
+	}
+}
+
+func (d *Decoder) enter(name string) {
+	d.path = append(d.path, pathElem{name: name})
+}
+
+func (d *Decoder) enterIndex(i int) {
+	d.path = append(d.path, pathElem{index: i})
+}
+
+func (d *Decoder) leave() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+func (d *Decoder) pathString(field string) string {
+	var buf strings.Builder
+	for _, elem := range d.path {
+		if elem.name == "" {
+			buf.WriteByte('[')
+			buf.WriteString(strconv.Itoa(elem.index))
+			buf.WriteByte(']')
+			continue
+		}
+		if buf.Len() != 0 {
+			buf.WriteByte('.')
+		}
+		buf.WriteString(elem.name)
+	}
+	if field != "" {
+		if buf.Len() != 0 {
+			buf.WriteByte('.')
+		}
+		buf.WriteString(field)
 	}
-	buf := make([]byte, length)
-	_, err = io.ReadFull(d.r, buf)
-	return buf, err
+	return buf.String()
 }
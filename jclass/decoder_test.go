@@ -0,0 +1,469 @@
+package jclass
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/quasilyte/go-jdk/jclass/jclasstest"
+)
+
+func TestDecodeShortReads(t *testing.T) {
+	data, _ := buildTestClass()
+	var dec Decoder
+	f, err := dec.Decode(iotest.OneByteReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if f.ThisClassName != "Foo" {
+		t.Errorf("class name mismatch:\nhave: %s\nwant: Foo", f.ThisClassName)
+	}
+	if c := f.Consts[9].(*LongConst); c.Value != -2 {
+		t.Errorf("long const mismatch:\nhave: %d\nwant: -2", c.Value)
+	}
+	m := f.Methods[0]
+	if m.Name != "f" || m.Descriptor != "()I" {
+		t.Errorf("method mismatch:\nhave: %s%s\nwant: f()I", m.Name, m.Descriptor)
+	}
+	mref := f.Consts[12].(*MethodrefConst)
+	if mref.ClassName != "Foo" || mref.Name != "f" || mref.Descriptor != "()I" {
+		t.Errorf("methodref mismatch: %#v", mref)
+	}
+	if c := f.Consts[13].(*FloatConst); c.Value != 1.5 {
+		t.Errorf("float const mismatch:\nhave: %v\nwant: 1.5", c.Value)
+	}
+	if c := f.Consts[14].(*StringConst); c.Value != "f" {
+		t.Errorf("string const mismatch:\nhave: %q\nwant: \"f\"", c.Value)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	data, _ := buildTestClass()
+	for n := 0; n < len(data); n++ {
+		var dec Decoder
+		_, err := dec.Decode(bytes.NewReader(data[:n]))
+		if !errors.Is(err, ErrTruncated) {
+			t.Fatalf("decode %d bytes: expected truncation error, got %v", n, err)
+		}
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("decode %d bytes: expected *DecodeError, got %T", n, err)
+		}
+		if decodeErr.Offset > int64(n) {
+			t.Fatalf("decode %d bytes: error offset %d is out of bounds", n, decodeErr.Offset)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		mark  string
+		patch func([]byte)
+		path  string
+		check func(error) bool
+	}{
+		{
+			mark:  "this_class",
+			patch: putUint16(99),
+			path:  "this_class",
+			check: isIndexError,
+		},
+		{
+			mark:  "this_class",
+			patch: putUint16(1),
+			path:  "this_class",
+			check: isConstKindError,
+		},
+		{
+			mark:  "super_class",
+			patch: putUint16(5),
+			path:  "super_class",
+			check: isConstKindError,
+		},
+		{
+			mark:  "method.name_index",
+			patch: putUint16(10), // Unusable slot after the long constant
+			path:  "methods[0].name_index",
+			check: isConstKindError,
+		},
+		{
+			mark:  "method.descriptor_index",
+			patch: putUint16(0),
+			path:  "methods[0].descriptor_index",
+			check: isIndexError,
+		},
+		{
+			mark:  "methodref.class_index",
+			patch: putUint16(11),
+			path:  "constant_pool[12].class_index",
+			check: isConstKindError,
+		},
+		{
+			mark:  "string.string_index",
+			patch: putUint16(2),
+			path:  "constant_pool[14].string_index",
+			check: isConstKindError,
+		},
+		{
+			mark:  "class.name_index",
+			patch: putUint16(200),
+			path:  "constant_pool[2].name_index",
+			check: isIndexError,
+		},
+		{
+			mark:  "code.attribute_name_index",
+			patch: putUint16(2),
+			path:  "methods[0].attributes[0].attribute_name_index",
+			check: isConstKindError,
+		},
+		{
+			mark:  "code.code_length",
+			patch: putUint32(0xFFFFFFF0),
+			path:  "methods[0].attributes[0].code_length",
+			check: isLengthError,
+		},
+		{
+			mark:  "code.attribute_length",
+			patch: putUint32(100),
+			path:  "methods[0].attributes[0]",
+			check: func(error) bool { return true },
+		},
+		{
+			mark:  "stackmap.attribute_name_index",
+			patch: putUint16(7), // Code attribute inside Code attribute
+			path:  "methods[0].attributes[0].attributes[0].attribute_name_index",
+			check: func(error) bool { return true },
+		},
+		{
+			mark:  "code.attributes_count",
+			patch: putUint16(0xFFFF), // Only 1 attribute fits into Code
+			path:  "methods[0].attributes[0].attributes.count",
+			check: isLengthError,
+		},
+		{
+			mark:  "stackmap.frame_type",
+			patch: func(b []byte) { b[0] = 200 },
+			path:  "methods[0].attributes[0].attributes[0].entries[0].frame_type",
+			check: func(error) bool { return true },
+		},
+	}
+
+	for _, test := range tests {
+		data, marks := buildTestClass()
+		offset, ok := marks[test.mark]
+		if !ok {
+			t.Fatalf("%s: mark not found", test.mark)
+		}
+		test.patch(data[offset:])
+		var dec Decoder
+		_, err := dec.Decode(bytes.NewReader(data))
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("%s: expected *DecodeError, got %v", test.mark, err)
+			continue
+		}
+		if decodeErr.Path != test.path {
+			t.Errorf("%s: path mismatch:\nhave: %s\nwant: %s", test.mark, decodeErr.Path, test.path)
+		}
+		if !test.check(decodeErr.Err) {
+			t.Errorf("%s: unexpected error: %v", test.mark, err)
+		}
+		if test.path != "methods[0].attributes[0]" && decodeErr.Offset != int64(offset) {
+			t.Errorf("%s: offset mismatch:\nhave: %d\nwant: %d", test.mark, decodeErr.Offset, offset)
+		}
+	}
+}
+
+func TestDecodeVersion(t *testing.T) {
+	tests := []struct {
+		major        uint16
+		minor        uint16
+		allowPreview bool
+		ok           bool
+	}{
+		{major: 44, minor: 0},
+		{major: 45, minor: 3, ok: true},
+		{major: 49, minor: 10, ok: true},
+		{major: 52, minor: 0, ok: true},
+		{major: 55, minor: 0xFFFF, ok: true},
+		{major: 56, minor: 1},
+		{major: 56, minor: 0xFFFF},
+		{major: 56, minor: 0xFFFF, allowPreview: true, ok: true},
+		{major: MaxMajorVersion, minor: 0, ok: true},
+		{major: MaxMajorVersion + 1, minor: 0},
+	}
+
+	for _, test := range tests {
+		data, marks := buildTestClass()
+		putUint16(test.major)(data[marks["major_version"]:])
+		putUint16(test.minor)(data[marks["minor_version"]:])
+		dec := Decoder{AllowPreview: test.allowPreview}
+		f, err := dec.Decode(bytes.NewReader(data))
+		ver := fmt.Sprintf("%d.%d (preview=%v)", test.major, test.minor, test.allowPreview)
+		if !test.ok {
+			if !errors.Is(err, ErrUnsupportedVersion) {
+				t.Errorf("%s: expected unsupported version error, got %v", ver, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", ver, err)
+			continue
+		}
+		// Older class files should have their StackMapTable ignored.
+		code := f.Methods[0].Attrs[0].(CodeAttribute)
+		_, isStackMap := code.Attrs[0].(StackMapTableAttribute)
+		if isStackMap != f.Ver.HasStackMapTable() {
+			t.Errorf("%s: StackMapTable decoded=%v", ver, isStackMap)
+		}
+	}
+}
+
+func TestDecodeLazyCode(t *testing.T) {
+	data, marks := buildTestClass()
+	dec := Decoder{LazyCode: true}
+	f, err := dec.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	m := &f.Methods[0]
+	lazy, ok := m.Attrs[0].(LazyCodeAttribute)
+	if !ok {
+		t.Fatalf("expected LazyCodeAttribute, got %T", m.Attrs[0])
+	}
+	if lazy.IsDecoded() {
+		t.Fatalf("code is decoded before the first access")
+	}
+	code, err := m.Code()
+	if err != nil {
+		t.Fatalf("decode code: %v", err)
+	}
+	if !bytes.Equal(code.Code, []byte{0x04, 0xac}) {
+		t.Errorf("code mismatch:\nhave: %x\nwant: 04ac", code.Code)
+	}
+	if _, ok := code.Attrs[0].(StackMapTableAttribute); !ok {
+		t.Errorf("expected StackMapTableAttribute, got %T", code.Attrs[0])
+	}
+	if !m.Attrs[0].(LazyCodeAttribute).IsDecoded() {
+		t.Errorf("decoded attribute is not marked as decoded")
+	}
+	if again, _ := m.Code(); again != code {
+		t.Errorf("decoded attribute is not cached")
+	}
+
+	// Malformed method bodies are only reported on demand.
+	offset := marks["code.code_length"]
+	putUint32(0xFFFFFFF0)(data[offset:])
+	f, err = dec.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode malformed: %v", err)
+	}
+	_, err = f.Methods[0].Code()
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected *DecodeError, got %v", err)
+	}
+	if want := "methods[0].attributes[0].code_length"; decodeErr.Path != want {
+		t.Errorf("path mismatch:\nhave: %s\nwant: %s", decodeErr.Path, want)
+	}
+	if decodeErr.Offset != int64(offset) {
+		t.Errorf("offset mismatch:\nhave: %d\nwant: %d", decodeErr.Offset, offset)
+	}
+}
+
+func TestDecodeLazyCodeConcurrent(t *testing.T) {
+	data, _ := buildTestClass()
+	dec := Decoder{LazyCode: true}
+	f, err := dec.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	m := &f.Methods[0]
+	codes := make([]*CodeAttribute, 8)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			code, err := m.Code()
+			if err != nil {
+				t.Errorf("decode code: %v", err)
+			}
+			codes[i] = code
+		}(i)
+	}
+	wg.Wait()
+	for _, code := range codes[1:] {
+		if code != codes[0] {
+			t.Fatalf("code is decoded more than once")
+		}
+	}
+}
+
+func TestDecodeHugeLength(t *testing.T) {
+	data, marks := buildTestClass()
+	// Turn the Code attribute into an unknown "f" attribute
+	// that claims to be almost 4GB long.
+	putUint16(5)(data[marks["code.attribute_name_index"]:])
+	putUint32(0xFFFFFFF0)(data[marks["code.attribute_length"]:])
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var dec Decoder
+	_, err := dec.Decode(bytes.NewReader(data))
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected truncation error, got %v", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1024*1024 {
+		t.Fatalf("too much memory allocated: %d bytes", allocated)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	data, _ := buildTestClass()
+	f.Add(data)
+	// The constant pool count is the only thing that follows the header.
+	f.Add([]byte("\xca\xfe\xba\xbe\x00\x00\x00\x34\xff\xff"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// The decoder never allocates more memory than the input
+		// describes, no matter what counts and lengths it has.
+		// Only the byte strings up to 64KB are allocated before
+		// they're read, so one of them can be truncated.
+		maxAllocated := uint64(128*1024 + 512*len(data))
+		for _, lazy := range []bool{false, true} {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			dec := Decoder{LazyCode: lazy}
+			file, err := dec.Decode(bytes.NewReader(data))
+			if err == nil && lazy {
+				for i := range file.Methods {
+					if _, err = file.Methods[i].Code(); err != nil {
+						break
+					}
+				}
+			}
+			runtime.ReadMemStats(&after)
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > maxAllocated {
+				t.Fatalf("lazy=%v: %d bytes allocated for %d bytes of input", lazy, allocated, len(data))
+			}
+			if err == nil {
+				continue
+			}
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("lazy=%v: expected *DecodeError, got %T: %v", lazy, err, err)
+			}
+		}
+	})
+}
+
+func isIndexError(err error) bool {
+	var e *IndexError
+	return errors.As(err, &e)
+}
+
+func isConstKindError(err error) bool {
+	var e *ConstKindError
+	return errors.As(err, &e)
+}
+
+func isLengthError(err error) bool {
+	var e *LengthError
+	return errors.As(err, &e)
+}
+
+func putUint16(v uint16) func([]byte) {
+	return func(b []byte) { binary.BigEndian.PutUint16(b, v) }
+}
+
+func putUint32(v uint32) func([]byte) {
+	return func(b []byte) { binary.BigEndian.PutUint32(b, v) }
+}
+
+// buildTestClass returns an encoded class that is equivalent to:
+//
+//	class Foo {
+//	    static int f() { return 1; }
+//	}
+//
+// It also has some extra constants that are used by the tests.
+func buildTestClass() ([]byte, map[string]int) {
+	w := jclasstest.NewWriter()
+
+	w.U4(0xCAFEBABE)
+	w.Mark("minor_version")
+	w.U2(0)
+	w.Mark("major_version")
+	w.U2(52)
+
+	w.U2(15)                        // constant_pool_count
+	w.Utf8("Foo")                   // #1
+	w.U1(7)                         // #2 Class
+	w.Mark("class.name_index")      //
+	w.U2(1)                         //
+	w.Mark("object")                //
+	w.Utf8("java/lang/Object")      // #3
+	w.U1(7)                         // #4 Class
+	w.U2(3)                         //
+	w.Utf8("f")                     // #5
+	w.Utf8("()I")                   // #6
+	w.Utf8("Code")                  // #7
+	w.Utf8("StackMapTable")         // #8
+	w.U1(5)                         // #9 Long (occupies #10 as well)
+	w.U4(0xFFFFFFFF)                //
+	w.U4(0xFFFFFFFE)                //
+	w.U1(12)                        // #11 NameAndType
+	w.U2(5)                         //
+	w.U2(6)                         //
+	w.U1(10)                        // #12 Methodref
+	w.Mark("methodref.class_index") //
+	w.U2(2)                         //
+	w.U2(11)                        //
+	w.U1(4)                         // #13 Float
+	w.U4(0x3FC00000)                //
+	w.U1(8)                         // #14 String
+	w.Mark("string.string_index")   //
+	w.U2(5)                         //
+
+	w.U2(0x0021) // access_flags
+	w.Mark("this_class")
+	w.U2(2)
+	w.Mark("super_class")
+	w.U2(4)
+	w.U2(0) // interfaces_count
+	w.U2(0) // fields_count
+
+	w.U2(1)      // methods_count
+	w.U2(0x0008) // access_flags
+	w.Mark("method.name_index")
+	w.U2(5)
+	w.Mark("method.descriptor_index")
+	w.U2(6)
+	w.U2(1) // attributes_count
+	w.Attr("code", 7, func() {
+		w.U2(1) // max_stack
+		w.U2(0) // max_locals
+		w.Mark("code.code_length")
+		w.U4(2)
+		w.U1(0x04) // iconst_1
+		w.U1(0xac) // ireturn
+		w.U2(0)    // exception_table_length
+		w.Mark("code.attributes_count")
+		w.U2(1) // attributes_count
+		w.Attr("stackmap", 8, func() {
+			w.U2(1) // number_of_entries
+			w.Mark("stackmap.frame_type")
+			w.U1(1) // same_frame
+		})
+	})
+
+	w.U2(0) // attributes_count
+
+	return w.Buf, w.Marks
+}
@@ -59,8 +59,81 @@ func walkDescriptor(s string, visit func(typ DescriptorType)) {
 	}
 }
 
+// IsValid reports whether d is a well-formed method descriptor.
+func (d MethodDescriptor) IsValid() bool {
+	s := string(d)
+	if !strings.HasPrefix(s, "(") {
+		return false
+	}
+	s = s[len("("):]
+	for len(s) != 0 && s[0] != ')' {
+		n := fieldTypeLength(s)
+		if n == 0 {
+			return false
+		}
+		s = s[n:]
+	}
+	if s == "" {
+		return false
+	}
+	s = s[len(")"):]
+	return s == "V" || FieldDescriptor(s).IsValid()
+}
+
 type FieldDescriptor string
 
+// IsValid reports whether d is a well-formed field descriptor.
+func (d FieldDescriptor) IsValid() bool {
+	n := fieldTypeLength(string(d))
+	return n != 0 && n == len(d)
+}
+
+// IsValidClassName reports whether name can be referenced by
+// a Class constant: it's either a class name in its internal form,
+// like "java/lang/Object", or an array descriptor, like "[I".
+func IsValidClassName(name string) bool {
+	if strings.HasPrefix(name, "[") {
+		return FieldDescriptor(name).IsValid()
+	}
+	return isValidBinaryName(name)
+}
+
+// fieldTypeLength returns the length of the field type
+// that s starts with. It returns 0 if there is no valid type.
+func fieldTypeLength(s string) int {
+	dims := 0
+	for dims < len(s) && s[dims] == '[' {
+		dims++
+	}
+	if dims == len(s) || dims > 255 {
+		return 0
+	}
+	switch s[dims] {
+	case 'B', 'C', 'D', 'F', 'I', 'J', 'S', 'Z':
+		return dims + 1
+	case 'L':
+		end := strings.IndexByte(s[dims:], ';')
+		if end == -1 || !isValidBinaryName(s[dims+len("L"):dims+end]) {
+			return 0
+		}
+		return dims + end + len(";")
+	default:
+		return 0
+	}
+}
+
+func isValidBinaryName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || strings.ContainsAny(part, ".;[") {
+			return false
+		}
+	}
+	return true
+}
+
 func (d FieldDescriptor) GetType() DescriptorType {
 	var result DescriptorType
 	walkDescriptor(string(d), func(typ DescriptorType) {
@@ -32,3 +32,51 @@ func TestMethodDescriptor(t *testing.T) {
 		}
 	}
 }
+
+func TestDescriptorIsValid(t *testing.T) {
+	methods := []struct {
+		d     string
+		valid bool
+	}{
+		{"()V", true},
+		{"(I[JLFoo;)LBar;", true},
+		{"([[Ljava/lang/Object;)[I", true},
+		{"", false},
+		{"(", false},
+		{"(L", false},
+		{"([", false},
+		{"()", false},
+		{"(V)V", false},
+		{"()VV", false},
+		{"(L;)V", false},
+		{"(La//b;)V", false},
+		{"(Q)V", false},
+	}
+	for _, test := range methods {
+		if have := MethodDescriptor(test.d).IsValid(); have != test.valid {
+			t.Errorf("method %q: valid=%v, want %v", test.d, have, test.valid)
+		}
+	}
+
+	classes := []struct {
+		name  string
+		valid bool
+	}{
+		{"Foo", true},
+		{"java/lang/Object", true},
+		{"[I", true},
+		{"[[Ljava/lang/String;", true},
+		{"", false},
+		{"[", false},
+		{"[L", false},
+		{"[Lfoo", false},
+		{"[I;", false},
+		{"java.lang.Object", false},
+		{"/Foo", false},
+	}
+	for _, test := range classes {
+		if have := IsValidClassName(test.name); have != test.valid {
+			t.Errorf("class %q: valid=%v, want %v", test.name, have, test.valid)
+		}
+	}
+}
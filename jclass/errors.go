@@ -0,0 +1,94 @@
+package jclass
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated is reported when class file data ends prematurely.
+var ErrTruncated = errors.New("unexpected end of class file data")
+
+// DecodeError is returned by the Decoder for malformed class files.
+//
+// Err describes the actual problem. It's either ErrTruncated,
+// one of the *IndexError, *ConstKindError and *LengthError
+// or some other error for less common cases.
+type DecodeError struct {
+	// Offset is a byte offset inside the class file data
+	// where a problematic structure begins.
+	Offset int64
+
+	// Path is a structure path that leads to the problematic value,
+	// like "methods[1].attributes[0].code_length".
+	Path string
+
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s (offset %d): %v", e.Path, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// IndexError is reported when constant pool index is out of range.
+type IndexError struct {
+	Index    uint16
+	PoolSize int
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("constant pool index %d is out of range [1, %d)", e.Index, e.PoolSize)
+}
+
+// ConstKindError is reported when constant pool entry has a kind
+// that is not permitted in the referencing context.
+type ConstKindError struct {
+	Index uint16
+	Want  string
+	Have  Const
+}
+
+func (e *ConstKindError) Error() string {
+	return fmt.Sprintf("constant pool index %d: expected %s, found %s",
+		e.Index, e.Want, constKindName(e.Have))
+}
+
+// LengthError is reported when some encoded length exceeds its limit.
+type LengthError struct {
+	Length uint32
+	Max    uint32
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("length %d exceeds the limit of %d", e.Length, e.Max)
+}
+
+func constKindName(c Const) string {
+	switch c.(type) {
+	case nil:
+		return "unusable entry"
+	case *Utf8Const:
+		return "Utf8"
+	case *ClassConst:
+		return "Class"
+	case *IntConst:
+		return "Integer"
+	case *LongConst:
+		return "Long"
+	case *FloatConst:
+		return "Float"
+	case *DoubleConst:
+		return "Double"
+	case *StringConst:
+		return "String"
+	case *FieldrefConst:
+		return "Fieldref"
+	case *MethodrefConst:
+		return "Methodref"
+	case *NameAndTypeConst:
+		return "NameAndType"
+	default:
+		return fmt.Sprintf("%T", c)
+	}
+}
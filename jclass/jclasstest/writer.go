@@ -0,0 +1,56 @@
+// Package jclasstest implements a class file encoder for the tests.
+package jclasstest
+
+import (
+	"encoding/binary"
+)
+
+// Writer is a tiny class file encoder used to produce test inputs.
+//
+// It only writes the raw class file items, the tests lay them out.
+// Marks map the names to the offsets of the items that follow them,
+// so the tests can patch the encoded class file.
+type Writer struct {
+	Buf   []byte
+	Marks map[string]int
+}
+
+// NewWriter returns an empty class file writer.
+func NewWriter() *Writer {
+	return &Writer{Marks: map[string]int{}}
+}
+
+// Mark records the current offset under the given name.
+func (w *Writer) Mark(name string) { w.Marks[name] = len(w.Buf) }
+
+func (w *Writer) U1(v uint8) { w.Buf = append(w.Buf, v) }
+
+func (w *Writer) U2(v uint16) { w.Buf = append(w.Buf, byte(v>>8), byte(v)) }
+
+func (w *Writer) U4(v uint32) {
+	w.Buf = append(w.Buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// Bytes writes b as is.
+func (w *Writer) Bytes(b []byte) { w.Buf = append(w.Buf, b...) }
+
+// Utf8 writes a CONSTANT_Utf8 entry.
+// Only ASCII strings are encoded correctly.
+func (w *Writer) Utf8(s string) {
+	w.U1(1)
+	w.U2(uint16(len(s)))
+	w.Buf = append(w.Buf, s...)
+}
+
+// Attr writes an attribute header and patches its length after body is written.
+// Its name and length offsets are marked as name.attribute_name_index
+// and name.attribute_length.
+func (w *Writer) Attr(name string, nameIndex uint16, body func()) {
+	w.Mark(name + ".attribute_name_index")
+	w.U2(nameIndex)
+	w.Mark(name + ".attribute_length")
+	lengthPos := len(w.Buf)
+	w.U4(0)
+	body()
+	binary.BigEndian.PutUint32(w.Buf[lengthPos:], uint32(len(w.Buf)-lengthPos-4))
+}
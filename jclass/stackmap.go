@@ -0,0 +1,56 @@
+package jclass
+
+// FrameKind describes how StackMapFrame derives its state from the previous frame.
+type FrameKind uint8
+
+const (
+	// SameFrame has the same locals as the previous frame and an empty stack.
+	SameFrame FrameKind = iota
+
+	// SameLocals1StackItemFrame has the same locals as the previous frame
+	// and a single stack item.
+	SameLocals1StackItemFrame
+
+	// ChopFrame removes the last Chop locals of the previous frame.
+	// The stack is empty.
+	ChopFrame
+
+	// AppendFrame adds Locals to the previous frame locals.
+	// The stack is empty.
+	AppendFrame
+
+	// FullFrame describes all locals and stack items explicitly.
+	FullFrame
+)
+
+// VerificationTag is a verification_type_info tag.
+type VerificationTag uint8
+
+const (
+	VerifTop               VerificationTag = 0
+	VerifInteger           VerificationTag = 1
+	VerifFloat             VerificationTag = 2
+	VerifDouble            VerificationTag = 3
+	VerifLong              VerificationTag = 4
+	VerifNull              VerificationTag = 5
+	VerifUninitializedThis VerificationTag = 6
+	VerifObject            VerificationTag = 7
+	VerifUninitialized     VerificationTag = 8
+)
+
+// VerificationType is a stack map frame locals or stack item type.
+type VerificationType struct {
+	Tag VerificationTag
+
+	// ClassName is a referenced class for the VerifObject types.
+	// Array classes use the descriptor syntax, like "[I".
+	ClassName string
+
+	// Offset is a new instruction offset for the VerifUninitialized types.
+	Offset uint16
+}
+
+// IsWide reports whether typ occupies two local variable or stack slots.
+func (typ VerificationType) IsWide() bool {
+	return typ.Tag == VerifLong || typ.Tag == VerifDouble
+}
@@ -1,16 +1,92 @@
 package jclass
 
 import (
-	"bytes"
-	"encoding/binary"
+	"fmt"
 	"unicode/utf16"
+	"unicode/utf8"
 )
 
-func decodeUtf16(s []byte) (string, error) {
-	// Not very efficient, but correct. Can speed it up later.
-	pairs := make([]uint16, len(s)/2)
-	if err := binary.Read(bytes.NewReader(s), binary.BigEndian, &pairs); err != nil {
-		return "", err
+// decodeModifiedUtf8 converts a JVM "modified UTF-8" string to Go string.
+//
+// Modified UTF-8 differs from the standard encoding in two ways:
+//   - NUL character is encoded as 2 bytes (0xC0 0x80), so there are no zero bytes
+//   - Supplementary characters are encoded as UTF-16 surrogate pairs
+//     and every surrogate takes 3 bytes
+//
+// Unpaired surrogates are replaced with utf8.RuneError.
+func decodeModifiedUtf8(s []byte) (string, error) {
+	// Fast path: most strings are pure ASCII
+	// and their encoding is identical.
+	isASCII := true
+	for _, b := range s {
+		if b == 0 || b >= utf8.RuneSelf {
+			isASCII = false
+			break
+		}
 	}
-	return string(utf16.Decode(pairs)), nil
+	if isASCII {
+		return string(s), nil
+	}
+
+	units := make([]uint16, 0, len(s))
+	i := 0
+	for i < len(s) {
+		b := s[i]
+		switch {
+		case b == 0:
+			return "", fmt.Errorf("byte %d: unexpected zero byte", i)
+		case b < 0x80: // 0xxxxxxx
+			units = append(units, uint16(b))
+			i++
+		case b&0xE0 == 0xC0: // 110xxxxx 10xxxxxx
+			if i+1 >= len(s) || !isContinuationByte(s[i+1]) {
+				return "", fmt.Errorf("byte %d: invalid 2-byte sequence", i)
+			}
+			units = append(units, uint16(b&0x1F)<<6|uint16(s[i+1]&0x3F))
+			i += 2
+		case b&0xF0 == 0xE0: // 1110xxxx 10xxxxxx 10xxxxxx
+			if i+2 >= len(s) || !isContinuationByte(s[i+1]) || !isContinuationByte(s[i+2]) {
+				return "", fmt.Errorf("byte %d: invalid 3-byte sequence", i)
+			}
+			units = append(units, uint16(b&0x0F)<<12|uint16(s[i+1]&0x3F)<<6|uint16(s[i+2]&0x3F))
+			i += 3
+		default:
+			return "", fmt.Errorf("byte %d: unexpected byte 0x%02X", i, b)
+		}
+	}
+	return decodeUtf16(units), nil
+}
+
+// appendModifiedUtf8 appends a modified UTF-8 encoding of s to dst.
+// See decodeModifiedUtf8 for the details.
+func appendModifiedUtf8(dst []byte, s string) []byte {
+	for _, r := range s {
+		switch {
+		case r == 0:
+			dst = append(dst, 0xC0, 0x80)
+		case r < 0x80:
+			dst = append(dst, byte(r))
+		case r < 0x800:
+			dst = append(dst, 0xC0|byte(r>>6), 0x80|byte(r&0x3F))
+		case r < 0x10000:
+			dst = appendModifiedUtf8Unit(dst, uint16(r))
+		default:
+			r1, r2 := utf16.EncodeRune(r)
+			dst = appendModifiedUtf8Unit(dst, uint16(r1))
+			dst = appendModifiedUtf8Unit(dst, uint16(r2))
+		}
+	}
+	return dst
+}
+
+func appendModifiedUtf8Unit(dst []byte, u uint16) []byte {
+	return append(dst, 0xE0|byte(u>>12), 0x80|byte((u>>6)&0x3F), 0x80|byte(u&0x3F))
+}
+
+func isContinuationByte(b byte) bool {
+	return b&0xC0 == 0x80
+}
+
+func decodeUtf16(units []uint16) string {
+	return string(utf16.Decode(units))
 }
@@ -0,0 +1,91 @@
+package jclass
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestModifiedUtf8(t *testing.T) {
+	tests := []struct {
+		s   string
+		enc []byte
+	}{
+		{"", []byte{}},
+		{"main", []byte("main")},
+		{"a\x00b", []byte{'a', 0xC0, 0x80, 'b'}},
+		{"\x00", []byte{0xC0, 0x80}},
+		{"é", []byte{0xC3, 0xA9}},
+		{"Ω", []byte{0xCE, 0xA9}},
+		{"日本", []byte{0xE6, 0x97, 0xA5, 0xE6, 0x9C, 0xAC}},
+		// U+1F600 is encoded as a D83D DE00 surrogate pair.
+		{"😀", []byte{0xED, 0xA0, 0xBD, 0xED, 0xB8, 0x80}},
+		{"get😀\x00x", []byte{
+			'g', 'e', 't',
+			0xED, 0xA0, 0xBD, 0xED, 0xB8, 0x80,
+			0xC0, 0x80,
+			'x',
+		}},
+	}
+
+	for _, test := range tests {
+		enc := appendModifiedUtf8(nil, test.s)
+		if !bytes.Equal(enc, test.enc) {
+			t.Errorf("encode(%q):\nhave: % x\nwant: % x", test.s, enc, test.enc)
+		}
+		s, err := decodeModifiedUtf8(test.enc)
+		if err != nil {
+			t.Errorf("decode(% x): %v", test.enc, err)
+			continue
+		}
+		if s != test.s {
+			t.Errorf("decode(% x):\nhave: %q\nwant: %q", test.enc, s, test.s)
+		}
+	}
+}
+
+func TestModifiedUtf8Errors(t *testing.T) {
+	tests := [][]byte{
+		{0x00},
+		{'a', 0x00},
+		{0xC0},
+		{0xC0, 'a'},
+		{0xE6, 0x97},
+		{0xE6, 'a', 0xA5},
+		{0xF0, 0x9F, 0x98, 0x80}, // 4-byte sequences are not permitted
+		{0x80},
+		{0xFF},
+	}
+
+	for _, enc := range tests {
+		if s, err := decodeModifiedUtf8(enc); err == nil {
+			t.Errorf("decode(% x): expected an error, got %q", enc, s)
+		}
+	}
+}
+
+func TestDecodeModifiedUtf8Identifiers(t *testing.T) {
+	data, marks := buildTestClass()
+	var dec Decoder
+	f, err := dec.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if f.Methods[0].Name != "f" {
+		t.Fatalf("unexpected method name: %q", f.Methods[0].Name)
+	}
+
+	// Replace "java/lang/Object" (16 bytes) with an identifier of the same
+	// encoded length that contains an emoji and a NUL.
+	enc := appendModifiedUtf8(nil, "pkg/😀\x00Clss")
+	if len(enc) != len("java/lang/Object") {
+		t.Fatalf("unexpected encoded length: %d", len(enc))
+	}
+	copy(data[marks["object"]+len("\x01\x00\x10"):], enc)
+	f, err = dec.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if have := f.Consts[4].(*ClassConst).Name; have != "pkg/😀\x00Clss" {
+		t.Errorf("class name mismatch:\nhave: %q\nwant: %q", have, "pkg/😀\x00Clss")
+	}
+}
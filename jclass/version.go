@@ -0,0 +1,63 @@
+package jclass
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Supported class file major versions range.
+const (
+	// MinMajorVersion is a JDK 1.0.2 class file version.
+	MinMajorVersion = 45
+
+	// MaxMajorVersion is a Java SE 25 class file version.
+	MaxMajorVersion = 69
+)
+
+// ErrUnsupportedVersion is reported for class files of unsupported versions.
+var ErrUnsupportedVersion = errors.New("unsupported class file version")
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// IsPreview reports whether class file depends on the preview features
+// of the Java SE release that corresponds to its major version.
+func (v Version) IsPreview() bool {
+	return v.Major >= 56 && v.Minor == 0xFFFF
+}
+
+// HasStackMapTable reports whether StackMapTable attributes are used
+// by the class file of this version.
+//
+// Older class files don't have them and the type checker ignores
+// StackMapTable attributes if they're present.
+func (v Version) HasStackMapTable() bool {
+	return v.Major >= 50
+}
+
+// HasSubroutines reports whether jsr, jsr_w and ret instructions
+// are permitted in the class file of this version.
+func (v Version) HasSubroutines() bool {
+	return v.Major < 51
+}
+
+func (d *Decoder) checkVersion(v Version) error {
+	if v.Major < MinMajorVersion || v.Major > MaxMajorVersion {
+		return fmt.Errorf("%w %s (supported major versions are %d through %d)",
+			ErrUnsupportedVersion, v, MinMajorVersion, MaxMajorVersion)
+	}
+	if v.Major < 56 {
+		// Minor versions are not restricted before Java SE 12.
+		return nil
+	}
+	switch {
+	case v.IsPreview():
+		if !d.AllowPreview {
+			return fmt.Errorf("%w %s: preview features are not enabled", ErrUnsupportedVersion, v)
+		}
+	case v.Minor != 0:
+		return fmt.Errorf("%w %s: minor version should be 0 or 65535", ErrUnsupportedVersion, v)
+	}
+	return nil
+}
@@ -9,6 +9,19 @@ import (
 // ClassDependencies returns a list of package names that given class depends on.
 // The list is not sorted.
 func ClassDependencies(c *jclass.File) []string {
+	pkgs := map[string]struct{}{}
+	for _, name := range ClassReferences(c) {
+		i := strings.LastIndexByte(name, '/')
+		if i != -1 {
+			pkgs[name[:i]] = struct{}{}
+		}
+	}
+	return keys(pkgs)
+}
+
+// ClassReferences returns a list of class names that given class refers to.
+// The list is not sorted.
+func ClassReferences(c *jclass.File) []string {
 	visitor := depsFinder{map[string]struct{}{}, c}
 	visitor.addClass(c.SuperClass)
 	visitor.addClasses(c.Interfaces)
@@ -16,7 +29,7 @@ func ClassDependencies(c *jclass.File) []string {
 	visitor.walkFields()
 	visitor.walkMethods()
 	// TODO: deal with inner classes
-	return visitor.keys()
+	return keys(visitor.deps)
 }
 
 type depsFinder struct {
@@ -24,9 +37,9 @@ type depsFinder struct {
 	classFile *jclass.File
 }
 
-func (f *depsFinder) keys() []string {
-	keys := make([]string, 0, len(f.deps))
-	for k := range f.deps {
+func keys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
 		keys = append(keys, k)
 	}
 	return keys
@@ -43,10 +56,7 @@ func (f *depsFinder) walkConsts() {
 }
 
 func (f *depsFinder) addDependency(d string) {
-	i := strings.LastIndexByte(d, '/')
-	if i != -1 {
-		f.deps[d[:i]] = struct{}{}
-	}
+	f.deps[d] = struct{}{}
 }
 
 func (f *depsFinder) addClass(i uint16) {
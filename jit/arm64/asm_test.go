@@ -0,0 +1,419 @@
+package arm64
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type asmExpected struct {
+	line int
+	asm  string
+	enc  string
+}
+
+// asmTests are generated with a help of `testdata/gen.go`.
+var asmTests = []struct {
+	name string
+	want []asmExpected
+	run  func(*Assembler)
+}{
+	{
+		name: "testBranch1",
+		want: []asmExpected{
+			{5, "BEQ forward2", "54000020"},
+			{7, "BGE forward1", "5400004a"},
+			{8, "NOOP", "d503201f"},
+			{10, "NOOP", "d503201f"},
+		},
+		run: func(asm *Assembler) {
+			asm.Beq(2)
+			asm.Label(2)
+			asm.Bge(1)
+			asm.Nop()
+			asm.Label(1)
+			asm.Nop()
+		},
+	},
+
+	{
+		name: "testBranch2",
+		want: []asmExpected{
+			{15, "NOOP", "d503201f"},
+			{16, "BLT l1", "5400006b"},
+			{18, "NOOP", "d503201f"},
+			{19, "BGT l2", "54ffffac"},
+			{21, "BLE l3", "54ffffcd"},
+			{22, "BNE l1", "54ffffe1"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(2)
+			asm.Nop()
+			asm.Blt(1)
+			asm.Label(3)
+			asm.Nop()
+			asm.Bgt(2)
+			asm.Label(1)
+			asm.Ble(3)
+			asm.Bne(1)
+		},
+	},
+
+	{
+		name: "testBranchUnsigned",
+		want: []asmExpected{
+			{27, "BHS l2", "54000082"},
+			{28, "BLO l1", "54ffffe3"},
+			{29, "BHI l2", "54000048"},
+			{30, "BLS l1", "54ffffa9"},
+			{32, "NOOP", "d503201f"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(1)
+			asm.Bhs(2)
+			asm.Blo(1)
+			asm.Bhi(2)
+			asm.Bls(1)
+			asm.Label(2)
+			asm.Nop()
+		},
+	},
+
+	{
+		name: "testJmp",
+		want: []asmExpected{
+			{37, "NOOP", "d503201f"},
+			{38, "JMP l1", "17ffffff"},
+			{40, "JMP l2", "14000000"},
+			{41, "JMP l1", "17fffffd"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(1)
+			asm.Nop()
+			asm.Jmp(1)
+			asm.Label(2)
+			asm.Jmp(2)
+			asm.Jmp(1)
+		},
+	},
+
+	{
+		name: "testCbz",
+		want: []asmExpected{
+			{46, "CBZW R1, l2", "34000041"},
+			{47, "CBNZW R20, l1", "35fffff4"},
+			{49, "CBNZW R0, l2", "35000000"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(1)
+			asm.Cbzw(R1, 2)
+			asm.Cbnzw(R20, 1)
+			asm.Label(2)
+			asm.Cbnzw(R0, 2)
+		},
+	},
+
+	{
+		name: "testAdr",
+		want: []asmExpected{
+			{54, "ADR l2, R0", "10000080"},
+			{55, "NOOP", "d503201f"},
+			{56, "NOOP", "d503201f"},
+			{57, "NOOP", "d503201f"},
+			{59, "ADR l1, R16", "10ffff90"},
+			{60, "ADR l3, R30", "1000003e"},
+			{62, "NOOP", "d503201f"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(1)
+			asm.Adr(2, R0)
+			asm.Nop()
+			asm.Nop()
+			asm.Nop()
+			asm.Label(2)
+			asm.Adr(1, R16)
+			asm.Adr(3, R30)
+			asm.Label(3)
+			asm.Nop()
+		},
+	},
+
+	{
+		name: "testBranchReg",
+		want: []asmExpected{
+			{66, "JMP (R16)", "d61f0200"},
+			{67, "JMP (R0)", "d61f0000"},
+			{68, "CALL (R1)", "d63f0020"},
+			{69, "CALL (R17)", "d63f0220"},
+			{70, "BRK $0", "d4200000"},
+			{71, "BRK $1000", "d4207d00"},
+		},
+		run: func(asm *Assembler) {
+			asm.JmpReg(R16)
+			asm.JmpReg(R0)
+			asm.CallReg(R1)
+			asm.CallReg(R17)
+			asm.Brk(0)
+			asm.Brk(1000)
+		},
+	},
+
+	{
+		name: "testMov",
+		want: []asmExpected{
+			{75, "MOVD R1, R2", "aa0103e2"},
+			{76, "MOVD R30, R19", "aa1e03f3"},
+			{77, "MOVWU R1, R2", "2a0103e2"},
+			{78, "SXTW R0, R1", "93407c01"},
+			{79, "SXTW R20, R3", "93407e83"},
+			{80, "SXTBW R0, R1", "13001c01"},
+			{81, "SXTBW R5, R5", "13001ca5"},
+			{82, "MOVZ $1, R0", "d2800020"},
+			{83, "MOVZ $(0xabcd<<16), R0", "d2b579a0"},
+			{84, "MOVZ $(0xffff<<48), R20", "d2fffff4"},
+			{85, "MOVK $(0x1234<<48), R1", "f2e24681"},
+			{86, "MOVK $(7<<32), R17", "f2c000f1"},
+			{87, "MOVK $0x8000, R2", "f2900002"},
+			{88, "MOVN $(5<<32), R2", "92c000a2"},
+			{89, "WORD $0x92800003", "92800003"},
+		},
+		run: func(asm *Assembler) {
+			asm.MovdRegReg(R1, R2)
+			asm.MovdRegReg(R30, R19)
+			asm.MovwuRegReg(R1, R2)
+			asm.SxtwRegReg(R0, R1)
+			asm.SxtwRegReg(R20, R3)
+			asm.SxtbwRegReg(R0, R1)
+			asm.SxtbwRegReg(R5, R5)
+			asm.MovzConstReg(1, 0, R0)
+			asm.MovzConstReg(0xabcd, 16, R0)
+			asm.MovzConstReg(0xffff, 48, R20)
+			asm.MovkConstReg(0x1234, 48, R1)
+			asm.MovkConstReg(7, 32, R17)
+			asm.MovkConstReg(0x8000, 0, R2)
+			asm.MovnConstReg(5, 32, R2)
+			asm.MovnConstReg(0, 0, R3)
+		},
+	},
+
+	{
+		name: "testMovConst",
+		want: []asmExpected{
+			{93, "WORD $0xd2800000", "d2800000"},
+			{94, "MOVZ $1000, R1", "d2807d01"},
+			{95, "WORD $0x92800002", "92800002"},
+			{96, "MOVN $999, R3", "92807ce3"},
+			{97, "MOVZ $(0x8000<<16), R4", "d2b00004"},
+			{98, "MOVN $(0x7fff<<16), R5", "92afffe5"},
+			{99, "MOVN $0xffff, R10", "929fffea"},
+			{100, "MOVK $(0x8000<<16), R10", "f2b0000a"},
+			{101, "MOVZ $0xffff, R6", "d29fffe6"},
+			{102, "MOVK $(0xffff<<16), R6", "f2bfffe6"},
+			{103, "MOVN $(0x1234<<16), R7", "92a24687"},
+			{104, "MOVN $0xedcb, R11", "929db96b"},
+			{105, "MOVK $(0xedcb<<32), R11", "f2ddb96b"},
+			{106, "MOVZ $0x5678, R8", "d28acf08"},
+			{107, "MOVK $(0x1234<<48), R8", "f2e24688"},
+			{108, "MOVZ $0x4444, R9", "d2888889"},
+			{109, "MOVK $(0x3333<<16), R9", "f2a66669"},
+			{110, "MOVK $(0x2222<<32), R9", "f2c44449"},
+			{111, "MOVK $(0x1111<<48), R9", "f2e22229"},
+		},
+		run: func(asm *Assembler) {
+			asm.MovdConstReg(0, R0)
+			asm.MovdConstReg(1000, R1)
+			asm.MovdConstReg(-1, R2)
+			asm.MovdConstReg(-1000, R3)
+			asm.MovdConstReg(0x80000000, R4)
+			asm.MovdConstReg(^(0x7fff << 16), R5)
+			asm.MovdConstReg(-0x80000000, R10)
+			asm.MovdConstReg(0xffffffff, R6)
+			asm.MovdConstReg(-0x12340001, R7)
+			asm.MovdConstReg(-0x12340000edcc, R11)
+			asm.MovdConstReg(0x1234000000005678, R8)
+			asm.MovdConstReg(0x1111222233334444, R9)
+		},
+	},
+
+	{
+		name: "testMem",
+		want: []asmExpected{
+			{115, "MOVD 8(R0), R1", "f9400401"},
+			{116, "MOVD (R19), R0", "f9400260"},
+			{117, "MOVD -16(R19), R16", "f85f0270"},
+			{118, "MOVD 12(R0), R1", "f840c001"},
+			{119, "MOVD 32760(R0), R1", "f97ffc01"},
+			{120, "MOVD 8(RSP), R2", "f94007e2"},
+			{121, "MOVD R0, (R19)", "f9000260"},
+			{122, "MOVD R0, -16(R19)", "f81f0260"},
+			{123, "MOVD R3, 24(RSP)", "f9000fe3"},
+			{124, "MOVD R1, 255(R2)", "f80ff041"},
+			{125, "MOVW 8(R19), R0", "b9800a60"},
+			{126, "MOVW -4(R19), R1", "b89fc261"},
+			{127, "MOVW 16380(R19), R2", "b9bffe62"},
+			{128, "MOVWU 8(R19), R0", "b9400a60"},
+			{129, "MOVWU -256(R1), R0", "b8500020"},
+			{130, "MOVW R0, 16(R19)", "b9001260"},
+			{131, "MOVW R0, -4(R19)", "b81fc260"},
+			{132, "MOVW R2, 6(R1)", "b8006022"},
+			{133, "MOVB R0, 3(R1)", "39000c20"},
+			{134, "MOVB R3, 4095(R20)", "393ffe83"},
+			{135, "MOVB R3, -1(R20)", "381ff283"},
+			{136, "MOVW (R0)(R1<<2), R3", "b8a17803"},
+			{137, "MOVW (R20)(R9<<2), R20", "b8a97a94"},
+			{138, "MOVW R3, (R0)(R1<<2)", "b8217803"},
+			{139, "MOVW R17, (R2)(R16<<2)", "b8307851"},
+		},
+		run: func(asm *Assembler) {
+			asm.MovdMemReg(R0, R1, 8)
+			asm.MovdMemReg(R19, R0, 0)
+			asm.MovdMemReg(R19, R16, -16)
+			asm.MovdMemReg(R0, R1, 12)
+			asm.MovdMemReg(R0, R1, 32760)
+			asm.MovdMemReg(RSP, R2, 8)
+			asm.MovdRegMem(R0, R19, 0)
+			asm.MovdRegMem(R0, R19, -16)
+			asm.MovdRegMem(R3, RSP, 24)
+			asm.MovdRegMem(R1, R2, 255)
+			asm.MovwMemReg(R19, R0, 8)
+			asm.MovwMemReg(R19, R1, -4)
+			asm.MovwMemReg(R19, R2, 16380)
+			asm.MovwuMemReg(R19, R0, 8)
+			asm.MovwuMemReg(R1, R0, -256)
+			asm.MovwRegMem(R0, R19, 16)
+			asm.MovwRegMem(R0, R19, -4)
+			asm.MovwRegMem(R2, R1, 6)
+			asm.MovbRegMem(R0, R1, 3)
+			asm.MovbRegMem(R3, R20, 4095)
+			asm.MovbRegMem(R3, R20, -1)
+			asm.MovwMemindexReg(R0, R1, R3)
+			asm.MovwMemindexReg(R20, R9, R20)
+			asm.MovwRegMemindex(R3, R0, R1)
+			asm.MovwRegMemindex(R17, R2, R16)
+		},
+	},
+
+	{
+		name: "testMemLarge",
+		want: []asmExpected{
+			{143, "MOVZ $32768, R17", "d2900011"},
+			{144, "MOVD (R19)(R17), R0", "f8716a60"},
+			{145, "MOVN $256, R17", "92802011"},
+			{146, "WORD $0xb8316a81", "b8316a81"},
+			{147, "MOVZ $16384, R17", "d2880011"},
+			{148, "WORD $0xb8b16843", "b8b16843"},
+		},
+		run: func(asm *Assembler) {
+			asm.MovdMemReg(R19, R0, 32768)
+			asm.MovwRegMem(R1, R20, -257)
+			asm.MovwMemReg(R2, R3, 16384)
+		},
+	},
+
+	{
+		name: "testArith",
+		want: []asmExpected{
+			{152, "ADD R1, R2, R3", "8b010043"},
+			{153, "ADDW R19, R0, R0", "0b130000"},
+			{154, "ADD R0<<2, R1, R1", "8b000821"},
+			{155, "ADD R16<<3, R17, R2", "8b100e22"},
+			{156, "SUB R1, R2, R3", "cb010043"},
+			{157, "SUBW R1, R2, R3", "4b010043"},
+			{158, "MUL R1, R0, R2", "9b017c02"},
+			{159, "MULW R1, R0, R0", "1b017c00"},
+			{160, "SDIV R1, R0, R2", "9ac10c02"},
+			{161, "SDIVW R3, R0, R0", "1ac30c00"},
+			{162, "NEG R0, R1", "cb0003e1"},
+			{163, "NEGW R2, R2", "4b0203e2"},
+			{164, "ADD $4095, R2, R3", "913ffc43"},
+			{165, "ADD $16, R19, R19", "91004273"},
+			{166, "ADDW $1, R0, R0", "11000400"},
+			{167, "SUB $16, R19, R19", "d1004273"},
+			{168, "SUB $0, RSP, R1", "d10003e1"},
+			{169, "SUBW $100, R5, R6", "510190a6"},
+		},
+		run: func(asm *Assembler) {
+			asm.AddRegRegReg(R1, R2, R3)
+			asm.AddwRegRegReg(R19, R0, R0)
+			asm.AddShiftRegRegReg(R0, 2, R1, R1)
+			asm.AddShiftRegRegReg(R16, 3, R17, R2)
+			asm.SubRegRegReg(R1, R2, R3)
+			asm.SubwRegRegReg(R1, R2, R3)
+			asm.MulRegRegReg(R1, R0, R2)
+			asm.MulwRegRegReg(R1, R0, R0)
+			asm.SdivRegRegReg(R1, R0, R2)
+			asm.SdivwRegRegReg(R3, R0, R0)
+			asm.NegRegReg(R0, R1)
+			asm.NegwRegReg(R2, R2)
+			asm.AddConstRegReg(4095, R2, R3)
+			asm.AddConstRegReg(16, R19, R19)
+			asm.AddwConstRegReg(1, R0, R0)
+			asm.SubConstRegReg(16, R19, R19)
+			asm.SubConstRegReg(0, RSP, R1)
+			asm.SubwConstRegReg(100, R5, R6)
+		},
+	},
+
+	{
+		name: "testCmp",
+		want: []asmExpected{
+			{173, "CMP R1, R0", "eb01001f"},
+			{174, "CMPW R1, R0", "6b01001f"},
+			{175, "CMPW R20, R3", "6b14007f"},
+			{176, "CMP $4095, R0", "f13ffc1f"},
+			{177, "CMP $0, R2", "f100005f"},
+			{178, "CMPW $7, R0", "71001c1f"},
+			{179, "CMN $1, R0", "b100041f"},
+			{180, "CMNW $100, R9", "3101913f"},
+		},
+		run: func(asm *Assembler) {
+			asm.CmpRegReg(R1, R0)
+			asm.CmpwRegReg(R1, R0)
+			asm.CmpwRegReg(R20, R3)
+			asm.CmpConstReg(4095, R0)
+			asm.CmpConstReg(0, R2)
+			asm.CmpwConstReg(7, R0)
+			asm.CmnConstReg(1, R0)
+			asm.CmnwConstReg(100, R9)
+		},
+	},
+}
+
+func TestAsm(t *testing.T) {
+	for _, test := range asmTests {
+		t.Run(test.name, func(t *testing.T) {
+			asm := NewAssembler()
+			test.run(asm)
+			have := linkToWords(asm)
+			head := have
+			for _, v := range test.want {
+				if !strings.HasPrefix(head, v.enc) {
+					if len(head) >= len(v.enc) {
+						head = head[:len(v.enc)]
+					}
+					t.Fatalf("asmtest.s:%d: %s:\nhave: %s\nwant: %s",
+						v.line, v.asm,
+						head, v.enc)
+				}
+				head = head[len(v.enc):]
+			}
+			if head != "" {
+				t.Fatalf("extra trailing words: %s", head)
+			}
+		})
+	}
+}
+
+// linkToWords returns the assembled code as a sequence of
+// hex-formatted instruction words, the way objdump prints them.
+func linkToWords(asm *Assembler) string {
+	length := asm.Link()
+	buf := make([]byte, length)
+	asm.Put(buf)
+	var sb strings.Builder
+	for i := 0; i+4 <= len(buf); i += 4 {
+		fmt.Fprintf(&sb, "%08x", binary.LittleEndian.Uint32(buf[i:]))
+	}
+	return sb.String()
+}
@@ -0,0 +1,409 @@
+package arm64
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// NewAssembler returns an assembler for the A64 instruction set.
+//
+// R17 (IP1) is used as a scratch register for the memory operands
+// with displacements that can't be encoded in the instruction.
+func NewAssembler() *Assembler {
+	return &Assembler{
+		pending: make([]instruction, 0, 256),
+		jumps:   make([]int, 0, 32),
+		labels:  make([]int, 0, 32),
+	}
+}
+
+type Assembler struct {
+	length  int
+	pending []instruction
+	jumps   []int
+	labels  []int
+}
+
+func (a *Assembler) Reset() {
+	a.length = 0
+	a.pending = a.pending[:0]
+	a.jumps = a.jumps[:0]
+	a.labels = a.labels[:0]
+}
+
+// Index returns an index that will be assigned to the next instruction.
+// After Link, OffsetOf can be used to get its offset.
+func (a *Assembler) Index() int {
+	return len(a.pending)
+}
+
+func (a *Assembler) OffsetOf(index int) int32 {
+	if index == len(a.pending) {
+		return int32(a.length)
+	}
+	return a.pending[index].offset
+}
+
+func (a *Assembler) Link() int {
+	a.link()
+	return a.length
+}
+
+func (a *Assembler) Put(dst []byte) {
+	for _, inst := range a.pending {
+		switch inst.size {
+		case 4:
+			binary.LittleEndian.PutUint32(dst[inst.offset:], inst.opcode)
+		case 8:
+			binary.LittleEndian.PutUint64(dst[inst.offset:], uint64(inst.imm))
+		}
+	}
+}
+
+func (a *Assembler) Label(id int64) {
+	a.labels = append(a.labels, len(a.pending))
+	a.push(instruction{imm: id, flags: flagPseudo})
+}
+
+// Jmp emits an unconditional branch to the label.
+// Its width is fixed (4 bytes), so it can be used to build jump tables.
+func (a *Assembler) Jmp(labelID int64) {
+	a.pushJump(bop, flagBranch26, labelID)
+}
+
+func (a *Assembler) Beq(labelID int64) { a.Bcc(CondEQ, labelID) }
+func (a *Assembler) Bne(labelID int64) { a.Bcc(CondNE, labelID) }
+func (a *Assembler) Bge(labelID int64) { a.Bcc(CondGE, labelID) }
+func (a *Assembler) Bgt(labelID int64) { a.Bcc(CondGT, labelID) }
+func (a *Assembler) Blt(labelID int64) { a.Bcc(CondLT, labelID) }
+func (a *Assembler) Ble(labelID int64) { a.Bcc(CondLE, labelID) }
+func (a *Assembler) Bhs(labelID int64) { a.Bcc(CondHS, labelID) }
+func (a *Assembler) Blo(labelID int64) { a.Bcc(CondLO, labelID) }
+func (a *Assembler) Bhi(labelID int64) { a.Bcc(CondHI, labelID) }
+func (a *Assembler) Bls(labelID int64) { a.Bcc(CondLS, labelID) }
+
+// Bcc emits a conditional branch to the label.
+func (a *Assembler) Bcc(cc Cond, labelID int64) {
+	a.pushJump(bccop|uint32(cc), flagBranch19, labelID)
+}
+
+// Cbzw emits a branch to the label that is taken if 32-bit reg is zero.
+func (a *Assembler) Cbzw(reg uint8, labelID int64) {
+	a.pushJump(cbzwop|uint32(reg), flagBranch19, labelID)
+}
+
+// Cbnzw emits a branch to the label that is taken if 32-bit reg is not zero.
+func (a *Assembler) Cbnzw(reg uint8, labelID int64) {
+	a.pushJump(cbnzwop|uint32(reg), flagBranch19, labelID)
+}
+
+// Adr loads the label address into reg.
+func (a *Assembler) Adr(labelID int64, reg uint8) {
+	a.pushJump(adrop|uint32(reg), flagAdr, labelID)
+}
+
+func (a *Assembler) JmpReg(reg uint8) {
+	a.emit(0xD61F0000 | uint32(reg)<<5)
+}
+
+func (a *Assembler) CallReg(reg uint8) {
+	a.emit(0xD63F0000 | uint32(reg)<<5)
+}
+
+func (a *Assembler) Brk(v uint16) {
+	a.emit(0xD4200000 | uint32(v)<<5)
+}
+
+func (a *Assembler) Nop() {
+	a.emit(nopop)
+}
+
+// Raw emits pre-encoded instructions.
+func (a *Assembler) Raw(words ...uint32) {
+	for _, w := range words {
+		a.emit(w)
+	}
+}
+
+func (a *Assembler) MovdRegReg(srcreg, dstreg uint8) {
+	a.emit(0xAA0003E0 | uint32(srcreg)<<16 | uint32(dstreg))
+}
+
+func (a *Assembler) MovwuRegReg(srcreg, dstreg uint8) {
+	a.emit(0x2A0003E0 | uint32(srcreg)<<16 | uint32(dstreg))
+}
+
+func (a *Assembler) SxtwRegReg(srcreg, dstreg uint8) {
+	a.emit(0x93407C00 | uint32(srcreg)<<5 | uint32(dstreg))
+}
+
+func (a *Assembler) SxtbwRegReg(srcreg, dstreg uint8) {
+	a.emit(0x13001C00 | uint32(srcreg)<<5 | uint32(dstreg))
+}
+
+// MovzConstReg loads v<<shift into reg, other bits are cleared.
+// Shift is one of 0, 16, 32 or 48.
+func (a *Assembler) MovzConstReg(v uint16, shift uint8, reg uint8) {
+	a.emit(0xD2800000 | uint32(shift/16)<<21 | uint32(v)<<5 | uint32(reg))
+}
+
+// MovkConstReg replaces 16 bits of reg at the shift position with v.
+func (a *Assembler) MovkConstReg(v uint16, shift uint8, reg uint8) {
+	a.emit(0xF2800000 | uint32(shift/16)<<21 | uint32(v)<<5 | uint32(reg))
+}
+
+// MovnConstReg loads ^(v<<shift) into reg.
+func (a *Assembler) MovnConstReg(v uint16, shift uint8, reg uint8) {
+	a.emit(0x92800000 | uint32(shift/16)<<21 | uint32(v)<<5 | uint32(reg))
+}
+
+// MovdConstReg loads a 64-bit constant into reg.
+// It uses the shortest MOVZ/MOVN and MOVK sequence.
+func (a *Assembler) MovdConstReg(v int64, reg uint8) {
+	u := uint64(v)
+	zeros, ones := 0, 0
+	for shift := uint(0); shift < 64; shift += 16 {
+		switch uint16(u >> shift) {
+		case 0:
+			zeros++
+		case 0xFFFF:
+			ones++
+		}
+	}
+
+	// When MOVN is used, the skipped chunks are all ones.
+	skip := uint16(0)
+	if ones > zeros {
+		skip = 0xFFFF
+	}
+	first := true
+	for shift := uint8(0); shift < 64; shift += 16 {
+		chunk := uint16(u >> shift)
+		if chunk == skip {
+			continue
+		}
+		switch {
+		case !first:
+			a.MovkConstReg(chunk, shift, reg)
+		case skip == 0:
+			a.MovzConstReg(chunk, shift, reg)
+		default:
+			a.MovnConstReg(^chunk, shift, reg)
+		}
+		first = false
+	}
+	if first {
+		// All chunks are skipped: v is 0 or -1.
+		if skip == 0 {
+			a.MovzConstReg(0, 0, reg)
+		} else {
+			a.MovnConstReg(0, 0, reg)
+		}
+	}
+}
+
+// MovdFixup64Reg emits a 64-bit literal load into reg.
+// The literal is initialized with zero.
+//
+// Returned index can be used to get the literal offset after Link.
+// The literal is 8-byte aligned.
+func (a *Assembler) MovdFixup64Reg(reg uint8) int {
+	if a.length%8 != 0 {
+		a.Nop()
+	}
+	a.emit(0x58000040 | uint32(reg)) // LDR reg, 8(PC)
+	a.emit(bop | 3)                  // JMP 3(PC)
+	a.pending = append(a.pending, instruction{
+		offset: int32(a.length),
+		size:   8,
+		flags:  flagData,
+	})
+	a.length += 8
+	return len(a.pending) - 1
+}
+
+func (a *Assembler) MovdMemReg(srcreg, dstreg uint8, disp int32) {
+	a.mem(ldrd, dstreg, srcreg, disp)
+}
+
+func (a *Assembler) MovdRegMem(srcreg, dstreg uint8, disp int32) {
+	a.mem(strd, srcreg, dstreg, disp)
+}
+
+// MovwMemReg loads a sign-extended 32-bit value.
+func (a *Assembler) MovwMemReg(srcreg, dstreg uint8, disp int32) {
+	a.mem(ldrsw, dstreg, srcreg, disp)
+}
+
+// MovwuMemReg loads a zero-extended 32-bit value.
+func (a *Assembler) MovwuMemReg(srcreg, dstreg uint8, disp int32) {
+	a.mem(ldrw, dstreg, srcreg, disp)
+}
+
+func (a *Assembler) MovwRegMem(srcreg, dstreg uint8, disp int32) {
+	a.mem(strw, srcreg, dstreg, disp)
+}
+
+func (a *Assembler) MovbRegMem(srcreg, dstreg uint8, disp int32) {
+	a.mem(strb, srcreg, dstreg, disp)
+}
+
+// MovwMemindexReg loads a sign-extended 32-bit value from srcreg+index*4.
+func (a *Assembler) MovwMemindexReg(srcreg, index, dstreg uint8) {
+	a.emit(ldrsw.regIndex | 1<<12 | uint32(index)<<16 | uint32(srcreg)<<5 | uint32(dstreg))
+}
+
+// MovwRegMemindex stores a 32-bit value to dstreg+index*4.
+func (a *Assembler) MovwRegMemindex(srcreg, dstreg, index uint8) {
+	a.emit(strw.regIndex | 1<<12 | uint32(index)<<16 | uint32(dstreg)<<5 | uint32(srcreg))
+}
+
+func (a *Assembler) AddRegRegReg(rm, rn, rd uint8) {
+	a.emit(0x8B000000 | regRegReg(rm, rn, rd))
+}
+
+func (a *Assembler) AddwRegRegReg(rm, rn, rd uint8) {
+	a.emit(0x0B000000 | regRegReg(rm, rn, rd))
+}
+
+// AddShiftRegRegReg computes rd = rn + rm<<shift.
+func (a *Assembler) AddShiftRegRegReg(rm, shift, rn, rd uint8) {
+	a.emit(0x8B000000 | uint32(shift)<<10 | regRegReg(rm, rn, rd))
+}
+
+func (a *Assembler) SubRegRegReg(rm, rn, rd uint8) {
+	a.emit(0xCB000000 | regRegReg(rm, rn, rd))
+}
+
+func (a *Assembler) SubwRegRegReg(rm, rn, rd uint8) {
+	a.emit(0x4B000000 | regRegReg(rm, rn, rd))
+}
+
+func (a *Assembler) MulRegRegReg(rm, rn, rd uint8) {
+	a.emit(0x9B007C00 | regRegReg(rm, rn, rd))
+}
+
+func (a *Assembler) MulwRegRegReg(rm, rn, rd uint8) {
+	a.emit(0x1B007C00 | regRegReg(rm, rn, rd))
+}
+
+// SdivRegRegReg computes rd = rn / rm.
+// Division by zero results in 0.
+func (a *Assembler) SdivRegRegReg(rm, rn, rd uint8) {
+	a.emit(0x9AC00C00 | regRegReg(rm, rn, rd))
+}
+
+func (a *Assembler) SdivwRegRegReg(rm, rn, rd uint8) {
+	a.emit(0x1AC00C00 | regRegReg(rm, rn, rd))
+}
+
+func (a *Assembler) NegRegReg(rm, rd uint8) {
+	a.emit(0xCB0003E0 | uint32(rm)<<16 | uint32(rd))
+}
+
+func (a *Assembler) NegwRegReg(rm, rd uint8) {
+	a.emit(0x4B0003E0 | uint32(rm)<<16 | uint32(rd))
+}
+
+// CmpRegReg compares rn with rm.
+func (a *Assembler) CmpRegReg(rm, rn uint8) {
+	a.emit(0xEB00001F | uint32(rm)<<16 | uint32(rn)<<5)
+}
+
+func (a *Assembler) CmpwRegReg(rm, rn uint8) {
+	a.emit(0x6B00001F | uint32(rm)<<16 | uint32(rn)<<5)
+}
+
+// Instructions below have a 12-bit unsigned immediate operand.
+// Callers should check the value with FitsImm12.
+
+func (a *Assembler) AddConstRegReg(v int64, rn, rd uint8) {
+	a.emit(0x91000000 | imm12RegReg(v, rn, rd))
+}
+
+func (a *Assembler) AddwConstRegReg(v int64, rn, rd uint8) {
+	a.emit(0x11000000 | imm12RegReg(v, rn, rd))
+}
+
+func (a *Assembler) SubConstRegReg(v int64, rn, rd uint8) {
+	a.emit(0xD1000000 | imm12RegReg(v, rn, rd))
+}
+
+func (a *Assembler) SubwConstRegReg(v int64, rn, rd uint8) {
+	a.emit(0x51000000 | imm12RegReg(v, rn, rd))
+}
+
+// CmpConstReg compares rn with v.
+func (a *Assembler) CmpConstReg(v int64, rn uint8) {
+	a.emit(0xF1000000 | imm12RegReg(v, rn, ZR))
+}
+
+func (a *Assembler) CmpwConstReg(v int64, rn uint8) {
+	a.emit(0x71000000 | imm12RegReg(v, rn, ZR))
+}
+
+// CmnConstReg compares rn with -v.
+func (a *Assembler) CmnConstReg(v int64, rn uint8) {
+	a.emit(0xB1000000 | imm12RegReg(v, rn, ZR))
+}
+
+func (a *Assembler) CmnwConstReg(v int64, rn uint8) {
+	a.emit(0x31000000 | imm12RegReg(v, rn, ZR))
+}
+
+func (a *Assembler) link() {
+	// TODO: don't use a map here.
+	id2index := make(map[int64]int, len(a.labels))
+	for _, labelIndex := range a.labels {
+		id2index[a.pending[labelIndex].imm] = labelIndex
+	}
+
+	for _, jumpIndex := range a.jumps {
+		jmp := &a.pending[jumpIndex]
+		labelIndex, ok := id2index[jmp.imm]
+		if !ok {
+			panic(fmt.Sprintf("branch to undefined label %d", jmp.imm))
+		}
+		rel := a.pending[labelIndex].offset - jmp.offset
+		switch jmp.flags {
+		case flagBranch26:
+			checkRange(rel/4, 26)
+			jmp.opcode |= uint32(rel/4) & 0x3FFFFFF
+		case flagBranch19:
+			checkRange(rel/4, 19)
+			jmp.opcode |= (uint32(rel/4) & 0x7FFFF) << 5
+		case flagAdr:
+			checkRange(rel, 21)
+			jmp.opcode |= (uint32(rel)&0b11)<<29 | (uint32(rel>>2)&0x7FFFF)<<5
+		}
+	}
+}
+
+func (a *Assembler) pushJump(op uint32, flags uint8, labelID int64) {
+	a.jumps = append(a.jumps, len(a.pending))
+	a.push(instruction{opcode: op, imm: labelID, size: 4, flags: flags})
+}
+
+// mem emits a load or store instruction.
+// It selects the shortest encoding form for the displacement.
+func (a *Assembler) mem(op memOp, rt, base uint8, disp int32) {
+	switch {
+	case disp >= 0 && disp%op.size == 0 && disp/op.size <= 0xFFF:
+		a.emit(op.scaled | uint32(disp/op.size)<<10 | uint32(base)<<5 | uint32(rt))
+	case disp >= -256 && disp <= 255:
+		a.emit(op.unscaled | (uint32(disp)&0x1FF)<<12 | uint32(base)<<5 | uint32(rt))
+	default:
+		a.MovdConstReg(int64(disp), R17)
+		a.emit(op.regIndex | R17<<16 | uint32(base)<<5 | uint32(rt))
+	}
+}
+
+func (a *Assembler) emit(word uint32) {
+	a.push(instruction{opcode: word, size: 4})
+}
+
+func (a *Assembler) push(inst instruction) {
+	inst.offset = int32(a.length)
+	a.length += int(inst.size)
+	a.pending = append(a.pending, inst)
+}
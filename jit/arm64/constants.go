@@ -0,0 +1,94 @@
+package arm64
+
+// Various encoding-related constants taken from the Arm A64 manual.
+
+const (
+	// General purpose registers.
+	// Register 31 is either a zero register or a stack pointer,
+	// depending on the instruction.
+	R0  = 0
+	R1  = 1
+	R2  = 2
+	R3  = 3
+	R4  = 4
+	R5  = 5
+	R6  = 6
+	R7  = 7
+	R8  = 8
+	R9  = 9
+	R10 = 10
+	R11 = 11
+	R12 = 12
+	R13 = 13
+	R14 = 14
+	R15 = 15
+	R16 = 16
+	R17 = 17
+	R18 = 18
+	R19 = 19
+	R20 = 20
+	R21 = 21
+	R22 = 22
+	R23 = 23
+	R24 = 24
+	R25 = 25
+	R26 = 26
+	R27 = 27
+	R28 = 28
+	R29 = 29
+	R30 = 30
+	ZR  = 31
+	RSP = 31
+
+	regBitMask = 0b11111
+)
+
+// Cond is a condition code used by conditional branches.
+type Cond uint8
+
+const (
+	CondEQ Cond = 0b0000
+	CondNE Cond = 0b0001
+	CondHS Cond = 0b0010 // Unsigned >=
+	CondLO Cond = 0b0011 // Unsigned <
+	CondMI Cond = 0b0100
+	CondPL Cond = 0b0101
+	CondVS Cond = 0b0110
+	CondVC Cond = 0b0111
+	CondHI Cond = 0b1000 // Unsigned >
+	CondLS Cond = 0b1001 // Unsigned <=
+	CondGE Cond = 0b1010
+	CondLT Cond = 0b1011
+	CondGT Cond = 0b1100
+	CondLE Cond = 0b1101
+)
+
+const (
+	// Branch opcodes with a zero offset field.
+	bop     = 0x14000000 // B imm26
+	bccop   = 0x54000000 // B.cond imm19
+	cbzwop  = 0x34000000 // CBZ Wt, imm19
+	cbnzwop = 0x35000000 // CBNZ Wt, imm19
+	adrop   = 0x10000000 // ADR Xd, immhi:immlo
+
+	nopop = 0xD503201F
+)
+
+// Load and store opcodes for the 3 addressing forms:
+// unsigned scaled 12-bit offset, signed unscaled 9-bit offset
+// and a register offset.
+type memOp struct {
+	scaled   uint32
+	unscaled uint32
+	regIndex uint32
+	size     int32 // Access width in bytes
+}
+
+var (
+	ldrd  = memOp{0xF9400000, 0xF8400000, 0xF8606800, 8} // LDR Xt
+	strd  = memOp{0xF9000000, 0xF8000000, 0xF8206800, 8} // STR Xt
+	ldrw  = memOp{0xB9400000, 0xB8400000, 0xB8606800, 4} // LDR Wt
+	ldrsw = memOp{0xB9800000, 0xB8800000, 0xB8A06800, 4} // LDRSW Xt
+	strw  = memOp{0xB9000000, 0xB8000000, 0xB8206800, 4} // STR Wt
+	strb  = memOp{0x39000000, 0x38000000, 0x38206800, 1} // STRB Wt
+)
@@ -0,0 +1,22 @@
+package arm64
+
+// instruction is an encoded machine instruction.
+//
+// All A64 instructions are 4 bytes wide, so their offsets are known
+// as soon as they're pushed. We need this intermediate representation
+// for branches linkage.
+type instruction struct {
+	imm    int64  // Label ID for branches and labels, value for data
+	offset int32  // Instruction offset from the code beginning
+	opcode uint32 // Encoded instruction; branches have zero offset fields
+	size   uint8  // 4 for instructions, 8 for data and 0 for labels
+	flags  uint8  // Hints on how to link this instruction
+}
+
+const (
+	flagPseudo   uint8 = 1 << iota
+	flagBranch26       // imm26 offset field, B
+	flagBranch19       // imm19 offset field, B.cond, CBZ and CBNZ
+	flagAdr            // immhi:immlo offset field, ADR
+	flagData           // 64-bit data word
+)
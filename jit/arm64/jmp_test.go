@@ -0,0 +1,87 @@
+package arm64
+
+import (
+	"testing"
+)
+
+func TestBranches(t *testing.T) {
+	checkEncoding := func(t *testing.T, asm *Assembler, want string) {
+		t.Helper()
+		if have := linkToWords(asm); have != want {
+			t.Errorf("encoding mismatch:\nhave: %s\nwant: %s", have, want)
+		}
+	}
+
+	t.Run("jmpForward", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.Jmp(0)
+		asm.Nop()
+		asm.Label(0)
+		checkEncoding(t, asm, "14000002"+"d503201f")
+	})
+
+	t.Run("jmpFar", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.Jmp(0)
+		for i := 0; i < 0x10000; i++ {
+			asm.Nop()
+		}
+		asm.Label(0)
+		asm.Beq(0)
+		have := linkToWords(asm)
+		if have[:8] != "14010001" {
+			t.Errorf("jmp encoding mismatch:\nhave: %s\nwant: 14010001", have[:8])
+		}
+		if have[len(have)-8:] != "54000000" {
+			t.Errorf("beq encoding mismatch:\nhave: %s\nwant: 54000000", have[len(have)-8:])
+		}
+	})
+
+	t.Run("jumpTable", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.Adr(0, R1)
+		asm.AddShiftRegRegReg(R0, 2, R1, R1)
+		asm.JmpReg(R1)
+		asm.Label(0)
+		asm.Jmp(1)
+		asm.Jmp(2)
+		asm.Label(1)
+		asm.Label(2)
+		checkEncoding(t, asm, "10000061"+"8b000821"+"d61f0020"+"14000002"+"14000001")
+	})
+
+	t.Run("fixup", func(t *testing.T) {
+		asm := NewAssembler()
+		index := asm.MovdFixup64Reg(R16)
+		asm.JmpReg(R16)
+		checkEncoding(t, asm, "58000050"+"14000003"+"00000000"+"00000000"+"d61f0200")
+		if offset := asm.OffsetOf(index); offset != 8 {
+			t.Errorf("fixup offset: have %d, want 8", offset)
+		}
+	})
+
+	t.Run("fixupAligned", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.Nop()
+		index := asm.MovdFixup64Reg(R0)
+		checkEncoding(t, asm, "d503201f"+"d503201f"+"58000040"+"14000003"+"00000000"+"00000000")
+		if offset := asm.OffsetOf(index); offset != 16 {
+			t.Errorf("fixup offset: have %d, want 16", offset)
+		}
+	})
+}
+
+func TestBranchOutOfRange(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected a panic")
+		}
+	}()
+	asm := NewAssembler()
+	asm.Cbzw(R0, 0)
+	for i := 0; i < 1<<18; i++ {
+		asm.Nop()
+	}
+	asm.Label(0)
+	asm.Link()
+}
@@ -0,0 +1,181 @@
+#define NOSPLIT 4
+#define NOFRAME 512
+
+TEXT testBranch1(SB), NOSPLIT|NOFRAME, $0-0
+        BEQ forward2 // asm.Beq(2)
+forward2:
+        BGE forward1 // asm.Label(2); asm.Bge(1)
+        NOOP         // asm.Nop()
+forward1:
+        NOOP // asm.Label(1); asm.Nop()
+        RET
+
+TEXT testBranch2(SB), NOSPLIT|NOFRAME, $0-0
+l2:
+        NOOP   // asm.Label(2); asm.Nop()
+        BLT l1 // asm.Blt(1)
+l3:
+        NOOP   // asm.Label(3); asm.Nop()
+        BGT l2 // asm.Bgt(2)
+l1:
+        BLE l3 // asm.Label(1); asm.Ble(3)
+        BNE l1 // asm.Bne(1)
+        RET
+
+TEXT testBranchUnsigned(SB), NOSPLIT|NOFRAME, $0-0
+l1:
+        BHS l2 // asm.Label(1); asm.Bhs(2)
+        BLO l1 // asm.Blo(1)
+        BHI l2 // asm.Bhi(2)
+        BLS l1 // asm.Bls(1)
+l2:
+        NOOP // asm.Label(2); asm.Nop()
+        RET
+
+TEXT testJmp(SB), NOSPLIT|NOFRAME, $0-0
+l1:
+        NOOP   // asm.Label(1); asm.Nop()
+        JMP l1 // asm.Jmp(1)
+l2:
+        JMP l2 // asm.Label(2); asm.Jmp(2)
+        JMP l1 // asm.Jmp(1)
+        RET
+
+TEXT testCbz(SB), NOSPLIT|NOFRAME, $0-0
+l1:
+        CBZW R1, l2   // asm.Label(1); asm.Cbzw(R1, 2)
+        CBNZW R20, l1 // asm.Cbnzw(R20, 1)
+l2:
+        CBNZW R0, l2 // asm.Label(2); asm.Cbnzw(R0, 2)
+        RET
+
+TEXT testAdr(SB), NOSPLIT|NOFRAME, $0-0
+l1:
+        ADR l2, R0 // asm.Label(1); asm.Adr(2, R0)
+        NOOP       // asm.Nop()
+        NOOP       // asm.Nop()
+        NOOP       // asm.Nop()
+l2:
+        ADR l1, R16 // asm.Label(2); asm.Adr(1, R16)
+        ADR l3, R30 // asm.Adr(3, R30)
+l3:
+        NOOP // asm.Label(3); asm.Nop()
+        RET
+
+TEXT testBranchReg(SB), NOSPLIT|NOFRAME, $0-0
+        JMP (R16)  // asm.JmpReg(R16)
+        JMP (R0)   // asm.JmpReg(R0)
+        CALL (R1)  // asm.CallReg(R1)
+        CALL (R17) // asm.CallReg(R17)
+        BRK $0     // asm.Brk(0)
+        BRK $1000  // asm.Brk(1000)
+        RET
+
+TEXT testMov(SB), NOSPLIT|NOFRAME, $0-0
+        MOVD R1, R2                // asm.MovdRegReg(R1, R2)
+        MOVD R30, R19              // asm.MovdRegReg(R30, R19)
+        MOVWU R1, R2               // asm.MovwuRegReg(R1, R2)
+        SXTW R0, R1                // asm.SxtwRegReg(R0, R1)
+        SXTW R20, R3               // asm.SxtwRegReg(R20, R3)
+        SXTBW R0, R1               // asm.SxtbwRegReg(R0, R1)
+        SXTBW R5, R5               // asm.SxtbwRegReg(R5, R5)
+        MOVZ $1, R0                // asm.MovzConstReg(1, 0, R0)
+        MOVZ $(0xabcd<<16), R0     // asm.MovzConstReg(0xabcd, 16, R0)
+        MOVZ $(0xffff<<48), R20    // asm.MovzConstReg(0xffff, 48, R20)
+        MOVK $(0x1234<<48), R1     // asm.MovkConstReg(0x1234, 48, R1)
+        MOVK $(7<<32), R17         // asm.MovkConstReg(7, 32, R17)
+        MOVK $0x8000, R2           // asm.MovkConstReg(0x8000, 0, R2)
+        MOVN $(5<<32), R2          // asm.MovnConstReg(5, 32, R2)
+        WORD $0x92800003           // asm.MovnConstReg(0, 0, R3)
+        RET
+
+TEXT testMovConst(SB), NOSPLIT|NOFRAME, $0-0
+        WORD $0xd2800000             // asm.MovdConstReg(0, R0)
+        MOVZ $1000, R1               // asm.MovdConstReg(1000, R1)
+        WORD $0x92800002             // asm.MovdConstReg(-1, R2)
+        MOVN $999, R3                // asm.MovdConstReg(-1000, R3)
+        MOVZ $(0x8000<<16), R4       // asm.MovdConstReg(0x80000000, R4)
+        MOVN $(0x7fff<<16), R5       // asm.MovdConstReg(^(0x7fff << 16), R5)
+        MOVN $0xffff, R10            // asm.MovdConstReg(-0x80000000, R10)
+        MOVK $(0x8000<<16), R10
+        MOVZ $0xffff, R6             // asm.MovdConstReg(0xffffffff, R6)
+        MOVK $(0xffff<<16), R6
+        MOVN $(0x1234<<16), R7       // asm.MovdConstReg(-0x12340001, R7)
+        MOVN $0xedcb, R11            // asm.MovdConstReg(-0x12340000edcc, R11)
+        MOVK $(0xedcb<<32), R11
+        MOVZ $0x5678, R8             // asm.MovdConstReg(0x1234000000005678, R8)
+        MOVK $(0x1234<<48), R8
+        MOVZ $0x4444, R9             // asm.MovdConstReg(0x1111222233334444, R9)
+        MOVK $(0x3333<<16), R9
+        MOVK $(0x2222<<32), R9
+        MOVK $(0x1111<<48), R9
+        RET
+
+TEXT testMem(SB), NOSPLIT|NOFRAME, $0-0
+        MOVD 8(R0), R1           // asm.MovdMemReg(R0, R1, 8)
+        MOVD (R19), R0           // asm.MovdMemReg(R19, R0, 0)
+        MOVD -16(R19), R16       // asm.MovdMemReg(R19, R16, -16)
+        MOVD 12(R0), R1          // asm.MovdMemReg(R0, R1, 12)
+        MOVD 32760(R0), R1       // asm.MovdMemReg(R0, R1, 32760)
+        MOVD 8(RSP), R2          // asm.MovdMemReg(RSP, R2, 8)
+        MOVD R0, (R19)           // asm.MovdRegMem(R0, R19, 0)
+        MOVD R0, -16(R19)        // asm.MovdRegMem(R0, R19, -16)
+        MOVD R3, 24(RSP)         // asm.MovdRegMem(R3, RSP, 24)
+        MOVD R1, 255(R2)         // asm.MovdRegMem(R1, R2, 255)
+        MOVW 8(R19), R0          // asm.MovwMemReg(R19, R0, 8)
+        MOVW -4(R19), R1         // asm.MovwMemReg(R19, R1, -4)
+        MOVW 16380(R19), R2      // asm.MovwMemReg(R19, R2, 16380)
+        MOVWU 8(R19), R0         // asm.MovwuMemReg(R19, R0, 8)
+        MOVWU -256(R1), R0       // asm.MovwuMemReg(R1, R0, -256)
+        MOVW R0, 16(R19)         // asm.MovwRegMem(R0, R19, 16)
+        MOVW R0, -4(R19)         // asm.MovwRegMem(R0, R19, -4)
+        MOVW R2, 6(R1)           // asm.MovwRegMem(R2, R1, 6)
+        MOVB R0, 3(R1)           // asm.MovbRegMem(R0, R1, 3)
+        MOVB R3, 4095(R20)       // asm.MovbRegMem(R3, R20, 4095)
+        MOVB R3, -1(R20)         // asm.MovbRegMem(R3, R20, -1)
+        MOVW (R0)(R1<<2), R3     // asm.MovwMemindexReg(R0, R1, R3)
+        MOVW (R20)(R9<<2), R20   // asm.MovwMemindexReg(R20, R9, R20)
+        MOVW R3, (R0)(R1<<2)     // asm.MovwRegMemindex(R3, R0, R1)
+        MOVW R17, (R2)(R16<<2)   // asm.MovwRegMemindex(R17, R2, R16)
+        RET
+
+TEXT testMemLarge(SB), NOSPLIT|NOFRAME, $0-0
+        MOVZ $32768, R17         // asm.MovdMemReg(R19, R0, 32768)
+        MOVD (R19)(R17), R0
+        MOVN $256, R17           // asm.MovwRegMem(R1, R20, -257)
+        WORD $0xb8316a81
+        MOVZ $16384, R17         // asm.MovwMemReg(R2, R3, 16384)
+        WORD $0xb8b16843
+        RET
+
+TEXT testArith(SB), NOSPLIT|NOFRAME, $0-0
+        ADD R1, R2, R3         // asm.AddRegRegReg(R1, R2, R3)
+        ADDW R19, R0, R0       // asm.AddwRegRegReg(R19, R0, R0)
+        ADD R0<<2, R1, R1      // asm.AddShiftRegRegReg(R0, 2, R1, R1)
+        ADD R16<<3, R17, R2    // asm.AddShiftRegRegReg(R16, 3, R17, R2)
+        SUB R1, R2, R3         // asm.SubRegRegReg(R1, R2, R3)
+        SUBW R1, R2, R3        // asm.SubwRegRegReg(R1, R2, R3)
+        MUL R1, R0, R2         // asm.MulRegRegReg(R1, R0, R2)
+        MULW R1, R0, R0        // asm.MulwRegRegReg(R1, R0, R0)
+        SDIV R1, R0, R2        // asm.SdivRegRegReg(R1, R0, R2)
+        SDIVW R3, R0, R0       // asm.SdivwRegRegReg(R3, R0, R0)
+        NEG R0, R1             // asm.NegRegReg(R0, R1)
+        NEGW R2, R2            // asm.NegwRegReg(R2, R2)
+        ADD $4095, R2, R3      // asm.AddConstRegReg(4095, R2, R3)
+        ADD $16, R19, R19      // asm.AddConstRegReg(16, R19, R19)
+        ADDW $1, R0, R0        // asm.AddwConstRegReg(1, R0, R0)
+        SUB $16, R19, R19      // asm.SubConstRegReg(16, R19, R19)
+        SUB $0, RSP, R1        // asm.SubConstRegReg(0, RSP, R1)
+        SUBW $100, R5, R6      // asm.SubwConstRegReg(100, R5, R6)
+        RET
+
+TEXT testCmp(SB), NOSPLIT|NOFRAME, $0-0
+        CMP R1, R0             // asm.CmpRegReg(R1, R0)
+        CMPW R1, R0            // asm.CmpwRegReg(R1, R0)
+        CMPW R20, R3           // asm.CmpwRegReg(R20, R3)
+        CMP $4095, R0          // asm.CmpConstReg(4095, R0)
+        CMP $0, R2             // asm.CmpConstReg(0, R2)
+        CMPW $7, R0            // asm.CmpwConstReg(7, R0)
+        CMN $1, R0             // asm.CmnConstReg(1, R0)
+        CMNW $100, R9          // asm.CmnwConstReg(100, R9)
+        RET
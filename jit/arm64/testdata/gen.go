@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	_, err := runCommand("go", "tool", "asm", "asmtest.s")
+	if err != nil {
+		log.Fatalf("asm: %v", err)
+	}
+	out, err := runCommand("go", "tool", "objdump", "asmtest.o")
+	if err != nil {
+		log.Fatalf("objdump: %v", err)
+	}
+	data, err := ioutil.ReadFile("asmtest.s")
+	if err != nil {
+		log.Fatalf("read file: %v", err)
+	}
+	sourceLines := strings.Split(string(data), "\n")
+
+	type asmLine struct {
+		LineNum int
+		loc     string
+		Enc     string
+		Asm     string
+		Comment string
+	}
+	type asmFunc struct {
+		Name  string
+		Lines []asmLine
+	}
+
+	var funcs []asmFunc
+	for _, funcString := range strings.Split(out, "\n\n") {
+		lines := strings.Split(funcString, "\n")
+		var fn asmFunc
+		fn.Name = strings.TrimSuffix(strings.Fields(lines[0])[1], "(SB)")
+		for _, l := range lines[1:] {
+			if l == "" {
+				continue
+			}
+			fields := strings.Fields(l)
+			loc := fields[0]
+			enc := fields[2]
+			var lineNum int
+			fmt.Sscanf(loc, "asmtest.s:%d", &lineNum)
+			src := sourceLines[lineNum-1]
+			parts := strings.Split(src, "//")
+			asm := parts[0]
+			var comment string
+			if len(parts) > 1 {
+				comment = parts[1]
+			}
+			fn.Lines = append(fn.Lines, asmLine{
+				LineNum: lineNum,
+				loc:     loc,
+				Enc:     enc,
+				Asm:     strings.TrimSpace(asm),
+				Comment: comment,
+			})
+		}
+		// Drop the last RET and the alignment padding
+		// that follows it from the lines list.
+		last := len(fn.Lines) - 1
+		for last >= 0 && fn.Lines[last].Asm == "RET" && fn.Lines[last].Enc == "00000000" {
+			last--
+		}
+		if last < 0 || fn.Lines[last].Asm != "RET" {
+			log.Fatalf("%s last line is not RET", fn.Name)
+		}
+		fn.Lines = fn.Lines[:last]
+		funcs = append(funcs, fn)
+	}
+
+	tmpl := template.Must(template.New(`testcase`).Parse(`
+{
+  name: "{{$.Name}}",
+  want: []asmExpected{
+    {{- range $.Lines}}
+      { {{.LineNum}}, "{{.Asm}}", "{{.Enc}}" },
+    {{- end}}
+  },
+  run: func(asm *Assembler) {
+    {{- range $.Lines}} {{.Comment}}; {{end}}
+  },
+},
+`))
+	for _, fn := range funcs {
+		err := tmpl.Execute(os.Stdout, fn)
+		if err != nil {
+			log.Fatalf("run %s template: %v", fn.Name, err)
+		}
+	}
+}
+
+func runCommand(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), "GOARCH=arm64")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, out)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,29 @@
+package arm64
+
+import (
+	"fmt"
+)
+
+// FitsImm12 reports whether v can be encoded as a 12-bit unsigned immediate.
+func FitsImm12(v int64) bool {
+	return v >= 0 && v <= 0xFFF
+}
+
+func regRegReg(rm, rn, rd uint8) uint32 {
+	return uint32(rm)<<16 | uint32(rn)<<5 | uint32(rd)
+}
+
+func imm12RegReg(v int64, rn, rd uint8) uint32 {
+	if !FitsImm12(v) {
+		panic(fmt.Sprintf("%d doesn't fit into imm12", v))
+	}
+	return uint32(v)<<10 | uint32(rn)<<5 | uint32(rd)
+}
+
+// checkRange panics if a signed v doesn't fit into the bits-wide field.
+func checkRange(v int32, bits uint) {
+	limit := int32(1) << (bits - 1)
+	if v < -limit || v >= limit {
+		panic(fmt.Sprintf("offset %d doesn't fit into %d bits", v, bits))
+	}
+}
@@ -0,0 +1,787 @@
+package arm64
+
+import (
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/jclass"
+	"github.com/quasilyte/go-jdk/jit"
+	"github.com/quasilyte/go-jdk/jit/arm64"
+	"github.com/quasilyte/go-jdk/mmap"
+	"github.com/quasilyte/go-jdk/symbol"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+// Register roles, see jruntime/call_arm64.s.
+//
+// Every IR register lives in its frame slot,
+// machine registers only hold the temporary values.
+const (
+	regStack  = arm64.R19 // Frame pointer for the current method
+	regEnv    = arm64.R20 // Env pointer
+	regBranch = arm64.R16 // Indirect branch target
+	regConst  = arm64.R3  // Constants that can't be encoded as immediates
+)
+
+// Compiler implements a class compiler for arm64 (AArch64) architecture.
+type Compiler struct {
+	// Fallback compiles the methods that can't be compiled to machine code.
+	// If it's nil, such methods make the whole compilation fail.
+	Fallback jit.Compiler
+
+	ctx jit.Context
+
+	asm *arm64.Assembler
+
+	// relocs are kept between the Compile calls.
+	// When a method is recompiled, all call sites that refer
+	// to it are patched to use the new machine code.
+	relocs       []relocation
+	methodRelocs int
+	method       *ir.Method
+
+	// failed is a set of methods that are passed to the Fallback.
+	failed map[symbol.ID]bool
+
+	// labelSeq is used to allocate the method-local labels
+	// that don't collide with IR instruction indexes.
+	labelSeq int64
+}
+
+type relocation struct {
+	sourceID     symbol.ID
+	targetID     symbol.ID
+	targetOffset int
+}
+
+// NewCompiler returns a compiler for arm64 platform.
+func NewCompiler() *Compiler {
+	return &Compiler{
+		asm:    arm64.NewAssembler(),
+		relocs: make([]relocation, 0, 64),
+	}
+}
+
+func (cl *Compiler) Compile(ctx jit.Context, packages []*ir.Package) error {
+	cl.ctx = ctx
+	cl.failed = map[symbol.ID]bool{}
+	for _, p := range packages {
+		if err := cl.compilePackage(p); err != nil {
+			return fmt.Errorf("package %s: %v", p.Out.Name, err)
+		}
+	}
+	if len(cl.failed) == 0 {
+		cl.link()
+		return nil
+	}
+
+	fallback := jit.FallbackPackages(packages, cl.failed)
+	// Some of the methods that call the failed ones could
+	// be already compiled. Their machine code is discarded.
+	for id := range cl.failed {
+		cl.dropRelocs(id)
+		cl.getMethodByID(id).Code = nil
+	}
+	cl.link()
+	return cl.Fallback.Compile(ctx, fallback)
+}
+
+func (cl *Compiler) link() {
+	// Relocations patch the literal data words that are
+	// loaded by the LDR instructions, so there is no need
+	// to flush the instruction cache again.
+	// Literals are 8-byte aligned, so the running code
+	// observes either the old or the new address.
+	for _, rel := range cl.relocs {
+		dstMethod := cl.getMethodByID(rel.targetID)
+		srcMethod := cl.getMethodByID(rel.sourceID)
+		addr := uint64(uintptr(unsafe.Pointer(&srcMethod.Code[0])))
+		literal := (*uint64)(unsafe.Pointer(&dstMethod.Code[rel.targetOffset]))
+		atomic.StoreUint64(literal, addr)
+	}
+}
+
+func (cl *Compiler) compilePackage(p *ir.Package) error {
+	for i := range p.Classes {
+		c := &p.Classes[i]
+		for j := range c.Methods {
+			m := &c.Methods[j]
+			err := cl.compileMethod(m)
+			if err != nil && cl.Fallback != nil {
+				cl.relocs = cl.relocs[:len(cl.relocs)-cl.methodRelocs]
+				cl.failed[m.Out.ID] = true
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s.%s%s: %v",
+					c.Name, m.Out.Name, m.Out.Descriptor, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (cl *Compiler) compileMethod(m *ir.Method) error {
+	if len(m.Code) == 0 {
+		return nil
+	}
+
+	if m.Out.Code != nil {
+		// Old machine code is replaced, its call sites are not needed.
+		cl.dropRelocs(m.Out.ID)
+	}
+	cl.asm.Reset()
+	cl.methodRelocs = 0
+	cl.method = m
+	cl.labelSeq = int64(len(m.Code))
+
+	m.CodeOffsets = m.CodeOffsets[:0]
+	for i, inst := range m.Code {
+		m.CodeOffsets = append(m.CodeOffsets, cl.asm.Index())
+		if inst.Flags.IsJumpTarget() {
+			cl.asm.Label(int64(i))
+		}
+		if !cl.assembleInst(inst) {
+			return fmt.Errorf("can't assemble: %s", inst)
+		}
+	}
+
+	length := cl.asm.Link()
+	if length == 0 {
+		return fmt.Errorf("no machine code is generated")
+	}
+	code, err := cl.ctx.Mmap.AllocateExecutable(length)
+	if err != nil {
+		return fmt.Errorf("mmap(%d): %v", length, err)
+	}
+	cl.asm.Put(code)
+	mmap.FlushCode(code)
+	m.Out.Code = code
+	for i, index := range m.CodeOffsets {
+		m.CodeOffsets[i] = int(cl.asm.OffsetOf(index))
+	}
+
+	relocs := cl.relocs[len(cl.relocs)-cl.methodRelocs:]
+	for i := range relocs {
+		rel := &relocs[i]
+		rel.targetOffset = int(cl.asm.OffsetOf(rel.targetOffset))
+	}
+
+	return nil
+}
+
+func (cl *Compiler) assembleInst(inst ir.Inst) bool {
+	asm := cl.asm
+
+	var a1, a2 ir.Arg
+	dst := inst.Dst
+	if len(inst.Args) > 0 {
+		a1 = inst.Args[0]
+	}
+	if len(inst.Args) > 1 {
+		a2 = inst.Args[1]
+	}
+
+	switch inst.Kind {
+	case ir.InstJumpEqual:
+		asm.Beq(a1.Value)
+	case ir.InstJumpGtEq:
+		asm.Bge(a1.Value)
+	case ir.InstJumpGt:
+		asm.Bgt(a1.Value)
+	case ir.InstJumpLtEq:
+		asm.Ble(a1.Value)
+	case ir.InstJumpLt:
+		asm.Blt(a1.Value)
+	case ir.InstJumpNotEqual:
+		asm.Bne(a1.Value)
+	case ir.InstJump:
+		asm.Jmp(a1.Value)
+	case ir.InstSwitch:
+		return cl.assembleSwitch(inst)
+
+	case ir.InstArrayLen:
+		if a1.Kind != ir.ArgReg {
+			return false
+		}
+		cl.loadd(a1, arm64.R0)
+		asm.MovwMemReg(arm64.R0, arm64.R0, 16)
+		cl.storew(arm64.R0, dst)
+	case ir.InstIntArrayGet:
+		aref := a1
+		index := a2
+		if aref.Kind != ir.ArgReg {
+			return false
+		}
+		cl.loadArrayData(aref)
+		switch index.Kind {
+		case ir.ArgIntConst:
+			asm.MovwMemReg(arm64.R0, arm64.R0, int32(index.Value)*4)
+		case ir.ArgReg:
+			cl.loadw(index, arm64.R1)
+			asm.MovwMemindexReg(arm64.R0, arm64.R1, arm64.R0)
+		default:
+			return false
+		}
+		cl.storew(arm64.R0, dst)
+	case ir.InstIntArraySet:
+		aref := a1
+		index := a2
+		v := inst.Args[2]
+		if aref.Kind != ir.ArgReg || !isValue(v) {
+			return false
+		}
+		cl.loadArrayData(aref)
+		cl.loadw(v, arm64.R2)
+		switch index.Kind {
+		case ir.ArgIntConst:
+			asm.MovwRegMem(arm64.R2, arm64.R0, int32(index.Value)*4)
+		case ir.ArgReg:
+			cl.loadw(index, arm64.R1)
+			asm.MovwRegMemindex(arm64.R2, arm64.R0, arm64.R1)
+		default:
+			return false
+		}
+	case ir.InstNewIntArray:
+		fnAddr := cl.ctx.Funcs.NewIntArray
+		ok := cl.assembleCallGo(uintptr(fnAddr), "($I)[I", inst.Dst, inst.Args)
+		if !ok {
+			return false
+		}
+
+	case ir.InstAload:
+		if a1.Kind != ir.ArgReg {
+			return false
+		}
+		cl.loadd(a1, arm64.R0)
+		cl.stored(arm64.R0, dst)
+	case ir.InstLload:
+		if !isValue(a1) {
+			return false
+		}
+		cl.loadd(a1, arm64.R0)
+		cl.stored(arm64.R0, dst)
+	case ir.InstIload:
+		if !isValue(a1) {
+			return false
+		}
+		cl.loadw(a1, arm64.R0)
+		cl.storew(arm64.R0, dst)
+
+	case ir.InstIneg:
+		if a1.Kind != ir.ArgReg {
+			return false
+		}
+		cl.loadw(a1, arm64.R0)
+		asm.NegwRegReg(arm64.R0, arm64.R0)
+		cl.storew(arm64.R0, dst)
+	case ir.InstLneg:
+		if a1.Kind != ir.ArgReg {
+			return false
+		}
+		cl.loadd(a1, arm64.R0)
+		asm.NegRegReg(arm64.R0, arm64.R0)
+		cl.stored(arm64.R0, dst)
+
+	case ir.InstIcmp:
+		if !isValue(a1) || !isValue(a2) {
+			return false
+		}
+		cl.loadw(a1, arm64.R0)
+		if a2.Kind == ir.ArgIntConst {
+			cl.cmpwConst(arm64.R0, a2.Value)
+		} else {
+			cl.loadw(a2, arm64.R1)
+			asm.CmpwRegReg(arm64.R1, arm64.R0)
+		}
+	case ir.InstLcmp:
+		if !isValue(a1) || !isValue(a2) {
+			return false
+		}
+		cl.loadd(a1, arm64.R0)
+		if a2.Kind == ir.ArgIntConst {
+			cl.cmpConst(arm64.R0, a2.Value)
+		} else {
+			cl.loadd(a2, arm64.R1)
+			asm.CmpRegReg(arm64.R1, arm64.R0)
+		}
+	case ir.InstAcmp:
+		// Null reference is represented as 0 int constant.
+		if a1.Kind != ir.ArgReg || !isValue(a2) {
+			return false
+		}
+		cl.loadd(a1, arm64.R0)
+		if a2.Kind == ir.ArgIntConst {
+			asm.CmpConstReg(0, arm64.R0)
+		} else {
+			cl.loadd(a2, arm64.R1)
+			asm.CmpRegReg(arm64.R1, arm64.R0)
+		}
+
+	case ir.InstIret:
+		if !isValue(a1) {
+			return false
+		}
+		cl.loadw(a1, arm64.R0)
+		cl.ret()
+	case ir.InstLret:
+		if !isValue(a1) {
+			return false
+		}
+		cl.loadd(a1, arm64.R0)
+		cl.ret()
+	case ir.InstAret:
+		if a1.Kind != ir.ArgReg {
+			return false
+		}
+		cl.loadd(a1, arm64.R0)
+		cl.ret()
+	case ir.InstRet:
+		cl.ret()
+
+	case ir.InstCallGo:
+		sym := inst.Args[0].SymbolID()
+		pkg := cl.ctx.State.Packages[sym.PackageIndex()]
+		class := pkg.Classes[sym.ClassIndex()]
+		method := class.Methods[sym.MemberIndex()]
+		key := fmt.Sprintf("%s/%s.%s", pkg.Name, class.Name, method.Name)
+		fnAddr := cl.ctx.State.GoFuncs[key]
+		return cl.assembleCallGo(fnAddr, method.Descriptor, inst.Dst, inst.Args[1:])
+
+	case ir.InstCallStatic:
+		return cl.assembleCallStatic(inst)
+
+	case ir.InstIadd, ir.InstIsub:
+		if !isValue(a1) || !isValue(a2) {
+			return false
+		}
+		cl.loadw(a1, arm64.R0)
+		switch {
+		case a2.Kind == ir.ArgIntConst && inst.Kind == ir.InstIadd:
+			cl.addwConst(arm64.R0, a2.Value)
+		case a2.Kind == ir.ArgIntConst:
+			cl.addwConst(arm64.R0, -a2.Value)
+		case inst.Kind == ir.InstIadd:
+			cl.loadw(a2, arm64.R1)
+			asm.AddwRegRegReg(arm64.R1, arm64.R0, arm64.R0)
+		default:
+			cl.loadw(a2, arm64.R1)
+			asm.SubwRegRegReg(arm64.R1, arm64.R0, arm64.R0)
+		}
+		cl.storew(arm64.R0, dst)
+	case ir.InstImul:
+		if !isValue(a1) || !isValue(a2) {
+			return false
+		}
+		cl.loadw(a1, arm64.R0)
+		cl.loadw(a2, arm64.R1)
+		asm.MulwRegRegReg(arm64.R1, arm64.R0, arm64.R0)
+		cl.storew(arm64.R0, dst)
+	case ir.InstIdiv:
+		if a1.Kind != ir.ArgReg || !isValue(a2) {
+			return false
+		}
+		cl.loadw(a1, arm64.R0)
+		cl.loadw(a2, arm64.R1)
+		// SDIV returns 0 for a zero divisor instead of trapping.
+		// Stop the execution like a hardware division would do.
+		nonZero := cl.newLabel()
+		asm.Cbnzw(arm64.R1, nonZero)
+		asm.Brk(0)
+		asm.Label(nonZero)
+		asm.SdivwRegRegReg(arm64.R1, arm64.R0, arm64.R0)
+		cl.storew(arm64.R0, dst)
+
+	case ir.InstConvI2L:
+		if a1.Kind != ir.ArgReg {
+			return false
+		}
+		// 32-bit loads are sign-extending.
+		cl.loadw(a1, arm64.R0)
+		cl.stored(arm64.R0, dst)
+	case ir.InstConvI2B:
+		if !isValue(a1) {
+			return false
+		}
+		cl.loadw(a1, arm64.R0)
+		asm.SxtbwRegReg(arm64.R0, arm64.R0)
+		cl.storew(arm64.R0, dst)
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (cl *Compiler) assembleSwitch(inst ir.Inst) bool {
+	asm := cl.asm
+
+	key := inst.Args[0]
+	defaultLabel := inst.Args[1].Value
+	cases := inst.Args[2:]
+	if key.Kind != ir.ArgReg {
+		return false
+	}
+	n := int64(len(cases) / 2)
+	if n == 0 {
+		asm.Jmp(defaultLabel)
+		return true
+	}
+
+	cl.loadw(key, arm64.R0)
+
+	// Dense switches are lowered to a jump table.
+	// Table entries are branches, 4 bytes each.
+	const minJumpTableCases = 4
+	low := cases[0].Value
+	high := cases[len(cases)-2].Value
+	size := high - low + 1
+	if n >= minJumpTableCases && size <= 2*n {
+		// 32-bit operations zero the upper register bits,
+		// so the key can be used as a 64-bit table index.
+		cl.addwConst(arm64.R0, -low)
+		cl.cmpwConst(arm64.R0, size)
+		asm.Bhs(defaultLabel)
+		table := cl.newLabel()
+		asm.Adr(table, arm64.R1)
+		asm.AddShiftRegRegReg(arm64.R0, 2, arm64.R1, arm64.R1)
+		asm.JmpReg(arm64.R1)
+		asm.Label(table)
+		prev := low - 1
+		for i := 0; i < len(cases); i += 2 {
+			// Gaps between the case keys are filled with default jumps.
+			for v := prev + 1; v < cases[i].Value; v++ {
+				asm.Jmp(defaultLabel)
+			}
+			asm.Jmp(cases[i+1].Value)
+			prev = cases[i].Value
+		}
+		return true
+	}
+
+	cl.assembleSwitchSearch(defaultLabel, cases)
+	return true
+}
+
+// assembleSwitchSearch emits a binary search over the sorted switch cases.
+// The switch key is expected to be loaded into R0.
+func (cl *Compiler) assembleSwitchSearch(defaultLabel int64, cases []ir.Arg) {
+	asm := cl.asm
+
+	n := len(cases) / 2
+	mid := n / 2
+	leftLabel := defaultLabel
+	if mid > 0 {
+		leftLabel = cl.newLabel()
+	}
+	rightLabel := defaultLabel
+	if mid+1 < n {
+		rightLabel = cl.newLabel()
+	}
+	cl.cmpwConst(arm64.R0, cases[mid*2].Value)
+	asm.Blt(leftLabel)
+	asm.Bgt(rightLabel)
+	asm.Jmp(cases[mid*2+1].Value)
+	if leftLabel != defaultLabel {
+		asm.Label(leftLabel)
+		cl.assembleSwitchSearch(defaultLabel, cases[:mid*2])
+	}
+	if rightLabel != defaultLabel {
+		asm.Label(rightLabel)
+		cl.assembleSwitchSearch(defaultLabel, cases[(mid+1)*2:])
+	}
+}
+
+func (cl *Compiler) newLabel() int64 {
+	id := cl.labelSeq
+	cl.labelSeq++
+	return id
+}
+
+func (cl *Compiler) assembleCallStatic(inst ir.Inst) bool {
+	asm := cl.asm
+
+	// Frame size is 16 bytes per every stack slot plus
+	// one extra slot to store the return address.
+	frameSize := cl.method.Out.FrameSlots*16 + 16
+	sym := inst.Args[0].SymbolID()
+	pkg := cl.ctx.State.Packages[sym.PackageIndex()]
+	class := pkg.Classes[sym.ClassIndex()]
+	method := class.Methods[sym.MemberIndex()]
+	i := 1
+	failed := false
+	signature := jclass.MethodDescriptor(method.Descriptor)
+	signature.WalkParams(func(typ jclass.DescriptorType) {
+		arg := inst.Args[i]
+		disp := int32(frameSize + (i-1)*16)
+		i++
+		switch {
+		case typ.Dims != 0:
+			if arg.Kind != ir.ArgReg {
+				failed = true
+				return
+			}
+			cl.loadd(arg, arm64.R0)
+			asm.MovdRegMem(arm64.R0, regStack, disp+8)
+		case typ.Kind == 'I':
+			if !isValue(arg) {
+				failed = true
+				return
+			}
+			cl.loadw(arg, arm64.R0)
+			asm.MovwRegMem(arm64.R0, regStack, disp)
+		case typ.Kind == 'J':
+			if !isValue(arg) {
+				failed = true
+				return
+			}
+			cl.loadd(arg, arm64.R0)
+			asm.MovdRegMem(arm64.R0, regStack, disp)
+		default:
+			failed = true
+		}
+	})
+	if failed {
+		return false
+	}
+
+	cl.addConst(regStack, int64(frameSize))
+	{
+		ret := cl.newLabel()
+		asm.Adr(ret, arm64.R0)
+		asm.MovdRegMem(arm64.R0, regStack, -16)
+		index := asm.MovdFixup64Reg(regBranch)
+		asm.JmpReg(regBranch)
+		cl.pushReloc(inst.Args[0].SymbolID(), index)
+		asm.Label(ret)
+	}
+	cl.addConst(regStack, int64(-frameSize))
+	if inst.Dst.Kind != 0 {
+		typ := signature.ReturnType()
+		switch {
+		case typ.Dims != 0:
+			cl.stored(arm64.R0, inst.Dst)
+		case typ.Kind == 'I':
+			cl.storew(arm64.R0, inst.Dst)
+		case typ.Kind == 'J':
+			cl.stored(arm64.R0, inst.Dst)
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (cl *Compiler) assembleCallGo(fnAddr uintptr, desc string, dst ir.Arg, args []ir.Arg) bool {
+	const (
+		// Go call arguments start right after the saved
+		// link register inside the jcallScalar frame.
+		arg0offset = 8
+		// gocallOffset is a jcallScalar gocall label offset.
+		gocallOffset = 68
+	)
+
+	asm := cl.asm // Just for convenience
+
+	offset := 0
+	i := 0
+	failed := false
+	signature := jclass.MethodDescriptor(desc)
+
+	signature.WalkParams(func(typ jclass.DescriptorType) {
+		arg := args[i]
+		i++
+		switch {
+		case typ.Dims != 0:
+			offset = alignUp(offset, 8)
+			if arg.Kind != ir.ArgReg {
+				failed = true
+				return
+			}
+			cl.loadd(arg, arm64.R0)
+			asm.MovdRegMem(arm64.R0, arm64.RSP, int32(arg0offset+offset))
+			offset += 8
+		case typ.Kind == '$':
+			// Dollar ($) is our special marker for env argument.
+			offset = alignUp(offset, 8)
+			asm.MovdRegMem(regEnv, arm64.RSP, int32(arg0offset+offset))
+			offset += 8
+		case typ.Kind == 'I':
+			offset = alignUp(offset, 4)
+			if !isValue(arg) {
+				failed = true
+				return
+			}
+			cl.loadw(arg, arm64.R0)
+			asm.MovwRegMem(arm64.R0, arm64.RSP, int32(arg0offset+offset))
+			offset += 4
+		case typ.Kind == 'J':
+			offset = alignUp(offset, 8)
+			if !isValue(arg) {
+				failed = true
+				return
+			}
+			cl.loadd(arg, arm64.R0)
+			asm.MovdRegMem(arm64.R0, arm64.RSP, int32(arg0offset+offset))
+			offset += 8
+		default:
+			failed = true // TODO: handle all other argument types
+		}
+	})
+	if failed {
+		return false
+	}
+
+	// The gocall code inside jcallScalar saves R0 return address
+	// and restores our stack and env registers after the call.
+	ret := cl.newLabel()
+	asm.MovdConstReg(int64(fnAddr), arm64.R1)
+	asm.Adr(ret, arm64.R0)
+	asm.MovdConstReg(int64(cl.ctx.Funcs.JcallScalar+gocallOffset), regBranch)
+	asm.JmpReg(regBranch)
+	asm.Label(ret)
+	if dst.Kind != 0 {
+		// Return values start from a location aligned to a pointer size.
+		offset = alignUp(offset, 8)
+		typ := signature.ReturnType()
+		switch {
+		case typ.Dims != 0 || typ.Kind == 'L':
+			asm.MovdMemReg(arm64.RSP, arm64.R0, int32(arg0offset+offset))
+			cl.stored(arm64.R0, dst)
+		case typ.Kind == 'I':
+			asm.MovwMemReg(arm64.RSP, arm64.R0, int32(arg0offset+offset))
+			cl.storew(arm64.R0, dst)
+		case typ.Kind == 'J':
+			asm.MovdMemReg(arm64.RSP, arm64.R0, int32(arg0offset+offset))
+			cl.stored(arm64.R0, dst)
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// ret emits a return to the address stored in the caller frame.
+func (cl *Compiler) ret() {
+	cl.asm.MovdMemReg(regStack, regBranch, -16)
+	cl.asm.JmpReg(regBranch)
+}
+
+// loadw loads a sign-extended 32-bit value of arg into reg.
+func (cl *Compiler) loadw(arg ir.Arg, reg uint8) {
+	if arg.Kind == ir.ArgIntConst {
+		cl.asm.MovdConstReg(int64(int32(arg.Value)), reg)
+		return
+	}
+	cl.asm.MovwMemReg(regStack, reg, scalarDisp(arg))
+}
+
+// loadd loads a 64-bit value of arg into reg.
+func (cl *Compiler) loadd(arg ir.Arg, reg uint8) {
+	if arg.Kind == ir.ArgIntConst {
+		cl.asm.MovdConstReg(arg.Value, reg)
+		return
+	}
+	cl.asm.MovdMemReg(regStack, reg, regDisp(arg))
+}
+
+func (cl *Compiler) storew(reg uint8, dst ir.Arg) {
+	cl.asm.MovwRegMem(reg, regStack, scalarDisp(dst))
+}
+
+func (cl *Compiler) stored(reg uint8, dst ir.Arg) {
+	cl.asm.MovdRegMem(reg, regStack, regDisp(dst))
+}
+
+// loadArrayData loads aref array data pointer into R0.
+func (cl *Compiler) loadArrayData(aref ir.Arg) {
+	cl.loadd(aref, arm64.R0)
+	cl.asm.MovdMemReg(arm64.R0, arm64.R0, 8)
+}
+
+// addwConst adds a 32-bit constant v to reg.
+func (cl *Compiler) addwConst(reg uint8, v int64) {
+	v = int64(int32(v))
+	switch {
+	case v == 0:
+		// Nothing to do.
+	case arm64.FitsImm12(v):
+		cl.asm.AddwConstRegReg(v, reg, reg)
+	case arm64.FitsImm12(-v):
+		cl.asm.SubwConstRegReg(-v, reg, reg)
+	default:
+		cl.asm.MovdConstReg(v, regConst)
+		cl.asm.AddwRegRegReg(regConst, reg, reg)
+	}
+}
+
+// addConst adds a 64-bit constant v to reg.
+func (cl *Compiler) addConst(reg uint8, v int64) {
+	switch {
+	case arm64.FitsImm12(v):
+		cl.asm.AddConstRegReg(v, reg, reg)
+	case arm64.FitsImm12(-v):
+		cl.asm.SubConstRegReg(-v, reg, reg)
+	default:
+		cl.asm.MovdConstReg(v, regConst)
+		cl.asm.AddRegRegReg(regConst, reg, reg)
+	}
+}
+
+// cmpwConst compares 32-bit reg with v.
+func (cl *Compiler) cmpwConst(reg uint8, v int64) {
+	v = int64(int32(v))
+	switch {
+	case arm64.FitsImm12(v):
+		cl.asm.CmpwConstReg(v, reg)
+	case arm64.FitsImm12(-v):
+		cl.asm.CmnwConstReg(-v, reg)
+	default:
+		cl.asm.MovdConstReg(v, regConst)
+		cl.asm.CmpwRegReg(regConst, reg)
+	}
+}
+
+// cmpConst compares 64-bit reg with v.
+func (cl *Compiler) cmpConst(reg uint8, v int64) {
+	switch {
+	case arm64.FitsImm12(v):
+		cl.asm.CmpConstReg(v, reg)
+	case arm64.FitsImm12(-v):
+		cl.asm.CmnConstReg(-v, reg)
+	default:
+		cl.asm.MovdConstReg(v, regConst)
+		cl.asm.CmpRegReg(regConst, reg)
+	}
+}
+
+func (cl *Compiler) pushReloc(src symbol.ID, offset int) {
+	cl.methodRelocs++
+	cl.relocs = append(cl.relocs, relocation{
+		sourceID:     src,
+		targetID:     cl.method.Out.ID,
+		targetOffset: offset,
+	})
+}
+
+// dropRelocs removes the relocations that patch the id method code.
+func (cl *Compiler) dropRelocs(id symbol.ID) {
+	relocs := cl.relocs[:0]
+	for _, rel := range cl.relocs {
+		if rel.targetID != id {
+			relocs = append(relocs, rel)
+		}
+	}
+	cl.relocs = relocs
+}
+
+func (cl *Compiler) getMethodByID(id symbol.ID) *vmdat.Method {
+	i1 := id.PackageIndex()
+	i2 := id.ClassIndex()
+	i3 := id.MemberIndex()
+	return &cl.ctx.State.Packages[i1].Classes[i2].Methods[i3]
+}
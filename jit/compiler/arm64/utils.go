@@ -0,0 +1,33 @@
+package arm64
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+)
+
+func ptrDisp(arg ir.Arg) int32 {
+	return int32(arg.Value*16) + 8
+}
+
+func scalarDisp(arg ir.Arg) int32 {
+	return int32(arg.Value * 16)
+}
+
+// regDisp returns a frame slot displacement for the register arg.
+// References and scalars are stored at different slot offsets,
+// the register value type selects the right one.
+func regDisp(arg ir.Arg) int32 {
+	if arg.Type == ir.TypeRef {
+		return ptrDisp(arg)
+	}
+	return scalarDisp(arg)
+}
+
+// isValue reports whether arg is a register or an int constant.
+func isValue(arg ir.Arg) bool {
+	return arg.Kind == ir.ArgReg || arg.Kind == ir.ArgIntConst
+}
+
+// alignUp rounds offset up to a multiple of n.
+func alignUp(offset, n int) int {
+	return (offset + n - 1) &^ (n - 1)
+}
@@ -1,8 +1,9 @@
 package x64
 
 import (
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/quasilyte/go-jdk/ir"
@@ -15,16 +16,44 @@ import (
 
 // Compiler implements a class compiler for x86-64 (amd64) architecture.
 type Compiler struct {
+	// Fallback compiles the methods that can't be compiled to machine code.
+	// If it's nil, such methods make the whole compilation fail.
+	Fallback jit.Compiler
+
 	ctx jit.Context
 
-	packageID uint64
-	classID   uint64
-	methodID  uint64
+	asm *x64.Assembler
 
-	asm          *x64.Assembler
+	// relocs are kept between the Compile calls.
+	// When a method is recompiled, all call sites that refer
+	// to it are patched to use the new machine code.
 	relocs       []relocation
 	methodRelocs int
 	method       *ir.Method
+
+	// failed is a set of methods that are passed to the Fallback.
+	failed map[symbol.ID]bool
+
+	// lazy is set when the compilation of methods is deferred
+	// until their first call, see EnableLazy.
+	// Deferred methods are stored as single method packages.
+	// Until they're compiled, their callers are linked to the stubs.
+	lazy     bool
+	deferred map[symbol.ID]*ir.Package
+
+	// stubs are used by the callers of the methods without machine code:
+	// deferred ones and the ones that are passed to the Fallback.
+	stubs map[symbol.ID][]byte
+
+	// labelSeq is used to allocate the method-local labels
+	// that don't collide with IR instruction indexes.
+	labelSeq int64
+
+	// ra holds the machine registers assigned to the method values.
+	ra regAllocation
+
+	// pos is an index of the instruction being assembled.
+	pos int
 }
 
 type relocation struct {
@@ -38,39 +67,198 @@ func NewCompiler() *Compiler {
 	return &Compiler{
 		asm:    x64.NewAssembler(),
 		relocs: make([]relocation, 0, 64),
+		stubs:  make(map[symbol.ID][]byte),
 	}
 }
 
 func (cl *Compiler) Compile(ctx jit.Context, packages []*ir.Package) error {
 	cl.ctx = ctx
-	cl.relocs = cl.relocs[:0]
+	if cl.lazy {
+		return cl.deferPackages(packages)
+	}
+	return cl.compile(packages)
+}
+
+// EnableLazy makes the subsequent Compile calls defer
+// the methods compilation until their first call.
+func (cl *Compiler) EnableLazy() {
+	cl.lazy = true
+	cl.deferred = make(map[symbol.ID]*ir.Package)
+}
+
+// CompileLazy compiles the deferred id method.
+// It does nothing if the method is not deferred.
+//
+// Lazy methods IR is generated by the context GenerateIR first.
+func (cl *Compiler) CompileLazy(id symbol.ID) error {
+	p := cl.deferred[id]
+	if p == nil {
+		return nil
+	}
+	delete(cl.deferred, id)
+	if p.Classes[0].Methods[0].Lazy {
+		if cl.ctx.GenerateIR == nil {
+			return errors.New("no IR generator for the lazy method")
+		}
+		if err := cl.ctx.GenerateIR(p); err != nil {
+			return err
+		}
+	}
+	return cl.compile([]*ir.Package{p})
+}
+
+func (cl *Compiler) deferPackages(packages []*ir.Package) error {
+	for _, p := range packages {
+		for i := range p.Classes {
+			c := &p.Classes[i]
+			for j := range c.Methods {
+				m := &c.Methods[j]
+				if len(m.Code) == 0 && !m.Lazy {
+					continue
+				}
+				id := m.Out.ID
+				if err := cl.ensureStub(id); err != nil {
+					return fmt.Errorf("%s.%s%s: stub: %v",
+						c.Name, m.Out.Name, m.Out.Descriptor, err)
+				}
+				if m.Out.Code != nil {
+					// Callers of the old machine code are linked to the stub.
+					cl.dropRelocs(id)
+					m.Out.Code = nil
+				}
+				class := *c
+				class.Methods = []ir.Method{*m}
+				cl.deferred[id] = &ir.Package{
+					Out:     p.Out,
+					Classes: []ir.Class{class},
+				}
+			}
+		}
+	}
+	cl.link()
+	return nil
+}
+
+// ensureStub creates the id method stub, unless it already exists.
+func (cl *Compiler) ensureStub(id symbol.ID) error {
+	if cl.stubs[id] != nil {
+		return nil
+	}
+	stub, err := cl.assembleStub(id)
+	if err != nil {
+		return err
+	}
+	cl.stubs[id] = stub
+	return nil
+}
+
+// assembleStub generates the id method stub.
+// Its callers jump to it as if it was a method code.
+//
+// Stub calls the ResolveMethod runtime function which compiles
+// the deferred method and links its callers to the new code.
+// Then the stub jumps to that code with the caller frame intact.
+// If the method is interpreted instead, its result is returned.
+func (cl *Compiler) assembleStub(id symbol.ID) ([]byte, error) {
+	asm := cl.asm
+	asm.Reset()
+
+	asm.MovqMemReg(x64.RBP, x64.RAX, gocallEnvOffset)
+	asm.MovqRegMem(x64.RAX, x64.RBP, gocallArg0Offset)
+	asm.MovqConst64Reg(int64(id), x64.RAX)
+	asm.MovqRegMem(x64.RAX, x64.RBP, gocallArg0Offset+8)
+	asm.MovqRegMem(x64.RSI, x64.RDI, gocallTmp0Offset) // Spill SI
+	asm.MovlConstReg(int64(cl.ctx.Funcs.ResolveMethod), x64.RCX)
+	asm.MovlConstReg(int64(cl.ctx.Funcs.JcallScalar+gocallOffset), x64.RDI)
+	asm.LeaqLabelReg(1, x64.RAX)
+	asm.MovqRegMem(x64.RAX, x64.RBP, -8)
+	asm.JmpReg(x64.RDI)
+	asm.Label(1)
+	asm.MovqMemReg(x64.RBP, x64.RDI, gocallEnvOffset)  // Load DI
+	asm.MovqMemReg(x64.RDI, x64.RSI, gocallTmp0Offset) // Load SI
+	// Results: the method code address and the interpreted method result.
+	asm.MovqMemReg(x64.RBP, x64.RCX, gocallArg0Offset+16)
+	asm.MovqMemReg(x64.RBP, x64.RAX, gocallArg0Offset+24)
+	asm.TestqRegReg(x64.RCX, x64.RCX)
+	asm.Je(0)
+	asm.JmpReg(x64.RCX)
+	asm.Label(0)
+	asm.JmpMem(x64.RSI, -16)
+
+	length := asm.Link()
+	code, err := cl.ctx.Mmap.AllocateExecutable(length)
+	if err != nil {
+		return nil, fmt.Errorf("mmap(%d): %v", length, err)
+	}
+	asm.Put(code)
+	return code, nil
+}
+
+func (cl *Compiler) compile(packages []*ir.Package) error {
+	ctx := cl.ctx
+	cl.failed = map[symbol.ID]bool{}
 	for _, p := range packages {
-		cl.packageID = uint64(p.Out.ID)
 		if err := cl.compilePackage(p); err != nil {
 			return fmt.Errorf("package %s: %v", p.Out.Name, err)
 		}
 	}
+	if len(cl.failed) == 0 {
+		cl.link()
+		return nil
+	}
+
+	var fallback []*ir.Package
+	if ctx.Funcs.ResolveMethod != 0 {
+		// Only the failed methods are passed to the Fallback,
+		// their callers are linked to the stubs.
+		fallback = jit.MethodPackages(packages, cl.failed)
+		for id := range cl.failed {
+			if err := cl.ensureStub(id); err != nil {
+				return fmt.Errorf("stub: %v", err)
+			}
+		}
+	} else {
+		fallback = jit.FallbackPackages(packages, cl.failed)
+	}
+	// Some of the methods that call the failed ones could
+	// be already compiled. Their machine code is discarded.
+	for id := range cl.failed {
+		cl.dropRelocs(id)
+		cl.getMethodByID(id).Code = nil
+	}
 	cl.link()
-	return nil
+	return cl.Fallback.Compile(ctx, fallback)
 }
 
 func (cl *Compiler) link() {
 	for _, rel := range cl.relocs {
 		dstMethod := cl.getMethodByID(rel.targetID)
 		srcMethod := cl.getMethodByID(rel.sourceID)
-		addr := uint64(uintptr(unsafe.Pointer(&srcMethod.Code[0])))
-		binary.LittleEndian.PutUint64(dstMethod.Code[rel.targetOffset:], addr)
+		code := srcMethod.Code
+		if len(code) == 0 {
+			// Deferred or interpreted method.
+			code = cl.stubs[rel.sourceID]
+		}
+		addr := uint64(uintptr(unsafe.Pointer(&code[0])))
+		// Fixups are aligned, so the call sites can be
+		// patched while other Envs are executing them.
+		fixup := (*uint64)(unsafe.Pointer(&dstMethod.Code[rel.targetOffset]))
+		atomic.StoreUint64(fixup, addr)
 	}
 }
 
 func (cl *Compiler) compilePackage(p *ir.Package) error {
 	for i := range p.Classes {
-		cl.classID = uint64(i)
 		c := &p.Classes[i]
 		for j := range c.Methods {
-			cl.methodID = uint64(j)
 			m := &c.Methods[j]
-			if err := cl.compileMethod(m); err != nil {
+			err := cl.compileMethod(m)
+			if err != nil && cl.Fallback != nil {
+				cl.relocs = cl.relocs[:len(cl.relocs)-cl.methodRelocs]
+				cl.failed[m.Out.ID] = true
+				continue
+			}
+			if err != nil {
 				// TODO: print descriptor in a more pretty way.
 				return fmt.Errorf("%s.%s%s: %v",
 					c.Name, m.Out.Name, m.Out.Descriptor, err)
@@ -85,11 +273,25 @@ func (cl *Compiler) compileMethod(m *ir.Method) error {
 		return nil
 	}
 
+	if m.Out.Code != nil {
+		// Old machine code is replaced, its call sites are not needed.
+		cl.dropRelocs(m.Out.ID)
+	}
 	cl.asm.Reset()
 	cl.methodRelocs = 0
 	cl.method = m
+	cl.labelSeq = int64(len(m.Code))
 
+	allocRegisters(&cl.ra, m.Code)
+	// Params are passed through the frame slots.
+	for _, iv := range cl.ra.entry {
+		cl.asm.MovqMemReg(x64.RSI, iv.reg, keyDisp(iv.key))
+	}
+
+	m.CodeOffsets = m.CodeOffsets[:0]
 	for i, inst := range m.Code {
+		cl.pos = i
+		m.CodeOffsets = append(m.CodeOffsets, cl.asm.Index())
 		if inst.Flags.IsJumpTarget() {
 			cl.asm.Label(int64(i))
 		}
@@ -98,6 +300,7 @@ func (cl *Compiler) compileMethod(m *ir.Method) error {
 		}
 	}
 
+	cl.asm.Optimize()
 	length := cl.asm.Link()
 	if length == 0 {
 		return fmt.Errorf("no machine code is generated")
@@ -108,6 +311,9 @@ func (cl *Compiler) compileMethod(m *ir.Method) error {
 	}
 	cl.asm.Put(code)
 	m.Out.Code = code
+	for i, index := range m.CodeOffsets {
+		m.CodeOffsets[i] = int(cl.asm.OffsetOf(index))
+	}
 
 	relocs := cl.relocs[len(cl.relocs)-cl.methodRelocs:]
 	for i := range relocs {
@@ -132,6 +338,8 @@ func (cl *Compiler) assembleInst(inst ir.Inst) bool {
 	}
 
 	switch inst.Kind {
+	case ir.InstJumpEqual:
+		asm.Je(a1.Value)
 	case ir.InstJumpGtEq:
 		asm.Jge(a1.Value)
 	case ir.InstJumpGt:
@@ -144,43 +352,56 @@ func (cl *Compiler) assembleInst(inst ir.Inst) bool {
 		asm.Jne(a1.Value)
 	case ir.InstJump:
 		asm.Jmp(a1.Value)
+	case ir.InstSwitch:
+		return cl.assembleSwitch(inst)
 
 	case ir.InstArrayLen:
-		asm.MovqMemReg(x64.RSI, x64.RAX, ptrDisp(a1))
-		asm.MovlMemReg(x64.RAX, x64.RAX, 16)
-		asm.MovlRegMem(x64.RAX, x64.RSI, scalarDisp(dst))
+		if a1.Kind != ir.ArgReg {
+			return false
+		}
+		base := cl.loadq(a1, x64.RAX)
+		r := cl.dstReg(dst, x64.RAX)
+		asm.MovlMemReg(base, r, 16)
+		cl.storel(r, dst)
 	case ir.InstIntArrayGet:
 		aref := a1
 		index := a2
-		asm.MovqMemReg(x64.RSI, x64.RAX, ptrDisp(aref))
-		asm.MovqMemReg(x64.RAX, x64.RAX, 8)
+		if aref.Kind != ir.ArgReg {
+			return false
+		}
+		cl.loadArrayData(aref)
+		r := cl.dstReg(dst, x64.RAX)
 		switch index.Kind {
 		case ir.ArgIntConst:
-			asm.MovlMemReg(x64.RAX, x64.RAX, int32(index.Value)*4)
+			asm.MovlMemReg(x64.RAX, r, int32(index.Value)*4)
 		case ir.ArgReg:
-			asm.MovlMemReg(x64.RSI, x64.RCX, scalarDisp(index))
-			asm.MovlMemindexReg(x64.RAX, x64.RAX, x64.RCX)
+			cl.movl(index, x64.RCX)
+			asm.MovlMemindexReg(x64.RAX, r, x64.RCX)
+		default:
+			return false
 		}
-		asm.MovlRegMem(x64.RAX, x64.RSI, scalarDisp(dst))
+		cl.storel(r, dst)
 	case ir.InstIntArraySet:
 		aref := a1
 		index := a2
 		v := inst.Args[2]
-		asm.MovqMemReg(x64.RSI, x64.RAX, ptrDisp(aref))
-		asm.MovqMemReg(x64.RAX, x64.RAX, 8)
+		if aref.Kind != ir.ArgReg {
+			return false
+		}
+		cl.loadArrayData(aref)
 		switch {
 		case v.Kind == ir.ArgIntConst && index.Kind == ir.ArgIntConst:
 			asm.MovlConstMem(v.Value, x64.RAX, int32(index.Value)*4)
 		case v.Kind == ir.ArgReg && index.Kind == ir.ArgIntConst:
-			asm.MovlMemReg(x64.RSI, x64.RCX, scalarDisp(v))
-			asm.MovlRegMem(x64.RCX, x64.RAX, int32(index.Value)*4)
+			src := cl.loadl(v, x64.RCX)
+			asm.MovlRegMem(src, x64.RAX, int32(index.Value)*4)
 		case v.Kind == ir.ArgIntConst && index.Kind == ir.ArgReg:
-			asm.MovlMemReg(x64.RSI, x64.RCX, scalarDisp(index))
+			cl.movl(index, x64.RCX)
 			asm.MovlConstMemindex(v.Value, x64.RAX, x64.RCX)
 		case v.Kind == ir.ArgReg && index.Kind == ir.ArgReg:
-			asm.MovlMemReg(x64.RSI, x64.R8, scalarDisp(v))
-			asm.MovlMemReg(x64.RSI, x64.RCX, scalarDisp(index))
-			asm.MovlRegMemindex(x64.R8, x64.RAX, x64.RCX)
+			src := cl.loadl(v, x64.R8)
+			cl.movl(index, x64.RCX)
+			asm.MovlRegMemindex(src, x64.RAX, x64.RCX)
 		default:
 			return false
 		}
@@ -194,77 +415,112 @@ func (cl *Compiler) assembleInst(inst ir.Inst) bool {
 	case ir.InstAload:
 		switch a1.Kind {
 		case ir.ArgReg:
-			asm.MovqMemReg(x64.RSI, x64.RAX, ptrDisp(a1))
-			asm.MovqRegMem(x64.RAX, x64.RSI, ptrDisp(dst))
+			cl.moveq(dst, a1)
 		default:
 			return false
 		}
 	case ir.InstLload:
 		switch a1.Kind {
 		case ir.ArgReg:
-			asm.MovqMemReg(x64.RSI, x64.RAX, scalarDisp(a1))
-			asm.MovqRegMem(x64.RAX, x64.RSI, scalarDisp(dst))
+			cl.moveq(dst, a1)
 		case ir.ArgIntConst:
 			if !fits32bit(a1.Value) {
 				return false
 			}
-			asm.MovqConst32Mem(int32(a1.Value), x64.RSI, scalarDisp(dst))
+			cl.moveq(dst, a1)
 		default:
 			return false
 		}
 
 	case ir.InstIload:
 		switch a1.Kind {
-		case ir.ArgReg:
-			asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
-			asm.MovlRegMem(x64.RAX, x64.RSI, regDisp(dst))
-		case ir.ArgIntConst:
-			asm.MovlConstMem(a1.Value, x64.RSI, regDisp(dst))
+		case ir.ArgReg, ir.ArgIntConst:
+			cl.movel(dst, a1)
 		default:
 			return false
 		}
 
 	case ir.InstIneg:
 		if a1 == dst {
-			asm.NeglMem(x64.RSI, regDisp(a1))
+			if r, ok := cl.allocated(dst); ok {
+				asm.NeglReg(r)
+			} else {
+				asm.NeglMem(x64.RSI, regDisp(a1))
+			}
 		} else {
-			asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
-			asm.NeglReg(x64.RAX)
-			asm.MovlRegMem(x64.RAX, x64.RSI, regDisp(dst))
+			r := cl.dstReg(dst, x64.RAX)
+			cl.movl(a1, r)
+			asm.NeglReg(r)
+			cl.storel(r, dst)
 		}
 	case ir.InstLneg:
 		if a1 == dst {
-			asm.NegqMem(x64.RSI, regDisp(a1))
+			if r, ok := cl.allocated(dst); ok {
+				asm.NegqReg(r)
+			} else {
+				asm.NegqMem(x64.RSI, regDisp(a1))
+			}
 		} else {
-			asm.MovqMemReg(x64.RSI, x64.RAX, regDisp(a1))
-			asm.NegqReg(x64.RAX)
-			asm.MovqRegMem(x64.RAX, x64.RSI, regDisp(dst))
+			r := cl.dstReg(dst, x64.RAX)
+			cl.movq(a1, r)
+			asm.NegqReg(r)
+			cl.storeq(r, dst)
 		}
 
 	case ir.InstIcmp:
 		switch {
 		case a1.Kind == ir.ArgReg && a2.Kind == ir.ArgIntConst:
-			asm.CmplConstMem(a2.Value, x64.RSI, regDisp(a1))
+			if r, ok := cl.allocated(a1); ok {
+				asm.CmplConstReg(a2.Value, r)
+			} else {
+				asm.CmplConstMem(a2.Value, x64.RSI, regDisp(a1))
+			}
 		case a1.Kind == ir.ArgReg && a2.Kind == ir.ArgReg:
-			asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
-			asm.CmplRegMem(x64.RAX, x64.RSI, regDisp(a2))
+			cl.cmpl(cl.loadl(a1, x64.RAX), a2)
+		case a1.Kind == ir.ArgIntConst && a2.Kind == ir.ArgReg:
+			asm.MovlConstReg(a1.Value, x64.RAX)
+			cl.cmpl(x64.RAX, a2)
 		default:
 			return false
 		}
 	case ir.InstLcmp:
 		switch {
 		case a1.Kind == ir.ArgReg && a2.Kind == ir.ArgIntConst:
-			asm.CmpqConstMem(a1.Value, x64.RSI, regDisp(a1))
+			if !fits32bit(a2.Value) {
+				return false
+			}
+			if r, ok := cl.allocated(a1); ok {
+				asm.CmpqConstReg(a2.Value, r)
+			} else {
+				asm.CmpqConstMem(a2.Value, x64.RSI, scalarDisp(a1))
+			}
+		case a1.Kind == ir.ArgReg && a2.Kind == ir.ArgReg:
+			cl.cmpq(cl.loadq(a1, x64.RAX), a2)
+		case a1.Kind == ir.ArgIntConst && a2.Kind == ir.ArgReg:
+			asm.MovqConstReg(a1.Value, x64.RAX)
+			cl.cmpq(x64.RAX, a2)
+		default:
+			return false
+		}
+	case ir.InstAcmp:
+		// Null reference is represented as 0 int constant.
+		switch {
+		case a1.Kind == ir.ArgReg && a2.Kind == ir.ArgIntConst:
+			if r, ok := cl.allocated(a1); ok {
+				asm.CmpqConstReg(0, r)
+			} else {
+				asm.CmpqConstMem(0, x64.RSI, ptrDisp(a1))
+			}
+		case a1.Kind == ir.ArgReg && a2.Kind == ir.ArgReg:
+			cl.cmpq(cl.loadq(a1, x64.RAX), a2)
 		default:
 			return false
 		}
 
 	case ir.InstIret:
 		switch a1.Kind {
-		case ir.ArgReg:
-			asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
-		case ir.ArgIntConst:
-			asm.MovlConstReg(a1.Value, x64.RAX)
+		case ir.ArgReg, ir.ArgIntConst:
+			cl.movl(a1, x64.RAX)
 		default:
 			return false
 		}
@@ -273,17 +529,19 @@ func (cl *Compiler) assembleInst(inst ir.Inst) bool {
 		if a1.Kind != ir.ArgReg {
 			return false
 		}
-		asm.MovqMemReg(x64.RSI, x64.RAX, ptrDisp(a1))
+		cl.movq(a1, x64.RAX)
 		asm.JmpMem(x64.RSI, -16)
 	case ir.InstLret:
 		switch a1.Kind {
 		case ir.ArgReg:
-			asm.MovqMemReg(x64.RSI, x64.RAX, scalarDisp(a1))
+			cl.movq(a1, x64.RAX)
 		case ir.ArgIntConst:
 			if !fits32bit(a1.Value) {
 				return false
 			}
 			asm.MovqConstReg(a1.Value, x64.RAX)
+		default:
+			return false
 		}
 		asm.JmpMem(x64.RSI, -16)
 	case ir.InstRet:
@@ -302,80 +560,101 @@ func (cl *Compiler) assembleInst(inst ir.Inst) bool {
 		return cl.assembleCallStatic(inst)
 
 	case ir.InstIsub:
-		// We use negated argument for AddlConstMem for sub with constants.
-		if a1 == dst {
-			if a2.Kind == ir.ArgIntConst {
-				asm.AddlConstMem(-a2.Value, x64.RSI, regDisp(dst))
-			} else {
-				return false
-			}
+		// We use negated argument for AddlConst for sub with constants.
+		if a1 == dst && a2.Kind == ir.ArgIntConst {
+			cl.addlConst(-a2.Value, dst)
 		} else {
-			switch {
-			case a2.Kind == ir.ArgIntConst:
-				asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
-				asm.AddlConstReg(-a2.Value, x64.RAX)
-				asm.MovlRegMem(x64.RAX, x64.RSI, regDisp(dst))
-			case a2.Kind == ir.ArgReg:
-				asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
-				asm.SublMemReg(x64.RSI, x64.RAX, regDisp(a2))
-				asm.MovlRegMem(x64.RAX, x64.RSI, regDisp(dst))
+			r := cl.binaryOpReg(dst, a2)
+			switch a2.Kind {
+			case ir.ArgIntConst:
+				cl.movl(a1, r)
+				asm.AddlConstReg(-a2.Value, r)
+			case ir.ArgReg:
+				cl.movl(a1, r)
+				if y, ok := cl.allocated(a2); ok {
+					asm.SublRegReg(y, r)
+				} else {
+					asm.SublMemReg(x64.RSI, r, regDisp(a2))
+				}
 			default:
 				return false
 			}
+			cl.storel(r, dst)
 		}
 	case ir.InstIadd:
-		if a1 == dst {
-			if a2.Kind == ir.ArgIntConst {
-				asm.AddlConstMem(a2.Value, x64.RSI, regDisp(dst))
-			} else {
-				return false
-			}
+		if a1 == dst && a2.Kind == ir.ArgIntConst {
+			cl.addlConst(a2.Value, dst)
 		} else {
-			switch {
-			case a2.Kind == ir.ArgIntConst:
-				asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
-				asm.AddlConstReg(a2.Value, x64.RAX)
-				asm.MovlRegMem(x64.RAX, x64.RSI, regDisp(dst))
-			case a2.Kind == ir.ArgReg:
-				asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
-				asm.AddlMemReg(x64.RSI, x64.RAX, regDisp(a2))
-				asm.MovlRegMem(x64.RAX, x64.RSI, regDisp(dst))
+			r := cl.binaryOpReg(dst, a2)
+			switch a2.Kind {
+			case ir.ArgIntConst:
+				cl.movl(a1, r)
+				asm.AddlConstReg(a2.Value, r)
+			case ir.ArgReg:
+				cl.movl(a1, r)
+				if y, ok := cl.allocated(a2); ok {
+					asm.AddlRegReg(y, r)
+				} else {
+					asm.AddlMemReg(x64.RSI, r, regDisp(a2))
+				}
 			default:
 				return false
 			}
+			cl.storel(r, dst)
 		}
 	case ir.InstImul:
 		switch {
 		case a2.Kind == ir.ArgReg:
-			asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
-			asm.ImullMemReg(x64.RSI, x64.RAX, regDisp(a2))
-			asm.MovlRegMem(x64.RAX, x64.RSI, regDisp(dst))
+			r := cl.binaryOpReg(dst, a2)
+			cl.movl(a1, r)
+			if y, ok := cl.allocated(a2); ok {
+				asm.ImullRegReg(y, r)
+			} else {
+				asm.ImullMemReg(x64.RSI, r, regDisp(a2))
+			}
+			cl.storel(r, dst)
 		default:
 			return false
 		}
 	case ir.InstIdiv:
-		switch {
-		case a1.Kind == ir.ArgReg && a2.Kind == ir.ArgReg:
-			asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
+		if a1.Kind != ir.ArgReg {
+			return false
+		}
+		switch a2.Kind {
+		case ir.ArgReg:
+			cl.movl(a1, x64.RAX)
 			asm.Cdq()
-			asm.IdivlMem(x64.RSI, regDisp(a2))
-			asm.MovlRegMem(x64.RAX, x64.RSI, regDisp(dst))
-		case a1.Kind == ir.ArgReg && a2.Kind == ir.ArgIntConst:
-			asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
+			if y, ok := cl.allocated(a2); ok {
+				asm.IdivlReg(y)
+			} else {
+				asm.IdivlMem(x64.RSI, regDisp(a2))
+			}
+		case ir.ArgIntConst:
+			cl.movl(a1, x64.RAX)
 			asm.Cdq()
 			asm.MovlConstReg(a2.Value, x64.RCX)
 			asm.IdivlReg(x64.RCX)
-			asm.MovlRegMem(x64.RAX, x64.RSI, regDisp(dst))
 		default:
 			return false
 		}
+		cl.storel(x64.RAX, dst)
 
 	case ir.InstConvI2L:
-		asm.MovlqsxMemReg(x64.RSI, x64.RAX, regDisp(a1))
-		asm.MovqRegMem(x64.RAX, x64.RSI, regDisp(dst))
+		if a1.Kind != ir.ArgReg {
+			return false
+		}
+		r := cl.dstReg(dst, x64.RAX)
+		if x, ok := cl.allocated(a1); ok {
+			asm.MovlqsxRegReg(x, r)
+		} else {
+			asm.MovlqsxMemReg(x64.RSI, r, regDisp(a1))
+		}
+		cl.storeq(r, dst)
 	case ir.InstConvI2B:
-		asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(a1))
-		asm.MovbRegMem(x64.RAX, x64.RSI, regDisp(dst))
+		r := cl.dstReg(dst, x64.RAX)
+		cl.movl(a1, x64.RAX)
+		asm.MovblsxRegReg(x64.RAX, r)
+		cl.storel(r, dst)
 	default:
 		return false
 	}
@@ -383,6 +662,92 @@ func (cl *Compiler) assembleInst(inst ir.Inst) bool {
 	return true
 }
 
+func (cl *Compiler) assembleSwitch(inst ir.Inst) bool {
+	asm := cl.asm
+
+	key := inst.Args[0]
+	defaultLabel := inst.Args[1].Value
+	cases := inst.Args[2:]
+	if key.Kind != ir.ArgReg {
+		return false
+	}
+	n := int64(len(cases) / 2)
+	if n == 0 {
+		asm.Jmp(defaultLabel)
+		return true
+	}
+
+	cl.movl(key, x64.RAX)
+
+	// Dense switches are lowered to a jump table.
+	// Table entries are rel32 jumps, 5 bytes each.
+	const minJumpTableCases = 4
+	low := cases[0].Value
+	high := cases[len(cases)-2].Value
+	size := high - low + 1
+	if n >= minJumpTableCases && size <= 2*n {
+		if low != 0 {
+			asm.AddlConstReg(-low, x64.RAX)
+		}
+		asm.CmplConstReg(size, x64.RAX)
+		asm.Jae(defaultLabel)
+		tableLabel := cl.newLabel()
+		asm.LeaqMemindexReg(x64.RAX, x64.RCX, x64.RAX, 4, 0) // RCX = RAX*5
+		asm.LeaqLabelReg(tableLabel, x64.RAX)
+		asm.AddqRegReg(x64.RCX, x64.RAX)
+		asm.JmpReg(x64.RAX)
+		asm.Label(tableLabel)
+		prev := low - 1
+		for i := 0; i < len(cases); i += 2 {
+			// Gaps between the case keys are filled with default jumps.
+			for v := prev + 1; v < cases[i].Value; v++ {
+				asm.JmpRel32(defaultLabel)
+			}
+			asm.JmpRel32(cases[i+1].Value)
+			prev = cases[i].Value
+		}
+		return true
+	}
+
+	cl.assembleSwitchSearch(defaultLabel, cases)
+	return true
+}
+
+// assembleSwitchSearch emits a binary search over the sorted switch cases.
+// The switch key is expected to be loaded into RAX.
+func (cl *Compiler) assembleSwitchSearch(defaultLabel int64, cases []ir.Arg) {
+	asm := cl.asm
+
+	n := len(cases) / 2
+	mid := n / 2
+	leftLabel := defaultLabel
+	if mid > 0 {
+		leftLabel = cl.newLabel()
+	}
+	rightLabel := defaultLabel
+	if mid+1 < n {
+		rightLabel = cl.newLabel()
+	}
+	asm.CmplConstReg(cases[mid*2].Value, x64.RAX)
+	asm.Jlt(leftLabel)
+	asm.Jgt(rightLabel)
+	asm.Jmp(cases[mid*2+1].Value)
+	if leftLabel != defaultLabel {
+		asm.Label(leftLabel)
+		cl.assembleSwitchSearch(defaultLabel, cases[:mid*2])
+	}
+	if rightLabel != defaultLabel {
+		asm.Label(rightLabel)
+		cl.assembleSwitchSearch(defaultLabel, cases[(mid+1)*2:])
+	}
+}
+
+func (cl *Compiler) newLabel() int64 {
+	id := cl.labelSeq
+	cl.labelSeq++
+	return id
+}
+
 func (cl *Compiler) assembleCallStatic(inst ir.Inst) bool {
 	asm := cl.asm
 
@@ -405,15 +770,13 @@ func (cl *Compiler) assembleCallStatic(inst ir.Inst) bool {
 				failed = true
 				return
 			}
-			asm.MovqMemReg(x64.RSI, x64.RAX, ptrDisp(arg))
-			asm.MovqRegMem(x64.RAX, x64.RSI, disp+8)
+			asm.MovqRegMem(cl.loadq(arg, x64.RAX), x64.RSI, disp+8)
 		case typ.Kind == 'I':
 			switch arg.Kind {
 			case ir.ArgIntConst:
 				asm.MovlConstMem(arg.Value, x64.RSI, disp)
 			case ir.ArgReg:
-				asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(arg))
-				asm.MovlRegMem(x64.RAX, x64.RSI, disp)
+				asm.MovlRegMem(cl.loadl(arg, x64.RAX), x64.RSI, disp)
 			default:
 				failed = true
 			}
@@ -425,8 +788,7 @@ func (cl *Compiler) assembleCallStatic(inst ir.Inst) bool {
 				}
 				asm.MovqConst32Mem(int32(arg.Value), x64.RSI, disp)
 			case ir.ArgReg:
-				asm.MovqMemReg(x64.RSI, x64.RAX, regDisp(arg))
-				asm.MovqRegMem(x64.RAX, x64.RSI, disp)
+				asm.MovqRegMem(cl.loadq(arg, x64.RAX), x64.RSI, disp)
 			default:
 				failed = true
 			}
@@ -439,26 +801,31 @@ func (cl *Compiler) assembleCallStatic(inst ir.Inst) bool {
 		return false
 	}
 
+	live := cl.saveLive()
 	asm.AddqConstReg(int64(frameSize), x64.RSI)
 	{
-		// The magic disp=16 is a width of instructions that
-		// follow lea inside this block.
-		asm.Raw(0x48, 0x8d, 0x05, 0x10, 0, 0, 0) // lea rax, [rip+16]
+		// The fixup immediate goes after the lea (7 bytes),
+		// the return address store (4 bytes) and the mov opcode (2 bytes).
+		asm.Align(8, 7+4+2)
+		returnLabel := cl.newLabel()
+		asm.LeaqLabelReg(returnLabel, x64.RAX)
 		asm.MovqRegMem(x64.RAX, x64.RSI, -16)
 		index := asm.MovqFixup64Reg(x64.RAX)
 		asm.JmpReg(x64.RAX)
+		asm.Label(returnLabel)
 		cl.pushReloc(inst.Args[0].SymbolID(), index)
 	}
 	asm.AddqConstReg(int64(-frameSize), x64.RSI)
+	cl.restoreLive(live)
 	if inst.Dst.Kind != 0 {
 		typ := signature.ReturnType()
 		switch {
 		case typ.Dims != 0:
-			asm.MovqRegMem(x64.RAX, x64.RSI, ptrDisp(inst.Dst))
+			cl.storeq(x64.RAX, inst.Dst)
 		case typ.Kind == 'I':
-			asm.MovlRegMem(x64.RAX, x64.RSI, regDisp(inst.Dst))
+			cl.storel(x64.RAX, inst.Dst)
 		case typ.Kind == 'J':
-			asm.MovqRegMem(x64.RAX, x64.RSI, regDisp(inst.Dst))
+			cl.storeq(x64.RAX, inst.Dst)
 		default:
 			return false
 		}
@@ -471,11 +838,9 @@ func (cl *Compiler) assembleCallGo(fnAddr uintptr, desc string, dst ir.Arg, args
 	// TODO: refactor and optimize.
 
 	const (
-		arg0offset   = -96
-		gocallOffset = 73
-		frameSize    = 96
-		tmp0offset   = 24
-		envOffset    = 16
+		arg0offset = gocallArg0Offset
+		tmp0offset = gocallTmp0Offset
+		envOffset  = gocallEnvOffset
 	)
 
 	asm := cl.asm // Just for convenience
@@ -496,8 +861,7 @@ func (cl *Compiler) assembleCallGo(fnAddr uintptr, desc string, dst ir.Arg, args
 				failed = true
 				return
 			}
-			asm.MovqMemReg(x64.RSI, x64.RAX, ptrDisp(arg))
-			asm.MovqRegMem(x64.RAX, x64.RBP, int32(arg0offset+offset))
+			asm.MovqRegMem(cl.loadq(arg, x64.RAX), x64.RBP, int32(arg0offset+offset))
 			offset += 8
 		case typ.Kind == '$':
 			// Dollar ($) is our special marker for env argument.
@@ -515,8 +879,7 @@ func (cl *Compiler) assembleCallGo(fnAddr uintptr, desc string, dst ir.Arg, args
 			case ir.ArgIntConst:
 				asm.MovlConstMem(arg.Value, x64.RBP, int32(arg0offset+offset))
 			case ir.ArgReg:
-				asm.MovlMemReg(x64.RSI, x64.RAX, regDisp(arg))
-				asm.MovlRegMem(x64.RAX, x64.RBP, int32(arg0offset+offset))
+				asm.MovlRegMem(cl.loadl(arg, x64.RAX), x64.RBP, int32(arg0offset+offset))
 			default:
 				failed = true
 			}
@@ -532,8 +895,7 @@ func (cl *Compiler) assembleCallGo(fnAddr uintptr, desc string, dst ir.Arg, args
 				}
 				asm.MovqConst32Mem(int32(arg.Value), x64.RBP, int32(arg0offset+offset))
 			case ir.ArgReg:
-				asm.MovqMemReg(x64.RSI, x64.RAX, regDisp(arg))
-				asm.MovqRegMem(x64.RAX, x64.RBP, int32(arg0offset+offset))
+				asm.MovqRegMem(cl.loadq(arg, x64.RAX), x64.RBP, int32(arg0offset+offset))
 			default:
 				failed = true
 			}
@@ -547,14 +909,18 @@ func (cl *Compiler) assembleCallGo(fnAddr uintptr, desc string, dst ir.Arg, args
 		return false
 	}
 
+	live := cl.saveLive()
 	asm.MovqRegMem(x64.RSI, x64.RDI, tmp0offset) // Spill SI
 	asm.MovlConstReg(int64(fnAddr), x64.RCX)
 	asm.MovlConstReg(int64(cl.ctx.Funcs.JcallScalar+gocallOffset), x64.RDI)
-	asm.Raw(0x48, 0x8d, 0x05, 4+2, 0, 0, 0)
+	returnLabel := cl.newLabel()
+	asm.LeaqLabelReg(returnLabel, x64.RAX)
 	asm.MovqRegMem(x64.RAX, x64.RBP, -8)
 	asm.JmpReg(x64.RDI)
+	asm.Label(returnLabel)
 	asm.MovqMemReg(x64.RBP, x64.RDI, envOffset)  // Load DI
 	asm.MovqMemReg(x64.RDI, x64.RSI, tmp0offset) // Load SI
+	cl.restoreLive(live)
 	if dst.Kind != 0 {
 		// Return values start from a location aligned to a pointer size.
 		if rem := offset % 8; rem != 0 {
@@ -564,13 +930,13 @@ func (cl *Compiler) assembleCallGo(fnAddr uintptr, desc string, dst ir.Arg, args
 		switch {
 		case typ.Dims != 0 || typ.Kind == 'L':
 			asm.MovqMemReg(x64.RBP, x64.RAX, int32(arg0offset+offset))
-			asm.MovqRegMem(x64.RAX, x64.RSI, ptrDisp(dst))
+			cl.storeq(x64.RAX, dst)
 		case typ.Kind == 'I':
 			asm.MovlMemReg(x64.RBP, x64.RAX, int32(arg0offset+offset))
-			asm.MovlRegMem(x64.RAX, x64.RSI, regDisp(dst))
+			cl.storel(x64.RAX, dst)
 		case typ.Kind == 'J':
 			asm.MovqMemReg(x64.RBP, x64.RAX, int32(arg0offset+offset))
-			asm.MovqRegMem(x64.RAX, x64.RSI, regDisp(dst))
+			cl.storeq(x64.RAX, dst)
 		default:
 			return false
 		}
@@ -579,15 +945,43 @@ func (cl *Compiler) assembleCallGo(fnAddr uintptr, desc string, dst ir.Arg, args
 	return true
 }
 
+// Go functions are called through the jcallScalar frame,
+// see call_amd64.s inside jruntime package.
+const (
+	// gocallOffset is an offset of the gocall label from the jcallScalar start.
+	gocallOffset = 63
+
+	// gocallArg0Offset is a BP-relative offset of the first Go call argument.
+	// Go call results follow the arguments.
+	gocallArg0Offset = -96
+
+	// gocallEnvOffset is a BP-relative offset of the Env pointer.
+	gocallEnvOffset = 16
+
+	// gocallTmp0Offset is an Env tmp field offset. It's used to spill SI.
+	gocallTmp0Offset = 24
+)
+
 func (cl *Compiler) pushReloc(src symbol.ID, offset int) {
 	cl.methodRelocs++
 	cl.relocs = append(cl.relocs, relocation{
 		sourceID:     src,
-		targetID:     symbol.NewID(cl.packageID, cl.classID, cl.methodID),
+		targetID:     cl.method.Out.ID,
 		targetOffset: offset,
 	})
 }
 
+// dropRelocs removes the relocations that patch the id method code.
+func (cl *Compiler) dropRelocs(id symbol.ID) {
+	relocs := cl.relocs[:0]
+	for _, rel := range cl.relocs {
+		if rel.targetID != id {
+			relocs = append(relocs, rel)
+		}
+	}
+	cl.relocs = relocs
+}
+
 func (cl *Compiler) getMethodByID(id symbol.ID) *vmdat.Method {
 	i1 := id.PackageIndex()
 	i2 := id.ClassIndex()
@@ -0,0 +1,542 @@
+package x64
+
+import (
+	"math/bits"
+	"sort"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/jit/x64"
+)
+
+// allocatableRegs are the machine registers that can hold IR values.
+//
+// RAX, RCX, RDX and R8 are scratch registers of the instruction templates.
+// RSI, RDI and RBP have fixed roles, see jruntime call_amd64.s.
+// R14 and R15 are reserved by the Go internal ABI.
+//
+// All of them are clobbered by the calls, so the values that
+// are live across a call are spilled to their frame slots.
+var allocatableRegs = [...]uint8{
+	x64.RBX,
+	x64.R9,
+	x64.R10,
+	x64.R11,
+	x64.R12,
+	x64.R13,
+}
+
+// valueKey identifies a value storage of the IR register.
+// References and scalars use different frame slot parts,
+// so they're allocated separately.
+type valueKey struct {
+	reg int64
+	ref bool
+}
+
+func argValueKey(arg ir.Arg) valueKey {
+	return valueKey{reg: arg.Value, ref: arg.Type == ir.TypeRef}
+}
+
+// liveInterval is an instruction index range [start, end]
+// in which the value is live. Entry values start at -1.
+type liveInterval struct {
+	key   valueKey
+	start int
+	end   int
+
+	// reg is an assigned machine register.
+	// Only meaningful if allocated is set.
+	reg       uint8
+	allocated bool
+}
+
+// regAllocation is a result of the register allocation for a method.
+type regAllocation struct {
+	regs      map[valueKey]uint8
+	intervals []*liveInterval
+
+	// entry values are loaded from their frame slots on the method entry.
+	entry []*liveInterval
+}
+
+func (ra *regAllocation) reset() {
+	ra.regs = make(map[valueKey]uint8)
+	ra.intervals = ra.intervals[:0]
+	ra.entry = ra.entry[:0]
+}
+
+// liveAcross returns the allocated values that are live
+// before and after the instruction at pos.
+func (ra *regAllocation) liveAcross(pos int) []*liveInterval {
+	var out []*liveInterval
+	for _, iv := range ra.intervals {
+		if iv.allocated && iv.start < pos && iv.end > pos {
+			out = append(out, iv)
+		}
+	}
+	return out
+}
+
+// allocRegisters assigns the machine registers to the method values
+// using the linear scan algorithm (Poletto & Sarkar).
+//
+// Every value gets a single live interval that covers all instructions
+// where it's live, so a value stays in the same location for
+// the whole method. Values that can't be allocated stay in
+// their frame slots, like they do without the register allocation.
+func allocRegisters(ra *regAllocation, code []ir.Inst) {
+	ra.reset()
+
+	// Collect the values and number them.
+	index := make(map[valueKey]int)
+	var keys []valueKey
+	var allocatable []bool
+	addValue := func(arg ir.Arg) {
+		if arg.Kind != ir.ArgReg {
+			return
+		}
+		key := argValueKey(arg)
+		id, ok := index[key]
+		if !ok {
+			id = len(keys)
+			index[key] = id
+			keys = append(keys, key)
+			allocatable = append(allocatable, true)
+		}
+		switch arg.Type {
+		case ir.TypeInt, ir.TypeLong, ir.TypeRef:
+		default:
+			// Float and double values are only moved around by
+			// the backend, it's simpler to keep them in memory.
+			allocatable[id] = false
+		}
+	}
+	for _, inst := range code {
+		addValue(inst.Dst)
+		for _, arg := range inst.Args {
+			addValue(arg)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	blocks := splitBlocks(code)
+	live := computeLiveness(code, blocks, index, len(keys))
+
+	intervals := make([]liveInterval, len(keys))
+	for i := range intervals {
+		intervals[i] = liveInterval{key: keys[i], start: len(code), end: -1}
+	}
+	extend := func(id, pos int) {
+		iv := &intervals[id]
+		if pos < iv.start {
+			iv.start = pos
+		}
+		if pos > iv.end {
+			iv.end = pos
+		}
+	}
+	for i, b := range blocks {
+		live.in[i].forEach(func(id int) { extend(id, b.start) })
+		live.out[i].forEach(func(id int) { extend(id, b.end-1) })
+	}
+	for pos, inst := range code {
+		if inst.Dst.Kind == ir.ArgReg {
+			extend(index[argValueKey(inst.Dst)], pos)
+		}
+		for _, arg := range inst.Args {
+			if arg.Kind == ir.ArgReg {
+				extend(index[argValueKey(arg)], pos)
+			}
+		}
+	}
+	// Entry values are loaded before the first instruction,
+	// so they're live across it if it's a call.
+	live.in[0].forEach(func(id int) { extend(id, -1) })
+
+	var order []*liveInterval
+	for i := range intervals {
+		if allocatable[i] {
+			order = append(order, &intervals[i])
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].start < order[j].start
+	})
+	linearScan(order)
+
+	for i := range intervals {
+		iv := &intervals[i]
+		ra.intervals = append(ra.intervals, iv)
+		if !iv.allocated {
+			continue
+		}
+		ra.regs[iv.key] = iv.reg
+		if live.in[0].has(i) {
+			ra.entry = append(ra.entry, iv)
+		}
+	}
+}
+
+// linearScan assigns registers to the intervals sorted by their start.
+// When there are no free registers, the interval that ends
+// last is spilled.
+func linearScan(intervals []*liveInterval) {
+	// active intervals are sorted by their end.
+	var active []*liveInterval
+	free := uint(1)<<len(allocatableRegs) - 1
+
+	insertActive := func(iv *liveInterval) {
+		i := sort.Search(len(active), func(i int) bool {
+			return active[i].end > iv.end
+		})
+		active = append(active, nil)
+		copy(active[i+1:], active[i:])
+		active[i] = iv
+	}
+
+	for _, iv := range intervals {
+		// Expire the intervals that ended before iv start.
+		// Intervals that end at iv start still occupy their
+		// registers: instruction may read its args after
+		// the destination is written.
+		n := 0
+		for _, a := range active {
+			if a.end >= iv.start {
+				break
+			}
+			free |= 1 << a.regIndex()
+			n++
+		}
+		active = active[n:]
+
+		if free != 0 {
+			i := bits.TrailingZeros(free)
+			free &^= 1 << i
+			iv.reg = allocatableRegs[i]
+			iv.allocated = true
+			insertActive(iv)
+			continue
+		}
+
+		spill := active[len(active)-1]
+		if spill.end > iv.end {
+			iv.reg = spill.reg
+			iv.allocated = true
+			spill.allocated = false
+			active = active[:len(active)-1]
+			insertActive(iv)
+		}
+	}
+}
+
+func (iv *liveInterval) regIndex() uint {
+	for i, reg := range allocatableRegs {
+		if reg == iv.reg {
+			return uint(i)
+		}
+	}
+	panic("unexpected register")
+}
+
+// codeBlock is a basic block of the method code: [start, end) range.
+type codeBlock struct {
+	start int
+	end   int
+	succs []int
+}
+
+// splitBlocks uses the block leader flags to split the code into blocks.
+func splitBlocks(code []ir.Inst) []codeBlock {
+	var blocks []codeBlock
+	inst2block := make(map[int64]int)
+	for i, inst := range code {
+		if i == 0 || inst.Flags.IsBlockLead() {
+			if len(blocks) != 0 {
+				blocks[len(blocks)-1].end = i
+			}
+			inst2block[int64(i)] = len(blocks)
+			blocks = append(blocks, codeBlock{start: i})
+		}
+	}
+	blocks[len(blocks)-1].end = len(code)
+
+	for i := range blocks {
+		b := &blocks[i]
+		last := code[b.end-1]
+		for _, arg := range last.Args {
+			if arg.Kind == ir.ArgBranch {
+				b.succs = append(b.succs, inst2block[arg.Value])
+			}
+		}
+		switch last.Kind {
+		case ir.InstJump, ir.InstSwitch, ir.InstRet, ir.InstIret, ir.InstLret, ir.InstAret:
+		default:
+			if i+1 < len(blocks) {
+				b.succs = append(b.succs, i+1)
+			}
+		}
+	}
+	return blocks
+}
+
+type liveness struct {
+	in  []bitset
+	out []bitset
+}
+
+// computeLiveness solves the backward liveness dataflow problem.
+func computeLiveness(code []ir.Inst, blocks []codeBlock, index map[valueKey]int, numValues int) liveness {
+	uses := make([]bitset, len(blocks))
+	defs := make([]bitset, len(blocks))
+	live := liveness{
+		in:  make([]bitset, len(blocks)),
+		out: make([]bitset, len(blocks)),
+	}
+	for i, b := range blocks {
+		uses[i] = newBitset(numValues)
+		defs[i] = newBitset(numValues)
+		live.in[i] = newBitset(numValues)
+		live.out[i] = newBitset(numValues)
+		for _, inst := range code[b.start:b.end] {
+			for _, arg := range inst.Args {
+				if arg.Kind != ir.ArgReg {
+					continue
+				}
+				if id := index[argValueKey(arg)]; !defs[i].has(id) {
+					uses[i].set(id)
+				}
+			}
+			if inst.Dst.Kind == ir.ArgReg {
+				defs[i].set(index[argValueKey(inst.Dst)])
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(blocks) - 1; i >= 0; i-- {
+			out := live.out[i]
+			for _, succ := range blocks[i].succs {
+				out.unionWith(live.in[succ])
+			}
+			// in = uses | (out &^ defs)
+			for j := range live.in[i] {
+				in := uses[i][j] | (out[j] &^ defs[i][j])
+				if in != live.in[i][j] {
+					live.in[i][j] = in
+					changed = true
+				}
+			}
+		}
+	}
+	return live
+}
+
+type bitset []uint64
+
+func newBitset(n int) bitset { return make(bitset, (n+63)/64) }
+
+func (bs bitset) set(i int)      { bs[i/64] |= 1 << uint(i%64) }
+func (bs bitset) has(i int) bool { return bs[i/64]&(1<<uint(i%64)) != 0 }
+
+func (bs bitset) unionWith(other bitset) {
+	for i := range bs {
+		bs[i] |= other[i]
+	}
+}
+
+func (bs bitset) forEach(fn func(i int)) {
+	for i, word := range bs {
+		for word != 0 {
+			j := bits.TrailingZeros64(word)
+			fn(i*64 + j)
+			word &^= 1 << uint(j)
+		}
+	}
+}
+
+// keyDisp returns a frame slot displacement of the value.
+func keyDisp(key valueKey) int32 {
+	if key.ref {
+		return int32(key.reg*16) + 8
+	}
+	return int32(key.reg * 16)
+}
+
+// allocated reports the machine register that holds arg value.
+func (cl *Compiler) allocated(arg ir.Arg) (uint8, bool) {
+	if arg.Kind != ir.ArgReg {
+		return 0, false
+	}
+	reg, ok := cl.ra.regs[argValueKey(arg)]
+	return reg, ok
+}
+
+// dstReg returns a register that should be used to compute dst.
+// Spilled values are computed in scratch and then stored to memory.
+func (cl *Compiler) dstReg(dst ir.Arg, scratch uint8) uint8 {
+	if reg, ok := cl.allocated(dst); ok {
+		return reg
+	}
+	return scratch
+}
+
+// binaryOpReg is like dstReg, but it avoids the register that holds y.
+// Binary ops load x into the result register before reading y.
+func (cl *Compiler) binaryOpReg(dst, y ir.Arg) uint8 {
+	reg := cl.dstReg(dst, x64.RAX)
+	if yreg, ok := cl.allocated(y); ok && yreg == reg {
+		return x64.RAX
+	}
+	return reg
+}
+
+// loadl returns a register that holds 32-bit arg value.
+// If arg is not allocated, it's loaded into scratch.
+func (cl *Compiler) loadl(arg ir.Arg, scratch uint8) uint8 {
+	if reg, ok := cl.allocated(arg); ok {
+		return reg
+	}
+	cl.movl(arg, scratch)
+	return scratch
+}
+
+// loadq is a 64-bit version of loadl.
+func (cl *Compiler) loadq(arg ir.Arg, scratch uint8) uint8 {
+	if reg, ok := cl.allocated(arg); ok {
+		return reg
+	}
+	cl.movq(arg, scratch)
+	return scratch
+}
+
+// loadArrayData loads aref array data pointer into RAX.
+func (cl *Compiler) loadArrayData(aref ir.Arg) {
+	base := cl.loadq(aref, x64.RAX)
+	cl.asm.MovqMemReg(base, x64.RAX, 8)
+}
+
+// movl copies 32-bit arg value into reg.
+func (cl *Compiler) movl(arg ir.Arg, reg uint8) {
+	if arg.Kind == ir.ArgIntConst {
+		cl.asm.MovlConstReg(arg.Value, reg)
+		return
+	}
+	if src, ok := cl.allocated(arg); ok {
+		if src != reg {
+			cl.asm.MovlRegReg(src, reg)
+		}
+		return
+	}
+	cl.asm.MovlMemReg(x64.RSI, reg, regDisp(arg))
+}
+
+// movq is a 64-bit version of movl.
+func (cl *Compiler) movq(arg ir.Arg, reg uint8) {
+	if arg.Kind == ir.ArgIntConst {
+		cl.asm.MovqConstReg(arg.Value, reg)
+		return
+	}
+	if src, ok := cl.allocated(arg); ok {
+		if src != reg {
+			cl.asm.MovqRegReg(src, reg)
+		}
+		return
+	}
+	cl.asm.MovqMemReg(x64.RSI, reg, regDisp(arg))
+}
+
+// storel copies 32-bit reg value to the dst location.
+func (cl *Compiler) storel(reg uint8, dst ir.Arg) {
+	if r, ok := cl.allocated(dst); ok {
+		if r != reg {
+			cl.asm.MovlRegReg(reg, r)
+		}
+		return
+	}
+	cl.asm.MovlRegMem(reg, x64.RSI, regDisp(dst))
+}
+
+// storeq is a 64-bit version of storel.
+func (cl *Compiler) storeq(reg uint8, dst ir.Arg) {
+	if r, ok := cl.allocated(dst); ok {
+		if r != reg {
+			cl.asm.MovqRegReg(reg, r)
+		}
+		return
+	}
+	cl.asm.MovqRegMem(reg, x64.RSI, regDisp(dst))
+}
+
+// movel copies 32-bit src value to the dst location.
+func (cl *Compiler) movel(dst, src ir.Arg) {
+	if r, ok := cl.allocated(dst); ok {
+		cl.movl(src, r)
+		return
+	}
+	if src.Kind == ir.ArgIntConst {
+		cl.asm.MovlConstMem(src.Value, x64.RSI, regDisp(dst))
+		return
+	}
+	cl.asm.MovlRegMem(cl.loadl(src, x64.RAX), x64.RSI, regDisp(dst))
+}
+
+// moveq is a 64-bit version of movel.
+// Constant src is expected to fit in 32 bits.
+func (cl *Compiler) moveq(dst, src ir.Arg) {
+	if r, ok := cl.allocated(dst); ok {
+		cl.movq(src, r)
+		return
+	}
+	if src.Kind == ir.ArgIntConst {
+		cl.asm.MovqConst32Mem(int32(src.Value), x64.RSI, regDisp(dst))
+		return
+	}
+	cl.asm.MovqRegMem(cl.loadq(src, x64.RAX), x64.RSI, regDisp(dst))
+}
+
+// cmpl compares 32-bit x register with y.
+func (cl *Compiler) cmpl(x uint8, y ir.Arg) {
+	if yreg, ok := cl.allocated(y); ok {
+		cl.asm.CmplRegReg(x, yreg)
+	} else {
+		cl.asm.CmplRegMem(x, x64.RSI, regDisp(y))
+	}
+}
+
+// cmpq is a 64-bit version of cmpl.
+func (cl *Compiler) cmpq(x uint8, y ir.Arg) {
+	if yreg, ok := cl.allocated(y); ok {
+		cl.asm.CmpqRegReg(x, yreg)
+	} else {
+		cl.asm.CmpqRegMem(x, x64.RSI, regDisp(y))
+	}
+}
+
+// addlConst adds v to the dst value in place.
+func (cl *Compiler) addlConst(v int64, dst ir.Arg) {
+	if r, ok := cl.allocated(dst); ok {
+		cl.asm.AddlConstReg(v, r)
+	} else {
+		cl.asm.AddlConstMem(v, x64.RSI, regDisp(dst))
+	}
+}
+
+// saveLive spills the values that are live across the current
+// instruction to their frame slots. Calls clobber all registers.
+func (cl *Compiler) saveLive() []*liveInterval {
+	live := cl.ra.liveAcross(cl.pos)
+	for _, iv := range live {
+		cl.asm.MovqRegMem(iv.reg, x64.RSI, keyDisp(iv.key))
+	}
+	return live
+}
+
+// restoreLive reloads the values spilled by saveLive.
+func (cl *Compiler) restoreLive(live []*liveInterval) {
+	for _, iv := range live {
+		cl.asm.MovqMemReg(x64.RSI, iv.reg, keyDisp(iv.key))
+	}
+}
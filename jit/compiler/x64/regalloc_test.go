@@ -0,0 +1,121 @@
+package x64
+
+import (
+	"testing"
+
+	"github.com/quasilyte/go-jdk/irfmt"
+)
+
+func TestAllocRegisters(t *testing.T) {
+	tests := []struct {
+		src         string
+		allocated   int
+		entry       int
+		liveAcross0 int
+	}{
+		{
+			src: `
+method loop(II)I
+  r2:int = Iload 0
+loop:
+  flags = Icmp r0:int r1:int
+  JumpGtEq @done flags
+  r2 = Iadd r2 r0
+  r0 = Iadd r0 1
+  Jump @loop
+done:
+  Iret r2`,
+			allocated:   3,
+			entry:       2,
+			liveAcross0: 2,
+		},
+
+		{
+			src: `
+method entry(I)I
+  r1:int = Iadd r0:int 1
+  r1 = Iadd r1 r0
+  Iret r1`,
+			allocated:   2,
+			entry:       1,
+			liveAcross0: 1, // r0 must be saved if it's a call
+		},
+
+		{
+			src: `
+method floats(FD)V
+  r3:float = Iload r0:float
+  r4:double = Lload r1:double
+  Ret`,
+			allocated: 0,
+			entry:     0,
+		},
+
+		{
+			src: `
+method refs([I)I
+  r1:int = ArrayLen r0:ref
+  r1:ref = Aload r0
+  r2:int = ArrayLen r1
+  Iret r2`,
+			allocated:   4,
+			entry:       1,
+			liveAcross0: 1,
+		},
+
+		{
+			src: `
+method pressure(I)I
+  r1:int = Iadd r0:int 1
+  r2:int = Iadd r0 2
+  r3:int = Iadd r0 3
+  r4:int = Iadd r0 4
+  r5:int = Iadd r0 5
+  r6:int = Iadd r0 6
+  r7:int = Iadd r0 7
+  r1 = Iadd r1 r2
+  r1 = Iadd r1 r3
+  r1 = Iadd r1 r4
+  r1 = Iadd r1 r5
+  r1 = Iadd r1 r6
+  r1 = Iadd r1 r7
+  Iret r1`,
+			allocated:   len(allocatableRegs),
+			entry:       1,
+			liveAcross0: 1,
+		},
+	}
+
+	var ra regAllocation
+	for _, test := range tests {
+		methods, err := irfmt.Parse(nil, test.src)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		m := methods[0]
+		allocRegisters(&ra, m.Code)
+
+		name := m.Out.Name
+		if len(ra.regs) != test.allocated {
+			t.Errorf("%s: allocated %d values, want %d", name, len(ra.regs), test.allocated)
+		}
+		if len(ra.entry) != test.entry {
+			t.Errorf("%s: %d entry values, want %d", name, len(ra.entry), test.entry)
+		}
+		if n := len(ra.liveAcross(0)); n != test.liveAcross0 {
+			t.Errorf("%s: %d values are live across the first instruction, want %d",
+				name, n, test.liveAcross0)
+		}
+		for i, x := range ra.intervals {
+			for _, y := range ra.intervals[i+1:] {
+				if !x.allocated || !y.allocated || x.reg != y.reg {
+					continue
+				}
+				if x.start <= y.end && y.start <= x.end {
+					t.Errorf("%s: %v [%d, %d] and %v [%d, %d] share a register",
+						name, x.key, x.start, x.end, y.key, y.start, y.end)
+				}
+			}
+		}
+	}
+}
@@ -14,8 +14,14 @@ func scalarDisp(arg ir.Arg) int32 {
 	return int32(arg.Value * 16)
 }
 
+// regDisp returns a frame slot displacement for the register arg.
+// References and scalars are stored at different slot offsets,
+// the register value type selects the right one.
 func regDisp(arg ir.Arg) int32 {
-	return int32(arg.Value * 16)
+	if arg.Type == ir.TypeRef {
+		return ptrDisp(arg)
+	}
+	return scalarDisp(arg)
 }
 
 func fits32bit(x int64) bool {
@@ -0,0 +1,85 @@
+package jit
+
+import (
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/symbol"
+)
+
+// FallbackPackages returns packages that only contain the methods
+// that should be handled by a fallback compiler.
+//
+// failed is a set of methods that JIT compiler could not handle.
+// Machine code can't call the methods that have no machine code,
+// so the callers of failed methods are added to the set as well.
+// When this function returns, failed contains all methods
+// that are going to be passed to the fallback compiler.
+func FallbackPackages(packages []*ir.Package, failed map[symbol.ID]bool) []*ir.Package {
+	if len(failed) == 0 {
+		return nil
+	}
+
+	for changed := true; changed; {
+		changed = false
+		walkMethods(packages, func(m *ir.Method) {
+			if failed[m.Out.ID] || !callsAny(m, failed) {
+				return
+			}
+			failed[m.Out.ID] = true
+			changed = true
+		})
+	}
+	return MethodPackages(packages, failed)
+}
+
+// MethodPackages returns packages that only contain the methods from the set.
+//
+// Compilers that can link the machine code to the methods
+// without machine code use it instead of FallbackPackages,
+// so only the failed methods are handled by a fallback compiler.
+func MethodPackages(packages []*ir.Package, set map[symbol.ID]bool) []*ir.Package {
+	if len(set) == 0 {
+		return nil
+	}
+
+	var result []*ir.Package
+	for _, p := range packages {
+		var classes []ir.Class
+		for _, c := range p.Classes {
+			var methods []ir.Method
+			for _, m := range c.Methods {
+				if set[m.Out.ID] {
+					methods = append(methods, m)
+				}
+			}
+			if len(methods) == 0 {
+				continue
+			}
+			c.Methods = methods
+			classes = append(classes, c)
+		}
+		if len(classes) != 0 {
+			result = append(result, &ir.Package{Out: p.Out, Classes: classes})
+		}
+	}
+	return result
+}
+
+func walkMethods(packages []*ir.Package, visit func(m *ir.Method)) {
+	for _, p := range packages {
+		for i := range p.Classes {
+			c := &p.Classes[i]
+			for j := range c.Methods {
+				visit(&c.Methods[j])
+			}
+		}
+	}
+}
+
+func callsAny(m *ir.Method, set map[symbol.ID]bool) bool {
+	for _, inst := range m.Code {
+		if inst.Kind == ir.InstCallStatic && set[inst.Args[0].SymbolID()] {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package jit
 import (
 	"github.com/quasilyte/go-jdk/ir"
 	"github.com/quasilyte/go-jdk/mmap"
+	"github.com/quasilyte/go-jdk/symbol"
 	"github.com/quasilyte/go-jdk/vmdat"
 )
 
@@ -11,12 +12,34 @@ type Context struct {
 	Mmap  *mmap.Manager
 
 	Funcs struct {
-		JcallScalar uint32
-		NewIntArray uint32
+		JcallScalar   uint32
+		NewIntArray   uint32
+		ResolveMethod uint32
 	}
+
+	// GenerateIR is used by the lazy compilers to generate
+	// the IR of the Lazy methods before their compilation.
+	// The package contains only the method being compiled.
+	GenerateIR func(*ir.Package) error
 }
 
 // Compiler is used by a VM to generate machine code for class methods.
 type Compiler interface {
 	Compile(Context, []*ir.Package) error
 }
+
+// LazyCompiler is a Compiler that can defer the method compilation
+// until the method is called for the first time.
+type LazyCompiler interface {
+	Compiler
+
+	// EnableLazy makes the subsequent Compile calls defer
+	// the compilation of the methods.
+	EnableLazy()
+
+	// CompileLazy compiles the deferred id method.
+	// It does nothing if the method is not deferred.
+	//
+	// It's not safe to call CompileLazy concurrently.
+	CompileLazy(id symbol.ID) error
+}
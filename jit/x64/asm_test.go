@@ -6,665 +6,1143 @@ import (
 	"testing"
 )
 
-func TestAsm(t *testing.T) {
-	type expected struct {
-		line int
-		asm  string
-		enc  string
-	}
+type asmExpected struct {
+	line int
+	asm  string
+	enc  string
+}
 
-	// Test cases are generated with a help of `testdata/gen.go`.
-	tests := []struct {
-		name string
-		want []expected
-		run  func(*Assembler)
-	}{
-
-		{
-			name: "testJge1",
-			want: []expected{
-				{5, "JGE forward2", "7d00"},
-				{7, "JGE forward1", "7d01"},
-				{8, "NOP1", "90"},
-				{10, "NOP1", "90"},
-			},
-			run: func(asm *Assembler) {
-				asm.Jge(2)
-				asm.Label(2)
-				asm.Jge(1)
-				asm.Nop(1)
-				asm.Label(1)
-				asm.Nop(1)
-			},
-		},
-
-		{
-			name: "testJge2",
-			want: []expected{
-				{15, "NOP1", "90"},
-				{16, "JGE l1", "7d03"},
-				{18, "NOP1", "90"},
-				{19, "JGE l2", "7dfa"},
-				{21, "NOP1", "90"},
-				{22, "JGE l3", "7dfa"},
-			},
-			run: func(asm *Assembler) {
-				asm.Label(2)
-				asm.Nop(1)
-				asm.Jge(1)
-				asm.Label(3)
-				asm.Nop(1)
-				asm.Jge(2)
-				asm.Label(1)
-				asm.Nop(1)
-				asm.Jge(3)
-			},
-		},
-
-		{
-			name: "testJmp1",
-			want: []expected{
-				{26, "JMP forward", "eb00"},
-			},
-			run: func(asm *Assembler) {
-				asm.Jmp(7)
-				asm.Label(7)
-			},
-		},
-
-		{
-			name: "testJmp2",
-			want: []expected{
-				{32, "JMP looping", "ebfe"},
-			},
-			run: func(asm *Assembler) {
-				asm.Label(3)
-				asm.Jmp(3)
-			},
-		},
-
-		{
-			name: "testJmp3",
-			want: []expected{
-				{37, "NOP1", "90"},
-				{38, "JMP backward", "ebfd"},
-			},
-			run: func(asm *Assembler) {
-				asm.Label(0)
-				asm.Nop(1)
-				asm.Jmp(0)
-			},
-		},
-
-		{
-			name: "testJmp4",
-			want: []expected{
-				{42, "JMP sharedlabel", "eb04"},
-				{43, "NOP1", "90"},
-				{44, "JMP sharedlabel", "eb01"},
-				{45, "NOP1", "90"},
-				{47, "NOP1", "90"},
-			},
-			run: func(asm *Assembler) {
-				asm.Jmp(0)
-				asm.Nop(1)
-				asm.Jmp(0)
-				asm.Nop(1)
-				asm.Label(0)
-				asm.Nop(1)
-			},
-		},
-
-		{
-			name: "testJmp5",
-			want: []expected{
-				{51, "NOP1", "90"},
-				{52, "JMP l1", "eb03"},
-				{54, "NOP1", "90"},
-				{55, "JMP l2", "eb03"},
-				{57, "NOP1", "90"},
-				{58, "JMP l3", "ebfa"},
-				{60, "NOP1", "90"},
-			},
-			run: func(asm *Assembler) {
-				asm.Nop(1)
-				asm.Jmp(1)
-				asm.Label(3)
-				asm.Nop(1)
-				asm.Jmp(2)
-				asm.Label(1)
-				asm.Nop(1)
-				asm.Jmp(3)
-				asm.Label(2)
-				asm.Nop(1)
-			},
-		},
-
-		{
-			name: "testJmp6",
-			want: []expected{
-				{65, "NOP1", "90"},
-				{66, "JMP l1", "eb03"},
-				{68, "NOP1", "90"},
-				{69, "JMP l2", "ebfa"},
-				{71, "NOP1", "90"},
-				{72, "JMP l3", "ebfa"},
-			},
-			run: func(asm *Assembler) {
-				asm.Label(2)
-				asm.Nop(1)
-				asm.Jmp(1)
-				asm.Label(3)
-				asm.Nop(1)
-				asm.Jmp(2)
-				asm.Label(1)
-				asm.Nop(1)
-				asm.Jmp(3)
-			},
-		},
-
-		{
-			name: "testJmpReg",
-			want: []expected{
-				{76, "JMP AX", "ffe0"},
-				{77, "JMP DX", "ffe2"},
-				{78, "JMP CX", "ffe1"},
-				{79, "JMP R10", "41ffe2"},
-			},
-			run: func(asm *Assembler) {
-				asm.JmpReg(RAX)
-				asm.JmpReg(RDX)
-				asm.JmpReg(RCX)
-				asm.JmpReg(R10)
-			},
-		},
-
-		{
-			name: "testJmpMem",
-			want: []expected{
-				{83, "JMP (AX)", "ff20"},
-				{84, "JMP -8(DI)", "ff67f8"},
-				{85, "JMP 13935(CX)", "ffa16f360000"},
-			},
-			run: func(asm *Assembler) {
-				asm.JmpMem(RAX, 0)
-				asm.JmpMem(RDI, -8)
-				asm.JmpMem(RCX, 13935)
-			},
-		},
-
-		{
-			name: "testAdd",
-			want: []expected{
-				{89, "ADDL (AX), DX", "0310"},
-				{90, "ADDL 8(SI), AX", "034608"},
-				{91, "ADDL $7, (AX)", "830007"},
-				{92, "ADDL $-9, -8(DX)", "8342f8f7"},
-				{93, "ADDL $9300, 16(SI)", "81461054240000"},
-				{94, "ADDL $127, CX", "83c17f"},
-				{95, "ADDL $-128, BX", "83c380"},
-				{96, "ADDL $200, BP", "81c5c8000000"},
-				{97, "ADDQ $0, 0*8(SI)", "48830600"},
-				{98, "ADDQ $1, 0*8(SI)", "48830601"},
-				{99, "ADDQ $1, 1*8(SI)", "4883460801"},
-				{100, "ADDQ $-1, 3*8(SI)", "48834618ff"},
-				{101, "ADDQ $14, 10*8(SI)", "488346500e"},
-				{102, "ADDQ $14, 100*8(SI)", "488386200300000e"},
-				{103, "ADDQ $0xff, 0*8(SI)", "488106ff000000"},
-				{104, "ADDQ $0xff, 1*8(SI)", "48814608ff000000"},
-				{105, "ADDQ $-129, 100*8(SI)", "488186200300007fffffff"},
-				{106, "ADDQ $1, AX", "4883c001"},
-				{107, "ADDQ $-1, DI", "4883c7ff"},
-				{108, "ADDQ $5000, SP", "4881c488130000"},
-				{109, "ADDQ $313, R8", "4981c039010000"},
-				{110, "ADDQ $-190, R9", "4981c142ffffff"},
-			},
-			run: func(asm *Assembler) {
-				asm.AddlMemReg(RAX, RDX, 0)
-				asm.AddlMemReg(RSI, RAX, 8)
-				asm.AddlConst8Mem(7, RAX, 0)
-				asm.AddlConst8Mem(-9, RDX, -8)
-				asm.AddlConst32Mem(9300, RSI, 16)
-				asm.AddlConst8Reg(127, RCX)
-				asm.AddlConst8Reg(-128, RBX)
-				asm.AddlConst32Reg(200, RBP)
-				asm.AddqConst8Mem(0, RSI, 0*8)
-				asm.AddqConst8Mem(1, RSI, 0*8)
-				asm.AddqConst8Mem(1, RSI, 1*8)
-				asm.AddqConst8Mem(-1, RSI, 3*8)
-				asm.AddqConst8Mem(14, RSI, 10*8)
-				asm.AddqConst8Mem(14, RSI, 100*8)
-				asm.AddqConst32Mem(0xff, RSI, 0*8)
-				asm.AddqConst32Mem(0xff, RSI, 1*8)
-				asm.AddqConst32Mem(-129, RSI, 100*8)
-				asm.AddqConst8Reg(1, RAX)
-				asm.AddqConst8Reg(-1, RDI)
-				asm.AddqConst32Reg(5000, RSP)
-				asm.AddqConst32Reg(313, R8)
-				asm.AddqConst32Reg(-190, R9)
-			},
-		},
-
-		{
-			name: "testMov",
-			want: []expected{
-				{114, "MOVB AX, (AX)", "8800"},
-				{115, "MOVB CX, 24(SI)", "884e18"},
-				{116, "MOVB BX, -300(BP)", "889dd4feffff"},
-				{117, "MOVL $0, 0*8(SI)", "c70600000000"},
-				{118, "MOVL $1, 0*8(DI)", "c70701000000"},
-				{119, "MOVL $1, 1*8(AX)", "c7400801000000"},
-				{120, "MOVL $-50000, 40*8(SI)", "c78640010000b03cffff"},
-				{121, "MOVL (AX), AX", "8b00"},
-				{122, "MOVL -16(CX), DX", "8b51f0"},
-				{123, "MOVL AX, (AX)", "8900"},
-				{124, "MOVL DX, -16(CX)", "8951f0"},
-				{125, "MOVL $1355, AX", "b84b050000"},
-				{126, "MOVL $-6643, DX", "ba0de6ffff"},
-				{127, "MOVL $500, R14", "41bef4010000"},
-				{128, "MOVQ 0*8(AX), BX", "488b18"},
-				{129, "MOVQ 16*8(BX), AX", "488b8380000000"},
-				{130, "MOVQ AX, 0*8(DI)", "488907"},
-				{131, "MOVQ DX, 3*8(DI)", "48895718"},
-				{132, "MOVQ AX, 0*8(AX)", "488900"},
-				{133, "MOVQ R15, 16(R14)", "4d897e10"},
-				{134, "MOVQ R14, 16(R15)", "4d897710"},
-				{135, "MOVQ CX, 16(R14)", "49894e10"},
-				{136, "MOVQ R14, 16(CX)", "4c897110"},
-				{137, "MOVQ $140038723203072, AX", "48b800f0594e5d7f0000"},
-				{138, "MOVQ $9223372036854775807, DX", "48baffffffffffffff7f"},
-				{139, "MOVQ $-9223372036854775800, SI", "48be0800000000000080"},
-				{140, "MOVQ $922337203685477000, R9", "49b988cacccccccccc0c"},
-				{141, "MOVQ $922337203685477000, R11", "49bb88cacccccccccc0c"},
-				{142, "MOVQ $1423, AX", "48c7c08f050000"},
-				{143, "MOVQ $-23, CX", "48c7c1e9ffffff"},
-				{144, "MOVQ $1, DX", "48c7c201000000"},
-				{145, "MOVQ 100(BP), DX", "488b5564"},
-				{146, "MOVQ $1, 1(AX)", "48c7400101000000"},
-				{147, "MOVQ $-1, 2(AX)", "48c74002ffffffff"},
-				{148, "MOVQ $0, -96(BP)", "48c745a000000000"},
-				{149, "MOVQ $100, -96(BP)", "48c745a064000000"},
-			},
-			run: func(asm *Assembler) {
-				asm.MovbRegMem(RAX, RAX, 0)
-				asm.MovbRegMem(RCX, RSI, 24)
-				asm.MovbRegMem(RBX, RBP, -300)
-				asm.MovlConst32Mem(0, RSI, 0*8)
-				asm.MovlConst32Mem(1, RDI, 0*8)
-				asm.MovlConst32Mem(1, RAX, 1*8)
-				asm.MovlConst32Mem(-50000, RSI, 40*8)
-				asm.MovlMemReg(RAX, RAX, 0)
-				asm.MovlMemReg(RCX, RDX, -16)
-				asm.MovlRegMem(RAX, RAX, 0)
-				asm.MovlRegMem(RDX, RCX, -16)
-				asm.MovlConst32Reg(1355, RAX)
-				asm.MovlConst32Reg(-6643, RDX)
-				asm.MovlConst32Reg(500, R14)
-				asm.MovqMemReg(RAX, RBX, 0*8)
-				asm.MovqMemReg(RBX, RAX, 16*8)
-				asm.MovqRegMem(RAX, RDI, 0*8)
-				asm.MovqRegMem(RDX, RDI, 3*8)
-				asm.MovqRegMem(RAX, RAX, 0*8)
-				asm.MovqRegMem(R15, R14, 16)
-				asm.MovqRegMem(R14, R15, 16)
-				asm.MovqRegMem(RCX, R14, 16)
-				asm.MovqRegMem(R14, RCX, 16)
-				asm.MovqConst64Reg(140038723203072, RAX)
-				asm.MovqConst64Reg(9223372036854775807, RDX)
-				asm.MovqConst64Reg(-9223372036854775800, RSI)
-				asm.MovqConst64Reg(922337203685477000, R9)
-				asm.MovqConst64Reg(922337203685477000, R11)
-				asm.MovqConst32Reg(1423, RAX)
-				asm.MovqConst32Reg(-23, RCX)
-				asm.MovqConst32Reg(1, RDX)
-				asm.MovqMemReg(RBP, RDX, 100)
-				asm.MovqConst32Mem(1, RAX, 1)
-				asm.MovqConst32Mem(-1, RAX, 2)
-				asm.MovqConst32Mem(0, RBP, -96)
-				asm.MovqConst32Mem(100, RBP, -96)
-			},
-		},
-
-		{
-			name: "testCmp",
-			want: []expected{
-				{153, "CMPL AX, 0*8(DI)", "3b07"},
-				{154, "CMPL BX, 1*8(AX)", "3b5808"},
-				{155, "CMPL 16(SI), $0", "837e1000"},
-				{156, "CMPL (AX), $15", "83380f"},
-				{157, "CMPL (DI), $242", "813ff2000000"},
-				{158, "CMPL -8(BX), $-5343", "817bf821ebffff"},
-				{159, "CMPQ 6*8(SI), $0", "48837e3000"},
-				{160, "CMPQ (SI), $999", "48813ee7030000"},
-				{161, "CMPQ 8(DI), $-999", "48817f0819fcffff"},
-			},
-			run: func(asm *Assembler) {
-				asm.CmplRegMem(RAX, RDI, 0*8)
-				asm.CmplRegMem(RBX, RAX, 1*8)
-				asm.CmplConst8Mem(0, RSI, 16)
-				asm.CmplConst8Mem(15, RAX, 0)
-				asm.CmplConst32Mem(242, RDI, 0)
-				asm.CmplConst32Mem(-5343, RBX, -8)
-				asm.CmpqConst8Mem(0, RSI, 6*8)
-				asm.CmpqConst32Mem(999, RSI, 0)
-				asm.CmpqConst32Mem(-999, RDI, 8)
-			},
-		},
-
-		{
-			name: "testNeg",
-			want: []expected{
-				{165, "NEGQ 0*8(SI)", "48f71e"},
-				{166, "NEGQ 5*8(AX)", "48f75828"},
-				{167, "NEGL AX", "f7d8"},
-				{168, "NEGL DX", "f7da"},
-				{169, "NEGL (AX)", "f718"},
-				{170, "NEGL 100(BX)", "f75b64"},
-				{171, "NEGQ CX", "48f7d9"},
-				{172, "NEGQ BX", "48f7db"},
-			},
-			run: func(asm *Assembler) {
-				asm.NegqMem(RSI, 0*8)
-				asm.NegqMem(RAX, 5*8)
-				asm.NeglReg(RAX)
-				asm.NeglReg(RDX)
-				asm.NeglMem(RAX, 0)
-				asm.NeglMem(RBX, 100)
-				asm.NegqReg(RCX)
-				asm.NegqReg(RBX)
-			},
-		},
-
-		{
-			name: "testRaw",
-			want: []expected{
-				{176, "MOVL -16(CX), DX", "8b51f0"},
-				{177, "JMP AX", "ffe0"},
-				{178, "CMPQ 6*8(SI), $0", "48837e3000"},
-			},
-			run: func(asm *Assembler) {
-				asm.Raw(0x8b, 0x51, 0xf0)
-				asm.Raw(0xff, 0xe0)
-				asm.Raw(0x48, 0x83, 0x7e, 0x30, 0x00)
-			},
-		},
-
-		{
-			name: "testCall",
-			want: []expected{
-				{182, "CALL AX", "ffd0"},
-				{183, "CALL BX", "ffd3"},
-			},
-			run: func(asm *Assembler) {
-				asm.CallReg(RAX)
-				asm.CallReg(RBX)
-			},
-		},
-
-		{
-			name: "testSub",
-			want: []expected{
-				{187, "SUBL (AX), DI", "2b38"},
-				{188, "SUBL 16(SI), AX", "2b4610"},
-				{189, "SUBL 640(BX), DX", "2b9380020000"},
-			},
-			run: func(asm *Assembler) {
-				asm.SublMemReg(RAX, RDI, 0)
-				asm.SublMemReg(RSI, RAX, 16)
-				asm.SublMemReg(RBX, RDX, 640)
-			},
-		},
-
-		{
-			name: "testJgt1",
-			want: []expected{
-				{193, "JGT forward2", "7f00"},
-				{195, "JGT forward1", "7f01"},
-				{196, "NOP1", "90"},
-				{198, "NOP1", "90"},
-			},
-			run: func(asm *Assembler) {
-				asm.Jgt(2)
-				asm.Label(2)
-				asm.Jgt(1)
-				asm.Nop(1)
-				asm.Label(1)
-				asm.Nop(1)
-			},
-		},
-
-		{
-			name: "testJgt2",
-			want: []expected{
-				{203, "NOP1", "90"},
-				{204, "JGT l1", "7f03"},
-				{206, "NOP1", "90"},
-				{207, "JGT l2", "7ffa"},
-				{209, "NOP1", "90"},
-				{210, "JGT l3", "7ffa"},
-			},
-			run: func(asm *Assembler) {
-				asm.Label(2)
-				asm.Nop(1)
-				asm.Jgt(1)
-				asm.Label(3)
-				asm.Nop(1)
-				asm.Jgt(2)
-				asm.Label(1)
-				asm.Nop(1)
-				asm.Jgt(3)
-			},
-		},
-
-		{
-			name: "testImul",
-			want: []expected{
-				{214, "IMULL (AX), CX", "0faf08"},
-				{215, "IMULL 4(SI), CX", "0faf4e04"},
-				{216, "IMULL -8(DX), AX", "0faf42f8"},
-			},
-			run: func(asm *Assembler) {
-				asm.ImullMemReg(RAX, RCX, 0)
-				asm.ImullMemReg(RSI, RCX, 4)
-				asm.ImullMemReg(RDX, RAX, -8)
-			},
-		},
-
-		{
-			name: "testMovlqsx",
-			want: []expected{
-				{220, "MOVLQSX 4(AX), BX", "48635804"},
-				{221, "MOVLQSX 8(AX), AX", "48634008"},
-			},
-			run: func(asm *Assembler) {
-				asm.MovlqsxMemReg(RAX, RBX, 4)
-				asm.MovlqsxMemReg(RAX, RAX, 8)
-			},
-		},
-
-		{
-			name: "testJlt1",
-			want: []expected{
-				{225, "JLT forward2", "7c00"},
-				{227, "JLT forward1", "7c01"},
-				{228, "NOP1", "90"},
-				{230, "NOP1", "90"},
-			},
-			run: func(asm *Assembler) {
-				asm.Jlt(2)
-				asm.Label(2)
-				asm.Jlt(1)
-				asm.Nop(1)
-				asm.Label(1)
-				asm.Nop(1)
-			},
-		},
-
-		{
-			name: "testJlt2",
-			want: []expected{
-				{235, "NOP1", "90"},
-				{236, "JLT l1", "7c03"},
-				{238, "NOP1", "90"},
-				{239, "JLT l2", "7cfa"},
-				{241, "NOP1", "90"},
-				{242, "JLT l3", "7cfa"},
-			},
-			run: func(asm *Assembler) {
-				asm.Label(2)
-				asm.Nop(1)
-				asm.Jlt(1)
-				asm.Label(3)
-				asm.Nop(1)
-				asm.Jlt(2)
-				asm.Label(1)
-				asm.Nop(1)
-				asm.Jlt(3)
-			},
-		},
-
-		{
-			name: "testCdq",
-			want: []expected{
-				{246, "CDQ", "99"},
-			},
-			run: func(asm *Assembler) {
-				asm.Cdq()
-			},
-		},
-
-		{
-			name: "testIdivl",
-			want: []expected{
-				{250, "IDIVL (AX)", "f738"},
-				{251, "IDIVL 16(CX)", "f77910"},
-				{252, "IDIVL AX", "f7f8"},
-				{253, "IDIVL BX", "f7fb"},
-			},
-			run: func(asm *Assembler) {
-				asm.IdivlMem(RAX, 0)
-				asm.IdivlMem(RCX, 16)
-				asm.IdivlReg(RAX)
-				asm.IdivlReg(RBX)
-			},
-		},
-
-		{
-			name: "testMovIndex",
-			want: []expected{
-				{257, "MOVL (AX)(CX*4), AX", "8b0488"},
-				{258, "MOVL (CX)(CX*4), BX", "8b1c89"},
-				{259, "MOVL (SI)(AX*4), CX", "8b0c86"},
-				{260, "MOVL (AX)(SI*4), CX", "8b0cb0"},
-				{261, "MOVL $0, (AX)(CX*4)", "c7048800000000"},
-				{262, "MOVL $14, (DX)(DI*4)", "c704ba0e000000"},
-				{263, "MOVL $-6, (SI)(BX*4)", "c7049efaffffff"},
-				{264, "MOVL AX, (AX)(CX*4)", "890488"},
-				{265, "MOVL DX, (DI)(AX*4)", "891487"},
-				{266, "MOVL SI, (SI)(SI*4)", "8934b6"},
-				{267, "MOVL CX, (CX)(CX*4)", "890c89"},
-				{268, "MOVL R8, (SI)(CX*4)", "4489048e"},
-			},
-			run: func(asm *Assembler) {
-				asm.MovlMemindexReg(RAX, RAX, RCX)
-				asm.MovlMemindexReg(RCX, RBX, RCX)
-				asm.MovlMemindexReg(RSI, RCX, RAX)
-				asm.MovlMemindexReg(RAX, RCX, RSI)
-				asm.MovlConst32Memindex(0, RAX, RCX)
-				asm.MovlConst32Memindex(14, RDX, RDI)
-				asm.MovlConst32Memindex(-6, RSI, RBX)
-				asm.MovlRegMemindex(RAX, RAX, RCX)
-				asm.MovlRegMemindex(RDX, RDI, RAX)
-				asm.MovlRegMemindex(RSI, RSI, RSI)
-				asm.MovlRegMemindex(RCX, RCX, RCX)
-				asm.MovlRegMemindex(R8, RSI, RCX)
-			},
-		},
-
-		{
-			name: "testJle1",
-			want: []expected{
-				{272, "JLE forward2", "7e00"},
-				{274, "JLE forward1", "7e01"},
-				{275, "NOP1", "90"},
-				{277, "NOP1", "90"},
-			},
-			run: func(asm *Assembler) {
-				asm.Jle(2)
-				asm.Label(2)
-				asm.Jle(1)
-				asm.Nop(1)
-				asm.Label(1)
-				asm.Nop(1)
-			},
-		},
-
-		{
-			name: "testJle2",
-			want: []expected{
-				{282, "NOP1", "90"},
-				{283, "JLE l1", "7e03"},
-				{285, "NOP1", "90"},
-				{286, "JLE l2", "7efa"},
-				{288, "NOP1", "90"},
-				{289, "JLE l3", "7efa"},
-			},
-			run: func(asm *Assembler) {
-				asm.Label(2)
-				asm.Nop(1)
-				asm.Jle(1)
-				asm.Label(3)
-				asm.Nop(1)
-				asm.Jle(2)
-				asm.Label(1)
-				asm.Nop(1)
-				asm.Jle(3)
-			},
-		},
-
-		{
-			name: "testJne1",
-			want: []expected{
-				{293, "JNE forward2", "7500"},
-				{295, "JNE forward1", "7501"},
-				{296, "NOP1", "90"},
-				{298, "NOP1", "90"},
-			},
-			run: func(asm *Assembler) {
-				asm.Jne(2)
-				asm.Label(2)
-				asm.Jne(1)
-				asm.Nop(1)
-				asm.Label(1)
-				asm.Nop(1)
-			},
-		},
-
-		{
-			name: "testJne2",
-			want: []expected{
-				{303, "NOP1", "90"},
-				{304, "JNE l1", "7503"},
-				{306, "NOP1", "90"},
-				{307, "JNE l2", "75fa"},
-				{309, "NOP1", "90"},
-				{310, "JNE l3", "75fa"},
-			},
-			run: func(asm *Assembler) {
-				asm.Label(2)
-				asm.Nop(1)
-				asm.Jne(1)
-				asm.Label(3)
-				asm.Nop(1)
-				asm.Jne(2)
-				asm.Label(1)
-				asm.Nop(1)
-				asm.Jne(3)
-			},
+// asmTests are generated with a help of `testdata/gen.go`.
+var asmTests = []struct {
+	name string
+	want []asmExpected
+	run  func(*Assembler)
+}{
+
+	{
+		name: "testJge1",
+		want: []asmExpected{
+			{5, "JGE forward2", "7d00"},
+			{7, "JGE forward1", "7d01"},
+			{8, "NOP1", "90"},
+			{10, "NOP1", "90"},
 		},
-	}
+		run: func(asm *Assembler) {
+			asm.Jge(2)
+			asm.Label(2)
+			asm.Jge(1)
+			asm.Nop(1)
+			asm.Label(1)
+			asm.Nop(1)
+		},
+	},
+
+	{
+		name: "testJge2",
+		want: []asmExpected{
+			{15, "NOP1", "90"},
+			{16, "JGE l1", "7d03"},
+			{18, "NOP1", "90"},
+			{19, "JGE l2", "7dfa"},
+			{21, "NOP1", "90"},
+			{22, "JGE l3", "7dfa"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(2)
+			asm.Nop(1)
+			asm.Jge(1)
+			asm.Label(3)
+			asm.Nop(1)
+			asm.Jge(2)
+			asm.Label(1)
+			asm.Nop(1)
+			asm.Jge(3)
+		},
+	},
+
+	{
+		name: "testJmp1",
+		want: []asmExpected{
+			{26, "JMP forward", "eb00"},
+		},
+		run: func(asm *Assembler) {
+			asm.Jmp(7)
+			asm.Label(7)
+		},
+	},
+
+	{
+		name: "testJmp2",
+		want: []asmExpected{
+			{32, "JMP looping", "ebfe"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(3)
+			asm.Jmp(3)
+		},
+	},
+
+	{
+		name: "testJmp3",
+		want: []asmExpected{
+			{37, "NOP1", "90"},
+			{38, "JMP backward", "ebfd"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(0)
+			asm.Nop(1)
+			asm.Jmp(0)
+		},
+	},
+
+	{
+		name: "testJmp4",
+		want: []asmExpected{
+			{42, "JMP sharedlabel", "eb04"},
+			{43, "NOP1", "90"},
+			{44, "JMP sharedlabel", "eb01"},
+			{45, "NOP1", "90"},
+			{47, "NOP1", "90"},
+		},
+		run: func(asm *Assembler) {
+			asm.Jmp(0)
+			asm.Nop(1)
+			asm.Jmp(0)
+			asm.Nop(1)
+			asm.Label(0)
+			asm.Nop(1)
+		},
+	},
+
+	{
+		name: "testJmp5",
+		want: []asmExpected{
+			{51, "NOP1", "90"},
+			{52, "JMP l1", "eb03"},
+			{54, "NOP1", "90"},
+			{55, "JMP l2", "eb03"},
+			{57, "NOP1", "90"},
+			{58, "JMP l3", "ebfa"},
+			{60, "NOP1", "90"},
+		},
+		run: func(asm *Assembler) {
+			asm.Nop(1)
+			asm.Jmp(1)
+			asm.Label(3)
+			asm.Nop(1)
+			asm.Jmp(2)
+			asm.Label(1)
+			asm.Nop(1)
+			asm.Jmp(3)
+			asm.Label(2)
+			asm.Nop(1)
+		},
+	},
+
+	{
+		name: "testJmp6",
+		want: []asmExpected{
+			{65, "NOP1", "90"},
+			{66, "JMP l1", "eb03"},
+			{68, "NOP1", "90"},
+			{69, "JMP l2", "ebfa"},
+			{71, "NOP1", "90"},
+			{72, "JMP l3", "ebfa"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(2)
+			asm.Nop(1)
+			asm.Jmp(1)
+			asm.Label(3)
+			asm.Nop(1)
+			asm.Jmp(2)
+			asm.Label(1)
+			asm.Nop(1)
+			asm.Jmp(3)
+		},
+	},
+
+	{
+		name: "testJmpReg",
+		want: []asmExpected{
+			{76, "JMP AX", "ffe0"},
+			{77, "JMP DX", "ffe2"},
+			{78, "JMP CX", "ffe1"},
+			{79, "JMP R10", "41ffe2"},
+		},
+		run: func(asm *Assembler) {
+			asm.JmpReg(RAX)
+			asm.JmpReg(RDX)
+			asm.JmpReg(RCX)
+			asm.JmpReg(R10)
+		},
+	},
+
+	{
+		name: "testJmpMem",
+		want: []asmExpected{
+			{83, "JMP (AX)", "ff20"},
+			{84, "JMP -8(DI)", "ff67f8"},
+			{85, "JMP 13935(CX)", "ffa16f360000"},
+		},
+		run: func(asm *Assembler) {
+			asm.JmpMem(RAX, 0)
+			asm.JmpMem(RDI, -8)
+			asm.JmpMem(RCX, 13935)
+		},
+	},
+
+	{
+		name: "testAdd",
+		want: []asmExpected{
+			{89, "ADDL (AX), DX", "0310"},
+			{90, "ADDL 8(SI), AX", "034608"},
+			{91, "ADDL $7, (AX)", "830007"},
+			{92, "ADDL $-9, -8(DX)", "8342f8f7"},
+			{93, "ADDL $9300, 16(SI)", "81461054240000"},
+			{94, "ADDL $127, CX", "83c17f"},
+			{95, "ADDL $-128, BX", "83c380"},
+			{96, "ADDL $200, BP", "81c5c8000000"},
+			{97, "ADDQ $0, 0*8(SI)", "48830600"},
+			{98, "ADDQ $1, 0*8(SI)", "48830601"},
+			{99, "ADDQ $1, 1*8(SI)", "4883460801"},
+			{100, "ADDQ $-1, 3*8(SI)", "48834618ff"},
+			{101, "ADDQ $14, 10*8(SI)", "488346500e"},
+			{102, "ADDQ $14, 100*8(SI)", "488386200300000e"},
+			{103, "ADDQ $0xff, 0*8(SI)", "488106ff000000"},
+			{104, "ADDQ $0xff, 1*8(SI)", "48814608ff000000"},
+			{105, "ADDQ $-129, 100*8(SI)", "488186200300007fffffff"},
+			{106, "ADDQ $1, AX", "4883c001"},
+			{107, "ADDQ $-1, DI", "4883c7ff"},
+			{108, "ADDQ $5000, SP", "4881c488130000"},
+			{109, "ADDQ $313, R8", "4981c039010000"},
+			{110, "ADDQ $-190, R9", "4981c142ffffff"},
+		},
+		run: func(asm *Assembler) {
+			asm.AddlMemReg(RAX, RDX, 0)
+			asm.AddlMemReg(RSI, RAX, 8)
+			asm.AddlConst8Mem(7, RAX, 0)
+			asm.AddlConst8Mem(-9, RDX, -8)
+			asm.AddlConst32Mem(9300, RSI, 16)
+			asm.AddlConst8Reg(127, RCX)
+			asm.AddlConst8Reg(-128, RBX)
+			asm.AddlConst32Reg(200, RBP)
+			asm.AddqConst8Mem(0, RSI, 0*8)
+			asm.AddqConst8Mem(1, RSI, 0*8)
+			asm.AddqConst8Mem(1, RSI, 1*8)
+			asm.AddqConst8Mem(-1, RSI, 3*8)
+			asm.AddqConst8Mem(14, RSI, 10*8)
+			asm.AddqConst8Mem(14, RSI, 100*8)
+			asm.AddqConst32Mem(0xff, RSI, 0*8)
+			asm.AddqConst32Mem(0xff, RSI, 1*8)
+			asm.AddqConst32Mem(-129, RSI, 100*8)
+			asm.AddqConst8Reg(1, RAX)
+			asm.AddqConst8Reg(-1, RDI)
+			asm.AddqConst32Reg(5000, RSP)
+			asm.AddqConst32Reg(313, R8)
+			asm.AddqConst32Reg(-190, R9)
+		},
+	},
+
+	{
+		name: "testMov",
+		want: []asmExpected{
+			{114, "MOVB AX, (AX)", "8800"},
+			{115, "MOVB CX, 24(SI)", "884e18"},
+			{116, "MOVB BX, -300(BP)", "889dd4feffff"},
+			{117, "MOVL $0, 0*8(SI)", "c70600000000"},
+			{118, "MOVL $1, 0*8(DI)", "c70701000000"},
+			{119, "MOVL $1, 1*8(AX)", "c7400801000000"},
+			{120, "MOVL $-50000, 40*8(SI)", "c78640010000b03cffff"},
+			{121, "MOVL (AX), AX", "8b00"},
+			{122, "MOVL -16(CX), DX", "8b51f0"},
+			{123, "MOVL AX, (AX)", "8900"},
+			{124, "MOVL DX, -16(CX)", "8951f0"},
+			{125, "MOVL $1355, AX", "b84b050000"},
+			{126, "MOVL $-6643, DX", "ba0de6ffff"},
+			{127, "MOVL $500, R14", "41bef4010000"},
+			{128, "MOVQ 0*8(AX), BX", "488b18"},
+			{129, "MOVQ 16*8(BX), AX", "488b8380000000"},
+			{130, "MOVQ AX, 0*8(DI)", "488907"},
+			{131, "MOVQ DX, 3*8(DI)", "48895718"},
+			{132, "MOVQ AX, 0*8(AX)", "488900"},
+			{133, "MOVQ R15, 16(R14)", "4d897e10"},
+			{134, "MOVQ R14, 16(R15)", "4d897710"},
+			{135, "MOVQ CX, 16(R14)", "49894e10"},
+			{136, "MOVQ R14, 16(CX)", "4c897110"},
+			{137, "MOVQ $140038723203072, AX", "48b800f0594e5d7f0000"},
+			{138, "MOVQ $9223372036854775807, DX", "48baffffffffffffff7f"},
+			{139, "MOVQ $-9223372036854775800, SI", "48be0800000000000080"},
+			{140, "MOVQ $922337203685477000, R9", "49b988cacccccccccc0c"},
+			{141, "MOVQ $922337203685477000, R11", "49bb88cacccccccccc0c"},
+			{142, "MOVQ $1423, AX", "48c7c08f050000"},
+			{143, "MOVQ $-23, CX", "48c7c1e9ffffff"},
+			{144, "MOVQ $1, DX", "48c7c201000000"},
+			{145, "MOVQ 100(BP), DX", "488b5564"},
+			{146, "MOVQ $1, 1(AX)", "48c7400101000000"},
+			{147, "MOVQ $-1, 2(AX)", "48c74002ffffffff"},
+			{148, "MOVQ $0, -96(BP)", "48c745a000000000"},
+			{149, "MOVQ $100, -96(BP)", "48c745a064000000"},
+		},
+		run: func(asm *Assembler) {
+			asm.MovbRegMem(RAX, RAX, 0)
+			asm.MovbRegMem(RCX, RSI, 24)
+			asm.MovbRegMem(RBX, RBP, -300)
+			asm.MovlConst32Mem(0, RSI, 0*8)
+			asm.MovlConst32Mem(1, RDI, 0*8)
+			asm.MovlConst32Mem(1, RAX, 1*8)
+			asm.MovlConst32Mem(-50000, RSI, 40*8)
+			asm.MovlMemReg(RAX, RAX, 0)
+			asm.MovlMemReg(RCX, RDX, -16)
+			asm.MovlRegMem(RAX, RAX, 0)
+			asm.MovlRegMem(RDX, RCX, -16)
+			asm.MovlConst32Reg(1355, RAX)
+			asm.MovlConst32Reg(-6643, RDX)
+			asm.MovlConst32Reg(500, R14)
+			asm.MovqMemReg(RAX, RBX, 0*8)
+			asm.MovqMemReg(RBX, RAX, 16*8)
+			asm.MovqRegMem(RAX, RDI, 0*8)
+			asm.MovqRegMem(RDX, RDI, 3*8)
+			asm.MovqRegMem(RAX, RAX, 0*8)
+			asm.MovqRegMem(R15, R14, 16)
+			asm.MovqRegMem(R14, R15, 16)
+			asm.MovqRegMem(RCX, R14, 16)
+			asm.MovqRegMem(R14, RCX, 16)
+			asm.MovqConst64Reg(140038723203072, RAX)
+			asm.MovqConst64Reg(9223372036854775807, RDX)
+			asm.MovqConst64Reg(-9223372036854775800, RSI)
+			asm.MovqConst64Reg(922337203685477000, R9)
+			asm.MovqConst64Reg(922337203685477000, R11)
+			asm.MovqConst32Reg(1423, RAX)
+			asm.MovqConst32Reg(-23, RCX)
+			asm.MovqConst32Reg(1, RDX)
+			asm.MovqMemReg(RBP, RDX, 100)
+			asm.MovqConst32Mem(1, RAX, 1)
+			asm.MovqConst32Mem(-1, RAX, 2)
+			asm.MovqConst32Mem(0, RBP, -96)
+			asm.MovqConst32Mem(100, RBP, -96)
+		},
+	},
+
+	{
+		name: "testCmp",
+		want: []asmExpected{
+			{153, "CMPL AX, 0*8(DI)", "3b07"},
+			{154, "CMPL BX, 1*8(AX)", "3b5808"},
+			{155, "CMPL 16(SI), $0", "837e1000"},
+			{156, "CMPL (AX), $15", "83380f"},
+			{157, "CMPL (DI), $242", "813ff2000000"},
+			{158, "CMPL -8(BX), $-5343", "817bf821ebffff"},
+			{159, "CMPQ 6*8(SI), $0", "48837e3000"},
+			{160, "CMPQ (SI), $999", "48813ee7030000"},
+			{161, "CMPQ 8(DI), $-999", "48817f0819fcffff"},
+		},
+		run: func(asm *Assembler) {
+			asm.CmplRegMem(RAX, RDI, 0*8)
+			asm.CmplRegMem(RBX, RAX, 1*8)
+			asm.CmplConst8Mem(0, RSI, 16)
+			asm.CmplConst8Mem(15, RAX, 0)
+			asm.CmplConst32Mem(242, RDI, 0)
+			asm.CmplConst32Mem(-5343, RBX, -8)
+			asm.CmpqConst8Mem(0, RSI, 6*8)
+			asm.CmpqConst32Mem(999, RSI, 0)
+			asm.CmpqConst32Mem(-999, RDI, 8)
+		},
+	},
+
+	{
+		name: "testNeg",
+		want: []asmExpected{
+			{165, "NEGQ 0*8(SI)", "48f71e"},
+			{166, "NEGQ 5*8(AX)", "48f75828"},
+			{167, "NEGL AX", "f7d8"},
+			{168, "NEGL DX", "f7da"},
+			{169, "NEGL (AX)", "f718"},
+			{170, "NEGL 100(BX)", "f75b64"},
+			{171, "NEGQ CX", "48f7d9"},
+			{172, "NEGQ BX", "48f7db"},
+		},
+		run: func(asm *Assembler) {
+			asm.NegqMem(RSI, 0*8)
+			asm.NegqMem(RAX, 5*8)
+			asm.NeglReg(RAX)
+			asm.NeglReg(RDX)
+			asm.NeglMem(RAX, 0)
+			asm.NeglMem(RBX, 100)
+			asm.NegqReg(RCX)
+			asm.NegqReg(RBX)
+		},
+	},
+
+	{
+		name: "testRaw",
+		want: []asmExpected{
+			{176, "MOVL -16(CX), DX", "8b51f0"},
+			{177, "JMP AX", "ffe0"},
+			{178, "CMPQ 6*8(SI), $0", "48837e3000"},
+		},
+		run: func(asm *Assembler) {
+			asm.Raw(0x8b, 0x51, 0xf0)
+			asm.Raw(0xff, 0xe0)
+			asm.Raw(0x48, 0x83, 0x7e, 0x30, 0x00)
+		},
+	},
+
+	{
+		name: "testCall",
+		want: []asmExpected{
+			{182, "CALL AX", "ffd0"},
+			{183, "CALL BX", "ffd3"},
+		},
+		run: func(asm *Assembler) {
+			asm.CallReg(RAX)
+			asm.CallReg(RBX)
+		},
+	},
+
+	{
+		name: "testSub",
+		want: []asmExpected{
+			{187, "SUBL (AX), DI", "2b38"},
+			{188, "SUBL 16(SI), AX", "2b4610"},
+			{189, "SUBL 640(BX), DX", "2b9380020000"},
+		},
+		run: func(asm *Assembler) {
+			asm.SublMemReg(RAX, RDI, 0)
+			asm.SublMemReg(RSI, RAX, 16)
+			asm.SublMemReg(RBX, RDX, 640)
+		},
+	},
+
+	{
+		name: "testJgt1",
+		want: []asmExpected{
+			{193, "JGT forward2", "7f00"},
+			{195, "JGT forward1", "7f01"},
+			{196, "NOP1", "90"},
+			{198, "NOP1", "90"},
+		},
+		run: func(asm *Assembler) {
+			asm.Jgt(2)
+			asm.Label(2)
+			asm.Jgt(1)
+			asm.Nop(1)
+			asm.Label(1)
+			asm.Nop(1)
+		},
+	},
+
+	{
+		name: "testJgt2",
+		want: []asmExpected{
+			{203, "NOP1", "90"},
+			{204, "JGT l1", "7f03"},
+			{206, "NOP1", "90"},
+			{207, "JGT l2", "7ffa"},
+			{209, "NOP1", "90"},
+			{210, "JGT l3", "7ffa"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(2)
+			asm.Nop(1)
+			asm.Jgt(1)
+			asm.Label(3)
+			asm.Nop(1)
+			asm.Jgt(2)
+			asm.Label(1)
+			asm.Nop(1)
+			asm.Jgt(3)
+		},
+	},
+
+	{
+		name: "testImul",
+		want: []asmExpected{
+			{214, "IMULL (AX), CX", "0faf08"},
+			{215, "IMULL 4(SI), CX", "0faf4e04"},
+			{216, "IMULL -8(DX), AX", "0faf42f8"},
+		},
+		run: func(asm *Assembler) {
+			asm.ImullMemReg(RAX, RCX, 0)
+			asm.ImullMemReg(RSI, RCX, 4)
+			asm.ImullMemReg(RDX, RAX, -8)
+		},
+	},
+
+	{
+		name: "testMovlqsx",
+		want: []asmExpected{
+			{220, "MOVLQSX 4(AX), BX", "48635804"},
+			{221, "MOVLQSX 8(AX), AX", "48634008"},
+		},
+		run: func(asm *Assembler) {
+			asm.MovlqsxMemReg(RAX, RBX, 4)
+			asm.MovlqsxMemReg(RAX, RAX, 8)
+		},
+	},
+
+	{
+		name: "testJlt1",
+		want: []asmExpected{
+			{225, "JLT forward2", "7c00"},
+			{227, "JLT forward1", "7c01"},
+			{228, "NOP1", "90"},
+			{230, "NOP1", "90"},
+		},
+		run: func(asm *Assembler) {
+			asm.Jlt(2)
+			asm.Label(2)
+			asm.Jlt(1)
+			asm.Nop(1)
+			asm.Label(1)
+			asm.Nop(1)
+		},
+	},
+
+	{
+		name: "testJlt2",
+		want: []asmExpected{
+			{235, "NOP1", "90"},
+			{236, "JLT l1", "7c03"},
+			{238, "NOP1", "90"},
+			{239, "JLT l2", "7cfa"},
+			{241, "NOP1", "90"},
+			{242, "JLT l3", "7cfa"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(2)
+			asm.Nop(1)
+			asm.Jlt(1)
+			asm.Label(3)
+			asm.Nop(1)
+			asm.Jlt(2)
+			asm.Label(1)
+			asm.Nop(1)
+			asm.Jlt(3)
+		},
+	},
+
+	{
+		name: "testCdq",
+		want: []asmExpected{
+			{246, "CDQ", "99"},
+		},
+		run: func(asm *Assembler) {
+			asm.Cdq()
+		},
+	},
+
+	{
+		name: "testIdivl",
+		want: []asmExpected{
+			{250, "IDIVL (AX)", "f738"},
+			{251, "IDIVL 16(CX)", "f77910"},
+			{252, "IDIVL AX", "f7f8"},
+			{253, "IDIVL BX", "f7fb"},
+		},
+		run: func(asm *Assembler) {
+			asm.IdivlMem(RAX, 0)
+			asm.IdivlMem(RCX, 16)
+			asm.IdivlReg(RAX)
+			asm.IdivlReg(RBX)
+		},
+	},
+
+	{
+		name: "testMovIndex",
+		want: []asmExpected{
+			{257, "MOVL (AX)(CX*4), AX", "8b0488"},
+			{258, "MOVL (CX)(CX*4), BX", "8b1c89"},
+			{259, "MOVL (SI)(AX*4), CX", "8b0c86"},
+			{260, "MOVL (AX)(SI*4), CX", "8b0cb0"},
+			{261, "MOVL $0, (AX)(CX*4)", "c7048800000000"},
+			{262, "MOVL $14, (DX)(DI*4)", "c704ba0e000000"},
+			{263, "MOVL $-6, (SI)(BX*4)", "c7049efaffffff"},
+			{264, "MOVL AX, (AX)(CX*4)", "890488"},
+			{265, "MOVL DX, (DI)(AX*4)", "891487"},
+			{266, "MOVL SI, (SI)(SI*4)", "8934b6"},
+			{267, "MOVL CX, (CX)(CX*4)", "890c89"},
+			{268, "MOVL R8, (SI)(CX*4)", "4489048e"},
+		},
+		run: func(asm *Assembler) {
+			asm.MovlMemindexReg(RAX, RAX, RCX)
+			asm.MovlMemindexReg(RCX, RBX, RCX)
+			asm.MovlMemindexReg(RSI, RCX, RAX)
+			asm.MovlMemindexReg(RAX, RCX, RSI)
+			asm.MovlConst32Memindex(0, RAX, RCX)
+			asm.MovlConst32Memindex(14, RDX, RDI)
+			asm.MovlConst32Memindex(-6, RSI, RBX)
+			asm.MovlRegMemindex(RAX, RAX, RCX)
+			asm.MovlRegMemindex(RDX, RDI, RAX)
+			asm.MovlRegMemindex(RSI, RSI, RSI)
+			asm.MovlRegMemindex(RCX, RCX, RCX)
+			asm.MovlRegMemindex(R8, RSI, RCX)
+		},
+	},
+
+	{
+		name: "testJle1",
+		want: []asmExpected{
+			{272, "JLE forward2", "7e00"},
+			{274, "JLE forward1", "7e01"},
+			{275, "NOP1", "90"},
+			{277, "NOP1", "90"},
+		},
+		run: func(asm *Assembler) {
+			asm.Jle(2)
+			asm.Label(2)
+			asm.Jle(1)
+			asm.Nop(1)
+			asm.Label(1)
+			asm.Nop(1)
+		},
+	},
+
+	{
+		name: "testJle2",
+		want: []asmExpected{
+			{282, "NOP1", "90"},
+			{283, "JLE l1", "7e03"},
+			{285, "NOP1", "90"},
+			{286, "JLE l2", "7efa"},
+			{288, "NOP1", "90"},
+			{289, "JLE l3", "7efa"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(2)
+			asm.Nop(1)
+			asm.Jle(1)
+			asm.Label(3)
+			asm.Nop(1)
+			asm.Jle(2)
+			asm.Label(1)
+			asm.Nop(1)
+			asm.Jle(3)
+		},
+	},
+
+	{
+		name: "testJne1",
+		want: []asmExpected{
+			{293, "JNE forward2", "7500"},
+			{295, "JNE forward1", "7501"},
+			{296, "NOP1", "90"},
+			{298, "NOP1", "90"},
+		},
+		run: func(asm *Assembler) {
+			asm.Jne(2)
+			asm.Label(2)
+			asm.Jne(1)
+			asm.Nop(1)
+			asm.Label(1)
+			asm.Nop(1)
+		},
+	},
+
+	{
+		name: "testJne2",
+		want: []asmExpected{
+			{303, "NOP1", "90"},
+			{304, "JNE l1", "7503"},
+			{306, "NOP1", "90"},
+			{307, "JNE l2", "75fa"},
+			{309, "NOP1", "90"},
+			{310, "JNE l3", "75fa"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(2)
+			asm.Nop(1)
+			asm.Jne(1)
+			asm.Label(3)
+			asm.Nop(1)
+			asm.Jne(2)
+			asm.Label(1)
+			asm.Nop(1)
+			asm.Jne(3)
+		},
+	},
+
+	{
+		name: "testJae1",
+		want: []asmExpected{
+			{314, "JCC forward2", "7300"},
+			{316, "JCC forward1", "7301"},
+			{317, "NOP1", "90"},
+			{319, "NOP1", "90"},
+		},
+		run: func(asm *Assembler) {
+			asm.Jae(2)
+			asm.Label(2)
+			asm.Jae(1)
+			asm.Nop(1)
+			asm.Label(1)
+			asm.Nop(1)
+		},
+	},
+
+	{
+		name: "testJae2",
+		want: []asmExpected{
+			{324, "NOP1", "90"},
+			{325, "JCC l1", "7303"},
+			{327, "NOP1", "90"},
+			{328, "JCC l2", "73fa"},
+			{330, "NOP1", "90"},
+			{331, "JCC l3", "73fa"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(2)
+			asm.Nop(1)
+			asm.Jae(1)
+			asm.Label(3)
+			asm.Nop(1)
+			asm.Jae(2)
+			asm.Label(1)
+			asm.Nop(1)
+			asm.Jae(3)
+		},
+	},
+
+	{
+		name: "testCmpReg",
+		want: []asmExpected{
+			{335, "CMPL AX, $15", "83f80f"},
+			{336, "CMPL CX, $-1", "83f9ff"},
+			{337, "CMPL DX, $1000", "81fae8030000"},
+			{338, "CMPL R9, $-200", "4181f938ffffff"},
+		},
+		run: func(asm *Assembler) {
+			asm.CmplConst8Reg(15, RAX)
+			asm.CmplConst8Reg(-1, RCX)
+			asm.CmplConst32Reg(1000, RDX)
+			asm.CmplConst32Reg(-200, R9)
+		},
+	},
+
+	{
+		name: "testJe1",
+		want: []asmExpected{
+			{342, "JEQ forward2", "7400"},
+			{344, "JEQ forward1", "7401"},
+			{345, "NOP1", "90"},
+			{347, "NOP1", "90"},
+		},
+		run: func(asm *Assembler) {
+			asm.Je(2)
+			asm.Label(2)
+			asm.Je(1)
+			asm.Nop(1)
+			asm.Label(1)
+			asm.Nop(1)
+		},
+	},
+
+	{
+		name: "testJe2",
+		want: []asmExpected{
+			{352, "NOP1", "90"},
+			{353, "JEQ l1", "7403"},
+			{355, "NOP1", "90"},
+			{356, "JEQ l2", "74fa"},
+			{358, "NOP1", "90"},
+			{359, "JEQ l3", "74fa"},
+		},
+		run: func(asm *Assembler) {
+			asm.Label(2)
+			asm.Nop(1)
+			asm.Je(1)
+			asm.Label(3)
+			asm.Nop(1)
+			asm.Je(2)
+			asm.Label(1)
+			asm.Nop(1)
+			asm.Je(3)
+		},
+	},
+
+	{
+		name: "testCmpqReg",
+		want: []asmExpected{
+			{363, "CMPQ AX, 0*8(DI)", "483b07"},
+			{364, "CMPQ BX, 1*8(SI)", "483b5e08"},
+			{365, "CMPQ R8, 300(SI)", "4c3b862c010000"},
+		},
+		run: func(asm *Assembler) {
+			asm.CmpqRegMem(RAX, RDI, 0*8)
+			asm.CmpqRegMem(RBX, RSI, 1*8)
+			asm.CmpqRegMem(R8, RSI, 300)
+		},
+	},
+
+	{
+		name: "testRegReg",
+		want: []asmExpected{
+			{369, "MOVL BX, R9", "4189d9"},
+			{370, "MOVL R13, AX", "4489e8"},
+			{371, "MOVQ R12, CX", "4c89e1"},
+			{372, "MOVQ AX, BX", "4889c3"},
+			{373, "ADDL R10, AX", "4401d0"},
+			{374, "ADDL AX, R11", "4101c3"},
+			{375, "SUBL BX, AX", "29d8"},
+			{376, "SUBL R9, R10", "4529ca"},
+			{377, "IMULL BX, AX", "0fafc3"},
+			{378, "IMULL R13, R9", "450fafcd"},
+			{379, "CMPL AX, BX", "39d8"},
+			{380, "CMPL R9, R12", "4539e1"},
+			{381, "CMPQ BX, AX", "4839c3"},
+			{382, "CMPQ R11, CX", "4939cb"},
+			{383, "CMPQ BX, $0", "4883fb00"},
+			{384, "CMPQ R10, $-100", "4983fa9c"},
+			{385, "CMPQ CX, $1000", "4881f9e8030000"},
+			{386, "MOVLQSX BX, AX", "4863c3"},
+			{387, "MOVLQSX AX, R12", "4c63e0"},
+			{388, "MOVBLSX AX, AX", "0fbec0"},
+			{389, "MOVBLSX R9, BX", "410fbed9"},
+		},
+		run: func(asm *Assembler) {
+			asm.MovlRegReg(RBX, R9)
+			asm.MovlRegReg(R13, RAX)
+			asm.MovqRegReg(R12, RCX)
+			asm.MovqRegReg(RAX, RBX)
+			asm.AddlRegReg(R10, RAX)
+			asm.AddlRegReg(RAX, R11)
+			asm.SublRegReg(RBX, RAX)
+			asm.SublRegReg(R9, R10)
+			asm.ImullRegReg(RBX, RAX)
+			asm.ImullRegReg(R13, R9)
+			asm.CmplRegReg(RAX, RBX)
+			asm.CmplRegReg(R9, R12)
+			asm.CmpqRegReg(RBX, RAX)
+			asm.CmpqRegReg(R11, RCX)
+			asm.CmpqConst8Reg(0, RBX)
+			asm.CmpqConst8Reg(-100, R10)
+			asm.CmpqConst32Reg(1000, RCX)
+			asm.MovlqsxRegReg(RBX, RAX)
+			asm.MovlqsxRegReg(RAX, R12)
+			asm.MovblsxRegReg(RAX, RAX)
+			asm.MovblsxRegReg(R9, RBX)
+		},
+	},
 
-	for _, test := range tests {
+	{
+		name: "testBitwise",
+		want: []asmExpected{
+			{393, "ANDL BX, CX", "21d9"},
+			{394, "ANDQ R9, DX", "4c21ca"},
+			{395, "ANDL 8(SI), DX", "235608"},
+			{396, "ANDQ -16(BP), R11", "4c235df0"},
+			{397, "ANDL $7, CX", "83e107"},
+			{398, "ANDL $0xfff0, R9", "4181e1f0ff0000"},
+			{399, "ANDQ $-16, R10", "4983e2f0"},
+			{400, "ANDQ $0x7fffffff, BX", "4881e3ffffff7f"},
+			{401, "ORL AX, BX", "09c3"},
+			{402, "ORQ R12, R13", "4d09e5"},
+			{403, "ORL (DI), AX", "0b07"},
+			{404, "ORQ 24(SI), CX", "480b4e18"},
+			{405, "ORL $1, DX", "83ca01"},
+			{406, "ORL $1000, SI", "81cee8030000"},
+			{407, "ORQ $-1, R8", "4983c8ff"},
+			{408, "ORQ $300, DI", "4881cf2c010000"},
+			{409, "XORL AX, AX", "31c0"},
+			{410, "XORQ R15, CX", "4c31f9"},
+			{411, "XORL 4(BX), R9", "44334b04"},
+			{412, "XORQ 1000(SI), AX", "483386e8030000"},
+			{413, "XORL $-1, BX", "83f3ff"},
+			{414, "XORL $0x10000, CX", "81f100000100"},
+			{415, "XORQ $127, R14", "4983f67f"},
+			{416, "XORQ $-129, DX", "4881f27fffffff"},
+		},
+		run: func(asm *Assembler) {
+			asm.AndlRegReg(RBX, RCX)
+			asm.AndqRegReg(R9, RDX)
+			asm.AndlMemReg(RSI, RDX, 8)
+			asm.AndqMemReg(RBP, R11, -16)
+			asm.AndlConst8Reg(7, RCX)
+			asm.AndlConst32Reg(0xfff0, R9)
+			asm.AndqConst8Reg(-16, R10)
+			asm.AndqConst32Reg(0x7fffffff, RBX)
+			asm.OrlRegReg(RAX, RBX)
+			asm.OrqRegReg(R12, R13)
+			asm.OrlMemReg(RDI, RAX, 0)
+			asm.OrqMemReg(RSI, RCX, 24)
+			asm.OrlConst8Reg(1, RDX)
+			asm.OrlConst32Reg(1000, RSI)
+			asm.OrqConst8Reg(-1, R8)
+			asm.OrqConst32Reg(300, RDI)
+			asm.XorlRegReg(RAX, RAX)
+			asm.XorqRegReg(R15, RCX)
+			asm.XorlMemReg(RBX, R9, 4)
+			asm.XorqMemReg(RSI, RAX, 1000)
+			asm.XorlConst8Reg(-1, RBX)
+			asm.XorlConst32Reg(0x10000, RCX)
+			asm.XorqConst8Reg(127, R14)
+			asm.XorqConst32Reg(-129, RDX)
+		},
+	},
+
+	{
+		name: "testShift",
+		want: []asmExpected{
+			{420, "SHLL $3, CX", "c1e103"},
+			{421, "SHLL $1, DX", "d1e2"},
+			{422, "SHLL CX, BX", "d3e3"},
+			{423, "SHLQ $32, R9", "49c1e120"},
+			{424, "SHLQ CX, AX", "48d3e0"},
+			{425, "SHRL $31, AX", "c1e81f"},
+			{426, "SHRL CX, R10", "41d3ea"},
+			{427, "SHRQ $63, R11", "49c1eb3f"},
+			{428, "SHRQ $1, SI", "48d1ee"},
+			{429, "SARL $1, DI", "d1ff"},
+			{430, "SARL CX, DX", "d3fa"},
+			{431, "SARQ $7, BX", "48c1fb07"},
+			{432, "SARQ CX, R9", "49d3f9"},
+		},
+		run: func(asm *Assembler) {
+			asm.ShllConstReg(3, RCX)
+			asm.ShllConstReg(1, RDX)
+			asm.ShllCLReg(RBX)
+			asm.ShlqConstReg(32, R9)
+			asm.ShlqCLReg(RAX)
+			asm.ShrlConstReg(31, RAX)
+			asm.ShrlCLReg(R10)
+			asm.ShrqConstReg(63, R11)
+			asm.ShrqConstReg(1, RSI)
+			asm.SarlConstReg(1, RDI)
+			asm.SarlCLReg(RDX)
+			asm.SarqConstReg(7, RBX)
+			asm.SarqCLReg(R9)
+		},
+	},
+
+	{
+		name: "testTest",
+		want: []asmExpected{
+			{436, "TESTL BX, CX", "85d9"},
+			{437, "TESTL R9, AX", "4485c8"},
+			{438, "TESTQ DX, DX", "4885d2"},
+			{439, "TESTQ AX, R12", "4985c4"},
+			{440, "TESTL $0x100, BX", "f7c300010000"},
+			{441, "TESTQ $1, R8", "49f7c001000000"},
+		},
+		run: func(asm *Assembler) {
+			asm.TestlRegReg(RCX, RBX)
+			asm.TestlRegReg(RAX, R9)
+			asm.TestqRegReg(RDX, RDX)
+			asm.TestqRegReg(R12, RAX)
+			asm.TestlConstReg(0x100, RBX)
+			asm.TestqConstReg(1, R8)
+		},
+	},
+
+	{
+		name: "testSetcc",
+		want: []asmExpected{
+			{445, "SETEQ CX", "0f94c1"},
+			{446, "SETNE SI", "400f95c6"},
+			{447, "SETLT R9", "410f9cc1"},
+			{448, "SETGE DI", "400f9dc7"},
+			{449, "SETLE BX", "0f9ec3"},
+			{450, "SETGT DX", "0f9fc2"},
+			{451, "SETCS AX", "0f92c0"},
+			{452, "SETCC AX", "0f93c0"},
+			{453, "SETLS BP", "400f96c5"},
+			{454, "SETHI R15", "410f97c7"},
+		},
+		run: func(asm *Assembler) {
+			asm.SetccReg(CondE, RCX)
+			asm.SetccReg(CondNE, RSI)
+			asm.SetccReg(CondL, R9)
+			asm.SetccReg(CondGE, RDI)
+			asm.SetccReg(CondLE, RBX)
+			asm.SetccReg(CondG, RDX)
+			asm.SetccReg(CondB, RAX)
+			asm.SetccReg(CondAE, RAX)
+			asm.SetccReg(CondBE, RBP)
+			asm.SetccReg(CondA, R15)
+		},
+	},
+
+	{
+		name: "testCmov",
+		want: []asmExpected{
+			{458, "CMOVLEQ BX, CX", "0f44cb"},
+			{459, "CMOVLNE R9, AX", "410f45c1"},
+			{460, "CMOVLLT AX, R10", "440f4cd0"},
+			{461, "CMOVLGE DX, SI", "0f4df2"},
+			{462, "CMOVQLE R11, R12", "4d0f4ee3"},
+			{463, "CMOVQGT CX, DX", "480f4fd1"},
+			{464, "CMOVQCS SI, DI", "480f42fe"},
+			{465, "CMOVQHI R8, BX", "490f47d8"},
+		},
+		run: func(asm *Assembler) {
+			asm.CmovlRegReg(CondE, RBX, RCX)
+			asm.CmovlRegReg(CondNE, R9, RAX)
+			asm.CmovlRegReg(CondL, RAX, R10)
+			asm.CmovlRegReg(CondGE, RDX, RSI)
+			asm.CmovqRegReg(CondLE, R11, R12)
+			asm.CmovqRegReg(CondG, RCX, RDX)
+			asm.CmovqRegReg(CondB, RSI, RDI)
+			asm.CmovqRegReg(CondA, R8, RBX)
+		},
+	},
+
+	{
+		name: "testImul3",
+		want: []asmExpected{
+			{469, "IMUL3L $7, BX, CX", "6bcb07"},
+			{470, "IMUL3L $1000, R9, AX", "4169c1e8030000"},
+			{471, "IMUL3Q $-3, CX, R12", "4c6be1fd"},
+			{472, "IMUL3Q $100000, SI, DI", "4869fea0860100"},
+		},
+		run: func(asm *Assembler) {
+			asm.ImullConst8RegReg(7, RBX, RCX)
+			asm.ImullConst32RegReg(1000, R9, RAX)
+			asm.ImulqConst8RegReg(-3, RCX, R12)
+			asm.ImulqConst32RegReg(100000, RSI, RDI)
+		},
+	},
+
+	{
+		name: "testLea",
+		want: []asmExpected{
+			{476, "LEAQ 8(AX), CX", "488d4808"},
+			{477, "LEAQ (SP), BX", "488d1c24"},
+			{478, "LEAQ 16(R12), AX", "498d442410"},
+			{479, "LEAQ (BP), DX", "488d5500"},
+			{480, "LEAQ -300(R13), R8", "4d8d85d4feffff"},
+			{481, "LEAQ (AX)(BX*1), CX", "488d0c18"},
+			{482, "LEAQ 8(AX)(BX*2), CX", "488d4c5808"},
+			{483, "LEAQ -4(R13)(R9*8), R10", "4f8d54cdfc"},
+			{484, "LEAQ 1000(SI)(CX*4), DX", "488d948ee8030000"},
+			{485, "LEAQ (BP)(AX*4), BX", "488d5c8500"},
+			{486, "LEAQ (R12)(R15*1), SI", "4b8d343c"},
+		},
+		run: func(asm *Assembler) {
+			asm.LeaqMemReg(RAX, RCX, 8)
+			asm.LeaqMemReg(RSP, RBX, 0)
+			asm.LeaqMemReg(R12, RAX, 16)
+			asm.LeaqMemReg(RBP, RDX, 0)
+			asm.LeaqMemReg(R13, R8, -300)
+			asm.LeaqMemindexReg(RAX, RCX, RBX, 1, 0)
+			asm.LeaqMemindexReg(RAX, RCX, RBX, 2, 8)
+			asm.LeaqMemindexReg(R13, R10, R9, 8, -4)
+			asm.LeaqMemindexReg(RSI, RDX, RCX, 4, 1000)
+			asm.LeaqMemindexReg(RBP, RBX, RAX, 4, 0)
+			asm.LeaqMemindexReg(R12, RSI, R15, 1, 0)
+		},
+	},
+
+	{
+		name: "testExtend",
+		want: []asmExpected{
+			{490, "MOVBLZX CX, BX", "0fb6d9"},
+			{491, "MOVBLZX SI, AX", "400fb6c6"},
+			{492, "MOVBLSX DI, R8", "440fbec7"},
+			{493, "MOVWLZX R9, AX", "410fb7c1"},
+			{494, "MOVWLSX BX, CX", "0fbfcb"},
+			{495, "MOVBLZX 3(SI), AX", "0fb64603"},
+			{496, "MOVBLSX (AX), R10", "440fbe10"},
+			{497, "MOVWLZX 8(SP), CX", "0fb74c2408"},
+			{498, "MOVWLSX -2(BP), DX", "0fbf55fe"},
+			{499, "MOVW AX, 2(SI)", "66894602"},
+			{500, "MOVW R9, (BX)", "6644890b"},
+			{501, "MOVB SI, (AX)", "408830"},
+			{502, "MOVB R10, 1(DI)", "44885701"},
+		},
+		run: func(asm *Assembler) {
+			asm.MovblzxRegReg(RCX, RBX)
+			asm.MovblzxRegReg(RSI, RAX)
+			asm.MovblsxRegReg(RDI, R8)
+			asm.MovwlzxRegReg(R9, RAX)
+			asm.MovwlsxRegReg(RBX, RCX)
+			asm.MovblzxMemReg(RSI, RAX, 3)
+			asm.MovblsxMemReg(RAX, R10, 0)
+			asm.MovwlzxMemReg(RSP, RCX, 8)
+			asm.MovwlsxMemReg(RBP, RDX, -2)
+			asm.MovwRegMem(RAX, RSI, 2)
+			asm.MovwRegMem(R9, RBX, 0)
+			asm.MovbRegMem(RSI, RAX, 0)
+			asm.MovbRegMem(R10, RDI, 1)
+		},
+	},
+
+	{
+		name: "testMemBase",
+		want: []asmExpected{
+			{506, "MOVL 8(R12), AX", "418b442408"},
+			{507, "MOVQ BX, (SP)", "48891c24"},
+			{508, "MOVL (R13), CX", "418b4d00"},
+			{509, "MOVQ (BP), DX", "488b5500"},
+			{510, "ADDL $1, (R12)", "4183042401"},
+			{511, "MOVL $5, (AX)(R9*4)", "42c7048805000000"},
+			{512, "MOVL (R8)(R11*4), DX", "438b1498"},
+		},
+		run: func(asm *Assembler) {
+			asm.MovlMemReg(R12, RAX, 8)
+			asm.MovqRegMem(RBX, RSP, 0)
+			asm.MovlMemReg(R13, RCX, 0)
+			asm.MovqMemReg(RBP, RDX, 0)
+			asm.AddlConst8Mem(1, R12, 0)
+			asm.MovlConst32Memindex(5, RAX, R9)
+			asm.MovlMemindexReg(R8, RDX, R11)
+		},
+	},
+
+	{
+		name: "testIdivq",
+		want: []asmExpected{
+			{516, "CQO", "4899"},
+			{517, "IDIVQ BX", "48f7fb"},
+			{518, "IDIVQ R10", "49f7fa"},
+			{519, "IDIVQ 8(SI)", "48f77e08"},
+			{520, "IDIVQ (R12)", "49f73c24"},
+		},
+		run: func(asm *Assembler) {
+			asm.Cqo()
+			asm.IdivqReg(RBX)
+			asm.IdivqReg(R10)
+			asm.IdivqMem(RSI, 8)
+			asm.IdivqMem(R12, 0)
+		},
+	},
+
+	{
+		name: "testJunsigned",
+		want: []asmExpected{
+			{524, "JCS forward2", "7200"},
+			{526, "JHI forward1", "7703"},
+			{527, "JLS forward1", "7601"},
+			{528, "NOP1", "90"},
+			{530, "NOP1", "90"},
+		},
+		run: func(asm *Assembler) {
+			asm.Jb(2)
+			asm.Label(2)
+			asm.Ja(1)
+			asm.Jbe(1)
+			asm.Nop(1)
+			asm.Label(1)
+			asm.Nop(1)
+		},
+	},
+
+	{
+		name: "testAddq",
+		want: []asmExpected{
+			{534, "ADDQ CX, AX", "4801c8"},
+			{535, "ADDQ R9, BX", "4c01cb"},
+			{536, "ADDQ SI, R14", "4901f6"},
+		},
+		run: func(asm *Assembler) {
+			asm.AddqRegReg(RCX, RAX)
+			asm.AddqRegReg(R9, RBX)
+			asm.AddqRegReg(RSI, R14)
+		},
+	},
+}
+
+func TestAsm(t *testing.T) {
+	for _, test := range asmTests {
 		t.Run(test.name, func(t *testing.T) {
 			asm := NewAssembler()
 			test.run(asm)
@@ -17,6 +17,7 @@ type Assembler struct {
 	pending []instruction
 	jumps   []int
 	labels  []int
+	aligns  []int
 }
 
 func (a *Assembler) Reset() {
@@ -24,9 +25,19 @@ func (a *Assembler) Reset() {
 	a.pending = a.pending[:0]
 	a.jumps = a.jumps[:0]
 	a.labels = a.labels[:0]
+	a.aligns = a.aligns[:0]
+}
+
+// Index returns an index that will be assigned to the next instruction.
+// After Link, OffsetOf can be used to get its offset.
+func (a *Assembler) Index() int {
+	return len(a.pending)
 }
 
 func (a *Assembler) OffsetOf(index int) int32 {
+	if index == len(a.pending) {
+		return int32(a.length)
+	}
 	return a.pending[index].offset
 }
 
@@ -52,6 +63,66 @@ func (a *Assembler) Jmp(labelID int64) {
 	a.pushJmp(jmp8op, labelID)
 }
 
+// JmpRel32 is like Jmp, but it always uses rel32 encoding form.
+// Its width is fixed (5 bytes), so it can be used to build jump tables.
+func (a *Assembler) JmpRel32(labelID int64) {
+	a.jumps = append(a.jumps, len(a.pending))
+	a.push(instruction{
+		opcode: jmp32op,
+		imm:    labelID,
+		size:   5,
+		disp:   5,
+		flags:  flagPseudo,
+	})
+}
+
+// CallRel32 emits a call to the label.
+// Like JmpRel32, it always uses rel32 encoding form.
+func (a *Assembler) CallRel32(labelID int64) {
+	a.jumps = append(a.jumps, len(a.pending))
+	a.push(instruction{
+		opcode: call32op,
+		imm:    labelID,
+		size:   5,
+		disp:   5,
+		flags:  flagPseudo,
+	})
+}
+
+// LeaqLabelReg loads the label address into reg.
+// It always uses RIP-relative disp32 form, so its width is fixed (7 bytes).
+func (a *Assembler) LeaqLabelReg(labelID int64, reg uint8) {
+	a.jumps = append(a.jumps, len(a.pending))
+	a.push(instruction{
+		opcode: 0x8D,
+		reg1:   reg,
+		imm:    labelID,
+		size:   7,
+		disp:   7,
+		flags:  flagPseudo | flagRIP,
+	})
+}
+
+func (a *Assembler) Ja(labelID int64) {
+	a.pushJcc(ja8op, labelID)
+}
+
+func (a *Assembler) Jae(labelID int64) {
+	a.pushJcc(jae8op, labelID)
+}
+
+func (a *Assembler) Jb(labelID int64) {
+	a.pushJcc(jb8op, labelID)
+}
+
+func (a *Assembler) Jbe(labelID int64) {
+	a.pushJcc(jbe8op, labelID)
+}
+
+func (a *Assembler) Je(labelID int64) {
+	a.pushJcc(je8op, labelID)
+}
+
 func (a *Assembler) Jne(labelID int64) {
 	a.pushJcc(jne8op, labelID)
 }
@@ -72,6 +143,25 @@ func (a *Assembler) Jgt(labelID int64) {
 	a.pushJcc(jgt8op, labelID)
 }
 
+// Align inserts NOP padding that makes the offset of the next
+// instruction plus skew a multiple of n after the Link.
+//
+// It's used to align the fixup immediates, so they can be
+// patched atomically while the code is being executed.
+func (a *Assembler) Align(n, skew int) {
+	inst := instruction{
+		imm:   int64(n),
+		disp:  int32(skew),
+		size:  uint8(n - 1), // Max padding size, shrunk by Link
+		flags: flagPseudo,
+	}
+	for i := range inst.buf[:inst.size] {
+		inst.buf[i] = 0x90
+	}
+	a.aligns = append(a.aligns, len(a.pending))
+	a.push(inst)
+}
+
 func (a *Assembler) Nop(length int) {
 	// TODO(quasilyte): use wide NOPs.
 	for i := 0; i < length; i++ {
@@ -157,8 +247,36 @@ func (a *Assembler) NegqMem(reg uint8, disp int32) {
 	})
 }
 
+func (a *Assembler) CmplConstReg(v int64, reg uint8) {
+	if fitsInt8(v) {
+		a.CmplConst8Reg(int8(v), reg)
+	} else {
+		a.CmplConst32Reg(int32(v), reg)
+	}
+}
+
+func (a *Assembler) CmplConst8Reg(v int8, reg uint8) {
+	a.push(instruction{
+		opcode: 0x83,
+		reg1:   op7,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) CmplConst32Reg(v int32, reg uint8) {
+	a.push(instruction{
+		opcode: 0x81,
+		reg1:   op7,
+		reg2:   reg,
+		flags:  flagModRM | flagImm32,
+		imm:    int64(v),
+	})
+}
+
 func (a *Assembler) CmplConstMem(v int64, reg uint8, disp int32) {
-	if v >= -128 && v >= 127 {
+	if fitsInt8(v) {
 		a.CmplConst8Mem(int8(v), reg, disp)
 	} else {
 		a.CmplConst32Mem(int32(v), reg, disp)
@@ -188,7 +306,7 @@ func (a *Assembler) CmplConst32Mem(v int32, reg uint8, disp int32) {
 }
 
 func (a *Assembler) CmpqConstMem(v int64, reg uint8, disp int32) {
-	if v >= -128 && v >= 127 {
+	if fitsInt8(v) {
 		a.CmpqConst8Mem(int8(v), reg, disp)
 	} else {
 		a.CmpqConst32Mem(int32(v), reg, disp)
@@ -227,12 +345,68 @@ func (a *Assembler) CmplRegMem(xreg uint8, yreg uint8, disp int32) {
 	})
 }
 
+func (a *Assembler) CmpqRegMem(xreg uint8, yreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0x3B,
+		reg1:   xreg,
+		reg2:   yreg,
+		flags:  flagModRM | flagMemory | flagRexW,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) CmpqConstReg(v int64, reg uint8) {
+	if fitsInt8(v) {
+		a.CmpqConst8Reg(int8(v), reg)
+	} else {
+		a.CmpqConst32Reg(int32(v), reg)
+	}
+}
+
+func (a *Assembler) CmpqConst8Reg(v int8, reg uint8) {
+	a.push(instruction{
+		opcode: 0x83,
+		reg1:   op7,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) CmpqConst32Reg(v int32, reg uint8) {
+	a.push(instruction{
+		opcode: 0x81,
+		reg1:   op7,
+		reg2:   reg,
+		flags:  flagModRM | flagImm32 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) CmplRegReg(xreg, yreg uint8) {
+	a.push(instruction{
+		opcode: 0x39,
+		reg1:   yreg,
+		reg2:   xreg,
+		flags:  flagModRM,
+	})
+}
+
+func (a *Assembler) CmpqRegReg(xreg, yreg uint8) {
+	a.push(instruction{
+		opcode: 0x39,
+		reg1:   yreg,
+		reg2:   xreg,
+		flags:  flagModRM | flagRexW,
+	})
+}
+
 func (a *Assembler) MovbRegMem(srcreg, dstreg uint8, disp int32) {
 	a.push(instruction{
 		opcode: 0x88,
 		reg1:   srcreg,
 		reg2:   dstreg,
-		flags:  flagModRM | flagMemory,
+		flags:  flagModRM | flagMemory | flagByteReg1,
 		disp:   disp,
 	})
 }
@@ -247,6 +421,24 @@ func (a *Assembler) MovlRegMem(srcreg, dstreg uint8, disp int32) {
 	})
 }
 
+func (a *Assembler) MovlRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x89,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flagModRM,
+	})
+}
+
+func (a *Assembler) MovqRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x89,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flagModRM | flagRexW,
+	})
+}
+
 func (a *Assembler) MovlRegMemindex(srcreg, dstreg, index uint8) {
 	a.push(instruction{
 		opcode: 0x89,
@@ -393,6 +585,15 @@ func (a *Assembler) SublMemReg(srcreg, dstreg uint8, disp int32) {
 	})
 }
 
+func (a *Assembler) SublRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x29,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flagModRM,
+	})
+}
+
 func (a *Assembler) IdivlReg(reg uint8) {
 	a.push(instruction{
 		opcode: 0xF7,
@@ -422,6 +623,33 @@ func (a *Assembler) ImullMemReg(srcreg, dstreg uint8, disp int32) {
 	})
 }
 
+func (a *Assembler) ImullRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0xAF,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flag0F | flagModRM,
+	})
+}
+
+func (a *Assembler) AddlRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x01,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flagModRM,
+	})
+}
+
+func (a *Assembler) AddqRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x01,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flagModRM | flagRexW,
+	})
+}
+
 func (a *Assembler) AddlMemReg(srcreg, dstreg uint8, disp int32) {
 	a.push(instruction{
 		opcode: 0x03,
@@ -433,7 +661,7 @@ func (a *Assembler) AddlMemReg(srcreg, dstreg uint8, disp int32) {
 }
 
 func (a *Assembler) AddlConstMem(v int64, reg uint8, disp int32) {
-	if v >= -128 && v >= 127 {
+	if fitsInt8(v) {
 		a.AddlConst8Mem(int8(v), reg, disp)
 	} else {
 		a.AddlConst32Mem(int32(v), reg, disp)
@@ -463,7 +691,7 @@ func (a *Assembler) AddlConst32Mem(v int32, reg uint8, disp int32) {
 }
 
 func (a *Assembler) AddlConstReg(v int64, reg uint8) {
-	if v >= -128 && v >= 127 {
+	if fitsInt8(v) {
 		a.AddlConst8Reg(int8(v), reg)
 	} else {
 		a.AddlConst32Reg(int32(v), reg)
@@ -491,7 +719,7 @@ func (a *Assembler) AddlConst32Reg(v int32, reg uint8) {
 }
 
 func (a *Assembler) AddqConstReg(v int64, reg uint8) {
-	if v >= -128 && v >= 127 {
+	if fitsInt8(v) {
 		a.AddqConst8Reg(int8(v), reg)
 	} else {
 		a.AddqConst32Reg(int32(v), reg)
@@ -550,109 +778,888 @@ func (a *Assembler) MovlqsxMemReg(srcreg, dstreg uint8, disp int32) {
 	})
 }
 
-func (a *Assembler) link() {
-	// TODO: don't use a map here.
-	id2index := make(map[int]int, len(a.labels))
-	for _, labelIndex := range a.labels {
-		id := a.pending[labelIndex].imm
-		id2index[int(id)] = labelIndex
-	}
-
-	// Pass 1 (fast, only jumps): find short jumps, assign opcodes.
-	pass2needed := false
-	for _, jumpIndex := range a.jumps {
-		jmp := &a.pending[jumpIndex]
-		labelIndex := id2index[int(jmp.imm)]
-		label := &a.pending[labelIndex]
-		dist := label.offset - jmp.offset
-
-		if dist < -120 || dist > 120 {
-			pass2needed = true
-			jmp.opcode = jumpRel8ToRel32[jmp.opcode]
-			jmp.size = uint8(jmp.disp)
-		}
-	}
-
-	// Pass 2: re-calculate offsets.
-	//
-	// For small functions where all jumps are 8-bit relative,
-	// we don't need a second pass at all.
-	if pass2needed {
-		offset := int32(0)
-		for i, inst := range a.pending {
-			a.pending[i].offset = offset
-			offset += int32(inst.size)
-		}
-		// Update length by using last instruction offset and size.
-		last := a.pending[len(a.pending)-1]
-		a.length = int(last.offset + int32(last.size))
-	}
-
-	// Pass 3 (fast, only jumps): assemble jumps.
-	for _, jumpIndex := range a.jumps {
-		jmp := &a.pending[jumpIndex]
-		labelIndex := id2index[int(jmp.imm)]
-		label := &a.pending[labelIndex]
-		target := (label.offset - jmp.offset) - int32(jmp.size)
+func (a *Assembler) MovlqsxRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x63,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagRexW,
+	})
+}
 
-		// We're using a fact that all jumps have very similar encoding.
-		// It's either 2, 5 or 6 bytes.
-		// 2 bytes are used for all rel8 forms.
-		// 5 bytes are unconditional jump (JMP) rel32 form.
-		// 6 bytes is a conditional jump (Jcc) rel32 that requires 0x0F prefix.
-		buf := jmp.buf[:0]
-		if jmp.size == 6 {
-			buf = append(buf, 0x0F)
-		}
-		buf = append(buf, jmp.opcode)
-		if jmp.size == 2 {
-			buf = append(buf, byte(target))
-		} else {
-			buf = appendInt32(buf, target)
-		}
-		if len(buf) != int(jmp.size) {
-			panic("len(buf) != jmp.size")
-		}
-	}
+func (a *Assembler) MovblsxRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0xBE,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flag0F | flagModRM | flagByteReg2,
+	})
 }
 
-func (a *Assembler) pushJcc(op uint8, labelID int64) {
-	inst := instruction{
-		opcode: op,
-		imm:    labelID,
-		size:   2, // rel8 form size
-		disp:   6, // rel32 form size
-		flags:  flagPseudo,
-	}
-	a.jumps = append(a.jumps, len(a.pending))
-	a.push(inst)
+func (a *Assembler) AndlRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x21,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flagModRM,
+	})
 }
 
-func (a *Assembler) pushJmp(op uint8, labelID int64) {
-	inst := instruction{
-		opcode: op,
-		imm:    labelID,
-		size:   2, // rel8 form size
-		disp:   5, // rel32 form size
-		flags:  flagPseudo,
-	}
-	a.jumps = append(a.jumps, len(a.pending))
-	a.push(inst)
+func (a *Assembler) AndlMemReg(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0x23,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagMemory,
+		disp:   disp,
+	})
 }
 
-func (a *Assembler) push(inst instruction) {
-	if inst.flags&flagPseudo == 0 {
-		a.encode(&inst)
+func (a *Assembler) AndlConstReg(v int64, reg uint8) {
+	if fitsInt8(v) {
+		a.AndlConst8Reg(int8(v), reg)
+	} else {
+		a.AndlConst32Reg(int32(v), reg)
 	}
-	inst.offset = int32(a.length)
-	a.length += int(inst.size)
-	a.pending = append(a.pending, inst)
 }
 
-func (a *Assembler) encode(inst *instruction) {
+func (a *Assembler) AndlConst8Reg(v int8, reg uint8) {
+	a.push(instruction{
+		opcode: 0x83,
+		reg1:   op4,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) AndlConst32Reg(v int32, reg uint8) {
+	a.push(instruction{
+		opcode: 0x81,
+		reg1:   op4,
+		reg2:   reg,
+		flags:  flagModRM | flagImm32,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) AndqRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x21,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flagModRM | flagRexW,
+	})
+}
+
+func (a *Assembler) AndqMemReg(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0x23,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagMemory | flagRexW,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) AndqConstReg(v int64, reg uint8) {
+	if fitsInt8(v) {
+		a.AndqConst8Reg(int8(v), reg)
+	} else {
+		a.AndqConst32Reg(int32(v), reg)
+	}
+}
+
+func (a *Assembler) AndqConst8Reg(v int8, reg uint8) {
+	a.push(instruction{
+		opcode: 0x83,
+		reg1:   op4,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) AndqConst32Reg(v int32, reg uint8) {
+	a.push(instruction{
+		opcode: 0x81,
+		reg1:   op4,
+		reg2:   reg,
+		flags:  flagModRM | flagImm32 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) OrlRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x09,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flagModRM,
+	})
+}
+
+func (a *Assembler) OrlMemReg(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0x0b,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagMemory,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) OrlConstReg(v int64, reg uint8) {
+	if fitsInt8(v) {
+		a.OrlConst8Reg(int8(v), reg)
+	} else {
+		a.OrlConst32Reg(int32(v), reg)
+	}
+}
+
+func (a *Assembler) OrlConst8Reg(v int8, reg uint8) {
+	a.push(instruction{
+		opcode: 0x83,
+		reg1:   op1,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) OrlConst32Reg(v int32, reg uint8) {
+	a.push(instruction{
+		opcode: 0x81,
+		reg1:   op1,
+		reg2:   reg,
+		flags:  flagModRM | flagImm32,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) OrqRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x09,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flagModRM | flagRexW,
+	})
+}
+
+func (a *Assembler) OrqMemReg(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0x0b,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagMemory | flagRexW,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) OrqConstReg(v int64, reg uint8) {
+	if fitsInt8(v) {
+		a.OrqConst8Reg(int8(v), reg)
+	} else {
+		a.OrqConst32Reg(int32(v), reg)
+	}
+}
+
+func (a *Assembler) OrqConst8Reg(v int8, reg uint8) {
+	a.push(instruction{
+		opcode: 0x83,
+		reg1:   op1,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) OrqConst32Reg(v int32, reg uint8) {
+	a.push(instruction{
+		opcode: 0x81,
+		reg1:   op1,
+		reg2:   reg,
+		flags:  flagModRM | flagImm32 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) XorlRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x31,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flagModRM,
+	})
+}
+
+func (a *Assembler) XorlMemReg(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0x33,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagMemory,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) XorlConstReg(v int64, reg uint8) {
+	if fitsInt8(v) {
+		a.XorlConst8Reg(int8(v), reg)
+	} else {
+		a.XorlConst32Reg(int32(v), reg)
+	}
+}
+
+func (a *Assembler) XorlConst8Reg(v int8, reg uint8) {
+	a.push(instruction{
+		opcode: 0x83,
+		reg1:   op6,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) XorlConst32Reg(v int32, reg uint8) {
+	a.push(instruction{
+		opcode: 0x81,
+		reg1:   op6,
+		reg2:   reg,
+		flags:  flagModRM | flagImm32,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) XorqRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x31,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flagModRM | flagRexW,
+	})
+}
+
+func (a *Assembler) XorqMemReg(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0x33,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagMemory | flagRexW,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) XorqConstReg(v int64, reg uint8) {
+	if fitsInt8(v) {
+		a.XorqConst8Reg(int8(v), reg)
+	} else {
+		a.XorqConst32Reg(int32(v), reg)
+	}
+}
+
+func (a *Assembler) XorqConst8Reg(v int8, reg uint8) {
+	a.push(instruction{
+		opcode: 0x83,
+		reg1:   op6,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) XorqConst32Reg(v int32, reg uint8) {
+	a.push(instruction{
+		opcode: 0x81,
+		reg1:   op6,
+		reg2:   reg,
+		flags:  flagModRM | flagImm32 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+// ShllConstReg shifts reg by v bits.
+// Shift by 1 uses a shorter encoding without immediate.
+func (a *Assembler) ShllConstReg(v uint8, reg uint8) {
+	if v == 1 {
+		a.push(instruction{
+			opcode: 0xD1,
+			reg1:   op4,
+			reg2:   reg,
+			flags:  flagModRM,
+		})
+		return
+	}
+	a.push(instruction{
+		opcode: 0xC1,
+		reg1:   op4,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8,
+		imm:    int64(v),
+	})
+}
+
+// ShllCLReg shifts reg by the CL register value.
+func (a *Assembler) ShllCLReg(reg uint8) {
+	a.push(instruction{
+		opcode: 0xD3,
+		reg1:   op4,
+		reg2:   reg,
+		flags:  flagModRM,
+	})
+}
+
+// ShlqConstReg shifts reg by v bits.
+// Shift by 1 uses a shorter encoding without immediate.
+func (a *Assembler) ShlqConstReg(v uint8, reg uint8) {
+	if v == 1 {
+		a.push(instruction{
+			opcode: 0xD1,
+			reg1:   op4,
+			reg2:   reg,
+			flags:  flagModRM | flagRexW,
+		})
+		return
+	}
+	a.push(instruction{
+		opcode: 0xC1,
+		reg1:   op4,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+// ShlqCLReg shifts reg by the CL register value.
+func (a *Assembler) ShlqCLReg(reg uint8) {
+	a.push(instruction{
+		opcode: 0xD3,
+		reg1:   op4,
+		reg2:   reg,
+		flags:  flagModRM | flagRexW,
+	})
+}
+
+// ShrlConstReg shifts reg by v bits.
+// Shift by 1 uses a shorter encoding without immediate.
+func (a *Assembler) ShrlConstReg(v uint8, reg uint8) {
+	if v == 1 {
+		a.push(instruction{
+			opcode: 0xD1,
+			reg1:   op5,
+			reg2:   reg,
+			flags:  flagModRM,
+		})
+		return
+	}
+	a.push(instruction{
+		opcode: 0xC1,
+		reg1:   op5,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8,
+		imm:    int64(v),
+	})
+}
+
+// ShrlCLReg shifts reg by the CL register value.
+func (a *Assembler) ShrlCLReg(reg uint8) {
+	a.push(instruction{
+		opcode: 0xD3,
+		reg1:   op5,
+		reg2:   reg,
+		flags:  flagModRM,
+	})
+}
+
+// ShrqConstReg shifts reg by v bits.
+// Shift by 1 uses a shorter encoding without immediate.
+func (a *Assembler) ShrqConstReg(v uint8, reg uint8) {
+	if v == 1 {
+		a.push(instruction{
+			opcode: 0xD1,
+			reg1:   op5,
+			reg2:   reg,
+			flags:  flagModRM | flagRexW,
+		})
+		return
+	}
+	a.push(instruction{
+		opcode: 0xC1,
+		reg1:   op5,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+// ShrqCLReg shifts reg by the CL register value.
+func (a *Assembler) ShrqCLReg(reg uint8) {
+	a.push(instruction{
+		opcode: 0xD3,
+		reg1:   op5,
+		reg2:   reg,
+		flags:  flagModRM | flagRexW,
+	})
+}
+
+// SarlConstReg shifts reg by v bits.
+// Shift by 1 uses a shorter encoding without immediate.
+func (a *Assembler) SarlConstReg(v uint8, reg uint8) {
+	if v == 1 {
+		a.push(instruction{
+			opcode: 0xD1,
+			reg1:   op7,
+			reg2:   reg,
+			flags:  flagModRM,
+		})
+		return
+	}
+	a.push(instruction{
+		opcode: 0xC1,
+		reg1:   op7,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8,
+		imm:    int64(v),
+	})
+}
+
+// SarlCLReg shifts reg by the CL register value.
+func (a *Assembler) SarlCLReg(reg uint8) {
+	a.push(instruction{
+		opcode: 0xD3,
+		reg1:   op7,
+		reg2:   reg,
+		flags:  flagModRM,
+	})
+}
+
+// SarqConstReg shifts reg by v bits.
+// Shift by 1 uses a shorter encoding without immediate.
+func (a *Assembler) SarqConstReg(v uint8, reg uint8) {
+	if v == 1 {
+		a.push(instruction{
+			opcode: 0xD1,
+			reg1:   op7,
+			reg2:   reg,
+			flags:  flagModRM | flagRexW,
+		})
+		return
+	}
+	a.push(instruction{
+		opcode: 0xC1,
+		reg1:   op7,
+		reg2:   reg,
+		flags:  flagModRM | flagImm8 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+// SarqCLReg shifts reg by the CL register value.
+func (a *Assembler) SarqCLReg(reg uint8) {
+	a.push(instruction{
+		opcode: 0xD3,
+		reg1:   op7,
+		reg2:   reg,
+		flags:  flagModRM | flagRexW,
+	})
+}
+
+func (a *Assembler) TestlRegReg(xreg, yreg uint8) {
+	a.push(instruction{
+		opcode: 0x85,
+		reg1:   yreg,
+		reg2:   xreg,
+		flags:  flagModRM,
+	})
+}
+
+func (a *Assembler) TestlConstReg(v int32, reg uint8) {
+	a.push(instruction{
+		opcode: 0xF7,
+		reg1:   op0,
+		reg2:   reg,
+		flags:  flagModRM | flagImm32,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) TestqRegReg(xreg, yreg uint8) {
+	a.push(instruction{
+		opcode: 0x85,
+		reg1:   yreg,
+		reg2:   xreg,
+		flags:  flagModRM | flagRexW,
+	})
+}
+
+func (a *Assembler) TestqConstReg(v int32, reg uint8) {
+	a.push(instruction{
+		opcode: 0xF7,
+		reg1:   op0,
+		reg2:   reg,
+		flags:  flagModRM | flagImm32 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+// SetccReg sets the reg low byte to 1 if cc condition is true, 0 otherwise.
+// The upper reg bits are not changed.
+func (a *Assembler) SetccReg(cc Cond, reg uint8) {
+	a.push(instruction{
+		opcode: 0x90 | uint8(cc),
+		reg1:   op0,
+		reg2:   reg,
+		flags:  flag0F | flagModRM | flagByteReg2,
+	})
+}
+
+// CmovlRegReg moves srcreg to dstreg if cc condition is true.
+func (a *Assembler) CmovlRegReg(cc Cond, srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x40 | uint8(cc),
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flag0F | flagModRM,
+	})
+}
+
+// CmovqRegReg moves srcreg to dstreg if cc condition is true.
+func (a *Assembler) CmovqRegReg(cc Cond, srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x40 | uint8(cc),
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flag0F | flagModRM | flagRexW,
+	})
+}
+
+// ImullConstRegReg computes dstreg = srcreg * v.
+func (a *Assembler) ImullConstRegReg(v int64, srcreg, dstreg uint8) {
+	if fitsInt8(v) {
+		a.ImullConst8RegReg(int8(v), srcreg, dstreg)
+	} else {
+		a.ImullConst32RegReg(int32(v), srcreg, dstreg)
+	}
+}
+
+func (a *Assembler) ImullConst8RegReg(v int8, srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x6B,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagImm8,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) ImullConst32RegReg(v int32, srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x69,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagImm32,
+		imm:    int64(v),
+	})
+}
+
+// ImulqConstRegReg computes dstreg = srcreg * v.
+func (a *Assembler) ImulqConstRegReg(v int64, srcreg, dstreg uint8) {
+	if fitsInt8(v) {
+		a.ImulqConst8RegReg(int8(v), srcreg, dstreg)
+	} else {
+		a.ImulqConst32RegReg(int32(v), srcreg, dstreg)
+	}
+}
+
+func (a *Assembler) ImulqConst8RegReg(v int8, srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x6B,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagImm8 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) ImulqConst32RegReg(v int32, srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0x69,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagImm32 | flagRexW,
+		imm:    int64(v),
+	})
+}
+
+func (a *Assembler) LeaqMemReg(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0x8D,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flagModRM | flagMemory | flagRexW,
+		disp:   disp,
+	})
+}
+
+// LeaqMemindexReg computes dstreg = srcreg + index*scale + disp.
+// scale can be 1, 2, 4 or 8.
+func (a *Assembler) LeaqMemindexReg(srcreg, dstreg, index, scale uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0x8D,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		index:  index,
+		flags:  flagModSIB | flagMemory | flagRexW | scaleFlag(scale),
+		disp:   disp,
+	})
+}
+
+func scaleFlag(scale uint8) uint32 {
+	switch scale {
+	case 1:
+		return 0
+	case 2:
+		return flagScale2
+	case 4:
+		return flagScale4
+	case 8:
+		return flagScale8
+	default:
+		panic("invalid scale")
+	}
+}
+
+func (a *Assembler) MovblzxRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0xB6,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flag0F | flagModRM | flagByteReg2,
+	})
+}
+
+func (a *Assembler) MovwlzxRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0xB7,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flag0F | flagModRM,
+	})
+}
+
+func (a *Assembler) MovwlsxRegReg(srcreg, dstreg uint8) {
+	a.push(instruction{
+		opcode: 0xBF,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flag0F | flagModRM,
+	})
+}
+
+func (a *Assembler) MovblsxMemReg(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0xBE,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flag0F | flagModRM | flagMemory,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) MovblzxMemReg(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0xB6,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flag0F | flagModRM | flagMemory,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) MovwlsxMemReg(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0xBF,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flag0F | flagModRM | flagMemory,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) MovwlzxMemReg(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0xB7,
+		reg1:   dstreg,
+		reg2:   srcreg,
+		flags:  flag0F | flagModRM | flagMemory,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) MovwRegMem(srcreg, dstreg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0x89,
+		reg1:   srcreg,
+		reg2:   dstreg,
+		flags:  flag66 | flagModRM | flagMemory,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) Cqo() {
+	a.push(instruction{opcode: 0x99, flags: flagRexW})
+}
+
+func (a *Assembler) IdivqReg(reg uint8) {
+	a.push(instruction{
+		opcode: 0xF7,
+		reg1:   op7,
+		reg2:   reg,
+		flags:  flagModRM | flagRexW,
+	})
+}
+
+func (a *Assembler) IdivqMem(reg uint8, disp int32) {
+	a.push(instruction{
+		opcode: 0xF7,
+		reg1:   op7,
+		reg2:   reg,
+		flags:  flagModRM | flagMemory | flagRexW,
+		disp:   disp,
+	})
+}
+
+func (a *Assembler) link() {
+	// TODO: don't use a map here.
+	id2index := make(map[int]int, len(a.labels))
+	for _, labelIndex := range a.labels {
+		id := a.pending[labelIndex].imm
+		id2index[int(id)] = labelIndex
+	}
+
+	// Pass 1 (fast, only jumps): find short jumps, assign opcodes.
+	pass2needed := false
+	for _, jumpIndex := range a.jumps {
+		jmp := &a.pending[jumpIndex]
+		labelIndex := id2index[int(jmp.imm)]
+		label := &a.pending[labelIndex]
+		dist := label.offset - jmp.offset
+
+		if jmp.size == 2 && (dist < -120 || dist > 120) {
+			pass2needed = true
+			jmp.opcode = jumpRel8ToRel32[jmp.opcode]
+			jmp.size = uint8(jmp.disp)
+		}
+	}
+
+	// Pass 2: re-calculate offsets.
+	//
+	// For small functions where all jumps are 8-bit relative,
+	// we don't need a second pass at all.
+	//
+	// Paddings can only shrink here, so the jump distances
+	// can't grow and rel8 jumps stay valid.
+	if pass2needed || len(a.aligns) != 0 {
+		offset := int32(0)
+		aligns := a.aligns
+		for i := range a.pending {
+			inst := &a.pending[i]
+			inst.offset = offset
+			if len(aligns) != 0 && aligns[0] == i {
+				aligns = aligns[1:]
+				n := int32(inst.imm)
+				inst.size = uint8((n - (offset+inst.disp)%n) % n)
+			}
+			offset += int32(inst.size)
+		}
+		// Update length by using last instruction offset and size.
+		last := a.pending[len(a.pending)-1]
+		a.length = int(last.offset + int32(last.size))
+	}
+
+	// Pass 3 (fast, only jumps): assemble jumps.
+	for _, jumpIndex := range a.jumps {
+		jmp := &a.pending[jumpIndex]
+		labelIndex := id2index[int(jmp.imm)]
+		label := &a.pending[labelIndex]
+		target := (label.offset - jmp.offset) - int32(jmp.size)
+
+		if jmp.flags&flagRIP != 0 {
+			// Label address loads are not jumps, but they're
+			// resolved in the same way, relative to the next instruction.
+			rexPrefix := uint8(rexW)
+			if jmp.reg1 >= R8 {
+				rexPrefix |= rexR
+			}
+			buf := append(jmp.buf[:0], rexPrefix, jmp.opcode, modrm(disp0, jmp.reg1&regBitMask, 0b101))
+			buf = appendInt32(buf, target)
+			if len(buf) != int(jmp.size) {
+				panic("len(buf) != jmp.size")
+			}
+			continue
+		}
+
+		// We're using a fact that all jumps have very similar encoding.
+		// It's either 2, 5 or 6 bytes.
+		// 2 bytes are used for all rel8 forms.
+		// 5 bytes are unconditional jump (JMP) rel32 form.
+		// 6 bytes is a conditional jump (Jcc) rel32 that requires 0x0F prefix.
+		buf := jmp.buf[:0]
+		if jmp.size == 6 {
+			buf = append(buf, 0x0F)
+		}
+		buf = append(buf, jmp.opcode)
+		if jmp.size == 2 {
+			buf = append(buf, byte(target))
+		} else {
+			buf = appendInt32(buf, target)
+		}
+		if len(buf) != int(jmp.size) {
+			panic("len(buf) != jmp.size")
+		}
+	}
+}
+
+func (a *Assembler) pushJcc(op uint8, labelID int64) {
+	inst := instruction{
+		opcode: op,
+		imm:    labelID,
+		size:   2, // rel8 form size
+		disp:   6, // rel32 form size
+		flags:  flagPseudo,
+	}
+	a.jumps = append(a.jumps, len(a.pending))
+	a.push(inst)
+}
+
+func (a *Assembler) pushJmp(op uint8, labelID int64) {
+	inst := instruction{
+		opcode: op,
+		imm:    labelID,
+		size:   2, // rel8 form size
+		disp:   5, // rel32 form size
+		flags:  flagPseudo,
+	}
+	a.jumps = append(a.jumps, len(a.pending))
+	a.push(inst)
+}
+
+func (a *Assembler) push(inst instruction) {
+	if inst.flags&flagPseudo == 0 {
+		a.encode(&inst)
+	}
+	inst.offset = int32(a.length)
+	a.length += int(inst.size)
+	a.pending = append(a.pending, inst)
+}
+
+func (a *Assembler) encode(inst *instruction) {
 	buf := inst.buf[:0]
 
-	// Encode prefix.
+	// Encode prefixes.
+	if inst.flags&flag66 != 0 {
+		buf = append(buf, 0x66)
+	}
 	var rexPrefix byte
 	if inst.flags&flagRexW != 0 {
 		rexPrefix |= rexW
@@ -663,6 +1670,17 @@ func (a *Assembler) encode(inst *instruction) {
 	if inst.reg2 >= R8 {
 		rexPrefix |= rexB
 	}
+	if inst.flags&flagModSIB != 0 && inst.index >= R8 {
+		rexPrefix |= rexX
+	}
+	// SPL, BPL, SIL and DIL can only be encoded with REX prefix.
+	// Without it, these register numbers select AH, CH, DH and BH.
+	if inst.flags&flagByteReg1 != 0 && inst.reg1 >= RSP && inst.reg1 <= RDI {
+		rexPrefix |= rex
+	}
+	if inst.flags&flagByteReg2 != 0 && inst.flags&flagMemory == 0 && inst.reg2 >= RSP && inst.reg2 <= RDI {
+		rexPrefix |= rex
+	}
 	if rexPrefix != 0 {
 		buf = append(buf, rexPrefix)
 	}
@@ -680,39 +1698,47 @@ func (a *Assembler) encode(inst *instruction) {
 	}
 	buf = append(buf, opcode)
 
-	// Encode ModRM.
-	// If ModSIB is set, we encode ModRM along with SIB.
-	if inst.flags&flagModRM != 0 {
-		if inst.flags&flagMemory != 0 {
-			var mod byte
+	// Encode ModRM, SIB and displacement.
+	switch {
+	case inst.flags&flagModRM != 0 && inst.flags&flagMemory == 0:
+		buf = append(buf, modrm(regreg, reg1, reg2))
+	case inst.flags&(flagModRM|flagModSIB) != 0:
+		// RBP and R13 base with mod=00 means RIP-relative (or no base
+		// for SIB) addressing, so they need an explicit zero displacement.
+		var mod byte
+		switch {
+		case inst.disp == 0 && reg2 != RBP:
+			mod = disp0
+		case fitsInt8(int64(inst.disp)):
+			mod = disp8
+		default:
+			mod = disp32
+		}
+		// RSP and R12 base can only be encoded with SIB.
+		if inst.flags&flagModSIB != 0 || reg2 == RSP {
+			buf = append(buf, modrm(mod, reg1, 0b100))
+			index := byte(0b100) // No index
+			if inst.flags&flagModSIB != 0 {
+				index = inst.index & regBitMask
+			}
+			scale := byte(scale1)
 			switch {
-			case inst.disp == 0:
-				mod = disp0
-			case fitsInt8(int64(inst.disp)):
-				mod = disp8
-			default:
-				mod = disp32
+			case inst.flags&flagScale2 != 0:
+				scale = scale2
+			case inst.flags&flagScale4 != 0:
+				scale = scale4
+			case inst.flags&flagScale8 != 0:
+				scale = scale8
 			}
-			buf = append(buf, modrm(mod, reg1, reg2))
+			buf = append(buf, sib(scale, index, reg2))
 		} else {
-			buf = append(buf, modrm(regreg, reg1, reg2))
-		}
-	} else if inst.flags&flagModSIB != 0 {
-		buf = append(buf, modrm(0, reg1, 4))
-		switch {
-		case inst.flags&flagScale4 != 0:
-			buf = append(buf, sib(scale4, inst.index, reg2))
-		case inst.flags&flagScale8 != 0:
-			buf = append(buf, sib(scale8, inst.index, reg2))
+			buf = append(buf, modrm(mod, reg1, reg2))
 		}
-	}
-
-	// Encode displacement.
-	if inst.disp != 0 {
-		if fitsInt8(int64(inst.disp)) {
+		switch mod {
+		case disp8:
 			buf = append(buf, byte(inst.disp))
-		} else {
-			buf = appendInt32(buf, int32(inst.disp))
+		case disp32:
+			buf = appendInt32(buf, inst.disp)
 		}
 	}
 
@@ -6,6 +6,7 @@ const (
 	// Rex prefix delivers 4 main bit fields: REX.W, REX.R, REX.X and REX.B.
 	//
 	//       0100 WRXB
+	rex  = 0b0100_0000
 	rexW = 0b0100_1000
 	rexR = 0b0100_0100
 	rexX = 0b0100_0010
@@ -55,8 +56,20 @@ const (
 )
 
 const (
+	call32op = 0xE8
+
 	jmp8op  = 0xEB
 	jmp32op = 0xE9
+	ja8op   = 0x77
+	ja32op  = 0x87
+	jae8op  = 0x73
+	jae32op = 0x83
+	jb8op   = 0x72
+	jb32op  = 0x82
+	jbe8op  = 0x76
+	jbe32op = 0x86
+	je8op   = 0x74
+	je32op  = 0x84
 	jge8op  = 0x7D
 	jge32op = 0x8D
 	jgt8op  = 0x7F
@@ -71,9 +84,31 @@ const (
 
 var jumpRel8ToRel32 = [256]byte{
 	jmp8op: jmp32op,
+	ja8op:  ja32op,
+	jae8op: jae32op,
+	jb8op:  jb32op,
+	jbe8op: jbe32op,
+	je8op:  je32op,
 	jge8op: jge32op,
 	jgt8op: jgt32op,
 	jlt8op: jlt32op,
 	jle8op: jle32op,
 	jne8op: jne32op,
 }
+
+// Cond is a condition code of SETcc and CMOVcc instructions.
+// It's encoded in the opcode low 4 bits.
+type Cond uint8
+
+const (
+	CondB  Cond = 0x2 // Below (unsigned <)
+	CondAE Cond = 0x3 // Above or equal (unsigned >=)
+	CondE  Cond = 0x4 // Equal
+	CondNE Cond = 0x5 // Not equal
+	CondBE Cond = 0x6 // Below or equal (unsigned <=)
+	CondA  Cond = 0x7 // Above (unsigned >)
+	CondL  Cond = 0xC // Less (signed <)
+	CondGE Cond = 0xD // Greater or equal (signed >=)
+	CondLE Cond = 0xE // Less or equal (signed <=)
+	CondG  Cond = 0xF // Greater (signed >)
+)
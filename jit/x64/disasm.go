@@ -0,0 +1,489 @@
+package x64
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Inst is a decoded machine instruction.
+type Inst struct {
+	Offset int // Instruction offset inside the decoded code
+	Len    int // Encoded instruction width
+
+	// Branch is set for the relative jumps.
+	// Target is their destination offset.
+	Branch bool
+	Target int
+
+	// Text is an instruction printed in the Go assembler syntax.
+	Text string
+}
+
+func (inst Inst) String() string { return inst.Text }
+
+// Disasm decodes all code instructions.
+//
+// Bytes that can't be decoded are reported as BYTE pseudo instructions,
+// decoding continues from the next byte.
+func Disasm(code []byte) []Inst {
+	var out []Inst
+	for offset := 0; offset < len(code); {
+		inst, err := Decode(code, offset)
+		if err != nil {
+			inst = Inst{
+				Offset: offset,
+				Len:    1,
+				Text:   fmt.Sprintf("BYTE $%#x", code[offset]),
+			}
+		}
+		out = append(out, inst)
+		offset += inst.Len
+	}
+	return out
+}
+
+var errTruncated = errors.New("truncated instruction")
+
+// Decode decodes a single instruction at code[offset:].
+//
+// The decoder covers every encoding that Assembler can produce,
+// plus a few closely related forms.
+func Decode(code []byte, offset int) (Inst, error) {
+	d := decoder{code: code, pos: offset}
+	text, err := d.decode()
+	if err != nil {
+		return Inst{}, fmt.Errorf("offset %d: %v", offset, err)
+	}
+	return Inst{
+		Offset: offset,
+		Len:    d.pos - offset,
+		Branch: d.branch,
+		Target: d.target,
+		Text:   text,
+	}, nil
+}
+
+type decoder struct {
+	code   []byte
+	pos    int
+	rex    byte
+	opsize bool // 0x66 operand size prefix
+	branch bool
+	target int
+
+	// Decoded ModRM fields.
+	mod byte
+	reg byte
+	rm  byte
+}
+
+var regNames = [...]string{
+	"AX", "CX", "DX", "BX", "SP", "BP", "SI", "DI",
+	"R8", "R9", "R10", "R11", "R12", "R13", "R14", "R15",
+}
+
+// group1 are 0x81 and 0x83 opcode instructions, selected by ModRM.reg.
+var group1 = [...]string{"ADD", "OR", "ADC", "SBB", "AND", "SUB", "XOR", "CMP"}
+
+// group2 are 0xC1, 0xD1 and 0xD3 opcode instructions, selected by ModRM.reg.
+var group2 = [...]string{"ROL", "ROR", "RCL", "RCR", "SHL", "SHR", "", "SAR"}
+
+// group3 are 0xF7 opcode instructions, selected by ModRM.reg.
+var group3 = [...]string{"TEST", "", "NOT", "NEG", "MUL", "IMUL", "DIV", "IDIV"}
+
+// jccNames are condition suffixes of 0x7X and 0x0F 0x8X jumps.
+var jccNames = [...]string{
+	"JOS", "JOC", "JCS", "JCC", "JEQ", "JNE", "JLS", "JHI",
+	"JMI", "JPL", "JPS", "JPC", "JLT", "JGE", "JLE", "JGT",
+}
+
+// byteRegNames are 8-bit registers 4-7 that are encoded without a REX prefix.
+var byteRegNames = [...]string{"AH", "CH", "DH", "BH"}
+
+func (d *decoder) decode() (string, error) {
+	op, err := d.byte()
+	if err != nil {
+		return "", err
+	}
+	if op == 0x66 {
+		d.opsize = true
+		if op, err = d.byte(); err != nil {
+			return "", err
+		}
+	}
+	if op&0xF0 == 0x40 {
+		d.rex = op
+		if op, err = d.byte(); err != nil {
+			return "", err
+		}
+	}
+
+	switch {
+	case op == 0x0F:
+		return d.decode0F()
+	case op == 0x90:
+		return "NOP", nil
+	case op == 0x99:
+		if d.rexW() {
+			return "CQO", nil
+		}
+		return "CDQ", nil
+	case op >= 0xB8 && op <= 0xBF:
+		reg := regNames[op-0xB8+d.rexB()]
+		if d.rexW() {
+			v, err := d.imm64()
+			return fmt.Sprintf("MOVQ $%d, %s", v, reg), err
+		}
+		v, err := d.imm32()
+		return fmt.Sprintf("MOVL $%d, %s", v, reg), err
+	case op >= 0x70 && op <= 0x7F:
+		return d.jump(jccNames[op-0x70], 1)
+	case op == 0xEB:
+		return d.jump("JMP", 1)
+	case op == 0xE9:
+		return d.jump("JMP", 4)
+	case op == 0xE8:
+		return d.jump("CALL", 4)
+	}
+
+	if err := d.modrm(); err != nil {
+		return "", err
+	}
+	sfx := d.suffix()
+	switch op {
+	case 0x01:
+		return d.regRM("ADD"+sfx, false)
+	case 0x03:
+		return d.regRM("ADD"+sfx, true)
+	case 0x09:
+		return d.regRM("OR"+sfx, false)
+	case 0x0B:
+		return d.regRM("OR"+sfx, true)
+	case 0x21:
+		return d.regRM("AND"+sfx, false)
+	case 0x23:
+		return d.regRM("AND"+sfx, true)
+	case 0x29:
+		return d.regRM("SUB"+sfx, false)
+	case 0x2B:
+		return d.regRM("SUB"+sfx, true)
+	case 0x31:
+		return d.regRM("XOR"+sfx, false)
+	case 0x33:
+		return d.regRM("XOR"+sfx, true)
+	case 0x39:
+		// CMP operands are printed in the Intel order.
+		return d.regRM("CMP"+sfx, true)
+	case 0x3B:
+		return d.regRM("CMP"+sfx, false)
+	case 0x63:
+		return d.regRM("MOVLQSX", true)
+	case 0x69, 0x6B:
+		rm, err := d.operand()
+		if err != nil {
+			return "", err
+		}
+		var v int64
+		if op == 0x6B {
+			v, err = d.imm8()
+		} else {
+			v, err = d.imm32()
+		}
+		reg := regNames[d.reg+d.rexR()]
+		return fmt.Sprintf("IMUL3%s $%d, %s, %s", sfx, v, rm, reg), err
+	case 0x85:
+		return d.regRM("TEST"+sfx, false)
+	case 0x88:
+		rm, err := d.byteOperand()
+		if err != nil {
+			return "", err
+		}
+		return "MOVB " + d.byteReg(d.reg+d.rexR()) + ", " + rm, nil
+	case 0x89:
+		return d.regRM("MOV"+sfx, false)
+	case 0x8B:
+		return d.regRM("MOV"+sfx, true)
+	case 0x8D:
+		if d.mod == 0b11 {
+			return "", errors.New("LEA with a register operand")
+		}
+		return d.regRM("LEA"+sfx, true)
+	case 0x81, 0x83:
+		rm, err := d.operand()
+		if err != nil {
+			return "", err
+		}
+		var v int64
+		if op == 0x83 {
+			v, err = d.imm8()
+		} else {
+			v, err = d.imm32()
+		}
+		name := group1[d.reg] + sfx
+		if d.reg == 7 {
+			return fmt.Sprintf("%s %s, $%d", name, rm, v), err
+		}
+		return fmt.Sprintf("%s $%d, %s", name, v, rm), err
+	case 0xC1, 0xD1, 0xD3:
+		name := group2[d.reg]
+		if name == "" {
+			break
+		}
+		rm, err := d.operand()
+		if err != nil {
+			return "", err
+		}
+		switch op {
+		case 0xD1:
+			return fmt.Sprintf("%s%s $1, %s", name, sfx, rm), nil
+		case 0xD3:
+			return fmt.Sprintf("%s%s CX, %s", name, sfx, rm), nil
+		}
+		v, err := d.byte()
+		return fmt.Sprintf("%s%s $%d, %s", name, sfx, v, rm), err
+	case 0xC7:
+		if d.reg != 0 {
+			break
+		}
+		rm, err := d.operand()
+		if err != nil {
+			return "", err
+		}
+		v, err := d.imm32()
+		return fmt.Sprintf("MOV%s $%d, %s", sfx, v, rm), err
+	case 0xF7:
+		rm, err := d.operand()
+		if err != nil {
+			return "", err
+		}
+		switch d.reg {
+		case 0:
+			v, err := d.imm32()
+			return fmt.Sprintf("TEST%s $%d, %s", sfx, v, rm), err
+		case 1:
+			return "", fmt.Errorf("unknown opcode %#02x /%d", op, d.reg)
+		}
+		return group3[d.reg] + sfx + " " + rm, nil
+	case 0xFF:
+		rm, err := d.operand()
+		if err != nil {
+			return "", err
+		}
+		switch d.reg {
+		case 0:
+			return "INC" + sfx + " " + rm, nil
+		case 1:
+			return "DEC" + sfx + " " + rm, nil
+		case 2:
+			return "CALL " + rm, nil
+		case 4:
+			return "JMP " + rm, nil
+		}
+	}
+	return "", fmt.Errorf("unknown opcode %#02x", op)
+}
+
+func (d *decoder) decode0F() (string, error) {
+	op, err := d.byte()
+	if err != nil {
+		return "", err
+	}
+	if op >= 0x80 && op <= 0x8F {
+		return d.jump(jccNames[op-0x80], 4)
+	}
+	if err := d.modrm(); err != nil {
+		return "", err
+	}
+	switch {
+	case op >= 0x40 && op <= 0x4F:
+		return d.regRM("CMOV"+d.suffix()+jccNames[op-0x40][1:], true)
+	case op >= 0x90 && op <= 0x9F:
+		rm, err := d.byteOperand()
+		return "SET" + jccNames[op-0x90][1:] + " " + rm, err
+	case op == 0xAF:
+		return d.regRM("IMUL"+d.suffix(), true)
+	case op == 0xB6, op == 0xBE:
+		name := "MOVBLZX"
+		if op == 0xBE {
+			name = "MOVBLSX"
+		}
+		if d.rexW() {
+			name = strings.Replace(name, "L", "Q", 1)
+		}
+		rm, err := d.byteOperand()
+		return name + " " + rm + ", " + regNames[d.reg+d.rexR()], err
+	case op == 0xB7, op == 0xBF:
+		name := "MOVWLZX"
+		if op == 0xBF {
+			name = "MOVWLSX"
+		}
+		if d.rexW() {
+			name = strings.Replace(name, "L", "Q", 1)
+		}
+		return d.regRM(name, true)
+	}
+	return "", fmt.Errorf("unknown opcode 0x0f%02x", op)
+}
+
+// regRM prints a ModRM.reg and ModRM.rm operands instruction.
+// If toReg is true, rm is a source operand.
+func (d *decoder) regRM(name string, toReg bool) (string, error) {
+	rm, err := d.operand()
+	if err != nil {
+		return "", err
+	}
+	reg := regNames[d.reg+d.rexR()]
+	if toReg {
+		return name + " " + rm + ", " + reg, nil
+	}
+	return name + " " + reg + ", " + rm, nil
+}
+
+// byteOperand is like operand, but ModRM.rm register is an 8-bit register.
+func (d *decoder) byteOperand() (string, error) {
+	if d.mod == 0b11 {
+		return d.byteReg(d.rm + d.rexB()), nil
+	}
+	return d.operand()
+}
+
+// byteReg returns an 8-bit register name.
+// Without a REX prefix, registers 4-7 are the high byte registers.
+func (d *decoder) byteReg(r byte) string {
+	if d.rex == 0 && r >= 4 && r <= 7 {
+		return byteRegNames[r-4]
+	}
+	return regNames[r]
+}
+
+func (d *decoder) jump(name string, width int) (string, error) {
+	var rel int64
+	var err error
+	if width == 1 {
+		rel, err = d.imm8()
+	} else {
+		rel, err = d.imm32()
+	}
+	d.branch = true
+	d.target = d.pos + int(rel)
+	return fmt.Sprintf("%s %d", name, d.target), err
+}
+
+func (d *decoder) modrm() error {
+	b, err := d.byte()
+	if err != nil {
+		return err
+	}
+	d.mod = b >> 6
+	d.reg = (b >> 3) & 0b111
+	d.rm = b & 0b111
+	return nil
+}
+
+// operand returns a ModRM.rm operand text.
+// It decodes the SIB and displacement bytes if they're present.
+func (d *decoder) operand() (string, error) {
+	if d.mod == 0b11 {
+		return regNames[d.rm+d.rexB()], nil
+	}
+
+	var base, index string
+	scale := 0
+	if d.rm == 0b100 {
+		sib, err := d.byte()
+		if err != nil {
+			return "", err
+		}
+		scale = 1 << (sib >> 6)
+		if i := (sib>>3)&0b111 + d.rexX(); i != 0b100 {
+			index = regNames[i]
+		}
+		if b := sib & 0b111; b == 0b101 && d.mod == 0b00 {
+			// No base, disp32 follows.
+			d.mod = 0b10
+		} else {
+			base = regNames[b+d.rexB()]
+		}
+	} else if d.rm == 0b101 && d.mod == 0b00 {
+		disp, err := d.imm32()
+		return fmt.Sprintf("%d(IP)", disp), err
+	} else {
+		base = regNames[d.rm+d.rexB()]
+	}
+
+	var disp int64
+	var err error
+	switch d.mod {
+	case 0b01:
+		disp, err = d.imm8()
+	case 0b10:
+		disp, err = d.imm32()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	if disp != 0 {
+		fmt.Fprintf(&buf, "%d", disp)
+	}
+	if base != "" {
+		buf.WriteString("(" + base + ")")
+	}
+	if index != "" {
+		fmt.Fprintf(&buf, "(%s*%d)", index, scale)
+	}
+	if buf.Len() == 0 {
+		return "0", nil
+	}
+	return buf.String(), nil
+}
+
+func (d *decoder) suffix() string {
+	switch {
+	case d.rexW():
+		return "Q"
+	case d.opsize:
+		return "W"
+	}
+	return "L"
+}
+
+func (d *decoder) rexW() bool { return d.rex&0b1000 != 0 }
+func (d *decoder) rexR() byte { return (d.rex & 0b0100) << 1 }
+func (d *decoder) rexX() byte { return (d.rex & 0b0010) << 2 }
+func (d *decoder) rexB() byte { return (d.rex & 0b0001) << 3 }
+
+func (d *decoder) byte() (byte, error) {
+	if d.pos >= len(d.code) {
+		return 0, errTruncated
+	}
+	b := d.code[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *decoder) imm8() (int64, error) {
+	b, err := d.byte()
+	return int64(int8(b)), err
+}
+
+func (d *decoder) imm32() (int64, error) {
+	if d.pos+4 > len(d.code) {
+		return 0, errTruncated
+	}
+	v := int32(binary.LittleEndian.Uint32(d.code[d.pos:]))
+	d.pos += 4
+	return int64(v), nil
+}
+
+func (d *decoder) imm64() (int64, error) {
+	if d.pos+8 > len(d.code) {
+		return 0, errTruncated
+	}
+	v := int64(binary.LittleEndian.Uint64(d.code[d.pos:]))
+	d.pos += 8
+	return v, nil
+}
@@ -0,0 +1,95 @@
+package x64
+
+import (
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDisasm(t *testing.T) {
+	// Go assembler sources use a few notations that
+	// the disassembler doesn't reproduce.
+	exprRE := regexp.MustCompile(`\$?-?\b(\d+\*8|0x[0-9a-f]+)\b`)
+	zeroDispRE := regexp.MustCompile(`(^|[ ,])0\(`)
+	normalize := func(s string) string {
+		s = exprRE.ReplaceAllStringFunc(s, func(x string) string {
+			prefix := ""
+			if strings.HasPrefix(x, "$") {
+				prefix, x = "$", x[1:]
+			}
+			if strings.HasPrefix(x, "0x") {
+				v, _ := strconv.ParseInt(x[2:], 16, 64)
+				return prefix + strconv.FormatInt(v, 10)
+			}
+			v, _ := strconv.Atoi(strings.TrimSuffix(x, "*8"))
+			return prefix + strconv.Itoa(v*8)
+		})
+		s = zeroDispRE.ReplaceAllString(s, "$1(")
+		if s == "NOP1" {
+			return "NOP"
+		}
+		return s
+	}
+
+	for _, test := range asmTests {
+		for _, v := range test.want {
+			code, err := hex.DecodeString(v.enc)
+			if err != nil {
+				t.Fatalf("asmtest.s:%d: bad encoding: %v", v.line, err)
+			}
+			inst, err := Decode(code, 0)
+			if err != nil {
+				t.Errorf("asmtest.s:%d: %s: decode %s: %v", v.line, v.asm, v.enc, err)
+				continue
+			}
+			if inst.Len != len(code) {
+				t.Errorf("asmtest.s:%d: %s: decoded %d bytes out of %d", v.line, v.asm, inst.Len, len(code))
+			}
+			if inst.Branch {
+				// Branch targets are labels in the asm sources.
+				continue
+			}
+			if want := normalize(v.asm); inst.Text != want {
+				t.Errorf("asmtest.s:%d: %s:\nhave: %s\nwant: %s", v.line, v.enc, inst.Text, want)
+			}
+		}
+	}
+}
+
+func TestDisasmRaw(t *testing.T) {
+	// Instructions that the compiler emits via Assembler.Raw,
+	// branches and the invalid encodings.
+	tests := []struct {
+		enc  string
+		want []string
+	}{
+		{"488d0510000000", []string{"LEAQ 16(IP), AX"}},
+		{"488d0c80", []string{"LEAQ (AX)(AX*4), CX"}},
+		{"4801c8", []string{"ADDQ CX, AX"}},
+		{"ff66f0", []string{"JMP -16(SI)"}},
+		{"eb00" + "7cfc", []string{"JMP 2", "JLT 0"}},
+		{"e900000000" + "0f8df5ffffff", []string{"JMP 5", "JGE 0"}},
+		{"4899", []string{"CQO"}},
+		{"e800000000" + "e8fbffffff", []string{"CALL 5", "CALL 5"}},
+		{"0f94c4" + "88e3", []string{"SETEQ AH", "MOVB AH, BX"}},
+		{"400f94c4", []string{"SETEQ SP"}},
+		{"0fff" + "90", []string{"BYTE $0xf", "BYTE $0xff", "NOP"}},
+		{"48b8010000", []string{"BYTE $0x48", "BYTE $0xb8", "ADDL AX, (AX)", "BYTE $0x0"}},
+	}
+
+	for _, test := range tests {
+		code, err := hex.DecodeString(test.enc)
+		if err != nil {
+			t.Fatalf("%s: bad encoding: %v", test.enc, err)
+		}
+		var have []string
+		for _, inst := range Disasm(code) {
+			have = append(have, inst.Text)
+		}
+		if strings.Join(have, "; ") != strings.Join(test.want, "; ") {
+			t.Errorf("%s:\nhave: %q\nwant: %q", test.enc, have, test.want)
+		}
+	}
+}
@@ -15,7 +15,7 @@ type instruction struct {
 	reg1   uint8  // 3 bits for ModRM.reg
 	reg2   uint8  // 3 bits for ModRM.rm
 	index  uint8  // 3 bits for SIB.index
-	flags  uint16 // Hints on how to encode this instruction
+	flags  uint32 // Hints on how to encode this instruction
 }
 
 func (i instruction) Bytes() []byte {
@@ -23,7 +23,7 @@ func (i instruction) Bytes() []byte {
 }
 
 const (
-	flagMemory uint16 = 1 << iota
+	flagMemory uint32 = 1 << iota
 	flagReg2Op
 	flagModRM
 	flagModSIB
@@ -35,4 +35,9 @@ const (
 	flagPseudo
 	flagRexW
 	flag0F
+	flagScale2
+	flag66       // Operand-size override prefix (16-bit operands)
+	flagByteReg1 // reg1 is an 8-bit register
+	flagByteReg2 // reg2 is an 8-bit register (if it's not a memory base)
+	flagRIP      // RIP-relative label address (see LeaqLabelReg)
 )
@@ -28,4 +28,106 @@ func TestLongJumps(t *testing.T) {
 		asm.Label(0)
 		checkEncoding(t, linkToBytes(asm), "0f8d77660000")
 	})
+	t.Run("je", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.Je(0)
+		asm.Nop(0x200)
+		asm.Label(0)
+		checkEncoding(t, linkToBytes(asm), "0f8400020000")
+	})
+
+	t.Run("jae", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.Jae(0)
+		asm.Nop(0x100)
+		asm.Label(0)
+		checkEncoding(t, linkToBytes(asm), "0f8300010000")
+	})
+
+	t.Run("ja", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.Ja(0)
+		asm.Nop(0x100)
+		asm.Label(0)
+		checkEncoding(t, linkToBytes(asm), "0f8700010000")
+	})
+
+	t.Run("jb", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.Jb(0)
+		asm.Nop(0x300)
+		asm.Label(0)
+		checkEncoding(t, linkToBytes(asm), "0f8200030000")
+	})
+
+	t.Run("jbe", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.Label(0)
+		asm.Nop(0x80)
+		asm.Jbe(0)
+		checkEncoding(t, linkToBytes(asm)[0x80:], "0f867affffff")
+	})
+
+	t.Run("jmprel32", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.JmpRel32(0)
+		asm.Nop(1)
+		asm.Label(0)
+		asm.JmpRel32(0)
+		checkEncoding(t, linkToBytes(asm), "e90100000090e9fbffffff")
+	})
+
+	t.Run("callrel32", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.CallRel32(0)
+		asm.Nop(2)
+		asm.Label(0)
+		asm.CallRel32(0)
+		checkEncoding(t, linkToBytes(asm), "e8020000009090e8fbffffff")
+	})
+
+	t.Run("leaqlabel", func(t *testing.T) {
+		asm := NewAssembler()
+		asm.LeaqLabelReg(0, RAX)
+		asm.Nop(1)
+		asm.Label(0)
+		asm.LeaqLabelReg(0, R9)
+		checkEncoding(t, linkToBytes(asm), "488d0501000000904c8d0df9ffffff")
+	})
+}
+
+func TestAlign(t *testing.T) {
+	tests := []struct {
+		prefix int
+		skew   int
+		want   string
+	}{
+		{0, 0, "48b8"},
+		{1, 0, "9090909090909048b8"},
+		{1, 2, "909090909048b8"},
+		{6, 2, "48b8"},
+		{7, 2, "9090909090909048b8"},
+		{3, 13, "48b8"},
+		{4, 13, "9090909090909048b8"},
+	}
+
+	for _, test := range tests {
+		asm := NewAssembler()
+		asm.Nop(test.prefix)
+		asm.Align(8, test.skew)
+		index := asm.MovqFixup64Reg(RAX)
+		asm.Jmp(0)
+		asm.Label(0)
+		buf := linkToBytes(asm)
+		offset := int(asm.OffsetOf(index)) + test.skew
+		if offset%8 != 0 {
+			t.Errorf("prefix=%d skew=%d: offset %d is not aligned",
+				test.prefix, test.skew, offset)
+		}
+		have := fmt.Sprintf("%x", buf[test.prefix:asm.OffsetOf(index)+2])
+		if have != test.want {
+			t.Errorf("prefix=%d skew=%d:\nhave: %s\nwant: %s",
+				test.prefix, test.skew, have, test.want)
+		}
+	}
 }
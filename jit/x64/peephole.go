@@ -0,0 +1,133 @@
+package x64
+
+// Optimize runs peephole optimizations over the pending instructions.
+// It should be called before Link.
+//
+// Removed instructions are replaced by zero-width pseudo instructions,
+// so the instruction indexes (labels, jumps and fixups) remain valid.
+//
+// Rewrites are local to the straight-line code: labels and
+// Raw instructions are never crossed.
+func (a *Assembler) Optimize() {
+	isLabel := make([]bool, len(a.pending))
+	for _, i := range a.labels {
+		isLabel[i] = true
+	}
+
+	changed := false
+	prev := -1
+	for i := range a.pending {
+		inst := &a.pending[i]
+		// Labels, jumps and Raw instructions are pseudo instructions.
+		if inst.flags&flagPseudo != 0 {
+			prev = -1
+			continue
+		}
+		if prev == -1 {
+			prev = i
+			continue
+		}
+		p := &a.pending[prev]
+		switch {
+		case isStoreReload(p, inst):
+			// mov [base+X], reg; mov reg, [base+X]
+			changed = true
+			if inst.flags&flagRexW != 0 {
+				a.remove(i)
+				continue
+			}
+			// 32-bit load zero-extends the register,
+			// so it's replaced by a mov reg, reg.
+			*inst = instruction{
+				opcode: 0x89,
+				reg1:   inst.reg1,
+				reg2:   inst.reg1,
+				flags:  flagModRM,
+			}
+			a.encode(inst)
+			prev = i
+		case isAddqCancel(p, inst):
+			// add reg, N; add reg, -N
+			a.remove(prev)
+			a.remove(i)
+			changed = true
+			prev = -1
+		default:
+			prev = i
+		}
+	}
+
+	// Remove jumps to the next instruction.
+	// Only rel8 jumps are considered: jump table entries (JmpRel32)
+	// must keep their width, calls (CallRel32) and label address
+	// loads (LeaqLabelReg) are not jumps.
+	// Jumps are visited backwards, so a removed jump
+	// can make its predecessor removable too.
+	removed := false
+	for k := len(a.jumps) - 1; k >= 0; k-- {
+		i := a.jumps[k]
+		if a.pending[i].size == 2 && a.jumpsToNext(i, isLabel) {
+			a.remove(i)
+			removed = true
+		}
+	}
+	if removed {
+		changed = true
+		jumps := a.jumps[:0]
+		for _, i := range a.jumps {
+			if a.pending[i].size != 0 {
+				jumps = append(jumps, i)
+			}
+		}
+		a.jumps = jumps
+	}
+
+	if changed {
+		offset := int32(0)
+		for i, inst := range a.pending {
+			a.pending[i].offset = offset
+			offset += int32(inst.size)
+		}
+		a.length = int(offset)
+	}
+}
+
+func (a *Assembler) remove(i int) {
+	a.pending[i] = instruction{flags: flagPseudo}
+}
+
+// jumpsToNext reports whether a jump at index i targets a label
+// that is bound right after it.
+func (a *Assembler) jumpsToNext(i int, isLabel []bool) bool {
+	id := a.pending[i].imm
+	for j := i + 1; j < len(a.pending); j++ {
+		inst := &a.pending[j]
+		switch {
+		case isLabel[j]:
+			if inst.imm == id {
+				return true
+			}
+		case inst.flags&flagPseudo != 0 && inst.size == 0:
+			// Removed instruction.
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func isStoreReload(store, load *instruction) bool {
+	const memFlags = flagModRM | flagMemory
+	return store.opcode == 0x89 && load.opcode == 0x8B &&
+		store.flags&^flagRexW == memFlags && load.flags == store.flags &&
+		store.reg1 == load.reg1 && store.reg2 == load.reg2 &&
+		store.disp == load.disp
+}
+
+func isAddqCancel(x, y *instruction) bool {
+	isAddq := func(inst *instruction) bool {
+		return (inst.opcode == 0x83 || inst.opcode == 0x81) &&
+			inst.reg1 == op0 && inst.flags&(flagRexW|flagMemory) == flagRexW
+	}
+	return isAddq(x) && isAddq(y) && x.reg2 == y.reg2 && x.imm+y.imm == 0
+}
@@ -0,0 +1,134 @@
+package x64
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		run  func(*Assembler)
+	}{
+		{
+			name: "storeReload64",
+			want: "48894610",
+			run: func(asm *Assembler) {
+				asm.MovqRegMem(RAX, RSI, 16)
+				asm.MovqMemReg(RSI, RAX, 16)
+			},
+		},
+
+		{
+			name: "storeReload32",
+			want: "89461089c0",
+			run: func(asm *Assembler) {
+				asm.MovlRegMem(RAX, RSI, 16)
+				asm.MovlMemReg(RSI, RAX, 16)
+			},
+		},
+
+		{
+			name: "storeReloadOtherSlot",
+			want: "48894610488b4618",
+			run: func(asm *Assembler) {
+				asm.MovqRegMem(RAX, RSI, 16)
+				asm.MovqMemReg(RSI, RAX, 24)
+			},
+		},
+
+		{
+			name: "storeReloadOtherWidth",
+			want: "48894610" + "8b4610",
+			run: func(asm *Assembler) {
+				asm.MovqRegMem(RAX, RSI, 16)
+				asm.MovlMemReg(RSI, RAX, 16)
+			},
+		},
+
+		{
+			name: "storeReloadLabel",
+			want: "48894610488b4610",
+			run: func(asm *Assembler) {
+				asm.MovqRegMem(RAX, RSI, 16)
+				asm.Label(0)
+				asm.MovqMemReg(RSI, RAX, 16)
+			},
+		},
+
+		{
+			name: "addCancel",
+			want: "90",
+			run: func(asm *Assembler) {
+				asm.AddqConstReg(-1000, RSI)
+				asm.AddqConstReg(1000, RSI)
+				asm.Nop(1)
+			},
+		},
+
+		{
+			name: "addCancelOnce",
+			want: "4883c620",
+			run: func(asm *Assembler) {
+				asm.AddqConstReg(32, RSI)
+				asm.AddqConstReg(-32, RSI)
+				asm.AddqConstReg(32, RSI)
+			},
+		},
+
+		{
+			name: "jumpToNext",
+			want: "90",
+			run: func(asm *Assembler) {
+				asm.Jmp(0)
+				asm.Label(1)
+				asm.Jge(0)
+				asm.Label(0)
+				asm.Nop(1)
+			},
+		},
+
+		{
+			name: "jumpTableEntry",
+			want: "e900000000",
+			run: func(asm *Assembler) {
+				asm.JmpRel32(0)
+				asm.Label(0)
+			},
+		},
+
+		{
+			name: "callToNext",
+			want: "e800000000",
+			run: func(asm *Assembler) {
+				asm.CallRel32(0)
+				asm.Label(0)
+			},
+		},
+
+		{
+			name: "offsets",
+			want: "eb05" + "48894610" + "90" + "ebf9",
+			run: func(asm *Assembler) {
+				asm.Jmp(1)
+				asm.Label(0)
+				asm.MovqRegMem(RAX, RSI, 16)
+				asm.MovqMemReg(RSI, RAX, 16)
+				asm.Nop(1)
+				asm.Label(1)
+				asm.Jmp(0)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		asm := NewAssembler()
+		test.run(asm)
+		asm.Optimize()
+		have := fmt.Sprintf("%x", linkToBytes(asm))
+		if have != test.want {
+			t.Errorf("%s:\nhave: %s\nwant: %s", test.name, have, test.want)
+		}
+	}
+}
@@ -309,3 +309,229 @@ l1:
         NOP1   // asm.Label(1); asm.Nop(1)
         JNE l3 // asm.Jne(3)
         RET
+
+TEXT testJae1(SB), 0, $0-0
+        JCC forward2 // asm.Jae(2)
+forward2:
+        JCC forward1 // asm.Label(2); asm.Jae(1)
+        NOP1         // asm.Nop(1)
+forward1:
+        NOP1 // asm.Label(1); asm.Nop(1)
+        RET
+
+TEXT testJae2(SB), 0, $0-0
+l2:
+        NOP1   // asm.Label(2); asm.Nop(1)
+        JCC l1 // asm.Jae(1)
+l3:
+        NOP1   // asm.Label(3); asm.Nop(1)
+        JCC l2 // asm.Jae(2)
+l1:
+        NOP1   // asm.Label(1); asm.Nop(1)
+        JCC l3 // asm.Jae(3)
+        RET
+
+TEXT testCmpReg(SB), 0, $0-0
+        CMPL AX, $15   // asm.CmplConst8Reg(15, RAX)
+        CMPL CX, $-1   // asm.CmplConst8Reg(-1, RCX)
+        CMPL DX, $1000 // asm.CmplConst32Reg(1000, RDX)
+        CMPL R9, $-200 // asm.CmplConst32Reg(-200, R9)
+        RET
+
+TEXT testJe1(SB), 0, $0-0
+        JEQ forward2 // asm.Je(2)
+forward2:
+        JEQ forward1 // asm.Label(2); asm.Je(1)
+        NOP1         // asm.Nop(1)
+forward1:
+        NOP1 // asm.Label(1); asm.Nop(1)
+        RET
+
+TEXT testJe2(SB), 0, $0-0
+l2:
+        NOP1   // asm.Label(2); asm.Nop(1)
+        JEQ l1 // asm.Je(1)
+l3:
+        NOP1   // asm.Label(3); asm.Nop(1)
+        JEQ l2 // asm.Je(2)
+l1:
+        NOP1   // asm.Label(1); asm.Nop(1)
+        JEQ l3 // asm.Je(3)
+        RET
+
+TEXT testCmpqReg(SB), 0, $0-0
+        CMPQ AX, 0*8(DI)  // asm.CmpqRegMem(RAX, RDI, 0*8)
+        CMPQ BX, 1*8(SI)  // asm.CmpqRegMem(RBX, RSI, 1*8)
+        CMPQ R8, 300(SI)  // asm.CmpqRegMem(R8, RSI, 300)
+        RET
+
+TEXT testRegReg(SB), 0, $0-0
+        MOVL BX, R9       // asm.MovlRegReg(RBX, R9)
+        MOVL R13, AX      // asm.MovlRegReg(R13, RAX)
+        MOVQ R12, CX      // asm.MovqRegReg(R12, RCX)
+        MOVQ AX, BX       // asm.MovqRegReg(RAX, RBX)
+        ADDL R10, AX      // asm.AddlRegReg(R10, RAX)
+        ADDL AX, R11      // asm.AddlRegReg(RAX, R11)
+        SUBL BX, AX       // asm.SublRegReg(RBX, RAX)
+        SUBL R9, R10      // asm.SublRegReg(R9, R10)
+        IMULL BX, AX      // asm.ImullRegReg(RBX, RAX)
+        IMULL R13, R9     // asm.ImullRegReg(R13, R9)
+        CMPL AX, BX       // asm.CmplRegReg(RAX, RBX)
+        CMPL R9, R12      // asm.CmplRegReg(R9, R12)
+        CMPQ BX, AX       // asm.CmpqRegReg(RBX, RAX)
+        CMPQ R11, CX      // asm.CmpqRegReg(R11, RCX)
+        CMPQ BX, $0       // asm.CmpqConst8Reg(0, RBX)
+        CMPQ R10, $-100   // asm.CmpqConst8Reg(-100, R10)
+        CMPQ CX, $1000    // asm.CmpqConst32Reg(1000, RCX)
+        MOVLQSX BX, AX    // asm.MovlqsxRegReg(RBX, RAX)
+        MOVLQSX AX, R12   // asm.MovlqsxRegReg(RAX, R12)
+        MOVBLSX AX, AX    // asm.MovblsxRegReg(RAX, RAX)
+        MOVBLSX R9, BX    // asm.MovblsxRegReg(R9, RBX)
+        RET
+
+TEXT testBitwise(SB), 0, $0-0
+        ANDL BX, CX         // asm.AndlRegReg(RBX, RCX)
+        ANDQ R9, DX         // asm.AndqRegReg(R9, RDX)
+        ANDL 8(SI), DX      // asm.AndlMemReg(RSI, RDX, 8)
+        ANDQ -16(BP), R11   // asm.AndqMemReg(RBP, R11, -16)
+        ANDL $7, CX         // asm.AndlConst8Reg(7, RCX)
+        ANDL $0xfff0, R9    // asm.AndlConst32Reg(0xfff0, R9)
+        ANDQ $-16, R10      // asm.AndqConst8Reg(-16, R10)
+        ANDQ $0x7fffffff, BX // asm.AndqConst32Reg(0x7fffffff, RBX)
+        ORL AX, BX          // asm.OrlRegReg(RAX, RBX)
+        ORQ R12, R13        // asm.OrqRegReg(R12, R13)
+        ORL (DI), AX        // asm.OrlMemReg(RDI, RAX, 0)
+        ORQ 24(SI), CX      // asm.OrqMemReg(RSI, RCX, 24)
+        ORL $1, DX          // asm.OrlConst8Reg(1, RDX)
+        ORL $1000, SI       // asm.OrlConst32Reg(1000, RSI)
+        ORQ $-1, R8         // asm.OrqConst8Reg(-1, R8)
+        ORQ $300, DI        // asm.OrqConst32Reg(300, RDI)
+        XORL AX, AX         // asm.XorlRegReg(RAX, RAX)
+        XORQ R15, CX        // asm.XorqRegReg(R15, RCX)
+        XORL 4(BX), R9      // asm.XorlMemReg(RBX, R9, 4)
+        XORQ 1000(SI), AX   // asm.XorqMemReg(RSI, RAX, 1000)
+        XORL $-1, BX        // asm.XorlConst8Reg(-1, RBX)
+        XORL $0x10000, CX   // asm.XorlConst32Reg(0x10000, RCX)
+        XORQ $127, R14      // asm.XorqConst8Reg(127, R14)
+        XORQ $-129, DX      // asm.XorqConst32Reg(-129, RDX)
+        RET
+
+TEXT testShift(SB), 0, $0-0
+        SHLL $3, CX         // asm.ShllConstReg(3, RCX)
+        SHLL $1, DX         // asm.ShllConstReg(1, RDX)
+        SHLL CX, BX         // asm.ShllCLReg(RBX)
+        SHLQ $32, R9        // asm.ShlqConstReg(32, R9)
+        SHLQ CX, AX         // asm.ShlqCLReg(RAX)
+        SHRL $31, AX        // asm.ShrlConstReg(31, RAX)
+        SHRL CX, R10        // asm.ShrlCLReg(R10)
+        SHRQ $63, R11       // asm.ShrqConstReg(63, R11)
+        SHRQ $1, SI         // asm.ShrqConstReg(1, RSI)
+        SARL $1, DI         // asm.SarlConstReg(1, RDI)
+        SARL CX, DX         // asm.SarlCLReg(RDX)
+        SARQ $7, BX         // asm.SarqConstReg(7, RBX)
+        SARQ CX, R9         // asm.SarqCLReg(R9)
+        RET
+
+TEXT testTest(SB), 0, $0-0
+        TESTL BX, CX        // asm.TestlRegReg(RCX, RBX)
+        TESTL R9, AX        // asm.TestlRegReg(RAX, R9)
+        TESTQ DX, DX        // asm.TestqRegReg(RDX, RDX)
+        TESTQ AX, R12       // asm.TestqRegReg(R12, RAX)
+        TESTL $0x100, BX    // asm.TestlConstReg(0x100, RBX)
+        TESTQ $1, R8        // asm.TestqConstReg(1, R8)
+        RET
+
+TEXT testSetcc(SB), 0, $0-0
+        SETEQ CX            // asm.SetccReg(CondE, RCX)
+        SETNE SI            // asm.SetccReg(CondNE, RSI)
+        SETLT R9            // asm.SetccReg(CondL, R9)
+        SETGE DI            // asm.SetccReg(CondGE, RDI)
+        SETLE BX            // asm.SetccReg(CondLE, RBX)
+        SETGT DX            // asm.SetccReg(CondG, RDX)
+        SETCS AX            // asm.SetccReg(CondB, RAX)
+        SETCC AX            // asm.SetccReg(CondAE, RAX)
+        SETLS BP            // asm.SetccReg(CondBE, RBP)
+        SETHI R15           // asm.SetccReg(CondA, R15)
+        RET
+
+TEXT testCmov(SB), 0, $0-0
+        CMOVLEQ BX, CX      // asm.CmovlRegReg(CondE, RBX, RCX)
+        CMOVLNE R9, AX      // asm.CmovlRegReg(CondNE, R9, RAX)
+        CMOVLLT AX, R10     // asm.CmovlRegReg(CondL, RAX, R10)
+        CMOVLGE DX, SI      // asm.CmovlRegReg(CondGE, RDX, RSI)
+        CMOVQLE R11, R12    // asm.CmovqRegReg(CondLE, R11, R12)
+        CMOVQGT CX, DX      // asm.CmovqRegReg(CondG, RCX, RDX)
+        CMOVQCS SI, DI      // asm.CmovqRegReg(CondB, RSI, RDI)
+        CMOVQHI R8, BX      // asm.CmovqRegReg(CondA, R8, RBX)
+        RET
+
+TEXT testImul3(SB), 0, $0-0
+        IMUL3L $7, BX, CX       // asm.ImullConst8RegReg(7, RBX, RCX)
+        IMUL3L $1000, R9, AX    // asm.ImullConst32RegReg(1000, R9, RAX)
+        IMUL3Q $-3, CX, R12     // asm.ImulqConst8RegReg(-3, RCX, R12)
+        IMUL3Q $100000, SI, DI  // asm.ImulqConst32RegReg(100000, RSI, RDI)
+        RET
+
+TEXT testLea(SB), 0, $0-0
+        LEAQ 8(AX), CX              // asm.LeaqMemReg(RAX, RCX, 8)
+        LEAQ (SP), BX               // asm.LeaqMemReg(RSP, RBX, 0)
+        LEAQ 16(R12), AX            // asm.LeaqMemReg(R12, RAX, 16)
+        LEAQ (BP), DX               // asm.LeaqMemReg(RBP, RDX, 0)
+        LEAQ -300(R13), R8          // asm.LeaqMemReg(R13, R8, -300)
+        LEAQ (AX)(BX*1), CX         // asm.LeaqMemindexReg(RAX, RCX, RBX, 1, 0)
+        LEAQ 8(AX)(BX*2), CX        // asm.LeaqMemindexReg(RAX, RCX, RBX, 2, 8)
+        LEAQ -4(R13)(R9*8), R10     // asm.LeaqMemindexReg(R13, R10, R9, 8, -4)
+        LEAQ 1000(SI)(CX*4), DX     // asm.LeaqMemindexReg(RSI, RDX, RCX, 4, 1000)
+        LEAQ (BP)(AX*4), BX         // asm.LeaqMemindexReg(RBP, RBX, RAX, 4, 0)
+        LEAQ (R12)(R15*1), SI       // asm.LeaqMemindexReg(R12, RSI, R15, 1, 0)
+        RET
+
+TEXT testExtend(SB), 0, $0-0
+        MOVBLZX CX, BX      // asm.MovblzxRegReg(RCX, RBX)
+        MOVBLZX SI, AX      // asm.MovblzxRegReg(RSI, RAX)
+        MOVBLSX DI, R8      // asm.MovblsxRegReg(RDI, R8)
+        MOVWLZX R9, AX      // asm.MovwlzxRegReg(R9, RAX)
+        MOVWLSX BX, CX      // asm.MovwlsxRegReg(RBX, RCX)
+        MOVBLZX 3(SI), AX   // asm.MovblzxMemReg(RSI, RAX, 3)
+        MOVBLSX (AX), R10   // asm.MovblsxMemReg(RAX, R10, 0)
+        MOVWLZX 8(SP), CX   // asm.MovwlzxMemReg(RSP, RCX, 8)
+        MOVWLSX -2(BP), DX  // asm.MovwlsxMemReg(RBP, RDX, -2)
+        MOVW AX, 2(SI)      // asm.MovwRegMem(RAX, RSI, 2)
+        MOVW R9, (BX)       // asm.MovwRegMem(R9, RBX, 0)
+        MOVB SI, (AX)       // asm.MovbRegMem(RSI, RAX, 0)
+        MOVB R10, 1(DI)     // asm.MovbRegMem(R10, RDI, 1)
+        RET
+
+TEXT testMemBase(SB), 0, $0-0
+        MOVL 8(R12), AX     // asm.MovlMemReg(R12, RAX, 8)
+        MOVQ BX, (SP)       // asm.MovqRegMem(RBX, RSP, 0)
+        MOVL (R13), CX      // asm.MovlMemReg(R13, RCX, 0)
+        MOVQ (BP), DX       // asm.MovqMemReg(RBP, RDX, 0)
+        ADDL $1, (R12)      // asm.AddlConst8Mem(1, R12, 0)
+        MOVL $5, (AX)(R9*4) // asm.MovlConst32Memindex(5, RAX, R9)
+        MOVL (R8)(R11*4), DX // asm.MovlMemindexReg(R8, RDX, R11)
+        RET
+
+TEXT testIdivq(SB), 0, $0-0
+        CQO                 // asm.Cqo()
+        IDIVQ BX            // asm.IdivqReg(RBX)
+        IDIVQ R10           // asm.IdivqReg(R10)
+        IDIVQ 8(SI)         // asm.IdivqMem(RSI, 8)
+        IDIVQ (R12)         // asm.IdivqMem(R12, 0)
+        RET
+
+TEXT testJunsigned(SB), 0, $0-0
+        JCS forward2 // asm.Jb(2)
+forward2:
+        JHI forward1 // asm.Label(2); asm.Ja(1)
+        JLS forward1 // asm.Jbe(1)
+        NOP1         // asm.Nop(1)
+forward1:
+        NOP1 // asm.Label(1); asm.Nop(1)
+        RET
+
+TEXT testAddq(SB), 0, $0-0
+        ADDQ CX, AX  // asm.AddqRegReg(RCX, RAX)
+        ADDQ R9, BX  // asm.AddqRegReg(R9, RBX)
+        ADDQ SI, R14 // asm.AddqRegReg(RSI, R14)
+        RET
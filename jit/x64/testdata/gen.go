@@ -80,7 +80,7 @@ func main() {
 	tmpl := template.Must(template.New(`testcase`).Parse(`
 {
   name: "{{$.Name}}",
-  want: []expected{
+  want: []asmExpected{
     {{- range $.Lines}}
       { {{.LineNum}}, "{{.Asm}}", "{{.Enc}}" },
     {{- end}}
@@ -1,25 +1,16 @@
 package jruntime
 
 import (
-	"unsafe"
-
 	"github.com/quasilyte/go-jdk/jit"
 )
 
 func BindFuncs(ctx *jit.Context) {
-	ctx.Funcs.JcallScalar = funcAddr(jcallScalar)
-	ctx.Funcs.NewIntArray = funcAddr(NewIntArray)
+	bindFuncs(ctx)
 }
 
-// funcAddr returns function value fn executable code address.
-func funcAddr(fn interface{}) uint32 {
-	// emptyInterface is the header for an interface{} value.
-	type emptyInterface struct {
-		typ   uintptr
-		value *uintptr
-	}
-	e := (*emptyInterface)(unsafe.Pointer(&fn))
-	addr := *e.value
+// addr32 returns executable code address that is
+// guaranteed to fit in a 32-bit immediate.
+func addr32(addr uintptr) uint32 {
 	if addr > 0xffffffff {
 		panic("func addr does not fit in 32-bit")
 	}
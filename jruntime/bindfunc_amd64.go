@@ -0,0 +1,19 @@
+package jruntime
+
+import (
+	"github.com/quasilyte/go-jdk/jit"
+)
+
+// Go func values point to the register-based ABI entry points,
+// while the JIT code passes Go call arguments through the stack.
+// Assembly functions below return the stack-based (ABI0) entry points.
+
+func jcallScalarAddr() uintptr
+func newIntArrayAddr() uintptr
+func resolveMethodAddr() uintptr
+
+func bindFuncs(ctx *jit.Context) {
+	ctx.Funcs.JcallScalar = addr32(jcallScalarAddr())
+	ctx.Funcs.NewIntArray = addr32(newIntArrayAddr())
+	ctx.Funcs.ResolveMethod = addr32(resolveMethodAddr())
+}
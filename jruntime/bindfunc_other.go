@@ -0,0 +1,11 @@
+//go:build !amd64 && !arm64
+
+package jruntime
+
+import (
+	"github.com/quasilyte/go-jdk/jit"
+)
+
+func bindFuncs(ctx *jit.Context) {
+	// Interpreted code doesn't need any machine code addresses.
+}
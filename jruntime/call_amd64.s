@@ -37,3 +37,21 @@ TEXT ·jcallScalar(SB), 0, $96-16
 gocall:
         CALL CX
         JMP -8(BP)
+
+// func jcallScalarAddr() uintptr
+TEXT ·jcallScalarAddr(SB), NOSPLIT, $0-8
+        MOVQ $·jcallScalar(SB), AX
+        MOVQ AX, ret+0(FP)
+        RET
+
+// func newIntArrayAddr() uintptr
+TEXT ·newIntArrayAddr(SB), NOSPLIT, $0-8
+        MOVQ $·NewIntArray(SB), AX
+        MOVQ AX, ret+0(FP)
+        RET
+
+// func resolveMethodAddr() uintptr
+TEXT ·resolveMethodAddr(SB), NOSPLIT, $0-8
+        MOVQ $·resolveMethod(SB), AX
+        MOVQ AX, ret+0(FP)
+        RET
@@ -1,8 +1,10 @@
 package jruntime
 
 import (
+	"bytes"
 	"sync"
 	"testing"
+	"unsafe"
 
 	"github.com/quasilyte/go-jdk/mmap"
 )
@@ -95,3 +97,21 @@ func munmap(tb testing.TB, d mmap.Descriptor) {
 		tb.Errorf("mmap free: %v", err)
 	}
 }
+
+func TestGocallOffset(t *testing.T) {
+	// The x64 compiler uses this offset to call Go functions
+	// through the jcallScalar frame. It depends on the jcallScalar
+	// prologue that is generated by the Go assembler.
+	const gocallOffset = 63
+	want := []byte{
+		// CALL CX
+		0xff, 0xd1,
+		// JMP -8(BP)
+		0xff, 0x65, 0xf8,
+	}
+	addr := jcallScalarAddr() + gocallOffset
+	have := (*(**[5]byte)(unsafe.Pointer(&addr)))[:]
+	if !bytes.Equal(have, want) {
+		t.Errorf("gocall code mismatch:\nhave: %x\nwant: %x", have, want)
+	}
+}
@@ -0,0 +1,54 @@
+#include "textflag.h"
+#include "funcdata.h"
+
+// Register roles:
+// R0 - tmp register; also used for return value
+// R1-R3 - tmp registers
+// R16 - branch target register
+// R17 - assembler scratch register
+// R19 - stack pointer
+// R20 - env pointer
+//
+// $96 bytes for Go call arguments space.
+// $8 bytes for the JIT code return address during the Go call.
+// $16 bytes for 2 pointer arguments.
+
+// func jcallScalar(e *Env, code *byte)
+TEXT ·jcallScalar(SB), 0, $104-16
+        // We only use local stack frame to pass Go func arguments.
+        // As long as pointers that are placed there are also
+        // reachable from other parts of the program, we should be fine.
+        // See #32.
+        NO_LOCAL_POINTERS
+        MOVD e+0(FP), R20 // env is always at R20
+        MOVD 8(R20), R19  // stack is always at R19
+        MOVD code+8(FP), R16
+        ADR ret, R0
+        MOVD R0, (R19)
+        ADD $16, R19
+        JMP (R16)
+ret:
+        MOVD R0, -16(R19) // Save called function result, if any
+        RET
+gocall:
+        // R0 - JIT code return address
+        // R1 - Go function address
+        MOVD R0, jitret-8(SP)
+        MOVD R19, 24(R20) // Spill stack pointer to env.tmp
+        CALL (R1)
+        MOVD e+0(FP), R20
+        MOVD 24(R20), R19
+        MOVD jitret-8(SP), R0
+        JMP (R0)
+
+// func jcallScalarAddr() uintptr
+TEXT ·jcallScalarAddr(SB), NOSPLIT, $0-8
+        MOVD $·jcallScalar(SB), R0
+        MOVD R0, ret+0(FP)
+        RET
+
+// func newIntArrayAddr() uintptr
+TEXT ·newIntArrayAddr(SB), NOSPLIT, $0-8
+        MOVD $·NewIntArray(SB), R0
+        MOVD R0, ret+0(FP)
+        RET
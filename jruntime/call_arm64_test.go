@@ -0,0 +1,85 @@
+package jruntime
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	"github.com/quasilyte/go-jdk/mmap"
+)
+
+func TestJcall(t *testing.T) {
+	var env Env
+	env.slots = make([]stackSlot, 16)
+	env.stack = &env.slots[0]
+
+	funcCode := wordsToBytes(
+		// MOVD $777, R0
+		0xd2806120,
+		// MOVD R0, (R19)
+		0xf9000260,
+		// MOVD $1, R0
+		0xd2800020,
+		// MOVD -16(R19), R16
+		0xf85f0270,
+		// JMP (R16)
+		0xd61f0200,
+	)
+	d, executable, err := mmap.Executable(len(funcCode))
+	if err != nil {
+		t.Errorf("mmap executable: %v", err)
+	}
+	copy(executable, funcCode)
+	mmap.FlushCode(executable)
+	defer munmap(t, d)
+
+	checkStack := func() {
+		if env.slots[0].scalar != 1 {
+			t.Errorf("stack[0] mismatch:\nhave: %d\nwant: 1", env.slots[0].scalar)
+		}
+		if env.slots[1].scalar != 777 {
+			t.Errorf("stack[1] mismatch:\nhave: %d\nwant: 777", env.slots[1].scalar)
+		}
+		env.slots[0].scalar = 0
+		env.slots[1].scalar = 0
+	}
+
+	// Call in a same goroutine, on a same frame.
+	jcallScalar(&env, &executable[0])
+	checkStack()
+
+	// Should not panic nor corrupt the stack.
+	for i := 0; i < 10; i++ {
+		nestedCall(&env, executable)
+		checkStack()
+	}
+
+	// Now test it inside a new goroutine.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		jcallScalar(&env, &executable[0])
+		checkStack()
+		wg.Done()
+	}()
+	wg.Wait()
+}
+
+//go:noinline
+func nestedCall(env *Env, code []byte) {
+	jcallScalar(env, &code[0])
+}
+
+func wordsToBytes(words ...uint32) []byte {
+	buf := make([]byte, len(words)*4)
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(buf[i*4:], w)
+	}
+	return buf
+}
+
+func munmap(tb testing.TB, d mmap.Descriptor) {
+	if err := mmap.Free(d); err != nil {
+		tb.Errorf("mmap free: %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !amd64 && !arm64
+
+package jruntime
+
+// jcallScalar runs method code inside env context.
+//
+// There is no JIT backend for this platform, so every method
+// is executed by the interpreter and this function is never called.
+func jcallScalar(e *Env, code *byte) {
+	panic("machine code execution is not supported on this platform")
+}
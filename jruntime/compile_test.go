@@ -0,0 +1,155 @@
+package jruntime
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/irfmt"
+	"github.com/quasilyte/go-jdk/iropt"
+	"github.com/quasilyte/go-jdk/jit"
+	"github.com/quasilyte/go-jdk/symbol"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+func TestCompiledIR(t *testing.T) {
+	// Methods use more values than there are allocatable registers
+	// and keep them live across the calls.
+	const src = `
+method pressure(I)I
+  r1:int = Iadd r0:int 1
+  r2:int = Iadd r0 2
+  r3:int = Iadd r0 3
+  r4:int = Iadd r0 4
+  r5:int = Iadd r0 5
+  r6:int = Iadd r0 6
+  r7:int = Iadd r0 7
+  r8:int = Iadd r0 8
+  r9:int = Iadd r0 9
+  r10:int = CallStatic test/T.sq(I)I r0
+  r10 = Iadd r10 r1
+  r10 = Iadd r10 r2
+  r10 = Iadd r10 r3
+  r10 = Iadd r10 r4
+  r10 = Iadd r10 r5
+  r10 = Isub r10 r6
+  r10 = Isub r10 r7
+  r10 = Iadd r10 r8
+  r10 = Iadd r10 r9
+  Iret r10
+
+method sq(I)I
+  r1:int = Imul r0:int r0
+  Iret r1
+
+method sumsq(I)I
+  r1:int = Iload 0
+  r2:int = Iload 0
+loop:
+  flags = Icmp r2 r0:int
+  JumpGtEq @done flags
+  r3:int = CallStatic test/T.sq(I)I r2
+  r1 = Iadd r1 r3
+  r2 = Iadd r2 1
+  Jump @loop
+done:
+  Iret r1
+`
+
+	vm, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	class := compileTestClass(t, vm, []vmdat.Method{
+		{Name: "pressure", Descriptor: "(I)I"},
+		{Name: "sq", Descriptor: "(I)I"},
+		{Name: "sumsq", Descriptor: "(I)I"},
+	}, src)
+
+	sumsq := func(n int64) int64 {
+		v := int64(0)
+		for i := int64(0); i < n; i++ {
+			v += i * i
+		}
+		return v
+	}
+	pressure := func(n int64) int64 {
+		return n*n + 5*n + 15 - (2*n + 13) + 2*n + 17
+	}
+	tests := []struct {
+		method string
+		want   func(n int64) int64
+	}{
+		{"sumsq", sumsq},
+		{"pressure", pressure},
+	}
+	for _, test := range tests {
+		m := class.FindMethod(test.method, "")
+		for _, n := range []int64{1, 2, 10, 100} {
+			have := callTestMethod(t, vm, m, n)
+			if want := test.want(n); int32(have) != int32(want) {
+				t.Errorf("%s(%d): have %d, want %d", test.method, n, int32(have), want)
+			}
+		}
+	}
+}
+
+// compileTestClass compiles src methods as a test/T class methods.
+// decls describe the class methods, they should be sorted by name.
+func compileTestClass(t *testing.T, vm *VM, decls []vmdat.Method, src string) *vmdat.Class {
+	t.Helper()
+	return compileOptimizedTestClass(t, vm, decls, src, nil)
+}
+
+// compileOptimizedTestClass is like compileTestClass, but the methods
+// are optimized using opt before the compilation, unless opt is nil.
+func compileOptimizedTestClass(t *testing.T, vm *VM, decls []vmdat.Method, src string, opt *iropt.Config) *vmdat.Class {
+	t.Helper()
+	pkg := vm.State.NewPackage("test")
+	pkg.Classes = []vmdat.Class{{Name: "T", Methods: decls}}
+	class := &pkg.Classes[0]
+	for i := range class.Methods {
+		class.Methods[i].ID = symbol.NewID(uint64(pkg.ID), 0, uint64(i))
+	}
+	parsed, err := irfmt.Parse(&vm.State, src)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var methods []ir.Method
+	for _, pm := range parsed {
+		out := class.FindMethod(pm.Out.Name, pm.Out.Descriptor)
+		if out == nil {
+			t.Fatalf("%s%s is not declared", pm.Out.Name, pm.Out.Descriptor)
+		}
+		out.FrameSlots = pm.Out.FrameSlots
+		pm.Out = out
+		methods = append(methods, pm)
+	}
+	packages := []*ir.Package{{
+		Out:     pkg,
+		Classes: []ir.Class{{Name: "T", Out: class, Methods: methods}},
+	}}
+	if opt != nil {
+		if _, err := iropt.Optimize(&vm.State, packages, opt); err != nil {
+			t.Fatalf("optimize: %v", err)
+		}
+	}
+	ctx := jit.Context{Mmap: &vm.Mmap, State: &vm.State}
+	BindFuncs(&ctx)
+	if err := vm.Compiler.Compile(ctx, packages); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	return class
+}
+
+func callTestMethod(t *testing.T, vm *VM, m *vmdat.Method, arg int64) int64 {
+	t.Helper()
+	env := NewEnv(vm, &EnvConfig{StackMemory: 64 * 1024})
+	env.IntArg(0, arg)
+	result, err := env.IntCall(m)
+	if err != nil {
+		t.Fatalf("%s(%d): %v", m.Name, arg, err)
+	}
+	return result
+}
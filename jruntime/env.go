@@ -93,10 +93,22 @@ func (env *Env) GC() {
 
 func (env *Env) IntCall(m *vmdat.Method) (int64, error) {
 	env.allocBytesLeft = env.allocBytesLimit
-	jcallScalar(env, &m.Code[0])
+	if code, entry := env.vm.methodEntry(m); code != nil {
+		// Arguments are stored right after the return address slot,
+		// just like jcallScalar would expect them to be.
+		*env.stack = env.interpret(code, env.stackIndex()+1)
+	} else {
+		jcallScalar(env, entry)
+	}
 	return env.stack.scalar, nil
 }
 
+// stackIndex returns an index of the slot that is pointed by env stack.
+func (env *Env) stackIndex() int {
+	offset := uintptr(unsafe.Pointer(env.stack)) - uintptr(unsafe.Pointer(&env.slots[0]))
+	return int(offset / unsafe.Sizeof(stackSlot{}))
+}
+
 func (env *Env) IntArg(i int, v int64) {
 	ptr := unsafe.Pointer(uintptr(unsafe.Pointer(env.stack)) + uintptr(i*16) + 16)
 	(*stackSlot)(ptr).scalar = v
@@ -0,0 +1,441 @@
+package jruntime
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/jit"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+// Interpreter is a compiler that generates no machine code.
+// It keeps the method IR and executes it directly.
+//
+// Interpreted methods use the same Env stack slots layout as
+// the compiled ones, so they can call the machine code methods.
+// Machine code can't call interpreted methods directly,
+// only through the method stubs, if the JIT compiler has them.
+//
+// Every VM has its own interpreter, see VM.Interpreter.
+type Interpreter struct {
+	methods map[*vmdat.Method]*interpMethod
+
+	// hot is called when a method counter reaches the hotThreshold.
+	// If it's nil, methods are not profiled.
+	hot          func(m *vmdat.Method)
+	hotThreshold int
+}
+
+type interpMethod struct {
+	ir *ir.Method
+
+	// frameSlots is a frame size of the ir code.
+	// Method out frame size can change during the recompilation
+	// while the old code is still running.
+	frameSlots int
+
+	// counter is a number of method invocations plus
+	// the number of the backward jumps that were taken.
+	// It's updated atomically by the concurrently running Envs.
+	counter int64
+}
+
+func newInterpreter() *Interpreter {
+	return &Interpreter{
+		methods: make(map[*vmdat.Method]*interpMethod),
+	}
+}
+
+func (interp *Interpreter) Compile(ctx jit.Context, packages []*ir.Package) error {
+	for _, p := range packages {
+		for i := range p.Classes {
+			c := &p.Classes[i]
+			for j := range c.Methods {
+				m := &c.Methods[j]
+				if len(m.Code) == 0 {
+					continue
+				}
+				for _, inst := range m.Code {
+					if !canInterpret(inst) {
+						return fmt.Errorf("package %s: %s.%s%s: can't interpret: %s",
+							p.Out.Name, c.Name, m.Out.Name, m.Out.Descriptor, inst)
+					}
+				}
+				m.Out.Code = nil
+				interp.methods[m.Out] = &interpMethod{
+					ir:         m,
+					frameSlots: m.Out.FrameSlots,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func canInterpret(inst ir.Inst) bool {
+	switch inst.Kind {
+	case ir.InstInvalid, ir.InstPhi:
+		return false
+	case ir.InstNewBoolArray, ir.InstNewCharArray, ir.InstNewFloatArray,
+		ir.InstNewDoubleArray, ir.InstNewByteArray, ir.InstNewShortArray,
+		ir.InstNewLongArray:
+		return false // Only int arrays are supported by the runtime
+	default:
+		return true
+	}
+}
+
+// interpFrame is an interpreted method activation record.
+type interpFrame struct {
+	env *Env
+
+	// fp is an index of the first frame slot inside env slots.
+	fp int
+
+	// frameSlots is a number of the method frame slots.
+	frameSlots int
+
+	// cmp is a result of the last comparison: -1, 0 or 1.
+	cmp int
+}
+
+// profile increments m counter and reports m as hot, if needed.
+func (interp *Interpreter) profile(m *interpMethod) {
+	if interp.hot == nil {
+		return
+	}
+	if atomic.AddInt64(&m.counter, 1) == int64(interp.hotThreshold) {
+		interp.hot(m.ir.Out)
+	}
+}
+
+// interpret runs m using the frame that starts at fp slot.
+func (env *Env) interpret(m *interpMethod, fp int) stackSlot {
+	env.checkStackLimit(fp + m.frameSlots + 1)
+
+	interp := env.vm.interp
+	interp.profile(m)
+
+	f := interpFrame{env: env, fp: fp, frameSlots: m.frameSlots}
+	code := m.ir.Code
+	pc := 0
+	for {
+		i := pc
+		inst := &code[i]
+		pc++
+
+		var a1, a2 ir.Arg
+		if len(inst.Args) > 0 {
+			a1 = inst.Args[0]
+		}
+		if len(inst.Args) > 1 {
+			a2 = inst.Args[1]
+		}
+
+		switch inst.Kind {
+		case ir.InstJump:
+			pc = int(a1.Value)
+		case ir.InstJumpEqual:
+			if f.cmp == 0 {
+				pc = int(a1.Value)
+			}
+		case ir.InstJumpNotEqual:
+			if f.cmp != 0 {
+				pc = int(a1.Value)
+			}
+		case ir.InstJumpGtEq:
+			if f.cmp >= 0 {
+				pc = int(a1.Value)
+			}
+		case ir.InstJumpGt:
+			if f.cmp > 0 {
+				pc = int(a1.Value)
+			}
+		case ir.InstJumpLt:
+			if f.cmp < 0 {
+				pc = int(a1.Value)
+			}
+		case ir.InstJumpLtEq:
+			if f.cmp <= 0 {
+				pc = int(a1.Value)
+			}
+		case ir.InstSwitch:
+			key := f.int(a1)
+			pc = int(a2.Value)
+			cases := inst.Args[2:]
+			for i := 0; i < len(cases); i += 2 {
+				if int32(cases[i].Value) == key {
+					pc = int(cases[i+1].Value)
+					break
+				}
+			}
+
+		case ir.InstRet:
+			return stackSlot{}
+		case ir.InstIret, ir.InstLret:
+			return stackSlot{scalar: f.scalar(a1)}
+		case ir.InstAret:
+			return stackSlot{ptr: f.ref(a1)}
+
+		case ir.InstIload, ir.InstLload:
+			f.setScalar(inst.Dst, f.scalar(a1))
+		case ir.InstAload:
+			f.setRef(inst.Dst, f.ref(a1))
+
+		case ir.InstIcmp:
+			f.cmp = compareInt64(int64(f.int(a1)), int64(f.int(a2)))
+		case ir.InstLcmp:
+			f.cmp = compareInt64(f.scalar(a1), f.scalar(a2))
+		case ir.InstAcmp:
+			f.cmp = 0
+			if f.ref(a1) != f.ref(a2) {
+				f.cmp = 1
+			}
+
+		case ir.InstIadd:
+			f.setInt(inst.Dst, f.int(a1)+f.int(a2))
+		case ir.InstIsub:
+			f.setInt(inst.Dst, f.int(a1)-f.int(a2))
+		case ir.InstImul:
+			f.setInt(inst.Dst, f.int(a1)*f.int(a2))
+		case ir.InstIdiv:
+			f.setInt(inst.Dst, f.int(a1)/f.int(a2))
+		case ir.InstIneg:
+			f.setInt(inst.Dst, -f.int(a1))
+		case ir.InstLadd:
+			f.setScalar(inst.Dst, f.scalar(a1)+f.scalar(a2))
+		case ir.InstLneg:
+			f.setScalar(inst.Dst, -f.scalar(a1))
+		case ir.InstFadd:
+			f.setFloat(inst.Dst, f.float(a1)+f.float(a2))
+		case ir.InstDadd:
+			f.setDouble(inst.Dst, f.double(a1)+f.double(a2))
+
+		case ir.InstConvL2I:
+			f.setInt(inst.Dst, int32(f.scalar(a1)))
+		case ir.InstConvF2I:
+			f.setInt(inst.Dst, float2int(float64(f.float(a1))))
+		case ir.InstConvD2I:
+			f.setInt(inst.Dst, float2int(f.double(a1)))
+		case ir.InstConvI2L:
+			f.setScalar(inst.Dst, int64(f.int(a1)))
+		case ir.InstConvI2B:
+			f.setInt(inst.Dst, int32(int8(f.int(a1))))
+
+		case ir.InstNewIntArray:
+			f.setRef(inst.Dst, NewIntArray(env, f.int(a2)))
+		case ir.InstIntArrayGet:
+			data := f.ref(a1).AsIntArray().AsSlice()
+			f.setInt(inst.Dst, data[f.int(a2)])
+		case ir.InstIntArraySet:
+			data := f.ref(a1).AsIntArray().AsSlice()
+			data[f.int(a2)] = f.int(inst.Args[2])
+		case ir.InstArrayLen:
+			f.setInt(inst.Dst, f.ref(a1).AsIntArray().Len)
+
+		case ir.InstCallStatic:
+			f.callStatic(inst)
+		case ir.InstCallGo:
+			f.callGo(inst)
+
+		default:
+			panic(fmt.Sprintf("unexpected instruction: %s", inst))
+		}
+
+		if pc <= i {
+			interp.profile(m) // Loop back-edge
+		}
+	}
+}
+
+func (f *interpFrame) callStatic(inst *ir.Inst) {
+	env := f.env
+	method := env.vm.methodByID(inst.Args[0].SymbolID())
+
+	// Callee frame goes right after the caller frame and
+	// the extra slot that is used to store the return address.
+	calleeFP := f.fp + f.frameSlots + 1
+	env.checkStackLimit(calleeFP + len(inst.Args))
+	for i, arg := range inst.Args[1:] {
+		slot := &env.slots[calleeFP+i]
+		if arg.Type == ir.TypeRef {
+			*slot = stackSlot{ptr: f.ref(arg)}
+		} else {
+			*slot = stackSlot{scalar: f.scalar(arg)}
+		}
+	}
+
+	var result stackSlot
+	if m, entry := env.vm.methodEntry(method); m != nil {
+		result = env.interpret(m, calleeFP)
+	} else {
+		stack := env.stack
+		env.stack = &env.slots[calleeFP-1]
+		jcallScalar(env, entry)
+		env.stack = stack
+		result = env.slots[calleeFP-1]
+		if inst.Dst.Type == ir.TypeRef {
+			// Machine code returns references as scalars.
+			result.ptr = *(**Object)(unsafe.Pointer(&result.scalar))
+		}
+	}
+
+	if inst.Dst.Kind == 0 {
+		return
+	}
+	if inst.Dst.Type == ir.TypeRef {
+		f.setRef(inst.Dst, result.ptr)
+	} else {
+		f.setScalar(inst.Dst, result.scalar)
+	}
+}
+
+func (f *interpFrame) callGo(inst *ir.Inst) {
+	st := &f.env.vm.State
+	sym := inst.Args[0].SymbolID()
+	pkg := st.Packages[sym.PackageIndex()]
+	class := pkg.Classes[sym.ClassIndex()]
+	method := class.Methods[sym.MemberIndex()]
+	key := fmt.Sprintf("%s/%s.%s", pkg.Name, class.Name, method.Name)
+	fn := st.GoFuncValues[key]
+	if fn == nil {
+		panic(fmt.Sprintf("Go func %s is not bound", key))
+	}
+
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	args := inst.Args[1:]
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		in[i] = f.goValue(fnType.In(i), arg)
+	}
+	out := fnValue.Call(in)
+	if inst.Dst.Kind == 0 {
+		return
+	}
+
+	// We don't need to look at the descriptor here:
+	// Go func result type tells how to convert it.
+	switch v := out[0]; v.Kind() {
+	case reflect.Ptr, reflect.UnsafePointer:
+		f.setRef(inst.Dst, (*Object)(unsafe.Pointer(v.Pointer())))
+	case reflect.Bool:
+		if v.Bool() {
+			f.setScalar(inst.Dst, 1)
+		} else {
+			f.setScalar(inst.Dst, 0)
+		}
+	case reflect.Uint16:
+		f.setScalar(inst.Dst, int64(v.Uint()))
+	case reflect.Float32:
+		f.setFloat(inst.Dst, float32(v.Float()))
+	case reflect.Float64:
+		f.setDouble(inst.Dst, v.Float())
+	default:
+		f.setScalar(inst.Dst, v.Int())
+	}
+}
+
+// goValue converts arg to a Go value of the specified type.
+func (f *interpFrame) goValue(typ reflect.Type, arg ir.Arg) reflect.Value {
+	v := reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.Ptr:
+		if ptr := f.ref(arg); ptr != nil {
+			v.Set(reflect.NewAt(typ.Elem(), unsafe.Pointer(ptr)))
+		}
+	case reflect.UnsafePointer:
+		v.SetPointer(unsafe.Pointer(f.ref(arg)))
+	case reflect.Bool:
+		v.SetBool(f.int(arg) != 0)
+	case reflect.Uint16:
+		v.SetUint(uint64(uint16(f.int(arg))))
+	case reflect.Float32:
+		v.SetFloat(float64(f.float(arg)))
+	case reflect.Float64:
+		v.SetFloat(f.double(arg))
+	default:
+		v.SetInt(f.scalar(arg))
+	}
+	return v
+}
+
+// checkStackLimit panics if there are less than n stack slots.
+func (env *Env) checkStackLimit(n int) {
+	if n >= len(env.slots) {
+		// TODO(quasilyte): provide JVM stack trace info.
+		panic("stack limit reached")
+	}
+}
+
+func (f *interpFrame) slot(arg ir.Arg) *stackSlot {
+	return &f.env.slots[f.fp+int(arg.Value)]
+}
+
+func (f *interpFrame) scalar(arg ir.Arg) int64 {
+	if arg.Kind == ir.ArgReg {
+		return f.slot(arg).scalar
+	}
+	return arg.Value
+}
+
+func (f *interpFrame) int(arg ir.Arg) int32 { return int32(f.scalar(arg)) }
+
+func (f *interpFrame) float(arg ir.Arg) float32 {
+	return math.Float32frombits(uint32(f.scalar(arg)))
+}
+
+func (f *interpFrame) double(arg ir.Arg) float64 {
+	return math.Float64frombits(uint64(f.scalar(arg)))
+}
+
+func (f *interpFrame) ref(arg ir.Arg) *Object {
+	if arg.Kind == ir.ArgReg {
+		return f.slot(arg).ptr
+	}
+	return nil // Null constant
+}
+
+func (f *interpFrame) setScalar(dst ir.Arg, v int64) { f.slot(dst).scalar = v }
+
+func (f *interpFrame) setInt(dst ir.Arg, v int32) { f.setScalar(dst, int64(v)) }
+
+func (f *interpFrame) setFloat(dst ir.Arg, v float32) {
+	f.setScalar(dst, int64(math.Float32bits(v)))
+}
+
+func (f *interpFrame) setDouble(dst ir.Arg, v float64) {
+	f.setScalar(dst, int64(math.Float64bits(v)))
+}
+
+func (f *interpFrame) setRef(dst ir.Arg, v *Object) { f.slot(dst).ptr = v }
+
+func compareInt64(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// float2int implements Java floating point to int conversion rules:
+// NaN is converted to 0, out of range values are saturated.
+func float2int(v float64) int32 {
+	switch {
+	case v != v:
+		return 0
+	case v >= math.MaxInt32:
+		return math.MaxInt32
+	case v <= math.MinInt32:
+		return math.MinInt32
+	default:
+		return int32(v)
+	}
+}
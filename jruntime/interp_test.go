@@ -0,0 +1,256 @@
+package jruntime
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/quasilyte/go-jdk/iropt"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+func TestInterpreterDiff(t *testing.T) {
+	// Every method is executed by the JIT-compiled code, the code
+	// optimized by the default pipeline and the interpreter,
+	// their results should be identical.
+	const src = `
+method clamp(I)I
+  r1:int = Iload r0:int
+  flags = Icmp r1 -100
+  JumpGtEq @checkMax flags
+  r1 = Iload -100
+checkMax:
+  flags = Icmp r1 100
+  JumpLtEq @done flags
+  r1 = Iload 100
+done:
+  Iret r1
+
+method div(I)I
+  r1:int = Iadd r0:int 1
+  r4:int = Iload 1000
+  r2:int = Idiv r4 r1
+  r3:int = Imul r2 r0
+  r3 = Ineg r3
+  Iret r3
+
+method i2b(I)I
+  r3:int = Iload 37
+  r1:int = Imul r0:int r3
+  r2:int = ConvI2B r1
+  Iret r2
+
+method i2l(I)I
+  r1:long = ConvI2L r0:int
+  r2:long = Lneg r1
+  Lret r2
+
+method sq(I)I
+  r1:int = Imul r0:int r0
+  Iret r1
+
+method sumsq(I)I
+  r1:int = Iload 0
+  r2:int = Iload 0
+loop:
+  flags = Icmp r2 r0:int
+  JumpGtEq @done flags
+  r3:int = CallStatic test/T.sq(I)I r2
+  r1 = Iadd r1 r3
+  r2 = Iadd r2 1
+  Jump @loop
+done:
+  Iret r1
+
+method switch(I)I
+  Switch r0:int @default 1 @one 2 @two 3 @three 5 @five
+default:
+  Iret -1
+one:
+  Iret 10
+two:
+  Iret 20
+three:
+  Iret 30
+five:
+  Iret 50
+`
+
+	decls := []vmdat.Method{
+		{Name: "clamp", Descriptor: "(I)I"},
+		{Name: "div", Descriptor: "(I)I"},
+		{Name: "i2b", Descriptor: "(I)I"},
+		{Name: "i2l", Descriptor: "(I)I"},
+		{Name: "sq", Descriptor: "(I)I"},
+		{Name: "sumsq", Descriptor: "(I)I"},
+		{Name: "switch", Descriptor: "(I)I"},
+	}
+
+	jitVM, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jitVM.Close()
+	jitClass := compileTestClass(t, jitVM, append([]vmdat.Method(nil), decls...), src)
+	for i, m := range jitClass.Methods {
+		if jitVM.interp.methods[&jitClass.Methods[i]] != nil {
+			t.Errorf("%s is interpreted by JIT VM", m.Name)
+		}
+	}
+
+	optVM, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer optVM.Close()
+	optClass := compileOptimizedTestClass(t, optVM, append([]vmdat.Method(nil), decls...), src,
+		&iropt.Config{Debug: true})
+
+	interpVM, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer interpVM.Close()
+	interpVM.Compiler = interpVM.Interpreter()
+	interpClass := compileTestClass(t, interpVM, append([]vmdat.Method(nil), decls...), src)
+
+	inputs := []int64{-1000, -129, -100, -5, -1, 0, 1, 2, 3, 4, 5, 6, 99, 100, 300, 1 << 20}
+	for i := range decls {
+		jitMethod := &jitClass.Methods[i]
+		interpMethod := &interpClass.Methods[i]
+		if interpMethod.Code != nil {
+			t.Errorf("%s has machine code in interpreter VM", interpMethod.Name)
+		}
+		for _, n := range inputs {
+			if decls[i].Name == "div" && n == -1 {
+				continue // Division by zero
+			}
+			have := callTestMethod(t, interpVM, interpMethod, n)
+			want := callTestMethod(t, jitVM, jitMethod, n)
+			opt := callTestMethod(t, optVM, &optClass.Methods[i], n)
+			if decls[i].Name != "i2l" {
+				// Int results are only defined by the lower 32 bits.
+				have = int64(int32(have))
+				want = int64(int32(want))
+				opt = int64(int32(opt))
+			}
+			if have != want {
+				t.Errorf("%s(%d): interpreter %d, JIT %d", decls[i].Name, n, have, want)
+			}
+			if opt != want {
+				t.Errorf("%s(%d): optimized %d, JIT %d", decls[i].Name, n, opt, want)
+			}
+		}
+	}
+}
+
+func TestInterpreterFallback(t *testing.T) {
+	// JIT compilers don't support Ladd. Methods that use it are
+	// interpreted. The x64 machine code calls them through the stubs,
+	// other JIT compilers interpret their callers as well.
+	const src = `
+method caller(I)I
+  r1:int = CallStatic test/T.middle(I)I r0:int
+  Iret r1
+
+method ladd(I)I
+  r1:long = ConvI2L r0:int
+  r2:long = Ladd r1 r1
+  r3:int = ConvL2I r2
+  Iret r3
+
+method middle(I)I
+  r1:int = CallStatic test/T.ladd(I)I r0:int
+  r2:int = CallStatic test/T.sq(I)I r1
+  Iret r2
+
+method sq(I)I
+  r1:int = Imul r0:int r0
+  Iret r1
+`
+
+	vm, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	class := compileTestClass(t, vm, []vmdat.Method{
+		{Name: "caller", Descriptor: "(I)I"},
+		{Name: "ladd", Descriptor: "(I)I"},
+		{Name: "middle", Descriptor: "(I)I"},
+		{Name: "sq", Descriptor: "(I)I"},
+	}, src)
+
+	_, interpOnly := vm.Compiler.(*Interpreter)
+	for i, m := range class.Methods {
+		interpreted := vm.interp.methods[&class.Methods[i]] != nil
+		wantInterpreted := m.Name != "sq" || interpOnly
+		if runtime.GOARCH == "amd64" {
+			wantInterpreted = m.Name == "ladd"
+		}
+		if interpreted != wantInterpreted {
+			t.Errorf("%s: interpreted=%v, want %v", m.Name, interpreted, wantInterpreted)
+		}
+	}
+
+	caller := class.FindMethod("caller", "(I)I")
+	for _, n := range []int64{0, 1, 3, 100} {
+		have := int32(callTestMethod(t, vm, caller, n))
+		if want := int32(4 * n * n); have != want {
+			t.Errorf("caller(%d): have %d, want %d", n, have, want)
+		}
+	}
+}
+
+func TestInterpreterGoCalls(t *testing.T) {
+	const src = `
+method sub(II)I
+  r2:int = Isub r0:int r1:int
+  Iret r2
+
+method sumArray(I)I
+  r1:ref = NewIntArray env r0:int
+  r2:int = Iload 0
+fill:
+  flags = Icmp r2 r0
+  JumpGtEq @sum flags
+  r3:int = CallGo test/T.sub(II)I r2 -1
+  IntArraySet r1 r2 r3
+  r2 = Iadd r2 1
+  Jump @fill
+sum:
+  r4:int = Iload 0
+  r5:int = ArrayLen r1
+  r6:int = Iload 0
+loop:
+  flags = Icmp r6 r5
+  JumpGtEq @done flags
+  r7:int = IntArrayGet r1 r6
+  r4 = Iadd r4 r7
+  r6 = Iadd r6 1
+  Jump @loop
+done:
+  Iret r4
+`
+
+	vm, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	vm.Compiler = vm.Interpreter()
+	vm.State.BindGoFunc("test/T.sub", func(x, y int32) int32 {
+		return x - y
+	})
+	class := compileTestClass(t, vm, []vmdat.Method{
+		{Name: "sub", Descriptor: "(II)I"},
+		{Name: "sumArray", Descriptor: "(I)I"},
+	}, src)
+
+	sumArray := class.FindMethod("sumArray", "(I)I")
+	for _, n := range []int64{0, 1, 10} {
+		have := callTestMethod(t, vm, sumArray, n)
+		if want := n * (n + 1) / 2; have != want {
+			t.Errorf("sumArray(%d): have %d, want %d", n, have, want)
+		}
+	}
+}
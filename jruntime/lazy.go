@@ -0,0 +1,89 @@
+package jruntime
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/quasilyte/go-jdk/jit"
+	"github.com/quasilyte/go-jdk/symbol"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+// EnableLazyCompilation makes the VM compiler defer the method
+// compilation until the method is called for the first time.
+//
+// Call sites of the deferred methods go through the stubs that
+// compile the callee, patch the call site and continue the call.
+// Methods that can't be compiled are interpreted.
+func (vm *VM) EnableLazyCompilation() error {
+	if vm.lazy != nil {
+		return errors.New("lazy compilation is already enabled")
+	}
+	lc, ok := vm.Compiler.(jit.LazyCompiler)
+	if !ok {
+		return errors.New("lazy compilation is not supported by the VM compiler")
+	}
+	lc.EnableLazy()
+	vm.lazy = lc
+	return nil
+}
+
+// methodEntry returns the way m should be executed.
+// If m is interpreted, its interpreter method is returned.
+// Otherwise, a pointer to its machine code is returned.
+//
+// Deferred methods are compiled by this function.
+// It's safe to call methodEntry from the concurrently running Envs.
+func (vm *VM) methodEntry(m *vmdat.Method) (*interpMethod, *byte) {
+	vm.lazyMu.Lock()
+	defer vm.lazyMu.Unlock()
+	if code := vm.interp.methods[m]; code != nil {
+		return code, nil
+	}
+	if vm.lazy != nil && len(m.Code) == 0 {
+		if err := vm.lazy.CompileLazy(m.ID); err != nil {
+			panic(fmt.Sprintf("compile %s%s: %v", m.Name, m.Descriptor, err))
+		}
+		// Compiler falls back to the interpreter for the
+		// methods it can't handle.
+		if code := vm.interp.methods[m]; code != nil {
+			return code, nil
+		}
+	}
+	return nil, methodCode(m)
+}
+
+func methodCode(m *vmdat.Method) *byte {
+	if len(m.Code) == 0 {
+		panic(fmt.Sprintf("calling a method without code: %s%s", m.Name, m.Descriptor))
+	}
+	return &m.Code[0]
+}
+
+// resolveMethod is called by the machine code through the
+// deferred method stub when the method is called for the first time.
+//
+// Callee frame address is stored in env tmp.
+// If the method is compiled, its machine code address is returned,
+// so the stub can jump to it. Otherwise the method is interpreted
+// and the stub returns its result to the caller.
+func resolveMethod(env *Env, id uint64) (code uintptr, result int64) {
+	m := env.vm.methodByID(symbol.ID(id))
+	interpMethod, entry := env.vm.methodEntry(m)
+	if interpMethod == nil {
+		return uintptr(unsafe.Pointer(entry)), 0
+	}
+
+	// Interpreted code can call the machine code that
+	// uses env tmp, so it's restored before returning.
+	tmp := env.tmp
+	offset := uintptr(tmp) - uintptr(unsafe.Pointer(&env.slots[0]))
+	slot := env.interpret(interpMethod, int(offset/unsafe.Sizeof(stackSlot{})))
+	env.tmp = tmp
+	if slot.ptr != nil {
+		// Machine code expects references to be returned as scalars.
+		return 0, int64(uintptr(unsafe.Pointer(slot.ptr)))
+	}
+	return 0, slot.scalar
+}
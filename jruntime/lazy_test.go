@@ -0,0 +1,320 @@
+package jruntime
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/quasilyte/go-jdk/bytecode"
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/irgen"
+	"github.com/quasilyte/go-jdk/jclass"
+	"github.com/quasilyte/go-jdk/jclass/jclasstest"
+	"github.com/quasilyte/go-jdk/jit"
+	"github.com/quasilyte/go-jdk/loader"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+func TestLazyCompilation(t *testing.T) {
+	// JIT compilers don't support Ladd, so ladd is interpreted
+	// when it's called through its stub. It calls sq that is
+	// compiled on its first call from the interpreter.
+	const src = `
+method caller(I)I
+  r1:int = CallStatic test/T.middle(I)I r0:int
+  r2:int = CallStatic test/T.middle(I)I r1
+  Iret r2
+
+method cold(I)I
+  r1:int = Iadd r0:int 1
+  Iret r1
+
+method ladd(I)I
+  r1:long = ConvI2L r0:int
+  r2:long = Ladd r1 r1
+  r3:int = ConvL2I r2
+  r4:int = CallStatic test/T.sq(I)I r3
+  Iret r4
+
+method middle(I)I
+  r1:int = CallStatic test/T.ladd(I)I r0:int
+  r2:int = Iadd r1 1
+  Iret r2
+
+method sq(I)I
+  r1:int = Imul r0:int r0
+  Iret r1
+`
+
+	vm, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.EnableLazyCompilation(); err != nil {
+		t.Skipf("no lazy compilation: %v", err)
+	}
+	class := compileTestClass(t, vm, []vmdat.Method{
+		{Name: "caller", Descriptor: "(I)I"},
+		{Name: "cold", Descriptor: "(I)I"},
+		{Name: "ladd", Descriptor: "(I)I"},
+		{Name: "middle", Descriptor: "(I)I"},
+		{Name: "sq", Descriptor: "(I)I"},
+	}, src)
+	for i := range class.Methods {
+		if class.Methods[i].Code != nil {
+			t.Fatalf("%s is compiled during the load", class.Methods[i].Name)
+		}
+	}
+
+	middle := func(x int32) int32 { return (2*x)*(2*x) + 1 }
+	caller := class.FindMethod("caller", "(I)I")
+	for _, n := range []int32{0, 1, 2, 3} {
+		// The first call compiles the methods, the next
+		// calls use the patched call sites.
+		for i := 0; i < 2; i++ {
+			have := int32(callTestMethod(t, vm, caller, int64(n)))
+			if want := middle(middle(n)); have != want {
+				t.Fatalf("caller(%d): have %d, want %d", n, have, want)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		compiled    bool
+		interpreted bool
+	}{
+		{"caller", true, false},
+		{"cold", false, false},
+		{"ladd", false, true},
+		{"middle", true, false},
+		{"sq", true, false},
+	} {
+		m := class.FindMethod(test.name, "(I)I")
+		compiled := len(m.Code) != 0
+		interpreted := vm.interp.methods[m] != nil
+		if compiled != test.compiled || interpreted != test.interpreted {
+			t.Errorf("%s: compiled=%v interpreted=%v, want %v and %v",
+				test.name, compiled, interpreted, test.compiled, test.interpreted)
+		}
+	}
+}
+
+func TestLazyCompilationConcurrent(t *testing.T) {
+	// Every method is called for the first time
+	// by several Envs running concurrently.
+	// ladd is interpreted, it's called by the machine code
+	// through its stub and by the Envs directly.
+	const numMethods = 8
+	src := `
+method ladd(I)I
+  r1:long = ConvI2L r0:int
+  r2:long = Ladd r1 r1
+  r3:int = ConvL2I r2
+  Iret r3
+
+method sum(I)I
+  r1:int = CallStatic test/T.ladd(I)I r0:int
+`
+	var decls []vmdat.Method
+	for i := 0; i < numMethods; i++ {
+		name := fmt.Sprintf("f%d", i)
+		decls = append(decls, vmdat.Method{Name: name, Descriptor: "(I)I"})
+		src += fmt.Sprintf("  r2:int = CallStatic test/T.%s(I)I r0:int\n", name)
+		src += "  r1 = Iadd r1 r2\n"
+	}
+	src += "  Iret r1\n"
+	for i := 0; i < numMethods; i++ {
+		src += fmt.Sprintf(`
+method f%d(I)I
+  r1:int = Iadd r0:int %d
+  Iret r1
+`, i, i)
+	}
+	decls = append(decls,
+		vmdat.Method{Name: "ladd", Descriptor: "(I)I"},
+		vmdat.Method{Name: "sum", Descriptor: "(I)I"})
+
+	vm, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.EnableLazyCompilation(); err != nil {
+		t.Skipf("no lazy compilation: %v", err)
+	}
+	class := compileTestClass(t, vm, decls, src)
+	ladd := class.FindMethod("ladd", "(I)I")
+	sum := class.FindMethod("sum", "(I)I")
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(n int64) {
+			defer wg.Done()
+			env := NewEnv(vm, &EnvConfig{StackMemory: 64 * 1024})
+			for i := 0; i < 100; i++ {
+				for _, call := range []struct {
+					m    *vmdat.Method
+					want int64
+				}{
+					{ladd, 2 * n},
+					{sum, 2*n + numMethods*n + numMethods*(numMethods-1)/2},
+				} {
+					env.IntArg(0, n)
+					have, err := env.IntCall(call.m)
+					if err != nil {
+						t.Errorf("%s(%d): %v", call.m.Name, n, err)
+						return
+					}
+					if have != call.want {
+						t.Errorf("%s(%d): have %d, want %d", call.m.Name, n, have, call.want)
+						return
+					}
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+
+	if vm.interp.methods[ladd] == nil {
+		t.Errorf("ladd is not interpreted")
+	}
+}
+
+func TestLazyIR(t *testing.T) {
+	// Methods are decoded, verified and converted to IR
+	// on their first call, so cold code is never decoded.
+	filename := filepath.Join(t.TempDir(), "Foo.class")
+	if err := ioutil.WriteFile(filename, encodeLazyTestClass(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.EnableLazyCompilation(); err != nil {
+		t.Skipf("no lazy compilation: %v", err)
+	}
+	packages, err := loader.LoadClass(&vm.State, filename, &loader.Config{LazyCode: true})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := irgen.Generate(&vm.State, packages, &irgen.Config{Lazy: true}); err != nil {
+		t.Fatalf("irgen: %v", err)
+	}
+	ctx := jit.Context{Mmap: &vm.Mmap, State: &vm.State}
+	BindFuncs(&ctx)
+	ctx.GenerateIR = func(p *ir.Package) error {
+		return irgen.Generate(&vm.State, []*ir.Package{p}, &irgen.Config{Debug: true})
+	}
+	if err := vm.Compiler.Compile(ctx, packages); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	f := packages[0].Classes[0].File
+	isDecoded := func(name string) bool {
+		for _, m := range f.Methods {
+			if m.Name == name {
+				return m.Attrs[0].(jclass.LazyCodeAttribute).IsDecoded()
+			}
+		}
+		t.Fatalf("method %s not found", name)
+		return false
+	}
+	for _, name := range []string{"callee", "caller", "cold"} {
+		if isDecoded(name) {
+			t.Fatalf("%s is decoded during the load", name)
+		}
+	}
+
+	class := packages[0].Out.FindClass("Foo")
+	if have := callTestMethod(t, vm, class.FindMethod("caller", "()I"), 0); have != 2 {
+		t.Fatalf("caller(): have %d, want 2", have)
+	}
+	for _, test := range []struct {
+		name    string
+		decoded bool
+	}{
+		{"callee", true},
+		{"caller", true},
+		{"cold", false},
+	} {
+		compiled := len(class.FindMethod(test.name, "()I").Code) != 0
+		if decoded := isDecoded(test.name); decoded != test.decoded || compiled != test.decoded {
+			t.Errorf("%s: decoded=%v compiled=%v, want %v", test.name, decoded, compiled, test.decoded)
+		}
+	}
+}
+
+// encodeLazyTestClass returns a "Foo" class file that is equivalent to:
+//
+//	class Foo {
+//	    static int caller() { return callee() + 1; }
+//	    static int callee() { return 1; }
+//	    static int cold() { return 2; }
+//	}
+func encodeLazyTestClass() []byte {
+	w := jclasstest.NewWriter()
+	method := func(name uint16, code ...byte) {
+		w.U2(0x0009) // access_flags
+		w.U2(name)
+		w.U2(8) // descriptor_index
+		w.U2(1) // attributes_count
+		w.Attr("code", 9, func() {
+			w.U2(2) // max_stack
+			w.U2(0) // max_locals
+			w.U4(uint32(len(code)))
+			w.Bytes(code)
+			w.U2(0) // exception_table_length
+			w.U2(0) // attributes_count
+		})
+	}
+
+	w.U4(0xCAFEBABE)
+	w.U2(0)  // minor_version
+	w.U2(52) // major_version
+
+	w.U2(12)                   // constant_pool_count
+	w.Utf8("Foo")              // #1
+	w.U1(7)                    // #2 Class
+	w.U2(1)                    //
+	w.Utf8("java/lang/Object") // #3
+	w.U1(7)                    // #4 Class
+	w.U2(3)                    //
+	w.Utf8("caller")           // #5
+	w.Utf8("callee")           // #6
+	w.Utf8("cold")             // #7
+	w.Utf8("()I")              // #8
+	w.Utf8("Code")             // #9
+	w.U1(12)                   // #10 NameAndType
+	w.U2(6)                    //
+	w.U2(8)                    //
+	w.U1(10)                   // #11 Methodref
+	w.U2(2)                    //
+	w.U2(10)                   //
+
+	w.U2(0x0021) // access_flags
+	w.U2(2)      // this_class
+	w.U2(4)      // super_class
+	w.U2(0)      // interfaces_count
+	w.U2(0)      // fields_count
+
+	w.U2(3) // methods_count
+	method(5,
+		byte(bytecode.Invokestatic), 0, 11,
+		byte(bytecode.Iconst1),
+		byte(bytecode.Iadd),
+		byte(bytecode.Ireturn))
+	method(6, byte(bytecode.Iconst1), byte(bytecode.Ireturn))
+	method(7, byte(bytecode.Iconst2), byte(bytecode.Ireturn))
+
+	w.U2(0) // attributes_count
+	return w.Buf
+}
@@ -0,0 +1,183 @@
+package jruntime
+
+import (
+	"errors"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/iropt"
+	"github.com/quasilyte/go-jdk/jit"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+// TieringConfig describes the tiered compilation settings.
+type TieringConfig struct {
+	// HotThreshold is a number of method invocations and loop iterations
+	// after which the method is compiled to machine code.
+	//
+	// Zero value means "default value".
+	HotThreshold int
+
+	// Optimize is used to optimize the hot methods before compiling them.
+	//
+	// Nil value means "default optimization pipeline".
+	Optimize *iropt.Config
+}
+
+// EnableTiering turns on the tiered compilation.
+//
+// All methods are interpreted when they are loaded, the interpreter
+// counts their invocations and loop iterations. Hot methods are optimized
+// and compiled to machine code by the VM compiler.
+// After that, they're executed as machine code.
+func (vm *VM) EnableTiering(cfg *TieringConfig) error {
+	if vm.Compiler == vm.interp {
+		return errors.New("tiering requires a JIT compiler")
+	}
+	if _, ok := vm.Compiler.(*tieredCompiler); ok {
+		return errors.New("tiering is already enabled")
+	}
+	if vm.lazy != nil {
+		return errors.New("tiering can't be combined with the lazy compilation")
+	}
+
+	const defaultHotThreshold = 1000
+
+	tc := &tieredCompiler{
+		vm:       vm,
+		jit:      vm.Compiler,
+		optimize: cfg.Optimize,
+		rejected: make(map[*vmdat.Method]bool),
+	}
+	if tc.optimize == nil {
+		tc.optimize = &iropt.Config{}
+	}
+	vm.interp.hot = tc.compileHot
+	vm.interp.hotThreshold = cfg.HotThreshold
+	if vm.interp.hotThreshold == 0 {
+		vm.interp.hotThreshold = defaultHotThreshold
+	}
+	vm.Compiler = tc
+	return nil
+}
+
+// tieredCompiler uses the interpreter as a baseline tier.
+// Hot methods are recompiled by the JIT compiler.
+type tieredCompiler struct {
+	vm       *VM
+	jit      jit.Compiler
+	optimize *iropt.Config
+
+	// The fields below are guarded by the vm lazyMu.
+
+	// ctx is saved during Compile to be used for the hot methods.
+	ctx jit.Context
+
+	// rejected methods are never compiled, they stay interpreted.
+	rejected map[*vmdat.Method]bool
+}
+
+func (tc *tieredCompiler) Compile(ctx jit.Context, packages []*ir.Package) error {
+	tc.vm.lazyMu.Lock()
+	defer tc.vm.lazyMu.Unlock()
+	tc.ctx = ctx
+	return tc.vm.interp.Compile(ctx, packages)
+}
+
+// compileHot compiles m and all interpreted methods it calls,
+// even if some of them are not hot.
+//
+// Methods that can't be compiled stay interpreted. Depending on
+// the JIT compiler, their callers either call them through the
+// stubs or stay interpreted as well.
+// Hot methods can be reported by the concurrently running Envs,
+// they're compiled one at a time.
+func (tc *tieredCompiler) compileHot(m *vmdat.Method) {
+	tc.vm.lazyMu.Lock()
+	defer tc.vm.lazyMu.Unlock()
+	if tc.rejected[m] {
+		return
+	}
+
+	interp := tc.vm.interp
+	var methods []*vmdat.Method
+	queued := map[*vmdat.Method]bool{m: true}
+	for queue := []*vmdat.Method{m}; len(queue) != 0; {
+		method := queue[0]
+		queue = queue[1:]
+		// Rejected callees are passed to the JIT compiler as well,
+		// so it can link their call sites.
+		methods = append(methods, method)
+		for _, inst := range interp.methods[method].ir.Code {
+			if inst.Kind != ir.InstCallStatic {
+				continue
+			}
+			callee := tc.vm.methodByID(inst.Args[0].SymbolID())
+			if interp.methods[callee] == nil || queued[callee] {
+				continue
+			}
+			queued[callee] = true
+			queue = append(queue, callee)
+		}
+	}
+
+	// Interpreted code can still be running, so the
+	// optimizer works with the copies of the methods.
+	frameSlots := make([]int, len(methods))
+	packages := make([]*ir.Package, len(methods))
+	for i, method := range methods {
+		frameSlots[i] = method.FrameSlots
+		packages[i] = tc.newPackage(cloneMethod(interp.methods[method].ir))
+	}
+	restore := func() {
+		for i, method := range methods {
+			method.FrameSlots = frameSlots[i]
+			tc.rejected[method] = true
+		}
+	}
+
+	if _, err := iropt.Optimize(&tc.vm.State, packages, tc.optimize); err != nil {
+		restore()
+		return
+	}
+	// Compiler falls back to the interpreter for the methods
+	// it can't compile. They're registered with their new code.
+	if err := tc.jit.Compile(tc.ctx, packages); err != nil {
+		restore()
+		return
+	}
+	for _, method := range methods {
+		if len(method.Code) != 0 {
+			delete(interp.methods, method)
+		} else {
+			tc.rejected[method] = true
+		}
+	}
+}
+
+// newPackage returns a package that contains m as its only method.
+func (tc *tieredCompiler) newPackage(m ir.Method) *ir.Package {
+	id := m.Out.ID
+	pkg := tc.vm.State.Packages[id.PackageIndex()]
+	class := &pkg.Classes[id.ClassIndex()]
+	return &ir.Package{
+		Out: pkg,
+		Classes: []ir.Class{{
+			Name:    class.Name,
+			Out:     class,
+			Methods: []ir.Method{m},
+		}},
+	}
+}
+
+// cloneMethod returns a deep copy of m.
+// Both methods refer to the same out method.
+func cloneMethod(m *ir.Method) ir.Method {
+	clone := *m
+	clone.CodeOffsets = nil
+	clone.Code = make([]ir.Inst, len(m.Code))
+	for i, inst := range m.Code {
+		inst.Args = append([]ir.Arg(nil), inst.Args...)
+		clone.Code[i] = inst
+	}
+	return clone
+}
@@ -0,0 +1,288 @@
+package jruntime
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/quasilyte/go-jdk/ir"
+	"github.com/quasilyte/go-jdk/irfmt"
+	"github.com/quasilyte/go-jdk/iropt"
+	"github.com/quasilyte/go-jdk/jit"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+func TestTiering(t *testing.T) {
+	const src = `
+method cold(I)I
+  r1:int = Iadd r0:int 1
+  Iret r1
+
+method ladd(I)I
+  r1:long = ConvI2L r0:int
+  r2:long = Ladd r1 r1
+  r3:int = ConvL2I r2
+  Iret r3
+
+method sq(I)I
+  r1:int = Imul r0:int r0
+  Iret r1
+
+method sumsq(I)I
+  r1:int = Iload 0
+  r2:int = Iload 0
+loop:
+  flags = Icmp r2 r0:int
+  JumpGtEq @done flags
+  r3:int = CallStatic test/T.sq(I)I r2
+  r1 = Iadd r1 r3
+  r2 = Iadd r2 1
+  Jump @loop
+done:
+  Iret r1
+`
+
+	vm, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.EnableTiering(&TieringConfig{HotThreshold: 20}); err != nil {
+		t.Skipf("no tiering: %v", err)
+	}
+	class := compileTestClass(t, vm, []vmdat.Method{
+		{Name: "cold", Descriptor: "(I)I"},
+		{Name: "ladd", Descriptor: "(I)I"},
+		{Name: "sq", Descriptor: "(I)I"},
+		{Name: "sumsq", Descriptor: "(I)I"},
+	}, src)
+	for i := range class.Methods {
+		if class.Methods[i].Code != nil {
+			t.Fatalf("%s is compiled during the load", class.Methods[i].Name)
+		}
+	}
+
+	sumsq := class.FindMethod("sumsq", "(I)I")
+	ladd := class.FindMethod("ladd", "(I)I")
+	cold := class.FindMethod("cold", "(I)I")
+	for n := int64(0); n < 30; n++ {
+		want := int64(0)
+		for i := int64(0); i < n; i++ {
+			want += i * i
+		}
+		if have := callTestMethod(t, vm, sumsq, n); int32(have) != int32(want) {
+			t.Fatalf("sumsq(%d): have %d, want %d", n, int32(have), want)
+		}
+		if have := callTestMethod(t, vm, ladd, n); int32(have) != int32(2*n) {
+			t.Fatalf("ladd(%d): have %d, want %d", n, int32(have), 2*n)
+		}
+	}
+	if have := callTestMethod(t, vm, cold, 1); have != 2 {
+		t.Fatalf("cold(1): have %d, want 2", have)
+	}
+
+	for _, test := range []struct {
+		name     string
+		compiled bool
+	}{
+		{"cold", false},
+		{"ladd", false}, // Can't be compiled, stays interpreted
+		{"sq", true},
+		{"sumsq", true},
+	} {
+		m := class.FindMethod(test.name, "(I)I")
+		compiled := vm.interp.methods[m] == nil && len(m.Code) != 0
+		if compiled != test.compiled {
+			t.Errorf("%s: compiled=%v, want %v", test.name, compiled, test.compiled)
+		}
+	}
+}
+
+func TestTieringOptimize(t *testing.T) {
+	// Hot methods are optimized before the compilation:
+	// dead values don't occupy the frame slots anymore.
+	const src = `
+method f(I)I
+  r1:int = Iadd r0:int 1
+  r2:int = Imul r1 r1
+  r3:int = Iadd r2 r0
+  r4:int = Isub r3 r1
+  r5:int = Iadd r0 r0
+  Iret r5
+`
+
+	for _, test := range []struct {
+		optimize   *iropt.Config
+		frameSlots int
+	}{
+		{nil, 2},
+		{&iropt.Config{Passes: []string{}}, 6},
+	} {
+		vm, err := OpenVM(runtime.GOARCH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer vm.Close()
+		err = vm.EnableTiering(&TieringConfig{HotThreshold: 5, Optimize: test.optimize})
+		if err != nil {
+			t.Skipf("no tiering: %v", err)
+		}
+		class := compileTestClass(t, vm, []vmdat.Method{{Name: "f", Descriptor: "(I)I"}}, src)
+		f := class.FindMethod("f", "(I)I")
+		for i := 0; i < 10; i++ {
+			if have := callTestMethod(t, vm, f, 3); have != 6 {
+				t.Fatalf("f(3): have %d, want 6", have)
+			}
+		}
+		if len(f.Code) == 0 {
+			t.Fatalf("f is not compiled")
+		}
+		if f.FrameSlots != test.frameSlots {
+			t.Errorf("optimize=%+v: f frame slots %d, want %d", test.optimize, f.FrameSlots, test.frameSlots)
+		}
+	}
+}
+
+func TestTieringConcurrent(t *testing.T) {
+	// Methods become hot while they're executed by several Envs.
+	const src = `
+method ladd(I)I
+  r1:long = ConvI2L r0:int
+  r2:long = Ladd r1 r1
+  r3:int = ConvL2I r2
+  Iret r3
+
+method sq(I)I
+  r1:int = Imul r0:int r0
+  Iret r1
+
+method sumsq(I)I
+  r1:int = Iload 0
+  r2:int = Iload 0
+loop:
+  flags = Icmp r2 r0:int
+  JumpGtEq @done flags
+  r3:int = CallStatic test/T.sq(I)I r2
+  r4:int = CallStatic test/T.ladd(I)I r3
+  r1 = Iadd r1 r4
+  r2 = Iadd r2 1
+  Jump @loop
+done:
+  Iret r1
+`
+
+	vm, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	// Inlined ladd would make sumsq fail to compile.
+	cfg := &TieringConfig{
+		HotThreshold: 50,
+		Optimize:     &iropt.Config{Passes: []string{"constfold", "deadcode"}},
+	}
+	if err := vm.EnableTiering(cfg); err != nil {
+		t.Skipf("no tiering: %v", err)
+	}
+	class := compileTestClass(t, vm, []vmdat.Method{
+		{Name: "ladd", Descriptor: "(I)I"},
+		{Name: "sq", Descriptor: "(I)I"},
+		{Name: "sumsq", Descriptor: "(I)I"},
+	}, src)
+	sq := class.FindMethod("sq", "(I)I")
+	sumsq := class.FindMethod("sumsq", "(I)I")
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			env := NewEnv(vm, &EnvConfig{StackMemory: 64 * 1024})
+			sum := int64(0)
+			for n := int64(0); n < 30; n++ {
+				for _, call := range []struct {
+					m    *vmdat.Method
+					want int64
+				}{
+					{sq, n * n},
+					{sumsq, sum},
+				} {
+					env.IntArg(0, n)
+					have, err := env.IntCall(call.m)
+					if err != nil {
+						t.Errorf("%s(%d): %v", call.m.Name, n, err)
+						return
+					}
+					if int32(have) != int32(call.want) {
+						t.Errorf("%s(%d): have %d, want %d", call.m.Name, n, int32(have), call.want)
+						return
+					}
+				}
+				sum += 2 * n * n
+			}
+		}()
+	}
+	wg.Wait()
+
+	if vm.interp.methods[sq] != nil || len(sq.Code) == 0 {
+		t.Errorf("sq is not compiled")
+	}
+	// Calls ladd that can't be compiled, through its stub on amd64.
+	if compiled := vm.interp.methods[sumsq] == nil; compiled != (runtime.GOARCH == "amd64") {
+		t.Errorf("sumsq: compiled=%v", compiled)
+	}
+}
+
+func TestRecompile(t *testing.T) {
+	// Recompiled method replaces the old code for all of its callers.
+	vm, err := OpenVM(runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if vm.Compiler == vm.Interpreter() {
+		t.Skip("no JIT compiler")
+	}
+	class := compileTestClass(t, vm, []vmdat.Method{
+		{Name: "caller", Descriptor: "(I)I"},
+		{Name: "f", Descriptor: "(I)I"},
+	}, `
+method caller(I)I
+  r1:int = CallStatic test/T.f(I)I r0:int
+  r1 = Iadd r1 1
+  Iret r1
+
+method f(I)I
+  r1:int = Iadd r0:int r0
+  Iret r1
+`)
+
+	caller := class.FindMethod("caller", "(I)I")
+	if have := callTestMethod(t, vm, caller, 10); have != 21 {
+		t.Fatalf("caller(10) before recompilation: have %d, want 21", have)
+	}
+
+	methods, err := irfmt.Parse(&vm.State, `
+method f(I)I
+  r1:int = Imul r0:int r0
+  Iret r1
+`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	f := class.FindMethod("f", "(I)I")
+	f.FrameSlots = methods[0].Out.FrameSlots
+	methods[0].Out = f
+	packages := []*ir.Package{{
+		Out:     vm.State.FindPackage("test"),
+		Classes: []ir.Class{{Name: "T", Out: class, Methods: methods}},
+	}}
+	ctx := jit.Context{Mmap: &vm.Mmap, State: &vm.State}
+	BindFuncs(&ctx)
+	if err := vm.Compiler.Compile(ctx, packages); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if have := callTestMethod(t, vm, caller, 10); have != 101 {
+		t.Fatalf("caller(10) after recompilation: have %d, want 101", have)
+	}
+}
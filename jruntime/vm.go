@@ -1,11 +1,13 @@
 package jruntime
 
 import (
-	"fmt"
+	"sync"
 
 	"github.com/quasilyte/go-jdk/jit"
+	"github.com/quasilyte/go-jdk/jit/compiler/arm64"
 	"github.com/quasilyte/go-jdk/jit/compiler/x64"
 	"github.com/quasilyte/go-jdk/mmap"
+	"github.com/quasilyte/go-jdk/symbol"
 	"github.com/quasilyte/go-jdk/vmdat"
 )
 
@@ -13,20 +15,52 @@ type VM struct {
 	State    vmdat.State
 	Mmap     mmap.Manager
 	Compiler jit.Compiler
+
+	// interp executes the methods that have no machine code.
+	interp *Interpreter
+
+	// lazy is a VM compiler, if the lazy compilation is enabled.
+	// lazyMu serializes the deferred and hot methods compilation,
+	// it also guards the interp methods map.
+	lazy   jit.LazyCompiler
+	lazyMu sync.Mutex
 }
 
+// OpenVM creates a new VM for the specified arch.
+//
+// Methods that can't be compiled to the arch machine code are interpreted.
+// If there is no JIT compiler for the arch, all methods are interpreted.
 func OpenVM(arch string) (*VM, error) {
 	var vm VM
+	vm.interp = newInterpreter()
 	switch arch {
 	case "amd64":
-		vm.Compiler = x64.NewCompiler()
+		compiler := x64.NewCompiler()
+		compiler.Fallback = vm.interp
+		vm.Compiler = compiler
+	case "arm64":
+		compiler := arm64.NewCompiler()
+		compiler.Fallback = vm.interp
+		vm.Compiler = compiler
 	default:
-		return nil, fmt.Errorf("arch %s is not supported", arch)
+		vm.Compiler = vm.interp
 	}
 	vm.State.Init()
 	return &vm, nil
 }
 
+// Interpreter returns the VM interpreter.
+//
+// It can be used as a VM compiler to make all methods interpreted.
+func (vm *VM) Interpreter() *Interpreter {
+	return vm.interp
+}
+
+func (vm *VM) methodByID(id symbol.ID) *vmdat.Method {
+	pkg := vm.State.Packages[id.PackageIndex()]
+	return &pkg.Classes[id.ClassIndex()].Methods[id.MemberIndex()]
+}
+
 // Close instructs the VM to free all associated resources.
 func (vm *VM) Close() error {
 	if err := vm.Mmap.Close(); err != nil {
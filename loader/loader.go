@@ -6,16 +6,35 @@ import (
 
 	"github.com/quasilyte/go-jdk/ir"
 	"github.com/quasilyte/go-jdk/jclass"
+	"github.com/quasilyte/go-jdk/jdeps"
 	"github.com/quasilyte/go-jdk/symbol"
 	"github.com/quasilyte/go-jdk/vmdat"
 )
 
 type Config struct {
 	ClassPath []string
+
+	// AllowPreview permits loading class files that depend
+	// on the Java SE preview features.
+	AllowPreview bool
+
+	// LazyCode defers method bodies decoding until they're
+	// requested by the IR generator.
+	// The bytecode verification is deferred as well, every
+	// method is verified right before its IR generation.
+	//
+	// Dependency packages only get the classes that are referenced
+	// by the loaded ones, other class files are not decoded.
+	LazyCode bool
+
+	// NoVerify disables the bytecode verification.
+	// Unverified code can crash the VM, so it should only
+	// be used for the trusted class files.
+	NoVerify bool
 }
 
 func LoadClass(st *vmdat.State, filename string, cfg *Config) ([]*ir.Package, error) {
-	classfile, err := decodeClassFile(filename)
+	classfile, err := decodeClassFile(filename, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -42,7 +61,10 @@ func LoadPackage(st *vmdat.State, pkgName string, cfg *Config) ([]*ir.Package, e
 }
 
 func loadPackageSet(st *vmdat.State, pkgName string, initial []*jclass.File, cfg *Config) ([]*ir.Package, error) {
-	pkg := createPackage(st, pkgName, initial)
+	pkg := createPackage(st, pkgName, initial, cfg)
+	if cfg.LazyCode {
+		return loadReferencedClasses(st, pkg, initial, cfg)
+	}
 	deps := findDependencies(st, initial)
 
 	toLoad := make([]*ir.Package, 0, len(deps)+1)
@@ -59,7 +81,7 @@ func loadPackageSet(st *vmdat.State, pkgName string, initial []*jclass.File, cfg
 		if err != nil {
 			return nil, fmt.Errorf("find %q package: %v", d, err)
 		}
-		pkg := createPackage(st, d, files)
+		pkg := createPackage(st, d, files, cfg)
 		toLoad = append(toLoad, pkg)
 		depDeps := findDependencies(st, files)
 		deps = append(deps[:len(deps)-1], depDeps...)
@@ -68,7 +90,49 @@ func loadPackageSet(st *vmdat.State, pkgName string, initial []*jclass.File, cfg
 	return toLoad, nil
 }
 
-func createPackage(st *vmdat.State, name string, files []*jclass.File) *ir.Package {
+// loadReferencedClasses loads the classes that are referenced
+// by the initial ones and the classes they refer to.
+// Their packages are created after all these classes are found,
+// so a package is never created without its referenced classes.
+func loadReferencedClasses(st *vmdat.State, pkg *ir.Package, initial []*jclass.File, cfg *Config) ([]*ir.Package, error) {
+	var pkgNames []string
+	pkgFiles := make(map[string][]*jclass.File)
+	loaded := make(map[string]bool)
+	for queue := initial; len(queue) != 0; {
+		f := queue[0]
+		queue = queue[1:]
+		for _, className := range jdeps.ClassReferences(f) {
+			_, d := splitName(className)
+			if loaded[className] || d == "" || st.FindPackage(d) != nil {
+				continue
+			}
+			if d == "java/lang" {
+				// We don't support stdlib packages yet.
+				// FIXME: remove this after we handle them properly.
+				continue
+			}
+			loaded[className] = true
+			file, err := readClassFile(className, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("find %q class: %v", className, err)
+			}
+			if pkgFiles[d] == nil {
+				pkgNames = append(pkgNames, d)
+			}
+			pkgFiles[d] = append(pkgFiles[d], file)
+			queue = append(queue, file)
+		}
+	}
+
+	toLoad := make([]*ir.Package, 0, len(pkgNames)+1)
+	toLoad = append(toLoad, pkg)
+	for _, d := range pkgNames {
+		toLoad = append(toLoad, createPackage(st, d, pkgFiles[d], cfg))
+	}
+	return toLoad, nil
+}
+
+func createPackage(st *vmdat.State, name string, files []*jclass.File, cfg *Config) *ir.Package {
 	pkg := ir.Package{Out: st.NewPackage(name)}
 
 	for _, f := range files {
@@ -87,9 +151,10 @@ func createPackage(st *vmdat.State, name string, files []*jclass.File) *ir.Packa
 			methods := make([]ir.Method, len(f.Methods))
 			className, _ := splitName(f.ThisClassName)
 			pkg.Classes = append(pkg.Classes, ir.Class{
-				Name:    className,
-				File:    f,
-				Methods: methods,
+				Name:       className,
+				File:       f,
+				Methods:    methods,
+				Unverified: cfg.LazyCode && !cfg.NoVerify,
 			})
 		}
 	}
@@ -0,0 +1,218 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/quasilyte/go-jdk/bytecode"
+	"github.com/quasilyte/go-jdk/irgen"
+	"github.com/quasilyte/go-jdk/jclass"
+	"github.com/quasilyte/go-jdk/jclass/jclasstest"
+	"github.com/quasilyte/go-jdk/vmdat"
+)
+
+func TestLazyCode(t *testing.T) {
+	// <init> has an invalid code, but it's never compiled.
+	filename := filepath.Join(t.TempDir(), "Foo.class")
+	data := encodeTestClass(map[string][]byte{
+		"<init>": {byte(bytecode.Iadd), byte(bytecode.Return)},
+		"f":      {byte(bytecode.Iconst1), byte(bytecode.Ireturn)},
+	})
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var st vmdat.State
+	st.Init()
+	_, err := LoadClass(&st, filename, &Config{})
+	if err == nil || !strings.Contains(err.Error(), "stack underflow") {
+		t.Fatalf("eager load: expected a verification error, got %v", err)
+	}
+
+	st.Init()
+	packages, err := LoadClass(&st, filename, &Config{LazyCode: true})
+	if err != nil {
+		t.Fatalf("lazy load: %v", err)
+	}
+	f := packages[0].Classes[0].File
+	isDecoded := func(name string) bool {
+		for _, m := range f.Methods {
+			if m.Name == name {
+				return m.Attrs[0].(jclass.LazyCodeAttribute).IsDecoded()
+			}
+		}
+		t.Fatalf("method %s not found", name)
+		return false
+	}
+	for _, name := range []string{"<init>", "f"} {
+		if isDecoded(name) {
+			t.Errorf("%s code is decoded during the load", name)
+		}
+	}
+
+	if err := irgen.Generate(&st, packages, &irgen.Config{}); err != nil {
+		t.Fatalf("irgen: %v", err)
+	}
+	if !isDecoded("f") {
+		t.Errorf("f code is not decoded by irgen")
+	}
+	if isDecoded("<init>") {
+		t.Errorf("<init> code is decoded, but it's never compiled")
+	}
+}
+
+func TestLazyDependencies(t *testing.T) {
+	// b/Unused is not referenced by the loaded classes,
+	// so it's only loaded with the whole b package.
+	cp := t.TempDir()
+	for name, callee := range map[string]string{
+		"a/Main":   "b/Used",
+		"b/Used":   "",
+		"b/Unused": "",
+	} {
+		filename := filepath.Join(cp, filepath.FromSlash(name)+".class")
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, encodeCallerClass(name, callee), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		lazy bool
+		want string
+	}{
+		{false, "a/Main b/Unused b/Used"},
+		{true, "a/Main b/Used"},
+	} {
+		var st vmdat.State
+		st.Init()
+		cfg := &Config{ClassPath: []string{cp}, LazyCode: test.lazy}
+		packages, err := LoadClass(&st, filepath.Join(cp, "a", "Main.class"), cfg)
+		if err != nil {
+			t.Fatalf("lazy=%v: load: %v", test.lazy, err)
+		}
+		var classes []string
+		for _, p := range packages {
+			for _, c := range p.Classes {
+				classes = append(classes, p.Out.Name+"/"+c.Name)
+			}
+		}
+		if have := strings.Join(classes, " "); have != test.want {
+			t.Errorf("lazy=%v: have %s, want %s", test.lazy, have, test.want)
+		}
+	}
+}
+
+// encodeTestClass returns a "Foo" class file that
+// contains "<init>()V" and static "f()I" methods.
+func encodeTestClass(code map[string][]byte) []byte {
+	w := jclasstest.NewWriter()
+	method := func(flags, name, descriptor uint16, code []byte) {
+		w.U2(flags)
+		w.U2(name)
+		w.U2(descriptor)
+		w.U2(1) // attributes_count
+		w.Attr("code", 9, func() {
+			w.U2(2) // max_stack
+			w.U2(1) // max_locals
+			w.U4(uint32(len(code)))
+			w.Bytes(code)
+			w.U2(0) // exception_table_length
+			w.U2(0) // attributes_count
+		})
+	}
+
+	w.U4(0xCAFEBABE)
+	w.U2(0)  // minor_version
+	w.U2(52) // major_version
+
+	w.U2(10)                   // constant_pool_count
+	w.Utf8("Foo")              // #1
+	w.U1(7)                    // #2 Class
+	w.U2(1)                    //
+	w.Utf8("java/lang/Object") // #3
+	w.U1(7)                    // #4 Class
+	w.U2(3)                    //
+	w.Utf8("<init>")           // #5
+	w.Utf8("()V")              // #6
+	w.Utf8("f")                // #7
+	w.Utf8("()I")              // #8
+	w.Utf8("Code")             // #9
+
+	w.U2(0x0021) // access_flags
+	w.U2(2)      // this_class
+	w.U2(4)      // super_class
+	w.U2(0)      // interfaces_count
+	w.U2(0)      // fields_count
+
+	w.U2(2) // methods_count
+	method(0x0001, 5, 6, code["<init>"])
+	method(0x0009, 7, 8, code["f"])
+
+	w.U2(0) // attributes_count
+	return w.Buf
+}
+
+// encodeCallerClass returns a class file with a static "f()I" method.
+// If callee is not empty, f returns the result of the callee f call.
+func encodeCallerClass(name, callee string) []byte {
+	code := []byte{byte(bytecode.Iconst1), byte(bytecode.Ireturn)}
+	if callee != "" {
+		code = []byte{byte(bytecode.Invokestatic), 0, 11, byte(bytecode.Ireturn)}
+	} else {
+		callee = name
+	}
+
+	w := jclasstest.NewWriter()
+	w.U4(0xCAFEBABE)
+	w.U2(0)  // minor_version
+	w.U2(52) // major_version
+
+	w.U2(12)                   // constant_pool_count
+	w.Utf8(name)               // #1
+	w.U1(7)                    // #2 Class
+	w.U2(1)                    //
+	w.Utf8("java/lang/Object") // #3
+	w.U1(7)                    // #4 Class
+	w.U2(3)                    //
+	w.Utf8("f")                // #5
+	w.Utf8("()I")              // #6
+	w.Utf8("Code")             // #7
+	w.Utf8(callee)             // #8
+	w.U1(7)                    // #9 Class
+	w.U2(8)                    //
+	w.U1(12)                   // #10 NameAndType
+	w.U2(5)                    //
+	w.U2(6)                    //
+	w.U1(10)                   // #11 Methodref
+	w.U2(9)                    //
+	w.U2(10)                   //
+
+	w.U2(0x0021) // access_flags
+	w.U2(2)      // this_class
+	w.U2(4)      // super_class
+	w.U2(0)      // interfaces_count
+	w.U2(0)      // fields_count
+
+	w.U2(1)      // methods_count
+	w.U2(0x0009) // access_flags
+	w.U2(5)      // name_index
+	w.U2(6)      // descriptor_index
+	w.U2(1)      // attributes_count
+	w.Attr("code", 7, func() {
+		w.U2(1) // max_stack
+		w.U2(0) // max_locals
+		w.U4(uint32(len(code)))
+		w.Bytes(code)
+		w.U2(0) // exception_table_length
+		w.U2(0) // attributes_count
+	})
+
+	w.U2(0) // attributes_count
+	return w.Buf
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/quasilyte/go-jdk/jclass"
 	"github.com/quasilyte/go-jdk/jdeps"
+	"github.com/quasilyte/go-jdk/verify"
 	"github.com/quasilyte/go-jdk/vmdat"
 )
 
@@ -30,7 +31,7 @@ func readClassFiles(name string, cfg *Config) ([]*jclass.File, error) {
 	out := make([]*jclass.File, len(files))
 	for i, f := range files {
 		var err error
-		out[i], err = decodeClassFile(filepath.Join(pkgPath, f.Name()))
+		out[i], err = decodeClassFile(filepath.Join(pkgPath, f.Name()), cfg)
 		if err != nil {
 			return nil, fmt.Errorf("decode %s: %v", f.Name(), err)
 		}
@@ -39,6 +40,19 @@ func readClassFiles(name string, cfg *Config) ([]*jclass.File, error) {
 	return out, nil
 }
 
+// readClassFile decodes the class file of the class with the full name.
+func readClassFile(name string, cfg *Config) (*jclass.File, error) {
+	fsname := strings.ReplaceAll(name, "/", string(os.PathSeparator)) + ".class"
+	for _, cp := range cfg.ClassPath {
+		filename := filepath.Join(cp, fsname)
+		if _, err := os.Stat(filename); err != nil {
+			continue
+		}
+		return decodeClassFile(filename, cfg)
+	}
+	return nil, errors.New("none of the class paths contained the specified class")
+}
+
 func dirClassFiles(name string) ([]os.FileInfo, error) {
 	f, err := os.Open(name)
 	if err != nil {
@@ -55,14 +69,28 @@ func dirClassFiles(name string) ([]os.FileInfo, error) {
 	return filesOnly, err
 }
 
-func decodeClassFile(filename string) (*jclass.File, error) {
+func decodeClassFile(filename string, cfg *Config) (*jclass.File, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	var dec jclass.Decoder
-	return dec.Decode(f)
+	dec := jclass.Decoder{
+		AllowPreview: cfg.AllowPreview,
+		LazyCode:     cfg.LazyCode,
+	}
+	classfile, err := dec.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	// Lazily decoded methods are verified by the IR generator,
+	// so only the methods that are compiled are decoded.
+	if !cfg.NoVerify && !cfg.LazyCode {
+		if err := verify.File(classfile); err != nil {
+			return nil, fmt.Errorf("verify: %v", err)
+		}
+	}
+	return classfile, nil
 }
 
 // findDependencies returns non-loaded dependencies for the given package.
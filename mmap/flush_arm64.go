@@ -0,0 +1,17 @@
+package mmap
+
+import (
+	"unsafe"
+)
+
+func flushCode(buf []byte) {
+	if len(buf) == 0 {
+		return
+	}
+	start := uintptr(unsafe.Pointer(&buf[0]))
+	flushICache(start, start+uintptr(len(buf)))
+}
+
+// flushICache cleans the data cache and invalidates the
+// instruction cache lines of the [start, end) range.
+func flushICache(start, end uintptr)
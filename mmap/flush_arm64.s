@@ -0,0 +1,34 @@
+#include "textflag.h"
+
+// func flushICache(start, end uintptr)
+TEXT ·flushICache(SB), NOSPLIT, $0-16
+        MOVD start+0(FP), R0
+        MOVD end+8(FP), R1
+        MRS CTR_EL0, R2
+        MOVD $4, R4
+
+        // Data cache line size is 4<<CTR_EL0.DminLine bytes.
+        UBFX $16, R2, $4, R3
+        LSL R3, R4, R3
+        SUB $1, R3, R5
+        BIC R5, R0, R6
+dloop:
+        DC CVAU, R6
+        ADD R3, R6, R6
+        CMP R1, R6
+        BLO dloop
+        DSB $11 // ISH
+
+        // Instruction cache line size is 4<<CTR_EL0.IminLine bytes.
+        AND $15, R2, R3
+        LSL R3, R4, R3
+        SUB $1, R3, R5
+        BIC R5, R0, R6
+iloop:
+        WORD $0xd50b7526 // IC IVAU, R6
+        ADD R3, R6, R6
+        CMP R1, R6
+        BLO iloop
+        DSB $11 // ISH
+        ISB $15 // SY
+        RET
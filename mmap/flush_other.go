@@ -0,0 +1,7 @@
+//go:build !arm64
+
+package mmap
+
+// Instruction caches are coherent with the data caches,
+// there is nothing to flush.
+func flushCode(buf []byte) {}
@@ -17,3 +17,12 @@ func Executable(length int) (Descriptor, []byte, error) {
 func Free(d Descriptor) error {
 	return munmap(d)
 }
+
+// FlushCode makes the machine code that was written to buf
+// visible to the instruction fetch.
+//
+// It should be called after the code is written, but before it's executed.
+// On the architectures with coherent instruction caches it's a no-op.
+func FlushCode(buf []byte) {
+	flushCode(buf)
+}
@@ -0,0 +1,786 @@
+package verify
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/quasilyte/go-jdk/bytecode"
+	"github.com/quasilyte/go-jdk/jclass"
+)
+
+// execute applies the current instruction effects to v.cur.
+// It reports whether the next instruction is reachable from the current one.
+func (v *verifier) execute() bool {
+	code := v.code.Code
+	op := bytecode.Op(code[v.pc])
+
+	switch op {
+	case bytecode.Nop:
+		// Nothing to check.
+
+	case bytecode.Aconstnull:
+		v.push(nullType)
+	case bytecode.Iconstm1, bytecode.Iconst0, bytecode.Iconst1, bytecode.Iconst2, bytecode.Iconst3, bytecode.Iconst4, bytecode.Iconst5:
+		v.push(intType)
+	case bytecode.Lconst0, bytecode.Lconst1:
+		v.push(longType)
+	case bytecode.Fconst0, bytecode.Fconst1, bytecode.Fconst2:
+		v.push(floatType)
+	case bytecode.Dconst0, bytecode.Dconst1:
+		v.push(doubleType)
+	case bytecode.Bipush, bytecode.Sipush:
+		v.push(intType)
+	case bytecode.Ldc:
+		v.ldc(uint16(code[v.pc+1]), false)
+	case bytecode.Ldcw:
+		v.ldc(v.u2(1), false)
+	case bytecode.Ldc2w:
+		v.ldc(v.u2(1), true)
+
+	case bytecode.Iload:
+		v.load(int(code[v.pc+1]), intType)
+	case bytecode.Lload:
+		v.load(int(code[v.pc+1]), longType)
+	case bytecode.Fload:
+		v.load(int(code[v.pc+1]), floatType)
+	case bytecode.Dload:
+		v.load(int(code[v.pc+1]), doubleType)
+	case bytecode.Aload:
+		v.loadRef(int(code[v.pc+1]))
+	case bytecode.Iload0, bytecode.Iload1, bytecode.Iload2, bytecode.Iload3:
+		v.load(int(op-bytecode.Iload0), intType)
+	case bytecode.Lload0, bytecode.Lload1, bytecode.Lload2, bytecode.Lload3:
+		v.load(int(op-bytecode.Lload0), longType)
+	case bytecode.Fload0, bytecode.Fload1, bytecode.Fload2, bytecode.Fload3:
+		v.load(int(op-bytecode.Fload0), floatType)
+	case bytecode.Dload0, bytecode.Dload1, bytecode.Dload2, bytecode.Dload3:
+		v.load(int(op-bytecode.Dload0), doubleType)
+	case bytecode.Aload0, bytecode.Aload1, bytecode.Aload2, bytecode.Aload3:
+		v.loadRef(int(op - bytecode.Aload0))
+
+	case bytecode.Iaload:
+		v.arrayLoad(intType, "[I")
+	case bytecode.Laload:
+		v.arrayLoad(longType, "[J")
+	case bytecode.Faload:
+		v.arrayLoad(floatType, "[F")
+	case bytecode.Daload:
+		v.arrayLoad(doubleType, "[D")
+	case bytecode.Baload:
+		v.arrayLoad(intType, "[B", "[Z")
+	case bytecode.Caload:
+		v.arrayLoad(intType, "[C")
+	case bytecode.Saload:
+		v.arrayLoad(intType, "[S")
+	case bytecode.Aaload:
+		v.pop(intType)
+		arr := v.popRefArray()
+		if arr.kind == tNull {
+			v.push(nullType)
+		} else {
+			v.push(elemType(arr))
+		}
+
+	case bytecode.Istore:
+		v.store(int(code[v.pc+1]), intType)
+	case bytecode.Lstore:
+		v.store(int(code[v.pc+1]), longType)
+	case bytecode.Fstore:
+		v.store(int(code[v.pc+1]), floatType)
+	case bytecode.Dstore:
+		v.store(int(code[v.pc+1]), doubleType)
+	case bytecode.Astore:
+		v.storeRef(int(code[v.pc+1]))
+	case bytecode.Istore0, bytecode.Istore1, bytecode.Istore2, bytecode.Istore3:
+		v.store(int(op-bytecode.Istore0), intType)
+	case bytecode.Lstore0, bytecode.Lstore1, bytecode.Lstore2, bytecode.Lstore3:
+		v.store(int(op-bytecode.Lstore0), longType)
+	case bytecode.Fstore0, bytecode.Fstore1, bytecode.Fstore2, bytecode.Fstore3:
+		v.store(int(op-bytecode.Fstore0), floatType)
+	case bytecode.Dstore0, bytecode.Dstore1, bytecode.Dstore2, bytecode.Dstore3:
+		v.store(int(op-bytecode.Dstore0), doubleType)
+	case bytecode.Astore0, bytecode.Astore1, bytecode.Astore2, bytecode.Astore3:
+		v.storeRef(int(op - bytecode.Astore0))
+
+	case bytecode.Iastore:
+		v.arrayStore(intType, "[I")
+	case bytecode.Lastore:
+		v.arrayStore(longType, "[J")
+	case bytecode.Fastore:
+		v.arrayStore(floatType, "[F")
+	case bytecode.Dastore:
+		v.arrayStore(doubleType, "[D")
+	case bytecode.Bastore:
+		v.arrayStore(intType, "[B", "[Z")
+	case bytecode.Castore:
+		v.arrayStore(intType, "[C")
+	case bytecode.Sastore:
+		v.arrayStore(intType, "[S")
+	case bytecode.Aastore:
+		v.pop(refType(objectClass))
+		v.pop(intType)
+		v.popRefArray()
+
+	case bytecode.Pop:
+		v.checkSplit(1)
+		v.cur.stack = v.cur.stack[:len(v.cur.stack)-1]
+	case bytecode.Pop2:
+		v.checkSplit(2)
+		v.cur.stack = v.cur.stack[:len(v.cur.stack)-2]
+	case bytecode.Dup:
+		v.dup(1, 1)
+	case bytecode.Dupx1:
+		v.dup(1, 2)
+	case bytecode.Dupx2:
+		v.dup(1, 3)
+	case bytecode.Dup2:
+		v.dup(2, 2)
+	case bytecode.Dup2x1:
+		v.dup(2, 3)
+	case bytecode.Dup2x2:
+		v.dup(2, 4)
+	case bytecode.Swap:
+		v.checkSplit(1, 2)
+		stack := v.cur.stack
+		n := len(stack)
+		stack[n-1], stack[n-2] = stack[n-2], stack[n-1]
+
+	case bytecode.Iadd, bytecode.Isub, bytecode.Imul, bytecode.Idiv, bytecode.Irem,
+		bytecode.Ishl, bytecode.Ishr, bytecode.Iushr, bytecode.Iand, bytecode.Ior, bytecode.Ixor:
+		v.binaryOp(intType)
+	case bytecode.Ladd, bytecode.Lsub, bytecode.Lmul, bytecode.Ldiv, bytecode.Lrem,
+		bytecode.Land, bytecode.Lor, bytecode.Lxor:
+		v.binaryOp(longType)
+	case bytecode.Fadd, bytecode.Fsub, bytecode.Fmul, bytecode.Fdiv, bytecode.Frem:
+		v.binaryOp(floatType)
+	case bytecode.Dadd, bytecode.Dsub, bytecode.Dmul, bytecode.Ddiv, bytecode.Drem:
+		v.binaryOp(doubleType)
+	case bytecode.Lshl, bytecode.Lshr, bytecode.Lushr:
+		v.pop(intType)
+		v.pop(longType)
+		v.push(longType)
+	case bytecode.Ineg:
+		v.convert(intType, intType)
+	case bytecode.Lneg:
+		v.convert(longType, longType)
+	case bytecode.Fneg:
+		v.convert(floatType, floatType)
+	case bytecode.Dneg:
+		v.convert(doubleType, doubleType)
+	case bytecode.Iinc:
+		v.iinc(int(code[v.pc+1]))
+	case bytecode.Wide:
+		v.executeWide()
+
+	case bytecode.I2l:
+		v.convert(intType, longType)
+	case bytecode.I2f:
+		v.convert(intType, floatType)
+	case bytecode.I2d:
+		v.convert(intType, doubleType)
+	case bytecode.L2i:
+		v.convert(longType, intType)
+	case bytecode.L2f:
+		v.convert(longType, floatType)
+	case bytecode.L2d:
+		v.convert(longType, doubleType)
+	case bytecode.F2i:
+		v.convert(floatType, intType)
+	case bytecode.F2l:
+		v.convert(floatType, longType)
+	case bytecode.F2d:
+		v.convert(floatType, doubleType)
+	case bytecode.D2i:
+		v.convert(doubleType, intType)
+	case bytecode.D2l:
+		v.convert(doubleType, longType)
+	case bytecode.D2f:
+		v.convert(doubleType, floatType)
+	case bytecode.I2b, bytecode.I2c, bytecode.I2s:
+		v.convert(intType, intType)
+
+	case bytecode.Lcmp:
+		v.pop(longType)
+		v.pop(longType)
+		v.push(intType)
+	case bytecode.Fcmpl, bytecode.Fcmpg:
+		v.pop(floatType)
+		v.pop(floatType)
+		v.push(intType)
+	case bytecode.Dcmpl, bytecode.Dcmpg:
+		v.pop(doubleType)
+		v.pop(doubleType)
+		v.push(intType)
+
+	case bytecode.Ifeq, bytecode.Ifne, bytecode.Iflt, bytecode.Ifge, bytecode.Ifgt, bytecode.Ifle:
+		v.pop(intType)
+		v.branch(int(v.s2(1)))
+	case bytecode.Ificmpeq, bytecode.Ificmpne, bytecode.Ificmplt, bytecode.Ificmpge, bytecode.Ificmpgt, bytecode.Ificmple:
+		v.pop(intType)
+		v.pop(intType)
+		v.branch(int(v.s2(1)))
+	case bytecode.Ifacmpeq, bytecode.Ifacmpne:
+		v.popRef()
+		v.popRef()
+		v.branch(int(v.s2(1)))
+	case bytecode.Ifnull, bytecode.Ifnonnull:
+		v.popRef()
+		v.branch(int(v.s2(1)))
+	case bytecode.Goto:
+		v.branch(int(v.s2(1)))
+		return false
+	case bytecode.Gotow:
+		v.branch(int(v.s4(1)))
+		return false
+	case bytecode.Tableswitch, bytecode.Lookupswitch:
+		v.pop(intType)
+		sw, _ := bytecode.DecodeSwitch(v.code.Code, v.pc)
+		v.branch(int(sw.Default))
+		for _, offset := range sw.Offsets {
+			v.branch(int(offset))
+		}
+		return false
+
+	case bytecode.Ireturn:
+		v.checkReturn(intType)
+		return false
+	case bytecode.Lreturn:
+		v.checkReturn(longType)
+		return false
+	case bytecode.Freturn:
+		v.checkReturn(floatType)
+		return false
+	case bytecode.Dreturn:
+		v.checkReturn(doubleType)
+		return false
+	case bytecode.Areturn:
+		v.checkReturn(refType(objectClass))
+		return false
+	case bytecode.Return:
+		v.checkReturn(topType)
+		return false
+	case bytecode.Athrow:
+		v.pop(refType(throwableClass))
+		return false
+
+	case bytecode.Getstatic, bytecode.Putstatic, bytecode.Getfield, bytecode.Putfield:
+		v.fieldAccess(op)
+
+	case bytecode.Invokestatic, bytecode.Invokevirtual, bytecode.Invokespecial, bytecode.Invokeinterface:
+		v.invoke(op)
+
+	case bytecode.New:
+		class := v.classConst(v.u2(1))
+		if strings.HasPrefix(class.Name, "[") {
+			v.errorf("new: %s is an array class", class.Name)
+		}
+		typ := vtype{kind: tUninitialized, offset: v.pc}
+		for _, slot := range v.cur.stack {
+			if slot == typ {
+				v.errorf("new: uninitialized object is already on the stack")
+			}
+		}
+		v.replaceType(typ, topType)
+		v.push(typ)
+	case bytecode.Newarray:
+		atype := int(code[v.pc+1])
+		if atype >= len(newarrayTypes) || newarrayTypes[atype] == "" {
+			v.errorf("newarray: invalid atype %d", atype)
+		}
+		v.pop(intType)
+		v.push(refType(newarrayTypes[atype]))
+	case bytecode.Anewarray:
+		class := v.classConst(v.u2(1))
+		v.pop(intType)
+		v.push(refType(arrayOf(class.Name)))
+	case bytecode.Multianewarray:
+		class := v.classConst(v.u2(1))
+		dims := int(code[v.pc+3])
+		if dims == 0 || !strings.HasPrefix(class.Name, strings.Repeat("[", dims)) {
+			v.errorf("multianewarray: can't create %d dimensions of %s", dims, class.Name)
+		}
+		for i := 0; i < dims; i++ {
+			v.pop(intType)
+		}
+		v.push(refType(class.Name))
+	case bytecode.Arraylength:
+		typ := v.popRef()
+		if typ.kind != tNull && !typ.isArray() {
+			v.errorf("arraylength: %s is not an array", typ)
+		}
+		v.push(intType)
+
+	case bytecode.Checkcast:
+		class := v.classConst(v.u2(1))
+		v.pop(refType(objectClass))
+		v.push(refType(class.Name))
+	case bytecode.Instanceof:
+		v.classConst(v.u2(1))
+		v.pop(refType(objectClass))
+		v.push(intType)
+	case bytecode.Monitorenter, bytecode.Monitorexit:
+		v.pop(refType(objectClass))
+
+	case bytecode.Jsr, bytecode.Jsrw, bytecode.Ret:
+		v.subroutine(op)
+
+	default:
+		v.errorf("%s is not supported", op)
+	}
+
+	return true
+}
+
+// executeWide applies the wide-prefixed instruction effects.
+func (v *verifier) executeWide() {
+	index := int(v.u2(2))
+	switch op := bytecode.Op(v.code.Code[v.pc+1]); op {
+	case bytecode.Iload:
+		v.load(index, intType)
+	case bytecode.Lload:
+		v.load(index, longType)
+	case bytecode.Fload:
+		v.load(index, floatType)
+	case bytecode.Dload:
+		v.load(index, doubleType)
+	case bytecode.Aload:
+		v.loadRef(index)
+	case bytecode.Istore:
+		v.store(index, intType)
+	case bytecode.Lstore:
+		v.store(index, longType)
+	case bytecode.Fstore:
+		v.store(index, floatType)
+	case bytecode.Dstore:
+		v.store(index, doubleType)
+	case bytecode.Astore:
+		v.storeRef(index)
+	case bytecode.Iinc:
+		v.iinc(index)
+	case bytecode.Ret:
+		v.subroutine(op)
+	default:
+		v.errorf("wide %s is not supported", op)
+	}
+}
+
+// subroutine reports the jsr, jsr_w or ret instruction.
+//
+// Subroutines are only permitted in the class files before
+// version 51 and we don't support them: javac stopped emitting
+// them for the class files of version 50 and above.
+func (v *verifier) subroutine(op bytecode.Op) {
+	ver := v.f.Ver
+	if !ver.HasSubroutines() {
+		v.errorf("%s is not permitted in class file version %s", op, ver)
+	}
+	v.errorf("%s: subroutines of class file version %s are not supported (recompile with -target 1.6 or later)", op, ver)
+}
+
+// isWideOp reports whether op can be used with the wide prefix.
+func isWideOp(op bytecode.Op) bool {
+	switch op {
+	case bytecode.Iload, bytecode.Lload, bytecode.Fload, bytecode.Dload, bytecode.Aload:
+		return true
+	case bytecode.Istore, bytecode.Lstore, bytecode.Fstore, bytecode.Dstore, bytecode.Astore:
+		return true
+	case bytecode.Iinc, bytecode.Ret:
+		return true
+	default:
+		return false
+	}
+}
+
+func (v *verifier) iinc(index int) {
+	if typ := v.local(index); typ.kind != tInt {
+		v.errorf("iinc: local %d is %s, not int", index, typ)
+	}
+}
+
+var newarrayTypes = [...]string{
+	4:  "[Z",
+	5:  "[C",
+	6:  "[F",
+	7:  "[D",
+	8:  "[B",
+	9:  "[S",
+	10: "[I",
+	11: "[J",
+}
+
+func (v *verifier) u2(offset int) uint16 {
+	return binary.BigEndian.Uint16(v.code.Code[v.pc+offset:])
+}
+
+func (v *verifier) s2(offset int) int16 {
+	return int16(v.u2(offset))
+}
+
+func (v *verifier) s4(offset int) int32 {
+	return int32(binary.BigEndian.Uint32(v.code.Code[v.pc+offset:]))
+}
+
+func (v *verifier) branch(offset int) {
+	v.flowTo(v.pc+offset, v.cur)
+}
+
+func (v *verifier) push(typ vtype) {
+	v.cur.stack = appendType(v.cur.stack, typ)
+	if len(v.cur.stack) > int(v.code.MaxStack) {
+		v.errorf("stack depth exceeds max_stack=%d", v.code.MaxStack)
+	}
+}
+
+func (v *verifier) popSlot() vtype {
+	n := len(v.cur.stack)
+	if n == 0 {
+		v.errorf("stack underflow")
+	}
+	typ := v.cur.stack[n-1]
+	v.cur.stack = v.cur.stack[:n-1]
+	return typ
+}
+
+// pop removes a value of type want from the stack.
+func (v *verifier) pop(want vtype) vtype {
+	if want.isWide() {
+		if hi := v.popSlot(); hi.kind != tTop {
+			v.errorf("stack: have %s, want %s", hi, want)
+		}
+	}
+	typ := v.popSlot()
+	if !isAssignable(typ, want) {
+		v.errorf("stack: have %s, want %s", typ, want)
+	}
+	return typ
+}
+
+// popRef removes a reference from the stack.
+// Unlike pop, it also accepts the uninitialized objects.
+func (v *verifier) popRef() vtype {
+	typ := v.popSlot()
+	if !typ.isReference() {
+		v.errorf("stack: have %s, want reference", typ)
+	}
+	return typ
+}
+
+// popRefArray removes an array of references from the stack.
+func (v *verifier) popRefArray() vtype {
+	typ := v.pop(refType(objectClass))
+	if typ.kind == tNull {
+		return typ
+	}
+	if !typ.isArray() || !isRefDescriptor(typ.name[len("["):]) {
+		v.errorf("stack: have %s, want array of references", typ)
+	}
+	return typ
+}
+
+// checkSplit makes sure that the stack value groups that start
+// at the given depths don't split the wide values.
+func (v *verifier) checkSplit(depths ...int) {
+	stack := v.cur.stack
+	for _, depth := range depths {
+		if depth > len(stack) {
+			v.errorf("stack underflow")
+		}
+		if stack[len(stack)-depth].kind == tTop {
+			v.errorf("stack: wide value is split")
+		}
+	}
+}
+
+// dup copies n top stack slots below depth slots from the top.
+func (v *verifier) dup(n, depth int) {
+	if n == depth {
+		v.checkSplit(n)
+	} else {
+		v.checkSplit(n, depth)
+	}
+	stack := v.cur.stack
+	top := append([]vtype(nil), stack[len(stack)-n:]...)
+	rest := append([]vtype(nil), stack[len(stack)-depth:]...)
+	stack = append(stack[:len(stack)-depth], top...)
+	v.cur.stack = append(stack, rest...)
+	if len(v.cur.stack) > int(v.code.MaxStack) {
+		v.errorf("stack depth exceeds max_stack=%d", v.code.MaxStack)
+	}
+}
+
+func (v *verifier) local(index int) vtype {
+	if index >= len(v.cur.locals) {
+		v.errorf("local %d exceeds max_locals=%d", index, len(v.cur.locals))
+	}
+	return v.cur.locals[index]
+}
+
+func (v *verifier) setLocal(index int, typ vtype) {
+	locals := v.cur.locals
+	size := 1
+	if typ.isWide() {
+		size = 2
+	}
+	if index+size > len(locals) {
+		v.errorf("local %d exceeds max_locals=%d", index+size-1, len(locals))
+	}
+	// Overwriting the second slot of a wide value invalidates it.
+	if index > 0 && locals[index-1].isWide() {
+		locals[index-1] = topType
+	}
+	locals[index] = typ
+	if size == 2 {
+		locals[index+1] = topType
+	}
+}
+
+func (v *verifier) load(index int, want vtype) {
+	typ := v.local(index)
+	if typ.kind != want.kind {
+		v.errorf("local %d: have %s, want %s", index, typ, want)
+	}
+	if typ.isWide() {
+		v.local(index + 1)
+	}
+	v.push(typ)
+}
+
+func (v *verifier) loadRef(index int) {
+	typ := v.local(index)
+	if !typ.isReference() {
+		v.errorf("local %d: have %s, want reference", index, typ)
+	}
+	v.push(typ)
+}
+
+func (v *verifier) store(index int, want vtype) {
+	v.setLocal(index, v.pop(want))
+}
+
+func (v *verifier) storeRef(index int) {
+	v.setLocal(index, v.popRef())
+}
+
+func (v *verifier) arrayLoad(elem vtype, arrays ...string) {
+	v.pop(intType)
+	v.popArray(arrays)
+	v.push(elem)
+}
+
+func (v *verifier) arrayStore(elem vtype, arrays ...string) {
+	v.pop(elem)
+	v.pop(intType)
+	v.popArray(arrays)
+}
+
+// popArray removes an array of one of the specified types from the stack.
+func (v *verifier) popArray(arrays []string) {
+	typ := v.pop(refType(objectClass))
+	if typ.kind == tNull {
+		return
+	}
+	for _, name := range arrays {
+		if typ.name == name {
+			return
+		}
+	}
+	v.errorf("stack: have %s, want %s", typ, strings.Join(arrays, " or "))
+}
+
+func (v *verifier) binaryOp(typ vtype) {
+	v.pop(typ)
+	v.pop(typ)
+	v.push(typ)
+}
+
+func (v *verifier) convert(from, to vtype) {
+	v.pop(from)
+	v.push(to)
+}
+
+// replaceType replaces all old type occurrences with the new type.
+func (v *verifier) replaceType(old, typ vtype) {
+	for i, slot := range v.cur.locals {
+		if slot == old {
+			v.cur.locals[i] = typ
+		}
+	}
+	for i, slot := range v.cur.stack {
+		if slot == old {
+			v.cur.stack[i] = typ
+		}
+	}
+}
+
+func (v *verifier) checkReturn(typ vtype) {
+	want := jclass.MethodDescriptor(v.m.Descriptor).ReturnType()
+	if typ.kind == tTop {
+		if want.Kind != 'V' {
+			v.errorf("return: method must return a value")
+		}
+	} else {
+		if want.Kind == 'V' {
+			v.errorf("return: method must not return a value")
+		}
+		wantType := descriptorType(want)
+		if wantType.kind != typ.kind {
+			v.errorf("return: have %s, want %s", typ, wantType)
+		}
+		v.pop(wantType)
+	}
+	if v.m.Name == "<init>" {
+		for _, typ := range v.cur.locals {
+			if typ.kind == tUninitializedThis {
+				v.errorf("return: constructor didn't initialize this")
+			}
+		}
+	}
+}
+
+func (v *verifier) fieldAccess(op bytecode.Op) {
+	index := v.u2(1)
+	field, ok := v.constAt(index).(*jclass.FieldrefConst)
+	if !ok {
+		v.errorf("%s: constant #%d is not a field reference", op, index)
+	}
+	v.checkClassName(field.ClassName)
+	if !jclass.FieldDescriptor(field.Descriptor).IsValid() {
+		v.errorf("%s: invalid field descriptor %q", op, field.Descriptor)
+	}
+	typ := descriptorType(jclass.FieldDescriptor(field.Descriptor).GetType())
+
+	switch op {
+	case bytecode.Getstatic:
+		v.push(typ)
+	case bytecode.Putstatic:
+		v.pop(typ)
+	case bytecode.Getfield:
+		v.pop(refType(field.ClassName))
+		v.push(typ)
+	case bytecode.Putfield:
+		v.pop(typ)
+		// Constructors can assign the own fields before calling super().
+		receiver := v.popRef()
+		selfInit := receiver.kind == tUninitializedThis && field.ClassName == v.f.ThisClassName
+		if !selfInit && !isAssignable(receiver, refType(field.ClassName)) {
+			v.errorf("%s: have %s, want %s", op, receiver, field.ClassName)
+		}
+	}
+}
+
+func (v *verifier) invoke(op bytecode.Op) {
+	index := v.u2(1)
+	method, ok := v.constAt(index).(*jclass.MethodrefConst)
+	if !ok {
+		v.errorf("%s: constant #%d is not a method reference", op, index)
+	}
+	v.checkClassName(method.ClassName)
+	if !jclass.MethodDescriptor(method.Descriptor).IsValid() {
+		v.errorf("%s: invalid method descriptor %q", op, method.Descriptor)
+	}
+	isInit := method.Name == "<init>"
+	if strings.HasPrefix(method.Name, "<") && (!isInit || op != bytecode.Invokespecial) {
+		v.errorf("%s: can't invoke %s", op, method.Name)
+	}
+
+	desc := jclass.MethodDescriptor(method.Descriptor)
+	var params []vtype
+	slots := 0
+	desc.WalkParams(func(typ jclass.DescriptorType) {
+		params = append(params, descriptorType(typ))
+		slots++
+		if params[len(params)-1].isWide() {
+			slots++
+		}
+	})
+	if op == bytecode.Invokeinterface {
+		if int(v.code.Code[v.pc+3]) != slots+1 || v.code.Code[v.pc+4] != 0 {
+			v.errorf("%s: invalid count operand", op)
+		}
+	}
+	for i := len(params) - 1; i >= 0; i-- {
+		v.pop(params[i])
+	}
+
+	switch {
+	case op == bytecode.Invokestatic:
+		// No receiver.
+	case isInit:
+		receiver := v.popRef()
+		var initialized vtype
+		switch receiver.kind {
+		case tUninitializedThis:
+			if method.ClassName != v.f.ThisClassName && method.ClassName != v.superClassName() {
+				v.errorf("%s: can't initialize this with %s constructor", op, method.ClassName)
+			}
+			initialized = refType(v.f.ThisClassName)
+		case tUninitialized:
+			if !v.isInstStart(receiver.offset) || bytecode.Op(v.code.Code[receiver.offset]) != bytecode.New {
+				v.errorf("%s: uninitialized object at %d is not created by new", op, receiver.offset)
+			}
+			// The new instruction may be not verified yet if
+			// the uninitialized type comes from a stack map frame.
+			newClass := v.classConst(binary.BigEndian.Uint16(v.code.Code[receiver.offset+1:]))
+			if newClass.Name != method.ClassName {
+				v.errorf("%s: initializing %s with %s constructor", op, newClass.Name, method.ClassName)
+			}
+			initialized = refType(newClass.Name)
+		default:
+			v.errorf("%s: %s is already initialized", op, receiver)
+		}
+		v.replaceType(receiver, initialized)
+	default:
+		v.pop(refType(method.ClassName))
+	}
+
+	if ret := desc.ReturnType(); ret.Kind != 'V' {
+		v.push(descriptorType(ret))
+	}
+}
+
+func (v *verifier) superClassName() string {
+	if v.f.SuperClass == 0 {
+		return ""
+	}
+	return v.f.Consts[v.f.SuperClass].(*jclass.ClassConst).Name
+}
+
+func (v *verifier) constAt(index uint16) jclass.Const {
+	if int(index) >= len(v.f.Consts) || v.f.Consts[index] == nil {
+		v.errorf("invalid constant pool index %d", index)
+	}
+	return v.f.Consts[index]
+}
+
+func (v *verifier) classConst(index uint16) *jclass.ClassConst {
+	class, ok := v.constAt(index).(*jclass.ClassConst)
+	if !ok {
+		v.errorf("%s: constant #%d is not a class", bytecode.Op(v.code.Code[v.pc]), index)
+	}
+	v.checkClassName(class.Name)
+	return class
+}
+
+func (v *verifier) ldc(index uint16, wide bool) {
+	var typ vtype
+	switch v.constAt(index).(type) {
+	case *jclass.IntConst:
+		typ = intType
+	case *jclass.FloatConst:
+		typ = floatType
+	case *jclass.StringConst:
+		typ = refType("java/lang/String")
+	case *jclass.ClassConst:
+		typ = refType("java/lang/Class")
+	case *jclass.LongConst:
+		typ = longType
+	case *jclass.DoubleConst:
+		typ = doubleType
+	default:
+		v.errorf("can't load constant #%d", index)
+	}
+	if typ.isWide() != wide {
+		v.errorf("%s can't load constant #%d", bytecode.Op(v.code.Code[v.pc]), index)
+	}
+	v.push(typ)
+}
@@ -0,0 +1,249 @@
+package verify
+
+import (
+	"strings"
+
+	"github.com/quasilyte/go-jdk/jclass"
+)
+
+type typeKind uint8
+
+const (
+	// tTop is an unusable value.
+	// It's also used as a second slot of the long and double values.
+	tTop typeKind = iota
+	tInt
+	tFloat
+	tLong
+	tDouble
+	tNull
+	tUninitializedThis
+	tUninitialized
+	tRef
+)
+
+// vtype is a verification type of a single local variable or stack slot.
+type vtype struct {
+	kind typeKind
+
+	// name is a class name for the tRef types.
+	// Arrays use the descriptor syntax, like "[I" or "[Ljava/lang/String;".
+	name string
+
+	// offset is a new instruction pc for the tUninitialized types.
+	offset int
+}
+
+const (
+	objectClass    = "java/lang/Object"
+	throwableClass = "java/lang/Throwable"
+)
+
+var (
+	topType    = vtype{kind: tTop}
+	intType    = vtype{kind: tInt}
+	floatType  = vtype{kind: tFloat}
+	longType   = vtype{kind: tLong}
+	doubleType = vtype{kind: tDouble}
+	nullType   = vtype{kind: tNull}
+)
+
+func refType(name string) vtype { return vtype{kind: tRef, name: name} }
+
+func (typ vtype) isWide() bool { return typ.kind == tLong || typ.kind == tDouble }
+
+func (typ vtype) isReference() bool {
+	switch typ.kind {
+	case tNull, tRef, tUninitializedThis, tUninitialized:
+		return true
+	default:
+		return false
+	}
+}
+
+func (typ vtype) isArray() bool {
+	return typ.kind == tRef && strings.HasPrefix(typ.name, "[")
+}
+
+func (typ vtype) String() string {
+	switch typ.kind {
+	case tTop:
+		return "top"
+	case tInt:
+		return "int"
+	case tFloat:
+		return "float"
+	case tLong:
+		return "long"
+	case tDouble:
+		return "double"
+	case tNull:
+		return "null"
+	case tUninitializedThis:
+		return "uninitializedThis"
+	case tUninitialized:
+		return "uninitialized"
+	default:
+		return typ.name
+	}
+}
+
+// descriptorType converts a field descriptor type to its verification type.
+// Boolean, byte, char and short values are represented as int.
+func descriptorType(typ jclass.DescriptorType) vtype {
+	if typ.Dims != 0 {
+		return refType(arrayName(typ))
+	}
+	switch typ.Kind {
+	case 'Z', 'B', 'C', 'S', 'I':
+		return intType
+	case 'F':
+		return floatType
+	case 'J':
+		return longType
+	case 'D':
+		return doubleType
+	default:
+		return refType(typ.Name)
+	}
+}
+
+func arrayName(typ jclass.DescriptorType) string {
+	prefix := strings.Repeat("[", typ.Dims)
+	if typ.Kind == 'L' {
+		return prefix + "L" + typ.Name + ";"
+	}
+	return prefix + string(typ.Kind)
+}
+
+// arrayOf returns an array class name with elements of the specified class.
+func arrayOf(className string) string {
+	if strings.HasPrefix(className, "[") {
+		return "[" + className
+	}
+	return "[L" + className + ";"
+}
+
+// elemType returns the element type of the array type typ.
+func elemType(typ vtype) vtype {
+	elem := typ.name[len("["):]
+	switch elem[0] {
+	case 'L':
+		return refType(elem[len("L") : len(elem)-len(";")])
+	case '[':
+		return refType(elem)
+	default:
+		return descriptorType(jclass.DescriptorType{Kind: elem[0]})
+	}
+}
+
+// frameType converts a stack map frame item to its verification type.
+func frameType(typ jclass.VerificationType) vtype {
+	switch typ.Tag {
+	case jclass.VerifInteger:
+		return intType
+	case jclass.VerifFloat:
+		return floatType
+	case jclass.VerifLong:
+		return longType
+	case jclass.VerifDouble:
+		return doubleType
+	case jclass.VerifNull:
+		return nullType
+	case jclass.VerifUninitializedThis:
+		return vtype{kind: tUninitializedThis}
+	case jclass.VerifUninitialized:
+		return vtype{kind: tUninitialized, offset: int(typ.Offset)}
+	case jclass.VerifObject:
+		return refType(typ.ClassName)
+	default:
+		return topType
+	}
+}
+
+// isAssignable reports whether a value of type from can be used
+// where a value of type to is expected.
+func isAssignable(from, to vtype) bool {
+	switch to.kind {
+	case tTop:
+		return true
+	case tRef:
+		switch from.kind {
+		case tNull:
+			return true
+		case tRef:
+			return isClassAssignable(from.name, to.name)
+		default:
+			return false
+		}
+	case tUninitialized:
+		return from.kind == tUninitialized && from.offset == to.offset
+	default:
+		return from.kind == to.kind
+	}
+}
+
+// isClassAssignable reports whether class from can be used
+// where class to is expected.
+//
+// The class hierarchy is not available during the verification,
+// so any non-array class is considered to be assignable to any other
+// non-array class. Such values are checked when they're used.
+func isClassAssignable(from, to string) bool {
+	if from == to || to == objectClass {
+		return true
+	}
+	fromArray := strings.HasPrefix(from, "[")
+	toArray := strings.HasPrefix(to, "[")
+	switch {
+	case fromArray && toArray:
+		fromElem := from[len("["):]
+		toElem := to[len("["):]
+		if !isRefDescriptor(fromElem) || !isRefDescriptor(toElem) {
+			return fromElem == toElem
+		}
+		return isClassAssignable(descriptorClassName(fromElem), descriptorClassName(toElem))
+	case fromArray:
+		return to == "java/lang/Cloneable" || to == "java/io/Serializable"
+	case toArray:
+		return false
+	default:
+		return true
+	}
+}
+
+func isRefDescriptor(s string) bool {
+	return s[0] == 'L' || s[0] == '['
+}
+
+func descriptorClassName(s string) string {
+	if s[0] == 'L' {
+		return s[len("L") : len(s)-len(";")]
+	}
+	return s
+}
+
+// mergeTypes returns a type that both x and y are assignable to.
+// It's used to infer the types for the class files that have no stack maps.
+func mergeTypes(x, y vtype) vtype {
+	switch {
+	case x == y:
+		return x
+	case x.kind == tNull && y.kind == tRef:
+		return y
+	case x.kind == tRef && y.kind == tNull:
+		return x
+	case x.kind == tRef && y.kind == tRef:
+		if x.isArray() && y.isArray() {
+			xelem := x.name[len("["):]
+			yelem := y.name[len("["):]
+			if isRefDescriptor(xelem) && isRefDescriptor(yelem) {
+				elem := mergeTypes(refType(descriptorClassName(xelem)), refType(descriptorClassName(yelem)))
+				return refType(arrayOf(elem.name))
+			}
+		}
+		return refType(objectClass)
+	default:
+		return topType
+	}
+}
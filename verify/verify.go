@@ -0,0 +1,445 @@
+// Package verify implements the JVM bytecode verification.
+//
+// The verifier makes sure that the method code is type-safe:
+// every instruction gets operands of the expected types,
+// local variables are initialized before they're used
+// and all branches lead to the valid instructions.
+//
+// Class files with StackMapTable attributes (version 50 and above)
+// are checked against the recorded frames as described in JVMS §4.10.1.
+// Types for the older class files are inferred with the data-flow analysis.
+//
+// The class hierarchy is not consulted, so the non-array class types
+// are not checked against each other.
+//
+// Subroutines (jsr, jsr_w and ret instructions) of the class files
+// before version 51 are not supported, such methods are rejected.
+package verify
+
+import (
+	"fmt"
+
+	"github.com/quasilyte/go-jdk/bytecode"
+	"github.com/quasilyte/go-jdk/jclass"
+)
+
+// Error describes a verification failure.
+type Error struct {
+	ClassName  string
+	MethodName string
+	Descriptor string
+
+	// PC is an offset of the offending instruction.
+	// It's -1 if the problem is not bound to any instruction.
+	PC int
+
+	Msg string
+}
+
+func (e *Error) Error() string {
+	if e.PC == -1 {
+		return fmt.Sprintf("%s.%s%s: %s", e.ClassName, e.MethodName, e.Descriptor, e.Msg)
+	}
+	return fmt.Sprintf("%s.%s%s: pc=%d: %s", e.ClassName, e.MethodName, e.Descriptor, e.PC, e.Msg)
+}
+
+// File verifies all methods of the class file f.
+func File(f *jclass.File) error {
+	for i := range f.Methods {
+		if err := Method(f, &f.Methods[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Method verifies the code of the method m that belongs to the class file f.
+// Methods without code, like abstract and native methods, are always valid.
+func Method(f *jclass.File, m *jclass.Method) (err error) {
+	code, err := m.Code()
+	if err != nil {
+		return err
+	}
+	if code == nil {
+		return nil
+	}
+
+	v := &verifier{f: f, m: m, code: code, pc: -1}
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		verr, ok := r.(verifyError)
+		if !ok {
+			panic(r)
+		}
+		err = &Error{
+			ClassName:  f.ThisClassName,
+			MethodName: m.Name,
+			Descriptor: m.Descriptor,
+			PC:         v.pc,
+			Msg:        verr.msg,
+		}
+	}()
+	v.verify()
+	return nil
+}
+
+// verifyError is used to abort the verification from the deeply
+// nested calls. It never escapes the package.
+type verifyError struct {
+	msg string
+}
+
+// frame is a verifier state at some instruction.
+type frame struct {
+	locals []vtype
+	stack  []vtype
+}
+
+func (fr *frame) clone() *frame {
+	return &frame{
+		locals: append([]vtype(nil), fr.locals...),
+		stack:  append([]vtype(nil), fr.stack...),
+	}
+}
+
+type verifier struct {
+	f    *jclass.File
+	m    *jclass.Method
+	code *jclass.CodeAttribute
+
+	// pc is an offset of the instruction being verified.
+	pc int
+
+	// instStart marks the offsets that start an instruction.
+	instStart []bool
+
+	// cur is a state before the current instruction.
+	cur *frame
+
+	// frames are the stack map frames indexed by their offsets.
+	// It's nil for the old class files without stack maps.
+	frames map[int]*frame
+
+	// states and worklist are used for the type inference.
+	states   map[int]*frame
+	worklist []int
+}
+
+func (v *verifier) errorf(format string, args ...interface{}) {
+	panic(verifyError{msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *verifier) verify() {
+	if !jclass.MethodDescriptor(v.m.Descriptor).IsValid() {
+		v.errorf("invalid method descriptor %q", v.m.Descriptor)
+	}
+	v.checkClassName(v.f.ThisClassName)
+	v.decodeInstructions()
+	v.checkHandlers()
+	initial := v.initialFrame()
+	if v.f.Ver.HasStackMapTable() {
+		v.frames = v.expandFrames(initial)
+		v.typecheck(initial)
+	} else {
+		v.infer(initial)
+	}
+}
+
+// decodeInstructions finds the instruction boundaries.
+func (v *verifier) decodeInstructions() {
+	code := v.code.Code
+	v.instStart = make([]bool, len(code))
+	for pc := 0; pc < len(code); {
+		v.pc = pc
+		op := bytecode.Op(code[pc])
+		if op == bytecode.Tableswitch || op == bytecode.Lookupswitch {
+			if _, err := bytecode.DecodeSwitch(code, pc); err != nil {
+				v.errorf("%v", err)
+			}
+		}
+		if op == bytecode.Wide && pc+1 < len(code) && !isWideOp(bytecode.Op(code[pc+1])) {
+			v.errorf("wide: can't be applied to %s", bytecode.Op(code[pc+1]))
+		}
+		width := bytecode.InstWidth(code, pc)
+		if width == 0 && op == bytecode.Wide {
+			v.errorf("%s is truncated", op)
+		}
+		if width == 0 {
+			v.errorf("unsupported opcode %d", op)
+		}
+		if pc+width > len(code) {
+			v.errorf("%s is truncated", op)
+		}
+		v.instStart[pc] = true
+		pc += width
+	}
+	v.pc = -1
+}
+
+// checkClassName reports the names that can't be used as a Class constant.
+// Names are checked before use, so the malformed ones can't break the verifier.
+func (v *verifier) checkClassName(name string) {
+	if !jclass.IsValidClassName(name) {
+		v.errorf("invalid class name %q", name)
+	}
+}
+
+func (v *verifier) checkHandlers() {
+	for _, h := range v.code.ExceptionTable {
+		if h.CatchType != 0 {
+			class, ok := v.constAt(h.CatchType).(*jclass.ClassConst)
+			if !ok {
+				v.errorf("exception handler catch type #%d is not a class", h.CatchType)
+			}
+			v.checkClassName(class.Name)
+		}
+		start, end, handler := int(h.StartPC), int(h.EndPC), int(h.HandlerPC)
+		if start >= end || !v.isInstStart(start) || (end != len(v.code.Code) && !v.isInstStart(end)) {
+			v.errorf("invalid exception handler range [%d, %d)", start, end)
+		}
+		if !v.isInstStart(handler) {
+			v.errorf("invalid exception handler pc %d", handler)
+		}
+	}
+}
+
+func (v *verifier) isInstStart(pc int) bool {
+	return pc >= 0 && pc < len(v.instStart) && v.instStart[pc]
+}
+
+// initialFrame returns the method entry state that is derived from its descriptor.
+func (v *verifier) initialFrame() *frame {
+	fr := &frame{}
+	if !v.m.AccessFlags.IsStatic() {
+		this := refType(v.f.ThisClassName)
+		if v.m.Name == "<init>" && v.f.ThisClassName != objectClass {
+			this = vtype{kind: tUninitializedThis}
+		}
+		fr.locals = append(fr.locals, this)
+	}
+	jclass.MethodDescriptor(v.m.Descriptor).WalkParams(func(typ jclass.DescriptorType) {
+		fr.locals = appendType(fr.locals, descriptorType(typ))
+	})
+	fr.locals = v.padLocals(fr.locals)
+	return fr
+}
+
+// appendType adds typ to the slots list, wide types occupy 2 slots.
+func appendType(slots []vtype, typ vtype) []vtype {
+	slots = append(slots, typ)
+	if typ.isWide() {
+		slots = append(slots, topType)
+	}
+	return slots
+}
+
+func (v *verifier) padLocals(locals []vtype) []vtype {
+	maxLocals := int(v.code.MaxLocals)
+	if len(locals) > maxLocals {
+		v.errorf("%d locals exceed max_locals=%d", len(locals), maxLocals)
+	}
+	for len(locals) < maxLocals {
+		locals = append(locals, topType)
+	}
+	return locals
+}
+
+// expandFrames converts the StackMapTable frames into the explicit states.
+func (v *verifier) expandFrames(initial *frame) map[int]*frame {
+	var stackMap []jclass.StackMapFrame
+	for _, attr := range v.code.Attrs {
+		if attr, ok := attr.(jclass.StackMapTableAttribute); ok {
+			stackMap = attr.Frames
+			break
+		}
+	}
+
+	frames := make(map[int]*frame, len(stackMap))
+	// Locals are tracked without the padding and in the
+	// stack map format: wide types occupy only 1 item.
+	var locals []vtype
+	for _, typ := range initial.locals {
+		if typ.kind == tTop && len(locals) != 0 && locals[len(locals)-1].isWide() {
+			continue
+		}
+		locals = append(locals, typ)
+	}
+	for len(locals) != 0 && locals[len(locals)-1].kind == tTop {
+		locals = locals[:len(locals)-1]
+	}
+
+	for _, sm := range stackMap {
+		for _, types := range [][]jclass.VerificationType{sm.Locals, sm.Stack} {
+			for _, typ := range types {
+				if typ.Tag == jclass.VerifObject {
+					v.checkClassName(typ.ClassName)
+				}
+			}
+		}
+		switch sm.Kind {
+		case jclass.ChopFrame:
+			if sm.Chop > len(locals) {
+				v.errorf("frame at %d: can't chop %d locals", sm.Offset, sm.Chop)
+			}
+			locals = locals[:len(locals)-sm.Chop]
+		case jclass.AppendFrame:
+			for _, typ := range sm.Locals {
+				locals = append(locals, frameType(typ))
+			}
+		case jclass.FullFrame:
+			locals = locals[:0]
+			for _, typ := range sm.Locals {
+				locals = append(locals, frameType(typ))
+			}
+		}
+
+		fr := &frame{}
+		for _, typ := range locals {
+			fr.locals = appendType(fr.locals, typ)
+		}
+		fr.locals = v.padLocals(fr.locals)
+		for _, typ := range sm.Stack {
+			fr.stack = appendType(fr.stack, frameType(typ))
+		}
+		if len(fr.stack) > int(v.code.MaxStack) {
+			v.errorf("frame at %d: stack depth exceeds max_stack=%d", sm.Offset, v.code.MaxStack)
+		}
+		offset := int(sm.Offset)
+		if !v.isInstStart(offset) {
+			v.errorf("frame at %d: offset is not an instruction start", offset)
+		}
+		frames[offset] = fr
+	}
+	return frames
+}
+
+// typecheck verifies the code against the stack map frames.
+// Every instruction is checked once, in the code order.
+func (v *verifier) typecheck(initial *frame) {
+	code := v.code.Code
+	v.cur = initial.clone()
+	fallsThrough := true
+	for pc := 0; pc < len(code); pc += bytecode.InstWidth(code, pc) {
+		v.pc = pc
+		if fr := v.frames[pc]; fr != nil {
+			if fallsThrough {
+				v.checkFrame(v.cur, fr)
+			}
+			v.cur = fr.clone()
+		} else if !fallsThrough {
+			v.errorf("no stack map frame after unconditional branch")
+		}
+		v.flowToHandlers()
+		fallsThrough = v.execute()
+	}
+	if fallsThrough {
+		v.errorf("falling off the end of the code")
+	}
+}
+
+// infer computes the instruction states with the data-flow analysis.
+// It's used for the class files that have no stack maps.
+func (v *verifier) infer(initial *frame) {
+	code := v.code.Code
+	v.states = map[int]*frame{0: initial.clone()}
+	v.worklist = append(v.worklist, 0)
+	for len(v.worklist) != 0 {
+		pc := v.worklist[len(v.worklist)-1]
+		v.worklist = v.worklist[:len(v.worklist)-1]
+		v.pc = pc
+		v.cur = v.states[pc].clone()
+		v.flowToHandlers()
+		if v.execute() {
+			next := pc + bytecode.InstWidth(code, pc)
+			if next >= len(code) {
+				v.errorf("falling off the end of the code")
+			}
+			v.flowTo(next, v.cur)
+		}
+	}
+}
+
+// flowTo records that the control can be transferred to the target pc with state fr.
+func (v *verifier) flowTo(target int, fr *frame) {
+	if !v.isInstStart(target) {
+		v.errorf("invalid branch target %d", target)
+	}
+
+	if v.frames != nil {
+		targetFrame := v.frames[target]
+		if targetFrame == nil {
+			v.errorf("no stack map frame at branch target %d", target)
+		}
+		v.checkFrame(fr, targetFrame)
+		return
+	}
+
+	old := v.states[target]
+	if old == nil {
+		v.states[target] = fr.clone()
+		v.worklist = append(v.worklist, target)
+		return
+	}
+	if len(old.stack) != len(fr.stack) {
+		v.errorf("inconsistent stack depth at %d: %d and %d", target, len(old.stack), len(fr.stack))
+	}
+	changed := false
+	for i, typ := range fr.stack {
+		merged := mergeTypes(old.stack[i], typ)
+		if merged.kind == tTop && (old.stack[i].kind != tTop || typ.kind != tTop) {
+			v.errorf("inconsistent stack types at %d: %s and %s", target, old.stack[i], typ)
+		}
+		if merged != old.stack[i] {
+			old.stack[i] = merged
+			changed = true
+		}
+	}
+	for i, typ := range fr.locals {
+		merged := mergeTypes(old.locals[i], typ)
+		if merged != old.locals[i] {
+			old.locals[i] = merged
+			changed = true
+		}
+	}
+	if changed {
+		v.worklist = append(v.worklist, target)
+	}
+}
+
+// flowToHandlers passes the current state to all exception handlers
+// that cover the current instruction.
+func (v *verifier) flowToHandlers() {
+	for _, h := range v.code.ExceptionTable {
+		if v.pc < int(h.StartPC) || v.pc >= int(h.EndPC) {
+			continue
+		}
+		exception := refType(throwableClass)
+		if h.CatchType != 0 {
+			exception = refType(v.f.Consts[h.CatchType].(*jclass.ClassConst).Name)
+		}
+		v.flowTo(int(h.HandlerPC), &frame{
+			locals: v.cur.locals,
+			stack:  []vtype{exception},
+		})
+	}
+}
+
+// checkFrame reports an error if state fr is not assignable to the frame target.
+func (v *verifier) checkFrame(fr, target *frame) {
+	if len(fr.stack) != len(target.stack) {
+		v.errorf("stack depth mismatch: have %d, frame expects %d", len(fr.stack), len(target.stack))
+	}
+	for i, typ := range fr.stack {
+		if !isAssignable(typ, target.stack[i]) {
+			v.errorf("stack[%d]: have %s, frame expects %s", i, typ, target.stack[i])
+		}
+	}
+	for i, typ := range fr.locals {
+		if !isAssignable(typ, target.locals[i]) {
+			v.errorf("local %d: have %s, frame expects %s", i, typ, target.locals[i])
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package verify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/quasilyte/go-jdk/bytecode"
+	"github.com/quasilyte/go-jdk/jclass"
+)
+
+func TestVerify(t *testing.T) {
+	const (
+		static = jclass.MethodAccessFlags(0x0008)
+		public = jclass.MethodAccessFlags(0x0001)
+	)
+
+	// Frames for the "iload_0; ifeq L; iconst_1; ireturn; L: iconst_0; ireturn" code.
+	condFrames := []jclass.StackMapFrame{
+		{Offset: 6, Kind: jclass.SameFrame},
+	}
+	condCode := []byte{
+		op(bytecode.Iload0),
+		op(bytecode.Ifeq), 0, 5,
+		op(bytecode.Iconst1),
+		op(bytecode.Ireturn),
+		op(bytecode.Iconst0),
+		op(bytecode.Ireturn),
+	}
+	loopCode := []byte{
+		op(bytecode.Iload0),
+		op(bytecode.Ifeq), 0, 9,
+		op(bytecode.Iinc), 0, 0xff,
+		op(bytecode.Goto), 0xff, 0xf9,
+		op(bytecode.Iconst0),
+		op(bytecode.Ireturn),
+	}
+	// "iload_0; lookupswitch {5: L2, default: L1}; L1: iconst_0; ireturn; L2: iconst_1; ireturn"
+	switchCode := []byte{
+		op(bytecode.Iload0),
+		op(bytecode.Lookupswitch), 0, 0,
+		0, 0, 0, 19,
+		0, 0, 0, 1,
+		0, 0, 0, 5, 0, 0, 0, 21,
+		op(bytecode.Iconst0),
+		op(bytecode.Ireturn),
+		op(bytecode.Iconst1),
+		op(bytecode.Ireturn),
+	}
+	loopFrames := []jclass.StackMapFrame{
+		{Offset: 0, Kind: jclass.SameFrame},
+		{Offset: 10, Kind: jclass.SameFrame},
+	}
+
+	tests := []struct {
+		name     string
+		flags    jclass.MethodAccessFlags
+		desc     string
+		code     []byte
+		frames   []jclass.StackMapFrame
+		handlers []jclass.ExceptionHandler
+		oldClass bool
+		err      string
+	}{
+		{
+			desc: "()I",
+			code: []byte{op(bytecode.Iconst1), op(bytecode.Ireturn)},
+		},
+		{
+			desc: "()J",
+			code: []byte{op(bytecode.Iconst1), op(bytecode.Lreturn)},
+			err:  "pc=1: stack: have int, want long",
+		},
+		{
+			desc: "()J",
+			code: []byte{op(bytecode.Iconst1), op(bytecode.Ireturn)},
+			err:  "pc=1: return: have int, want long",
+		},
+		{
+			desc: "()I",
+			code: []byte{op(bytecode.Iconst1), op(bytecode.Iadd), op(bytecode.Ireturn)},
+			err:  "pc=1: stack underflow",
+		},
+		{
+			desc: "()I",
+			code: []byte{op(bytecode.Iconst1), op(bytecode.Iconst1), op(bytecode.Iconst1), op(bytecode.Ireturn)},
+			err:  "pc=2: stack depth exceeds max_stack=2",
+		},
+		{
+			desc: "()I",
+			code: []byte{op(bytecode.Iload0), op(bytecode.Ireturn)},
+			err:  "pc=0: local 0: have top, want int",
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Iconst0)},
+			err:  "falling off the end of the code",
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Goto), 0, 1, op(bytecode.Return)},
+			err:  "pc=0: invalid branch target 1",
+		},
+		{
+			desc:   "(I)I",
+			code:   condCode,
+			frames: condFrames,
+		},
+		{
+			desc: "(I)I",
+			code: condCode,
+			err:  "pc=1: no stack map frame at branch target 6",
+		},
+		{
+			desc:     "(I)I",
+			code:     condCode,
+			oldClass: true,
+		},
+		{
+			desc: "(I)I",
+			code: condCode,
+			frames: []jclass.StackMapFrame{
+				{Offset: 6, Kind: jclass.FullFrame, Locals: []jclass.VerificationType{{Tag: jclass.VerifFloat}}},
+			},
+			err: "pc=1: local 0: have int, frame expects float",
+		},
+		{
+			desc:   "(I)I",
+			code:   loopCode,
+			frames: loopFrames,
+		},
+		{
+			desc:     "(I)I",
+			code:     loopCode,
+			oldClass: true,
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Lconst0), op(bytecode.Pop), op(bytecode.Pop), op(bytecode.Return)},
+			err:  "pc=1: stack: wide value is split",
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Lconst0), op(bytecode.Dup2), op(bytecode.Pop2), op(bytecode.Pop2), op(bytecode.Return)},
+			err:  "pc=1: stack depth exceeds max_stack=2",
+		},
+		{
+			desc: "(J)J",
+			code: []byte{op(bytecode.Lload0), op(bytecode.Lreturn)},
+		},
+		{
+			desc: "(J)J",
+			code: []byte{op(bytecode.Iconst0), op(bytecode.Istore1), op(bytecode.Lload0), op(bytecode.Lreturn)},
+			err:  "pc=2: local 0: have top, want long",
+		},
+		{
+			desc: "()I",
+			code: []byte{op(bytecode.Getstatic), 0, 5, op(bytecode.Ireturn)},
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Lconst0), op(bytecode.Putstatic), 0, 5, op(bytecode.Return)},
+			err:  "pc=1: stack: have top, want int",
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Iconst0), op(bytecode.Iconst0), op(bytecode.Invokestatic), 0, 6, op(bytecode.Return)},
+			err:  "pc=2: stack: have int, want long",
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Iconst0), op(bytecode.Lconst0), op(bytecode.Invokestatic), 0, 6, op(bytecode.Return)},
+			err:  "pc=1: stack depth exceeds max_stack=2",
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Ldc), 1, op(bytecode.Pop), op(bytecode.Ldc2w), 0, 2, op(bytecode.Pop2), op(bytecode.Return)},
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Ldc), 2, op(bytecode.Return)},
+			err:  "pc=0: ldc can't load constant #2",
+		},
+		{
+			desc: "([J)I",
+			code: []byte{op(bytecode.Aload0), op(bytecode.Iconst0), op(bytecode.Iaload), op(bytecode.Ireturn)},
+			err:  "pc=2: stack: have [J, want [I",
+		},
+		{
+			desc: "([Z)I",
+			code: []byte{op(bytecode.Aload0), op(bytecode.Iconst0), op(bytecode.Baload), op(bytecode.Ireturn)},
+		},
+		{
+			desc: "()I",
+			code: []byte{op(bytecode.Iconst1), op(bytecode.Newarray), 10, op(bytecode.Arraylength), op(bytecode.Ireturn)},
+		},
+		{
+			desc: "()I",
+			code: []byte{op(bytecode.Iconst1), op(bytecode.Arraylength), op(bytecode.Ireturn)},
+			err:  "pc=1: stack: have int, want reference",
+		},
+		{
+			name:  "<init>",
+			flags: public,
+			desc:  "()V",
+			code:  []byte{op(bytecode.Aload0), op(bytecode.Invokespecial), 0, 8, op(bytecode.Return)},
+		},
+		{
+			name:  "<init>",
+			flags: public,
+			desc:  "()V",
+			code:  []byte{op(bytecode.Return)},
+			err:   "pc=0: return: constructor didn't initialize this",
+		},
+		{
+			desc: "()LFoo;",
+			code: []byte{op(bytecode.New), 0, 4, op(bytecode.Dup), op(bytecode.Invokespecial), 0, 9, op(bytecode.Areturn)},
+		},
+		{
+			desc: "()LFoo;",
+			code: []byte{op(bytecode.New), 0, 4, op(bytecode.Areturn)},
+			err:  "pc=3: stack: have uninitialized, want Foo",
+		},
+		{
+			// The invokespecial is verified before the new,
+			// which refers to a non-class constant.
+			desc: "()V",
+			code: []byte{
+				op(bytecode.Return),
+				op(bytecode.Invokespecial), 0, 9,
+				op(bytecode.Return),
+				op(bytecode.New), 0, 1,
+				op(bytecode.Return),
+			},
+			frames: []jclass.StackMapFrame{
+				{
+					Offset: 1,
+					Kind:   jclass.SameLocals1StackItemFrame,
+					Stack:  []jclass.VerificationType{{Tag: jclass.VerifUninitialized, Offset: 5}},
+				},
+				{Offset: 5, Kind: jclass.SameFrame},
+			},
+			err: "pc=1: invokespecial: constant #1 is not a class",
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Aconstnull), op(bytecode.Invokespecial), 0, 8, op(bytecode.Return)},
+			err:  "pc=1: invokespecial: null is already initialized",
+		},
+		{
+			desc: "()I",
+			code: []byte{op(bytecode.Iconst0), op(bytecode.Ireturn), op(bytecode.Astore0), op(bytecode.Iconst1), op(bytecode.Ireturn)},
+			frames: []jclass.StackMapFrame{
+				{
+					Offset: 2,
+					Kind:   jclass.SameLocals1StackItemFrame,
+					Stack:  []jclass.VerificationType{{Tag: jclass.VerifObject, ClassName: "java/lang/Throwable"}},
+				},
+			},
+			handlers: []jclass.ExceptionHandler{{StartPC: 0, EndPC: 2, HandlerPC: 2}},
+		},
+		{
+			desc: "()I",
+			code: []byte{op(bytecode.Iconst0), op(bytecode.Ireturn), op(bytecode.Astore0), op(bytecode.Iconst1), op(bytecode.Ireturn)},
+			frames: []jclass.StackMapFrame{
+				{
+					Offset: 2,
+					Kind:   jclass.SameLocals1StackItemFrame,
+					Stack:  []jclass.VerificationType{{Tag: jclass.VerifInteger}},
+				},
+			},
+			handlers: []jclass.ExceptionHandler{{StartPC: 0, EndPC: 2, HandlerPC: 2}},
+			err:      "pc=0: stack[0]: have java/lang/Throwable, frame expects int",
+		},
+		{
+			desc:     "()I",
+			code:     []byte{op(bytecode.Iconst0), op(bytecode.Ireturn), op(bytecode.Astore0), op(bytecode.Iconst1), op(bytecode.Ireturn)},
+			handlers: []jclass.ExceptionHandler{{StartPC: 0, EndPC: 2, HandlerPC: 2}},
+			oldClass: true,
+		},
+		{
+			desc:     "(I)I",
+			code:     switchCode,
+			oldClass: true,
+		},
+		{
+			desc: "(I)I",
+			code: switchCode,
+			frames: []jclass.StackMapFrame{
+				{Offset: 20, Kind: jclass.SameFrame},
+				{Offset: 22, Kind: jclass.SameFrame},
+			},
+		},
+		{
+			desc: "(I)I",
+			code: switchCode,
+			frames: []jclass.StackMapFrame{
+				{Offset: 20, Kind: jclass.SameFrame},
+			},
+			err: "pc=1: no stack map frame at branch target 22",
+		},
+		{
+			desc: "(J)V",
+			code: []byte{
+				op(bytecode.Lload0),
+				op(bytecode.Tableswitch), 0, 0,
+				0, 0, 0, 19,
+				0, 0, 0, 0,
+				0, 0, 0, 0,
+				0, 0, 0, 19,
+				op(bytecode.Return),
+			},
+			oldClass: true,
+			err:      "pc=1: stack: have top, want int",
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Iconst0), op(bytecode.Tableswitch), 0, 0, 0, 0, 0, 4},
+			err:  "pc=1: switch is truncated",
+		},
+		{
+			desc: "()I",
+			code: []byte{
+				op(bytecode.Iconst1),
+				op(bytecode.Wide), op(bytecode.Istore), 0, 1,
+				op(bytecode.Wide), op(bytecode.Iinc), 0, 1, 0x01, 0x00,
+				op(bytecode.Wide), op(bytecode.Iload), 0, 1,
+				op(bytecode.Ireturn),
+			},
+		},
+		{
+			desc: "()I",
+			code: []byte{op(bytecode.Wide), op(bytecode.Iload), 0x01, 0x00, op(bytecode.Ireturn)},
+			err:  "pc=0: local 256 exceeds max_locals=2",
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Wide), op(bytecode.Iadd), 0, 0, op(bytecode.Return)},
+			err:  "pc=0: wide: can't be applied to iadd",
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Return), op(bytecode.Wide), op(bytecode.Iinc), 0, 0},
+			err:  "pc=1: wide is truncated",
+		},
+		{
+			desc: "()V",
+			code: []byte{op(bytecode.Jsr), 0, 3, op(bytecode.Return)},
+			err:  "pc=0: jsr is not permitted in class file version 52.0",
+		},
+		{
+			// "jsr L; return; L: astore_1; ret 1"
+			desc: "()V",
+			code: []byte{
+				op(bytecode.Jsr), 0, 4,
+				op(bytecode.Return),
+				op(bytecode.Astore1),
+				op(bytecode.Ret), 1,
+			},
+			oldClass: true,
+			err:      "pc=0: jsr: subroutines of class file version 49.0 are not supported",
+		},
+		{
+			desc: "()Ljava/lang/Object;",
+			code: []byte{
+				op(bytecode.Aconstnull),
+				op(bytecode.Checkcast), 0, 10,
+				op(bytecode.Iconst0),
+				op(bytecode.Aaload),
+				op(bytecode.Areturn),
+			},
+			err: `pc=1: invalid class name "["`,
+		},
+		{
+			desc: "()Ljava/lang/Object;",
+			code: []byte{
+				op(bytecode.Aconstnull),
+				op(bytecode.Checkcast), 0, 11,
+				op(bytecode.Iconst0),
+				op(bytecode.Aaload),
+				op(bytecode.Areturn),
+			},
+			err: `pc=1: invalid class name "[L"`,
+		},
+		{
+			desc: "(L",
+			code: []byte{op(bytecode.Return)},
+			err:  `invalid method descriptor "(L"`,
+		},
+		{
+			desc: "([",
+			code: []byte{op(bytecode.Return)},
+			err:  `invalid method descriptor "(["`,
+		},
+		{
+			desc: "",
+			code: []byte{op(bytecode.Return)},
+			err:  `invalid method descriptor ""`,
+		},
+		{
+			desc:     "()V",
+			code:     []byte{op(bytecode.Wide), op(bytecode.Ret), 0, 1, op(bytecode.Return)},
+			oldClass: true,
+			err:      "pc=0: ret: subroutines of class file version 49.0 are not supported",
+		},
+	}
+
+	for _, test := range tests {
+		if test.name == "" {
+			test.name = "f"
+			test.flags = static
+		}
+		f := newTestFile()
+		if test.oldClass {
+			f.Ver.Major = 49
+		}
+		code := jclass.CodeAttribute{
+			MaxStack:       2,
+			MaxLocals:      2,
+			Code:           test.code,
+			ExceptionTable: test.handlers,
+		}
+		if test.frames != nil {
+			code.Attrs = []jclass.Attribute{jclass.StackMapTableAttribute{Frames: test.frames}}
+		}
+		f.Methods = []jclass.Method{{
+			AccessFlags: test.flags,
+			Name:        test.name,
+			Descriptor:  test.desc,
+			Attrs:       []jclass.Attribute{code},
+		}}
+
+		err := File(f)
+		have := "<nil>"
+		if err != nil {
+			have = err.Error()
+		}
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s%s %x: unexpected error: %v", test.name, test.desc, test.code, err)
+			}
+			continue
+		}
+		if !strings.Contains(have, test.err) {
+			t.Errorf("%s%s %x: error mismatch:\nhave: %s\nwant: %s",
+				test.name, test.desc, test.code, have, test.err)
+		}
+	}
+}
+
+func op(op bytecode.Op) byte { return byte(op) }
+
+func newTestFile() *jclass.File {
+	return &jclass.File{
+		Ver:           jclass.Version{Major: 52},
+		ThisClassName: "Foo",
+		SuperClass:    7,
+		Consts: []jclass.Const{
+			1: &jclass.IntConst{Value: 10},
+			2: &jclass.LongConst{Value: 20},
+			4: &jclass.ClassConst{Name: "Foo"},
+			5: &jclass.FieldrefConst{ClassName: "Foo", Name: "x", Descriptor: "I"},
+			6: &jclass.MethodrefConst{ClassName: "Foo", Name: "g", Descriptor: "(IJ)V"},
+			7: &jclass.ClassConst{Name: "java/lang/Object"},
+			8: &jclass.MethodrefConst{ClassName: "java/lang/Object", Name: "<init>", Descriptor: "()V"},
+			9: &jclass.MethodrefConst{ClassName: "Foo", Name: "<init>", Descriptor: "()V"},
+			// Malformed class names are accepted by the decoder.
+			10: &jclass.ClassConst{Name: "["},
+			11: &jclass.ClassConst{Name: "[L"},
+		},
+	}
+}
@@ -12,11 +12,16 @@ type State struct {
 	Packages      []*Package
 	pkgname2index map[string]uint32
 	GoFuncs       map[string]uintptr
+
+	// GoFuncValues maps the same keys as GoFuncs to the bound func values.
+	// They're used when machine code addresses can't be called directly.
+	GoFuncValues map[string]interface{}
 }
 
 func (st *State) Init() {
 	st.Packages = make([]*Package, 0, 32)
 	st.GoFuncs = map[string]uintptr{}
+	st.GoFuncValues = map[string]interface{}{}
 	st.pkgname2index = map[string]uint32{}
 }
 
@@ -37,6 +42,7 @@ func (st *State) BindGoFunc(name string, fn interface{}) {
 	e := (*emptyInterface)(unsafe.Pointer(&fn))
 	addr := *e.value
 	st.GoFuncs[name] = addr
+	st.GoFuncValues[name] = fn
 }
 
 func (st *State) NewPackage(name string) *Package {